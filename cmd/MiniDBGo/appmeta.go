@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Metadata của server (view, field nhạy cảm...) được lưu trong engine dưới
+// các key ứng dụng engine.AppKeyPrefix+<tên>, dạng JSON; engine không hiểu
+// chúng nhưng dump/restore mang theo.
+
+// appMetaMu tuần tự hóa các lần đọc-sửa-ghi metadata ứng dụng
+var appMetaMu sync.Mutex
+
+// loadAppMeta đọc metadata ứng dụng name (JSON dưới engine.AppKeyPrefix) vào
+// v; chưa có thì v giữ nguyên
+func loadAppMeta(db engine.Engine, name string, v interface{}) error {
+	raw, err := db.Get([]byte(engine.AppKeyPrefix + name))
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// updateAppMeta đọc metadata name vào v, gọi update rồi ghi lại v
+func updateAppMeta(db engine.Engine, name string, v interface{}, update func() error) error {
+	appMetaMu.Lock()
+	defer appMetaMu.Unlock()
+	if err := loadAppMeta(db, name, v); err != nil {
+		return err
+	}
+	if err := update(); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return db.Put([]byte(engine.AppKeyPrefix+name), raw)
+}
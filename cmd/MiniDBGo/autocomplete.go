@@ -12,8 +12,8 @@ type completer struct {
 }
 
 var allCommands = []string{
-	"insertOne", "insertMany", "findOne", "findMany", "updateOne", "deleteOne",
-	"dumpAll", "dumpDB", "restoreDB", "compact", "exit",
+	"insertOne", "insertMany", "findOne", "findMany", "updateOne", "deleteOne", "updateMany", "deleteMany", "findOneAndUpdate", "findOneAndDelete", "count", "distinct", "drop",
+	"dumpAll", "dumpDB", "exportMeta", "restoreDB", "compact", "verify", "createIndex", "listIndexes", "createTextIndex", "textSearch", "setCoercion", "setReference", "exit",
 }
 
 // Do is called by chzyer/readline.
@@ -72,7 +72,8 @@ func (c completer) Do(line []rune, pos int) ([][]rune, int) {
 		cmdName = strings.ToLower(cmdName)
 		cmdsWithColl := map[string]bool{
 			"insertone": true, "insertmany": true, "findone": true, "findmany": true,
-			"updateone": true, "deleteone": true, "dumpall": true,
+			"updateone": true, "deleteone": true, "updatemany": true, "deletemany": true, "drop": true, "dumpall": true,
+			"createindex": true, "listindexes": true, "setcoercion": true,
 		}
 		if !cmdsWithColl[cmdName] {
 			return nil, 0 // [cite: 61]
@@ -96,6 +97,9 @@ func (c completer) Do(line []rune, pos int) ([][]rune, int) {
 			}
 
 			k := it.Key()
+			if engine.IsSystemKey(k) {
+				continue
+			}
 			if idx := strings.Index(k, ":"); idx >= 0 { // [cite: 63]
 				colSet[k[:idx]] = struct{}{}
 			}
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Chaos mode (chỉ dùng khi kiểm thử): thêm độ trễ và lỗi giả vào các lần gọi
+// engine và response HTTP, để kiểm tra logic retry/timeout của client với
+// một CSDL "hành xử tệ". Bật bằng CHAOS=true, chỉnh khi đang chạy qua /api/_chaos.
+
+var errChaos = errors.New("chaos: injected engine error")
+
+// ChaosConfig là cấu hình lỗi giả; tỉ lệ tính theo phần trăm (0..100)
+type ChaosConfig struct {
+	EngineLatencyMs    int     `json:"engine_latency_ms"`    // Trễ thêm cho mỗi lần gọi engine
+	HTTPLatencyMs      int     `json:"http_latency_ms"`      // Trễ thêm trước khi xử lý request
+	JitterMs           int     `json:"jitter_ms"`            // Trễ ngẫu nhiên 0..jitter cộng vào cả hai loại trên
+	EngineErrorPercent float64 `json:"engine_error_percent"` // Lần gọi engine trả về lỗi
+	HTTPErrorPercent   float64 `json:"http_error_percent"`   // Request nhận 503 mà không được xử lý
+	HTTPAbortPercent   float64 `json:"http_abort_percent"`   // Request bị cắt kết nối, không có response
+}
+
+// ChaosConfigPatch là phần cần đổi (field nil được giữ nguyên)
+type ChaosConfigPatch struct {
+	EngineLatencyMs    *int     `json:"engine_latency_ms"`
+	HTTPLatencyMs      *int     `json:"http_latency_ms"`
+	JitterMs           *int     `json:"jitter_ms"`
+	EngineErrorPercent *float64 `json:"engine_error_percent"`
+	HTTPErrorPercent   *float64 `json:"http_error_percent"`
+	HTTPAbortPercent   *float64 `json:"http_abort_percent"`
+}
+
+// chaosConfigFromEnv trả về nil nếu CHAOS không bật
+func chaosConfigFromEnv() *ChaosConfig {
+	if on, _ := strconv.ParseBool(os.Getenv("CHAOS")); !on {
+		return nil
+	}
+	cfg := &ChaosConfig{}
+	envInt := func(name string, dst *int) {
+		if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+			*dst = n
+		}
+	}
+	envPercent := func(name string, dst *float64) {
+		if p, err := strconv.ParseFloat(os.Getenv(name), 64); err == nil && p >= 0 && p <= 100 {
+			*dst = p
+		}
+	}
+	envInt("CHAOS_ENGINE_LATENCY_MS", &cfg.EngineLatencyMs)
+	envInt("CHAOS_HTTP_LATENCY_MS", &cfg.HTTPLatencyMs)
+	envInt("CHAOS_JITTER_MS", &cfg.JitterMs)
+	envPercent("CHAOS_ENGINE_ERROR_PERCENT", &cfg.EngineErrorPercent)
+	envPercent("CHAOS_HTTP_ERROR_PERCENT", &cfg.HTTPErrorPercent)
+	envPercent("CHAOS_HTTP_ABORT_PERCENT", &cfg.HTTPAbortPercent)
+	return cfg
+}
+
+type chaosInjector struct {
+	mu  sync.Mutex
+	cfg ChaosConfig
+
+	delayed      atomic.Int64 // Số lần đã thêm độ trễ
+	engineErrors atomic.Int64
+	httpErrors   atomic.Int64
+	httpAborts   atomic.Int64
+}
+
+func newChaosInjector(cfg ChaosConfig) *chaosInjector {
+	c := &chaosInjector{cfg: cfg}
+	slog.Warn("Chaos mode enabled: latency and errors are injected on purpose", "component", "chaos",
+		"engine_latency_ms", cfg.EngineLatencyMs, "http_latency_ms", cfg.HTTPLatencyMs, "jitter_ms", cfg.JitterMs,
+		"engine_error_percent", cfg.EngineErrorPercent, "http_error_percent", cfg.HTTPErrorPercent,
+		"http_abort_percent", cfg.HTTPAbortPercent)
+	return c
+}
+
+func (c *chaosInjector) current() ChaosConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cfg
+}
+
+func (c *chaosInjector) update(p ChaosConfigPatch) (ChaosConfig, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cfg := c.cfg
+	for _, ms := range []struct {
+		v   *int
+		dst *int
+	}{{p.EngineLatencyMs, &cfg.EngineLatencyMs}, {p.HTTPLatencyMs, &cfg.HTTPLatencyMs}, {p.JitterMs, &cfg.JitterMs}} {
+		if ms.v != nil {
+			if *ms.v < 0 {
+				return c.cfg, fmt.Errorf("latency must be >= 0")
+			}
+			*ms.dst = *ms.v
+		}
+	}
+	for _, pct := range []struct {
+		v   *float64
+		dst *float64
+	}{{p.EngineErrorPercent, &cfg.EngineErrorPercent}, {p.HTTPErrorPercent, &cfg.HTTPErrorPercent}, {p.HTTPAbortPercent, &cfg.HTTPAbortPercent}} {
+		if pct.v != nil {
+			if *pct.v < 0 || *pct.v > 100 {
+				return c.cfg, fmt.Errorf("error percent must be between 0 and 100")
+			}
+			*pct.dst = *pct.v
+		}
+	}
+	c.cfg = cfg
+	slog.Info("Chaos config updated", "component", "chaos", "config", cfg)
+	return cfg, nil
+}
+
+// sleep chờ base+jitter mili giây hoặc tới khi ctx hết hạn
+func (c *chaosInjector) sleep(ctx context.Context, baseMs, jitterMs int) error {
+	d := time.Duration(baseMs) * time.Millisecond
+	if jitterMs > 0 {
+		d += time.Duration(rand.Intn(jitterMs+1)) * time.Millisecond
+	}
+	if d <= 0 {
+		return nil
+	}
+	c.delayed.Add(1)
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// engineFault được gọi trước mỗi lần gọi engine: thêm độ trễ, có thể trả về lỗi giả
+func (c *chaosInjector) engineFault(ctx context.Context) error {
+	cfg := c.current()
+	if err := c.sleep(ctx, cfg.EngineLatencyMs, cfg.JitterMs); err != nil {
+		return err
+	}
+	if cfg.EngineErrorPercent > 0 && rand.Float64()*100 < cfg.EngineErrorPercent {
+		c.engineErrors.Add(1)
+		return errChaos
+	}
+	return nil
+}
+
+// middleware áp dụng lỗi giả ở tầng HTTP. /api/_chaos được miễn để luôn tắt được chaos.
+func (c *chaosInjector) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/_chaos" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cfg := c.current()
+		if err := c.sleep(r.Context(), cfg.HTTPLatencyMs, cfg.JitterMs); err != nil {
+			return // Client đã bỏ đi
+		}
+		roll := rand.Float64() * 100
+		switch {
+		case roll < cfg.HTTPAbortPercent:
+			c.httpAborts.Add(1)
+			panic(http.ErrAbortHandler) // net/http đóng kết nối, không ghi response
+		case roll < cfg.HTTPAbortPercent+cfg.HTTPErrorPercent:
+			c.httpErrors.Add(1)
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, "chaos: injected failure")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *chaosInjector) metrics() map[string]int64 {
+	return map[string]int64{
+		"chaos_delayed":       c.delayed.Load(),
+		"chaos_engine_errors": c.engineErrors.Load(),
+		"chaos_http_errors":   c.httpErrors.Load(),
+		"chaos_http_aborts":   c.httpAborts.Load(),
+	}
+}
+
+// chaosEngine bọc engine.Engine: các thao tác đọc/ghi dữ liệu đi qua engineFault,
+// các thao tác quản trị (Close, metrics, index...) được chuyển thẳng
+type chaosEngine struct {
+	engine.Engine
+	chaos *chaosInjector
+}
+
+func (e *chaosEngine) Put(key, value []byte) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.Put(key, value)
+}
+
+func (e *chaosEngine) Update(key, value []byte) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.Update(key, value)
+}
+
+func (e *chaosEngine) Delete(key []byte) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.Delete(key)
+}
+
+func (e *chaosEngine) Get(key []byte) ([]byte, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.Get(key)
+}
+
+func (e *chaosEngine) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := e.chaos.engineFault(ctx); err != nil {
+		return nil, err
+	}
+	return e.Engine.GetContext(ctx, key)
+}
+
+func (e *chaosEngine) GetTrace(ctx context.Context, key []byte) ([]byte, *engine.ReadTrace, error) {
+	if err := e.chaos.engineFault(ctx); err != nil {
+		return nil, nil, err
+	}
+	return e.Engine.GetTrace(ctx, key)
+}
+
+func (e *chaosEngine) GetItem(ctx context.Context, key []byte) (*engine.Item, error) {
+	if err := e.chaos.engineFault(ctx); err != nil {
+		return nil, err
+	}
+	return e.Engine.GetItem(ctx, key)
+}
+
+func (e *chaosEngine) Exists(key []byte) (bool, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return false, err
+	}
+	return e.Engine.Exists(key)
+}
+
+func (e *chaosEngine) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	if err := e.chaos.engineFault(ctx); err != nil {
+		return nil, err
+	}
+	return e.Engine.MultiGet(ctx, keys)
+}
+
+func (e *chaosEngine) FindOneAndUpdate(key []byte, fn func(old []byte) ([]byte, error)) ([]byte, []byte, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, nil, err
+	}
+	return e.Engine.FindOneAndUpdate(key, fn)
+}
+
+func (e *chaosEngine) FindOneAndDelete(key []byte, match func(old []byte) bool) ([]byte, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.FindOneAndDelete(key, match)
+}
+
+func (e *chaosEngine) ApplyBatch(b engine.Batch) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.ApplyBatch(b)
+}
+
+func (e *chaosEngine) NewIterator() (engine.Iterator, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.NewIterator()
+}
+
+func (e *chaosEngine) NewPrefixIterator(prefix string) (engine.Iterator, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.NewPrefixIterator(prefix)
+}
+
+func (e *chaosEngine) NewPrefixIteratorContext(ctx context.Context, prefix string) (engine.Iterator, error) {
+	if err := e.chaos.engineFault(ctx); err != nil {
+		return nil, err
+	}
+	return e.Engine.NewPrefixIteratorContext(ctx, prefix)
+}
+
+func (e *chaosEngine) Snapshot() (engine.Snapshot, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.Snapshot()
+}
+
+func (e *chaosEngine) Begin() (engine.Txn, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.Begin()
+}
+
+func (e *chaosEngine) DeletePrefix(prefix string, match func(key string, value []byte) bool) (int, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return 0, err
+	}
+	return e.Engine.DeletePrefix(prefix, match)
+}
+
+func (e *chaosEngine) DeleteRange(start, end []byte) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.DeleteRange(start, end)
+}
+
+func (e *chaosEngine) DropCollection(collection string) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.DropCollection(collection)
+}
+
+func (e *chaosEngine) ReplaceCollection(collection string, load func(apply func(engine.Batch) error) error) error {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return err
+	}
+	return e.Engine.ReplaceCollection(collection, load)
+}
+
+func (e *chaosEngine) IndexLookup(collection, field string, r engine.IndexRange) ([]string, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.IndexLookup(collection, field, r)
+}
+
+func (e *chaosEngine) IndexScan(collection, index string, eq []interface{}, r engine.IndexRange) ([]string, error) {
+	if err := e.chaos.engineFault(context.Background()); err != nil {
+		return nil, err
+	}
+	return e.Engine.IndexScan(collection, index, eq, r)
+}
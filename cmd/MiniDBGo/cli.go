@@ -39,14 +39,44 @@ func RunCLI(db engine.Engine, rl *readline.Instance) { //
 			handleUpdateOne(db, rest)
 		case "deleteone":
 			handleDeleteOne(db, rest)
+		case "updatemany":
+			handleUpdateMany(db, rest)
+		case "deletemany":
+			handleDeleteMany(db, rest)
+		case "drop":
+			handleDrop(db, rest)
+		case "count":
+			handleCount(db, rest)
+		case "distinct":
+			handleDistinct(db, rest)
+		case "findoneandupdate":
+			handleFindOneAndUpdate(db, rest)
+		case "findoneanddelete":
+			handleFindOneAndDelete(db, rest)
 		case "dumpall":
 			handleDumpAll(db, rest) // [cite: 240]
 		case "dumpdb":
 			handleDumpDB(db, rest)
+		case "exportmeta":
+			handleExportMeta(db, rest)
 		case "restoredb":
 			handleRestoreDB(db, rest)
 		case "compact":
 			handleCompact(db)
+		case "verify":
+			handleVerify(db)
+		case "createindex":
+			handleCreateIndex(db, rest)
+		case "listindexes":
+			handleListIndexes(db, rest)
+		case "createtextindex":
+			handleCreateTextIndex(db, rest)
+		case "textsearch":
+			handleTextSearch(db, rest)
+		case "setcoercion":
+			handleSetCoercion(db, rest)
+		case "setreference":
+			handleSetReference(db, rest)
 		case "exit", "quit":
 			fmt.Println("Bye!")
 			return
@@ -1,12 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
 
 	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
 )
 
 // insertOne <collection> <jsonDoc>
@@ -123,70 +125,119 @@ func handleFindOne(db engine.Engine, rest string) {
 	fmt.Println(prettyJSON(val))
 }
 
-// findMany <collection> <jsonFilter>
+// findMany <collection> <jsonFilter> [jsonCollation]
 func handleFindMany(db engine.Engine, rest string) {
 	parts := splitArgs(rest, 2)
 	if len(parts) < 2 {
-		fmt.Println("Usage: findMany <collection> <jsonFilter>")
+		fmt.Println("Usage: findMany <collection> <jsonFilter> [jsonCollation]")
 		return
 	}
 	col := parts[0]
-	filterStr := parts[1]
+	filterStr, collStr := splitJSONArg(parts[1])
 
 	var filter map[string]interface{}
 	if err := json.Unmarshal([]byte(filterStr), &filter); err != nil { // [cite: 43]
 		fmt.Println("Invalid filter JSON:", err)
 		return
 	}
-
-	it, err := db.NewIterator()
-	if err != nil {
-		fmt.Println("Iterator error:", err)
-		return
+	var coll *query.Collation
+	if collStr != "" {
+		var err error
+		if coll, err = query.ParseCollation([]byte(collStr)); err != nil {
+			fmt.Println("Invalid collation:", err)
+			return
+		}
 	}
-	defer it.Close()
 
 	matchCount := 0
-	prefix := col + ":"
-
-	for it.Next() {
-		key := it.Key()
-		if !strings.HasPrefix(key, prefix) {
-			continue
-		}
-
+	err := forEachMatch(context.Background(), db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
 		if matchCount >= 1000 { // Giới hạn như cũ
 			fmt.Println("... (results truncated at 1000)")
-			break
+			return false
 		}
+		fmt.Println(prettyJSON(raw))
+		matchCount++
+		return true
+	})
+	if err != nil {
+		fmt.Println("Iterator error:", err)
+	}
+}
 
-		val := it.Value().Value
-		var doc map[string]interface{}
-		if err := json.Unmarshal(val, &doc); err != nil { // [cite: 44]
-			continue
+// count <collection> [jsonFilter] [jsonCollation]
+func handleCount(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 2)
+	if len(parts) < 1 || parts[0] == "" {
+		fmt.Println("Usage: count <collection> [jsonFilter] [jsonCollation]")
+		return
+	}
+	filter := map[string]interface{}{}
+	var coll *query.Collation
+	if len(parts) == 2 {
+		filterStr, collStr := splitJSONArg(parts[1])
+		if err := json.Unmarshal([]byte(filterStr), &filter); err != nil {
+			fmt.Println("Invalid filter JSON:", err)
+			return
 		}
-
-		if matchFilter(doc, filter) {
-			fmt.Println(prettyJSON(val))
-			matchCount++
+		if collStr != "" {
+			var err error
+			if coll, err = query.ParseCollation([]byte(collStr)); err != nil {
+				fmt.Println("Invalid collation:", err)
+				return
+			}
 		}
 	}
+	n, err := countMatches(context.Background(), db, parts[0], filter, coll)
+	if err != nil {
+		fmt.Println("Count error:", err)
+		return
+	}
+	fmt.Println(n)
+}
 
-	if err := it.Error(); err != nil {
-		fmt.Println("Iterator error:", err)
+// distinct <collection> <field> [jsonFilter]
+func handleDistinct(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 3)
+	if len(parts) < 2 {
+		fmt.Println("Usage: distinct <collection> <field> [jsonFilter]")
+		return
+	}
+	filter := map[string]interface{}{}
+	if len(parts) == 3 {
+		if err := json.Unmarshal([]byte(parts[2]), &filter); err != nil {
+			fmt.Println("Invalid filter JSON:", err)
+			return
+		}
+	}
+	values, err := distinctValues(context.Background(), db, parts[0], parts[1], filter, nil)
+	if err != nil {
+		fmt.Println("Distinct error:", err)
+		return
 	}
+	out, _ := json.MarshalIndent(values, "", "  ")
+	fmt.Println(string(out))
 }
 
-// updateOne <collection> <jsonFilter> <jsonUpdate>
+// updateOne <collection> <jsonFilter> <jsonUpdate> [{"upsert":true}]
 func handleUpdateOne(db engine.Engine, rest string) {
 	parts := splitArgs(rest, 3)
 	if len(parts) < 3 {
-		fmt.Println("Usage: updateOne <collection> <jsonFilter> <jsonUpdate>")
+		fmt.Println("Usage: updateOne <collection> <jsonFilter> <jsonUpdate> [{\"upsert\":true}]")
 		return
 	}
 	col := parts[0]
 	filterStr := parts[1]
-	updateStr := parts[2]
+	updateStr, optsStr := splitJSONArg(parts[2])
+
+	var opts struct {
+		Upsert bool `json:"upsert"`
+	}
+	if optsStr != "" {
+		if err := json.Unmarshal([]byte(optsStr), &opts); err != nil {
+			fmt.Println("Invalid options JSON:", err)
+			return
+		}
+	}
 
 	var filter map[string]interface{}
 	if err := json.Unmarshal([]byte(filterStr), &filter); err != nil {
@@ -199,31 +250,154 @@ func handleUpdateOne(db engine.Engine, rest string) {
 		return
 	}
 	key := col + ":" + id
-	val, err := db.Get([]byte(key))
+
+	var update map[string]interface{}
+	if err := json.Unmarshal([]byte(updateStr), &update); err != nil {
+		fmt.Println("Invalid update JSON:", err)
+		return
+	}
+	var seed map[string]interface{}
+	if opts.Upsert {
+		var err error
+		if seed, err = upsertSeed(id, filter); err != nil {
+			fmt.Println("Update error:", err)
+			return
+		}
+	}
+	_, created, err := updateByKey(db, []byte(key), update, seed)
 	if err != nil {
-		fmt.Println("Error:", err)
+		fmt.Println("Update error:", err)
 		return
 	}
-	var doc map[string]interface{}
-	_ = json.Unmarshal(val, &doc)
+	if created {
+		fmt.Println("Inserted", id, "into", col)
+		return
+	}
+	fmt.Println("Updated", id, "in", col)
+}
 
-	var update map[string]map[string]interface{}
+// findOneAndUpdate <collection> <jsonFilter> <jsonUpdate>
+func handleFindOneAndUpdate(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 2)
+	if len(parts) < 2 {
+		fmt.Println("Usage: findOneAndUpdate <collection> <jsonFilter> <jsonUpdate>")
+		return
+	}
+	col := parts[0]
+	filterStr, updateStr := splitJSONArg(parts[1])
+
+	var filter, update map[string]interface{}
+	if err := json.Unmarshal([]byte(filterStr), &filter); err != nil {
+		fmt.Println("Invalid filter JSON:", err)
+		return
+	}
 	if err := json.Unmarshal([]byte(updateStr), &update); err != nil {
 		fmt.Println("Invalid update JSON:", err)
 		return
 	}
-	if set, ok := update["$set"]; ok {
-		for k, v := range set {
-			doc[k] = v
-		}
+
+	before, after, err := findOneAndUpdate(context.Background(), db, col, filter, update, nil)
+	if err != nil {
+		fmt.Println("Update error:", err)
+		return
+	}
+	if before == nil {
+		fmt.Println("No matching document")
+		return
 	}
+	fmt.Println("Before:", prettyDoc(before))
+	fmt.Println("After:", prettyDoc(after))
+}
 
-	raw, _ := json.Marshal(doc)
-	if err := db.Put([]byte(key), raw); err != nil {
+// findOneAndDelete <collection> <jsonFilter>
+func handleFindOneAndDelete(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 2)
+	if len(parts) < 2 {
+		fmt.Println("Usage: findOneAndDelete <collection> <jsonFilter>")
+		return
+	}
+	col := parts[0]
+
+	var filter map[string]interface{}
+	if err := json.Unmarshal([]byte(parts[1]), &filter); err != nil {
+		fmt.Println("Invalid filter JSON:", err)
+		return
+	}
+
+	doc, err := findOneAndDelete(context.Background(), db, col, filter, nil)
+	if err != nil {
+		fmt.Println("Delete error:", err)
+		return
+	}
+	if doc == nil {
+		fmt.Println("No matching document")
+		return
+	}
+	fmt.Println("Deleted:", prettyDoc(doc))
+}
+
+// updateMany <collection> <jsonFilter> <jsonUpdate>
+func handleUpdateMany(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 3)
+	if len(parts) < 3 {
+		fmt.Println("Usage: updateMany <collection> <jsonFilter> <jsonUpdate>")
+		return
+	}
+	col := parts[0]
+
+	var filter, update map[string]interface{}
+	if err := json.Unmarshal([]byte(parts[1]), &filter); err != nil {
+		fmt.Println("Invalid filter JSON:", err)
+		return
+	}
+	if err := json.Unmarshal([]byte(parts[2]), &update); err != nil {
+		fmt.Println("Invalid update JSON:", err)
+		return
+	}
+
+	n, err := updateMany(context.Background(), db, col, filter, update, nil)
+	if err != nil {
 		fmt.Println("Update error:", err)
 		return
 	}
-	fmt.Println("Updated", id, "in", col)
+	fmt.Printf("Updated %d documents in %s\n", n, col)
+}
+
+// deleteMany <collection> <jsonFilter>
+func handleDeleteMany(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 2)
+	if len(parts) < 2 {
+		fmt.Println("Usage: deleteMany <collection> <jsonFilter>")
+		return
+	}
+	col := parts[0]
+
+	var filter map[string]interface{}
+	if err := json.Unmarshal([]byte(parts[1]), &filter); err != nil {
+		fmt.Println("Invalid filter JSON:", err)
+		return
+	}
+
+	n, err := deleteMany(context.Background(), db, col, filter, nil)
+	if err != nil {
+		fmt.Println("Delete error:", err)
+		return
+	}
+	fmt.Printf("Deleted %d documents from %s\n", n, col)
+}
+
+// drop <collection>
+func handleDrop(db engine.Engine, rest string) {
+	col := strings.TrimSpace(rest)
+	if col == "" || strings.ContainsAny(col, " \t") {
+		fmt.Println("Usage: drop <collection>")
+		return
+	}
+	if err := db.DropCollection(col); err != nil {
+		fmt.Println("Drop error:", err)
+		return
+	}
+	fmt.Printf("Dropped collection %s\n", col)
 }
 
 // deleteOne <collection> <jsonFilter>
@@ -264,7 +438,7 @@ func handleDumpAll(db engine.Engine, rest string) { //
 	}
 	col := parts[0]
 
-	it, err := db.NewIterator()
+	it, err := db.NewPrefixIterator(col + ":")
 	if err != nil {
 		fmt.Println("Iterator error:", err)
 		return
@@ -274,19 +448,15 @@ func handleDumpAll(db engine.Engine, rest string) { //
 	// Logic OOM cũ dùng IterKeysWithLimit bị xóa
 
 	matchCount := 0
-	prefix := col + ":"
-
 	for it.Next() {
-		if strings.HasPrefix(it.Key(), prefix) {
-			if matchCount >= 1000 {
-				fmt.Println("... (results truncated at 1000)")
-				break
-			}
-
-			val := it.Value().Value
-			fmt.Println(prettyJSON(val))
-			matchCount++
+		if matchCount >= 1000 {
+			fmt.Println("... (results truncated at 1000)")
+			break
 		}
+
+		val := it.Value().Value
+		fmt.Println(prettyJSON(val))
+		matchCount++
 	}
 
 	if err := it.Error(); err != nil {
@@ -306,6 +476,19 @@ func handleDumpDB(db engine.Engine, rest string) {
 	fmt.Println("Dumped DB to", file)
 }
 
+// exportMeta [file.json]
+func handleExportMeta(db engine.Engine, rest string) {
+	file := fmt.Sprintf("meta_%s.json", time.Now().Format("150405_02012006"))
+	if parts := splitArgs(rest, 1); len(parts) == 1 && parts[0] != "" {
+		file = parts[0]
+	}
+	if err := db.ExportMeta(file); err != nil {
+		fmt.Println("Export meta error:", err)
+		return
+	}
+	fmt.Println("Exported metadata to", file)
+}
+
 // restoreDB <file.json>
 func handleRestoreDB(db engine.Engine, rest string) {
 	parts := splitArgs(rest, 1)
@@ -330,8 +513,192 @@ func handleCompact(db engine.Engine) {
 	fmt.Println("Compaction complete")
 }
 
+// verify
+func handleVerify(db engine.Engine) {
+	checks, err := db.VerifyTables(context.Background())
+	if err != nil {
+		fmt.Println("Verify error:", err)
+		return
+	}
+	corrupt := 0
+	for _, c := range checks {
+		if c.Error != "" {
+			corrupt++
+			fmt.Printf("L%d %s: %s\n", c.Level, c.Path, c.Error)
+		}
+	}
+	fmt.Printf("Verified %d SSTables, %d corrupt\n", len(checks), corrupt)
+}
+
+// createIndex <collection> <field[,field...]> [unique] [jsonCollation]
+func handleCreateIndex(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 3)
+	if len(parts) < 2 {
+		fmt.Println("Usage: createIndex <collection> <field[,field...]> [unique] [jsonCollation]")
+		return
+	}
+	var opts engine.IndexOptions
+	if len(parts) == 3 {
+		raw := parts[2]
+		if strings.HasPrefix(raw, "unique") {
+			opts.Unique = true
+			raw = strings.TrimSpace(strings.TrimPrefix(raw, "unique"))
+		}
+		if raw != "" {
+			var err error
+			if opts.Collation, err = query.ParseCollation([]byte(raw)); err != nil {
+				fmt.Println("Invalid collation:", err)
+				return
+			}
+		}
+	}
+	if err := db.CreateIndex(parts[0], parts[1], opts); err != nil {
+		fmt.Println("Create index error:", err)
+		return
+	}
+	fmt.Println("Index created on", parts[0]+"."+parts[1])
+}
+
+// listIndexes <collection>
+func handleListIndexes(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 1)
+	if len(parts) < 1 {
+		fmt.Println("Usage: listIndexes <collection>")
+		return
+	}
+	fields := db.ListIndexes(parts[0])
+	text, hasText := db.TextIndex(parts[0])
+	if len(fields) == 0 && !hasText {
+		fmt.Println("No indexes on", parts[0])
+		return
+	}
+	if hasText {
+		fmt.Println(" - text:", strings.Join(text, ", "))
+	}
+	for _, f := range fields {
+		opts, _ := db.IndexInfo(parts[0], f)
+		line := " - " + f
+		if opts.Unique {
+			line += " (unique)"
+		}
+		if opts.Collation != nil {
+			line += " (collation " + opts.Collation.String() + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
+// createTextIndex <collection> <field> [field...]
+func handleCreateTextIndex(db engine.Engine, rest string) {
+	parts := strings.Fields(rest)
+	if len(parts) < 2 {
+		fmt.Println("Usage: createTextIndex <collection> <field> [field...]")
+		return
+	}
+	if err := db.CreateTextIndex(parts[0], parts[1:]); err != nil {
+		fmt.Println("Create text index error:", err)
+		return
+	}
+	fmt.Println("Text index created on", parts[0], parts[1:])
+}
+
+// textSearch <collection> <words>
+func handleTextSearch(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 2)
+	if len(parts) < 2 {
+		fmt.Println("Usage: textSearch <collection> <words>")
+		return
+	}
+	results, err := textSearch(context.Background(), db, parts[0], parts[1], nil, 100)
+	if err != nil {
+		fmt.Println("Text search error:", err)
+		return
+	}
+	for _, doc := range results {
+		fmt.Println(prettyDoc(doc))
+	}
+	fmt.Printf("(%d results)\n", len(results))
+}
+
+// setCoercion <collection> <field> <number|string|bool|date|none>
+func handleSetCoercion(db engine.Engine, rest string) {
+	parts := splitArgs(rest, 3)
+	if len(parts) < 3 {
+		fmt.Println("Usage: setCoercion <collection> <field> <number|string|bool|date|none>")
+		return
+	}
+	typ := parts[2]
+	if typ == "none" {
+		typ = ""
+	}
+	if err := db.SetCoercion(parts[0], parts[1], typ); err != nil {
+		fmt.Println("Set coercion error:", err)
+		return
+	}
+	rules := db.Coercions(parts[0])
+	if len(rules) == 0 {
+		fmt.Println("No coercion rules on", parts[0])
+		return
+	}
+	for field, t := range rules {
+		fmt.Printf(" - %s: %s\n", field, t)
+	}
+}
+
+// setReference <collection> <field> <target> [checkInsert] [restrict|cascade|none]
+// setReference <collection> <field> drop
+func handleSetReference(db engine.Engine, rest string) {
+	parts := strings.Fields(rest)
+	if len(parts) < 3 {
+		fmt.Println("Usage: setReference <collection> <field> <target|drop> [checkInsert] [restrict|cascade|none]")
+		return
+	}
+	if parts[2] == "drop" {
+		if err := db.DropReference(parts[0], parts[1]); err != nil {
+			fmt.Println("Drop reference error:", err)
+			return
+		}
+	} else {
+		ref := engine.Reference{Collection: parts[0], Field: parts[1], Target: parts[2]}
+		for _, opt := range parts[3:] {
+			switch opt {
+			case "checkInsert":
+				ref.CheckInsert = true
+			case "none":
+				ref.OnDelete = engine.RefDeleteNone
+			default:
+				ref.OnDelete = opt
+			}
+		}
+		if err := db.SetReference(ref); err != nil {
+			fmt.Println("Set reference error:", err)
+			return
+		}
+	}
+	refs := db.References(parts[0])
+	if len(refs) == 0 {
+		fmt.Println("No references on", parts[0])
+		return
+	}
+	for _, r := range refs {
+		line := fmt.Sprintf(" - %s.%s -> %s", r.Collection, r.Field, r.Target)
+		if r.CheckInsert {
+			line += " (checkInsert)"
+		}
+		if r.OnDelete != "" {
+			line += " (onDelete " + r.OnDelete + ")"
+		}
+		fmt.Println(line)
+	}
+}
+
 // --- utils ---
 
+func prettyDoc(doc map[string]interface{}) string {
+	out, _ := json.MarshalIndent(doc, "", "  ")
+	return string(out)
+}
+
 func prettyJSON(b []byte) string {
 	var m map[string]interface{}
 	if err := json.Unmarshal(b, &m); err != nil {
@@ -341,6 +708,18 @@ func prettyJSON(b []byte) string {
 	return string(out)
 }
 
+// splitJSONArg tách giá trị JSON đầu tiên của s khỏi phần còn lại,
+// vd: `{"a": "x y"} {"strength": 2}` -> (`{"a": "x y"}`, `{"strength": 2}`)
+func splitJSONArg(s string) (string, string) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	var first json.RawMessage
+	if err := dec.Decode(&first); err != nil {
+		return s, "" // Để caller báo lỗi JSON như bình thường
+	}
+	off := dec.InputOffset()
+	return strings.TrimSpace(s[:off]), strings.TrimSpace(s[off:])
+}
+
 // splitArgs splits a string into N parts (N-1 splits), keeping JSON intact.
 func splitArgs(s string, n int) []string {
 	parts := make([]string, 0, n)
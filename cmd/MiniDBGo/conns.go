@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	jobConnRecycle = "conn_recycle" // Lane đóng các kết nối keep-alive quá hạn
+
+	connRecycleInterval = time.Second
+	drainPollInterval   = 100 * time.Millisecond
+)
+
+type connCtxKey struct{}
+
+// trackedConn là một kết nối HTTP đang mở
+type trackedConn struct {
+	start time.Time
+	state http.ConnState
+}
+
+// connTracker theo dõi các kết nối HTTP để giới hạn tuổi thọ của chúng và
+// rút (drain) chúng khi server dừng hoặc khi nhận SIGHUP. Kết nối cần đóng
+// được báo "Connection: close" ở response kế tiếp; kết nối đang rảnh
+// (keep-alive) thì bị đóng luôn, nên không request nào đang chạy bị cắt ngang.
+type connTracker struct {
+	lifetime time.Duration // 0 = không giới hạn
+
+	mu    sync.Mutex
+	conns map[net.Conn]*trackedConn
+	// drainBefore: kết nối mở trước mốc này phải đóng (SIGHUP)
+	drainBefore time.Time
+	draining    atomic.Bool // Server đang dừng: mọi kết nối phải đóng
+
+	recycled atomic.Int64 // Số kết nối bị đóng do quá tuổi thọ hoặc bị drain
+}
+
+func newConnTracker(lifetime time.Duration) *connTracker {
+	return &connTracker{lifetime: lifetime, conns: make(map[net.Conn]*trackedConn)}
+}
+
+// connState là http.Server.ConnState
+func (t *connTracker) connState(c net.Conn, state http.ConnState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch state {
+	case http.StateNew:
+		t.conns[c] = &trackedConn{start: time.Now(), state: state}
+	case http.StateClosed, http.StateHijacked:
+		delete(t.conns, c)
+	default:
+		if tc, ok := t.conns[c]; ok {
+			tc.state = state
+		}
+	}
+}
+
+// connContext là http.Server.ConnContext: gắn kết nối vào context của request
+func (t *connTracker) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, c)
+}
+
+// expiredLocked: kết nối mở lúc start phải đóng chưa
+func (t *connTracker) expiredLocked(start, now time.Time) bool {
+	return t.draining.Load() || start.Before(t.drainBefore) ||
+		(t.lifetime > 0 && now.Sub(start) >= t.lifetime)
+}
+
+// middleware báo client đóng kết nối sau response nếu kết nối đã hết hạn
+func (t *connTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(connCtxKey{}).(net.Conn); ok {
+			t.mu.Lock()
+			tc, tracked := t.conns[c]
+			expired := tracked && t.expiredLocked(tc.start, time.Now())
+			t.mu.Unlock()
+			if expired {
+				w.Header().Set("Connection", "close")
+				t.recycled.Add(1)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// closeIdle đóng các kết nối rảnh đã hết hạn, trả về số kết nối còn mở
+func (t *connTracker) closeIdle() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for c, tc := range t.conns {
+		if tc.state == http.StateIdle && t.expiredLocked(tc.start, now) {
+			c.Close()
+			delete(t.conns, c)
+			t.recycled.Add(1)
+		}
+	}
+	return len(t.conns)
+}
+
+// expired: kết nối (không qua http.Server, vd giao thức TCP) mở lúc start phải đóng chưa
+func (t *connTracker) expired(start time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.expiredLocked(start, time.Now())
+}
+
+// recycleAll yêu cầu mọi kết nối hiện có đóng lại (client mở kết nối mới)
+func (t *connTracker) recycleAll() {
+	t.mu.Lock()
+	t.drainBefore = time.Now()
+	t.mu.Unlock()
+	t.closeIdle()
+}
+
+// drain đánh dấu server đang dừng rồi tiếp tục phục vụ thêm period: health
+// check trả 503 để load balancer ngừng gửi request tới, mọi response báo
+// "Connection: close" và kết nối rảnh bị đóng dần
+func (t *connTracker) drain(period time.Duration) {
+	t.draining.Store(true)
+	deadline := time.Now().Add(period)
+	for time.Now().Before(deadline) {
+		t.closeIdle()
+		time.Sleep(min(drainPollInterval, time.Until(deadline)))
+	}
+	t.closeIdle()
+}
+
+func (t *connTracker) metrics() map[string]int64 {
+	t.mu.Lock()
+	open := int64(len(t.conns))
+	t.mu.Unlock()
+	return map[string]int64{
+		"http_connections_open":     open,
+		"http_connections_recycled": t.recycled.Load(),
+	}
+}
+
+// startConnRecycle đóng định kỳ các kết nối rảnh quá MaxConnLifetime
+func (s *Server) startConnRecycle() {
+	if s.conns.lifetime <= 0 {
+		return
+	}
+	s.jobs.Every(jobConnRecycle, connRecycleInterval, func() error {
+		s.conns.closeIdle()
+		return nil
+	})
+	log.Printf("[HTTP] Connections are recycled after %s\n", s.conns.lifetime)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nconghau/MiniDBGo/internal/lsm"
+)
+
+// Usage: go run ./cmd/MiniDBGo diff [--summary] [--json] <dir-a> <dir-b>
+func mainDiff() {
+	args := os.Args[2:]
+	summary, asJSON := false, false
+	for len(args) > 0 && (args[0] == "--summary" || args[0] == "--json") {
+		summary = summary || args[0] == "--summary"
+		asJSON = asJSON || args[0] == "--json"
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Println("Usage: diff [--summary] [--json] <dir-a> <dir-b>")
+		fmt.Println("  Compares the documents of two stopped data dirs (backups/checkpoints) and lists")
+		fmt.Println("  added (+, only in B), removed (-, only in A) and changed (~) documents per collection.")
+		fmt.Println("  --summary  only print the per-collection counts")
+		fmt.Println("  --json     print one JSON object per document, then the counts")
+		fmt.Println("  Exit status: 0 identical, 1 different, 2 error. Neither directory is modified.")
+		os.Exit(2)
+	}
+	// Log của engine (mở hai bản sao) không được lẫn vào kết quả
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false)
+	marks := map[string]string{lsm.DiffAdded: "+", lsm.DiffRemoved: "-", lsm.DiffChanged: "~"}
+	report, err := lsm.DiffDirs(args[0], args[1], func(d lsm.DiffEntry) error {
+		switch {
+		case summary:
+			return nil
+		case asJSON:
+			return enc.Encode(map[string]string{"kind": d.Kind, "collection": d.Collection, "id": d.ID})
+		}
+		_, err := fmt.Printf("%s %s/%s\n", marks[d.Kind], d.Collection, d.ID)
+		return err
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, ColorRed+"diff failed:"+ColorReset, err)
+		os.Exit(2)
+	}
+
+	if asJSON {
+		enc.Encode(report)
+	} else {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COLLECTION\tADDED\tREMOVED\tCHANGED\tSAME")
+		for _, c := range report.Collections {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", c.Collection, c.Added, c.Removed, c.Changed, c.Same)
+		}
+		tw.Flush()
+	}
+	if report.Differs() {
+		os.Exit(1)
+	}
+}
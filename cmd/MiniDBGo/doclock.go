@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Khóa document (advisory) là lease của engine tên lockLeasePrefix +
+// "<col>:<id>" (xem engine.Lease): token trả cho client là ID của lease.
+// Khóa không chặn ghi vào document; client tự thỏa thuận dùng _lock/_unlock
+// quanh phần việc cần độc quyền.
+const lockLeasePrefix = "lock:"
+
+const (
+	defaultLockTTL = 30 * time.Second
+	maxLockTTL     = 24 * time.Hour
+)
+
+// docLock là khóa trả về cho client
+type docLock struct {
+	Owner     string    `json:"owner"`
+	Token     string    `json:"token,omitempty"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func lockFromLease(l *engine.Lease) *docLock {
+	return &docLock{Owner: l.Owner, Token: l.ID, ExpiresAt: l.ExpiresAt}
+}
+
+// lockRequest là body của _lock; Token != "" gia hạn khóa đang giữ
+type lockRequest struct {
+	Owner string `json:"owner"`
+	TTLMs int64  `json:"ttlMs"`
+	Token string `json:"token"`
+}
+
+// acquireLock giành (hoặc gia hạn, nếu req.Token khớp) khóa của document.
+// Khóa đang bị giữ: trả về engine.ErrLeaseHeld kèm khóa của người giữ.
+func acquireLock(db engine.Engine, key []byte, req lockRequest, ttl time.Duration) (*docLock, error) {
+	name := lockLeasePrefix + string(key)
+	lease, err := db.GrantLease(name, req.Owner, ttl)
+	if errors.Is(err, engine.ErrLeaseHeld) && req.Token != "" {
+		lease, err = db.KeepAlive(name, req.Token, ttl)
+		if errors.Is(err, engine.ErrLeaseNotFound) {
+			// Hết hạn ngay giữa hai lần gọi: giành lại như khóa mới
+			lease, err = db.GrantLease(name, req.Owner, ttl)
+		}
+	}
+	if lease == nil {
+		return nil, err
+	}
+	return lockFromLease(lease), err
+}
+
+// releaseLock trả khóa nếu token khớp. Khóa đã hết hạn trả về
+// engine.ErrLeaseNotFound; khóa của token khác trả về engine.ErrLeaseHeld.
+func releaseLock(db engine.Engine, key []byte, token string) (*docLock, error) {
+	lease, err := db.RevokeLease(lockLeasePrefix+string(key), token)
+	if lease == nil {
+		return nil, err
+	}
+	return lockFromLease(lease), err
+}
+
+// handleLockDocument giành khóa của document
+// POST /api/<col>/<id>/_lock  body: {"owner": "worker-1", "ttlMs": 30000}
+// Gia hạn: gửi kèm "token" đã nhận. 409 nếu khóa đang bị giữ.
+func (s *Server) handleLockDocument(w http.ResponseWriter, r *http.Request, key []byte) {
+	var req lockRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body is not a valid JSON lock request")
+			return
+		}
+	}
+	ttl := defaultLockTTL
+	if req.TTLMs != 0 {
+		ttl = time.Duration(req.TTLMs) * time.Millisecond
+	}
+	if ttl <= 0 || ttl > maxLockTTL {
+		writeError(w, http.StatusBadRequest, "ttlMs must be between 1 and 86400000")
+		return
+	}
+
+	lock, err := acquireLock(s.db, key, req, ttl)
+	if errors.Is(err, engine.ErrLeaseHeld) {
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Document is locked",
+			"status":    http.StatusConflict,
+			"owner":     lock.Owner,
+			"expiresAt": lock.ExpiresAt,
+		})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, lock)
+}
+
+// handleUnlockDocument trả khóa của document
+// POST /api/<col>/<id>/_unlock  body: {"token": "..."}
+func (s *Server) handleUnlockDocument(w http.ResponseWriter, r *http.Request, key []byte) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		writeError(w, http.StatusBadRequest, "Request body must be {\"token\": \"...\"}")
+		return
+	}
+
+	lock, err := releaseLock(s.db, key, req.Token)
+	switch {
+	case errors.Is(err, engine.ErrLeaseNotFound):
+		writeError(w, http.StatusNotFound, "Document is not locked")
+	case errors.Is(err, engine.ErrLeaseHeld):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Lock is held by another token",
+			"status":    http.StatusConflict,
+			"owner":     lock.Owner,
+			"expiresAt": lock.ExpiresAt,
+		})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"status": "unlocked", "owner": lock.Owner})
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+)
+
+const (
+	jobExport = "export" // Lane chạy _exportQuery trong bộ lập lịch của server
+
+	exportQueueSize = 16
+)
+
+// errExportCanceled: server dừng khi export đang chạy
+var errExportCanceled = errors.New("export canceled by server shutdown")
+
+// exportJob là trạng thái của một lần _exportQuery
+type exportJob struct {
+	ID         string     `json:"id"`
+	Collection string     `json:"collection"`
+	Path       string     `json:"path"`
+	State      string     `json:"state"` // jobs.State*
+	Docs       int64      `json:"docs"`
+	Bytes      int64      `json:"bytes"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (j exportJob) taskID() string    { return j.ID }
+func (j exportJob) taskState() string { return j.State }
+
+// exportQueryRequest là body của _exportQuery
+type exportQueryRequest struct {
+	Filter map[string]interface{} `json:"filter"`
+	File   string                 `json:"file"`  // Tên tệp trong ExportDir (mặc định <col>-<id>.ndjson)
+	Limit  int64                  `json:"limit"` // 0 = không giới hạn
+}
+
+// handleExportQuery chạy filter ở server và ghi các document khớp ra tệp
+// NDJSON trong ExportDir ở nền, trả về ngay ID để theo dõi (GET /api/_exports/<id>).
+// POST /api/<col>/_exportQuery  body: {"filter": {...}, "file": "orders.ndjson", "limit": 0}
+func (s *Server) handleExportQuery(w http.ResponseWriter, r *http.Request, collection string) {
+	var req exportQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body must be {\"filter\": {...}, \"file\": \"...\"}")
+		return
+	}
+	if req.Filter == nil {
+		req.Filter = map[string]interface{}{}
+	}
+	if req.Limit < 0 {
+		writeError(w, http.StatusBadRequest, "limit must not be negative")
+		return
+	}
+	// Kiểm tra filter ngay để lỗi của client không thành job thất bại
+	if _, err := planScan(s.db, collection, req.Filter, nil, nil); err != nil {
+		writeReadError(w, err)
+		return
+	}
+
+	id := newDocID()
+	file := req.File
+	if file == "" {
+		file = collection + "-" + id + ".ndjson"
+	}
+	switch {
+	case strings.Contains(file, "://"):
+		writeError(w, http.StatusBadRequest, "Only server-local exports are supported; \"file\" must be a file name inside the export directory")
+		return
+	case file != filepath.Base(file) || file == "." || file == ".." || strings.ContainsAny(file, `/\`):
+		writeError(w, http.StatusBadRequest, "\"file\" must be a plain file name (no directories)")
+		return
+	}
+	if err := os.MkdirAll(s.opts.ExportDir, 0o755); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	path := filepath.Join(s.opts.ExportDir, file)
+	if _, err := os.Stat(path); err == nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("Export file %s already exists", file))
+		return
+	}
+
+	job := &exportJob{ID: id, Collection: collection, Path: path, State: jobs.StateQueued, CreatedAt: time.Now()}
+	s.exports.add(job)
+	detail := fmt.Sprintf("%s -> %s", collection, file)
+	if err := s.jobs.Submit(jobExport, detail, func() error { return s.runExport(job, req) }); err != nil {
+		s.exports.remove(id)
+		writeError(w, http.StatusServiceUnavailable, "Export queue is full: "+err.Error())
+		return
+	}
+	j, _ := s.exports.get(id)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// runExport là job ghi kết quả của filter ra tệp. Dữ liệu được ghi vào tệp
+// tạm rồi đổi tên, nên tệp đích chỉ xuất hiện khi export thành công.
+func (s *Server) runExport(job *exportJob, req exportQueryRequest) (err error) {
+	s.exports.update(job, func(j *exportJob) { j.State = jobs.StateRunning })
+	defer func() {
+		now := time.Now()
+		s.exports.update(job, func(j *exportJob) {
+			j.FinishedAt = &now
+			if err != nil {
+				j.State, j.Error = jobs.StateFailed, err.Error()
+			} else {
+				j.State = jobs.StateDone
+			}
+			slog.Info("Export finished", "component", "export", "id", j.ID, "path", j.Path, "docs", j.Docs, "error", err)
+		})
+	}()
+
+	tmp := job.Path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+		}
+	}()
+
+	scan, err := planScan(s.db, job.Collection, req.Filter, nil, nil)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(f, 256*1024)
+	var docs, written int64
+	var werr error
+	err = scan.each(s.bgCtx, func(key string, raw []byte, doc map[string]interface{}) bool {
+		if _, werr = bw.Write(raw); werr == nil {
+			werr = bw.WriteByte('\n')
+		}
+		if werr != nil {
+			return false
+		}
+		docs++
+		written += int64(len(raw)) + 1
+		if docs%1000 == 0 {
+			s.exports.update(job, func(j *exportJob) { j.Docs, j.Bytes = docs, written })
+		}
+		return req.Limit == 0 || docs < req.Limit
+	})
+	s.exports.update(job, func(j *exportJob) { j.Docs, j.Bytes = docs, written })
+	if errors.Is(err, context.Canceled) {
+		return errExportCanceled
+	}
+	if err == nil {
+		err = werr
+	}
+	if err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, job.Path)
+}
+
+// handleExports trả về trạng thái các export
+// GET /api/_exports, GET /api/_exports/<id>
+func (s *Server) handleExports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/_exports"), "/")
+	if id == "" {
+		writeJSON(w, http.StatusOK, s.exports.list())
+		return
+	}
+	j, ok := s.exports.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Export not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// startExports đăng ký lane export; bgCtx bị hủy khi server dừng để các
+// export đang chạy dừng lại thay vì giữ tiến trình tới khi xong
+func (s *Server) startExports() {
+	s.exports = newTaskRegistry[exportJob]()
+	s.jobs.AddLane(jobExport, jobs.LaneOptions{Workers: 1, QueueSize: exportQueueSize, Record: true})
+	if s.opts.ExportDir == "" {
+		s.opts.ExportDir = "exports"
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// Số giá trị số tối đa giữ lại để ước lượng percentile (reservoir sampling),
+// giúp bộ nhớ không phụ thuộc vào kích thước collection
+const fieldStatsSampleSize = 10000
+
+// FieldStats là kết quả profiling một field của collection
+type FieldStats struct {
+	Collection  string             `json:"collection"`
+	Field       string             `json:"field"`
+	Docs        int                `json:"docs"`
+	Missing     int                `json:"missing"`
+	Null        int                `json:"null"`
+	Types       map[string]int     `json:"types"`
+	Numeric     int                `json:"numeric"`
+	Min         *float64           `json:"min,omitempty"`
+	Max         *float64           `json:"max,omitempty"`
+	Avg         *float64           `json:"avg,omitempty"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+	Sampled     bool               `json:"sampled"` // true nếu percentile được ước lượng từ mẫu
+}
+
+// computeFieldStats quét (streaming) collection và tính thống kê cho field
+func computeFieldStats(db engine.Engine, col, field string) (*FieldStats, error) {
+	st := &FieldStats{
+		Collection: col,
+		Field:      field,
+		Types:      make(map[string]int),
+	}
+
+	it, err := db.NewPrefixIterator(col + ":")
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	var sum, min, max float64
+	sample := make([]float64, 0, 1024)
+	rng := rand.New(rand.NewSource(1))
+
+	for it.Next() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(it.Value().Value, &doc); err != nil {
+			continue
+		}
+		st.Docs++
+
+		v, ok := query.GetPath(doc, field)
+		if !ok {
+			st.Missing++
+			continue
+		}
+		st.Types[jsonTypeName(v)]++
+		if v == nil {
+			st.Null++
+			continue
+		}
+		num, ok := v.(float64)
+		if !ok {
+			continue
+		}
+
+		if st.Numeric == 0 || num < min {
+			min = num
+		}
+		if st.Numeric == 0 || num > max {
+			max = num
+		}
+		sum += num
+		st.Numeric++
+
+		// Reservoir sampling (Algorithm R)
+		if len(sample) < fieldStatsSampleSize {
+			sample = append(sample, num)
+		} else if j := rng.Intn(st.Numeric); j < fieldStatsSampleSize {
+			sample[j] = num
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+
+	if st.Numeric > 0 {
+		avg := sum / float64(st.Numeric)
+		st.Min, st.Max, st.Avg = &min, &max, &avg
+		st.Sampled = st.Numeric > len(sample)
+
+		sort.Float64s(sample)
+		st.Percentiles = map[string]float64{
+			"p25": percentile(sample, 0.25),
+			"p50": percentile(sample, 0.50),
+			"p75": percentile(sample, 0.75),
+			"p90": percentile(sample, 0.90),
+			"p99": percentile(sample, 0.99),
+		}
+	}
+	return st, nil
+}
+
+// percentile (nearest-rank) trên mảng đã sắp xếp
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return "unknown"
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nconghau/MiniDBGo/internal/lsm"
+)
+
+// Usage: go run ./cmd/MiniDBGo formats [--json]
+func mainFormats() {
+	args := os.Args[2:]
+	if len(args) > 1 || (len(args) == 1 && args[0] != "--json") {
+		fmt.Println("Usage: formats [--json]")
+		fmt.Println("  Prints the WAL, SSTable, value log and MANIFEST layouts written by this build.")
+		fmt.Println("  The layouts are checked against real encoder output before printing.")
+		os.Exit(1)
+	}
+
+	formats, err := lsm.DescribeFormats()
+	if err != nil {
+		fmt.Println(ColorRed+"formats failed:"+ColorReset, err)
+		os.Exit(1)
+	}
+	if len(args) == 1 {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(formats); err != nil {
+			fmt.Println(ColorRed+"formats failed:"+ColorReset, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Println("Encoding:", formats.Encoding)
+	fmt.Println("SSTable version written:", formats.SSTVersion)
+	for _, v := range formats.SSTVersions {
+		fmt.Printf("  v%d  footer %d bytes  %s\n", v.Version, v.FooterSize, v.Description)
+	}
+
+	fmt.Println("\nFlags:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range formats.Flags {
+		fmt.Fprintf(tw, "  %s\t%s\t0x%02x\t%s\n", f.Scope, f.Name, f.Value, f.Note)
+	}
+	tw.Flush()
+
+	for _, l := range formats.Layouts {
+		fmt.Printf("\n%s — %s\n", l.Name, l.Summary)
+		tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  FIELD\tOFFSET\tSIZE\tENCODING\tWHEN\tNOTE")
+		for _, f := range l.Fields {
+			fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\t%s\t%s\n", f.Name, f.Offset, f.Size, f.Encoding, f.When, f.Note)
+		}
+		tw.Flush()
+	}
+
+	fmt.Println("\nSSTable properties:")
+	for _, p := range formats.Properties {
+		fmt.Println("  " + p)
+	}
+
+	fmt.Println("\n" + formats.ManifestSummary)
+	tw = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range formats.Manifest {
+		fmt.Fprintf(tw, "  %s\t%s\n", f.Path, f.Type)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// Số giá trị khác nhau tối đa của một lần groupCount (bộ nhớ tỉ lệ với số nhóm)
+const maxGroupCountGroups = 100000
+
+var errTooManyGroups = fmt.Errorf("field has more than %d distinct values", maxGroupCountGroups)
+
+// GroupCount là số document có một giá trị của field
+type GroupCount struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// groupCount đếm số document theo từng giá trị của field trong một lượt quét.
+// Document không được giữ lại, chỉ có bộ đếm của mỗi nhóm.
+// Field dạng mảng: document được đếm một lần cho mỗi phần tử khác nhau
+// (facet); field không tồn tại được đếm vào nhóm null.
+// Kết quả sắp xếp theo count giảm dần.
+// coll (có thể nil) áp dụng cho filter và cho việc gộp nhóm ("Hanoi" và "hanoi"
+// cùng một nhóm, giá trị của nhóm là giá trị gặp đầu tiên).
+func groupCount(ctx context.Context, db engine.Engine, col, field string, filter map[string]interface{},
+	coll *query.Collation) ([]GroupCount, error) {
+
+	counts, err := countValues(ctx, db, col, field, filter, coll, true)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		ci, cj := counts[keys[i]].Count, counts[keys[j]].Count
+		if ci != cj {
+			return ci > cj
+		}
+		return keys[i] < keys[j]
+	})
+
+	out := make([]GroupCount, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, *counts[k])
+	}
+	return out, nil
+}
+
+// distinctValues trả về các giá trị khác nhau của field (đã sắp xếp)
+// trong các document khớp filter. Document thiếu field bị bỏ qua.
+func distinctValues(ctx context.Context, db engine.Engine, col, field string, filter map[string]interface{},
+	coll *query.Collation) ([]interface{}, error) {
+
+	counts, err := countValues(ctx, db, col, field, filter, coll, false)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]interface{}, 0, len(counts))
+	for _, g := range counts {
+		out = append(out, g.Value)
+	}
+	sort.Slice(out, func(i, j int) bool { return query.Compare(out[i], out[j], coll) < 0 })
+	return out, nil
+}
+
+// countValues quét các document khớp filter và đếm theo giá trị của field
+// (key là JSON của giá trị sau collation). missingAsNull: field thiếu được tính là null.
+func countValues(ctx context.Context, db engine.Engine, col, field string, filter map[string]interface{},
+	coll *query.Collation, missingAsNull bool) (map[string]*GroupCount, error) {
+
+	coerce := query.Coercions(db.Coercions(col))
+	counts := make(map[string]*GroupCount)
+
+	var groupErr error
+	err := forEachMatch(ctx, db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
+		v, ok := query.GetPath(coerce.Doc(doc), field)
+		if !ok && !missingAsNull {
+			return true
+		}
+		values := []interface{}{v}
+		if arr, ok := v.([]interface{}); ok {
+			values = arr
+		}
+
+		seen := make(map[string]struct{}, len(values))
+		for _, val := range values {
+			kb, err := json.Marshal(coll.Value(val))
+			if err != nil {
+				continue
+			}
+			k := string(kb)
+			if _, dup := seen[k]; dup {
+				continue
+			}
+			seen[k] = struct{}{}
+
+			g, ok := counts[k]
+			if !ok {
+				if len(counts) >= maxGroupCountGroups {
+					groupErr = errTooManyGroups
+					return false
+				}
+				g = &GroupCount{Value: val}
+				counts[k] = g
+			}
+			g.Count++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if groupErr != nil {
+		return nil, groupErr
+	}
+	return counts, nil
+}
+
+// countMatches đếm số document khớp filter mà không giữ document nào.
+// Filter rỗng chỉ đếm key, không cần giải mã JSON.
+func countMatches(ctx context.Context, db engine.Engine, col string, filter map[string]interface{}, coll *query.Collation) (int, error) {
+	n := 0
+	if len(filter) == 0 {
+		it, err := db.NewPrefixIteratorContext(ctx, col+":")
+		if err != nil {
+			return 0, err
+		}
+		defer it.Close()
+		for it.Next() {
+			n++
+		}
+		return n, it.Error()
+	}
+	err := forEachMatch(ctx, db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
+		n++
+		return true
+	})
+	return n, err
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+const (
+	jobImport = "import" // Lane chạy _importJob trong bộ lập lịch của server
+
+	importQueueSize        = 16
+	defaultImportBatchSize = 500
+	maxImportBatchSize     = 1000 // Như giới hạn của _insertMany
+)
+
+// errImportCanceled: server dừng khi import đang chạy
+var errImportCanceled = errors.New("import canceled by server shutdown")
+
+// importJob là trạng thái của một lần _importJob
+type importJob struct {
+	ID         string `json:"id"`
+	Collection string `json:"collection"`
+	Source     string `json:"source"` // Đường dẫn tệp trong ImportDir hoặc URL
+	State      string `json:"state"`  // jobs.State*
+	Replace    bool   `json:"replace,omitempty"`
+	Read       int64  `json:"read"` // Số document đã đọc từ nguồn
+	Imported   int64  `json:"imported"`
+	Error      string `json:"error,omitempty"`
+	// FailedAt là số thứ tự (từ 1) của document làm import dừng
+	FailedAt      int64      `json:"failedAt,omitempty"`
+	RolledBack    int64      `json:"rolledBack,omitempty"` // Số document đã nạp bị xóa lại khi rollback
+	RollbackError string     `json:"rollbackError,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	FinishedAt    *time.Time `json:"finishedAt,omitempty"`
+}
+
+func (j importJob) taskID() string    { return j.ID }
+func (j importJob) taskState() string { return j.State }
+
+// importJobRequest là body của _importJob; cần đúng một trong File và URL
+type importJobRequest struct {
+	File      string `json:"file"` // Tên tệp trong ImportDir
+	URL       string `json:"url"`  // http(s)
+	BatchSize int    `json:"batchSize"`
+	// Rollback (mặc định true): lỗi giữa chừng thì xóa các document đã nạp
+	Rollback *bool `json:"rollback"`
+	// Replace: nguồn thay toàn bộ collection (ReplaceCollection), reader chỉ
+	// thấy dữ liệu mới khi đã nạp xong; lỗi thì collection giữ nguyên
+	Replace bool `json:"replace"`
+}
+
+// importError là lỗi của một document trong nguồn (dữ liệu không hợp lệ)
+type importError struct {
+	index int64
+	err   error
+}
+
+func (e *importError) Error() string { return fmt.Sprintf("document %d: %v", e.index, e.err) }
+func (e *importError) Unwrap() error { return e.err }
+
+// handleImportJob nạp document từ tệp NDJSON (hoặc mảng JSON) ở nền: kiểm tra
+// từng document (có _id dạng chuỗi, chưa tồn tại, khớp quy tắc ép kiểu của
+// collection), ghi theo batch và theo dõi tiến độ qua GET /api/_imports/<id>.
+// Import chỉ tạo document mới nên rollback chỉ cần xóa các key đã nạp; với
+// "replace": true nguồn thay cả collection trong một lần hoán đổi.
+// POST /api/<col>/_importJob  body: {"file": "orders.ndjson"} hoặc {"url": "https://..."}
+func (s *Server) handleImportJob(w http.ResponseWriter, r *http.Request, collection string) {
+	var req importJobRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body must be {\"file\": \"...\"} or {\"url\": \"...\"}")
+		return
+	}
+	if req.BatchSize == 0 {
+		req.BatchSize = defaultImportBatchSize
+	}
+	if req.BatchSize < 0 || req.BatchSize > maxImportBatchSize {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("batchSize must be between 1 and %d", maxImportBatchSize))
+		return
+	}
+
+	var source string
+	switch {
+	case (req.File == "") == (req.URL == ""):
+		writeError(w, http.StatusBadRequest, "Exactly one of \"file\" and \"url\" is required")
+		return
+	case req.URL != "":
+		u, err := url.Parse(req.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			writeError(w, http.StatusBadRequest, "\"url\" must be an http(s) URL")
+			return
+		}
+		source = req.URL
+	case req.File != filepath.Base(req.File) || req.File == "." || req.File == ".." || strings.ContainsAny(req.File, `/\`):
+		writeError(w, http.StatusBadRequest, "\"file\" must be a plain file name (no directories)")
+		return
+	default:
+		source = filepath.Join(s.opts.ImportDir, req.File)
+		if st, err := os.Stat(source); err != nil || st.IsDir() {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Import file %s not found", req.File))
+			return
+		}
+	}
+
+	job := &importJob{ID: newDocID(), Collection: collection, Source: source, State: jobs.StateQueued, Replace: req.Replace, CreatedAt: time.Now()}
+	s.imports.add(job)
+	detail := fmt.Sprintf("%s <- %s", collection, source)
+	if err := s.jobs.Submit(jobImport, detail, func() error { return s.runImport(job, req) }); err != nil {
+		s.imports.remove(job.ID)
+		writeError(w, http.StatusServiceUnavailable, "Import queue is full: "+err.Error())
+		return
+	}
+	j, _ := s.imports.get(job.ID)
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// runImport là job nạp dữ liệu; lỗi giữa chừng (kể cả khi server dừng) thì
+// xóa các document đã nạp nếu req.Rollback (req.Replace: không có gì để xóa)
+func (s *Server) runImport(job *importJob, req importJobRequest) (err error) {
+	s.imports.update(job, func(j *importJob) { j.State = jobs.StateRunning })
+	var imported [][]byte
+	defer func() {
+		var rolledBack int64
+		var rerr error
+		if err != nil && !req.Replace && (req.Rollback == nil || *req.Rollback) {
+			rolledBack, rerr = s.rollbackImport(imported, req.BatchSize)
+		}
+		now := time.Now()
+		s.imports.update(job, func(j *importJob) {
+			j.FinishedAt = &now
+			j.RolledBack = rolledBack
+			if err != nil && req.Replace {
+				j.Imported = 0 // Các batch đã nạp nằm trong CSDL tạm, đã bị bỏ
+			}
+			if rerr != nil {
+				j.RollbackError = rerr.Error()
+			}
+			var ie *importError
+			if errors.As(err, &ie) {
+				j.FailedAt = ie.index
+			}
+			if err != nil {
+				j.State, j.Error = jobs.StateFailed, err.Error()
+			} else {
+				j.State = jobs.StateDone
+			}
+			slog.Info("Import finished", "component", "import", "id", j.ID, "source", j.Source,
+				"imported", j.Imported, "rolled_back", j.RolledBack, "error", err)
+		})
+	}()
+
+	src, err := s.openImportSource(job.Source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	coerce := query.Coercions(s.db.Coercions(job.Collection))
+	seen := make(map[string]struct{})
+	var read int64
+	batch := s.db.NewBatch()
+	var pending [][]byte
+	apply := s.db.ApplyBatch
+
+	flush := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := apply(batch); err != nil {
+			// Lỗi ràng buộc của engine (unique, tham chiếu...) là lỗi dữ liệu
+			return fmt.Errorf("documents %d-%d: %w", read-int64(len(pending))+1, read, err)
+		}
+		imported = append(imported, pending...)
+		pending = nil
+		batch = s.db.NewBatch()
+		s.imports.update(job, func(j *importJob) { j.Read, j.Imported = read, int64(len(imported)) })
+		return nil
+	}
+
+	add := func(v interface{}) error {
+		if s.bgCtx.Err() != nil {
+			return errImportCanceled
+		}
+		read++
+		doc, ok := v.(map[string]interface{})
+		if !ok {
+			return &importError{read, errors.New("not a JSON object")}
+		}
+		id, ok := doc["_id"].(string)
+		if !ok || id == "" {
+			return &importError{read, errors.New("missing required _id (string) field")}
+		}
+		if err := coerce.Validate(doc); err != nil {
+			return &importError{read, err}
+		}
+		key := []byte(job.Collection + ":" + id)
+		if _, dup := seen[string(key)]; dup {
+			return &importError{read, fmt.Errorf("duplicate _id %q in source", id)}
+		}
+		if !req.Replace {
+			exists, err := s.db.Exists(key)
+			if err != nil {
+				return err
+			}
+			if exists {
+				return &importError{read, fmt.Errorf("document %q already exists", id)}
+			}
+		}
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return &importError{read, err}
+		}
+		seen[string(key)] = struct{}{}
+		batch.Put(key, raw)
+		pending = append(pending, key)
+		if len(pending) >= req.BatchSize {
+			return flush()
+		}
+		return nil
+	}
+	load := func() error {
+		if err := decodeImport(src, add); err != nil {
+			return err
+		}
+		return flush()
+	}
+	if req.Replace {
+		err = s.db.ReplaceCollection(job.Collection, func(a func(engine.Batch) error) error {
+			apply = a
+			return load()
+		})
+	} else {
+		err = load()
+	}
+	if err != nil {
+		s.imports.update(job, func(j *importJob) { j.Read = read })
+	}
+	return err
+}
+
+// openImportSource mở tệp trong ImportDir hoặc tải URL (hủy khi server dừng)
+func (s *Server) openImportSource(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	req, err := http.NewRequestWithContext(s.bgCtx, "GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil, errImportCanceled
+		}
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetch %s: %s", source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// decodeImport đọc lần lượt các document của nguồn: NDJSON (hoặc các
+// object JSON nối tiếp nhau) hay một mảng JSON
+func decodeImport(r io.Reader, fn func(v interface{}) error) error {
+	br := bufio.NewReaderSize(r, 256*1024)
+	array := false
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			br.UnreadByte()
+			array = b == '['
+			break
+		}
+	}
+
+	dec := json.NewDecoder(br)
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	for !array || dec.More() {
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			if err == io.EOF && !array {
+				return nil
+			}
+			return fmt.Errorf("invalid JSON: %w", err)
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
+
+// rollbackImport xóa các document đã nạp theo batch
+func (s *Server) rollbackImport(keys [][]byte, batchSize int) (int64, error) {
+	var deleted int64
+	for start := 0; start < len(keys); start += batchSize {
+		end := min(start+batchSize, len(keys))
+		batch := s.db.NewBatch()
+		for _, key := range keys[start:end] {
+			batch.Delete(key)
+		}
+		if err := s.db.ApplyBatch(batch); err != nil {
+			return deleted, fmt.Errorf("rollback: %w", err)
+		}
+		deleted += int64(end - start)
+	}
+	return deleted, nil
+}
+
+// handleImports trả về trạng thái các import
+// GET /api/_imports, GET /api/_imports/<id>
+func (s *Server) handleImports(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/_imports"), "/")
+	if id == "" {
+		writeJSON(w, http.StatusOK, s.imports.list())
+		return
+	}
+	j, ok := s.imports.get(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "Import not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, j)
+}
+
+// startImports đăng ký lane import (một import chạy tại một thời điểm)
+func (s *Server) startImports() {
+	s.imports = newTaskRegistry[importJob]()
+	s.jobs.AddLane(jobImport, jobs.LaneOptions{Workers: 1, QueueSize: importQueueSize, Record: true})
+	if s.opts.ImportDir == "" {
+		s.opts.ImportDir = "imports"
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// leaseRequest là body của các route lease; TTLMs = 0 dùng mặc định
+// (defaultLockTTL khi cấp, TTL lúc cấp khi gia hạn)
+type leaseRequest struct {
+	Owner string `json:"owner"`
+	ID    string `json:"id"`
+	TTLMs int64  `json:"ttlMs"`
+}
+
+// handleLeases xử lý lease của engine (bầu leader, khóa giữa các client):
+//
+//	GET  /api/_leases                     các lease còn hiệu lực
+//	GET  /api/_leases/<name>              lease còn hiệu lực (404 nếu không có)
+//	POST /api/_leases/<name>              cấp: {"owner": "node-1", "ttlMs": 10000}
+//	POST /api/_leases/<name>/_keepalive   gia hạn: {"id": "...", "ttlMs": 10000}
+//	POST /api/_leases/<name>/_revoke      trả: {"id": "..."}
+//
+// Lease đang bị người khác giữ: 409 kèm owner và expiresAt của người giữ.
+func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/_leases"), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case r.Method == "GET" && rest == "":
+		leases, err := s.db.Leases()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, leases)
+	case r.Method == "GET" && len(parts) == 1:
+		lease, err := s.db.GetLease(parts[0])
+		writeLeaseResult(w, lease, err)
+	case r.Method == "POST" && rest != "" && len(parts) <= 2:
+		var req leaseRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, "Request body is not a valid JSON lease request")
+				return
+			}
+		}
+		if req.TTLMs < 0 || time.Duration(req.TTLMs)*time.Millisecond > maxLockTTL {
+			writeError(w, http.StatusBadRequest, "ttlMs must be between 1 and 86400000")
+			return
+		}
+		ttl := time.Duration(req.TTLMs) * time.Millisecond
+		name := parts[0]
+
+		var action string
+		if len(parts) == 2 {
+			action = parts[1]
+		}
+		switch action {
+		case "":
+			if ttl == 0 {
+				ttl = defaultLockTTL
+			}
+			lease, err := s.db.GrantLease(name, req.Owner, ttl)
+			writeLeaseResult(w, lease, err)
+		case "_keepalive", "_revoke":
+			if req.ID == "" {
+				writeError(w, http.StatusBadRequest, "Request body must contain the lease \"id\"")
+				return
+			}
+			var lease *engine.Lease
+			var err error
+			if action == "_keepalive" {
+				lease, err = s.db.KeepAlive(name, req.ID, ttl)
+			} else {
+				lease, err = s.db.RevokeLease(name, req.ID)
+			}
+			writeLeaseResult(w, lease, err)
+		default:
+			writeError(w, http.StatusNotFound, "Invalid lease action")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Invalid lease path")
+	}
+}
+
+// writeLeaseResult ghi kết quả của một thao tác lease
+func writeLeaseResult(w http.ResponseWriter, lease *engine.Lease, err error) {
+	switch {
+	case errors.Is(err, engine.ErrLeaseNotFound):
+		writeError(w, http.StatusNotFound, "Lease not found or expired")
+	case errors.Is(err, engine.ErrLeaseHeld):
+		writeJSON(w, http.StatusConflict, map[string]interface{}{
+			"error":     "Lease is held by another owner",
+			"status":    http.StatusConflict,
+			"owner":     lease.Owner,
+			"expiresAt": lease.ExpiresAt,
+		})
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	default:
+		writeJSON(w, http.StatusOK, lease)
+	}
+}
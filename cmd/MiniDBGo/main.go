@@ -5,11 +5,14 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"runtime"
-	"runtime/debug"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/nconghau/MiniDBGo/internal/engine"
 	"github.com/nconghau/MiniDBGo/internal/lsm"
 )
 
@@ -21,24 +24,248 @@ func main() {
 	}))
 	slog.SetDefault(logger)
 
+	// Subcommands chạy một lần rồi thoát (không mở DB/HTTP server)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			mainMigrate()
+			return
+		case "move-data":
+			mainMoveData()
+			return
+		case "seed":
+			mainSeed()
+			return
+		case "pitr":
+			mainPITR()
+			return
+		case "formats":
+			mainFormats()
+			return
+		case "diff":
+			mainDiff()
+			return
+		}
+	}
+
 	if memLimit := os.Getenv("GOMEMLIMIT"); memLimit != "" {
 		slog.Info("Main set", "value", memLimit)
 	}
-	debug.SetGCPercent(30)
-	runtime.GOMAXPROCS(runtime.NumCPU())
+	tuner.apply(runtimeConfigFromEnv(), "env")
 	slog.Info("Starting MiniDBGo", "pid", os.Getpid())
 
-	flushSize := int64(10000)              // 10000 =  10k records
-	maxMemBytes := int64(16 * 1024 * 1024) // 16 = 16MB
+	opts := lsm.DefaultOptions()
+	opts.FlushSize = 10000              // 10000 =  10k records
+	opts.MaxMemBytes = 16 * 1024 * 1024 // 16 = 16MB
 
 	if val := os.Getenv("FLUSH_SIZE"); val != "" {
 		if fs, err := strconv.ParseInt(val, 10, 64); err == nil {
-			flushSize = fs
+			opts.FlushSize = fs
 		}
 	}
 	if val := os.Getenv("MAX_MEM_MB"); val != "" {
 		if mb, err := strconv.ParseInt(val, 10, 64); err == nil {
-			maxMemBytes = mb * 1024 * 1024
+			opts.MaxMemBytes = mb * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("SCRUB_BLOCKS_PER_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			opts.ScrubBlocksPerSec = n
+		}
+	}
+	if val := os.Getenv("READ_STATS"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			opts.ReadStats = b
+		}
+	}
+	if val := os.Getenv("STATS_PERSIST_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			opts.StatsPersistInterval = time.Duration(n) * time.Second
+		}
+	}
+	if val := os.Getenv("LEASE_REAP_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.LeaseReapInterval = time.Duration(n) * time.Second
+		}
+	}
+	if val := os.Getenv("SHUTDOWN_TIMEOUT_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.ShutdownTimeout = time.Duration(n) * time.Second
+		}
+	}
+	if val := os.Getenv("BLOCK_CACHE_MB"); val != "" {
+		if mb, err := strconv.ParseInt(val, 10, 64); err == nil && mb >= 0 {
+			opts.BlockCacheBytes = mb * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("MAX_OPEN_FILES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.MaxOpenFiles = n
+		}
+	}
+	if val := os.Getenv("MMAP_READS"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			opts.MmapReads = b
+		}
+	}
+	if val := os.Getenv("READ_AHEAD_KB"); val != "" {
+		if kb, err := strconv.ParseInt(val, 10, 64); err == nil && kb >= 0 {
+			opts.ReadAheadBytes = kb * 1024
+		}
+	}
+	if val := os.Getenv("WAL_SYNC"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			opts.WALSync = b
+		}
+	}
+	if val := os.Getenv("WAL_DURABILITY"); val != "" {
+		if d, err := engine.ParseDurability(val); err == nil {
+			opts.WALDurability = d
+		} else {
+			slog.Warn("Ignoring WAL_DURABILITY", "error", err)
+		}
+	}
+	if val := os.Getenv("WAL_SEGMENT_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			opts.WALSegmentBytes = n * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("WAL_PREALLOCATE"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			opts.WALPreallocate = b
+		}
+	}
+	if val := os.Getenv("WAL_RECYCLE_FILES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.WALRecycleFiles = n
+		}
+	}
+	opts.WALArchiveDir = os.Getenv("WAL_ARCHIVE_DIR")
+	if val := os.Getenv("WAL_ARCHIVE_RETENTION_HOURS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.WALArchiveRetention = time.Duration(n) * time.Hour
+		}
+	}
+	if val := os.Getenv("WAL_ARCHIVE_MAX_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			opts.WALArchiveMaxBytes = n * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("GROUP_COMMIT_DELAY_US"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.GroupCommitDelay = time.Duration(n) * time.Microsecond
+		}
+	}
+	if val := os.Getenv("GROUP_COMMIT_AUTOTUNE"); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			opts.GroupCommitAutoTune = b
+		}
+	}
+	if val := os.Getenv("READ_LATENCY_SLO_MS"); val != "" {
+		if ms, err := strconv.ParseFloat(val, 64); err == nil && ms >= 0 {
+			opts.ReadLatencySLO = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if val := os.Getenv("GROUP_COMMIT_MAX_KB"); val != "" {
+		if kb, err := strconv.ParseInt(val, 10, 64); err == nil && kb > 0 {
+			opts.GroupCommitMaxBytes = kb * 1024
+		}
+	}
+	if val := os.Getenv("VALUE_LOG_THRESHOLD"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.ValueLogThreshold = n
+		}
+	}
+	if val := os.Getenv("BLOOM_BITS_PER_KEY"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n != 0 {
+			opts.BloomBitsPerKey = n
+		}
+	}
+	if val := os.Getenv("BLOOM_HASHES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.BloomHashes = n
+		}
+	}
+	if val := os.Getenv("BLOOM_LEVEL_BITS"); val != "" {
+		// "level:bits" cách nhau bằng dấu phẩy, vd. "2:-1" tắt bloom ở L2
+		opts.BloomLevels = make(map[int]lsm.BloomPolicy)
+		for _, part := range strings.Split(val, ",") {
+			lv, bits, ok := strings.Cut(strings.TrimSpace(part), ":")
+			level, err1 := strconv.Atoi(lv)
+			n, err2 := strconv.Atoi(bits)
+			if !ok || err1 != nil || err2 != nil || n == 0 {
+				slog.Warn("Ignoring BLOOM_LEVEL_BITS entry", "entry", part)
+				continue
+			}
+			opts.BloomLevels[level] = lsm.BloomPolicy{BitsPerKey: n, Hashes: opts.BloomHashes}
+		}
+	}
+	if val := os.Getenv("TARGET_FILE_SIZE_MB"); val != "" {
+		if mb, err := strconv.ParseInt(val, 10, 64); err == nil && mb >= 0 {
+			opts.TargetFileSize = mb * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("TARGET_FILE_SIZE_LEVEL_MB"); val != "" {
+		// "level:MB" cách nhau bằng dấu phẩy, vd. "2:128"
+		opts.TargetFileSizeLevels = make(map[int]int64)
+		for _, part := range strings.Split(val, ",") {
+			lv, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+			level, err1 := strconv.Atoi(lv)
+			mb, err2 := strconv.ParseInt(size, 10, 64)
+			if !ok || err1 != nil || err2 != nil || mb < 0 {
+				slog.Warn("Ignoring TARGET_FILE_SIZE_LEVEL_MB entry", "entry", part)
+				continue
+			}
+			opts.TargetFileSizeLevels[level] = mb * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("MAX_SUBCOMPACTIONS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			opts.MaxSubcompactions = n
+		}
+	}
+	if val := os.Getenv("L0_MERGE_FILE_KB"); val != "" {
+		if kb, err := strconv.ParseInt(val, 10, 64); err == nil && kb >= 0 {
+			opts.L0MergeFileBytes = kb * 1024
+		}
+	}
+	if val := os.Getenv("BLOCK_SIZE_KB"); val != "" {
+		if kb, err := strconv.Atoi(val); err == nil && kb >= 0 {
+			opts.BlockSize = kb * 1024
+		}
+	}
+	if val := os.Getenv("BLOCK_SIZE_LEVEL_KB"); val != "" {
+		// "level:KB" cách nhau bằng dấu phẩy, vd. "0:4,2:32"
+		opts.BlockSizeLevels = make(map[int]int)
+		for _, part := range strings.Split(val, ",") {
+			lv, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+			level, err1 := strconv.Atoi(lv)
+			kb, err2 := strconv.Atoi(size)
+			if !ok || err1 != nil || err2 != nil || kb <= 0 {
+				slog.Warn("Ignoring BLOCK_SIZE_LEVEL_KB entry", "entry", part)
+				continue
+			}
+			opts.BlockSizeLevels[level] = kb * 1024
+		}
+	}
+	if val := os.Getenv("BLOCK_SIZE_COLLECTION_KB"); val != "" {
+		// "collection:KB" cách nhau bằng dấu phẩy, vd. "events:64,sessions:1"
+		opts.BlockSizeCollections = make(map[string]int)
+		for _, part := range strings.Split(val, ",") {
+			col, size, ok := strings.Cut(strings.TrimSpace(part), ":")
+			kb, err := strconv.Atoi(size)
+			if !ok || col == "" || err != nil || kb <= 0 {
+				slog.Warn("Ignoring BLOCK_SIZE_COLLECTION_KB entry", "entry", part)
+				continue
+			}
+			opts.BlockSizeCollections[col] = kb * 1024
+		}
+	}
+	if val := os.Getenv("SST_COMPRESSION"); val != "" {
+		if c, err := lsm.ParseCompression(val); err == nil {
+			opts.Compression = c
+		} else {
+			slog.Warn("Ignoring SST_COMPRESSION", "error", err)
 		}
 	}
 
@@ -47,7 +274,7 @@ func main() {
 		dbPath = "data/MiniDBGo" // Giá trị mặc định (cho chạy local không docker)
 	}
 	slog.Info("Opening database", "path", dbPath)
-	db, err := lsm.OpenLSMWithConfig(dbPath, flushSize, maxMemBytes)
+	db, err := lsm.OpenLSMWithOptions(dbPath, opts)
 	if err != nil {
 		slog.Error("Failed to open database", "error", err)
 		os.Exit(1)
@@ -59,7 +286,90 @@ func main() {
 	}()
 
 	// Start HTTP server with graceful shutdown
-	server := startHttpServer(db, ":6866")
+	serverOpts := ServerOptions{}
+	if val := os.Getenv("PUBLIC_MODE"); val != "" {
+		serverOpts.Public, _ = strconv.ParseBool(val)
+	}
+	if val := os.Getenv("MAX_RESULTS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			serverOpts.MaxResults = n
+		}
+	}
+	serverOpts.MirrorURL = os.Getenv("MIRROR_URL")
+	if val := os.Getenv("MIRROR_PERCENT"); val != "" {
+		if p, err := strconv.ParseFloat(val, 64); err == nil && p >= 0 && p <= 100 {
+			serverOpts.MirrorPercent = p
+		}
+	}
+	serverOpts.Chaos = chaosConfigFromEnv()
+	if val := os.Getenv("CORS_ORIGINS"); val != "" {
+		for _, origin := range strings.Split(val, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				serverOpts.CORSOrigins = append(serverOpts.CORSOrigins, origin)
+			}
+		}
+	}
+	serverOpts.SecurityHeaders = true
+	if val := os.Getenv("SECURITY_HEADERS"); val != "" {
+		serverOpts.SecurityHeaders, _ = strconv.ParseBool(val)
+	}
+	if val := os.Getenv("HSTS_MAX_AGE"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			serverOpts.HSTSMaxAge = n
+		}
+	}
+	if val := os.Getenv("MAX_BODY_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+			serverOpts.MaxBodyBytes = n * 1024 * 1024
+		}
+	}
+	if val := os.Getenv("MAX_IMPORT_BODY_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n > 0 {
+			serverOpts.MaxImportBodyBytes = n * 1024 * 1024
+		}
+	}
+	serverOpts.ExportDir = os.Getenv("EXPORT_DIR")
+	if serverOpts.ExportDir == "" {
+		serverOpts.ExportDir = filepath.Join(dbPath, "exports")
+	}
+	serverOpts.ImportDir = os.Getenv("IMPORT_DIR")
+	if serverOpts.ImportDir == "" {
+		serverOpts.ImportDir = filepath.Join(dbPath, "imports")
+	}
+	serverOpts.TCPAddr = os.Getenv("TCP_ADDR")
+	if val := os.Getenv("MAX_CONN_LIFETIME_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			serverOpts.MaxConnLifetime = time.Duration(n) * time.Second
+		}
+	}
+	if val := os.Getenv("DRAIN_SEC"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			serverOpts.DrainPeriod = time.Duration(n) * time.Second
+		}
+	}
+	serverOpts.PayloadLog = strings.ToLower(os.Getenv("PAYLOAD_LOG"))
+	if serverOpts.PayloadLog != "" && !validPayloadLogMode(serverOpts.PayloadLog) {
+		log.Printf("[MAIN] Unknown PAYLOAD_LOG %q (use off, sampled or truncated), payload logging is off\n", serverOpts.PayloadLog)
+	}
+	serverOpts.PayloadLogPercent = DefaultPayloadLogPercent
+	if val := os.Getenv("PAYLOAD_LOG_PERCENT"); val != "" {
+		if p, err := strconv.ParseFloat(val, 64); err == nil && p >= 0 && p <= 100 {
+			serverOpts.PayloadLogPercent = p
+		}
+	}
+	if val := os.Getenv("PAYLOAD_LOG_MAX_BYTES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			serverOpts.PayloadLogMaxBytes = n
+		}
+	}
+	if val := os.Getenv("SENSITIVE_FIELDS"); val != "" {
+		for _, field := range strings.Split(val, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				serverOpts.SensitiveFields = append(serverOpts.SensitiveFields, field)
+			}
+		}
+	}
+	server := startHttpServer(db, ":6866", serverOpts)
 	_ = server // Keep reference to prevent GC
 
 	// Server-only mode
@@ -98,7 +408,7 @@ func printUsage() {
 
 	fmt.Println(ColorYellow + "\n📝 CLI Usage" + ColorReset)
 	fmt.Println(ColorCyan + " Commands:" + ColorReset)
-	fmt.Println("  insertOne, findOne, findMany, updateOne, deleteOne, dumpAll")
+	fmt.Println("  insertOne, findOne, findMany, updateOne, deleteOne, updateMany, deleteMany, findOneAndUpdate, findOneAndDelete, count, distinct, dumpAll")
 
 	fmt.Println(ColorCyan + "\n 💡 Examples (using 'products' collection):" + ColorReset)
 
@@ -124,6 +434,12 @@ func printUsage() {
 		ColorYellow + "\"price\"" + ColorReset + ":{" +
 		ColorBlue + "\"$gt\"" + ColorReset + ":" + ColorGreen + "1000" + ColorReset + "}}")
 
+	fmt.Println("  findMany products " + ColorReset + "{" +
+		ColorBlue + "\"$or\"" + ColorReset + ":[{" +
+		ColorYellow + "\"price\"" + ColorReset + ":{" +
+		ColorBlue + "\"$gt\"" + ColorReset + ":" + ColorGreen + "1000" + ColorReset + "}},{" +
+		ColorYellow + "\"category\"" + ColorReset + ":" + ColorCyan + "\"sale\"" + ColorReset + "}]}")
+
 	fmt.Println("  updateOne products " + ColorReset + "{" +
 		ColorYellow + "\"_id\"" + ColorReset + ":" + ColorCyan + "\"p1\"" + ColorReset + "} " + ColorReset + "{" +
 		ColorBlue + "\"$set\"" + ColorReset + ":{" +
@@ -136,8 +452,16 @@ func printUsage() {
 
 	fmt.Println("\n" + ColorCyan + " 🔧 DB Operations:" + ColorReset)
 	fmt.Println("  dumpDB                      " + ColorBlue + "# Export all collections to a file" + ColorReset)
+	fmt.Println("  exportMeta [file.json]      " + ColorBlue + "# Export index definitions only" + ColorReset)
 	fmt.Println("  restoreDB <file.json>       " + ColorBlue + "# Restore from a dump file" + ColorReset)
 	fmt.Println("  compact                     " + ColorBlue + "# Reclaim space from old data" + ColorReset)
+	fmt.Println("  createIndex <col> <field> [collation] " + ColorBlue + "# Index a field to speed up findMany" + ColorReset)
+	fmt.Println("  createIndex <col> <f1,f2>   " + ColorBlue + "# Compound index (filter on f1, sorted by f2)" + ColorReset)
+	fmt.Println("  createIndex <col> <field> unique " + ColorBlue + "# Reject duplicate values" + ColorReset)
+	fmt.Println("  listIndexes <col>           " + ColorBlue + "# Show indexed fields of a collection" + ColorReset)
+	fmt.Println("  createTextIndex <col> <field...> " + ColorBlue + "# Full-text index for textSearch / $text" + ColorReset)
+	fmt.Println("  textSearch <col> <words>    " + ColorBlue + "# Full-text search, best matches first" + ColorReset)
+	fmt.Println("  setReference <col> <field> <target> [checkInsert] [restrict|cascade] " + ColorBlue + "# e.g. orders customerId customers" + ColorReset)
 	fmt.Println("  exit")
 
 	fmt.Println(ColorYellow + "\n🌐 REST API Examples (cURL):" + ColorReset)
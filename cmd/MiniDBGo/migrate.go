@@ -27,7 +27,7 @@ func mainMigrate() {
 	// --- SỬA ĐỔI: Gọi lsm.OpenLSM ---
 	eng, err := lsm.OpenLSM(lsmDir) // (Trả về engine.Engine)
 	if err != nil {
-		log.Fatalf("open lsm failed: %w", err)
+		log.Fatalf("open lsm failed: %v", err)
 	}
 	// --- KẾT THÚC SỬA ĐỔI ---
 
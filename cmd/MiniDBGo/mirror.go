@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+)
+
+const (
+	mirrorQueueSize = 1000
+	mirrorWorkers   = 4
+	mirrorTimeout   = 5 * time.Second
+
+	jobMirror = "mirror" // Lane gửi request mirror trong bộ lập lịch của server
+)
+
+// mirrorRequest là bản sao của một request ghi cần gửi sang endpoint phụ
+type mirrorRequest struct {
+	method string
+	uri    string // path + query
+	body   []byte
+	header http.Header
+}
+
+// trafficMirror gửi (fire-and-forget) một phần lưu lượng ghi sang một
+// MiniDBGo khác để kiểm thử phiên bản/cấu hình mới với tải thật.
+// Kết quả của endpoint phụ không bao giờ ảnh hưởng tới response chính.
+type trafficMirror struct {
+	target  string  // vd: http://staging:6866
+	percent float64 // 0..100
+	client  *http.Client
+	jobs    *jobs.Scheduler
+
+	sent    atomic.Int64 // Endpoint phụ đã nhận (mọi status code)
+	failed  atomic.Int64 // Lỗi mạng / timeout / status 5xx
+	dropped atomic.Int64 // Hàng đợi đầy, bỏ qua
+}
+
+func newTrafficMirror(sched *jobs.Scheduler, target string, percent float64) *trafficMirror {
+	m := &trafficMirror{
+		target:  strings.TrimRight(target, "/"),
+		percent: percent,
+		client:  &http.Client{Timeout: mirrorTimeout},
+		jobs:    sched,
+	}
+	// Mỗi request là một job rất ngắn: chỉ thống kê theo lane, không ghi từng job
+	sched.AddLane(jobMirror, jobs.LaneOptions{Workers: mirrorWorkers, QueueSize: mirrorQueueSize})
+	slog.Info("Traffic mirroring enabled", "component", "mirror", "target", m.target, "percent", percent)
+	return m
+}
+
+// isWriteRequest: PUT/DELETE, và POST trừ các route chỉ đọc
+func isWriteRequest(r *http.Request) bool {
+	switch r.Method {
+	case "PUT", "PATCH", "DELETE":
+		return true
+	case "POST":
+		return !strings.HasSuffix(r.URL.Path, "/_search") &&
+			!strings.HasSuffix(r.URL.Path, "/_aggregate") &&
+			!strings.HasSuffix(r.URL.Path, "/_count") &&
+			!strings.HasSuffix(r.URL.Path, "/_distinct") &&
+			!strings.HasSuffix(r.URL.Path, "/_textSearch") &&
+			!strings.HasSuffix(r.URL.Path, "/_exportQuery") &&
+			!strings.HasSuffix(r.URL.Path, "/_importJob") // Tệp nguồn nằm trên server này
+	}
+	return false
+}
+
+// maybeMirror lấy mẫu theo percent và đưa request vào hàng đợi (không chặn)
+func (m *trafficMirror) maybeMirror(r *http.Request, body []byte) {
+	if !isWriteRequest(r) || rand.Float64()*100 >= m.percent {
+		return
+	}
+	req := mirrorRequest{
+		method: r.Method,
+		uri:    r.URL.RequestURI(),
+		body:   body,
+		header: http.Header{"Content-Type": r.Header.Values("Content-Type")},
+	}
+	if err := m.jobs.Submit(jobMirror, "", func() error { return m.send(req) }); err != nil {
+		m.dropped.Add(1)
+	}
+}
+
+// send gửi một request sang endpoint phụ (chạy trong lane "mirror")
+func (m *trafficMirror) send(req mirrorRequest) error {
+	httpReq, err := http.NewRequest(req.method, m.target+req.uri, bytes.NewReader(req.body))
+	if err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	httpReq.Header = req.header
+	httpReq.Header.Set("X-MiniDBGo-Mirror", "1")
+
+	resp, err := m.client.Do(httpReq)
+	if err != nil {
+		m.failed.Add(1)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		m.failed.Add(1)
+		return fmt.Errorf("mirror target returned %d", resp.StatusCode)
+	}
+	m.sent.Add(1)
+	return nil
+}
+
+func (m *trafficMirror) metrics() map[string]int64 {
+	return map[string]int64{
+		"mirror_sent":    m.sent.Load(),
+		"mirror_failed":  m.failed.Load(),
+		"mirror_dropped": m.dropped.Load(),
+		"mirror_queued":  m.queued(),
+	}
+}
+
+func (m *trafficMirror) queued() int64 {
+	lane, _ := m.jobs.Lane(jobMirror)
+	return int64(lane.Queued)
+}
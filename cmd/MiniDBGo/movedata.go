@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nconghau/MiniDBGo/internal/lsm"
+)
+
+// Usage: go run ./cmd/MiniDBGo move-data [--link] <old-dir> <new-dir>
+func mainMoveData() {
+	args := os.Args[2:]
+	link := false
+	if len(args) > 0 && args[0] == "--link" {
+		link = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		fmt.Println("Usage: move-data [--link] <old-dir> <new-dir>")
+		fmt.Println("  --link  hard-link files instead of copying (falls back to copy across filesystems)")
+		os.Exit(1)
+	}
+
+	report, err := lsm.MoveData(args[0], args[1], link)
+	if err != nil {
+		fmt.Println(ColorRed+"move-data failed:"+ColorReset, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Moved %d files (%d linked, %d copied, %.2f MB) to %s\n",
+		report.Files, report.Linked, report.Copied, float64(report.Bytes)/1024/1024, args[1])
+	fmt.Println("Checksums verified. Old directory was left in place:", args[0])
+}
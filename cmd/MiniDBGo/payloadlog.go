@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Chế độ ghi payload của request vào log (PAYLOAD_LOG)
+const (
+	payloadLogOff       = "off"       // Không ghi payload (mặc định)
+	payloadLogSampled   = "sampled"   // Chỉ PayloadLogPercent% request được ghi
+	payloadLogTruncated = "truncated" // Mọi request, cắt còn PayloadLogMaxBytes
+
+	DefaultPayloadLogMaxBytes = 1024
+	DefaultPayloadLogPercent  = 1.0
+
+	redactedValue = "[REDACTED]"
+
+	// sensitiveMetaName: field nhạy cảm của mọi collection (xem appmeta.go)
+	sensitiveMetaName = "sensitive"
+)
+
+// sensitiveField đánh dấu một field nhạy cảm của collection
+type sensitiveField struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+}
+
+// collectionSensitive trả về các field nhạy cảm của collection (đã sắp xếp)
+func collectionSensitive(db engine.Engine, collection string) ([]string, error) {
+	var marks []sensitiveField
+	if err := loadAppMeta(db, sensitiveMetaName, &marks); err != nil {
+		return nil, err
+	}
+	out := make([]string, 0)
+	for _, f := range marks {
+		if f.Collection == collection {
+			out = append(out, f.Field)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// setSensitive đánh dấu (hoặc bỏ đánh dấu) các field của collection là nhạy cảm
+func setSensitive(db engine.Engine, collection string, changes map[string]bool) error {
+	for field := range changes {
+		if collection == "" || field == "" {
+			return errors.New("collection and field are required")
+		}
+	}
+	var marks []sensitiveField
+	return updateAppMeta(db, sensitiveMetaName, &marks, func() error {
+		kept := marks[:0]
+		for _, f := range marks {
+			if _, changed := changes[f.Field]; f.Collection != collection || !changed {
+				kept = append(kept, f)
+			}
+		}
+		for field, sensitive := range changes {
+			if sensitive {
+				kept = append(kept, sensitiveField{Collection: collection, Field: field})
+			}
+		}
+		marks = kept
+		return nil
+	})
+}
+
+// validPayloadLogMode: mode có phải một chế độ ghi payload hợp lệ không
+func validPayloadLogMode(mode string) bool {
+	return mode == payloadLogOff || mode == payloadLogSampled || mode == payloadLogTruncated
+}
+
+// payloadAttr trả về thuộc tính "payload" cho log của request, sau khi che
+// các field nhạy cảm (đánh dấu trên collection qua _sensitive hoặc chung qua
+// SensitiveFields) và cắt bớt. ok=false nếu không ghi payload của request này.
+func (s *Server) payloadAttr(r *http.Request, body []byte) (attr slog.Attr, ok bool) {
+	if len(body) == 0 || (r.Method != "POST" && r.Method != "PUT" && r.Method != "PATCH") {
+		return attr, false
+	}
+	switch s.opts.PayloadLog {
+	case payloadLogTruncated:
+	case payloadLogSampled:
+		if rand.Float64()*100 >= s.opts.PayloadLogPercent {
+			return attr, false
+		}
+	default:
+		return attr, false
+	}
+
+	payload := string(body)
+	fields, err := s.sensitiveFields(r.URL.Path)
+	if err != nil {
+		// Không đọc được field nhạy cảm của collection: bỏ cả payload
+		payload = fmt.Sprintf("[payload of %d bytes omitted: %v]", len(body), err)
+	} else if len(fields) > 0 {
+		redacted, err := redactPayload(body, fields)
+		if err != nil {
+			// Không phân tích được thì không biết phần nào nhạy cảm: bỏ cả payload
+			payload = fmt.Sprintf("[unparsable payload of %d bytes omitted]", len(body))
+		} else {
+			payload = string(redacted)
+		}
+	}
+	return slog.String("payload", truncatePayload(payload, s.opts.PayloadLogMaxBytes)), true
+}
+
+// sensitiveFields gộp các field nhạy cảm chung với các field được đánh dấu
+// trên collection của route /api/<col>/...
+func (s *Server) sensitiveFields(path string) ([]string, error) {
+	fields := s.opts.SensitiveFields
+	col, _, _ := strings.Cut(strings.Trim(strings.TrimPrefix(path, "/api"), "/"), "/")
+	if col != "" && !strings.HasPrefix(col, "_") {
+		marked, err := collectionSensitive(s.db, col)
+		if err != nil {
+			return nil, err
+		}
+		if len(marked) > 0 {
+			fields = append(append([]string(nil), fields...), marked...)
+		}
+	}
+	return fields, nil
+}
+
+// redactPayload thay giá trị của các field nhạy cảm trong body JSON bằng
+// "[REDACTED]". Đường dẫn tính từ gốc document; mảng (vd. _insertMany),
+// toán tử "$..." và các vỏ "filter"/"update" ở gốc được đi xuyên qua.
+func redactPayload(body []byte, fields []string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber() // Giữ nguyên số như client gửi
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	paths := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		paths[f] = true
+	}
+	return json.Marshal(redactValue(v, paths, "", true))
+}
+
+func redactValue(v interface{}, paths map[string]bool, prefix string, root bool) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, child := range val {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			switch {
+			case paths[path]:
+				val[k] = redactedValue
+			case strings.HasPrefix(k, "$"), root && (k == "filter" || k == "update"):
+				val[k] = redactValue(child, paths, prefix, false)
+			default:
+				val[k] = redactValue(child, paths, path, false)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = redactValue(child, paths, prefix, false)
+		}
+	}
+	return v
+}
+
+// truncatePayload cắt payload còn tối đa max byte (không cắt giữa ký tự UTF-8)
+func truncatePayload(payload string, max int) string {
+	if max <= 0 || len(payload) <= max {
+		return payload
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(payload[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...[truncated %d bytes]", payload[:cut], len(payload)-cut)
+}
+
+// handleSensitive đọc (GET) hoặc cập nhật (PUT) các field nhạy cảm của collection
+// PUT /api/<col>/_sensitive  body: {"email": true, "card.number": true, "old": false}
+func (s *Server) handleSensitive(w http.ResponseWriter, r *http.Request, collection string) {
+	if r.Method == "PUT" {
+		var marks map[string]bool
+		if err := json.NewDecoder(r.Body).Decode(&marks); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be an object of field -> true/false")
+			return
+		}
+		defer r.Body.Close()
+		if err := setSensitive(s.db, collection, marks); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	fields, err := collectionSensitive(s.db, collection)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "sensitive": fields})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/lsm"
+)
+
+// Usage: go run ./cmd/MiniDBGo pitr <restored-backup-dir> <archive-dir> --time <RFC3339> | --seq <segment>
+func mainPITR() {
+	args := os.Args[2:]
+	if len(args) != 4 || (args[2] != "--time" && args[2] != "--seq") {
+		fmt.Println("Usage: pitr <restored-backup-dir> <archive-dir> (--time <RFC3339> | --seq <wal-segment>)")
+		fmt.Println("  Prepares a copy of a base backup (database stopped) so that the next start replays")
+		fmt.Println("  archived WAL segments up to the given commit time or WAL segment number.")
+		os.Exit(1)
+	}
+	dir, archive := args[0], args[1]
+
+	var report *lsm.RestoreReport
+	var err error
+	if args[2] == "--time" {
+		ts, perr := time.Parse(time.RFC3339Nano, args[3])
+		if perr != nil {
+			fmt.Println(ColorRed+"Invalid --time:"+ColorReset, perr)
+			os.Exit(1)
+		}
+		report, err = lsm.RestoreToTimestamp(dir, archive, ts)
+	} else {
+		seq, perr := strconv.ParseInt(args[3], 10, 64)
+		if perr != nil {
+			fmt.Println(ColorRed+"Invalid --seq:"+ColorReset, perr)
+			os.Exit(1)
+		}
+		report, err = lsm.RestoreToSeq(dir, archive, seq)
+	}
+	if err != nil {
+		fmt.Println(ColorRed+"pitr failed:"+ColorReset, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Prepared %d WAL segments (%d records kept, %d dropped after the target) in %s\n",
+		report.Segments, report.Records, report.Dropped, dir)
+	if !report.LastCommit.IsZero() {
+		fmt.Println("Last commit kept:", report.LastCommit.UTC().Format(time.RFC3339Nano))
+	}
+	fmt.Println("Start MiniDBGo with DB_PATH=" + dir + " to replay them.")
+}
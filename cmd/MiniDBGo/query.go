@@ -0,0 +1,583 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// forEachMatch duyệt các document của collection khớp với filter.
+// Nếu filter có điều kiện trên field đã được index, chỉ các document
+// do index trả về được đọc; nếu không sẽ quét toàn bộ collection.
+// Quy tắc ép kiểu của collection được áp dụng khi so khớp;
+// fn nhận document gốc (chưa ép kiểu).
+// coll (có thể nil) quy định cách so sánh chuỗi.
+// fn trả về false để dừng sớm.
+func forEachMatch(ctx context.Context, db engine.Engine, col string, filter map[string]interface{}, coll *query.Collation,
+	fn func(key string, raw []byte, doc map[string]interface{}) bool) error {
+
+	scan, err := planScan(db, col, filter, coll, nil)
+	if err != nil {
+		return err
+	}
+	return scan.each(ctx, fn)
+}
+
+// matchScan là cách đọc các document khớp filter: qua danh sách _id
+// lấy từ index, hoặc quét toàn bộ collection
+type matchScan struct {
+	db      engine.Engine
+	col     string
+	matches func(doc map[string]interface{}) bool
+	ids     []string
+	indexed bool
+	sorted  bool // Document được duyệt theo đúng thứ tự sắp xếp được yêu cầu
+}
+
+// planScan kiểm tra filter và chọn cách đọc. Nếu keys khác rỗng và có index
+// trả về document theo đúng thứ tự đó thì scan.sorted = true: caller không
+// cần gom và sắp xếp (và có thể dừng sớm); ngược lại caller tự sắp xếp.
+func planScan(db engine.Engine, col string, filter map[string]interface{},
+	coll *query.Collation, keys []query.SortKey) (*matchScan, error) {
+
+	if err := query.ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	coerce := query.Coercions(db.Coercions(col))
+	filter, matches := docMatcher(coerce, filter, coll)
+	scan := &matchScan{db: db, col: col, matches: matches}
+
+	// $text (text index) được ưu tiên, trừ khi có index cho đúng thứ tự sắp xếp
+	plan, hasPlan := planIndex(db, col, filter, coerce, coll, keys)
+	if !plan.sorted {
+		if scan.ids, scan.indexed = textIndexLookup(db, col, filter); scan.indexed {
+			return scan, nil
+		}
+	}
+	if hasPlan {
+		if ids, err := plan.run(db, col); err == nil {
+			scan.ids, scan.indexed, scan.sorted = ids, true, plan.sorted
+		}
+	}
+	return scan, nil
+}
+
+// each gọi fn cho từng document khớp filter (fn trả về false để dừng)
+func (s *matchScan) each(ctx context.Context, fn func(key string, raw []byte, doc map[string]interface{}) bool) error {
+	if s.indexed {
+		for _, id := range s.ids {
+			key := s.col + ":" + id
+			raw, err := s.db.GetContext(ctx, []byte(key))
+			if err != nil && ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				continue // Index entry cũ (document đã bị xóa)
+			}
+			var doc map[string]interface{}
+			if err := json.Unmarshal(raw, &doc); err != nil {
+				continue
+			}
+			// Kiểm tra lại toàn bộ filter (index có thể chứa entry cũ)
+			if s.matches(doc) && !fn(key, raw, doc) {
+				return nil
+			}
+		}
+		return nil
+	}
+
+	// Quét trên snapshot: kết quả nhất quán và không chặn các lần ghi
+	snap, err := s.db.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+	it, err := snap.NewPrefixIteratorContext(ctx, s.col+":")
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	for it.Next() {
+		key := it.Key()
+		val := it.Value().Value
+		var doc map[string]interface{}
+		if err := json.Unmarshal(val, &doc); err != nil {
+			continue // Bỏ qua JSON hỏng
+		}
+
+		if s.matches(doc) && !fn(key, val, doc) {
+			break
+		}
+	}
+	return it.Error()
+}
+
+// lookupDocs là nguồn đọc cho $lookup: mỗi lô _id là một lần MultiGet
+func lookupDocs(ctx context.Context, db engine.Engine) query.LookupFunc {
+	return func(col string, ids []string) (map[string]map[string]interface{}, error) {
+		keys := make([][]byte, len(ids))
+		for i, id := range ids {
+			keys[i] = []byte(col + ":" + id)
+		}
+		vals, err := db.MultiGet(ctx, keys)
+		if err != nil {
+			return nil, err
+		}
+		docs := make(map[string]map[string]interface{}, len(ids))
+		for i, raw := range vals {
+			var doc map[string]interface{}
+			if raw != nil && json.Unmarshal(raw, &doc) == nil {
+				docs[ids[i]] = doc
+			}
+		}
+		return docs, nil
+	}
+}
+
+// docMatcher trả về filter đã ép kiểu và hàm so khớp document gốc với nó
+func docMatcher(coerce query.Coercions, filter map[string]interface{}, coll *query.Collation) (
+	map[string]interface{}, func(doc map[string]interface{}) bool) {
+
+	if len(coerce) > 0 {
+		filter = coerce.Filter(filter)
+	}
+	return filter, func(doc map[string]interface{}) bool {
+		return query.MatchFilterWith(coerce.Doc(doc), filter, coll)
+	}
+}
+
+// indexPlan là cách đọc document qua một index: eq cố định các field đầu
+// của index, r giới hạn field kế tiếp
+type indexPlan struct {
+	index  string
+	eq     []interface{}
+	r      engine.IndexRange
+	sorted bool // _id trả về theo thứ tự sắp xếp được yêu cầu
+	desc   bool // Thứ tự giảm dần: đảo ngược kết quả của index
+}
+
+func (p indexPlan) run(db engine.Engine, col string) ([]string, error) {
+	ids, err := db.IndexScan(col, p.index, p.eq, p.r)
+	if err != nil {
+		return nil, err
+	}
+	if p.desc {
+		for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+			ids[i], ids[j] = ids[j], ids[i]
+		}
+	}
+	return ids, nil
+}
+
+// planIndex chọn index tốt nhất cho filter: index có nhiều field đầu được
+// cố định bằng điều kiện bằng ({"f": v}) nhất, cộng một điều kiện khoảng
+// ({"f": {"$gte": a, "$lt": b}}) trên field kế tiếp.
+// Field có quy tắc ép kiểu bị bỏ qua (index lưu giá trị gốc),
+// index có collation khác với truy vấn cũng vậy. Nếu keys khác rỗng, ưu tiên index mà các field ngay sau phần cố định
+// trùng với keys (cùng chiều), vì khi đó index đã trả về đúng thứ tự sắp xếp.
+func planIndex(db engine.Engine, col string, filter map[string]interface{},
+	coerce query.Coercions, coll *query.Collation, keys []query.SortKey) (indexPlan, bool) {
+
+	var best indexPlan
+	bestScore := 0
+	for _, name := range db.ListIndexes(col) {
+		opts, _ := db.IndexInfo(col, name)
+		if !query.SameCollation(opts.Collation, coll) {
+			continue
+		}
+		fields := engine.IndexFields(name)
+		plan := indexPlan{index: name}
+
+		k := 0
+		for ; k < len(fields); k++ {
+			cond, ok := filter[fields[k]]
+			if _, coerced := coerce[fields[k]]; !ok || coerced || !isEqualityCond(cond) {
+				break
+			}
+			plan.eq = append(plan.eq, cond)
+		}
+		hasRange := false
+		if k < len(fields) {
+			if cond, ok := filter[fields[k]]; ok {
+				if _, coerced := coerce[fields[k]]; !coerced {
+					plan.r, hasRange = indexRangeFor(cond)
+				}
+				if opts.Multikey && plan.r.Lower != nil {
+					// Với mảng, hai cận có thể được thỏa bởi hai phần tử khác nhau
+					// (xem query.MatchFilter): chỉ dùng một cận, phần còn lại lọc sau
+					plan.r.Upper = nil
+				}
+			}
+		}
+
+		// Index một field bỏ qua document thiếu field, nên chỉ cho thứ tự
+		// đầy đủ khi filter đã loại các document đó (có điều kiện khoảng)
+		// Index multikey sắp theo từng phần tử, không theo cả mảng
+		if len(keys) > 0 && k < len(fields) && (len(fields) > 1 || hasRange) && !opts.Multikey {
+			plan.sorted, plan.desc = sortMatches(fields[k:], keys, coerce)
+		}
+
+		score := 2*k + boolScore(hasRange)
+		if score == 0 && !plan.sorted {
+			continue
+		}
+		if plan.sorted {
+			score += 2 * len(fields) // Tránh được bước sắp xếp: luôn thắng
+		}
+		if score > bestScore {
+			best, bestScore = plan, score
+		}
+	}
+	return best, bestScore > 0
+}
+
+// sortMatches kiểm tra keys có phải là phần đầu của fields (cùng một chiều).
+// Field có quy tắc ép kiểu không dùng được (index sắp theo giá trị gốc).
+func sortMatches(fields []string, keys []query.SortKey, coerce query.Coercions) (sorted bool, desc bool) {
+	if len(keys) > len(fields) {
+		return false, false
+	}
+	for i, k := range keys {
+		if _, coerced := coerce[k.Field]; coerced {
+			return false, false
+		}
+		if k.Field != fields[i] || k.Desc != keys[0].Desc {
+			return false, false
+		}
+	}
+	return true, keys[0].Desc
+}
+
+func boolScore(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// isEqualityCond: điều kiện dạng {"f": v} với v là giá trị có thể index
+func isEqualityCond(cond interface{}) bool {
+	switch cond.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return false
+	}
+	return true
+}
+
+// indexRangeFor chuyển một điều kiện filter thành engine.IndexRange
+func indexRangeFor(cond interface{}) (engine.IndexRange, bool) {
+	ops, isOps := cond.(map[string]interface{})
+	if !isOps {
+		if _, isArr := cond.([]interface{}); isArr || cond == nil {
+			// null cũng khớp document thiếu field (không có trong index)
+			return engine.IndexRange{}, false
+		}
+		b := &engine.IndexBound{Value: cond, Inclusive: true}
+		return engine.IndexRange{Lower: b, Upper: b}, true
+	}
+
+	var r engine.IndexRange
+	for op, v := range ops {
+		switch strings.ToLower(op) {
+		case "$gt":
+			r.Lower = &engine.IndexBound{Value: v}
+		case "$gte":
+			r.Lower = &engine.IndexBound{Value: v, Inclusive: true}
+		case "$lt":
+			r.Upper = &engine.IndexBound{Value: v}
+		case "$lte":
+			r.Upper = &engine.IndexBound{Value: v, Inclusive: true}
+		default:
+			return engine.IndexRange{}, false
+		}
+	}
+	if r.Lower == nil && r.Upper == nil {
+		return engine.IndexRange{}, false
+	}
+	return r, true
+}
+
+// forEachTagged duyệt các document có đủ mọi nhãn trong tags (_tags).
+// Index _tags được engine tự tạo khi collection có document gắn nhãn;
+// nếu chưa có index nghĩa là collection chưa có nhãn nào.
+func forEachTagged(db engine.Engine, col string, tags []string,
+	fn func(key string, doc map[string]interface{}) bool) error {
+
+	if !hasIndex(db, col, engine.TagsField) {
+		return nil
+	}
+
+	// Tra index theo nhãn đầu tiên, kiểm tra các nhãn còn lại trên document
+	b := &engine.IndexBound{Value: tags[0], Inclusive: true}
+	ids, err := db.IndexLookup(col, engine.TagsField, engine.IndexRange{Lower: b, Upper: b})
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		key := col + ":" + id
+		raw, err := db.Get([]byte(key))
+		if err != nil {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			continue
+		}
+		if hasAllTags(doc, tags) && !fn(key, doc) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func hasIndex(db engine.Engine, col, field string) bool {
+	for _, f := range db.ListIndexes(col) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAllTags kiểm tra document có chứa mọi nhãn hay không
+func hasAllTags(doc map[string]interface{}, tags []string) bool {
+	arr, ok := doc[engine.TagsField].([]interface{})
+	if !ok {
+		return false
+	}
+	for _, want := range tags {
+		found := false
+		for _, t := range arr {
+			if s, ok := t.(string); ok && s == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Số document tối đa mà updateMany/deleteMany ghi trong một batch
+const maxManyBatch = 10000
+
+// errTooManyMatches: filter khớp quá nhiều document cho một batch nguyên tử
+var errTooManyMatches = fmt.Errorf("filter matches more than %d documents, narrow it down", maxManyBatch)
+
+// updateMany áp dụng update lên mọi document khớp filter trong một ApplyBatch
+func updateMany(ctx context.Context, db engine.Engine, col string, filter, update map[string]interface{}, coll *query.Collation) (int, error) {
+	batch := db.NewBatch()
+	count := 0
+	var applyErr error
+
+	// Iterator giữ khóa đọc của MemTable: gom thay đổi vào batch, ghi sau
+	err := forEachMatch(ctx, db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
+		if count >= maxManyBatch {
+			applyErr = errTooManyMatches
+			return false
+		}
+		if applyErr = query.ApplyUpdate(doc, update); applyErr != nil {
+			return false
+		}
+		out, err := json.Marshal(doc)
+		if err != nil {
+			applyErr = err
+			return false
+		}
+		batch.Put([]byte(key), out)
+		count++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if applyErr != nil {
+		return 0, applyErr
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := db.ApplyBatch(batch); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// deleteMany xóa mọi document khớp filter trong một ApplyBatch
+func deleteMany(ctx context.Context, db engine.Engine, col string, filter map[string]interface{}, coll *query.Collation) (int, error) {
+	batch := db.NewBatch()
+	count := 0
+	tooMany := false
+
+	err := forEachMatch(ctx, db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
+		if count >= maxManyBatch {
+			tooMany = true
+			return false
+		}
+		batch.Delete([]byte(key))
+		count++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if tooMany {
+		return 0, errTooManyMatches
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	if err := db.ApplyBatch(batch); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Số lần tìm lại khi document vừa tìm thấy bị sửa/xóa trước khi kịp khóa
+const findModifyRetries = 5
+
+// findOneAndUpdate áp dụng update lên document đầu tiên khớp filter.
+// Việc đọc-sửa-ghi diễn ra dưới khóa key của engine và filter được kiểm tra
+// lại trên giá trị mới nhất, nên không mất cập nhật khi ghi đồng thời.
+// Trả về document trước và sau khi cập nhật (nil, nil nếu không có document khớp).
+func findOneAndUpdate(ctx context.Context, db engine.Engine, col string, filter, update map[string]interface{},
+	coll *query.Collation) (map[string]interface{}, map[string]interface{}, error) {
+
+	_, matches := docMatcher(query.Coercions(db.Coercions(col)), filter, coll)
+	for attempt := 0; attempt < findModifyRetries; attempt++ {
+		key, ok, err := findFirstKey(ctx, db, col, filter, coll)
+		if err != nil || !ok {
+			return nil, nil, err
+		}
+
+		var before, after map[string]interface{}
+		_, _, err = db.FindOneAndUpdate([]byte(key), func(old []byte) ([]byte, error) {
+			if old == nil || json.Unmarshal(old, &before) != nil || !matches(before) {
+				before = nil
+				return nil, nil // Đã bị xóa hoặc không còn khớp: tìm lại
+			}
+			after = make(map[string]interface{}, len(before))
+			for k, v := range before {
+				after[k] = v
+			}
+			if err := query.ApplyUpdate(after, update); err != nil {
+				return nil, err
+			}
+			return json.Marshal(after)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		if before != nil {
+			return before, after, nil
+		}
+	}
+	return nil, nil, errConcurrentModification
+}
+
+// findOneAndDelete xóa document đầu tiên khớp filter và trả về nó
+// (nil nếu không có document khớp)
+func findOneAndDelete(ctx context.Context, db engine.Engine, col string, filter map[string]interface{}, coll *query.Collation) (
+	map[string]interface{}, error) {
+
+	_, matches := docMatcher(query.Coercions(db.Coercions(col)), filter, coll)
+	for attempt := 0; attempt < findModifyRetries; attempt++ {
+		key, ok, err := findFirstKey(ctx, db, col, filter, coll)
+		if err != nil || !ok {
+			return nil, err
+		}
+
+		var doc map[string]interface{}
+		old, err := db.FindOneAndDelete([]byte(key), func(old []byte) bool {
+			return json.Unmarshal(old, &doc) == nil && matches(doc)
+		})
+		if errors.Is(err, engine.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if old != nil {
+			return doc, nil
+		}
+	}
+	return nil, errConcurrentModification
+}
+
+// updateByKey áp dụng update lên document tại key (đọc-sửa-ghi nguyên tử)
+// và trả về document sau khi cập nhật.
+// Nếu document chưa tồn tại: upsert == nil thì trả về ErrKeyNotFound,
+// ngược lại document mới được tạo từ upsert rồi áp dụng update (created = true).
+func updateByKey(db engine.Engine, key []byte, update, upsert map[string]interface{}) (
+	doc map[string]interface{}, created bool, err error) {
+
+	_, _, err = db.FindOneAndUpdate(key, func(old []byte) ([]byte, error) {
+		if old == nil {
+			if upsert == nil {
+				return nil, engine.ErrKeyNotFound
+			}
+			doc, created = upsert, true
+		} else if err := json.Unmarshal(old, &doc); err != nil {
+			return nil, fmt.Errorf("stored document is not valid JSON: %w", err)
+		}
+		if err := query.ApplyUpdate(doc, update); err != nil {
+			return nil, err
+		}
+		return json.Marshal(doc)
+	})
+	return doc, created, err
+}
+
+func isOperatorCond(cond interface{}) bool {
+	m, ok := cond.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// upsertSeed tạo document ban đầu cho upsert: _id cộng các điều kiện
+// so sánh bằng của filter (vd {"sku": "A1", "price": {"$gt": 5}} -> sku)
+func upsertSeed(id string, filter map[string]interface{}) (map[string]interface{}, error) {
+	seed := map[string]interface{}{"_id": id}
+	for field, cond := range filter {
+		if field == "_id" || strings.HasPrefix(field, "$") {
+			continue
+		}
+		if isOperatorCond(cond) {
+			continue // Điều kiện toán tử không xác định được giá trị
+		}
+		if err := query.ApplyUpdate(seed, map[string]interface{}{"$set": map[string]interface{}{field: cond}}); err != nil {
+			return nil, err
+		}
+	}
+	return seed, nil
+}
+
+// errConcurrentModification: document khớp liên tục bị thay đổi bởi lần ghi khác
+var errConcurrentModification = errors.New("matching document kept changing concurrently, please retry")
+
+func findFirstKey(ctx context.Context, db engine.Engine, col string, filter map[string]interface{}, coll *query.Collation) (
+	string, bool, error) {
+
+	var found string
+	err := forEachMatch(ctx, db, col, filter, coll, func(key string, raw []byte, doc map[string]interface{}) bool {
+		found = key
+		return false
+	})
+	return found, found != "", err
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Giá trị mặc định của GC_PERCENT (trước đây được gán cứng trong main)
+const DefaultGCPercent = 30
+
+// RuntimeConfig là các tham số GC/bộ nhớ của Go runtime,
+// đọc từ env khi khởi động và chỉnh được khi đang chạy qua /api/_runtime
+type RuntimeConfig struct {
+	GCPercent  int   `json:"gc_percent"`   // debug.SetGCPercent; -1 = tắt GC
+	MaxProcs   int   `json:"gomaxprocs"`   // runtime.GOMAXPROCS
+	MemLimitMB int64 `json:"mem_limit_mb"` // debug.SetMemoryLimit; 0 = không giới hạn
+}
+
+// RuntimeConfigPatch là phần cần đổi (field nil được giữ nguyên)
+type RuntimeConfigPatch struct {
+	GCPercent  *int   `json:"gc_percent"`
+	MaxProcs   *int   `json:"gomaxprocs"`
+	MemLimitMB *int64 `json:"mem_limit_mb"`
+}
+
+var errInvalidRuntimeConfig = errors.New("invalid runtime config")
+
+// runtimeTuner giữ cấu hình đang hiệu lực để /api/stats có thể ghi nhận
+type runtimeTuner struct {
+	mu        sync.Mutex
+	cfg       RuntimeConfig
+	updatedAt time.Time
+	source    string // "env" hoặc "api"
+}
+
+var tuner = &runtimeTuner{}
+
+// runtimeConfigFromEnv đọc GC_PERCENT, GOMAXPROCS và GOMEMLIMIT_MB
+func runtimeConfigFromEnv() RuntimeConfig {
+	cfg := RuntimeConfig{
+		GCPercent: DefaultGCPercent,
+		MaxProcs:  runtime.NumCPU(),
+	}
+	if val := os.Getenv("GC_PERCENT"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n >= -1 {
+			cfg.GCPercent = n
+		}
+	}
+	if val := os.Getenv("GOMAXPROCS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil && n > 0 {
+			cfg.MaxProcs = n
+		}
+	}
+	if val := os.Getenv("GOMEMLIMIT_MB"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			cfg.MemLimitMB = n
+		}
+	} else if limit := debug.SetMemoryLimit(-1); limit != math.MaxInt64 {
+		// GOMEMLIMIT đã được runtime tự áp dụng khi khởi động
+		cfg.MemLimitMB = limit / 1024 / 1024
+	}
+	return cfg
+}
+
+// apply áp dụng cấu hình vào Go runtime
+func (t *runtimeTuner) apply(cfg RuntimeConfig, source string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	debug.SetGCPercent(cfg.GCPercent)
+	runtime.GOMAXPROCS(cfg.MaxProcs)
+	if cfg.MemLimitMB > 0 {
+		debug.SetMemoryLimit(cfg.MemLimitMB * 1024 * 1024)
+	} else {
+		debug.SetMemoryLimit(math.MaxInt64)
+	}
+
+	t.cfg = cfg
+	t.updatedAt = time.Now()
+	t.source = source
+	slog.Info("Runtime config applied", "source", source, "gc_percent", cfg.GCPercent,
+		"gomaxprocs", cfg.MaxProcs, "mem_limit_mb", cfg.MemLimitMB)
+}
+
+// update áp dụng một phần cấu hình và trả về cấu hình mới
+func (t *runtimeTuner) update(p RuntimeConfigPatch) (RuntimeConfig, error) {
+	cfg := t.current()
+	if p.GCPercent != nil {
+		if *p.GCPercent < -1 {
+			return cfg, fmt.Errorf("%w: gc_percent must be >= -1", errInvalidRuntimeConfig)
+		}
+		cfg.GCPercent = *p.GCPercent
+	}
+	if p.MaxProcs != nil {
+		if *p.MaxProcs < 1 {
+			return cfg, fmt.Errorf("%w: gomaxprocs must be >= 1", errInvalidRuntimeConfig)
+		}
+		cfg.MaxProcs = *p.MaxProcs
+	}
+	if p.MemLimitMB != nil {
+		if *p.MemLimitMB < 0 {
+			return cfg, fmt.Errorf("%w: mem_limit_mb must be >= 0", errInvalidRuntimeConfig)
+		}
+		cfg.MemLimitMB = *p.MemLimitMB
+	}
+	t.apply(cfg, "api")
+	return cfg, nil
+}
+
+func (t *runtimeTuner) current() RuntimeConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg
+}
+
+// stats trả về cấu hình hiệu lực kèm thời điểm và nguồn thay đổi gần nhất
+func (t *runtimeTuner) stats() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return map[string]interface{}{
+		"gc_percent":   t.cfg.GCPercent,
+		"gomaxprocs":   runtime.GOMAXPROCS(0),
+		"mem_limit_mb": t.cfg.MemLimitMB,
+		"source":       t.source,
+		"updated_at":   t.updatedAt.UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/lsm"
+)
+
+const defaultSeedTemplate = `{"_id":"{{id}}","name":"{{name}}","email":"{{email}}","age":"{{int 18 80}}","active":"{{bool}}","createdAt":"{{date}}"}`
+
+// Usage: go run ./cmd/MiniDBGo seed <col> [--template JSON] [--count N] [--batch N] [--seed N]
+// Ghi trực tiếp vào DB_PATH nên phải dừng server đang mở cùng thư mục.
+func mainSeed() {
+	fs := flag.NewFlagSet("seed", flag.ExitOnError)
+	template := fs.String("template", defaultSeedTemplate, "JSON document template with {{...}} placeholders")
+	count := fs.Int("count", 1000, "number of documents to generate")
+	batchSize := fs.Int("batch", 1000, "documents per write batch")
+	seed := fs.Int64("seed", 0, "random seed for reproducible data (0 = time based)")
+	fs.Usage = func() {
+		fmt.Println("Usage: seed <col> [--template JSON] [--count N] [--batch N] [--seed N]")
+		fmt.Println("  Placeholders: {{id}} {{seq}} {{name}} {{email}} {{word}} {{int MIN MAX}} {{float MIN MAX}}")
+		fmt.Println("                {{bool}} {{date}} {{pick A B ...}}")
+		fmt.Println("  A value that is exactly one placeholder keeps its type (\"{{int 1 9}}\" -> 7).")
+		fmt.Println("  Writes to DB_PATH directly: stop the server using that directory first.")
+	}
+
+	// Cho phép flag đứng sau tên collection: seed products --count 10
+	var positional []string
+	args := os.Args[2:]
+	for {
+		_ = fs.Parse(args)
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if len(positional) != 1 || *count <= 0 || *batchSize <= 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	col := positional[0]
+	if strings.Contains(col, ":") {
+		fmt.Println(ColorRed+"Invalid collection name:"+ColorReset, col)
+		os.Exit(1)
+	}
+
+	var tmpl interface{}
+	if err := json.Unmarshal([]byte(*template), &tmpl); err != nil {
+		fmt.Println(ColorRed+"Invalid template JSON:"+ColorReset, err)
+		os.Exit(1)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	gen := &seedGen{rnd: rand.New(rand.NewSource(*seed))}
+	// Sinh thử một document để báo lỗi placeholder trước khi mở DB
+	if _, err := gen.document(tmpl); err != nil {
+		fmt.Println(ColorRed+"Invalid template:"+ColorReset, err)
+		os.Exit(1)
+	}
+	gen = &seedGen{rnd: rand.New(rand.NewSource(*seed))}
+
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "data/MiniDBGo"
+	}
+	db, err := lsm.OpenLSM(dbPath)
+	if err != nil {
+		fmt.Println(ColorRed+"Open database failed:"+ColorReset, err)
+		os.Exit(1)
+	}
+
+	start := time.Now()
+	written, err := seedCollection(db, col, tmpl, gen, *count, *batchSize)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Printf(ColorRed+"seed failed after %d documents:"+ColorReset+" %v\n", written, err)
+		os.Exit(1)
+	}
+	elapsed := time.Since(start)
+	fmt.Printf("Seeded %d documents into %s in %s (%.0f docs/s, seed %d)\n",
+		written, col, elapsed.Round(time.Millisecond), float64(written)/elapsed.Seconds(), *seed)
+}
+
+// seedCollection sinh count document từ template và ghi theo từng batch
+func seedCollection(db engine.Engine, col string, tmpl interface{}, gen *seedGen, count, batchSize int) (int, error) {
+	written := 0
+	step := count / 10 // In tiến độ mỗi ~10%
+	for written < count {
+		n := batchSize
+		if count-written < n {
+			n = count - written
+		}
+		batch := db.NewBatch()
+		for i := 0; i < n; i++ {
+			doc, err := gen.document(tmpl)
+			if err != nil {
+				return written, err
+			}
+			raw, _ := json.Marshal(doc)
+			batch.Put([]byte(col+":"+doc["_id"].(string)), raw)
+		}
+		if err := db.ApplyBatch(batch); err != nil {
+			return written, err
+		}
+		prev := written
+		written += n
+		if step > 0 && written < count && written/step != prev/step {
+			fmt.Printf("  %d/%d\n", written, count)
+		}
+	}
+	return written, nil
+}
+
+var placeholderRe = regexp.MustCompile(`\{\{\s*([^}]*?)\s*\}\}`)
+
+var (
+	seedFirstNames = []string{"An", "Binh", "Chi", "Dung", "Giang", "Hoa", "Khanh", "Linh", "Minh", "Nam",
+		"Alice", "Bob", "Carol", "David", "Emma", "Frank", "Grace", "Henry", "Ivy", "Jack"}
+	seedLastNames = []string{"Nguyen", "Tran", "Le", "Pham", "Hoang", "Vu", "Dang", "Bui",
+		"Smith", "Johnson", "Brown", "Miller", "Wilson", "Taylor", "Clark", "Lewis"}
+	seedWords = []string{"alpha", "bravo", "cloud", "delta", "engine", "forest", "galaxy", "harbor",
+		"island", "jungle", "kernel", "lemon", "marble", "nebula", "orbit", "pixel", "quartz", "river",
+		"signal", "timber", "umbra", "vector", "willow", "xenon", "yellow", "zephyr"}
+)
+
+// seedGen sinh giá trị cho các placeholder; seq tăng theo mỗi document
+type seedGen struct {
+	rnd *rand.Rand
+	seq int
+}
+
+// document sinh một document từ template; thiếu _id thì dùng {{id}}
+func (g *seedGen) document(tmpl interface{}) (map[string]interface{}, error) {
+	g.seq++
+	v, err := g.render(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	doc, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("template must be a JSON object")
+	}
+	switch id := doc["_id"].(type) {
+	case nil:
+		doc["_id"] = g.id()
+	case string:
+		if id == "" {
+			return nil, fmt.Errorf("_id must not be empty")
+		}
+	default:
+		doc["_id"] = fmt.Sprint(id) // _id luôn là chuỗi
+	}
+	return doc, nil
+}
+
+func (g *seedGen) render(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		// Duyệt key theo thứ tự cố định để cùng --seed cho cùng dữ liệu
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(t))
+		for _, k := range keys {
+			item := t[k]
+			r, err := g.render(item)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			r, err := g.render(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	case string:
+		// Cả chuỗi là một placeholder: giữ kiểu của giá trị sinh ra
+		if m := placeholderRe.FindStringSubmatchIndex(t); m != nil && m[0] == 0 && m[1] == len(t) {
+			return g.eval(t[m[2]:m[3]])
+		}
+		var firstErr error
+		out := placeholderRe.ReplaceAllStringFunc(t, func(p string) string {
+			val, err := g.eval(placeholderRe.FindStringSubmatch(p)[1])
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			return fmt.Sprint(val)
+		})
+		return out, firstErr
+	}
+	return v, nil
+}
+
+func (g *seedGen) eval(expr string) (interface{}, error) {
+	f := strings.Fields(expr)
+	if len(f) == 0 {
+		return nil, fmt.Errorf("empty placeholder")
+	}
+	args := f[1:]
+	switch f[0] {
+	case "id":
+		return g.id(), nil
+	case "seq":
+		return g.seq, nil
+	case "name":
+		return seedFirstNames[g.rnd.Intn(len(seedFirstNames))] + " " + seedLastNames[g.rnd.Intn(len(seedLastNames))], nil
+	case "email":
+		return fmt.Sprintf("%s.%s%d@example.com", strings.ToLower(seedFirstNames[g.rnd.Intn(len(seedFirstNames))]),
+			strings.ToLower(seedLastNames[g.rnd.Intn(len(seedLastNames))]), g.rnd.Intn(1000)), nil
+	case "word":
+		return seedWords[g.rnd.Intn(len(seedWords))], nil
+	case "bool":
+		return g.rnd.Intn(2) == 1, nil
+	case "date":
+		// Thời điểm ngẫu nhiên trong 365 ngày qua
+		back := time.Duration(g.rnd.Int63n(int64(365 * 24 * time.Hour)))
+		return time.Now().UTC().Add(-back).Truncate(time.Second).Format(time.RFC3339), nil
+	case "pick":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("{{pick}} needs at least one choice")
+		}
+		return args[g.rnd.Intn(len(args))], nil
+	case "int":
+		lo, hi, err := seedRange(f[0], args)
+		if err != nil {
+			return nil, err
+		}
+		return int64(lo) + g.rnd.Int63n(int64(hi)-int64(lo)+1), nil
+	case "float":
+		lo, hi, err := seedRange(f[0], args)
+		if err != nil {
+			return nil, err
+		}
+		// Làm tròn 2 chữ số cho dễ đọc (giá tiền, điểm số...)
+		return float64(int64((lo+g.rnd.Float64()*(hi-lo))*100)) / 100, nil
+	}
+	return nil, fmt.Errorf("unknown placeholder {{%s}}", expr)
+}
+
+func (g *seedGen) id() string {
+	return fmt.Sprintf("%016x", g.rnd.Uint64())
+}
+
+// seedRange đọc hai tham số MIN MAX của {{int}}/{{float}}
+func seedRange(name string, args []string) (float64, float64, error) {
+	if len(args) != 2 {
+		return 0, 0, fmt.Errorf("{{%s}} expects MIN MAX", name)
+	}
+	lo, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("{{%s}}: %w", name, err)
+	}
+	hi, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("{{%s}}: %w", name, err)
+	}
+	if hi < lo {
+		return 0, 0, fmt.Errorf("{{%s}}: MAX must be >= MIN", name)
+	}
+	return lo, hi, nil
+}
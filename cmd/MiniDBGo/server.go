@@ -20,7 +20,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+	"github.com/nconghau/MiniDBGo/internal/query"
 	"github.com/rs/cors"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
@@ -29,53 +32,198 @@ import (
 
 const (
 	// Server limits
-	MaxRequestBodySize = 10 * 1024 * 1024 // 10MB
-	MaxConcurrentReq   = 100
-	RequestTimeout     = 30 * time.Second
-	ShutdownTimeout    = 30 * time.Second
-	ReadTimeout        = 15 * time.Second
-	WriteTimeout       = 15 * time.Second
-	IdleTimeout        = 60 * time.Second
+	DefaultMaxBodyBytes       = 10 * 1024 * 1024  // 10MB
+	DefaultMaxImportBodyBytes = 100 * 1024 * 1024 // 100MB, cho _insertMany/_upsertMany
+	MaxConcurrentReq          = 100
+	RequestTimeout            = 30 * time.Second
+	ShutdownTimeout           = 30 * time.Second
+	ReadTimeout               = 15 * time.Second
+	WriteTimeout              = 15 * time.Second
+	IdleTimeout               = 60 * time.Second
 
 	// Rate limiting
 	// MaxKeysToReturn = 10000
+
+	// Result limits
+	DefaultMaxResults = 1000 // Số document tối đa trả về cho một truy vấn
+	PublicMaxResults  = 100  // Mặc định cho chế độ public
 )
 
+// ServerOptions cấu hình HTTP server
+type ServerOptions struct {
+	// Public: chế độ chỉ đọc cho dữ liệu công khai. Chỉ mở các route đọc
+	// (GET document, GET ?tag=, _search, _count, _distinct, _textSearch, _collections, health), không có
+	// route ghi hay quản trị.
+	Public     bool
+	MaxResults int // Giới hạn số kết quả của _search/_aggregate/?tag=
+
+	// MirrorURL: nếu khác rỗng, MirrorPercent% request ghi được gửi
+	// (fire-and-forget) sang MiniDBGo tại địa chỉ này
+	MirrorURL     string
+	MirrorPercent float64
+
+	// Chaos: nếu khác nil, bật chaos mode (chỉ để kiểm thử, xem chaos.go).
+	// Bị bỏ qua ở chế độ public.
+	Chaos *ChaosConfig
+
+	// CORSOrigins: các origin được phép (rỗng = localhost:3000, public: "*")
+	CORSOrigins []string
+	// SecurityHeaders: gửi X-Content-Type-Options, X-Frame-Options, Referrer-Policy
+	SecurityHeaders bool
+	// HSTSMaxAge (giây): > 0 thì gửi Strict-Transport-Security
+	// (chỉ bật khi server đứng sau HTTPS)
+	HSTSMaxAge int
+
+	// Giới hạn kích thước body (0 = mặc định): MaxImportBodyBytes cho các
+	// route nạp dữ liệu hàng loạt, MaxBodyBytes cho mọi route còn lại
+	MaxBodyBytes       int64
+	MaxImportBodyBytes int64
+
+	// ExportDir là thư mục chứa tệp của _exportQuery (mặc định "exports")
+	ExportDir string
+	// ImportDir là thư mục chứa tệp nguồn của _importJob (mặc định "imports")
+	ImportDir string
+
+	// MaxConnLifetime (0 = không giới hạn): kết nối keep-alive mở lâu hơn
+	// bị đóng sau response kế tiếp (hoặc ngay khi rảnh) để client kết nối
+	// lại, giúp tải được chia lại đều giữa các instance sau load balancer
+	MaxConnLifetime time.Duration
+	// DrainPeriod: khi dừng, server tiếp tục phục vụ thêm khoảng này với
+	// health check trả 503 và đóng dần các kết nối trước khi ngừng nhận kết nối
+	DrainPeriod time.Duration
+
+	// TCPAddr: nếu khác rỗng, mở thêm cổng TCP cho giao thức nhị phân (xem wire.go)
+	TCPAddr string
+
+	// PayloadLog: chế độ ghi body của request ghi vào log (off, sampled,
+	// truncated; xem payloadlog.go). Payload luôn được che các field nhạy
+	// cảm: SensitiveFields cho mọi collection cộng các field đánh dấu qua _sensitive.
+	PayloadLog         string
+	PayloadLogPercent  float64 // Tỷ lệ lấy mẫu của chế độ sampled (0..100)
+	PayloadLogMaxBytes int     // Payload dài hơn bị cắt (0 = mặc định)
+	SensitiveFields    []string
+}
+
 type Server struct {
 	db         engine.Engine
+	opts       ServerOptions
+	mirror     *trafficMirror           // nil nếu không bật mirroring
+	chaos      *chaosInjector           // nil nếu không bật chaos mode
+	jobs       *jobs.Scheduler          // Tác vụ nền của server (mirror...); engine có bộ lập lịch riêng
+	exports    *taskRegistry[exportJob] // Trạng thái các _exportQuery
+	imports    *taskRegistry[importJob] // Trạng thái các _importJob
+	bgCtx      context.Context          // Bị hủy khi server dừng (dừng các export/import đang chạy)
+	bgCancel   context.CancelFunc
 	httpServer *http.Server
+	wire       *wireServer // nil nếu không bật giao thức TCP
+	conns      *connTracker
 	semaphore  chan struct{}
 	shutdown   chan os.Signal
 	wg         sync.WaitGroup
 }
 
 // startHttpServer starts the web server with graceful shutdown
-func startHttpServer(db engine.Engine, addr string) *Server {
+func startHttpServer(db engine.Engine, addr string, opts ServerOptions) *Server {
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = DefaultMaxResults
+		if opts.Public {
+			opts.MaxResults = PublicMaxResults
+		}
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.MaxImportBodyBytes <= 0 {
+		opts.MaxImportBodyBytes = DefaultMaxImportBodyBytes
+	}
+	if !validPayloadLogMode(opts.PayloadLog) {
+		opts.PayloadLog = payloadLogOff
+	}
+	if opts.PayloadLogMaxBytes <= 0 {
+		opts.PayloadLogMaxBytes = DefaultPayloadLogMaxBytes
+	}
 	s := &Server{
 		db:        db,
+		opts:      opts,
 		semaphore: make(chan struct{}, MaxConcurrentReq),
 		shutdown:  make(chan os.Signal, 1),
+		jobs:      jobs.New(),
+		conns:     newConnTracker(opts.MaxConnLifetime),
+	}
+
+	if opts.MirrorURL != "" && opts.MirrorPercent > 0 && !opts.Public {
+		s.mirror = newTrafficMirror(s.jobs, opts.MirrorURL, opts.MirrorPercent)
+	}
+	if opts.Chaos != nil && !opts.Public {
+		s.chaos = newChaosInjector(*opts.Chaos)
+		s.db = &chaosEngine{Engine: db, chaos: s.chaos}
+	}
+
+	if !opts.Public {
+		s.bgCtx, s.bgCancel = context.WithCancel(context.Background())
+		s.startExports()
+		s.startImports()
 	}
 
 	mux := http.NewServeMux()
 
 	// API Endpoints with middleware
 	mux.HandleFunc("/api/health", s.withMiddleware(s.handleHealthCheck))
-	mux.HandleFunc("/api/stats", s.withMiddleware(s.handleGetStats))
-	mux.HandleFunc("/api/metrics", s.withMiddleware(s.handleGetMetrics))
-	mux.HandleFunc("/api/_collections", s.withMiddleware(s.handleGetCollections))
-	mux.HandleFunc("/api/_compact", s.withMiddleware(s.handleCompact))
-	mux.HandleFunc("/api/", s.withMiddleware(s.handleApiRoutes))
+	mux.HandleFunc("/api/_mget", s.withMiddleware(s.handleMultiGet))
+	if opts.Public {
+		mux.HandleFunc("/api/", s.withMiddleware(s.handlePublicRoutes))
+	} else {
+		// Quét toàn bộ keyspace không giới hạn nên không mở ở public mode
+		mux.HandleFunc("/api/_collections", s.withMiddleware(s.handleGetCollections))
+		mux.HandleFunc("/api/stats", s.withMiddleware(s.handleGetStats))
+		mux.HandleFunc("/api/metrics", s.withMiddleware(s.handleGetMetrics))
+		mux.HandleFunc("/api/_compact", s.withMiddleware(s.handleCompact))
+		mux.HandleFunc("/api/_runtime", s.withMiddleware(s.handleRuntimeConfig))
+		mux.HandleFunc("/api/_config", s.withMiddleware(s.handleEngineConfig))
+		mux.HandleFunc("/api/_jobs", s.withMiddleware(s.handleJobs))
+		mux.HandleFunc("/api/_keyRangeStats", s.withMiddleware(s.handleKeyRangeStats))
+		mux.HandleFunc("/api/_verify", s.withMiddleware(s.handleVerify))
+		mux.HandleFunc("/api/_exports", s.withMiddleware(s.handleExports))
+		mux.HandleFunc("/api/_exports/", s.withMiddleware(s.handleExports))
+		mux.HandleFunc("/api/_imports", s.withMiddleware(s.handleImports))
+		mux.HandleFunc("/api/_imports/", s.withMiddleware(s.handleImports))
+		mux.HandleFunc("/api/_leases", s.withMiddleware(s.handleLeases))
+		mux.HandleFunc("/api/_leases/", s.withMiddleware(s.handleLeases))
+		mux.HandleFunc("/api/_txn", s.withMiddleware(s.handleTxn))
+		if s.chaos != nil {
+			mux.HandleFunc("/api/_chaos", s.withMiddleware(s.handleChaos))
+		}
+		mux.HandleFunc("/api/", s.withMiddleware(s.handleApiRoutes))
+	}
 
 	// CORS
-	c := cors.New(cors.Options{
+	corsOpts := cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Deadline-Ms", "X-Priority", "X-Durability"},
 		AllowCredentials: true,
-	})
+	}
+	if opts.Public {
+		// Dữ liệu công khai: cho phép mọi origin, không gửi kèm credentials
+		corsOpts = cors.Options{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "HEAD", "POST", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "X-Deadline-Ms", "X-Priority", "X-Durability"},
+		}
+	}
+	if len(opts.CORSOrigins) > 0 {
+		corsOpts.AllowedOrigins = opts.CORSOrigins
+	}
+	c := cors.New(corsOpts)
 
 	handler := c.Handler(mux)
+	if opts.SecurityHeaders || opts.HSTSMaxAge > 0 {
+		handler = securityHeaders(handler, opts.SecurityHeaders, opts.HSTSMaxAge)
+	}
+	if s.chaos != nil {
+		handler = s.chaos.middleware(handler)
+	}
+	handler = s.conns.middleware(handler)
 
 	s.httpServer = &http.Server{
 		Addr:           addr,
@@ -84,9 +232,22 @@ func startHttpServer(db engine.Engine, addr string) *Server {
 		WriteTimeout:   WriteTimeout,
 		IdleTimeout:    IdleTimeout,
 		MaxHeaderBytes: 1 << 20, // 1MB
+		ConnState:      s.conns.connState,
+		ConnContext:    s.conns.connContext,
+	}
+	s.startConnRecycle()
+
+	if opts.Public {
+		log.Printf("[HTTP] API server starting on %s (public read-only, max %d results)\n", addr, opts.MaxResults)
+	} else {
+		log.Printf("[HTTP] API server starting on %s\n", addr)
 	}
 
-	log.Printf("[HTTP] API server starting on %s\n", addr)
+	if opts.TCPAddr != "" {
+		if err := s.startWire(opts.TCPAddr, handler); err != nil {
+			log.Printf("[TCP] ERROR: Wire protocol failed: %v\n", err)
+		}
+	}
 
 	// Start server in goroutine
 	s.wg.Add(1)
@@ -100,6 +261,7 @@ func startHttpServer(db engine.Engine, addr string) *Server {
 	// Setup graceful shutdown
 	signal.Notify(s.shutdown, os.Interrupt, syscall.SIGTERM)
 	go s.handleShutdown()
+	go s.handleRecycle()
 
 	return s
 }
@@ -108,6 +270,12 @@ func (s *Server) handleShutdown() {
 	<-s.shutdown
 	log.Println("[HTTP] Shutting down gracefully...")
 
+	// Rút kết nối trước khi ngừng nhận kết nối mới (rolling restart sau load balancer)
+	if s.opts.DrainPeriod > 0 {
+		log.Printf("[HTTP] Draining connections for %s\n", s.opts.DrainPeriod)
+		s.conns.drain(s.opts.DrainPeriod)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
 
@@ -115,6 +283,15 @@ func (s *Server) handleShutdown() {
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		log.Printf("[HTTP] Shutdown error: %v\n", err)
 	}
+	if s.wire != nil {
+		s.wire.close(ctx)
+	}
+
+	// Chờ các tác vụ nền của server (mirror...) đã xếp hàng; export/import đang chạy bị hủy
+	if s.bgCancel != nil {
+		s.bgCancel()
+	}
+	s.jobs.Close()
 
 	// Close database
 	if err := s.db.Close(); err != nil {
@@ -126,13 +303,50 @@ func (s *Server) handleShutdown() {
 	os.Exit(0)
 }
 
+// handleRecycle: SIGHUP yêu cầu mọi kết nối hiện có đóng lại (vd sau khi
+// đổi cấu hình load balancer), không dừng server
+func (s *Server) handleRecycle() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Println("[HTTP] SIGHUP: recycling connections")
+		s.conns.recycleAll()
+	}
+}
+
+// requestSchedule đọc header X-Deadline-Ms (mili giây, không vượt quá RequestTimeout)
+// và X-Priority của request
+func requestSchedule(r *http.Request) (time.Duration, engine.Priority, error) {
+	timeout := RequestTimeout
+	if raw := r.Header.Get("X-Deadline-Ms"); raw != "" {
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms <= 0 {
+			return 0, 0, fmt.Errorf("X-Deadline-Ms must be a positive integer")
+		}
+		if d := time.Duration(ms) * time.Millisecond; d < timeout {
+			timeout = d
+		}
+	}
+	priority, err := engine.ParsePriority(r.Header.Get("X-Priority"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("X-Priority: %w", err)
+	}
+	return timeout, priority, nil
+}
+
 // Middleware chain
 func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Request timeout
-		ctx, cancel := context.WithTimeout(r.Context(), RequestTimeout)
+		// Request timeout (client có thể rút ngắn bằng X-Deadline-Ms)
+		// và độ ưu tiên (X-Priority: low|normal|high) cho bộ điều phối đọc của engine
+		timeout, priority, err := requestSchedule(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
 		defer cancel()
-		r = r.WithContext(ctx)
+		r = r.WithContext(engine.WithPriority(ctx, priority))
 
 		// Concurrency limiting
 		select {
@@ -143,22 +357,27 @@ func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Body size limiting
-		r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
+		// Body size limiting (route nạp hàng loạt có giới hạn riêng)
+		limit := s.opts.MaxBodyBytes
+		if isImportRoute(r.URL.Path) {
+			limit = s.opts.MaxImportBodyBytes
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
 
 		start := time.Now()
 
-		var bodyBytes []byte
-		if r.Method == "POST" || r.Method == "PUT" {
+		var mirrorBody []byte
+		if r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
 			if r.Body != nil {
 				// Read all the bytes from the request body
 				bodyBytes, err := io.ReadAll(r.Body)
 				if err != nil {
-					// This error triggers if body > MaxRequestBodySize
-					writeError(w, http.StatusRequestEntityTooLarge, "Request payload is too large")
+					// This error triggers if body > limit
+					writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request payload is too large (limit %d bytes)", limit))
 					return
 				}
 				r.Body.Close() // Close the original body
+				mirrorBody = bodyBytes
 
 				// Restore the body so the handler can read it
 				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
@@ -168,6 +387,10 @@ func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 		// Run the actual API handler
 		handler(w, r)
 
+		if s.mirror != nil && r.Header.Get("X-MiniDBGo-Mirror") == "" {
+			s.mirror.maybeMirror(r, mirrorBody)
+		}
+
 		// Use slog.LogAttrs for dynamic attributes
 		attrs := []slog.Attr{
 			slog.String("component", "http"),
@@ -176,9 +399,9 @@ func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 			slog.Int64("duration_ms", time.Since(start).Milliseconds()),
 		}
 
-		// Only add payload if it's a POST/PUT and we read bytes
-		if (r.Method == "POST" || r.Method == "PUT") && len(bodyBytes) > 0 {
-			attrs = append(attrs, slog.String("payload", string(bodyBytes)))
+		// Payload (đã che field nhạy cảm) theo chế độ PayloadLog
+		if attr, ok := s.payloadAttr(r, mirrorBody); ok {
+			attrs = append(attrs, attr)
 		}
 
 		// Log everything together
@@ -186,6 +409,27 @@ func (s *Server) withMiddleware(handler http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// isImportRoute: các route nạp dữ liệu hàng loạt (/api/<col>/_insertMany, _upsertMany)
+func isImportRoute(path string) bool {
+	return strings.HasSuffix(path, "/_insertMany") || strings.HasSuffix(path, "/_upsertMany")
+}
+
+// securityHeaders thêm các header bảo mật vào mọi response
+func securityHeaders(next http.Handler, basic bool, hstsMaxAge int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		if basic {
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("X-Frame-Options", "DENY")
+			h.Set("Referrer-Policy", "no-referrer")
+		}
+		if hstsMaxAge > 0 {
+			h.Set("Strict-Transport-Security", fmt.Sprintf("max-age=%d; includeSubDomains", hstsMaxAge))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (s *Server) handleApiRoutes(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/api")
 	parts := strings.Split(strings.Trim(path, "/"), "/")
@@ -199,12 +443,87 @@ func (s *Server) handleApiRoutes(w http.ResponseWriter, r *http.Request) {
 	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_insertMany":
 		s.handleInsertMany(w, r, parts[0])
 
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_upsertMany":
+		s.handleUpsertMany(w, r, parts[0])
+
 	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_search":
 		s.handleFindMany(w, r, parts[0])
 
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_count":
+		s.handleCount(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_distinct":
+		s.handleDistinct(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_textSearch":
+		s.handleTextSearch(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_updateMany":
+		s.handleUpdateMany(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_deleteMany":
+		s.handleDeleteMany(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_drop":
+		s.handleDrop(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_findOneAndUpdate":
+		s.handleFindOneAndUpdate(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_findOneAndDelete":
+		s.handleFindOneAndDelete(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_exportQuery":
+		s.handleExportQuery(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_importJob":
+		s.handleImportJob(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_aggregate":
+		s.handleAggregate(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_createIndex":
+		s.handleCreateIndex(w, r, parts[0])
+
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_createTextIndex":
+		s.handleCreateTextIndex(w, r, parts[0])
+
+	case r.Method == "GET" && len(parts) == 2 && parts[1] == "_indexes":
+		s.handleListIndexes(w, r, parts[0])
+
+	case (r.Method == "GET" || r.Method == "PUT") && len(parts) == 2 && parts[1] == "_coercions":
+		s.handleCoercions(w, r, parts[0])
+
+	case (r.Method == "GET" || r.Method == "PUT") && len(parts) == 2 && parts[1] == "_sensitive":
+		s.handleSensitive(w, r, parts[0])
+
+	case (len(parts) == 2 || len(parts) == 3) && parts[1] == "_views":
+		s.handleViews(w, r, parts[0], strings.Join(parts[2:], ""))
+
+	case (r.Method == "GET" || r.Method == "PUT" || r.Method == "DELETE") && len(parts) == 2 && parts[1] == "_references":
+		s.handleReferences(w, r, parts[0])
+
+	case r.Method == "GET" && len(parts) == 2 && parts[1] == "_fieldStats":
+		s.handleFieldStats(w, r, parts[0])
+
+	case r.Method == "GET" && len(parts) == 2 && parts[1] == "_groupCount":
+		s.handleGroupCount(w, r, parts[0])
+
+	case r.Method == "GET" && len(parts) == 1:
+		s.handleFindByTag(w, r, parts[0])
+
+	case r.Method == "DELETE" && len(parts) == 1:
+		s.handleDeleteByFilter(w, r, parts[0])
+
 	case r.Method == "POST" && len(parts) == 1:
 		s.handleInsertOne(w, r, parts[0])
 
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "_lock":
+		s.handleLockDocument(w, r, []byte(parts[0]+":"+parts[1]))
+
+	case r.Method == "POST" && len(parts) == 3 && parts[2] == "_unlock":
+		s.handleUnlockDocument(w, r, []byte(parts[0]+":"+parts[1]))
+
 	case len(parts) == 2:
 		collection := parts[0]
 		id := parts[1]
@@ -213,8 +532,12 @@ func (s *Server) handleApiRoutes(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "PUT":
 			s.handleUpdateDocument(w, r, key)
+		case "PATCH":
+			s.handlePatchDocument(w, r, key)
 		case "GET":
 			s.handleGetDocument(w, r, key)
+		case "HEAD":
+			s.handleHeadDocument(w, r, key)
 		case "DELETE":
 			s.handleDeleteDocument(w, r, key)
 		default:
@@ -227,6 +550,33 @@ func (s *Server) handleApiRoutes(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// handlePublicRoutes chỉ mở các route đọc của handleApiRoutes
+func (s *Server) handlePublicRoutes(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	switch {
+	case len(parts) == 0 || parts[0] == "" || strings.HasPrefix(parts[0], "_"):
+		writeError(w, http.StatusNotFound, "Invalid API path")
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_search":
+		s.handleFindMany(w, r, parts[0])
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_count":
+		s.handleCount(w, r, parts[0])
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_distinct":
+		s.handleDistinct(w, r, parts[0])
+	case r.Method == "POST" && len(parts) == 2 && parts[1] == "_textSearch":
+		s.handleTextSearch(w, r, parts[0])
+	case r.Method == "GET" && len(parts) == 1:
+		s.handleFindByTag(w, r, parts[0])
+	case r.Method == "GET" && len(parts) == 2 && !strings.HasPrefix(parts[1], "_"):
+		s.handleGetDocument(w, r, []byte(parts[0]+":"+parts[1]))
+	case r.Method == "HEAD" && len(parts) == 2 && !strings.HasPrefix(parts[1], "_"):
+		s.handleHeadDocument(w, r, []byte(parts[0]+":"+parts[1]))
+	default:
+		writeError(w, http.StatusForbidden, "This server is read-only")
+	}
+}
+
 type CollectionInfo struct {
 	Name     string `json:"name"`
 	DocCount int    `json:"docCount"`
@@ -253,6 +603,9 @@ func (s *Server) handleGetCollections(w http.ResponseWriter, r *http.Request) {
 		// }
 
 		key := it.Key()
+		if engine.IsSystemKey(key) {
+			continue
+		}
 		if idx := strings.Index(key, ":"); idx >= 0 { //
 			colName := key[:idx]
 			colCounts[colName]++
@@ -309,6 +662,13 @@ func (s *Server) handleInsertOne(w http.ResponseWriter, r *http.Request, collect
 			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
 			return
 		}
+		if writeConstraintError(w, err) {
+			return
+		}
+		if errors.Is(err, engine.ErrInvalidDocument) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		msg := fmt.Sprintf("Error inserting document %s: %v", id, err)
 		writeError(w, http.StatusInternalServerError, msg)
 		return
@@ -334,8 +694,15 @@ func (s *Server) handleInsertMany(w http.ResponseWriter, r *http.Request, collec
 		writeError(w, http.StatusBadRequest, "Too many documents (max 1000 per batch)")
 		return
 	}
+	// X-Durability: always|everysec|os ghi đè chế độ fsync WAL cho riêng batch này
+	durability, err := engine.ParseDurability(r.Header.Get("X-Durability"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "X-Durability: "+err.Error())
+		return
+	}
 
 	batch := s.db.NewBatch() // Hoạt động vì db là interface
+	batch.SetDurability(durability)
 
 	insertedCount := 0
 	for i, doc := range docs {
@@ -361,6 +728,13 @@ func (s *Server) handleInsertMany(w http.ResponseWriter, r *http.Request, collec
 			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
 			return
 		}
+		if writeConstraintError(w, err) {
+			return
+		}
+		if errors.Is(err, engine.ErrInvalidDocument) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		msg := fmt.Sprintf("Error inserting batch: %v", err)
 		writeError(w, http.StatusInternalServerError, msg)
 		return
@@ -369,6 +743,48 @@ func (s *Server) handleInsertMany(w http.ResponseWriter, r *http.Request, collec
 	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "insertedCount": insertedCount})
 }
 
+// handleUpsertMany: POST /api/<col>/_upsertMany?on=sku
+// Body là mảng document; khớp theo field `on` (mặc định _id)
+func (s *Server) handleUpsertMany(w http.ResponseWriter, r *http.Request, collection string) {
+	on := r.URL.Query().Get("on")
+	if on == "" {
+		on = "_id"
+	}
+
+	var docs []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&docs); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body is not a valid JSON array")
+		return
+	}
+	defer r.Body.Close()
+	if len(docs) > 1000 {
+		writeError(w, http.StatusBadRequest, "Too many documents (max 1000 per batch)")
+		return
+	}
+	if len(docs) == 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "matchedCount": 0, "upsertedCount": 0})
+		return
+	}
+
+	res, err := upsertMany(s.db, collection, on, docs)
+	if err != nil {
+		if strings.Contains(err.Error(), "too many pending flushes") {
+			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
+			return
+		}
+		if writeConstraintError(w, err) {
+			return
+		}
+		if errors.Is(err, engine.ErrInvalidDocument) || errors.Is(err, errBadUpsertInput) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "matchedCount": res.Matched, "upsertedCount": res.Upserted})
+}
+
 func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request, key []byte) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
@@ -388,111 +804,1122 @@ func (s *Server) handleUpdateDocument(w http.ResponseWriter, r *http.Request, ke
 			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
 			return
 		}
+		if writeConstraintError(w, err) {
+			return
+		}
+		if errors.Is(err, engine.ErrInvalidDocument) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok", "key": string(key)})
 }
 
+// handlePatchDocument áp dụng update operators lên một document
+// PATCH /api/<col>/<id>  body: {"$inc": {"stock": -1}, "$push": {"tags": "sale"}}
+// ?upsert=true: tạo document {_id} rồi áp dụng update nếu chưa tồn tại (201)
+func (s *Server) handlePatchDocument(w http.ResponseWriter, r *http.Request, key []byte) {
+	var update map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body is not a valid JSON update document")
+		return
+	}
+	defer r.Body.Close()
+
+	var seed map[string]interface{}
+	if upsert, _ := strconv.ParseBool(r.URL.Query().Get("upsert")); upsert {
+		_, id, _ := strings.Cut(string(key), ":")
+		seed = map[string]interface{}{"_id": id}
+	}
+
+	doc, created, err := updateByKey(s.db, key, update, seed)
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		writeError(w, http.StatusNotFound, "Key not found")
+		return
+	}
+	if err != nil {
+		writeManyError(w, err)
+		return
+	}
+	if created {
+		writeJSON(w, http.StatusCreated, doc)
+		return
+	}
+	writeJSON(w, http.StatusOK, doc)
+}
+
 func (s *Server) handleGetDocument(w http.ResponseWriter, r *http.Request, key []byte) {
-	val, err := s.db.Get(key)
+	if r.URL.Query().Get("trace") == "true" {
+		s.handleGetTrace(w, r, key)
+		return
+	}
+	if r.URL.Query().Get("fields") == "_meta" {
+		s.handleGetMeta(w, r, key)
+		return
+	}
+	collection, _, _ := strings.Cut(string(key), ":")
+	view, err := viewParam(s.db, r, collection)
 	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	item, err := s.db.GetItem(r.Context(), key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+		return
+	}
+	if errors.Is(err, engine.ErrKeyNotFound) {
 		writeError(w, http.StatusNotFound, "Key not found")
 		return
 	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	val := item.Value
+	if item.UpdatedAt != 0 {
+		updatedAt := time.Unix(0, item.UpdatedAt).UTC()
+		w.Header().Set("Last-Modified", updatedAt.Format(http.TimeFormat))
+		if notModifiedSince(r, updatedAt) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		val = withUpdatedAt(val, updatedAt)
+	}
+	if view != nil {
+		val = applyViewRaw(view, val)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	w.Write(val)
 }
 
-func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request, key []byte) {
-	if err := s.db.Delete(key); err != nil {
-		if strings.Contains(err.Error(), "too many pending flushes") {
-			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
-			return
-		}
-		writeError(w, http.StatusInternalServerError, err.Error())
-		return
+// notModifiedSince: request có If-Modified-Since không sớm hơn updatedAt
+// (Last-Modified chỉ chính xác tới giây nên so sánh ở mức giây)
+func notModifiedSince(r *http.Request, updatedAt time.Time) bool {
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "key": string(key)})
+	return !updatedAt.Truncate(time.Second).After(ims)
 }
 
-// handleFindMany
-// --- SỬA ĐỔI: Viết lại hoàn toàn bằng Iterator ---
-func (s *Server) handleFindMany(w http.ResponseWriter, r *http.Request, collection string) {
-	var filter map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil { // [cite: 19]
-		writeError(w, http.StatusBadRequest, "Invalid JSON filter")
-		return
+// withUpdatedAt thêm "_updatedAt" (RFC 3339, UTC) vào document JSON object;
+// document đã có trường này hoặc không phải object được giữ nguyên
+func withUpdatedAt(doc []byte, updatedAt time.Time) []byte {
+	body := bytes.TrimRight(doc, " \t\r\n")
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' || bytes.Contains(body, []byte(`"_updatedAt"`)) {
+		return doc
 	}
-	defer r.Body.Close()
+	field := `"_updatedAt":"` + updatedAt.Format(time.RFC3339Nano) + `"`
+	out := make([]byte, 0, len(body)+len(field)+1)
+	out = append(out, body[:len(body)-1]...)
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		out = append(out, ',')
+	}
+	out = append(out, field...)
+	return append(out, '}')
+}
 
-	results := make([]map[string]interface{}, 0, 100)
+// docMeta là metadata của document trả về cho GET ...?fields=_meta
+type docMeta struct {
+	Size int `json:"size"` // Số byte của document (JSON)
+	// Version là hash nội dung (xxhash, hex): đổi khi và chỉ khi document đổi,
+	// đủ cho công cụ đồng bộ phát hiện thay đổi mà không tải document
+	Version string `json:"version"`
+	// UpdatedAt: thời điểm commit của lần ghi cuối (bỏ trống với dữ liệu ghi
+	// trước khi có theo dõi thời điểm)
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+	// ExpiresAt: thời điểm document hết hạn (_ttl/_expiresAt), bỏ trống nếu không hết hạn
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
 
-	it, err := s.db.NewIterator()
+// handleGetMeta (GET /api/<col>/<id>?fields=_meta) trả về docMeta thay cho document
+func (s *Server) handleGetMeta(w http.ResponseWriter, r *http.Request, key []byte) {
+	item, err := s.db.GetItem(r.Context(), key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+		return
+	}
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		writeError(w, http.StatusNotFound, "Key not found")
+		return
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create iterator")
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	defer it.Close()
+	meta := docMeta{Size: len(item.Value), Version: fmt.Sprintf("%016x", xxhash.Sum64(item.Value))}
+	if item.UpdatedAt != 0 {
+		updatedAt := time.Unix(0, item.UpdatedAt).UTC()
+		meta.UpdatedAt = &updatedAt
+	}
+	if item.ExpiresAt != 0 {
+		expiresAt := time.Unix(0, item.ExpiresAt).UTC()
+		meta.ExpiresAt = &expiresAt
+	}
+	writeJSON(w, http.StatusOK, meta)
+}
 
-	prefix := collection + ":"
-	matchCount := 0
+// handleHeadDocument (HEAD /api/<col>/<id>): 200 nếu document tồn tại,
+// 404 nếu không; không đọc document (xem engine.Exists)
+func (s *Server) handleHeadDocument(w http.ResponseWriter, r *http.Request, key []byte) {
+	ok, err := s.db.Exists(key)
+	switch {
+	case err != nil:
+		w.WriteHeader(http.StatusInternalServerError)
+	case !ok:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
 
-	for it.Next() {
-		key := it.Key()
+// handleGetTrace trả về document kèm đường đi của lần đọc (GET ...?trace=true).
+// Key không tồn tại vẫn trả về trace (status 404) để chẩn đoán.
+func (s *Server) handleGetTrace(w http.ResponseWriter, r *http.Request, key []byte) {
+	if s.opts.Public {
+		writeError(w, http.StatusForbidden, "trace is not available in public mode")
+		return
+	}
+	val, trace, err := s.db.GetTrace(r.Context(), key)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+		return
+	}
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"error": "Key not found", "status": http.StatusNotFound, "trace": trace,
+		})
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var doc interface{} = json.RawMessage(val)
+	if !json.Valid(val) {
+		doc = string(val)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"doc": doc, "trace": trace})
+}
 
-		if !strings.HasPrefix(key, prefix) {
-			continue
-		}
+// mgetRef là một phần tử của body _mget
+type mgetRef struct {
+	Collection string `json:"collection"`
+	ID         string `json:"id"`
+}
 
-		// Giới hạn kết quả trả về
-		if matchCount >= 1000 {
-			break
-		}
+type mgetResult struct {
+	Collection string          `json:"collection"`
+	ID         string          `json:"id"`
+	Found      bool            `json:"found"`
+	Doc        json.RawMessage `json:"doc,omitempty"`
+}
 
-		// Lấy giá trị trực tiếp từ iterator
-		val := it.Value().Value
+// handleMultiGet đọc nhiều document (có thể thuộc nhiều collection) trong
+// một lần gọi engine. Kết quả giữ đúng thứ tự của request.
+func (s *Server) handleMultiGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	var refs []mgetRef
+	if err := json.NewDecoder(r.Body).Decode(&refs); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body must be a JSON array of {collection, id}")
+		return
+	}
+	defer r.Body.Close()
+	if len(refs) > s.opts.MaxResults {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Too many documents (max %d per request)", s.opts.MaxResults))
+		return
+	}
 
-		var doc map[string]interface{}
-		if err := json.Unmarshal(val, &doc); err != nil { // [cite: 20]
-			continue // Bỏ qua JSON hỏng
+	keys := make([][]byte, len(refs))
+	for i, ref := range refs {
+		if ref.Collection == "" || ref.ID == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Item at index %d needs collection and id", i))
+			return
 		}
-
-		if matchFilter(doc, filter) {
-			results = append(results, doc)
-			matchCount++
+		if s.opts.Public && strings.HasPrefix(ref.Collection, "_") {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Item at index %d: invalid collection", i))
+			return
 		}
+		keys[i] = []byte(ref.Collection + ":" + ref.ID)
 	}
 
-	if err := it.Error(); err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed during iteration")
+	vals, err := s.db.MultiGet(r.Context(), keys)
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	writeJSON(w, http.StatusOK, results)
+	docs := make([]mgetResult, len(refs))
+	found := 0
+	for i, ref := range refs {
+		docs[i] = mgetResult{Collection: ref.Collection, ID: ref.ID}
+		if vals[i] == nil {
+			continue
+		}
+		docs[i].Found, docs[i].Doc = true, vals[i]
+		if !json.Valid(vals[i]) {
+			docs[i].Doc, _ = json.Marshal(string(vals[i])) // Giá trị không phải JSON (ghi từ CLI)
+		}
+		found++
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"docs": docs, "found": found})
 }
 
-func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
-	// Run compaction in background to avoid blocking
-	go func() {
-		if err := s.db.Compact(); err != nil {
-			slog.Info("Compaction started", "trigger", "api")
-			if err := s.db.Compact(); err != nil {
-				slog.Error("Compaction error", "error", err)
-			}
-		}
-	}()
+func (s *Server) handleDeleteDocument(w http.ResponseWriter, r *http.Request, key []byte) {
+	if err := s.db.Delete(key); err != nil {
+		if writeConstraintError(w, err) {
+			return
+		}
+		if strings.Contains(err.Error(), "too many pending flushes") {
+			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted", "key": string(key)})
+}
+
+// handleDeleteByFilter xóa mọi document của collection khớp filter
+// DELETE /api/<col>?filter={...}  (filter={} để xóa toàn bộ collection)
+func (s *Server) handleDeleteByFilter(w http.ResponseWriter, r *http.Request, collection string) {
+	raw := r.URL.Query().Get("filter")
+	if raw == "" {
+		writeError(w, http.StatusBadRequest, "Missing required 'filter' query parameter (use filter={} to delete all)")
+		return
+	}
+	var filter map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON filter")
+		return
+	}
+	if err := query.ValidateFilter(filter); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deleted, err := s.db.DeletePrefix(collection+":", func(key string, value []byte) bool {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(value, &doc); err != nil {
+			return false
+		}
+		return query.MatchFilter(doc, filter)
+	})
+	if err != nil {
+		var ref *engine.ReferenceError
+		if errors.As(err, &ref) {
+			// Xóa theo từng lô: các lô trước lỗi đã được ghi
+			writeJSON(w, http.StatusConflict, map[string]interface{}{"error": err.Error(), "status": http.StatusConflict,
+				"reference": ref, "deletedCount": deleted})
+			return
+		}
+		if strings.Contains(err.Error(), "too many pending flushes") {
+			writeError(w, http.StatusServiceUnavailable, fmt.Sprintf("Database is busy after deleting %d documents, please retry", deleted))
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "deleted", "deletedCount": deleted})
+}
 
+// handleDrop xóa cả collection bằng range tombstone (không đếm số document)
+// POST /api/<col>/_drop
+func (s *Server) handleDrop(w http.ResponseWriter, r *http.Request, collection string) {
+	if err := s.db.DropCollection(collection); err != nil {
+		switch {
+		case errors.Is(err, engine.ErrReferenceViolation):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, engine.ErrInvalidDocument):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "dropped", "collection": collection})
+}
+
+// manyRequest là body của _updateMany / _deleteMany
+type manyRequest struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update map[string]interface{} `json:"update"`
+}
+
+// handleUpdateMany: POST /api/<col>/_updateMany {"filter": {...}, "update": {"$set": {...}}}
+func (s *Server) handleUpdateMany(w http.ResponseWriter, r *http.Request, collection string) {
+	var req manyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Filter == nil || req.Update == nil {
+		writeError(w, http.StatusBadRequest, "Body must be {\"filter\": {...}, \"update\": {...}}")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := updateMany(r.Context(), s.db, collection, req.Filter, req.Update, coll)
+	if err != nil {
+		writeManyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "modifiedCount": n})
+}
+
+// handleDeleteMany: POST /api/<col>/_deleteMany {"filter": {...}}
+func (s *Server) handleDeleteMany(w http.ResponseWriter, r *http.Request, collection string) {
+	var req manyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Filter == nil {
+		writeError(w, http.StatusBadRequest, "Body must be {\"filter\": {...}}")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := deleteMany(r.Context(), s.db, collection, req.Filter, coll)
+	if err != nil {
+		writeManyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "deleted", "deletedCount": n})
+}
+
+// handleFindOneAndUpdate: POST /api/<col>/_findOneAndUpdate {"filter": {...}, "update": {...}}
+// Cập nhật nguyên tử document đầu tiên khớp filter, trả về bản trước và sau
+func (s *Server) handleFindOneAndUpdate(w http.ResponseWriter, r *http.Request, collection string) {
+	var req manyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Filter == nil || req.Update == nil {
+		writeError(w, http.StatusBadRequest, "Body must be {\"filter\": {...}, \"update\": {...}}")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	before, after, err := findOneAndUpdate(r.Context(), s.db, collection, req.Filter, req.Update, coll)
+	if err != nil {
+		writeManyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"matched": before != nil, "before": before, "after": after})
+}
+
+// handleFindOneAndDelete: POST /api/<col>/_findOneAndDelete {"filter": {...}}
+func (s *Server) handleFindOneAndDelete(w http.ResponseWriter, r *http.Request, collection string) {
+	var req manyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Filter == nil {
+		writeError(w, http.StatusBadRequest, "Body must be {\"filter\": {...}}")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	doc, err := findOneAndDelete(r.Context(), s.db, collection, req.Filter, coll)
+	if err != nil {
+		writeManyError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"matched": doc != nil, "before": doc})
+}
+
+func writeManyError(w http.ResponseWriter, err error) {
+	if writeConstraintError(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+	case errors.Is(err, errConcurrentModification):
+		writeError(w, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "too many pending flushes"):
+		writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
+	case errors.Is(err, errTooManyMatches):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	case errors.Is(err, query.ErrInvalidUpdate), errors.Is(err, query.ErrInvalidFilter),
+		errors.Is(err, engine.ErrInvalidDocument):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// writeReadError ánh xạ lỗi của các truy vấn đọc (_search, _count...) sang mã HTTP
+func writeReadError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		writeError(w, http.StatusGatewayTimeout, "Request deadline exceeded")
+	case errors.Is(err, query.ErrInvalidFilter):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, errTooManyGroups):
+		writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "Failed during iteration")
+	}
+}
+
+// handleFindMany
+// --- SỬA ĐỔI: Viết lại hoàn toàn bằng Iterator ---
+func (s *Server) handleFindMany(w http.ResponseWriter, r *http.Request, collection string) {
+	var filter map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil { // [cite: 19]
+		writeError(w, http.StatusBadRequest, "Invalid JSON filter")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	keys, err := sortParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	view, err := viewParam(s.db, r, collection)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, 100)
+
+	scan, err := planScan(s.db, collection, filter, coll, keys)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	// Có sort mà index không cho sẵn thứ tự: phải gom hết rồi mới sắp xếp
+	buffered := len(keys) > 0 && !scan.sorted
+	err = scan.each(r.Context(), func(key string, raw []byte, doc map[string]interface{}) bool {
+		// Giới hạn kết quả trả về
+		if !buffered && len(results) >= s.opts.MaxResults {
+			return false
+		}
+		results = append(results, doc)
+		return true
+	})
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	if buffered {
+		query.SortDocs(results, keys, coll)
+		if len(results) > s.opts.MaxResults {
+			results = results[:s.opts.MaxResults]
+		}
+	}
+
+	writeJSON(w, http.StatusOK, applyView(view, results))
+}
+
+// handleFindByTag trả về các document có đủ mọi nhãn được yêu cầu
+// GET /api/<col>?tag=vip&tag=new
+func (s *Server) handleFindByTag(w http.ResponseWriter, r *http.Request, collection string) {
+	tags := r.URL.Query()["tag"]
+	if len(tags) == 0 {
+		writeError(w, http.StatusBadRequest, "Missing required 'tag' query parameter")
+		return
+	}
+	view, err := viewParam(s.db, r, collection)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results := make([]map[string]interface{}, 0, 100)
+	err = forEachTagged(s.db, collection, tags, func(key string, doc map[string]interface{}) bool {
+		if len(results) >= s.opts.MaxResults {
+			return false
+		}
+		results = append(results, doc)
+		return true
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, applyView(view, results))
+}
+
+// handleAggregate chạy aggregation pipeline trên collection
+// POST /api/<col>/_aggregate  body: [{"$match": {...}}, {"$group": {...}}, {"$sort": {...}}]
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request, collection string) {
+	var stages []map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&stages); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body is not a valid JSON array of stages")
+		return
+	}
+	defer r.Body.Close()
+
+	pipeline, err := query.ParsePipeline(stages)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// $match đầu tiên được đẩy xuống bước đọc để tận dụng index
+	filter, rest := pipeline.LeadingMatch()
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+	// $sort ngay sau đó được bỏ qua nếu index đã trả về đúng thứ tự
+	keys, afterSort := rest.LeadingSort()
+	scan, err := planScan(s.db, collection, filter, coll, keys)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	if scan.sorted {
+		rest = afterSort
+	}
+	// Các stage còn lại làm việc trên document đã ép kiểu
+	coerce := query.Coercions(s.db.Coercions(collection))
+	rest.WithCoercions(coerce)
+	rest.WithCollation(coll)
+	rest.WithLookup(lookupDocs(r.Context(), s.db))
+	err = scan.each(r.Context(), func(key string, raw []byte, doc map[string]interface{}) bool {
+		rest.Push(coerce.Doc(doc))
+		return rest.Err() == nil
+	})
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+
+	results := rest.Result()
+	if err := rest.Err(); err != nil {
+		writeReadError(w, err)
+		return
+	}
+	if len(results) > s.opts.MaxResults {
+		results = results[:s.opts.MaxResults]
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// handleCreateIndex tạo secondary index:
+// body {"field": "category"} hoặc {"field": "name", "collation": {"locale": "vi", "strength": 2}}
+// Compound index: {"fields": ["category", "price"]}; unique index: {"field": "email", "unique": true}
+func (s *Server) handleCreateIndex(w http.ResponseWriter, r *http.Request, collection string) {
+	var req struct {
+		Field     string          `json:"field"`
+		Fields    []string        `json:"fields"`
+		Collation json.RawMessage `json:"collation"`
+		Unique    bool            `json:"unique"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Field == "") == (len(req.Fields) == 0) {
+		writeError(w, http.StatusBadRequest, "Request body must be {\"field\": \"<name>\"} or {\"fields\": [\"<name>\", ...]}")
+		return
+	}
+	defer r.Body.Close()
+	if len(req.Fields) > 0 {
+		req.Field = strings.Join(req.Fields, ",")
+	}
+
+	opts := engine.IndexOptions{Unique: req.Unique}
+	if len(req.Collation) > 0 {
+		var err error
+		if opts.Collation, err = query.ParseCollation(req.Collation); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := s.db.CreateIndex(collection, req.Field, opts); err != nil {
+		if errors.Is(err, engine.ErrIndexConflict) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if writeConstraintError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "collection": collection, "field": req.Field, "unique": req.Unique})
+}
+
+func (s *Server) handleListIndexes(w http.ResponseWriter, r *http.Request, collection string) {
+	fields := s.db.ListIndexes(collection)
+	collations := make(map[string]*query.Collation)
+	unique := make([]string, 0)
+	multikey := make([]string, 0)
+	for _, f := range fields {
+		opts, _ := s.db.IndexInfo(collection, f)
+		if opts.Collation != nil {
+			collations[f] = opts.Collation
+		}
+		if opts.Unique {
+			unique = append(unique, f)
+		}
+		if opts.Multikey {
+			multikey = append(multikey, f)
+		}
+	}
+	text, _ := s.db.TextIndex(collection)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "indexes": fields,
+		"collations": collations, "unique": unique, "multikey": multikey, "text": text})
+}
+
+// handleCreateTextIndex tạo text index (toàn văn), mỗi collection tối đa một:
+// body {"fields": ["name", "description"]}
+func (s *Server) handleCreateTextIndex(w http.ResponseWriter, r *http.Request, collection string) {
+	var req struct {
+		Fields []string `json:"fields"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Fields) == 0 {
+		writeError(w, http.StatusBadRequest, "Request body must be {\"fields\": [\"<name>\", ...]}")
+		return
+	}
+	defer r.Body.Close()
+
+	if err := s.db.CreateTextIndex(collection, req.Fields); err != nil {
+		if errors.Is(err, engine.ErrIndexConflict) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "ok", "collection": collection, "fields": req.Fields})
+}
+
+// handleTextSearch tìm kiếm toàn văn trên text index, kết quả sắp theo _score:
+// POST /api/<col>/_textSearch  body: {"query": "áo khoác", "filter": {...}, "limit": 20}
+func (s *Server) handleTextSearch(w http.ResponseWriter, r *http.Request, collection string) {
+	var req struct {
+		Query  string                 `json:"query"`
+		Filter map[string]interface{} `json:"filter"`
+		Limit  int                    `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Query == "" {
+		writeError(w, http.StatusBadRequest, "Body must be {\"query\": \"<words>\", \"filter\": {...}, \"limit\": n}")
+		return
+	}
+	defer r.Body.Close()
+
+	limit := s.opts.MaxResults
+	if req.Limit > 0 && req.Limit < limit {
+		limit = req.Limit
+	}
+	results, err := textSearch(r.Context(), s.db, collection, req.Query, req.Filter, limit)
+	if err != nil {
+		if errors.Is(err, errNoTextIndex) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// collationParam đọc collation của truy vấn từ query string:
+// ?collation={"locale":"vi","strength":2}
+func collationParam(r *http.Request) (*query.Collation, error) {
+	raw := r.URL.Query().Get("collation")
+	if raw == "" {
+		return nil, nil
+	}
+	return query.ParseCollation([]byte(raw))
+}
+
+// sortParam đọc thứ tự sắp xếp của _search từ query string:
+// ?sort=price (tăng dần), ?sort=-price (giảm dần), ?sort=category,-price
+func sortParam(r *http.Request) ([]query.SortKey, error) {
+	raw := r.URL.Query().Get("sort")
+	if raw == "" {
+		return nil, nil
+	}
+	var keys []query.SortKey
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		desc := strings.HasPrefix(part, "-")
+		field := strings.TrimPrefix(strings.TrimPrefix(part, "-"), "+")
+		if field == "" {
+			return nil, fmt.Errorf("invalid sort %q", raw)
+		}
+		keys = append(keys, query.SortKey{Field: field, Desc: desc})
+	}
+	return keys, nil
+}
+
+// handleCoercions đọc (GET) hoặc cập nhật (PUT) quy tắc ép kiểu khi đọc
+// PUT /api/<col>/_coercions  body: {"price": "number", "createdAt": "date", "old": ""}
+// (kiểu rỗng để xóa quy tắc)
+func (s *Server) handleCoercions(w http.ResponseWriter, r *http.Request, collection string) {
+	if r.Method == "PUT" {
+		var rules map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be an object of field -> type")
+			return
+		}
+		defer r.Body.Close()
+		for field, typ := range rules {
+			if err := s.db.SetCoercion(collection, field, typ); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "coercions": s.db.Coercions(collection)})
+}
+
+// handleReferences: GET liệt kê tham chiếu của collection (khai báo trên nó
+// hoặc trỏ tới nó), PUT {"field","target","checkInsert","onDelete"} khai báo,
+// DELETE ?field=<name> xóa
+func (s *Server) handleReferences(w http.ResponseWriter, r *http.Request, collection string) {
+	switch r.Method {
+	case "PUT":
+		var ref engine.Reference
+		if err := json.NewDecoder(r.Body).Decode(&ref); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be {\"field\", \"target\", \"checkInsert\", \"onDelete\"}")
+			return
+		}
+		defer r.Body.Close()
+		ref.Collection = collection
+		if err := s.db.SetReference(ref); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	case "DELETE":
+		if err := s.db.DropReference(collection, r.URL.Query().Get("field")); err != nil {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "references": s.db.References(collection)})
+}
+
+// handleFieldStats thống kê một field: GET /api/<col>/_fieldStats?field=price
+func (s *Server) handleFieldStats(w http.ResponseWriter, r *http.Request, collection string) {
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		writeError(w, http.StatusBadRequest, "Missing required 'field' query parameter")
+		return
+	}
+	stats, err := computeFieldStats(s.db, collection, field)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleCount: POST /api/<col>/_count  body: filter (rỗng hoặc {} = tất cả)
+func (s *Server) handleCount(w http.ResponseWriter, r *http.Request, collection string) {
+	filter := map[string]interface{}{}
+	if err := json.NewDecoder(r.Body).Decode(&filter); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "Invalid JSON filter")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	n, err := countMatches(r.Context(), s.db, collection, filter, coll)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "count": n})
+}
+
+// handleDistinct: POST /api/<col>/_distinct  body: {"field": "category", "filter": {...}}
+func (s *Server) handleDistinct(w http.ResponseWriter, r *http.Request, collection string) {
+	var req struct {
+		Field  string                 `json:"field"`
+		Filter map[string]interface{} `json:"filter"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Field == "" {
+		writeError(w, http.StatusBadRequest, "Body must be {\"field\": \"<name>\", \"filter\": {...}}")
+		return
+	}
+	defer r.Body.Close()
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	values, err := distinctValues(r.Context(), s.db, collection, req.Field, req.Filter, coll)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"field": req.Field, "values": values})
+}
+
+// handleGroupCount đếm document theo giá trị của field (facet):
+// GET /api/<col>/_groupCount?field=category[&filter={"price":{"$gt":10}}]
+func (s *Server) handleGroupCount(w http.ResponseWriter, r *http.Request, collection string) {
+	field := r.URL.Query().Get("field")
+	if field == "" {
+		writeError(w, http.StatusBadRequest, "Missing required 'field' query parameter")
+		return
+	}
+	filter := map[string]interface{}{}
+	if raw := r.URL.Query().Get("filter"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &filter); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid JSON filter")
+			return
+		}
+	}
+
+	coll, err := collationParam(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	groups, err := groupCount(r.Context(), s.db, collection, field, filter, coll)
+	if err != nil {
+		writeReadError(w, err)
+		return
+	}
+	total := len(groups)
+	if total > s.opts.MaxResults {
+		groups = groups[:s.opts.MaxResults]
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"field": field, "groups": groups, "distinct": total})
+}
+
+// handleRuntimeConfig đọc (GET) hoặc chỉnh (PUT) tham số GC/bộ nhớ khi đang chạy
+// PUT /api/_runtime  body: {"gc_percent": 50, "gomaxprocs": 4, "mem_limit_mb": 512}
+func (s *Server) handleRuntimeConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, tuner.current())
+	case "PUT":
+		var patch RuntimeConfigPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be a JSON object")
+			return
+		}
+		defer r.Body.Close()
+		cfg, err := tuner.update(patch)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, cfg)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+	}
+}
+
+// handleChaos đọc (GET) hoặc chỉnh (PUT) cấu hình chaos mode khi đang chạy
+// PUT /api/_chaos  body: {"engine_latency_ms": 50, "http_error_percent": 10}
+func (s *Server) handleChaos(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"config":   s.chaos.current(),
+			"injected": s.chaos.metrics(),
+		})
+	case "PUT":
+		var patch ChaosConfigPatch
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be a JSON object")
+			return
+		}
+		defer r.Body.Close()
+		cfg, err := s.chaos.update(patch)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, cfg)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+	}
+}
+
+// handleEngineConfig đọc (GET) hoặc chỉnh (PUT) ngưỡng flush của MemTable khi đang chạy.
+// Ngưỡng mới có hiệu lực từ lần rotate MemTable kế tiếp (xem "pending").
+// PUT /api/_config  body: {"flush_size": 20000, "max_mem_mb": 32}
+func (s *Server) handleEngineConfig(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "PUT":
+		var patch struct {
+			FlushSize *int64 `json:"flush_size"`
+			MaxMemMB  *int64 `json:"max_mem_mb"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			writeError(w, http.StatusBadRequest, "Body must be a JSON object")
+			return
+		}
+		defer r.Body.Close()
+
+		// Field không gửi lên giữ giá trị đang chờ (nếu có) hoặc đang hiệu lực
+		active, pending := s.db.FlushThresholds()
+		next := active
+		if pending != nil {
+			next = *pending
+		}
+		if patch.FlushSize != nil {
+			next.FlushSize = *patch.FlushSize
+		}
+		if patch.MaxMemMB != nil {
+			next.MaxMemBytes = *patch.MaxMemMB * 1024 * 1024
+		}
+		if err := s.db.SetFlushThresholds(next); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	writeJSON(w, http.StatusOK, engineConfigView(s.db))
+}
+
+func engineConfigView(db engine.Engine) map[string]interface{} {
+	view := func(t engine.FlushThresholds) map[string]interface{} {
+		return map[string]interface{}{"flush_size": t.FlushSize, "max_mem_mb": t.MaxMemBytes / 1024 / 1024}
+	}
+	active, pending := db.FlushThresholds()
+	out := view(active)
+	out["pending"] = nil
+	if pending != nil {
+		out["pending"] = view(*pending)
+	}
+	return out
+}
+
+func (s *Server) handleCompact(w http.ResponseWriter, r *http.Request) {
+	// ?dryRun=true: chỉ trả về compaction sẽ chạy (tệp, ước lượng), không nén
+	if dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dryRun")); dryRun {
+		plan, err := s.db.PlanCompaction()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, plan)
+		return
+	}
+
+	// Compact chỉ xếp một job compaction (xem GET /api/_jobs), không chặn
+	slog.Info("Compaction requested", "trigger", "api")
+	if err := s.db.Compact(); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "compaction started"})
 }
 
+// handleJobs liệt kê các tác vụ nền: thống kê theo lane (đang chờ, đang chạy,
+// thời gian chạy, lỗi gần nhất) và các job gần đây của engine và server
+// GET /api/_jobs
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"engine": s.db.Jobs(),
+		"server": s.jobs.Status(),
+	})
+}
+
+// GET /api/_keyRangeStats?prefix=orders:
+// Ước lượng số key và dung lượng của tiền tố từ metadata SSTable (không quét)
+func (s *Server) handleKeyRangeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	stats, err := s.db.KeyRangeStats(r.URL.Query().Get("prefix"))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleVerify đọc lại toàn bộ các SSTable và báo tệp hỏng (tốn I/O như một lần quét toàn bộ)
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	checks, err := s.db.VerifyTables(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	corrupt := 0
+	for _, c := range checks {
+		if c.Error != "" {
+			corrupt++
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"files":   len(checks),
+		"corrupt": corrupt,
+		"tables":  checks,
+	})
+}
+
 func (s *Server) handleHealthCheck(w http.ResponseWriter, r *http.Request) {
+	if s.conns.draining.Load() {
+		// Báo load balancer ngừng gửi request mới tới instance này
+		writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "draining"})
+		return
+	}
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
 }
 
 func (s *Server) handleGetMetrics(w http.ResponseWriter, r *http.Request) {
 	metrics := s.db.GetMetrics()
+	if s.mirror != nil {
+		for k, v := range s.mirror.metrics() {
+			metrics[k] = v
+		}
+	}
+	if s.chaos != nil {
+		for k, v := range s.chaos.metrics() {
+			metrics[k] = v
+		}
+	}
+	for k, v := range s.conns.metrics() {
+		metrics[k] = v
+	}
 	writeJSON(w, http.StatusOK, metrics)
 }
 
@@ -556,6 +1983,8 @@ func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
 		"go_heap_inuse_mb":     m.HeapInuse / 1024 / 1024,
 		"go_num_gc":            m.NumGC,
 		"system_cpu_percent":   0.0,
+		"runtime_config":       tuner.stats(),
+		"engine_config":        engineConfigView(s.db),
 	}
 
 	if len(totalCpuPercent) > 0 {
@@ -582,3 +2011,21 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	}
 	writeJSON(w, status, payload)
 }
+
+// writeConstraintError trả về 409 kèm chi tiết nếu err là lỗi vi phạm
+// unique index ("duplicate") hoặc tham chiếu ("reference")
+func writeConstraintError(w http.ResponseWriter, err error) bool {
+	body := map[string]interface{}{"error": err.Error(), "status": http.StatusConflict}
+	var dup *engine.DuplicateKeyError
+	var ref *engine.ReferenceError
+	switch {
+	case errors.As(err, &dup):
+		body["duplicate"] = dup
+	case errors.As(err, &ref):
+		body["reference"] = ref
+	default:
+		return false
+	}
+	writeJSON(w, http.StatusConflict, body)
+	return true
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+)
+
+// maxTaskHistory là số tác vụ đã kết thúc được giữ lại để xem
+const maxTaskHistory = 100
+
+// task là trạng thái của một tác vụ nền do client tạo (_exportQuery, _importJob)
+type task interface {
+	taskID() string
+	taskState() string // jobs.State*
+}
+
+// taskRegistry giữ trạng thái các tác vụ nền (đang chạy và gần đây)
+type taskRegistry[T task] struct {
+	mu    sync.Mutex
+	tasks map[string]*T
+	order []string // Theo thứ tự tạo
+}
+
+func newTaskRegistry[T task]() *taskRegistry[T] {
+	return &taskRegistry[T]{tasks: make(map[string]*T)}
+}
+
+func (r *taskRegistry[T]) add(t *T) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := (*t).taskID()
+	r.tasks[id] = t
+	r.order = append(r.order, id)
+	// Bỏ các tác vụ cũ nhất đã kết thúc khi vượt giới hạn
+	for len(r.order) > maxTaskHistory {
+		old := r.tasks[r.order[0]]
+		if st := (*old).taskState(); st == jobs.StateQueued || st == jobs.StateRunning {
+			break
+		}
+		delete(r.tasks, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+func (r *taskRegistry[T]) remove(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tasks, id)
+	for i, o := range r.order {
+		if o == id {
+			r.order = append(r.order[:i], r.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// update sửa trạng thái của tác vụ dưới khóa
+func (r *taskRegistry[T]) update(t *T, fn func(t *T)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fn(t)
+}
+
+func (r *taskRegistry[T]) get(id string) (T, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tasks[id]
+	if !ok {
+		var zero T
+		return zero, false
+	}
+	return *t, true
+}
+
+// list trả về các tác vụ, mới nhất trước
+func (r *taskRegistry[T]) list() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]T, 0, len(r.order))
+	for i := len(r.order) - 1; i >= 0; i-- {
+		out = append(out, *r.tasks[r.order[i]])
+	}
+	return out
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// errNoTextIndex: _textSearch cần text index (tạo bằng _createTextIndex)
+var errNoTextIndex = errors.New("collection has no text index")
+
+// textSearch tìm các document chứa ít nhất một từ của search trong các field
+// của text index, sắp theo điểm giảm dần. filter (có thể rỗng) lọc thêm kết quả.
+// Mỗi document trả về có thêm field "_score".
+func textSearch(ctx context.Context, db engine.Engine, col, search string, filter map[string]interface{}, limit int) (
+	[]map[string]interface{}, error) {
+
+	fields, ok := db.TextIndex(col)
+	if !ok {
+		return nil, errNoTextIndex
+	}
+	terms, err := query.TextSearch(search)
+	if err != nil {
+		return nil, err
+	}
+	if err := query.ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	hits, err := db.TextSearch(col, terms)
+	if err != nil {
+		return nil, err
+	}
+
+	coerce := query.Coercions(db.Coercions(col))
+	_, matches := docMatcher(coerce, filter, nil)
+
+	results := make([]map[string]interface{}, 0)
+	for _, hit := range hits {
+		if len(results) >= limit {
+			break
+		}
+		raw, err := db.GetContext(ctx, []byte(col+":"+hit.ID))
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			continue // Posting cũ (document đã bị xóa)
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			continue
+		}
+		if !containsAnyTerm(query.TextTerms(doc, fields), terms) || !matches(doc) {
+			continue
+		}
+		doc["_score"] = hit.Score
+		results = append(results, doc)
+	}
+	return results, nil
+}
+
+func containsAnyTerm(docTerms map[string]int, terms []string) bool {
+	for _, t := range terms {
+		if docTerms[t] > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// textIndexLookup trả lời điều kiện $text của filter bằng text index (nếu có)
+func textIndexLookup(db engine.Engine, col string, filter map[string]interface{}) ([]string, bool) {
+	cond, ok := filter["$text"]
+	if !ok {
+		return nil, false
+	}
+	if _, has := db.TextIndex(col); !has {
+		return nil, false
+	}
+	terms, err := query.TextSearch(cond)
+	if err != nil {
+		return nil, false
+	}
+	hits, err := db.TextSearch(col, terms)
+	if err != nil {
+		return nil, false
+	}
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	return ids, true
+}
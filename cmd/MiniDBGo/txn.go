@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// txnOp là một thao tác của /api/_txn
+type txnOp struct {
+	Op         string          `json:"op"` // "get", "put" hoặc "delete"
+	Collection string          `json:"collection"`
+	ID         string          `json:"id"`
+	Doc        json.RawMessage `json:"doc,omitempty"` // Chỉ với "put"
+}
+
+type txnResult struct {
+	Op         string          `json:"op"`
+	Collection string          `json:"collection"`
+	ID         string          `json:"id"`
+	Found      *bool           `json:"found,omitempty"` // Chỉ với "get"
+	Doc        json.RawMessage `json:"doc,omitempty"`
+}
+
+// handleTxn chạy các thao tác theo thứ tự trong một transaction (engine.Txn):
+// get thấy các put/delete đứng trước trong cùng request, mọi lần ghi được
+// commit cùng nhau. 409 nếu một document đã đọc/ghi bị request khác thay
+// đổi trong lúc đó (không có gì được ghi, client gửi lại).
+// POST /api/_txn  body: [{"op":"get","collection":"accounts","id":"a"},
+// {"op":"put","collection":"accounts","id":"a","doc":{...}}, {"op":"delete",...}]
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+		return
+	}
+	var ops []txnOp
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		writeError(w, http.StatusBadRequest, "Request body must be a JSON array of {op, collection, id, doc}")
+		return
+	}
+	defer r.Body.Close()
+	if len(ops) > s.opts.MaxResults {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Too many operations (max %d per transaction)", s.opts.MaxResults))
+		return
+	}
+	for i, op := range ops {
+		if op.Collection == "" || op.ID == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Operation at index %d needs collection and id", i))
+			return
+		}
+		switch op.Op {
+		case "get", "delete":
+		case "put":
+			var doc map[string]interface{}
+			if json.Unmarshal(op.Doc, &doc) != nil || doc == nil {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("Operation at index %d: doc must be a JSON object", i))
+				return
+			}
+		default:
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("Operation at index %d: op must be get, put or delete", i))
+			return
+		}
+	}
+
+	txn, err := s.db.Begin()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer txn.Rollback()
+
+	results := make([]txnResult, len(ops))
+	for i, op := range ops {
+		key := []byte(op.Collection + ":" + op.ID)
+		results[i] = txnResult{Op: op.Op, Collection: op.Collection, ID: op.ID}
+		switch op.Op {
+		case "get":
+			val, err := txn.Get(key)
+			if err != nil && !errors.Is(err, engine.ErrKeyNotFound) {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			found := err == nil
+			results[i].Found = &found
+			if found {
+				results[i].Doc = val
+				if !json.Valid(val) {
+					results[i].Doc, _ = json.Marshal(string(val)) // Giá trị không phải JSON (ghi từ CLI)
+				}
+			}
+		case "put":
+			txn.Put(key, op.Doc)
+		case "delete":
+			txn.Delete(key)
+		}
+	}
+
+	if err := txn.Commit(); err != nil {
+		switch {
+		case errors.Is(err, engine.ErrTxnConflict):
+			writeError(w, http.StatusConflict, "Transaction conflict: a document was modified concurrently, please retry")
+		case strings.Contains(err.Error(), "too many pending flushes"):
+			writeError(w, http.StatusServiceUnavailable, "Database is busy, please retry")
+		case writeConstraintError(w, err):
+		case errors.Is(err, engine.ErrInvalidDocument):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": "committed", "seq": txn.Seq(), "results": results})
+}
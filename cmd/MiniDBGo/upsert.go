@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// errBadUpsertInput: document đầu vào không hợp lệ (lỗi phía client)
+var errBadUpsertInput = errors.New("invalid upsert input")
+
+// UpsertResult tóm tắt kết quả của upsertMany
+type UpsertResult struct {
+	Matched  int `json:"matchedCount"`
+	Upserted int `json:"upsertedCount"`
+}
+
+// upsertMany ghép các document theo giá trị của field `on` (không nhất thiết là _id):
+// document khớp sẽ bị thay thế (giữ nguyên _id cũ), phần còn lại được thêm mới.
+// Tất cả được ghi trong một batch.
+func upsertMany(db engine.Engine, col, on string, docs []map[string]interface{}) (*UpsertResult, error) {
+	// Giá trị khóa (dạng JSON) -> vị trí document trong docs
+	wanted := make(map[string][]int, len(docs))
+	for i, doc := range docs {
+		v, ok := query.GetPath(doc, on)
+		if !ok {
+			return nil, fmt.Errorf("%w: document at index %d is missing field %q", errBadUpsertInput, i, on)
+		}
+		k, ok := upsertKey(v)
+		if !ok {
+			return nil, fmt.Errorf("%w: document at index %d: field %q must be a string, number or bool", errBadUpsertInput, i, on)
+		}
+		wanted[k] = append(wanted[k], i)
+	}
+
+	existing, err := findIDsByValue(db, col, on, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &UpsertResult{}
+	batch := db.NewBatch()
+	for k, idxs := range wanted {
+		id, matched := existing[k]
+		if !matched {
+			// Document mới: dùng _id có sẵn hoặc sinh mới
+			if s, ok := docs[idxs[0]]["_id"].(string); ok && s != "" {
+				id = s
+			} else {
+				id = newDocID()
+			}
+		}
+		// Nhiều document trùng khóa trong cùng batch: document sau cùng thắng
+		doc := docs[idxs[len(idxs)-1]]
+		doc["_id"] = id
+		raw, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put([]byte(col+":"+id), raw)
+		if matched {
+			res.Matched++
+		} else {
+			res.Upserted++
+		}
+	}
+
+	if err := db.ApplyBatch(batch); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// findIDsByValue tìm _id của document hiện có theo giá trị field.
+// Dùng Get cho _id, index nếu field đã được index, nếu không quét collection một lần.
+func findIDsByValue(db engine.Engine, col, field string, wanted map[string][]int) (map[string]string, error) {
+	found := make(map[string]string, len(wanted))
+
+	if field == "_id" {
+		for k := range wanted {
+			id, ok := wantedValue(k).(string)
+			if !ok {
+				continue
+			}
+			if _, err := db.Get([]byte(col + ":" + id)); err == nil {
+				found[k] = id
+			}
+		}
+		return found, nil
+	}
+
+	if hasIndex(db, col, field) {
+		for k := range wanted {
+			b := &engine.IndexBound{Value: wantedValue(k), Inclusive: true}
+			ids, err := db.IndexLookup(col, field, engine.IndexRange{Lower: b, Upper: b})
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) > 0 {
+				found[k] = ids[0]
+			}
+		}
+		return found, nil
+	}
+
+	it, err := db.NewPrefixIterator(col + ":")
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	for it.Next() {
+		var doc map[string]interface{}
+		if err := json.Unmarshal(it.Value().Value, &doc); err != nil {
+			continue
+		}
+		v, _ := query.GetPath(doc, field)
+		k, ok := upsertKey(v)
+		if !ok {
+			continue
+		}
+		if _, want := wanted[k]; !want {
+			continue
+		}
+		if _, dup := found[k]; !dup {
+			found[k] = strings.TrimPrefix(it.Key(), col+":")
+		}
+	}
+	return found, it.Error()
+}
+
+// upsertKey chuẩn hóa giá trị khóa thành chuỗi JSON để so sánh
+func upsertKey(v interface{}) (string, bool) {
+	switch v.(type) {
+	case string, float64, bool:
+		b, err := json.Marshal(v)
+		return string(b), err == nil
+	}
+	return "", false
+}
+
+func wantedValue(k string) interface{} {
+	var v interface{}
+	json.Unmarshal([]byte(k), &v)
+	return v
+}
+
+// newDocID sinh _id ngẫu nhiên (16 ký tự hex)
+func newDocID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// viewsMetaName: view của mọi collection được lưu dưới key ứng dụng
+// engine.AppKeyPrefix+"views" (xem appmeta.go)
+const viewsMetaName = "views"
+
+// viewDef là một view đặt tên của collection (xem query.View)
+type viewDef struct {
+	Collection string     `json:"collection"`
+	Name       string     `json:"name"`
+	View       query.View `json:"view"`
+}
+
+// collectionViews trả về các view (tên -> định nghĩa) của collection
+func collectionViews(db engine.Engine, collection string) (map[string]query.View, error) {
+	var defs []viewDef
+	if err := loadAppMeta(db, viewsMetaName, &defs); err != nil {
+		return nil, err
+	}
+	out := make(map[string]query.View)
+	for _, def := range defs {
+		if def.Collection == collection {
+			out[def.Name] = def.View
+		}
+	}
+	return out, nil
+}
+
+// setView đặt (hoặc xóa, nếu v nil) view name của collection
+func setView(db engine.Engine, collection, name string, v *query.View) error {
+	if collection == "" || name == "" || strings.ContainsAny(name, "/?#") {
+		return fmt.Errorf("%w: collection and a view name without '/', '?' or '#' are required", query.ErrInvalidView)
+	}
+	if v != nil {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	var defs []viewDef
+	return updateAppMeta(db, viewsMetaName, &defs, func() error {
+		kept := defs[:0]
+		for _, def := range defs {
+			if def.Collection != collection || def.Name != name {
+				kept = append(kept, def)
+			}
+		}
+		if v != nil {
+			kept = append(kept, viewDef{Collection: collection, Name: name, View: *v})
+		}
+		defs = kept
+		return nil
+	})
+}
+
+// handleViews quản lý các view trình bày response của collection:
+//
+//	GET    /api/<col>/_views         các view của collection
+//	GET    /api/<col>/_views/<name>  một view
+//	PUT    /api/<col>/_views/<name>  body: {"fields": [...], "rename": {...}, "flatten": true}
+//	DELETE /api/<col>/_views/<name>
+//
+// Client chọn view bằng ?view=<name> khi đọc document, _search hoặc tìm theo tag.
+func (s *Server) handleViews(w http.ResponseWriter, r *http.Request, collection, name string) {
+	if name == "" {
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+			return
+		}
+		views, err := collectionViews(s.db, collection)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"collection": collection, "views": views})
+		return
+	}
+
+	views, err := collectionViews(s.db, collection)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	switch r.Method {
+	case "GET":
+		v, ok := views[name]
+		if !ok {
+			writeError(w, http.StatusNotFound, "View not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	case "PUT":
+		var v query.View
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			writeError(w, http.StatusBadRequest, "Request body must be a view: {\"fields\": [...], \"rename\": {...}, \"flatten\": true}")
+			return
+		}
+		if err := setView(s.db, collection, name, &v); err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, query.ErrInvalidView) {
+				status = http.StatusBadRequest
+			}
+			writeError(w, status, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	case "DELETE":
+		if _, ok := views[name]; !ok {
+			writeError(w, http.StatusNotFound, "View not found")
+			return
+		}
+		if err := setView(s.db, collection, name, nil); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "deleted", "view": name})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not supported")
+	}
+}
+
+// viewParam đọc ?view=<tên> và trả về view của collection (nil nếu không chọn view)
+func viewParam(db engine.Engine, r *http.Request, collection string) (*query.View, error) {
+	name := r.URL.Query().Get("view")
+	if name == "" {
+		return nil, nil
+	}
+	views, err := collectionViews(db, collection)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := views[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown view %q for collection %s", name, collection)
+	}
+	return &v, nil
+}
+
+// applyViewRaw áp view lên một document JSON; giá trị không phải object giữ nguyên
+func applyViewRaw(v *query.View, raw []byte) []byte {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return raw
+	}
+	out, err := json.Marshal(v.Apply(doc))
+	if err != nil {
+		return raw
+	}
+	return out
+}
+
+// applyView áp view lên các document của kết quả
+func applyView(v *query.View, docs []map[string]interface{}) []map[string]interface{} {
+	if v == nil {
+		return docs
+	}
+	for i, doc := range docs {
+		docs[i] = v.Apply(doc)
+	}
+	return docs
+}
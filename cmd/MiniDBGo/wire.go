@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Giao thức nhị phân qua TCP cho client cần thông lượng cao hơn HTTP. Mỗi
+// frame là length(4) + payload, số nguyên big-endian:
+//
+//	request:  id(4) | methodLen(1) method | pathLen(2) path | nHeaders(1)
+//	          { nameLen(1) name | valueLen(2) value } | body
+//	response: id(4) | status(2) | body
+//
+// path giống HTTP (/api/<col>/_search?sort=price), body là JSON như HTTP.
+// Request được chạy qua đúng handler (và middleware) của HTTP API; response
+// trả về theo thứ tự request trên cùng kết nối, nên client có thể gửi liên
+// tiếp nhiều request (pipelining) rồi đọc kết quả, đối chiếu bằng id.
+
+// wireFrameOverhead là phần dành cho method/path/header ngoài body
+const wireFrameOverhead = 64 * 1024
+
+var errWireFrame = errors.New("malformed wire frame")
+
+// wireServer nhận kết nối của giao thức nhị phân
+type wireServer struct {
+	s       *Server
+	handler http.Handler
+	ln      net.Listener
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	closing bool
+	wg      sync.WaitGroup
+}
+
+// startWire mở cổng TCP của giao thức nhị phân (addr rỗng = tắt)
+func (s *Server) startWire(addr string, handler http.Handler) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.wire = &wireServer{s: s, handler: handler, ln: ln, conns: make(map[net.Conn]struct{})}
+	log.Printf("[TCP] Wire protocol listening on %s\n", ln.Addr())
+	s.wire.wg.Add(1)
+	go s.wire.serve()
+	return nil
+}
+
+func (ws *wireServer) serve() {
+	defer ws.wg.Done()
+	for {
+		conn, err := ws.ln.Accept()
+		if err != nil {
+			ws.mu.Lock()
+			closing := ws.closing
+			ws.mu.Unlock()
+			if !closing {
+				log.Printf("[TCP] Accept error: %v\n", err)
+			}
+			return
+		}
+		ws.mu.Lock()
+		if ws.closing {
+			ws.mu.Unlock()
+			conn.Close()
+			return
+		}
+		ws.conns[conn] = struct{}{}
+		ws.wg.Add(1)
+		ws.mu.Unlock()
+		go ws.serveConn(conn)
+	}
+}
+
+// serveConn xử lý lần lượt các request của một kết nối
+func (ws *wireServer) serveConn(conn net.Conn) {
+	defer func() {
+		ws.mu.Lock()
+		delete(ws.conns, conn)
+		ws.mu.Unlock()
+		conn.Close()
+		ws.wg.Done()
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	br := bufio.NewReaderSize(conn, 64*1024)
+	bw := bufio.NewWriterSize(conn, 64*1024)
+	maxFrame := ws.s.opts.MaxImportBodyBytes + wireFrameOverhead
+	start := time.Now()
+	for {
+		conn.SetReadDeadline(time.Now().Add(IdleTimeout))
+		payload, err := readWireFrame(br, maxFrame)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) && !errors.Is(err, errWireFrame) {
+				var ne net.Error
+				if !errors.As(err, &ne) || !ne.Timeout() {
+					log.Printf("[TCP] Read error from %s: %v\n", conn.RemoteAddr(), err)
+				}
+			}
+			if errors.Is(err, errWireFrame) {
+				// Không biết frame kế tiếp bắt đầu ở đâu: báo lỗi rồi đóng kết nối
+				writeWireFrame(bw, 0, http.StatusBadRequest, wireErrorBody(http.StatusBadRequest, err.Error()))
+				bw.Flush()
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(ReadTimeout))
+
+		id, status, body := ws.handle(ctx, conn, payload)
+		conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+		if err := writeWireFrame(bw, id, status, body); err != nil {
+			return
+		}
+		// Gom response của các request đã đến sẵn (pipelining) vào một lần ghi
+		if br.Buffered() == 0 {
+			if err := bw.Flush(); err != nil {
+				return
+			}
+		}
+		ws.mu.Lock()
+		closing := ws.closing
+		ws.mu.Unlock()
+		if closing {
+			bw.Flush()
+			return
+		}
+		// Kết nối quá MaxConnLifetime hoặc bị drain: đóng sau response, client kết nối lại
+		if ws.s.conns.expired(start) {
+			bw.Flush()
+			ws.s.conns.recycled.Add(1)
+			return
+		}
+	}
+}
+
+// handle giải mã một request và chạy nó qua handler của HTTP API
+func (ws *wireServer) handle(ctx context.Context, conn net.Conn, payload []byte) (uint32, int, []byte) {
+	id, method, path, header, body, err := decodeWireRequest(payload)
+	if err != nil {
+		return id, http.StatusBadRequest, wireErrorBody(http.StatusBadRequest, err.Error())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://wire"+path, bytes.NewReader(body))
+	if err != nil {
+		return id, http.StatusBadRequest, wireErrorBody(http.StatusBadRequest, err.Error())
+	}
+	req.Header = header
+	if req.Header.Get("Content-Type") == "" && len(body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.RemoteAddr = conn.RemoteAddr().String()
+
+	rw := &wireResponse{header: make(http.Header)}
+	ws.handler.ServeHTTP(rw, req)
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	return id, rw.status, rw.body.Bytes()
+}
+
+// close ngừng nhận kết nối mới, chờ các request đang chạy xong (tối đa tới
+// khi ctx hết hạn) rồi đóng mọi kết nối
+func (ws *wireServer) close(ctx context.Context) {
+	ws.mu.Lock()
+	ws.closing = true
+	ws.ln.Close()
+	for conn := range ws.conns {
+		// Đánh thức các kết nối đang chờ request; request đang chạy vẫn trả lời xong
+		conn.SetReadDeadline(time.Now())
+	}
+	ws.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ws.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		ws.mu.Lock()
+		for conn := range ws.conns {
+			conn.Close()
+		}
+		ws.mu.Unlock()
+		<-done
+	}
+}
+
+// wireResponse là http.ResponseWriter ghi response vào bộ nhớ để gửi thành frame
+type wireResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *wireResponse) Header() http.Header { return w.header }
+
+func (w *wireResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *wireResponse) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// wireErrorBody là body lỗi giống writeError của HTTP
+func wireErrorBody(status int, message string) []byte {
+	rw := &wireResponse{header: make(http.Header)}
+	writeError(rw, status, message)
+	return rw.body.Bytes()
+}
+
+// readWireFrame đọc một frame; frame lớn hơn max là lỗi errWireFrame
+func readWireFrame(r *bufio.Reader, max int64) ([]byte, error) {
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(lenBuf[:])
+	if int64(n) > max {
+		return nil, fmt.Errorf("%w: frame of %d bytes exceeds limit %d", errWireFrame, n, max)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func writeWireFrame(w *bufio.Writer, id uint32, status int, body []byte) error {
+	var hdr [10]byte
+	binary.BigEndian.PutUint32(hdr[0:], uint32(6+len(body)))
+	binary.BigEndian.PutUint32(hdr[4:], id)
+	binary.BigEndian.PutUint16(hdr[8:], uint16(status))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// decodeWireRequest tách các phần của payload request
+func decodeWireRequest(p []byte) (id uint32, method, path string, header http.Header, body []byte, err error) {
+	bad := func(what string) error { return fmt.Errorf("%w: truncated %s", errWireFrame, what) }
+	if len(p) < 4 {
+		return 0, "", "", nil, nil, bad("id")
+	}
+	id, p = binary.BigEndian.Uint32(p), p[4:]
+
+	if len(p) < 1 || len(p) < 1+int(p[0]) {
+		return id, "", "", nil, nil, bad("method")
+	}
+	method, p = string(p[1:1+int(p[0])]), p[1+int(p[0]):]
+
+	if len(p) < 2 || len(p) < 2+int(binary.BigEndian.Uint16(p)) {
+		return id, "", "", nil, nil, bad("path")
+	}
+	n := int(binary.BigEndian.Uint16(p))
+	path, p = string(p[2:2+n]), p[2+n:]
+	if len(path) == 0 || path[0] != '/' {
+		return id, "", "", nil, nil, fmt.Errorf("%w: path must start with '/'", errWireFrame)
+	}
+
+	if len(p) < 1 {
+		return id, "", "", nil, nil, bad("headers")
+	}
+	count := int(p[0])
+	p = p[1:]
+	header = make(http.Header, count)
+	for i := 0; i < count; i++ {
+		if len(p) < 1 || len(p) < 1+int(p[0]) {
+			return id, "", "", nil, nil, bad("header name")
+		}
+		name := string(p[1 : 1+int(p[0])])
+		p = p[1+int(p[0]):]
+		if len(p) < 2 || len(p) < 2+int(binary.BigEndian.Uint16(p)) {
+			return id, "", "", nil, nil, bad("header value")
+		}
+		n := int(binary.BigEndian.Uint16(p))
+		header.Add(name, string(p[2:2+n]))
+		p = p[2+n:]
+	}
+	return id, method, path, header, p, nil
+}
@@ -0,0 +1,43 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Durability quy định khi nào một lần ghi được fsync xuống đĩa
+type Durability int
+
+const (
+	DurabilityDefault  Durability = iota // Theo cấu hình của engine
+	DurabilityOS                         // Chỉ ghi vào page cache của hệ điều hành (mất khi mất điện)
+	DurabilityEverySec                   // fsync nền mỗi giây (mất tối đa khoảng 1 giây khi mất điện)
+	DurabilityAlways                     // fsync trước khi lần ghi trả về
+)
+
+func (d Durability) String() string {
+	switch d {
+	case DurabilityOS:
+		return "os"
+	case DurabilityEverySec:
+		return "everysec"
+	case DurabilityAlways:
+		return "always"
+	}
+	return "default"
+}
+
+// ParseDurability đọc "always", "everysec" hoặc "os" ("" = DurabilityDefault)
+func ParseDurability(s string) (Durability, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "default":
+		return DurabilityDefault, nil
+	case "os":
+		return DurabilityOS, nil
+	case "everysec":
+		return DurabilityEverySec, nil
+	case "always":
+		return DurabilityAlways, nil
+	}
+	return DurabilityDefault, fmt.Errorf("invalid durability %q (expected always, everysec or os)", s)
+}
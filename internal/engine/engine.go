@@ -1,27 +1,80 @@
 package engine
 
 // (Không import lsm)
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/jobs"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
 
 // --- MỚI: Di chuyển Item (từ memtable.go) sang đây ---
 type Item struct {
 	Value     []byte
 	Tombstone bool
+	// ValuePointer: Value là con trỏ vào value log của lsm, không phải
+	// document (chỉ xuất hiện bên trong engine, không trả ra cho người dùng)
+	ValuePointer bool
+	// UpdatedAt là thời điểm commit của lần ghi (Unix nano);
+	// 0 = dữ liệu ghi trước khi engine lưu thời điểm ghi
+	UpdatedAt int64
+	// Seq là số thứ tự toàn cục của lần ghi (tăng dần theo thứ tự commit);
+	// 0 = dữ liệu ghi trước khi engine gán seqno
+	Seq uint64
+	// ExpiresAt là thời điểm document hết hạn (Unix nano, từ _ttl/_expiresAt);
+	// 0 = không hết hạn
+	ExpiresAt int64
 }
 
 // --- MỚI: Định nghĩa Iterator interface (từ iterator.go) ---
 type Iterator interface {
 	Next() bool
+	// Seek định vị iterator sao cho lần Next() kế tiếp
+	// trả về key nhỏ nhất >= key
+	Seek(key string)
 	Key() string
 	Value() *Item // Sử dụng engine.Item
 	Close() error
 	Error() error
 }
 
+// Snapshot là ảnh chụp nhất quán của CSDL tại một seqno: mọi lần đọc qua nó
+// không thấy các lần ghi sau, kể cả khi flush và compaction chạy. Các tệp nó
+// thấy được giữ tới khi Close (và mọi iterator của nó đã đóng).
+type Snapshot interface {
+	Seq() uint64 // Seqno của lần ghi cuối được nhìn thấy
+	Get(key []byte) ([]byte, error)
+	NewIterator() (Iterator, error)
+	NewPrefixIterator(prefix string) (Iterator, error)
+	// NewPrefixIteratorContext như Engine.NewPrefixIteratorContext
+	NewPrefixIteratorContext(ctx context.Context, prefix string) (Iterator, error)
+	Close() error
+}
+
+// Txn là transaction đọc-ghi lạc quan: đọc trên snapshot lúc Begin (thấy
+// cả các lần ghi của chính nó), ghi được giữ trong bộ nhớ tới Commit. Commit
+// trả về ErrTxnConflict nếu key nào txn đã đọc hoặc ghi bị ghi bởi người khác
+// sau snapshot; khi đó không có gì được ghi và caller chạy lại từ đầu.
+type Txn interface {
+	Seq() uint64 // Seqno của snapshot mà txn đọc
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte)
+	Delete(key []byte)
+	Commit() error
+	Rollback() // Bỏ các lần ghi; gọi sau Commit thì không làm gì
+}
+
 // --- MỚI: Định nghĩa Batch interface ---
 type Batch interface {
 	Put(key, value []byte)
 	Delete(key []byte)
 	Size() int
+	// SetDurability ghi đè chế độ fsync của engine cho riêng batch này
+	SetDurability(d Durability)
 }
 
 // DB Engine interface
@@ -31,19 +84,416 @@ type Engine interface {
 	Update(key, value []byte) error
 	Delete(key []byte) error
 	Get(key []byte) ([]byte, error)
+	// GetContext giống Get nhưng tôn trọng deadline và độ ưu tiên trong ctx
+	// (xem WithPriority)
+	GetContext(ctx context.Context, key []byte) ([]byte, error)
+	// GetItem giống GetContext nhưng trả về cả Item (UpdatedAt của lần ghi cuối)
+	GetItem(ctx context.Context, key []byte) (*Item, error)
+	// Exists cho biết key có tồn tại không mà không đọc và trả về value
+	// (rẻ hơn Get với document lớn)
+	Exists(key []byte) (bool, error)
+	// MultiGet đọc nhiều key trong một lần (cùng một ảnh chụp dữ liệu);
+	// phần tử ứng với key không tồn tại là nil
+	MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error)
+	// GetTrace giống GetContext nhưng trả về thêm đường đi của lần đọc
+	// (MemTable, Immutable, từng SSTable, bloom, block) để chẩn đoán.
+	// Trace được trả về cả khi key không tồn tại.
+	GetTrace(ctx context.Context, key []byte) ([]byte, *ReadTrace, error)
+	// FindOneAndUpdate đọc-sửa-ghi giá trị tại key một cách nguyên tử
+	// (các lần ghi khác vào cùng key phải chờ). fn nhận giá trị hiện tại
+	// (nil nếu key chưa tồn tại, cho phép upsert) và trả về giá trị mới,
+	// hoặc nil để không ghi gì.
+	FindOneAndUpdate(key []byte, fn func(old []byte) ([]byte, error)) (before, after []byte, err error)
+	// FindOneAndDelete xóa key nếu match(giá trị hiện tại) trả về true
+	// và trả về giá trị đã xóa (nil nếu không xóa)
+	FindOneAndDelete(key []byte, match func(old []byte) bool) ([]byte, error)
+
+	// Lease: quyền giữ một tên trong ttl, tự hết hiệu lực nếu người giữ không
+	// gia hạn bằng KeepAlive (nền cho bầu leader giữa các client). Lease đang
+	// bị giữ: ErrLeaseHeld kèm Lease của người giữ (không có ID).
+	GrantLease(name, owner string, ttl time.Duration) (*Lease, error)
+	// KeepAlive gia hạn lease thêm ttl (0 = TTL lúc cấp) nếu id khớp
+	KeepAlive(name, id string, ttl time.Duration) (*Lease, error)
+	// RevokeLease trả lease trước hạn và trả về lease vừa trả
+	RevokeLease(name, id string) (*Lease, error)
+	GetLease(name string) (*Lease, error) // ID không được trả về
+	Leases() ([]Lease, error)             // Các lease còn hiệu lực, ID không được trả về
 	DumpDB(path string) error
 	RestoreDB(path string) error
+	ExportMeta(path string) error // Chỉ xuất metadata (index...), nạp lại bằng RestoreDB
 	Compact() error
+	// PlanCompaction trả về compaction mà Compact sẽ chạy tiếp theo mà không
+	// chạy nó (dry run), xem CompactionPlan
+	PlanCompaction() (CompactionPlan, error)
 	Close() error
 	GetMetrics() map[string]int64
+	// KeyRangeStats ước lượng số key và dung lượng của tiền tố prefix từ
+	// Index Block của các SSTable (không quét dữ liệu), xem KeyRangeStats
+	KeyRangeStats(prefix string) (KeyRangeStats, error)
+	// VerifyTables đọc lại toàn bộ từng SSTable đang dùng (checksum của mọi
+	// block, thứ tự key, đối chiếu properties) và trả về kết quả theo tệp
+	VerifyTables(ctx context.Context) ([]TableCheck, error)
+	// Jobs trả về các tác vụ nền (flush, compaction, scrubber...) đang chờ,
+	// đang chạy và vừa kết thúc
+	Jobs() jobs.Status
 	IterKeysWithLimit(limit int) ([]string, error)
 
 	NewBatch() Batch                // Trả về interface
 	ApplyBatch(b Batch) error       // Chấp nhận interface
 	NewIterator() (Iterator, error) // Trả về interface
+	// NewPrefixIterator chỉ duyệt các key có tiền tố prefix,
+	// bỏ qua các SSTable không chứa key nào thuộc tiền tố đó
+	NewPrefixIterator(prefix string) (Iterator, error)
+	// NewPrefixIteratorContext giống NewPrefixIterator; iterator dừng với lỗi
+	// của ctx khi hết deadline, scan ưu tiên thấp nhường cho đọc ưu tiên cao
+	NewPrefixIteratorContext(ctx context.Context, prefix string) (Iterator, error)
+	// Snapshot chụp trạng thái hiện tại cho các lần quét dài (dump, _search,
+	// sao lưu); caller phải Close
+	Snapshot() (Snapshot, error)
+	// Begin mở một transaction lạc quan (xem Txn); caller phải Commit hoặc Rollback
+	Begin() (Txn, error)
+
+	// DeletePrefix xóa mọi key có tiền tố prefix mà match trả về true
+	// (match == nil: xóa tất cả). Trả về số key đã xóa.
+	DeletePrefix(prefix string, match func(key string, value []byte) bool) (int, error)
+	// DeleteRange xóa mọi key trong [start, end) (end rỗng: không giới hạn
+	// trên) bằng một range tombstone, không quét dữ liệu; dung lượng được thu
+	// hồi dần qua compaction. Không bảo trì index và tham chiếu.
+	DeleteRange(start, end []byte) error
+	// DropCollection xóa mọi document của collection cùng entry index của nó
+	// (DeleteRange), giữ lại định nghĩa index. ErrReferenceViolation nếu
+	// collection khác còn tham chiếu tới nó với onDelete restrict/cascade.
+	DropCollection(collection string) error
+	// ReplaceCollection thay toàn bộ document của collection (cùng entry index)
+	// bằng các batch mà load ghi qua apply, trong một lần hoán đổi nguyên tử:
+	// reader thấy trọn dữ liệu cũ hoặc trọn dữ liệu mới, lỗi thì giữ dữ liệu
+	// cũ. Batch tạo bằng NewBatch, mọi key phải thuộc collection. Tham chiếu
+	// không được kiểm tra.
+	ReplaceCollection(collection string, load func(apply func(Batch) error) error) error
+
+	// Secondary index trên field của document. Compound index được đặt tên
+	// bằng các field nối bởi dấu phẩy (vd "category,price", xem IndexFields).
+	CreateIndex(collection, field string, opts IndexOptions) error
+	ListIndexes(collection string) []string
+	IndexInfo(collection, field string) (IndexOptions, bool)
+	// IndexLookup trả về danh sách _id có giá trị field nằm trong khoảng r.
+	// Kết quả có thể chứa _id "cũ", caller cần kiểm tra lại document.
+	IndexLookup(collection, field string, r IndexRange) ([]string, error)
+	// IndexScan trả về _id theo thứ tự của index: eq là giá trị bằng của các
+	// field đầu của index, r là khoảng trên field kế tiếp.
+	IndexScan(collection, index string, eq []interface{}, r IndexRange) ([]string, error)
+
+	// Text index (toàn văn): mỗi collection có tối đa một, trên một hoặc nhiều field
+	CreateTextIndex(collection string, fields []string) error
+	TextIndex(collection string) ([]string, bool)
+	// TextSearch trả về các _id chứa ít nhất một từ trong terms (đã qua
+	// query.Tokenize), sắp theo điểm giảm dần. Có thể chứa _id "cũ".
+	TextSearch(collection string, terms []string) ([]TextHit, error)
+
+	// Ngưỡng rotate MemTable, đổi được khi đang chạy: MemTable hiện tại
+	// giữ ngưỡng cũ, ngưỡng mới có hiệu lực từ lần rotate kế tiếp
+	SetFlushThresholds(t FlushThresholds) error
+	// FlushThresholds trả về ngưỡng đang hiệu lực và ngưỡng chờ áp dụng (nil nếu không có)
+	FlushThresholds() (active FlushThresholds, pending *FlushThresholds)
+
+	// Tham chiếu giữa các collection, được kiểm tra khi ghi (xem Reference).
+	// SetReference tạo index trên Collection.Field nếu chưa có.
+	SetReference(ref Reference) error
+	DropReference(collection, field string) error
+	// References trả về các tham chiếu khai báo trên collection hoặc trỏ tới nó
+	References(collection string) []Reference
+
+	// Quy tắc ép kiểu khi đọc (schema-on-read); typ rỗng để xóa quy tắc
+	SetCoercion(collection, field, typ string) error
+	Coercions(collection string) map[string]string
 }
 
 // --- SỬA ĐỔI: Xóa hàm Open() ---
 // (Hàm Open() không thể ở đây vì nó tạo ra
 // phụ thuộc vào lsm. Chúng ta sẽ gọi lsm.OpenLSM trực tiếp
 // từ main.go)
+
+// ErrInvalidDocument được trả về (bọc kèm chi tiết) khi document
+// vi phạm một ràng buộc của engine. Lỗi này do phía client gây ra.
+var ErrInvalidDocument = errors.New("invalid document")
+
+// ErrKeyNotFound được trả về khi key không tồn tại (hoặc đã bị xóa)
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrIndexConflict: index đã tồn tại với tùy chọn khác
+var ErrIndexConflict = errors.New("index already exists with different options")
+
+// ErrDuplicateKey: lần ghi vi phạm unique index (xem DuplicateKeyError)
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// DuplicateKeyError cho biết giá trị nào của unique index đã bị document khác giữ
+type DuplicateKeyError struct {
+	Collection string      `json:"collection"`
+	Index      string      `json:"index"`
+	Value      interface{} `json:"value"` // Giá trị đã index (mảng với compound index)
+	ID         string      `json:"_id"`   // Document đang được ghi
+	ExistingID string      `json:"existing_id"`
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key on %s.%s: %v is already used by %s", e.Collection, e.Index, e.Value, e.ExistingID)
+}
+
+func (e *DuplicateKeyError) Unwrap() error { return ErrDuplicateKey }
+
+// ErrTxnConflict: key mà transaction đã đọc hoặc ghi bị thay đổi sau
+// snapshot của nó; transaction đã bị hủy
+var ErrTxnConflict = errors.New("transaction conflict")
+
+// ErrTxnDone: transaction đã Commit hoặc Rollback
+var ErrTxnDone = errors.New("transaction already committed or rolled back")
+
+// ErrLeaseHeld: lease đang được giữ bởi ID khác và chưa hết hạn
+var ErrLeaseHeld = errors.New("lease is held")
+
+// ErrLeaseNotFound: lease không tồn tại hoặc đã hết hạn
+var ErrLeaseNotFound = errors.New("lease not found")
+
+// Lease là quyền giữ Name tới ExpiresAt. ID chỉ được trả cho người giữ
+// (GrantLease, KeepAlive) và là bằng chứng để gia hạn hoặc trả lease.
+type Lease struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner,omitempty"`
+	ID        string    `json:"id,omitempty"`
+	TTLMs     int64     `json:"ttlMs"`
+	GrantedAt time.Time `json:"grantedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Expired cho biết lease đã hết hạn tại thời điểm now
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// ErrReferenceViolation: lần ghi/xóa vi phạm một tham chiếu (xem ReferenceError)
+var ErrReferenceViolation = errors.New("reference violation")
+
+// Hành động khi document đích của một tham chiếu bị xóa
+const (
+	RefDeleteNone     = ""         // Không kiểm tra (tham chiếu có thể trỏ tới document đã xóa)
+	RefDeleteRestrict = "restrict" // Từ chối xóa khi còn document tham chiếu tới
+	RefDeleteCascade  = "cascade"  // Xóa luôn các document tham chiếu tới
+)
+
+// Reference khai báo Collection.Field chứa _id (chuỗi hoặc mảng chuỗi)
+// của document trong Target, vd orders.customerId -> customers
+type Reference struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+	Target     string `json:"target"`
+	// CheckInsert: mỗi lần ghi document của Collection, các _id được tham chiếu
+	// phải tồn tại trong Target (null hoặc thiếu field thì bỏ qua)
+	CheckInsert bool   `json:"checkInsert,omitempty"`
+	OnDelete    string `json:"onDelete,omitempty"` // RefDelete*
+}
+
+// ReferenceError cho biết tham chiếu nào bị vi phạm
+type ReferenceError struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+	Target     string `json:"target"`
+	ID         string `json:"_id"`       // Document chứa tham chiếu
+	TargetID   string `json:"target_id"` // _id được tham chiếu
+	// Op = "write": tham chiếu tới document không tồn tại;
+	// "delete": document đích vẫn còn được tham chiếu (restrict)
+	Op string `json:"op"`
+}
+
+func (e *ReferenceError) Error() string {
+	if e.Op == "delete" {
+		return fmt.Sprintf("cannot delete %s:%s: still referenced by %s.%s of %s", e.Target, e.TargetID, e.Collection, e.Field, e.ID)
+	}
+	return fmt.Sprintf("%s.%s of %s references missing %s:%s", e.Collection, e.Field, e.ID, e.Target, e.TargetID)
+}
+
+func (e *ReferenceError) Unwrap() error { return ErrReferenceViolation }
+
+// ReadTrace là đường đi của một lần Get (xem GetTrace)
+type ReadTrace struct {
+	Result     string      `json:"result"` // "found", "tombstone" hoặc "not_found"
+	DurationUs int64       `json:"duration_us"`
+	Steps      []TraceStep `json:"steps"`
+}
+
+// TraceStep là một nơi lookup đã ghé qua, theo thứ tự.
+// Outcome: "found", "tombstone", "miss" (đã tìm, không có key),
+// "out_of_range" (key ngoài Min/MaxKey của tệp hoặc level), "bloom_negative", "error".
+type TraceStep struct {
+	Source     string      `json:"source"` // "memtable", "immutable" hoặc "sst"
+	Level      *int        `json:"level,omitempty"`
+	File       string      `json:"file,omitempty"`
+	TableCache string      `json:"table_cache,omitempty"` // "hit" hoặc "miss" (tệp phải mở và parse)
+	Bloom      string      `json:"bloom,omitempty"`       // "positive", "negative" hoặc "none" (tệp không có bloom)
+	Block      *TraceBlock `json:"block,omitempty"`
+	Outcome    string      `json:"outcome"`
+	Error      string      `json:"error,omitempty"`
+	DurationUs int64       `json:"duration_us"`
+}
+
+// TraceBlock là data block đã đọc trong một SSTable
+type TraceBlock struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"` // Độ dài trên đĩa (sau khi nén)
+	Cached bool  `json:"cached"` // Lấy từ block cache, không đọc đĩa
+}
+
+// KeyRangeStats là ước lượng số key và dung lượng của một tiền tố.
+// SSTable được tính theo data block giao với tiền tố (dung lượng trên đĩa,
+// sau khi nén), số key suy ra từ tỉ lệ đó; MemTable được đếm chính xác.
+// Bản ghi cũ và tombstone chưa được compaction dọn vẫn được tính.
+type KeyRangeStats struct {
+	Prefix        string          `json:"prefix"`
+	Keys          int64           `json:"keys"`
+	Bytes         int64           `json:"bytes"`
+	MemTableKeys  int64           `json:"memtable_keys"` // Gồm cả các Immutable chưa flush
+	MemTableBytes int64           `json:"memtable_bytes"`
+	Levels        []LevelKeyRange `json:"levels"`
+}
+
+// LevelKeyRange là phần của tiền tố nằm trong một level
+type LevelKeyRange struct {
+	Level int   `json:"level"`
+	Files int   `json:"files"` // Số tệp giao với tiền tố
+	Keys  int64 `json:"keys"`
+	Bytes int64 `json:"bytes"`
+}
+
+// TableProperties là properties block của một SSTable (từ SSTVersion 6),
+// ghi lúc tạo tệp
+type TableProperties struct {
+	KeyCount      uint64    `json:"key_count"`
+	Tombstones    uint64    `json:"tombstones"`
+	DataBlocks    uint64    `json:"data_blocks"`
+	RawKeyBytes   uint64    `json:"raw_key_bytes"`
+	RawValueBytes uint64    `json:"raw_value_bytes"`
+	RawDataBytes  uint64    `json:"raw_data_bytes"` // Data block trước khi nén
+	DataBytes     uint64    `json:"data_bytes"`     // Data block trên đĩa (gồm trailer)
+	MinKey        string    `json:"min_key"`
+	MaxKey        string    `json:"max_key"`
+	Level         int       `json:"level"`
+	Compression   string    `json:"compression"`
+	CreatedAt     time.Time `json:"created_at"`
+	// BlockSize là kích thước data block của tệp (từ footer, SSTVersion 11);
+	// CollectionBlockSizes là các collection trong tệp dùng kích thước riêng
+	BlockSize            uint32            `json:"block_size,omitempty"`
+	CollectionBlockSizes map[string]uint32 `json:"collection_block_sizes,omitempty"`
+}
+
+// TableCheck là kết quả kiểm tra một SSTable; Error rỗng nghĩa là tệp nguyên vẹn
+type TableCheck struct {
+	Level      int              `json:"level"`
+	Path       string           `json:"path"`
+	Version    uint32           `json:"version"`
+	Keys       uint64           `json:"keys"`
+	Blocks     int              `json:"blocks"`
+	Error      string           `json:"error,omitempty"`
+	Properties *TableProperties `json:"properties,omitempty"` // nil với tệp trước v6
+}
+
+// CompactionPlan mô tả compaction mà Compact sẽ chạy tiếp theo (không ghi gì).
+// Các trường Estimated* là ước lượng từ metadata, không đọc dữ liệu.
+type CompactionPlan struct {
+	Needed    bool             `json:"needed"`
+	Reason    string           `json:"reason,omitempty"` // "l0_file_count" hoặc "l1_size"
+	FromLevel int              `json:"from_level"`
+	ToLevel   int              `json:"to_level"`
+	Inputs    []CompactionFile `json:"inputs"` // Tệp ở FromLevel rồi các tệp chồng lấn ở ToLevel
+
+	InputBytes int64  `json:"input_bytes"`
+	InputKeys  uint64 `json:"input_keys"` // Gồm phiên bản cũ và tombstone
+	Tombstones uint64 `json:"tombstones"`
+	// DroppableTombstones: tombstone được bỏ hẳn vì không tệp nào ở level sâu
+	// hơn chồng lấn khoảng key của compaction (0 nếu có, dù compaction vẫn
+	// bỏ tombstone của key nằm ngoài các tệp đó)
+	DroppableTombstones uint64 `json:"droppable_tombstones"`
+
+	EstimatedOutputBytes int64 `json:"estimated_output_bytes"`
+	EstimatedOutputFiles int   `json:"estimated_output_files"`
+	EstimatedDurationMs  int64 `json:"estimated_duration_ms"`
+}
+
+// CompactionFile là một tệp input của CompactionPlan
+type CompactionFile struct {
+	Level      int    `json:"level"`
+	Path       string `json:"path"`
+	Bytes      int64  `json:"bytes"`
+	Keys       uint32 `json:"keys"`
+	Tombstones uint64 `json:"tombstones"`
+	MinKey     string `json:"min_key"`
+	MaxKey     string `json:"max_key"`
+}
+
+// TagsField là field nhãn (label) được engine tự động index
+const TagsField = "_tags"
+
+// TTLField và ExpiresAtField đặt thời điểm hết hạn của document: _ttl là số
+// giây tính từ lần ghi (mỗi lần ghi lại tính lại), _expiresAt là thời điểm cố
+// định (RFC 3339 hoặc Unix milliseconds). Document hết hạn được coi như đã
+// xóa và bị compaction bỏ hẳn.
+const (
+	TTLField       = "_ttl"
+	ExpiresAtField = "_expiresAt"
+)
+
+// SystemKeyPrefix đánh dấu các key nội bộ của engine (index, catalog...).
+// Các key này không thuộc về collection nào của người dùng.
+const SystemKeyPrefix = "__"
+
+// AppKeyPrefix: key nội bộ do ứng dụng dùng engine quản lý (vd. view của
+// server), không phải engine. Engine không đọc các key này nhưng DumpDB và
+// ExportMeta chép giá trị (JSON) của chúng vào metadata để RestoreDB ghi lại.
+const AppKeyPrefix = SystemKeyPrefix + "app:"
+
+// IsSystemKey trả về true nếu key là key nội bộ
+func IsSystemKey(key string) bool {
+	return strings.HasPrefix(key, SystemKeyPrefix)
+}
+
+// IndexFields tách tên index thành các field ("category,price" -> [category price])
+func IndexFields(index string) []string {
+	return strings.Split(index, ",")
+}
+
+// IndexOptions là các tùy chọn của một secondary index
+type IndexOptions struct {
+	// Collation dùng khi mã hóa giá trị chuỗi thành key của index
+	// (nil = so sánh theo byte). Chỉ truy vấn cùng collation mới dùng được index.
+	Collation *query.Collation `json:"collation,omitempty"`
+	// Unique: hai document không được có cùng giá trị (so theo collation).
+	// Document thiếu field không bị ràng buộc (trừ compound index, nơi field thiếu là null).
+	Unique bool `json:"unique,omitempty"`
+	// Multikey (chỉ đọc, do IndexInfo trả về): index đã chứa giá trị mảng,
+	// một document có thể có nhiều entry
+	Multikey bool `json:"multikey,omitempty"`
+}
+
+// FlushThresholds là ngưỡng để MemTable được rotate và flush xuống đĩa
+type FlushThresholds struct {
+	FlushSize   int64 `json:"flush_size"`    // Số record
+	MaxMemBytes int64 `json:"max_mem_bytes"` // Dung lượng (byte)
+}
+
+// TextHit là một kết quả của TextSearch
+type TextHit struct {
+	ID    string  `json:"_id"`
+	Score float64 `json:"score"`
+}
+
+// IndexBound là một cận (trên hoặc dưới) khi tra cứu index
+type IndexBound struct {
+	Value     interface{}
+	Inclusive bool
+}
+
+// IndexRange mô tả khoảng giá trị cần tra cứu trên một index.
+// Lower/Upper = nil nghĩa là không giới hạn phía đó.
+// Truy vấn bằng (equality) dùng Lower == Upper và cả hai Inclusive.
+type IndexRange struct {
+	Lower *IndexBound
+	Upper *IndexBound
+}
@@ -0,0 +1,328 @@
+// Package jobs chạy các tác vụ nền (flush, compaction, scrubber, mirror...)
+// qua một bộ lập lịch chung, để có thể xem hàng đợi, job đang chạy,
+// thời gian chạy và lỗi gần nhất thay vì mỗi tính năng tự mở goroutine riêng.
+package jobs
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Trạng thái của một job
+const (
+	StateQueued  = "queued"
+	StateRunning = "running"
+	StateDone    = "done"
+	StateFailed  = "failed"
+)
+
+// Số job đã kết thúc được giữ lại để xem
+const maxHistory = 100
+
+var (
+	// ErrQueueFull: hàng đợi của lane đã đầy
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrClosed: scheduler đã dừng, không nhận job mới
+	ErrClosed = errors.New("job scheduler is closed")
+)
+
+// LaneOptions cấu hình một lane (một loại job)
+type LaneOptions struct {
+	Workers   int  // Số job chạy song song (mặc định 1 = tuần tự)
+	QueueSize int  // Số job chờ tối đa
+	Record    bool // Ghi từng job vào danh sách (tắt cho job rất nhiều, vd mirror)
+}
+
+// Info là trạng thái của một job
+type Info struct {
+	ID         int64      `json:"id"`
+	Kind       string     `json:"kind"`
+	Detail     string     `json:"detail,omitempty"`
+	State      string     `json:"state"`
+	QueuedAt   time.Time  `json:"queued_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs int64      `json:"duration_ms"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// LaneInfo là thống kê của một lane
+type LaneInfo struct {
+	Kind           string `json:"kind"`
+	Workers        int    `json:"workers"`
+	IntervalMs     int64  `json:"interval_ms,omitempty"` // Job định kỳ
+	Queued         int    `json:"queued"`
+	Running        int    `json:"running"`
+	Completed      int64  `json:"completed"`
+	Failed         int64  `json:"failed"`
+	LastDurationMs int64  `json:"last_duration_ms"`
+	LastError      string `json:"last_error,omitempty"`
+	LastErrorAt    string `json:"last_error_at,omitempty"`
+}
+
+type job struct {
+	info Info
+	fn   func() error
+}
+
+type lane struct {
+	opts     LaneOptions
+	interval time.Duration
+	queue    chan *job
+	stats    LaneInfo
+}
+
+// Scheduler quản lý các lane và lịch sử job
+type Scheduler struct {
+	mu      sync.Mutex
+	nextID  int64
+	lanes   map[string]*lane
+	active  map[int64]*job
+	history []Info
+	closed  bool
+	sendMu  sync.RWMutex // Giữ (đọc) trong lúc gửi vào queue, Close giữ (ghi) khi đóng queue
+
+	stopCh chan struct{} // Dừng các job định kỳ
+	wg     sync.WaitGroup
+}
+
+// New tạo một Scheduler rỗng
+func New() *Scheduler {
+	return &Scheduler{
+		lanes:  make(map[string]*lane),
+		active: make(map[int64]*job),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// AddLane đăng ký một loại job và khởi động worker của nó
+func (s *Scheduler) AddLane(kind string, opts LaneOptions) {
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	l := &lane{opts: opts, queue: make(chan *job, opts.QueueSize)}
+	l.stats = LaneInfo{Kind: kind, Workers: opts.Workers}
+
+	s.mu.Lock()
+	s.lanes[kind] = l
+	s.mu.Unlock()
+
+	s.wg.Add(opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		go s.worker(l)
+	}
+}
+
+// Submit đưa job vào lane mà không chờ (ErrQueueFull nếu hàng đợi đầy)
+func (s *Scheduler) Submit(kind, detail string, fn func() error) error {
+	return s.SubmitWait(kind, detail, 0, fn)
+}
+
+// SubmitWait đưa job vào lane, chờ tối đa timeout nếu hàng đợi đầy
+func (s *Scheduler) SubmitWait(kind, detail string, timeout time.Duration, fn func() error) error {
+	// Close chỉ đóng các queue khi không còn ai đang gửi
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+
+	s.mu.Lock()
+	l, ok := s.lanes[kind]
+	if !ok || l.queue == nil {
+		s.mu.Unlock()
+		return errors.New("unknown job kind " + kind)
+	}
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.nextID++
+	j := &job{info: Info{ID: s.nextID, Kind: kind, Detail: detail, State: StateQueued, QueuedAt: time.Now()}, fn: fn}
+	if l.opts.Record {
+		s.active[j.info.ID] = j
+	}
+	l.stats.Queued++
+	s.mu.Unlock()
+
+	var wait <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		wait = timer.C
+	}
+
+	select {
+	case l.queue <- j:
+		return nil
+	default:
+	}
+	if wait != nil {
+		select {
+		case l.queue <- j:
+			return nil
+		case <-wait:
+		}
+	}
+
+	s.mu.Lock()
+	delete(s.active, j.info.ID)
+	l.stats.Queued--
+	s.mu.Unlock()
+	return ErrQueueFull
+}
+
+func (s *Scheduler) worker(l *lane) {
+	defer s.wg.Done()
+	for j := range l.queue {
+		s.run(l, j)
+	}
+}
+
+// run chạy một job và ghi nhận kết quả
+func (s *Scheduler) run(l *lane, j *job) {
+	start := time.Now()
+	s.mu.Lock()
+	j.info.State = StateRunning
+	j.info.StartedAt = &start
+	if l.interval == 0 {
+		l.stats.Queued--
+	}
+	l.stats.Running++
+	s.mu.Unlock()
+
+	err := safeRun(j.info.Kind, j.fn)
+
+	end := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j.info.FinishedAt = &end
+	j.info.DurationMs = end.Sub(start).Milliseconds()
+	l.stats.Running--
+	l.stats.LastDurationMs = j.info.DurationMs
+	if err != nil {
+		j.info.State = StateFailed
+		j.info.Error = err.Error()
+		l.stats.Failed++
+		l.stats.LastError = err.Error()
+		l.stats.LastErrorAt = end.UTC().Format(time.RFC3339)
+	} else {
+		j.info.State = StateDone
+		l.stats.Completed++
+	}
+
+	if l.opts.Record {
+		delete(s.active, j.info.ID)
+		s.history = append(s.history, j.info)
+		if len(s.history) > maxHistory {
+			s.history = s.history[len(s.history)-maxHistory:]
+		}
+	}
+}
+
+// safeRun chạy fn, chuyển panic thành lỗi để worker không chết
+func safeRun(kind string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Job panicked", "kind", kind, "panic", r)
+			err = errors.New("job panicked")
+		}
+	}()
+	return fn()
+}
+
+// Every chạy fn định kỳ (vd scrubber). Mỗi lần chạy chỉ cập nhật
+// thống kê của lane, không ghi vào danh sách job.
+func (s *Scheduler) Every(kind string, interval time.Duration, fn func() error) {
+	l := &lane{opts: LaneOptions{Workers: 1}, interval: interval}
+	l.stats = LaneInfo{Kind: kind, Workers: 1, IntervalMs: interval.Milliseconds()}
+
+	s.mu.Lock()
+	s.lanes[kind] = l
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stopCh:
+				return
+			case <-ticker.C:
+				s.run(l, &job{info: Info{Kind: kind}, fn: fn})
+			}
+		}
+	}()
+}
+
+// Status là ảnh chụp trạng thái của Scheduler (cho GET /api/_jobs)
+type Status struct {
+	Lanes []LaneInfo `json:"lanes"`
+	Jobs  []Info     `json:"jobs"`
+}
+
+// Status trả về thống kê các lane và danh sách job
+func (s *Scheduler) Status() Status {
+	return Status{Lanes: s.Lanes(), Jobs: s.Jobs()}
+}
+
+// Lane trả về thống kê của một lane
+func (s *Scheduler) Lane(kind string) (LaneInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.lanes[kind]
+	if !ok {
+		return LaneInfo{}, false
+	}
+	return l.stats, true
+}
+
+// Lanes trả về thống kê của mọi lane (sắp theo tên)
+func (s *Scheduler) Lanes() []LaneInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]LaneInfo, 0, len(s.lanes))
+	for _, l := range s.lanes {
+		out = append(out, l.stats)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Kind < out[j].Kind })
+	return out
+}
+
+// Jobs trả về các job đang chờ/chạy và các job đã kết thúc gần đây (mới nhất trước)
+func (s *Scheduler) Jobs() []Info {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Info, 0, len(s.active)+len(s.history))
+	for _, j := range s.active {
+		out = append(out, j.info)
+	}
+	out = append(out, s.history...)
+	sort.Slice(out, func(i, j int) bool { return out[i].ID > out[j].ID })
+	return out
+}
+
+// Close ngừng nhận job mới, dừng job định kỳ và chờ các job
+// đã vào hàng đợi chạy xong
+func (s *Scheduler) Close() {
+	s.sendMu.Lock()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		s.sendMu.Unlock()
+		return
+	}
+	s.closed = true
+	for _, l := range s.lanes {
+		if l.queue != nil {
+			close(l.queue)
+		}
+	}
+	s.mu.Unlock()
+	s.sendMu.Unlock()
+
+	close(s.stopCh)
+	s.wg.Wait()
+}
@@ -13,11 +13,15 @@ type batchEntry struct {
 	Key       []byte
 	Value     []byte
 	Tombstone bool
+	UpdatedAt int64  // Gán lúc commit (commitGroup)
+	Seq       uint64 // Gán lúc commit (commitGroup)
+	ExpiresAt int64  // Từ _ttl/_expiresAt của document (stampExpiry), 0 = không hết hạn
 }
 
 // --- SỬA ĐỔI: Đổi tên (nội bộ) ---
 type lsmBatch struct {
-	entries []*batchEntry
+	entries    []*batchEntry
+	durability engine.Durability // DurabilityDefault = theo Options của engine
 }
 
 // NewBatch (Hàm nội bộ)
@@ -49,3 +53,8 @@ func (b *lsmBatch) Delete(key []byte) {
 func (b *lsmBatch) Size() int {
 	return len(b.entries)
 }
+
+// SetDurability triển khai engine.Batch
+func (b *lsmBatch) SetDurability(d engine.Durability) {
+	b.durability = d
+}
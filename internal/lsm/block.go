@@ -0,0 +1,243 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Data block từ SSTVersion 3: key được rút gọn theo tiền tố chung với key
+// đứng trước; cứ blockRestartInterval entry thì có một restart point lưu
+// key đầy đủ, nhờ đó tìm kiếm trong block là tìm nhị phân trên các restart point.
+//
+// Entry:   shared(uvarint) + unshared(uvarint) + valueLen(uvarint) + flag(1) + key[shared:] + value
+// Block:   entry... + restart(4)*n + n(4)
+const blockRestartInterval = 16
+
+// Flag của entry trong data block
+const (
+	entryValue        byte = 0
+	entryTombstone    byte = 1
+	entryValuePointer byte = 2 // Từ SSTVersion 7: value là con trỏ vào value log
+
+	// entryUpdatedAt (bit, từ SSTVersion 9): value bắt đầu bằng thời điểm
+	// commit của lần ghi (Unix nano, 8 byte), xem engine.Item.UpdatedAt
+	entryUpdatedAt byte = 0x80
+	// entrySeq (bit, từ SSTVersion 10): value có seqno của lần ghi (8 byte,
+	// sau thời điểm commit nếu có), xem engine.Item.Seq
+	entrySeq byte = 0x40
+	// entryExpiresAt (bit, từ SSTVersion 12): value có thời điểm hết hạn của
+	// document (8 byte, sau seqno nếu có), xem engine.Item.ExpiresAt
+	entryExpiresAt byte = 0x20
+)
+
+// entryFlag là flag ghi xuống block cho item (chưa gồm entryUpdatedAt/entrySeq/entryExpiresAt)
+func entryFlag(item *engine.Item) byte {
+	switch {
+	case item.Tombstone:
+		return entryTombstone
+	case item.ValuePointer:
+		return entryValuePointer
+	}
+	return entryValue
+}
+
+// entryItem dựng lại item từ value và flag đọc từ block
+func entryItem(value []byte, flag byte) (*engine.Item, error) {
+	var updatedAt int64
+	if flag&entryUpdatedAt != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("entry too short for timestamp: %w", ErrCorruption)
+		}
+		updatedAt, value = int64(binary.LittleEndian.Uint64(value)), value[8:]
+		flag &^= entryUpdatedAt
+	}
+	var seq uint64
+	if flag&entrySeq != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("entry too short for seqno: %w", ErrCorruption)
+		}
+		seq, value = binary.LittleEndian.Uint64(value), value[8:]
+		flag &^= entrySeq
+	}
+	var expiresAt int64
+	if flag&entryExpiresAt != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("entry too short for expiry: %w", ErrCorruption)
+		}
+		expiresAt, value = int64(binary.LittleEndian.Uint64(value)), value[8:]
+		flag &^= entryExpiresAt
+	}
+	return &engine.Item{Value: value, Tombstone: flag == entryTombstone, ValuePointer: flag == entryValuePointer,
+		UpdatedAt: updatedAt, Seq: seq, ExpiresAt: expiresAt}, nil
+}
+
+// blockBuilder gom entry của data block đang ghi (key phải tăng dần)
+type blockBuilder struct {
+	buf      []byte
+	restarts []uint32
+	counter  int // Số entry kể từ restart point gần nhất
+	lastKey  string
+}
+
+// add thêm entry; updatedAt, seq và expiresAt khác 0 được ghi trước value
+// theo thứ tự đó (bit entryUpdatedAt, entrySeq, entryExpiresAt)
+func (b *blockBuilder) add(key string, value []byte, flag byte, updatedAt int64, seq uint64, expiresAt int64) {
+	if b.counter == blockRestartInterval {
+		b.counter = 0
+	}
+	shared := 0
+	if b.counter == 0 {
+		b.restarts = append(b.restarts, uint32(len(b.buf)))
+	} else {
+		shared = sharedPrefixLen(b.lastKey, key)
+	}
+
+	b.buf = binary.AppendUvarint(b.buf, uint64(shared))
+	b.buf = binary.AppendUvarint(b.buf, uint64(len(key)-shared))
+	prefix := 0
+	if updatedAt != 0 {
+		flag |= entryUpdatedAt
+		prefix += 8
+	}
+	if seq != 0 {
+		flag |= entrySeq
+		prefix += 8
+	}
+	if expiresAt != 0 {
+		flag |= entryExpiresAt
+		prefix += 8
+	}
+	b.buf = binary.AppendUvarint(b.buf, uint64(prefix+len(value)))
+	b.buf = append(b.buf, flag)
+	b.buf = append(b.buf, key[shared:]...)
+	if updatedAt != 0 {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(updatedAt))
+	}
+	if seq != 0 {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, seq)
+	}
+	if expiresAt != 0 {
+		b.buf = binary.LittleEndian.AppendUint64(b.buf, uint64(expiresAt))
+	}
+	b.buf = append(b.buf, value...)
+
+	b.lastKey = key
+	b.counter++
+}
+
+// size là kích thước block nếu finish ngay bây giờ
+func (b *blockBuilder) size() int {
+	return len(b.buf) + 4*len(b.restarts) + 4
+}
+
+func (b *blockBuilder) empty() bool {
+	return len(b.restarts) == 0
+}
+
+// finish nối mảng restart vào cuối và trả về block hoàn chỉnh;
+// slice chỉ hợp lệ tới lần reset kế tiếp
+func (b *blockBuilder) finish() []byte {
+	for _, off := range b.restarts {
+		b.buf = binary.LittleEndian.AppendUint32(b.buf, off)
+	}
+	return binary.LittleEndian.AppendUint32(b.buf, uint32(len(b.restarts)))
+}
+
+func (b *blockBuilder) reset() {
+	b.buf = b.buf[:0]
+	b.restarts = b.restarts[:0]
+	b.counter = 0
+	b.lastKey = ""
+}
+
+func sharedPrefixLen(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	i := 0
+	for i < n && a[i] == b[i] {
+		i++
+	}
+	return i
+}
+
+// restartBlock là một data block v3 đã tách phần entry và mảng restart
+type restartBlock struct {
+	data     []byte // Phần entry
+	restarts []byte // n offset, mỗi offset 4 byte
+	n        int
+}
+
+func decodeRestartBlock(block []byte) (restartBlock, error) {
+	if len(block) < 4 {
+		return restartBlock{}, fmt.Errorf("data block too small: %w", ErrCorruption)
+	}
+	n := int(binary.LittleEndian.Uint32(block[len(block)-4:]))
+	if n == 0 || n > (len(block)-4)/4 {
+		return restartBlock{}, fmt.Errorf("bad restart count %d: %w", n, ErrCorruption)
+	}
+	start := len(block) - 4 - 4*n
+	return restartBlock{data: block[:start], restarts: block[start : len(block)-4], n: n}, nil
+}
+
+func (b restartBlock) restart(i int) int {
+	return int(binary.LittleEndian.Uint32(b.restarts[4*i:]))
+}
+
+// entry giải mã entry tại off; prev là key của entry đứng trước (nil tại
+// restart point). value trỏ vào block, caller phải sao chép nếu giữ lại.
+func (b restartBlock) entry(off int, prev []byte) (key, value []byte, flag byte, next int, err error) {
+	var lens [3]uint64
+	pos := off
+	for i := range lens {
+		if pos >= len(b.data) {
+			return nil, nil, 0, 0, fmt.Errorf("truncated block entry: %w", ErrCorruption)
+		}
+		v, n := binary.Uvarint(b.data[pos:])
+		if n <= 0 {
+			return nil, nil, 0, 0, fmt.Errorf("bad block entry header: %w", ErrCorruption)
+		}
+		lens[i] = v
+		pos += n
+	}
+	shared, unshared, vlen := lens[0], lens[1], lens[2]
+	rest := uint64(len(b.data) - pos)
+	// So từng độ dài với rest trước khi cộng để varint hỏng không làm tràn số
+	if shared > uint64(len(prev)) || unshared > rest || vlen > rest || 1+unshared+vlen > rest {
+		return nil, nil, 0, 0, fmt.Errorf("bad block entry lengths: %w", ErrCorruption)
+	}
+	flag = b.data[pos]
+	pos++
+
+	key = make([]byte, shared+unshared)
+	copy(key, prev[:shared])
+	copy(key[shared:], b.data[pos:pos+int(unshared)])
+	pos += int(unshared)
+	value = b.data[pos : pos+int(vlen)]
+	return key, value, flag, pos + int(vlen), nil
+}
+
+// seekRestart trả về offset của restart point cuối cùng có key <= target,
+// nơi bắt đầu quét tuần tự để tìm target (tối đa blockRestartInterval entry)
+func (b restartBlock) seekRestart(target string) (int, error) {
+	var decodeErr error
+	i := sort.Search(b.n, func(i int) bool {
+		k, _, _, _, err := b.entry(b.restart(i), nil)
+		if err != nil {
+			decodeErr = err
+			return true
+		}
+		return string(k) > target
+	})
+	if decodeErr != nil {
+		return 0, decodeErr
+	}
+	if i > 0 {
+		i--
+	}
+	return b.restart(i), nil
+}
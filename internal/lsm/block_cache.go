@@ -0,0 +1,125 @@
+package lsm
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBlockCacheBytes là dung lượng mặc định của block cache
+const DefaultBlockCacheBytes = 8 * 1024 * 1024 // 8MB
+
+// blockCacheKey xác định một block theo (tệp, offset). Tên tệp SSTable không
+// bao giờ được dùng lại (seq tăng dần) và tệp bất biến nên không cần invalidation
+// khi ghi; tệp bị compaction xóa thì dropFile bỏ các block của nó.
+type blockCacheKey struct {
+	path   string
+	offset int64
+}
+
+type blockCacheEntry struct {
+	key   blockCacheKey
+	value []byte // Data block đã giải nén
+	size  int64
+}
+
+// blockCache là LRU giới hạn theo byte, dùng chung cho mọi lần Get.
+// Iterator (scan, compaction) không đi qua cache để không đẩy các block nóng ra ngoài.
+type blockCache struct {
+	mu       sync.Mutex
+	capacity int64
+	used     int64
+	ll       *list.List // Đầu danh sách = dùng gần nhất
+	items    map[blockCacheKey]*list.Element
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// newBlockCache trả về nil khi capacity <= 0 (tắt cache); mọi method chấp nhận nil
+func newBlockCache(capacity int64) *blockCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &blockCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[blockCacheKey]*list.Element),
+	}
+}
+
+func (c *blockCache) get(path string, offset int64) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	el, ok := c.items[blockCacheKey{path, offset}]
+	if ok {
+		c.ll.MoveToFront(el)
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return el.Value.(*blockCacheEntry).value, true
+}
+
+// add thêm block vào cache; block lớn hơn cả cache thì bỏ qua
+func (c *blockCache) add(path string, offset int64, value []byte) {
+	size := int64(len(value))
+	if c == nil || size > c.capacity {
+		return
+	}
+	key := blockCacheKey{path, offset}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		// Hai lần Get đồng thời cùng đọc block: giữ bản đã có
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.ll.PushFront(&blockCacheEntry{key: key, value: value, size: size})
+	c.used += size
+	for c.used > c.capacity {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// dropFile bỏ mọi block của một tệp (gọi sau khi tệp bị xóa)
+func (c *blockCache) dropFile(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.ll.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*blockCacheEntry).key.path == path {
+			c.removeElement(el)
+		}
+		el = next
+	}
+}
+
+func (c *blockCache) removeElement(el *list.Element) {
+	entry := c.ll.Remove(el).(*blockCacheEntry)
+	delete(c.items, entry.key)
+	c.used -= entry.size
+}
+
+func (c *blockCache) export(m map[string]int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	m["block_cache_bytes"] = c.used
+	m["block_cache_entries"] = int64(len(c.items))
+	c.mu.Unlock()
+	m["block_cache_capacity_bytes"] = c.capacity
+	m["block_cache_hits"] = c.hits.Load()
+	m["block_cache_misses"] = c.misses.Load()
+}
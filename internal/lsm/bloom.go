@@ -3,16 +3,45 @@ package lsm
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
 )
 
+// DefaultBloomBitsPerKey: ~1% dương tính giả với bloom dạng block
+const DefaultBloomBitsPerKey = 10
+
+// bloomBlockBits: mỗi key chỉ đặt/kiểm tra bit trong một block 512 bit
+// (= một cache line 64 byte) nên mỗi lần kiểm tra chỉ chạm một cache line
+const bloomBlockBits = 512
+
+// maxBloomHashes: giới hạn k khi tạo và khi đọc từ footer
+const maxBloomHashes = 30
+
+// BloomPolicy cấu hình bloom filter của SSTable mới ghi (xem Options.BloomLevels)
+type BloomPolicy struct {
+	BitsPerKey int // 0 = DefaultBloomBitsPerKey, < 0 = không ghi bloom filter
+	Hashes     int // Số hàm hash; 0 = tối ưu theo BitsPerKey (BitsPerKey * ln2)
+}
+
+// enabled: policy có ghi bloom filter
+func (p BloomPolicy) enabled() bool {
+	return p.BitsPerKey >= 0
+}
+
 // BloomFilter được tối ưu hóa sử dụng bitset (slice of bytes)
 type BloomFilter struct {
 	bits []byte
 	k    int    // Số lượng hàm hash
 	n    uint32 // Số lượng bit
+
+	// blocked: định dạng từ SSTVersion 4 (xxhash, double hashing trong block);
+	// false: định dạng cũ (FNV với tiền tố i, mỗi probe một hash riêng)
+	blocked bool
 }
 
-// NewBloomFilter tạo một bloom filter với n bits và k hàm hash
+// NewBloomFilter tạo một bloom filter (định dạng cũ) với n bits và k hàm hash
 func NewBloomFilter(numBits uint32, numHashes int) *BloomFilter {
 	if numBits == 0 {
 		numBits = 1 // Tránh lỗi chia cho 0
@@ -26,7 +55,35 @@ func NewBloomFilter(numBits uint32, numHashes int) *BloomFilter {
 	}
 }
 
-// hash tính toán giá trị hash thứ i cho key
+// newBlockedBloomFilter tạo bloom dạng block cho numKeys key theo policy;
+// số hàm hash mặc định (tối ưu) là bitsPerKey * ln2
+func newBlockedBloomFilter(numKeys uint32, policy BloomPolicy) *BloomFilter {
+	bitsPerKey := policy.BitsPerKey
+	if bitsPerKey <= 0 {
+		bitsPerKey = DefaultBloomBitsPerKey
+	}
+	blocks := (uint64(numKeys)*uint64(bitsPerKey) + bloomBlockBits - 1) / bloomBlockBits
+	if blocks == 0 {
+		blocks = 1
+	}
+	k := policy.Hashes
+	if k <= 0 {
+		k = int(math.Round(float64(bitsPerKey) * math.Ln2))
+	}
+	if k < 1 {
+		k = 1
+	} else if k > maxBloomHashes {
+		k = maxBloomHashes
+	}
+	return &BloomFilter{
+		bits:    make([]byte, blocks*bloomBlockBits/8),
+		k:       k,
+		n:       uint32(blocks * bloomBlockBits),
+		blocked: true,
+	}
+}
+
+// hash tính toán giá trị hash thứ i cho key (định dạng cũ)
 func (bf *BloomFilter) hash(i int, key string) uint32 {
 	h := fnv.New32a()
 	h.Write([]byte(fmt.Sprintf("%d%s", i, key)))
@@ -34,8 +91,37 @@ func (bf *BloomFilter) hash(i int, key string) uint32 {
 	return h.Sum32() % bf.n
 }
 
+// noBloomFilter: SSTable ghi với bloom tắt (footer n = 0, k = 0, không có dữ liệu);
+// MightContain luôn trả về true
+var noBloomFilter = &BloomFilter{blocked: true}
+
+// disabled: tệp không có bloom filter (xem noBloomFilter)
+func (bf *BloomFilter) disabled() bool {
+	return bf.n == 0
+}
+
+// bloomHash là hash của key cho bloom dạng block
+func bloomHash(key string) uint64 {
+	return xxhash.Sum64String(key)
+}
+
+// blockProbe trả về bit đầu của block chứa key (hash h = bloomHash(key)) và
+// hai hash cho double hashing (probe i = h1 + i*h2 trong block). Một lần
+// xxhash cho mọi probe, không cấp phát.
+func (bf *BloomFilter) blockProbe(h uint64) (base, h1, h2 uint32) {
+	blocks := uint64(bf.n / bloomBlockBits)
+	base = uint32((h>>32)*blocks>>32) * bloomBlockBits // Chia đều theo 32 bit cao, không dùng %
+	h1 = uint32(h)
+	h2 = h1>>17 | h1<<15
+	return base, h1, h2
+}
+
 // Add thêm một key vào bộ lọc
 func (bf *BloomFilter) Add(key string) {
+	if bf.blocked {
+		bf.addHash(bloomHash(key))
+		return
+	}
 	for i := 0; i < bf.k; i++ {
 		pos := bf.hash(i, key)
 		// Đặt bit tại vị trí pos
@@ -43,8 +129,32 @@ func (bf *BloomFilter) Add(key string) {
 	}
 }
 
+// addHash thêm key đã hash sẵn (bloomHash) vào bloom dạng block
+func (bf *BloomFilter) addHash(h uint64) {
+	base, h1, h2 := bf.blockProbe(h)
+	for i := 0; i < bf.k; i++ {
+		pos := base + h1%bloomBlockBits
+		bf.bits[pos/8] |= 1 << (pos % 8)
+		h1 += h2
+	}
+}
+
 // MightContain kiểm tra xem key có thể có trong bộ lọc hay không
 func (bf *BloomFilter) MightContain(key string) bool {
+	if bf.disabled() {
+		return true
+	}
+	if bf.blocked {
+		base, h1, h2 := bf.blockProbe(bloomHash(key))
+		for i := 0; i < bf.k; i++ {
+			pos := base + h1%bloomBlockBits
+			if bf.bits[pos/8]&(1<<(pos%8)) == 0 {
+				return false
+			}
+			h1 += h2
+		}
+		return true
+	}
 	for i := 0; i < bf.k; i++ {
 		pos := bf.hash(i, key)
 		// Kiểm tra xem bit tại vị trí pos có được đặt hay không
@@ -60,7 +170,7 @@ func (bf *BloomFilter) ToBytes() []byte {
 	return bf.bits
 }
 
-// NewFromBytes tạo lại một BloomFilter từ dữ liệu thô và các tham số
+// NewFromBytes tạo lại một BloomFilter (định dạng cũ) từ dữ liệu thô và các tham số
 func NewFromBytes(data []byte, numBits uint32, numHashes int) *BloomFilter {
 	return &BloomFilter{
 		bits: data,
@@ -68,3 +178,41 @@ func NewFromBytes(data []byte, numBits uint32, numHashes int) *BloomFilter {
 		n:    numBits,
 	}
 }
+
+// bloomFromBytes nạp bloom của một SSTable theo định dạng của tệp;
+// tham số không khớp dữ liệu (footer hỏng) trả về ErrCorruption
+func bloomFromBytes(format *sstFormat, data []byte, numBits uint64, numHashes uint32) (*BloomFilter, error) {
+	if numBits == 0 && numHashes == 0 && len(data) == 0 && format.blockedBloom {
+		return noBloomFilter, nil
+	}
+	if numBits == 0 || numBits > uint64(len(data))*8 || (format.blockedBloom && numBits%bloomBlockBits != 0) {
+		return nil, fmt.Errorf("bad bloom filter size %d bits: %w", numBits, ErrCorruption)
+	}
+	if numHashes > maxBloomHashes {
+		return nil, fmt.Errorf("bad bloom hash count %d: %w", numHashes, ErrCorruption)
+	}
+	bf := NewFromBytes(data, uint32(numBits), int(numHashes))
+	bf.blocked = format.blockedBloom
+	return bf, nil
+}
+
+// bloomStats đo hiệu quả bloom của Get: dương tính giả là khi bloom báo
+// "có thể có" nhưng tệp không chứa key (đã tốn một lần đọc block)
+type bloomStats struct {
+	checks         atomic.Int64
+	negatives      atomic.Int64
+	falsePositives atomic.Int64
+}
+
+func (bs *bloomStats) export(m map[string]int64) {
+	negatives, fp := bs.negatives.Load(), bs.falsePositives.Load()
+	m["bloom_checks"] = bs.checks.Load()
+	m["bloom_negatives"] = negatives
+	m["bloom_false_positives"] = fp
+	// Tỉ lệ dương tính giả đo được (phần triệu) trên các lần tra key không có trong tệp
+	if negatives+fp > 0 {
+		m["bloom_false_positive_ppm"] = fp * 1_000_000 / (negatives + fp)
+	} else {
+		m["bloom_false_positive_ppm"] = 0
+	}
+}
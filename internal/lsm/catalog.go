@@ -0,0 +1,257 @@
+package lsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+const catalogFileName = "CATALOG"
+
+// dumpMetaKey là key chứa metadata trong tệp dump (dumpDB/exportMeta).
+// Tiền tố hệ thống đảm bảo không trùng với tên collection.
+const dumpMetaKey = engine.SystemKeyPrefix + "meta"
+
+const dumpMetaVersion = 1
+
+// IndexDef mô tả một secondary index trên field của collection.
+// Với compound index, Field là danh sách field nối bởi dấu phẩy.
+type IndexDef struct {
+	Collection string           `json:"collection"`
+	Field      string           `json:"field"`
+	Collation  *query.Collation `json:"collation,omitempty"`
+	Unique     bool             `json:"unique,omitempty"`
+	Multikey   bool             `json:"multikey,omitempty"` // Đã từng index một giá trị mảng
+}
+
+// fields trả về các field của index (nhiều hơn một với compound index)
+func (d *IndexDef) fields() []string {
+	return engine.IndexFields(d.Field)
+}
+
+func (d *IndexDef) compound() bool {
+	return strings.Contains(d.Field, ",")
+}
+
+// TextIndexDef mô tả text index (toàn văn) của một collection
+type TextIndexDef struct {
+	Collection string   `json:"collection"`
+	Fields     []string `json:"fields"`
+}
+
+// CoercionRule: khi đọc, giá trị của Field được ép sang Type
+// (xem query.Coercions)
+type CoercionRule struct {
+	Collection string `json:"collection"`
+	Field      string `json:"field"`
+	Type       string `json:"type"`
+}
+
+// Catalog lưu các định nghĩa (metadata) ở cấp CSDL,
+// tách biệt khỏi MANIFEST (vốn chỉ mô tả các tệp SSTable)
+type Catalog struct {
+	Indexes     []*IndexDef        `json:"indexes"`
+	TextIndexes []*TextIndexDef    `json:"textIndexes,omitempty"`
+	Coercions   []*CoercionRule    `json:"coercions,omitempty"`
+	References  []engine.Reference `json:"references,omitempty"`
+}
+
+// NewCatalog tạo một Catalog rỗng
+func NewCatalog() *Catalog {
+	return &Catalog{
+		Indexes: make([]*IndexDef, 0),
+	}
+}
+
+// indexesFor trả về các index của một collection
+func (c *Catalog) indexesFor(collection string) []*IndexDef {
+	out := make([]*IndexDef, 0)
+	for _, idx := range c.Indexes {
+		if idx.Collection == collection {
+			out = append(out, idx)
+		}
+	}
+	return out
+}
+
+// findIndex tìm index theo collection + field
+func (c *Catalog) findIndex(collection, field string) *IndexDef {
+	for _, idx := range c.Indexes {
+		if idx.Collection == collection && idx.Field == field {
+			return idx
+		}
+	}
+	return nil
+}
+
+// findTextIndex tìm text index của collection
+func (c *Catalog) findTextIndex(collection string) *TextIndexDef {
+	for _, def := range c.TextIndexes {
+		if def.Collection == collection {
+			return def
+		}
+	}
+	return nil
+}
+
+// loadCatalog đọc tệp CATALOG (nếu có)
+func loadCatalog(dir string) (*Catalog, error) {
+	path := filepath.Join(dir, catalogFileName)
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewCatalog(), nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	c := NewCatalog()
+	if err := json.NewDecoder(f).Decode(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// saveCatalog ghi đè tệp CATALOG (atomic rename như MANIFEST).
+// Caller phải giữ e.catalogMu.
+func (e *LSMEngine) saveCatalog() error {
+	tempPath := filepath.Join(e.dir, catalogFileName+".tmp")
+	f, err := os.Create(tempPath)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(e.catalog); err != nil {
+		f.Close()
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, filepath.Join(e.dir, catalogFileName))
+}
+
+// dumpMeta là phần cấu hình của CSDL được kèm theo khi dump,
+// để restore khôi phục cả định nghĩa chứ không chỉ document
+type dumpMeta struct {
+	Version     int                `json:"version"`
+	Indexes     []*IndexDef        `json:"indexes"`
+	TextIndexes []*TextIndexDef    `json:"textIndexes,omitempty"`
+	Coercions   []*CoercionRule    `json:"coercions,omitempty"`
+	References  []engine.Reference `json:"references,omitempty"`
+	// App: giá trị các key dưới engine.AppKeyPrefix (tên không kèm tiền tố)
+	App map[string]json.RawMessage `json:"app,omitempty"`
+}
+
+func (e *LSMEngine) snapshotMeta() (*dumpMeta, error) {
+	app, err := e.appMeta()
+	if err != nil {
+		return nil, err
+	}
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	m := &dumpMeta{Version: dumpMetaVersion, Indexes: make([]*IndexDef, 0, len(e.catalog.Indexes))}
+	for _, def := range e.catalog.Indexes {
+		d := *def
+		m.Indexes = append(m.Indexes, &d)
+	}
+	for _, def := range e.catalog.TextIndexes {
+		d := TextIndexDef{Collection: def.Collection, Fields: append([]string(nil), def.Fields...)}
+		m.TextIndexes = append(m.TextIndexes, &d)
+	}
+	for _, rule := range e.catalog.Coercions {
+		r := *rule
+		m.Coercions = append(m.Coercions, &r)
+	}
+	m.References = append(m.References, e.catalog.References...)
+	m.App = app
+	return m, nil
+}
+
+// appMeta đọc các key dưới engine.AppKeyPrefix (bỏ qua giá trị không phải JSON)
+func (e *LSMEngine) appMeta() (map[string]json.RawMessage, error) {
+	it, err := e.newRangeIterator(engine.AppKeyPrefix, prefixEnd(engine.AppKeyPrefix))
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	var out map[string]json.RawMessage
+	for it.Next() {
+		if v := it.Value().Value; json.Valid(v) {
+			if out == nil {
+				out = make(map[string]json.RawMessage)
+			}
+			out[strings.TrimPrefix(it.Key(), engine.AppKeyPrefix)] = append(json.RawMessage(nil), v...)
+		}
+	}
+	return out, it.Error()
+}
+
+// restoreMeta tạo lại các định nghĩa trong metadata (bỏ qua cái đã có)
+func (e *LSMEngine) restoreMeta(raw json.RawMessage) error {
+	var m dumpMeta
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return fmt.Errorf("decode %s: %w", dumpMetaKey, err)
+	}
+	if m.Version > dumpMetaVersion {
+		return fmt.Errorf("unsupported %s version %d", dumpMetaKey, m.Version)
+	}
+	for _, def := range m.Indexes {
+		if err := e.CreateIndex(def.Collection, def.Field, engine.IndexOptions{Collation: def.Collation, Unique: def.Unique}); err != nil {
+			return fmt.Errorf("restore index %s.%s: %w", def.Collection, def.Field, err)
+		}
+	}
+	for _, def := range m.TextIndexes {
+		if err := e.CreateTextIndex(def.Collection, def.Fields); err != nil {
+			return fmt.Errorf("restore text index %s: %w", def.Collection, err)
+		}
+	}
+	for _, rule := range m.Coercions {
+		if err := e.SetCoercion(rule.Collection, rule.Field, rule.Type); err != nil {
+			return fmt.Errorf("restore coercion %s.%s: %w", rule.Collection, rule.Field, err)
+		}
+	}
+	for _, ref := range m.References {
+		if err := e.SetReference(ref); err != nil {
+			return fmt.Errorf("restore reference %s.%s: %w", ref.Collection, ref.Field, err)
+		}
+	}
+	for name, v := range m.App {
+		if err := e.Put([]byte(engine.AppKeyPrefix+name), v); err != nil {
+			return fmt.Errorf("restore %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ExportMeta chỉ ghi metadata (không có document) ra tệp.
+// Tệp này có thể nạp lại bằng RestoreDB.
+func (e *LSMEngine) ExportMeta(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	meta, err := e.snapshotMeta()
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]interface{}{dumpMetaKey: meta})
+}
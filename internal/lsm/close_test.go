@@ -0,0 +1,55 @@
+package lsm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Close chạy cùng lúc với các lần ghi và job wal_sync (chạy với go test -race)
+func TestCloseConcurrentWithWrites(t *testing.T) {
+	db, err := OpenLSMWithConfig(t.TempDir(), 50, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := db.(*LSMEngine)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Lỗi (hàng đợi flush đầy, CSDL đang đóng) là bình thường ở đây
+				db.Put([]byte(fmt.Sprintf("w%d:%06d", w, i)), []byte("v"))
+			}
+		}(w)
+	}
+	// Gọi thẳng job fsync nền thay vì chờ walSyncInterval
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			e.syncWAL()
+		}
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+}
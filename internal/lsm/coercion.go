@@ -0,0 +1,53 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// SetCoercion đặt (hoặc xóa, nếu typ rỗng) quy tắc ép kiểu cho collection.field
+func (e *LSMEngine) SetCoercion(collection, field, typ string) error {
+	if collection == "" || field == "" {
+		return errors.New("collection and field are required")
+	}
+	if typ != "" && !query.ValidCoercionType(typ) {
+		return fmt.Errorf("unknown coercion type %q (use number, string, bool or date)", typ)
+	}
+
+	e.catalogMu.Lock()
+	defer e.catalogMu.Unlock()
+
+	prev := e.catalog.Coercions
+	rules := make([]*CoercionRule, 0, len(prev)+1)
+	for _, r := range prev {
+		if r.Collection != collection || r.Field != field {
+			rules = append(rules, r)
+		}
+	}
+	if typ != "" {
+		rules = append(rules, &CoercionRule{Collection: collection, Field: field, Type: typ})
+	}
+
+	e.catalog.Coercions = rules
+	if err := e.saveCatalog(); err != nil {
+		e.catalog.Coercions = prev
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// Coercions trả về các quy tắc ép kiểu (field -> kiểu) của collection
+func (e *LSMEngine) Coercions(collection string) map[string]string {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	out := make(map[string]string)
+	for _, r := range e.catalog.Coercions {
+		if r.Collection == collection {
+			out[r.Field] = r.Type
+		}
+	}
+	return out
+}
@@ -1,111 +1,168 @@
 package lsm
 
 import (
-	"fmt"
 	"log/slog"
-	"os"
-	"path/filepath"
-	"runtime"
+	"time"
 
 	"github.com/nconghau/MiniDBGo/internal/engine"
 )
 
-// runCompaction thực hiện logic nén L0 -> L1
-func (e *LSMEngine) runL0Compaction(l0Files []*FileMetadata) error {
-	// (e.mu.RLock() đã bị comment, đúng rồi)
+// compactionPick là compaction mà pickAndRunCompaction sẽ chạy: inputs ở
+// level, overlaps là các tệp chồng lấn ở level+1 (được nén lại cùng để
+// level+1 vẫn không chồng lấn; Get chỉ đọc một tệp mỗi level từ L1 trở đi).
+// output là level nhận kết quả: level+1, hoặc 0 khi gộp các tệp L0 nhỏ.
+type compactionPick struct {
+	level    int
+	output   int
+	reason   string
+	inputs   []*FileMetadata
+	overlaps []*FileMetadata
+}
 
-	if len(l0Files) == 0 {
-		return nil // Không có gì để nén
+// pickCompaction chọn compaction tiếp theo (nil nếu chưa cần nén).
+// Trước khi chạy compaction, gọi khi giữ compactMu để các level không đổi.
+func (e *LSMEngine) pickCompaction() *compactionPick {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	// --- Quyết định 1: Ưu tiên L0 ---
+	if l0Files := e.current.Levels[0]; len(l0Files) >= L0CompactionTrigger {
+		return &compactionPick{
+			level:    0,
+			output:   1,
+			reason:   "l0_file_count",
+			inputs:   l0Files,
+			overlaps: overlappingFiles(e.current.Levels[1], l0Files),
+		}
 	}
 
-	slog.Info("Starting L0->L1 compaction | runL0Compaction", "files", len(l0Files))
-
-	// 1. Tạo MergingIterator cho TẤT CẢ các tệp L0
-	iters := make([]engine.Iterator, 0, len(l0Files))
-	for _, meta := range l0Files {
-		it, err := NewSSTableIterator(meta.Path)
-		if err != nil {
-			for _, it := range iters {
-				it.Close()
-			}
-			return fmt.Errorf("create compaction iterator: %w", err)
+	// --- Quyết định 2: Kiểm tra L1 ---
+	var l1Size int64
+	for _, f := range e.current.Levels[1] {
+		l1Size += f.FileSize
+	}
+	if l1Size > L1CompactionTriggerBytes {
+		// Chiến lược đơn giản: chọn file L1 cũ nhất
+		l1Files := e.current.Levels[1][:1]
+		return &compactionPick{
+			level:    1,
+			output:   2,
+			reason:   "l1_size",
+			inputs:   l1Files,
+			overlaps: overlappingFiles(e.current.Levels[2], l1Files),
 		}
-		iters = append(iters, it)
 	}
-	mergedIter := NewMergingIterator(iters)
-	defer mergedIter.Close()
-
-	estimatedKeys := calculateTotalKeys(l0Files)
-
-	// 2. Tạo SSTable L1 mới
-	e.mu.Lock()
-	seq := e.seq
-	e.seq++
-	e.mu.Unlock()
 
-	path := filepath.Join(e.sstDir, fmt.Sprintf("sst-L1-%06d.sst", seq))
-	writer, err := NewSSTWriter(path, estimatedKeys)
-	if err != nil {
-		return err
+	// --- Quyết định 3: Gộp các tệp L0 nhỏ liền kề (tận dụng lúc rảnh) ---
+	if run := tinyL0Run(e.current.Levels[0], e.opts.L0MergeFileBytes); run != nil {
+		return &compactionPick{level: 0, output: 0, reason: "l0_tiny_files", inputs: run}
 	}
+	return nil
+}
 
-	// 3. Stream từ iterator (L0) sang writer (L1)
-	hasEntries := false
+// keyRange trả về khoảng key chung của các tệp (files không rỗng)
+func keyRange(files []*FileMetadata) (minKey, maxKey string) {
+	minKey, maxKey = files[0].MinKey, files[0].MaxKey
+	for _, f := range files[1:] {
+		minKey, maxKey = min(minKey, f.MinKey), max(maxKey, f.MaxKey)
+	}
+	return minKey, maxKey
+}
 
-	// --- BẮT ĐẦU MÃ TỐI ƯU ---
-	keysWritten := 0
-	const throttleAfterKeys = 1000 // Nhường CPU sau mỗi 1000 key
-	// --- KẾT THÚC MÃ TỐI ƯU ---
+// overlappingFiles trả về các tệp trong level chồng lấn khoảng key của inputs
+func overlappingFiles(level, inputs []*FileMetadata) []*FileMetadata {
+	if len(inputs) == 0 {
+		return nil
+	}
+	minKey, maxKey := keyRange(inputs)
+	var overlaps []*FileMetadata
+	for _, f := range level {
+		if f.MaxKey >= minKey && f.MinKey <= maxKey {
+			overlaps = append(overlaps, f)
+		}
+	}
+	return overlaps
+}
 
-	for mergedIter.Next() {
-		// MergingIterator đã xử lý tombstones và de-dup
-		if err := writer.WriteEntry(mergedIter.Key(), mergedIter.Value()); err != nil {
-			writer.Close()
-			os.Remove(path)
-			return err
+// filesBelow trả về mọi tệp ở các level sâu hơn level
+func (e *LSMEngine) filesBelow(level int) []*FileMetadata {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var below []*FileMetadata
+	for l, files := range e.current.Levels {
+		if l > level {
+			below = append(below, files...)
 		}
-		hasEntries = true
+	}
+	return below
+}
 
-		// --- BẮT ĐẦU MÃ TỐI ƯU ---
-		keysWritten++
-		if keysWritten%throttleAfterKeys == 0 {
-			// Yêu cầu Go scheduler chạy các goroutine khác
-			// (ví dụ: API handler đang chờ)
-			runtime.Gosched()
+// newCompactionIterator hợp nhất iters (mới -> cũ) cho compaction ghi xuống
+// outputLevel. Tombstone chỉ được bỏ khi không tệp nào ở level sâu hơn có thể
+// chứa key; nếu không, bỏ tombstone sẽ làm giá trị cũ bên dưới "sống lại".
+// Entry nằm trong một range tombstone của rts bị bỏ hẳn; document đã hết hạn
+// (TTL) được xử lý như tombstone.
+func (e *LSMEngine) newCompactionIterator(iters []engine.Iterator, outputLevel int, rts rangeTombstones) engine.Iterator {
+	below := e.filesBelow(outputLevel)
+	it := NewMergingIterator(iters)
+	mi, ok := it.(*MergingIterator)
+	if ok {
+		mi.ranges = rts
+		mi.now, mi.expiredCount = time.Now().UnixNano(), &e.ttl.compacted
+	}
+	if ok && outputLevel == 0 {
+		// Gộp trong L0: tệp L0 cũ hơn inputs vẫn có thể chứa key
+		mi.keepTombstone = func(string) bool { return true }
+	} else if ok && len(below) > 0 {
+		mi.keepTombstone = func(key string) bool {
+			for _, f := range below {
+				if key >= f.MinKey && key <= f.MaxKey {
+					return true
+				}
+			}
+			return false
 		}
-		// --- KẾT THÚC MÃ TỐI ƯU ---
 	}
-	if err := mergedIter.Error(); err != nil {
-		writer.Close()
-		os.Remove(path)
-		return err
+	return it
+}
+
+// runL0Compaction nén mọi tệp L0 cùng các tệp L1 chồng lấn (l1Files) xuống L1
+func (e *LSMEngine) runL0Compaction(l0Files, l1Files []*FileMetadata) error {
+	// (e.mu.RLock() đã bị comment, đúng rồi)
+
+	if len(l0Files) == 0 {
+		return nil // Không có gì để nén
 	}
-	if err := writer.Close(); err != nil {
-		os.Remove(path)
-		return err
+
+	slog.Info("Starting L0->L1 compaction | runL0Compaction", "files", len(l0Files), "l1_overlap_count", len(l1Files))
+
+	// 1. Tạo MergingIterator cho TẤT CẢ các tệp L0, rồi các tệp L1 chồng lấn
+	// (Mới -> Cũ, để MergingIterator giữ phiên bản mới nhất của mỗi key)
+	inputs := make([]*FileMetadata, 0, len(l0Files)+len(l1Files))
+	for i := len(l0Files) - 1; i >= 0; i-- {
+		inputs = append(inputs, l0Files[i])
 	}
+	inputs = append(inputs, l1Files...)
+	rts, since := e.rangeTombstonesForJob()
 
-	var newL1Meta *FileMetadata
-	if hasEntries {
-		meta := writer.GetMetadata()
-		newL1Meta = &FileMetadata{
-			Level:    1, // Cấp L1
-			Path:     path,
-			MinKey:   meta.MinKey,
-			MaxKey:   meta.MaxKey,
-			FileSize: meta.FileSize,
-			KeyCount: meta.KeyCount,
-		}
+	// 2-3. Stream từ iterator (L0+L1) sang output L1 (chia thành nhiều tệp
+	// theo TargetFileSize, các khoảng key chạy song song: runSubcompactions)
+	newL1Files, err := e.runSubcompactions(inputs, 1, rts)
+	if err != nil {
+		return err
 	}
 
 	// 4. Cập nhật MANIFEST (atomic)
 	e.mu.Lock()
-	// Xóa tệp L0 cũ
+	// Xóa tệp L0 và L1 cũ
 	e.current.DeleteFiles(0, l0Files)
-	// Thêm tệp L1 mới (nếu có)
-	if newL1Meta != nil {
-		e.current.AddFile(newL1Meta)
+	e.current.DeleteFiles(1, l1Files)
+	// Thêm các tệp L1 mới (nếu có)
+	for _, meta := range newL1Files {
+		e.current.AddFile(meta)
 	}
+	e.current.trackRangeTombstones(since, newL1Files)
+	e.gcRangeTombstones()
 	// Lưu trạng thái mới
 	if err := e.saveManifest(); err != nil {
 		e.mu.Unlock()
@@ -114,10 +171,10 @@ func (e *LSMEngine) runL0Compaction(l0Files []*FileMetadata) error {
 	}
 	e.mu.Unlock()
 
-	// 5. Xóa các tệp L0 cũ (sau khi MANIFEST đã an toàn)
-	for _, meta := range l0Files {
-		if err := os.Remove(meta.Path); err != nil {
-			slog.Warn("Failed to delete old L0 file after compaction", "path", meta.Path, "error", err)
+	// 5. Xóa các tệp input cũ (sau khi MANIFEST đã an toàn)
+	for _, meta := range inputs {
+		if err := e.removeTableFile(meta.Path); err != nil {
+			slog.Warn("Failed to delete old file after L0 compaction", "path", meta.Path, "level", meta.Level, "error", err)
 		}
 	}
 
@@ -125,125 +182,37 @@ func (e *LSMEngine) runL0Compaction(l0Files []*FileMetadata) error {
 	return nil
 }
 
+// runL1Compaction nén các tệp L1 đã chọn cùng các tệp L2 chồng lấn (l2Files) xuống L2
 func (e *LSMEngine) runL1Compaction(l1Files, l2Files []*FileMetadata) error {
 	if len(l1Files) == 0 {
 		return nil // Không có gì để nén
 	}
-
-	// 1. Chọn file L1 (chiến lược đơn giản: chọn file cũ nhất)
-	l1FileToCompact := l1Files[0]
-	filesToCompactL1 := []*FileMetadata{l1FileToCompact}
-
-	minKey := l1FileToCompact.MinKey
-	maxKey := l1FileToCompact.MaxKey
-
-	// 2. Tìm các file L2 bị chồng lấn (overlap)
-	filesToCompactL2 := make([]*FileMetadata, 0)
-	for _, f := range l2Files {
-		if f.MaxKey >= minKey && f.MinKey <= maxKey {
-			filesToCompactL2 = append(filesToCompactL2, f)
-		}
-	}
+	filesToCompactL1, filesToCompactL2 := l1Files, l2Files
 
 	slog.Debug("L1->L2 Compaction",
-		"l1_file", l1FileToCompact.Path,
+		"l1_file", filesToCompactL1[0].Path,
 		"l2_overlap_count", len(filesToCompactL2))
 
-	// 3. Tạo MergingIterator
-	iters := make([]engine.Iterator, 0, len(filesToCompactL1)+len(filesToCompactL2))
-
-	// Thêm 1 file L1
-	it, err := NewSSTableIterator(l1FileToCompact.Path)
-	if err != nil {
-		return fmt.Errorf("create L1 iterator: %w", err)
-	}
-	iters = append(iters, it)
-
-	// Thêm các file L2 chồng lấn
-	for _, meta := range filesToCompactL2 {
-		it, err := NewSSTableIterator(meta.Path)
-		if err != nil {
-			for _, it := range iters {
-				it.Close()
-			}
-			return fmt.Errorf("create L2 iterator: %w", err)
-		}
-		iters = append(iters, it)
-	}
-
-	mergedIter := NewMergingIterator(iters)
-	defer mergedIter.Close()
-
-	estimatedKeys := calculateTotalKeys(filesToCompactL1, filesToCompactL2)
-
-	// 4. Tạo file SSTable L2 mới
-	e.mu.Lock()
-	seq := e.seq
-	e.seq++
-	e.mu.Unlock()
-
-	path := filepath.Join(e.sstDir, fmt.Sprintf("sst-L2-%06d.sst", seq))
-	writer, err := NewSSTWriter(path, estimatedKeys)
+	// 3-5. Stream từ các file L1 (mới hơn) và L2 sang output L2 (xem runSubcompactions)
+	inputs := append(append([]*FileMetadata(nil), filesToCompactL1...), filesToCompactL2...)
+	rts, since := e.rangeTombstonesForJob()
+	newL2Files, err := e.runSubcompactions(inputs, 2, rts)
 	if err != nil {
 		return err
 	}
 
-	// 5. Stream từ iterator (L1+L2) sang writer (L2 mới)
-	hasEntries := false
-
-	// --- BẮT ĐẦU MÃ TỐI ƯU (Thêm vào L1) ---
-	keysWritten := 0
-	const throttleAfterKeys = 1000 // Nhường CPU sau mỗi 1000 key
-	// --- KẾT THÚC MÃ TỐI ƯU ---
-
-	for mergedIter.Next() {
-		if err := writer.WriteEntry(mergedIter.Key(), mergedIter.Value()); err != nil {
-			writer.Close()
-			os.Remove(path)
-			return err
-		}
-		hasEntries = true
-
-		// --- BẮT ĐẦU MÃ TỐI ƯU (Thêm vào L1) ---
-		keysWritten++
-		if keysWritten%throttleAfterKeys == 0 {
-			runtime.Gosched()
-		}
-		// --- KẾT THÚC MÃ TỐI ƯU ---
-	}
-	if err := mergedIter.Error(); err != nil {
-		writer.Close()
-		os.Remove(path)
-		return err
-	}
-	if err := writer.Close(); err != nil {
-		os.Remove(path)
-		return err
-	}
-
-	var newL2Meta *FileMetadata
-	if hasEntries {
-		meta := writer.GetMetadata()
-		newL2Meta = &FileMetadata{
-			Level:    2, // Cấp L2 MỚI
-			Path:     path,
-			MinKey:   meta.MinKey,
-			MaxKey:   meta.MaxKey,
-			FileSize: meta.FileSize,
-			KeyCount: meta.KeyCount,
-		}
-	}
-
 	// 6. Cập nhật MANIFEST (atomic)
 	e.mu.Lock()
 	// Xóa 1 file L1 cũ
 	e.current.DeleteFiles(1, filesToCompactL1)
 	// Xóa các file L2 cũ (bị chồng lấn)
 	e.current.DeleteFiles(2, filesToCompactL2)
-	// Thêm file L2 mới (nếu có)
-	if newL2Meta != nil {
-		e.current.AddFile(newL2Meta)
+	// Thêm các file L2 mới (nếu có)
+	for _, meta := range newL2Files {
+		e.current.AddFile(meta)
 	}
+	e.current.trackRangeTombstones(since, newL2Files)
+	e.gcRangeTombstones()
 	if err := e.saveManifest(); err != nil {
 		e.mu.Unlock()
 		slog.Error("CRITICAL: Failed to save manifest after L1 compaction", "error", err)
@@ -253,10 +222,10 @@ func (e *LSMEngine) runL1Compaction(l1Files, l2Files []*FileMetadata) error {
 
 	// 7. Xóa các tệp cũ (sau khi MANIFEST đã an toàn)
 	for _, meta := range filesToCompactL1 {
-		os.Remove(meta.Path)
+		e.removeTableFile(meta.Path)
 	}
 	for _, meta := range filesToCompactL2 {
-		os.Remove(meta.Path)
+		e.removeTableFile(meta.Path)
 	}
 
 	e.metrics.compacts.Add(1)
@@ -270,6 +239,7 @@ func calculateTotalKeys(files ...[]*FileMetadata) uint32 {
 			total += meta.KeyCount
 		}
 	}
-	// Thêm buffer khoảng 10% để an toàn cho Bloom Filter (giảm tỉ lệ va chạm)
-	return uint32(float64(total) * 1.1)
+	// Cận trên của số key đầu ra (chỉ để cấp phát trước; bloom filter của
+	// writer được tính theo số key thực tế)
+	return total
 }
@@ -0,0 +1,75 @@
+package lsm
+
+import "log/slog"
+
+// l0MergeMinFiles là số tệp nhỏ liền kề tối thiểu để gộp
+const l0MergeMinFiles = 2
+
+// tinyL0Run trả về dãy dài nhất các tệp L0 liền kề (theo thứ tự cũ -> mới)
+// cùng nhỏ hơn maxBytes, nil nếu không có dãy nào đủ l0MergeMinFiles tệp.
+// Chỉ gộp tệp liền kề nên tệp output đứng đúng chỗ của dãy trong L0: mọi tệp
+// trước nó vẫn cũ hơn, mọi tệp sau nó vẫn mới hơn.
+func tinyL0Run(l0 []*FileMetadata, maxBytes int64) []*FileMetadata {
+	if maxBytes <= 0 || len(l0) >= L0CompactionTrigger {
+		return nil // Đủ tệp thì compaction L0 -> L1 nén tất cả
+	}
+	var best []*FileMetadata
+	start := 0
+	for i := 0; i <= len(l0); i++ {
+		if i < len(l0) && l0[i].FileSize < maxBytes {
+			continue
+		}
+		if i-start >= l0MergeMinFiles && i-start > len(best) {
+			best = l0[start:i]
+		}
+		start = i + 1
+	}
+	return best
+}
+
+// runL0Merge gộp các tệp L0 liền kề (files, cũ -> mới) thành tệp L0 mới thay
+// vào đúng vị trí của chúng. Tombstone luôn được giữ (xem newCompactionIterator).
+func (e *LSMEngine) runL0Merge(files []*FileMetadata) error {
+	newest := make([]*FileMetadata, 0, len(files))
+	for i := len(files) - 1; i >= 0; i-- {
+		newest = append(newest, files[i])
+	}
+	rts, since := e.rangeTombstonesForJob()
+	merged, err := e.runSubcompactions(newest, 0, rts)
+	if err != nil {
+		return err
+	}
+
+	// Cập nhật MANIFEST: flush có thể đã thêm tệp mới vào cuối L0 trong lúc
+	// gộp, nên dựng lại L0 thay cho dãy inputs thay vì dùng vị trí cũ
+	inputs := make(map[string]bool, len(files))
+	for _, f := range files {
+		inputs[f.Path] = true
+	}
+	e.mu.Lock()
+	l0 := make([]*FileMetadata, 0, len(e.current.Levels[0])-len(files)+len(merged))
+	for _, f := range e.current.Levels[0] {
+		if !inputs[f.Path] {
+			l0 = append(l0, f)
+		} else if f.Path == files[0].Path {
+			l0 = append(l0, merged...)
+		}
+	}
+	e.current.Levels[0] = l0
+	e.current.trackRangeTombstones(since, merged)
+	e.gcRangeTombstones()
+	if err := e.saveManifest(); err != nil {
+		e.mu.Unlock()
+		slog.Error("CRITICAL: Failed to save manifest after L0 merge", "error", err)
+		return err
+	}
+	e.mu.Unlock()
+
+	for _, meta := range files {
+		if err := e.removeTableFile(meta.Path); err != nil {
+			slog.Warn("Failed to delete old file after L0 merge", "path", meta.Path, "error", err)
+		}
+	}
+	e.metrics.l0Merges.Add(1)
+	return nil
+}
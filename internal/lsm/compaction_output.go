@@ -0,0 +1,132 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// DefaultTargetFileSize là kích thước mục tiêu của mỗi SSTable do compaction ghi
+const DefaultTargetFileSize = 64 * 1024 * 1024 // 64MB
+
+// compactionOutput ghi kết quả một compaction vào một hoặc nhiều SSTable ở
+// level: khi tệp đang ghi vượt Options.targetFileSize(level) thì tệp được
+// đóng và entry tiếp theo mở tệp mới. MergingIterator trả về mỗi key một lần
+// theo thứ tự tăng dần nên các tệp output không chồng lấn khoảng key.
+type compactionOutput struct {
+	e             *LSMEngine
+	level         int
+	targetSize    int64
+	estimatedKeys uint32 // Cận trên số key còn lại (chỉ để cấp phát trước)
+
+	writer *SSTWriter // nil: chưa mở tệp tiếp theo
+	path   string
+	files  []*FileMetadata // Các tệp đã đóng
+}
+
+func (e *LSMEngine) newCompactionOutput(level int, estimatedKeys uint32) *compactionOutput {
+	return &compactionOutput{
+		e:             e,
+		level:         level,
+		targetSize:    e.opts.targetFileSize(level),
+		estimatedKeys: estimatedKeys,
+	}
+}
+
+// add ghi một entry vào tệp đang ghi (mở tệp mới nếu cần)
+func (o *compactionOutput) add(key string, item *engine.Item) error {
+	if o.writer == nil {
+		if err := o.open(); err != nil {
+			return err
+		}
+	}
+	o.e.bgIO.wait(len(key) + len(item.Value))
+	if err := o.writer.WriteEntry(key, item); err != nil {
+		return err
+	}
+	if o.targetSize > 0 && o.writer.DataSize() >= o.targetSize {
+		return o.closeFile()
+	}
+	return nil
+}
+
+func (o *compactionOutput) open() error {
+	o.e.mu.Lock()
+	seq := o.e.seq
+	o.e.seq++
+	o.e.mu.Unlock()
+
+	path := filepath.Join(o.e.sstDir, fmt.Sprintf("sst-L%d-%06d.sst", o.level, seq))
+	writer, err := NewSSTWriter(path, o.level, o.estimatedKeys, o.e.opts.Compression, o.e.opts.bloomPolicy(o.level))
+	if err != nil {
+		return err
+	}
+	writer.SetBlockSize(o.e.opts.blockSize(o.level), o.e.opts.BlockSizeCollections)
+	o.writer, o.path = writer, path
+	return nil
+}
+
+// closeFile đóng tệp đang ghi và ghi nhận metadata của nó
+func (o *compactionOutput) closeFile() error {
+	if err := o.writer.Close(); err != nil {
+		return err
+	}
+	meta := o.writer.GetMetadata()
+	o.files = append(o.files, &FileMetadata{
+		Level:      o.level,
+		Path:       o.path,
+		MinKey:     meta.MinKey,
+		MaxKey:     meta.MaxKey,
+		FileSize:   meta.FileSize,
+		KeyCount:   meta.KeyCount,
+		Tombstones: meta.Tombstones,
+
+		ValueLogRefs: meta.ValueLogRefs,
+	})
+	o.estimatedKeys -= min(o.estimatedKeys, meta.KeyCount)
+	o.writer, o.path = nil, ""
+	return nil
+}
+
+// finish đóng tệp đang ghi và trả về mọi tệp output (rỗng nếu không có entry)
+func (o *compactionOutput) finish() ([]*FileMetadata, error) {
+	if o.writer != nil {
+		if err := o.closeFile(); err != nil {
+			return nil, err
+		}
+	}
+	return o.files, nil
+}
+
+// paths trả về đường dẫn mọi tệp output, kể cả tệp đang ghi
+func (o *compactionOutput) paths() []string {
+	paths := make([]string, 0, len(o.files)+1)
+	for _, f := range o.files {
+		paths = append(paths, f.Path)
+	}
+	if o.writer != nil {
+		paths = append(paths, o.path)
+	}
+	return paths
+}
+
+// discard xóa mọi tệp output khi compaction thất bại (MANIFEST chưa đổi)
+func (o *compactionOutput) discard() {
+	if o.writer != nil {
+		o.writer.Close()
+	}
+	for _, path := range o.paths() {
+		os.Remove(path)
+	}
+	o.writer, o.path, o.files = nil, "", nil
+}
+
+// abort bỏ mọi tệp output khi Close hủy compaction (xem abortCompaction)
+func (o *compactionOutput) abort() error {
+	paths := o.paths()
+	writer := o.writer
+	o.writer, o.path, o.files = nil, "", nil
+	return o.e.abortCompaction(writer, paths...)
+}
@@ -0,0 +1,101 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// defaultCompactionBytesPerSec: tốc độ dùng để ước lượng thời gian khi chưa
+// có compaction nào chạy xong trong lần mở này
+const defaultCompactionBytesPerSec = 32 * 1024 * 1024
+
+// PlanCompaction trả về compaction mà Compact sẽ chạy tiếp theo (dry run):
+// cùng cách chọn tệp với pickAndRunCompaction, chỉ đọc properties block.
+// Không chờ compaction đang chạy: kế hoạch dựa trên các level hiện tại.
+func (e *LSMEngine) PlanCompaction() (engine.CompactionPlan, error) {
+	pick := e.pickCompaction()
+
+	var plan engine.CompactionPlan
+	if pick == nil {
+		return plan, nil
+	}
+	plan.Needed, plan.Reason = true, pick.reason
+	plan.FromLevel, plan.ToLevel = pick.level, pick.output
+
+	inputs := append(append([]*FileMetadata(nil), pick.inputs...), pick.overlaps...)
+	for _, meta := range inputs {
+		tombstones, err := tableTombstones(meta.Path)
+		if err != nil {
+			return plan, fmt.Errorf("%s: %w", meta.Path, err)
+		}
+		plan.Inputs = append(plan.Inputs, engine.CompactionFile{
+			Level:      meta.Level,
+			Path:       meta.Path,
+			Bytes:      meta.FileSize,
+			Keys:       meta.KeyCount,
+			Tombstones: tombstones,
+			MinKey:     meta.MinKey,
+			MaxKey:     meta.MaxKey,
+		})
+		plan.InputBytes += meta.FileSize
+		plan.InputKeys += uint64(meta.KeyCount)
+		plan.Tombstones += tombstones
+	}
+
+	minKey, maxKey := keyRange(inputs)
+	plan.DroppableTombstones = plan.Tombstones
+	if pick.output == pick.level {
+		plan.DroppableTombstones = 0 // Gộp trong L0: các tệp L0 cũ hơn có thể chứa key
+	}
+	for _, f := range e.filesBelow(plan.ToLevel) {
+		if f.MaxKey >= minKey && f.MinKey <= maxKey {
+			plan.DroppableTombstones = 0
+			break
+		}
+	}
+
+	// Output: input trừ phần tombstone bị bỏ (không tính phiên bản cũ bị
+	// gộp, nên là cận trên)
+	plan.EstimatedOutputBytes = plan.InputBytes
+	if plan.InputKeys > 0 {
+		plan.EstimatedOutputBytes = int64(float64(plan.InputBytes) * float64(plan.InputKeys-plan.DroppableTombstones) / float64(plan.InputKeys))
+	}
+	if plan.EstimatedOutputBytes > 0 {
+		plan.EstimatedOutputFiles = 1
+		if target := e.opts.targetFileSize(plan.ToLevel); target > 0 {
+			plan.EstimatedOutputFiles = int((plan.EstimatedOutputBytes + target - 1) / target)
+		}
+	}
+
+	bytesPerSec := float64(defaultCompactionBytesPerSec)
+	if b, ns := e.metrics.compactBytes.Load(), e.metrics.compactNanos.Load(); b > 0 && ns > 0 {
+		bytesPerSec = float64(b) / time.Duration(ns).Seconds()
+	}
+	plan.EstimatedDurationMs = int64(float64(plan.InputBytes) / bytesPerSec * 1000)
+	return plan, nil
+}
+
+// tableTombstones đọc số tombstone từ properties block (0 với tệp trước v6)
+func tableTombstones(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	ft, err := readFooter(f, stat.Size())
+	if err != nil {
+		return 0, err
+	}
+	props, err := readProperties(f, ft)
+	if err != nil || props == nil {
+		return 0, err
+	}
+	return props.Tombstones, nil
+}
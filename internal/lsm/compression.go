@@ -0,0 +1,111 @@
+package lsm
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression là codec nén data block của SSTable
+type Compression string
+
+const (
+	CompressionNone   Compression = "none"
+	CompressionSnappy Compression = "snappy"
+	CompressionZstd   Compression = "zstd"
+)
+
+// Giá trị codec byte trong trailer của data block (từ SSTVersion 2)
+const (
+	codecNone   byte = 0
+	codecSnappy byte = 1
+	codecZstd   byte = 2
+)
+
+// ParseCompression đọc tên codec (không phân biệt hoa thường; "" = none)
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(strings.ToLower(strings.TrimSpace(s))); c {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionSnappy, CompressionZstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q (use snappy, zstd or none)", s)
+}
+
+// maxDecodedBlockSize: data block sau giải nén không thể lớn hơn mức này
+// (lớn hơn mọi giới hạn body của server); chặn block hỏng khai báo kích thước khổng lồ
+const maxDecodedBlockSize = 256 << 20
+
+// Encoder/decoder zstd dùng chung: EncodeAll/DecodeAll an toàn khi gọi đồng thời
+var (
+	zstdOnce sync.Once
+	zstdEnc  *zstd.Encoder
+	zstdDec  *zstd.Decoder
+	zstdErr  error
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEnc, zstdErr = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		if zstdErr == nil {
+			zstdDec, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0),
+				zstd.WithDecoderMaxMemory(maxDecodedBlockSize))
+		}
+	})
+	return zstdEnc, zstdDec, zstdErr
+}
+
+// compressBlock nén block theo codec đã chọn. Block không nhỏ đi
+// được giữ nguyên (codecNone) để không tốn công giải nén khi đọc.
+func compressBlock(c Compression, raw []byte) ([]byte, byte, error) {
+	var out []byte
+	var codec byte
+	switch c {
+	case CompressionSnappy:
+		out, codec = snappy.Encode(nil, raw), codecSnappy
+	case CompressionZstd:
+		enc, _, err := zstdCodec()
+		if err != nil {
+			return nil, 0, fmt.Errorf("init zstd: %w", err)
+		}
+		out, codec = enc.EncodeAll(raw, nil), codecZstd
+	default:
+		return raw, codecNone, nil
+	}
+	if len(out) >= len(raw) {
+		return raw, codecNone, nil
+	}
+	return out, codec, nil
+}
+
+// decompressBlock là phép ngược của compressBlock
+func decompressBlock(codec byte, data []byte) ([]byte, error) {
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecSnappy:
+		if n, err := snappy.DecodedLen(data); err == nil && n > maxDecodedBlockSize {
+			return nil, fmt.Errorf("snappy block too large (%d bytes): %w", n, ErrCorruption)
+		}
+		raw, err := snappy.Decode(nil, data)
+		if err != nil {
+			return nil, fmt.Errorf("snappy decode: %w", err)
+		}
+		return raw, nil
+	case codecZstd:
+		_, dec, err := zstdCodec()
+		if err != nil {
+			return nil, fmt.Errorf("init zstd: %w", err)
+		}
+		raw, err := dec.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("zstd decode: %w", err)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("unknown block codec %d", codec)
+}
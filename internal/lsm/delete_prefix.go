@@ -0,0 +1,64 @@
+package lsm
+
+import "github.com/nconghau/MiniDBGo/internal/engine"
+
+// deletePrefixChunk: số tombstone tối đa trong một batch của DeletePrefix
+const deletePrefixChunk = 1000
+
+// DeletePrefix xóa các key có tiền tố prefix (lọc bởi match) trong một lượt quét.
+// Tombstone được ghi theo từng batch: iterator được đóng trước mỗi lần ghi
+// (MemTable iterator giữ RLock) rồi mở lại ngay sau key cuối cùng đã xét,
+// nên bộ nhớ dùng chỉ giới hạn ở một batch.
+func (e *LSMEngine) DeletePrefix(prefix string, match func(key string, value []byte) bool) (int, error) {
+	end := prefixEnd(prefix)
+	start := prefix
+	deleted := 0
+
+	for {
+		b := NewBatch()
+		lastKey, exhausted, err := e.collectDeletes(start, end, match, b)
+		if err != nil {
+			return deleted, err
+		}
+		if b.Size() > 0 {
+			if err := e.ApplyBatch(b); err != nil {
+				return deleted, err
+			}
+			deleted += b.Size()
+			e.metrics.deletes.Add(int64(b.Size()))
+		}
+		if exhausted {
+			return deleted, nil
+		}
+		// Tiếp tục ngay sau key cuối cùng đã xét
+		start = lastKey + "\x00"
+	}
+}
+
+// collectDeletes quét [start, end) và thêm tombstone vào b cho tới khi đủ một batch
+func (e *LSMEngine) collectDeletes(start, end string, match func(string, []byte) bool, b *lsmBatch) (string, bool, error) {
+	it, err := e.newRangeIterator(start, end)
+	if err != nil {
+		return "", false, err
+	}
+	defer it.Close()
+
+	// Key nội bộ chỉ bị xóa khi chính prefix là prefix nội bộ
+	skipSystem := !engine.IsSystemKey(start)
+
+	lastKey := ""
+	for it.Next() {
+		k := it.Key()
+		lastKey = k
+		if skipSystem && engine.IsSystemKey(k) {
+			continue
+		}
+		if match == nil || match(k, it.Value().Value) {
+			b.Delete([]byte(k))
+			if b.Size() >= deletePrefixChunk {
+				return lastKey, false, it.Error()
+			}
+		}
+	}
+	return lastKey, true, it.Error()
+}
@@ -0,0 +1,176 @@
+package lsm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Loại khác biệt của một document giữa hai bản sao CSDL
+const (
+	DiffAdded   = "added"   // Chỉ có ở B
+	DiffRemoved = "removed" // Chỉ có ở A
+	DiffChanged = "changed" // Có ở cả hai, nội dung khác nhau
+)
+
+// DiffEntry là một document khác nhau giữa A và B
+type DiffEntry struct {
+	Kind       string
+	Collection string
+	ID         string
+}
+
+// CollectionDiff đếm khác biệt của một collection
+type CollectionDiff struct {
+	Collection string `json:"collection"`
+	Added      int64  `json:"added"`
+	Removed    int64  `json:"removed"`
+	Changed    int64  `json:"changed"`
+	Same       int64  `json:"same"`
+}
+
+// DiffReport tóm tắt DiffDirs, theo collection (tên tăng dần)
+type DiffReport struct {
+	Collections []CollectionDiff `json:"collections"`
+}
+
+// Differs cho biết hai bản sao có khác nhau không
+func (r *DiffReport) Differs() bool {
+	for _, c := range r.Collections {
+		if c.Added+c.Removed+c.Changed > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DiffDirs so sánh document của hai thư mục dữ liệu (bản sao lưu/checkpoint,
+// engine KHÔNG được chạy trên chúng) và gọi fn cho mỗi document khác nhau
+// theo thứ tự key. Key hệ thống (index, catalog...) không được so sánh.
+// Mỗi thư mục được mở qua một bản sao tạm (SSTable hard-link nếu được như
+// MoveData) nên replay WAL và flush không làm thay đổi bản gốc.
+func DiffDirs(dirA, dirB string, fn func(DiffEntry) error) (*DiffReport, error) {
+	tmp, err := os.MkdirTemp("", "minidb-diff-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	a, err := openDiffCopy(dirA, filepath.Join(tmp, "a"))
+	if err != nil {
+		return nil, err
+	}
+	defer a.Close()
+	b, err := openDiffCopy(dirB, filepath.Join(tmp, "b"))
+	if err != nil {
+		return nil, err
+	}
+	defer b.Close()
+
+	itA, err := a.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+	defer itA.Close()
+	itB, err := b.NewIterator()
+	if err != nil {
+		return nil, err
+	}
+	defer itB.Close()
+
+	stats := make(map[string]*CollectionDiff)
+	// kind rỗng: document giống nhau (chỉ đếm)
+	emit := func(kind, key string) error {
+		col, id, _ := splitDocKey(key)
+		c := stats[col]
+		if c == nil {
+			c = &CollectionDiff{Collection: col}
+			stats[col] = c
+		}
+		switch kind {
+		case DiffAdded:
+			c.Added++
+		case DiffRemoved:
+			c.Removed++
+		case DiffChanged:
+			c.Changed++
+		default:
+			c.Same++
+			return nil
+		}
+		return fn(DiffEntry{Kind: kind, Collection: col, ID: id})
+	}
+
+	okA, okB := nextDocument(itA), nextDocument(itB)
+	for okA || okB {
+		var err error
+		switch {
+		case !okB || (okA && itA.Key() < itB.Key()):
+			err = emit(DiffRemoved, itA.Key())
+			okA = nextDocument(itA)
+		case !okA || itB.Key() < itA.Key():
+			err = emit(DiffAdded, itB.Key())
+			okB = nextDocument(itB)
+		default:
+			kind := ""
+			if !bytes.Equal(itA.Value().Value, itB.Value().Value) {
+				kind = DiffChanged
+			}
+			err = emit(kind, itA.Key())
+			okA, okB = nextDocument(itA), nextDocument(itB)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, it := range []engine.Iterator{itA, itB} {
+		if err := it.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	report := &DiffReport{Collections: make([]CollectionDiff, 0, len(stats))}
+	for _, c := range stats {
+		report.Collections = append(report.Collections, *c)
+	}
+	sort.Slice(report.Collections, func(i, j int) bool {
+		return report.Collections[i].Collection < report.Collections[j].Collection
+	})
+	return report, nil
+}
+
+// openDiffCopy chép dir sang stage rồi mở bản sao (không chạy scrubber).
+// Thư mục chưa flush lần nào (chỉ có WAL, chưa có MANIFEST) vẫn hợp lệ.
+func openDiffCopy(dir, stage string) (*LSMEngine, error) {
+	_, errManifest := os.Stat(filepath.Join(dir, manifestFileName))
+	if _, err := os.Stat(filepath.Join(dir, "wal")); err != nil && errManifest != nil {
+		return nil, fmt.Errorf("%s is not a MiniDBGo data dir: %w", dir, errManifest)
+	}
+	if err := os.MkdirAll(stage, 0o755); err != nil {
+		return nil, err
+	}
+	if err := moveDataInto(dir, stage, true, &MoveReport{}); err != nil {
+		return nil, fmt.Errorf("copy %s: %w", dir, err)
+	}
+	opts := DefaultOptions()
+	opts.ScrubBlocksPerSec = 0
+	eng, err := OpenLSMWithOptions(stage, opts)
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", dir, err)
+	}
+	return eng.(*LSMEngine), nil
+}
+
+// nextDocument tiến it tới document kế tiếp (bỏ qua key hệ thống)
+func nextDocument(it engine.Iterator) bool {
+	for it.Next() {
+		if _, _, ok := splitDocKey(it.Key()); ok && !engine.IsSystemKey(it.Key()) {
+			return true
+		}
+	}
+	return false
+}
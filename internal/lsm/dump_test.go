@@ -0,0 +1,44 @@
+package lsm
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Key ứng dụng (engine.AppKeyPrefix) đi theo metadata của dump, không thành collection
+func TestDumpRestoresAppMeta(t *testing.T) {
+	src, err := OpenLSM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	appKey := []byte(engine.AppKeyPrefix + "views")
+	appVal := `[{"collection":"users","name":"short","view":{"fields":["name"]}}]`
+	if err := src.Put(appKey, []byte(appVal)); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Put([]byte("users:1"), []byte(`{"name":"a"}`)); err != nil {
+		t.Fatal(err)
+	}
+	dump := filepath.Join(t.TempDir(), "dump.json")
+	if err := src.DumpDB(dump); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := OpenLSM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.RestoreDB(dump); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := dst.Get(appKey); err != nil || string(got) != appVal {
+		t.Fatalf("restored app meta = %q, %v", got, err)
+	}
+	if _, err := dst.Get([]byte("users:1")); err != nil {
+		t.Fatalf("restored document: %v", err)
+	}
+}
@@ -7,17 +7,20 @@ import (
 	"errors"
 	"fmt"
 	"hash/crc32"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/jobs"
 )
 
 // ErrCorruption là lỗi trả về khi phát hiện
@@ -43,8 +46,8 @@ const (
 )
 
 type flushTask struct {
-	mem     *MemTable
-	walPath string // Đường dẫn file WAL cần xóa sau khi flush xong
+	mem      *MemTable
+	walPaths []string // Các file WAL cần xóa sau khi flush xong
 }
 
 type LSMEngine struct {
@@ -53,13 +56,25 @@ type LSMEngine struct {
 	mem      *MemTable //
 	memBytes int64
 
+	// walRetired: các segment WAL đã bị thay (do lỗi ghi hoặc vượt
+	// WALSegmentBytes) nhưng vẫn chứa dữ liệu của MemTable hiện tại; được
+	// bỏ cùng WAL khi MemTable flush xong
+	walRetired []string
+	walRecycle *walRecycler
+	walArchive *walArchive // nil nếu không bật lưu trữ WAL
+
 	immutMu    sync.RWMutex
 	immutables []*MemTable
 
 	sstDir      string
-	seq         int
-	flushSize   int64
+	seq         int           // Số thứ tự của tệp SSTable/WAL kế tiếp
+	lastSeq     atomic.Uint64 // Seqno của lần ghi gần nhất (gán trong commitGroup, dưới mu)
+	flushSize   int64         // Ngưỡng của MemTable hiện tại (bảo vệ bởi mu)
 	maxMemBytes int64
+	opts        Options
+
+	limitsMu      sync.Mutex
+	pendingLimits *engine.FlushThresholds // Ngưỡng mới, áp dụng ở lần rotate kế tiếp
 
 	mu           sync.RWMutex // Bảo vệ 'current', 'seq', 'wal', 'mem'
 	shuttingDown bool
@@ -67,27 +82,74 @@ type LSMEngine struct {
 	// Lifecycle management
 	ctx    context.Context
 	cancel context.CancelFunc
-	wg     sync.WaitGroup
+
+	// Tác vụ nền (flush, compaction, scrubber) chạy qua bộ lập lịch chung
+	jobs *jobs.Scheduler
 
 	// Flush management
-	flushCh  chan flushTask
 	flushErr atomic.Value
 
+	shutdown shutdownStats // Việc bị bỏ dở khi Close hết ShutdownTimeout
+
 	// Metrics
 	metrics struct {
 		puts     atomic.Int64
 		gets     atomic.Int64
+		exists   atomic.Int64
 		deletes  atomic.Int64
 		flushes  atomic.Int64
 		compacts atomic.Int64
+
+		flushBytes   atomic.Int64 // Tổng dung lượng SSTable do flush tạo ra
+		compactBytes atomic.Int64 // Tổng dung lượng đầu vào của các compaction thành công
+		compactNanos atomic.Int64 // Tổng thời gian chạy của các compaction thành công
+		l0Merges     atomic.Int64 // Số lần gộp các tệp L0 nhỏ thành một tệp L0
+		// subcompactions: số khoảng key đã nén song song (compaction chia khoảng)
+		subcompactions atomic.Int64
+
+		scrubBlocks atomic.Int64 // Số block scrubber đã kiểm tra
+		scrubErrors atomic.Int64 // Số lần scrubber phát hiện lỗi
+
+		walErrors    atomic.Int64 // Số batch bị từ chối do ghi WAL lỗi
+		walSwitches  atomic.Int64 // Số lần chuyển sang segment WAL mới do lỗi
+		walRotations atomic.Int64 // Số lần chuyển segment WAL do vượt WALSegmentBytes
+		walSyncs     atomic.Int64 // Số lần job nền fsync WAL (DurabilityEverySec)
 	}
 
+	statsBase lifetimeStats // Bộ đếm cộng dồn đọc từ tệp STATS lúc mở
+	statsMu   sync.Mutex    // Tuần tự hóa các lần ghi tệp STATS
+
+	readStats   readStats        // Thống kê khuếch đại đọc của Get
+	bloomStats  bloomStats       // Hiệu quả bloom filter của Get
+	readAhead   readAheadStats   // Read-ahead của iterator SSTable (xem readahead.go)
+	readLatency latencyHistogram // Độ trễ Get cho Options.ReadLatencySLO
+	bgIO        bgThrottle       // Giới hạn tốc độ ghi của tác vụ nền (xem read_slo.go)
+	sched       readScheduler
+
+	blockCache *blockCache  // LRU các block SSTable cho Get (nil = tắt)
+	tables     *tableCache  // Các SSTable đang mở cho Get (nil = tắt)
+	commits    *commitQueue // Hàng đợi group commit của các writer (xem group_commit.go)
+	vlog       *valueLog    // Value log cho value lớn (xem vlog.go)
+
+	scrubMu       sync.Mutex
+	scrubBadFiles map[string]struct{} // Các tệp bị scrubber phát hiện hỏng
+
 	// --- MỚI: Quản lý Version và Compaction ---
 	manifestPath string
 	current      *Version
-	compactionCh chan struct{} // Channel để kích hoạt nén
-	compactMu    sync.Mutex    // Đảm bảo chỉ 1 compaction chạy
-
+	versions     versionRefs // Ảnh chụp Version đang được đọc (xem version_refs.go)
+	snapshots    snapshotSet // Các engine.Snapshot đang mở (xem snapshot.go)
+	txns         txnStats    // Kết quả các transaction (xem txn.go)
+	rangeDels    rangeDeleteStats
+	ttl          ttlStats   // Document có thời hạn (xem ttl.go)
+	compactMu    sync.Mutex // Đảm bảo chỉ 1 compaction chạy
+
+	// Secondary index
+	catalog   *Catalog
+	catalogMu sync.RWMutex // Bảo vệ 'catalog'
+	indexMu   sync.Mutex   // Tuần tự hóa các lần ghi có bảo trì index
+
+	keyLocks keyLocks // Khóa theo key cho các thao tác đọc-sửa-ghi
 }
 
 // --- MỚI: KIỂM TRA STATIC ---
@@ -101,6 +163,19 @@ func OpenLSM(dir string) (engine.Engine, error) {
 
 // --- SỬA ĐỔI: Kiểu trả về là engine.Engine ---
 func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.Engine, error) {
+	opts := DefaultOptions()
+	opts.FlushSize = flushSize
+	opts.MaxMemBytes = maxMemBytes
+	return OpenLSMWithOptions(dir, opts)
+}
+
+// OpenLSMWithOptions mở CSDL với cấu hình đầy đủ
+func OpenLSMWithOptions(dir string, opts Options) (engine.Engine, error) {
+	flushSize, maxMemBytes := opts.FlushSize, opts.MaxMemBytes
+	if opts.MmapReads && !MmapSupported {
+		slog.Warn("mmap reads not supported on this platform, using pread", "component", "lsm")
+		opts.MmapReads = false
+	}
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, fmt.Errorf("create dir: %w", err)
 	}
@@ -117,6 +192,10 @@ func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.E
 	if err != nil {
 		return nil, fmt.Errorf("load manifest: %w", err)
 	}
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load catalog: %w", err)
+	}
 	// Tự động sửa lại đường dẫn file trong Manifest để khớp với thư mục hiện tại
 	// Điều này giúp DB hoạt động đúng ngay cả khi di chuyển thư mục dữ liệu (như Docker Volume)
 	for _, files := range currentVersion.Levels {
@@ -125,6 +204,12 @@ func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.E
 			f.Path = filepath.Join(sstDir, filepath.Base(f.Path))
 		}
 	}
+	// Từ chối ngay nếu có SSTable mà bản build này không đọc được
+	if err := checkSSTFormats(currentVersion); err != nil {
+		return nil, fmt.Errorf("check sst formats: %w", err)
+	}
+	removeOrphanTables(dir, sstDir, currentVersion)
+	removeReplaceStaging(dir)
 
 	seq := 1
 	for _, files := range currentVersion.Levels {
@@ -136,25 +221,46 @@ func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.E
 			}
 		}
 	}
+	// WAL mới đặt tên theo seq nên phải đứng sau FlushedWAL, kể cả khi
+	// SSTable có seq lớn nhất đã bị compaction xóa (nếu không sẽ bị bỏ qua khi replay)
+	if walSeq, _ := walNumber(currentVersion.FlushedWAL); currentVersion.FlushedWAL != "" && int(walSeq) >= seq {
+		seq = int(walSeq) + 1
+	}
 
-	w, err := OpenWAL(walDir, seq)
+	vlog, err := openValueLog(filepath.Join(dir, valueLogDirName), opts.ValueLogFileSize)
 	if err != nil {
-		return nil, fmt.Errorf("open wal: %w", err)
+		return nil, err
 	}
+	archive, err := openWALArchive(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	engine := &LSMEngine{
-		dir: dir, wal: w, mem: NewMemTable(),
+		dir: dir, mem: NewMemTable(),
 		immutables:   make([]*MemTable, 0, MaxImmutableTables),
 		sstDir:       sstDir,
 		seq:          seq,
 		flushSize:    flushSize,
 		maxMemBytes:  maxMemBytes,
+		opts:         opts,
 		ctx:          ctx,
 		cancel:       cancel,
-		flushCh:      make(chan flushTask, MaxImmutableTables),
+		jobs:         jobs.New(),
 		manifestPath: manifestPath, current: currentVersion,
-		compactionCh: make(chan struct{}, 1),
-	}
+		catalog:       catalog,
+		statsBase:     loadStats(dir),
+		blockCache:    newBlockCache(opts.BlockCacheBytes),
+		tables:        newTableCache(opts.MaxOpenFiles, opts.MmapReads),
+		commits:       newCommitQueue(opts.GroupCommitDelay),
+		walRecycle:    newWALRecycler(walDir, opts.WALRecycleFiles),
+		walArchive:    archive,
+		vlog:          vlog,
+		scrubBadFiles: make(map[string]struct{}),
+	}
+	// Seqno mới phải lớn hơn mọi range tombstone, kể cả khi không còn lần ghi nào sau nó
+	engine.lastSeq.Store(max(currentVersion.LastSeq, currentVersion.RangeTombstones.maxSeq()))
 	replayedFiles, err := engine.replayWAL(walDir)
 	if err != nil {
 		cancel()
@@ -162,14 +268,14 @@ func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.E
 	}
 	if engine.mem.Size() > 0 {
 		slog.Info("Flushing replayed WAL data to SSTable...", "count", engine.mem.Size())
-		if err := engine.flushMemTable(engine.mem); err != nil {
+		if err := engine.flushMemTable(engine.mem, replayedFiles); err != nil {
 			cancel()
 			return nil, fmt.Errorf("failed to flush replayed data: %w", err)
 		}
 		engine.mem = NewMemTable()
 		atomic.StoreInt64(&engine.memBytes, 0)
 		for _, p := range replayedFiles {
-			if err := os.Remove(p); err != nil {
+			if err := engine.removeWAL(p); err != nil {
 				slog.Warn("Failed to delete replayed WAL file", "path", p, "error", err)
 			}
 		}
@@ -179,9 +285,18 @@ func OpenLSMWithConfig(dir string, flushSize int64, maxMemBytes int64) (engine.E
 		// SAU KHI FLUSH, ĐÁNH THỨC COMPACTION WORKER ĐỂ NÓ KIỂM TRA
 		engine.tryScheduleCompaction()
 	}
-	engine.wg.Add(2)
-	go engine.flushWorker()
-	go engine.compactionWorker()
+
+	// Mở WAL sau khi replay: nếu mở trước, file WAL đang dùng cũng nằm trong
+	// danh sách replay và bị xóa sau khi flush, các lần ghi sau đó sẽ mất khi crash
+	w, err := engine.newWALSegment()
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("open wal: %w", err)
+	}
+	engine.wal = w
+	engine.startJobs()
+	// Tệp vlog của lần chạy trước có thể đã đủ rác để GC
+	engine.tryScheduleCompaction()
 	return engine, nil
 }
 
@@ -200,11 +315,23 @@ func (e *LSMEngine) replayWAL(walDir string) ([]string, error) {
 		}
 	}
 	// Sắp xếp để replay theo thứ tự thời gian
-	sort.Strings(names)
+	sortWALFiles(names)
 
 	slog.Info("Replaying WAL files...", "count", len(names))
 
-	for _, p := range names {
+	replayed := make([]string, 0, len(names))
+	for i, p := range names {
+		if e.current.walFlushed(p) {
+			// Crash sau khi flush nhưng trước khi xóa WAL: dữ liệu đã nằm trong
+			// SSTable, replay lại sẽ tạo tệp L0 trùng lặp
+			slog.Info("Skipping already flushed WAL file", "path", p)
+			if err := e.removeWAL(p); err != nil {
+				slog.Warn("Failed to delete flushed WAL file", "path", p, "error", err)
+			}
+			continue
+		}
+		replayed = append(replayed, p)
+
 		tmpF, err := os.Open(p)
 		if err != nil {
 			slog.Warn("Cannot open WAL file for replay", "path", p, "error", err)
@@ -214,12 +341,19 @@ func (e *LSMEngine) replayWAL(walDir string) ([]string, error) {
 		wr := &WAL{f: tmpF, path: p}
 		err = wr.Iterate(func(flags byte, key, value []byte) error {
 			k := string(key)
+			entry, err := decodeWALEntry(flags, key, value)
+			if err != nil {
+				return err
+			}
+			if entry.Seq > e.lastSeq.Load() {
+				e.lastSeq.Store(entry.Seq)
+			}
 
 			// 1. Ghi vào Memtable
-			if flags == 1 {
-				e.mem.Delete(k)
+			if entry.Tombstone {
+				e.mem.Delete(k, entry.UpdatedAt, entry.Seq)
 			} else {
-				e.mem.Put(k, value)
+				e.mem.Put(k, entry.Value, entry.UpdatedAt, entry.Seq, entry.ExpiresAt)
 			}
 
 			// 2. [QUAN TRỌNG] Kiểm tra Memory Limit ngay trong lúc Replay
@@ -227,8 +361,9 @@ func (e *LSMEngine) replayWAL(walDir string) ([]string, error) {
 			if e.mem.Size() >= int64(e.flushSize) || e.mem.ByteSize() >= e.maxMemBytes {
 				slog.Info("MemTable full during replay, flushing...", "size", e.mem.ByteSize())
 
-				// Flush đồng bộ (Sync) trực tiếp
-				if err := e.flushMemTable(e.mem); err != nil {
+				// Flush đồng bộ (Sync) trực tiếp; chỉ các file đã replay hết
+				// (đứng trước p) mới được đánh dấu là đã flush
+				if err := e.flushMemTable(e.mem, replayed[:len(replayed)-1]); err != nil {
 					return fmt.Errorf("flush error during replay: %w", err)
 				}
 
@@ -244,56 +379,126 @@ func (e *LSMEngine) replayWAL(walDir string) ([]string, error) {
 
 		tmpF.Close()
 		if err != nil {
-			return nil, fmt.Errorf("error iterating wal %s: %w", p, err)
+			if errors.Is(err, ErrCorruption) {
+				e.reportCorruption(CorruptionInfo{Source: "wal", Path: p, Level: -1, Err: err})
+			}
+			// Crash giữa lúc ghi chỉ để lại bản ghi dở ở cuối segment mới nhất:
+			// cắt bỏ từ bản ghi hỏng đầu tiên và mở CSDL với phần còn lại.
+			// Hỏng ở segment cũ hơn nghĩa là mất dữ liệu đã xác nhận nên vẫn báo lỗi.
+			var recErr *walRecordError
+			if i != len(names)-1 || !errors.As(err, &recErr) {
+				return nil, fmt.Errorf("error iterating wal %s: %w", p, err)
+			}
+			if terr := truncateWALTail(p, recErr.Offset); terr != nil {
+				return nil, fmt.Errorf("error iterating wal %s: %w (truncate: %v)", p, err, terr)
+			}
 		}
 	}
 
-	return names, nil
+	return replayed, nil
+}
+
+// startJobs đăng ký các lane tác vụ nền của engine
+func (e *LSMEngine) startJobs() {
+	// Flush tuần tự; hàng đợi giới hạn bởi số MemTable immutable
+	e.jobs.AddLane(jobFlush, jobs.LaneOptions{Workers: 1, QueueSize: MaxImmutableTables, Record: true})
+	// Compaction: một job chạy, tối đa một job chờ (các lần kích hoạt dồn lại)
+	e.jobs.AddLane(jobCompaction, jobs.LaneOptions{Workers: 1, QueueSize: 1, Record: true})
+	if e.opts.ScrubBlocksPerSec > 0 {
+		slog.Info("Scrubber started", "component", "lsm", "blocks_per_sec", e.opts.ScrubBlocksPerSec)
+		e.jobs.Every(jobScrub, time.Second/time.Duration(e.opts.ScrubBlocksPerSec), e.scrubOneBlock)
+	}
+	if e.opts.StatsPersistInterval > 0 {
+		e.jobs.Every(jobStats, e.opts.StatsPersistInterval, e.persistStats)
+	}
+	if e.opts.LeaseReapInterval > 0 {
+		e.jobs.Every(jobLeases, e.opts.LeaseReapInterval, e.reapLeases)
+	}
+	// Luôn chạy: batch có thể chọn DurabilityEverySec dù engine dùng chế độ khác
+	e.jobs.Every(jobWALSync, walSyncInterval, e.syncWAL)
+	if e.opts.GroupCommitAutoTune {
+		e.jobs.Every(jobCommitTune, groupCommitTuneInterval, e.tuneGroupCommit)
+	}
+	if e.opts.ReadLatencySLO > 0 {
+		e.jobs.Every(jobReadSLO, sloTuneInterval, e.tuneReadSLO)
+	}
+	if a := e.walArchive; a != nil && (a.retention > 0 || a.maxBytes > 0) {
+		e.jobs.Every(jobWALArchive, walArchivePruneInterval, a.prune)
+	}
 }
 
-func (e *LSMEngine) flushWorker() {
-	defer e.wg.Done()
-	slog.Info("Flush worker started", "component", "lsm")
+// Tên lane của các tác vụ nền
+const (
+	jobFlush      = "flush"
+	jobCompaction = "compaction"
+	jobScrub      = "scrub"
+	jobStats      = "stats"
+	jobLeases     = "leases"
+	jobWALSync    = "wal_sync"
+	jobWALArchive = "wal_archive"
+	jobCommitTune = "group_commit_tune"
+	jobReadSLO    = "read_slo"
+)
 
-	// Sửa vòng lặp nhận task
-	for task := range e.flushCh {
-		slog.Info("Starting memtable flush", "component", "lsm")
-		start := time.Now()
+// walSyncInterval là chu kỳ fsync nền của DurabilityEverySec
+const walSyncInterval = time.Second
 
-		// Gọi flushMemTable với task.mem
-		if err := e.flushMemTable(task.mem); err != nil {
-			e.flushErr.Store(err)
-			slog.Error("Memtable flush error", "error", err)
-		} else {
-			// --- FIX: Flush thành công -> Xóa file WAL cũ ---
-			if task.walPath != "" {
-				if err := os.Remove(task.walPath); err != nil {
-					slog.Warn("Failed to remove old WAL", "path", task.walPath, "error", err)
-				} else {
-					slog.Debug("Removed old WAL file", "path", task.walPath)
-				}
-			}
-			// ------------------------------------------------
+// Jobs trả về trạng thái các tác vụ nền của engine
+func (e *LSMEngine) Jobs() jobs.Status {
+	return e.jobs.Status()
+}
 
-			slog.Info("Memtable flush complete", "duration_ms", time.Since(start).Milliseconds())
-		}
+// runFlush là một job flush: ghi MemTable immutable xuống L0 và xóa WAL cũ
+func (e *LSMEngine) runFlush(task flushTask) error {
+	slog.Info("Starting memtable flush", "component", "lsm")
+	start := time.Now()
+	defer e.tryScheduleCompaction()
 
-		e.tryScheduleCompaction()
+	if e.shutdownAborted() {
+		// Giữ WAL: MemTable được khôi phục từ WAL ở lần mở sau
+		e.shutdown.flushesSkipped.Add(1)
+		slog.Warn("Memtable flush skipped by shutdown, data kept in WAL", "component", "lsm", "entries", task.mem.Size())
+		return nil
 	}
-	slog.Info("Flush worker stopped (channel closed).", "component", "lsm")
+	if err := e.flushMemTable(task.mem, task.walPaths); err != nil {
+		e.flushErr.Store(err)
+		slog.Error("Memtable flush error", "error", err)
+		return err
+	}
+	// Flush thành công -> Xóa file WAL cũ
+	for _, p := range task.walPaths {
+		if err := e.removeWAL(p); err != nil {
+			slog.Warn("Failed to remove old WAL", "path", p, "error", err)
+		} else {
+			slog.Debug("Removed old WAL file", "path", p)
+		}
+	}
+	slog.Info("Memtable flush complete", "duration_ms", time.Since(start).Milliseconds())
+	return nil
 }
 
-// flushMemTable
-func (e *LSMEngine) flushMemTable(memTable *MemTable) error {
+// flushMemTable ghi memTable xuống L0. walPaths là các segment WAL mà dữ liệu
+// đã nằm trọn trong memTable: segment mới nhất được ghi vào MANIFEST cùng lúc
+// với SSTable để replay bỏ qua chúng nếu crash trước khi kịp xóa.
+func (e *LSMEngine) flushMemTable(memTable *MemTable, walPaths []string) (err error) {
 	ctx, cancel := context.WithTimeout(e.ctx, FlushTimeout)
 	defer cancel()
 
-	items := memTable.SnapshotAndReset()
+	// Không reset memTable ở đây: nó vẫn nằm trong danh sách immutable
+	// và phục vụ đọc cho tới khi removeImmutable() bên dưới
+	items := memTable.Snapshot()
 	if len(items) == 0 {
 		e.removeImmutable(memTable) // Vẫn xóa khỏi danh sách immutable
 		return nil
 	}
 
+	start := time.Now()
+	var info FlushInfo
+	defer func() {
+		info.Duration, info.Err = time.Since(start), err
+		e.emitFlush(info)
+	}()
+
 	// ... (kiểm tra context) ...
 	select {
 	case <-ctx.Done():
@@ -307,21 +512,52 @@ func (e *LSMEngine) flushMemTable(memTable *MemTable) error {
 	e.seq++
 	e.mu.Unlock()
 
+	// Entry đã bị range tombstone xóa không được ghi xuống
+	rts, since := e.rangeTombstonesForJob()
+	keys := make([]string, 0, len(items))
+	var maxSeq uint64
+	for k, item := range items {
+		maxSeq = max(maxSeq, item.Seq)
+		if rts.covering(k, item.Seq) == nil {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 {
+		e.mu.Lock()
+		e.current.markWALFlushed(walPaths)
+		e.current.LastSeq = max(e.current.LastSeq, maxSeq)
+		err = e.saveManifest()
+		e.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		e.removeImmutable(memTable)
+		return nil
+	}
+
 	// 2. Viết SSTable (Level 0)
 	path := filepath.Join(e.sstDir, fmt.Sprintf("sst-L0-%06d.sst", seq))
-	writer, err := NewSSTWriter(path, uint32(len(items)))
+	writer, err := NewSSTWriter(path, 0, uint32(len(keys)), e.opts.Compression, e.opts.bloomPolicy(0))
 	if err != nil {
 		return err
 	}
+	writer.SetBlockSize(e.opts.blockSize(0), e.opts.BlockSizeCollections)
 
-	keys := make([]string, 0, len(items))
-	for k := range items {
-		keys = append(keys, k)
-	}
-	sort.Strings(keys)
-
+	// Giữ tới khi SSTable vào MANIFEST để GC không xóa tệp vlog mà
+	// các con trỏ mới ghi đang trỏ tới
+	e.vlog.commitMu.RLock()
+	defer e.vlog.commitMu.RUnlock()
+	throttled := e.flushThrottled()
 	for _, key := range keys {
-		if err := writer.WriteEntry(key, items[key]); err != nil {
+		if throttled {
+			e.bgIO.wait(len(key) + len(items[key].Value))
+		}
+		item, err := e.separateValue(key, items[key])
+		if err == nil {
+			err = writer.WriteEntry(key, item)
+		}
+		if err != nil {
 			writer.Close()
 			os.Remove(path)
 			return err
@@ -331,20 +567,32 @@ func (e *LSMEngine) flushMemTable(memTable *MemTable) error {
 		os.Remove(path)
 		return err
 	}
+	if err := e.vlog.sync(); err != nil {
+		os.Remove(path)
+		return err
+	}
 
 	// 3. Cập nhật Manifest (cần khóa mu)
 	meta := writer.GetMetadata()
 	fileMeta := &FileMetadata{
-		Level:    0,
-		Path:     path,
-		MinKey:   meta.MinKey,
-		MaxKey:   meta.MaxKey,
-		FileSize: meta.FileSize,
-		KeyCount: meta.KeyCount,
+		Level:      0,
+		Path:       path,
+		MinKey:     meta.MinKey,
+		MaxKey:     meta.MaxKey,
+		FileSize:   meta.FileSize,
+		KeyCount:   meta.KeyCount,
+		Tombstones: meta.Tombstones,
+
+		ValueLogRefs: meta.ValueLogRefs,
 	}
+	info.Path, info.Keys, info.Bytes = path, meta.KeyCount, meta.FileSize
 
 	e.mu.Lock()
 	e.current.AddFile(fileMeta)
+	e.current.markWALFlushed(walPaths)
+	e.current.LastSeq = max(e.current.LastSeq, maxSeq)
+	e.current.trackRangeTombstones(since, []*FileMetadata{fileMeta})
+	e.gcRangeTombstones()
 	err = e.saveManifest() // Ghi đè MANIFEST
 	e.mu.Unlock()
 
@@ -358,27 +606,30 @@ func (e *LSMEngine) flushMemTable(memTable *MemTable) error {
 	// 4. Dọn dẹp
 	e.removeImmutable(memTable)
 	e.metrics.flushes.Add(1)
+	e.metrics.flushBytes.Add(meta.FileSize)
 	return nil
 }
 
 // --- MỚI: Các hàm Compaction ---
 
-// compactionWorker là goroutine chạy nền
-func (e *LSMEngine) compactionWorker() {
-	defer e.wg.Done()
-	slog.Info("Compaction worker started", "component", "lsm")
-
-	for range e.compactionCh {
-		if e.ctx.Err() != nil {
-			break // Engine đang tắt
-		}
-
-		if err := e.pickAndRunCompaction(); err != nil {
-			slog.Error("Compaction error", "error", err)
+// runCompaction là một job compaction
+func (e *LSMEngine) runCompaction() error {
+	if e.shutdownAborted() {
+		e.shutdown.compactionsSkipped.Add(1)
+		return nil
+	}
+	err := e.pickAndRunCompaction()
+	if err == nil {
+		err = e.collectValueLog()
+	}
+	if err != nil {
+		if errors.Is(err, errCompactionAborted) {
+			return nil
 		}
+		slog.Error("Compaction error", "error", err)
+		return err
 	}
-
-	slog.Info("Compaction worker stopped.", "component", "lsm")
+	return nil
 }
 
 // --- BẮT ĐẦU MÃ MỚI ---
@@ -390,36 +641,45 @@ func (e *LSMEngine) pickAndRunCompaction() error {
 	e.compactMu.Lock() // Khóa để đảm bảo chỉ 1 compaction chạy
 	defer e.compactMu.Unlock()
 
-	// Lấy snapshot của version hiện tại
-	e.mu.RLock()
-	l0Files := e.current.Levels[0]
-	l1Files := e.current.Levels[1]
-	// Chúng ta cần lấy l2Files ngay cả khi nó không tồn tại
-	// để dùng trong logic tìm file chồng lấn (overlap)
-	l2Files := e.current.Levels[2]
-	e.mu.RUnlock()
-
-	// --- Quyết định 1: Ưu tiên L0 ---
-	if len(l0Files) >= L0CompactionTrigger {
-		slog.Info("Starting L0->L1 compaction | pickAndRunCompaction", "files", len(l0Files))
-		// (Chúng ta sẽ đổi tên hàm runCompaction() thành runL0Compaction)
-		return e.runL0Compaction(l0Files)
+	pick := e.pickCompaction()
+	if pick == nil {
+		slog.Debug("No compaction needed")
+		return nil
 	}
+	inputs := append(append([]*FileMetadata(nil), pick.inputs...), pick.overlaps...)
+	switch {
+	case pick.output == 0:
+		slog.Info("Starting L0 tiny file merge", "files", len(pick.inputs))
+		return e.observeCompaction(0, 0, inputs, func() error { return e.runL0Merge(pick.inputs) })
+	case pick.level == 0:
+		slog.Info("Starting L0->L1 compaction | pickAndRunCompaction", "files", len(pick.inputs))
+		return e.observeCompaction(0, 1, inputs, func() error { return e.runL0Compaction(pick.inputs, pick.overlaps) })
+	}
+	slog.Info("Starting L1->L2 compaction", "l1_files", len(pick.inputs), "l2_overlap_count", len(pick.overlaps))
+	return e.observeCompaction(1, 2, inputs, func() error { return e.runL1Compaction(pick.inputs, pick.overlaps) })
+}
 
-	// --- Quyết định 2: Kiểm tra L1 ---
-	var l1Size int64
-	for _, f := range l1Files {
-		l1Size += f.FileSize
+// observeCompaction chạy một compaction từ level xuống output và gọi các hook bắt đầu/kết thúc
+func (e *LSMEngine) observeCompaction(level, output int, inputs []*FileMetadata, run func() error) error {
+	info := CompactionInfo{FromLevel: level, ToLevel: output, InputFiles: len(inputs)}
+	for _, f := range inputs {
+		info.InputBytes += f.FileSize
 	}
+	e.emitCompactionStart(info)
 
-	if l1Size > L1CompactionTriggerBytes {
-		slog.Info("Starting L1->L2 compaction", "l1_size_mb", l1Size/1024/1024)
-		// (Đây là hàm mới chúng ta sắp viết)
-		return e.runL1Compaction(l1Files, l2Files)
+	start := time.Now()
+	err := run()
+	info.Duration, info.Err = time.Since(start), err
+	e.emitCompactionEnd(info)
+	if err == nil {
+		e.metrics.compactBytes.Add(info.InputBytes)
+		e.metrics.compactNanos.Add(int64(info.Duration))
 	}
 
-	slog.Debug("No compaction needed")
-	return nil
+	if errors.Is(err, ErrCorruption) {
+		e.reportCorruption(CorruptionInfo{Source: "compaction", Level: level, Err: err})
+	}
+	return err
 }
 
 // --- KẾT THÚC MÃ MỚI ---
@@ -444,16 +704,15 @@ func (e *LSMEngine) tryScheduleCompaction() {
 	needsL1Compaction := l1Size > L1CompactionTriggerBytes
 	// --- KẾT THÚC MÃ MỚI ---
 
+	// Gộp các tệp L0 nhỏ liền kề (xem compaction_l0merge.go)
+	needsL0Merge := tinyL0Run(e.current.Levels[0], e.opts.L0MergeFileBytes) != nil
+
 	e.mu.RUnlock() // Mở khóa
 
-	// Chỉ cần một trong hai điều kiện là đủ để "đánh thức" worker
-	if needsL0Compaction || needsL1Compaction {
-		select {
-		case e.compactionCh <- struct{}{}:
-			// Đã gửi tín hiệu
-		default:
-			// Worker đã bận, không cần gửi nữa
-		}
+	// Chỉ cần một trong hai điều kiện là đủ để xếp một job compaction
+	// (nếu đã có job đang chờ thì job đó sẽ xử lý luôn)
+	if needsL0Compaction || needsL1Compaction || needsL0Merge || e.needsValueLogGC() {
+		e.jobs.Submit(jobCompaction, "", e.runCompaction)
 	}
 }
 
@@ -491,52 +750,73 @@ func (e *LSMEngine) ApplyBatch(b engine.Batch) error {
 		return errors.New("invalid batch type provided")
 	}
 
-	e.mu.Lock()
-	defer e.mu.Unlock()
-	if e.shuttingDown {
-		return errors.New("database is shutting down")
-	}
-	if e.ctx.Err() != nil {
-		return errors.New("engine is shutting down")
+	// Chờ các FindOneAndUpdate/Delete đang chạy trên cùng key
+	unlock := e.keyLocks.lockBatch(lsmBatch)
+	defer unlock()
+	return e.writeBatch(lsmBatch)
+}
+
+// writeBatch ghi batch kèm bảo trì nhãn và index.
+// Caller phải giữ khóa key (keyLocks) của các key trong batch.
+func (e *LSMEngine) writeBatch(lsmBatch *lsmBatch) error {
+	// Thời hạn (_ttl/_expiresAt): cần có trước khi sinh entry index
+	if err := e.stampExpiry(lsmBatch); err != nil {
+		return err
 	}
-	if lsmBatch.Size() == 0 {
-		return nil
+	// Nhãn (_tags): kiểm tra và tự tạo index trước khi bảo trì index
+	if err := e.ensureTagIndexes(lsmBatch); err != nil {
+		return err
 	}
 
-	for _, entry := range lsmBatch.entries {
-		if err := e.wal.Append(entry.Key, entry.Value, entry.Tombstone); err != nil { // [cite: 197-198]
-			return fmt.Errorf("wal append batch: %w", err)
+	// Bảo trì secondary index (đọc document cũ cần thực hiện trước khi khóa e.mu)
+	if lsmBatch.Size() > 0 && e.hasIndexes() {
+		e.indexMu.Lock()
+		defer e.indexMu.Unlock()
+		var err error
+		if lsmBatch, err = e.withIndexEntries(lsmBatch); err != nil {
+			return err
 		}
 	}
-
-	needsFlush := false
-	for _, entry := range lsmBatch.entries {
-		k := string(entry.Key)
-		if entry.Tombstone {
-			e.mem.Delete(k)
-			atomic.AddInt64(&e.memBytes, int64(len(k)))
-		} else {
-			e.mem.Put(k, entry.Value)
-			atomic.AddInt64(&e.memBytes, int64(len(k)+len(entry.Value)))
-		}
-		if e.mem.Size() >= e.flushSize || atomic.LoadInt64(&e.memBytes) >= e.maxMemBytes { // [cite: 198-199]
-			needsFlush = true
-		}
+	if err := e.applyBatch(lsmBatch); err != nil {
+		return err
 	}
+	e.countWrites(lsmBatch)
+	return nil
+}
 
-	if needsFlush {
-		if err := e.rotateMemTable(); err != nil { // [cite: 199-201]
-			return fmt.Errorf("rotate memtable: %w", err)
+// countWrites cập nhật bộ đếm puts/deletes theo các key của người dùng
+// (không tính entry index do engine tự thêm, có tính các lệnh xóa dây chuyền)
+func (e *LSMEngine) countWrites(b *lsmBatch) {
+	var puts, deletes int64
+	for _, entry := range b.entries {
+		switch {
+		case engine.IsSystemKey(string(entry.Key)):
+		case entry.Tombstone:
+			deletes++
+		default:
+			puts++
 		}
 	}
-	return nil
+	e.metrics.puts.Add(puts)
+	e.metrics.deletes.Add(deletes)
+}
+
+// applyBatch ghi batch vào WAL + MemTable qua group commit (không bảo trì index)
+func (e *LSMEngine) applyBatch(lsmBatch *lsmBatch) error {
+	err := e.commit(lsmBatch)
+	if errors.Is(err, ErrTooManyPendingFlushes) {
+		// Gọi hook sau khi đã nhả e.mu
+		e.immutMu.RLock()
+		pending := len(e.immutables)
+		e.immutMu.RUnlock()
+		e.emitWriteStall(WriteStallInfo{PendingFlushes: pending, Err: err})
+	}
+	return err
 }
 
 // --- TÁI CẤU TRÚC (REFACTOR) Put và Delete ---
 
 func (e *LSMEngine) Put(key, value []byte) error {
-	e.metrics.puts.Add(1)
-
 	// --- SỬA ĐỔI: Sử dụng ApplyBatch ---
 	b := NewBatch()
 	b.Put(key, value)
@@ -548,8 +828,6 @@ func (e *LSMEngine) Update(key, value []byte) error {
 }
 
 func (e *LSMEngine) Delete(key []byte) error {
-	e.metrics.deletes.Add(1)
-
 	// --- SỬA ĐỔI: Sử dụng ApplyBatch ---
 	b := NewBatch()
 	b.Delete(key)
@@ -558,63 +836,212 @@ func (e *LSMEngine) Delete(key []byte) error {
 
 // Get
 func (e *LSMEngine) Get(key []byte) ([]byte, error) {
+	item, err := e.getItem(key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// getItem là Get kèm UpdatedAt và seqno của lần ghi cuối
+func (e *LSMEngine) getItem(key []byte) (*engine.Item, error) {
 	e.metrics.gets.Add(1)
-	k := string(key)
+	if e.opts.ReadLatencySLO > 0 {
+		defer e.readLatency.since(time.Now())
+	}
 
-	// 1. Check active memtable
-	e.mu.RLock()
-	if it, ok := e.mem.Get(k); ok {
-		e.mu.RUnlock()
-		if it.Tombstone {
-			return nil, errors.New("key not found")
+	val, res, err := e.lookup(string(key))
+	if err != nil {
+		return nil, err
+	}
+	if e.opts.ReadStats {
+		e.readStats.record(res)
+	}
+	if res.source == sourceNone || res.tombstone {
+		return nil, engine.ErrKeyNotFound
+	}
+	return &engine.Item{Value: val, UpdatedAt: res.updatedAt, Seq: res.seq, ExpiresAt: res.expiresAt}, nil
+}
+
+// Exists cho biết key có tồn tại không mà không trả về value: dừng ở bloom
+// filter và data block chứa key, value nằm trong value log không được đọc
+func (e *LSMEngine) Exists(key []byte) (bool, error) {
+	e.metrics.exists.Add(1)
+	v := e.readView()
+	defer e.releaseVersion(v.pin)
+	_, res, err := e.lookupIn(v, string(key), nil, true)
+	if err != nil {
+		return false, err
+	}
+	return res.source != sourceNone && !res.tombstone, nil
+}
+
+// MultiGet đọc nhiều key trên cùng một ảnh chụp của engine (một lần lấy
+// lock cho cả lô). Phần tử ứng với key không tồn tại là nil.
+func (e *LSMEngine) MultiGet(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	if err := e.sched.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+	if engine.PriorityFrom(ctx) == engine.PriorityHigh {
+		defer e.sched.beginHighRead()()
+	}
+
+	v := e.readView()
+	defer e.releaseVersion(v.pin)
+	out := make([][]byte, len(keys))
+	for i, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		e.metrics.gets.Add(1)
+		val, res, err := e.lookupIn(v, string(key), nil, false)
+		if err != nil {
+			return nil, err
+		}
+		if e.opts.ReadStats {
+			e.readStats.record(res)
 		}
-		return it.Value, nil
+		if res.source != sourceNone && !res.tombstone {
+			out[i] = val
+		}
+	}
+	return out, nil
+}
+
+// readView là ảnh chụp các nguồn dữ liệu (MemTable, Immutables, các level SST)
+// để tra nhiều key trên cùng một trạng thái của engine
+type readView struct {
+	mem        *MemTable
+	immutables []*MemTable
+	levels     map[int][]*FileMetadata
+	ranges     rangeTombstones // Range tombstone của Version lúc chụp
+	pin        *versionPin     // Giữ các tệp trong levels tới khi releaseVersion
+	seq        uint64          // Snapshot: chỉ thấy entry của mem có seqno <= seq (0 = mọi entry)
+}
+
+// memGet tra key trong MemTable của view
+func (v *readView) memGet(k string) (*engine.Item, bool) {
+	if v.seq == 0 {
+		return v.mem.Get(k)
+	}
+	return v.mem.getAt(k, v.seq)
+}
+
+// memIterator duyệt MemTable của view
+func (v *readView) memIterator() engine.Iterator {
+	if v.seq == 0 {
+		return NewMemTableIterator(v.mem)
 	}
+	return newSnapshotMemIterator(v.mem, v.seq)
+}
+
+func (e *LSMEngine) readView() *readView {
+	v := &readView{}
+	e.mu.RLock()
+	v.mem = e.mem
 	e.mu.RUnlock()
 
-	// 2. Check immutable memtables
 	e.immutMu.RLock()
-	for _, m := range e.immutables {
-		if it, ok := m.Get(k); ok {
-			e.immutMu.RUnlock()
-			if it.Tombstone {
-				return nil, errors.New("key not found")
-			}
-			return it.Value, nil
-		}
-	}
+	v.immutables = append([]*MemTable(nil), e.immutables...)
 	e.immutMu.RUnlock()
 
-	// 3. Search SST files (L0 -> LMax)
 	e.mu.RLock()
 	// Copy snapshot của levels để nhả lock sớm
-	levelsSnapshot := make(map[int][]*FileMetadata)
+	v.levels = make(map[int][]*FileMetadata, len(e.current.Levels))
 	for level, files := range e.current.Levels {
-		levelsSnapshot[level] = files
+		v.levels[level] = files
 	}
+	v.ranges = e.current.RangeTombstones
+	v.pin = e.versions.acquire(v.levels)
 	e.mu.RUnlock()
+	return v
+}
+
+// lookup tìm key theo thứ tự MemTable -> Immutables -> L0 -> LMax
+// và trả về cả đường đi (dùng cho thống kê đọc)
+func (e *LSMEngine) lookup(k string) ([]byte, lookupResult, error) {
+	v := e.readView()
+	defer e.releaseVersion(v.pin)
+	return e.lookupIn(v, k, nil, false)
+}
+
+// lookupIn tra key trên readView; tr != nil thì ghi lại từng bước (GetTrace).
+// keyOnly: chỉ cần biết key có tồn tại, value trong value log không được đọc (trả về nil).
+// Phiên bản mới nhất nằm trong một range tombstone mới hơn được coi là tombstone
+// mang seqno của range tombstone đó; phiên bản đã hết hạn (TTL) là tombstone
+// với seqno của chính nó. Lỗi đọc SSTable hay value log được trả về thay vì
+// bỏ qua tệp: tra tiếp ở tệp cũ hơn có thể trả về phiên bản đã bị ghi đè.
+func (e *LSMEngine) lookupIn(v *readView, k string, tr *readTrace, keyOnly bool) ([]byte, lookupResult, error) {
+	val, res, err := e.lookupNewest(v, k, tr, keyOnly)
+	if err != nil || res.source == sourceNone {
+		return val, res, err
+	}
+	if rt := v.ranges.covering(k, res.seq); rt != nil {
+		tr.add(engine.TraceStep{Source: "range_tombstone", Outcome: "tombstone"}, traceStart(tr))
+		res.tombstone, res.seq = true, rt.Seq
+		return nil, res, nil
+	}
+	if !res.tombstone && res.expiresAt != 0 && res.expiresAt <= time.Now().UnixNano() {
+		tr.add(engine.TraceStep{Source: "ttl", Outcome: "expired"}, traceStart(tr))
+		e.ttl.expired.Add(1)
+		res.tombstone = true
+		return nil, res, nil
+	}
+	return val, res, nil
+}
+
+// lookupNewest tìm phiên bản mới nhất của key (chưa xét range tombstone)
+func (e *LSMEngine) lookupNewest(v *readView, k string, tr *readTrace, keyOnly bool) ([]byte, lookupResult, error) {
+	res := lookupResult{source: sourceNone}
+
+	// 1. Check active memtable
+	start := traceStart(tr)
+	if it, ok := v.memGet(k); ok {
+		res.source, res.tombstone, res.updatedAt, res.seq, res.expiresAt = sourceMemTable, it.Tombstone, it.UpdatedAt, it.Seq, it.ExpiresAt
+		tr.add(engine.TraceStep{Source: "memtable", Outcome: memOutcome(it.Tombstone)}, start)
+		return it.Value, res, nil
+	}
+	tr.add(engine.TraceStep{Source: "memtable", Outcome: "miss"}, start)
+
+	// 2. Check immutable memtables (Mới -> Cũ: key có thể nằm ở nhiều immutable)
+	for i := len(v.immutables) - 1; i >= 0; i-- {
+		start := traceStart(tr)
+		if it, ok := v.immutables[i].Get(k); ok {
+			res.source, res.tombstone, res.updatedAt, res.seq, res.expiresAt = sourceImmutable, it.Tombstone, it.UpdatedAt, it.Seq, it.ExpiresAt
+			tr.add(engine.TraceStep{Source: "immutable", Outcome: memOutcome(it.Tombstone)}, start)
+			return it.Value, res, nil
+		}
+		tr.add(engine.TraceStep{Source: "immutable", Outcome: "miss"}, start)
+	}
+
+	// 3. Search SST files (L0 -> LMax)
+	levelsSnapshot := v.levels
 
 	// 3a. Quét L0 (Đặc biệt: có chồng lấn, phải quét từ Mới -> Cũ)
 	if l0Files, ok := levelsSnapshot[0]; ok {
 		for i := len(l0Files) - 1; i >= 0; i-- {
 			meta := l0Files[i]
 			if k < meta.MinKey || k > meta.MaxKey {
+				tr.add(sstStep(0, meta.Path, "out_of_range"), traceStart(tr))
 				continue
 			}
 			// --- [FIX 1] Xử lý lỗi chuẩn cho L0 ---
-			bv, tomb, err := ReadSSTFind(meta.Path, k)
+			res.sstProbes++
+			start := traceStart(tr)
+			step := sstStep(0, meta.Path, "")
+			item, err := e.findInSST(meta.Path, k, tr.stepPtr(&step), keyOnly)
+			tr.add(finishSSTStep(step, err == nil && item.Tombstone, err), start)
 			if err == nil {
-				// Tìm thấy!
-				if tomb {
-					return nil, errors.New("key not found")
-				}
-				if bv != nil {
-					return bv, nil
-				}
+				// Tìm thấy! (giá trị hoặc tombstone)
+				res.source, res.tombstone, res.updatedAt, res.seq, res.expiresAt = 0, item.Tombstone, item.UpdatedAt, item.Seq, item.ExpiresAt
+				return item.Value, res, nil
 			} else if err != os.ErrNotExist {
-				// Lỗi hệ thống (IO, Checksum...), log warning nhưng không return lỗi ngay
-				// để hệ thống cố gắng tìm ở các file cũ hơn (Hy vọng có bản backup)
-				slog.Warn("Error reading L0 SST", "path", meta.Path, "error", err)
+				// Lỗi hệ thống (IO, Checksum...): trả về lỗi, không tìm ở file cũ
+				// hơn vì bản ở đó có thể đã bị ghi đè/xóa
+				if errors.Is(err, ErrCorruption) {
+					e.reportCorruption(CorruptionInfo{Source: "read", Path: meta.Path, Level: 0, Err: err})
+				}
+				return nil, res, fmt.Errorf("read L0 sst %s: %w", meta.Path, err)
 			}
 			// Nếu err == os.ErrNotExist -> Chỉ đơn giản là không có, loop tiếp.
 		}
@@ -640,73 +1067,145 @@ func (e *LSMEngine) Get(key []byte) ([]byte, error) {
 				// Key nằm trong phạm vi file này.
 				// Vì không overlap, nếu key tồn tại ở Level này, nó CHỈ có thể ở file này.
 				// --- [FIX 2] Xử lý lỗi chuẩn cho Level > 0 ---
-				bv, tomb, err := ReadSSTFind(meta.Path, k)
+				res.sstProbes++
+				start := traceStart(tr)
+				step := sstStep(level, meta.Path, "")
+				item, err := e.findInSST(meta.Path, k, tr.stepPtr(&step), keyOnly)
+				tr.add(finishSSTStep(step, err == nil && item.Tombstone, err), start)
 				if err == nil {
-					if tomb {
-						return nil, errors.New("key not found")
-					}
-					if bv != nil {
-						return bv, nil
-					}
+					res.source, res.tombstone, res.updatedAt, res.seq, res.expiresAt = level, item.Tombstone, item.UpdatedAt, item.Seq, item.ExpiresAt
+					return item.Value, res, nil
 				} else if err != os.ErrNotExist {
-					// Log warning nếu file bị hỏng
-					slog.Warn("Error reading SST Level > 0", "level", level, "path", meta.Path, "error", err)
+					// File bị hỏng: trả về lỗi như L0
+					if errors.Is(err, ErrCorruption) {
+						e.reportCorruption(CorruptionInfo{Source: "read", Path: meta.Path, Level: level, Err: err})
+					}
+					return nil, res, fmt.Errorf("read L%d sst %s: %w", level, meta.Path, err)
 				}
 
 				// Logic quan trọng của LSM Level > 0:
 				// Vì các file không overlap, nếu key nằm trong Range [Min, Max] của file này
-				// mà tìm trong file không thấy (hoặc file lỗi), thì CHẮC CHẮN key không tồn tại ở Level này.
+				// mà tìm trong file không thấy, thì CHẮC CHẮN key không tồn tại ở Level này.
 				// Ta break để xuống Level sâu hơn tìm tiếp.
 				goto NextLevel
 			}
 		}
+		// Không tệp nào của level chứa key
+		tr.add(sstStep(level, "", "out_of_range"), traceStart(tr))
 	NextLevel:
 	}
 
-	return nil, errors.New("key not found")
+	return nil, res, nil
+}
+
+// --- KẾT THÚC SỬA ĐỔI ---
+
+// findInSST tìm key trong một SSTable qua tableCache và blockCache; value
+// trong value log được đọc ra (trừ khi keyOnly, xem lookupIn).
+// step != nil: ghi lại table cache, bloom và block đã đọc.
+func (e *LSMEngine) findInSST(path, k string, step *engine.TraceStep, keyOnly bool) (*engine.Item, error) {
+	h, hit, err := e.tables.acquire(path)
+	if err != nil {
+		return nil, err
+	}
+	defer e.tables.release(h)
+	if step != nil {
+		step.TableCache = "miss"
+		if hit {
+			step.TableCache = "hit"
+		}
+	}
+	item, err := h.r.find(e.blockCache, &e.bloomStats, k, step)
+	if err != nil || !item.ValuePointer {
+		return item, err
+	}
+	if keyOnly {
+		return &engine.Item{UpdatedAt: item.UpdatedAt, Seq: item.Seq, ExpiresAt: item.ExpiresAt}, nil
+	}
+	val, err := e.vlog.read(k, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &engine.Item{Value: val, UpdatedAt: item.UpdatedAt, Seq: item.Seq, ExpiresAt: item.ExpiresAt}, nil
 }
 
 // --- KẾT THÚC SỬA ĐỔI ---
 
 // NewIterator
 func (e *LSMEngine) NewIterator() (engine.Iterator, error) {
+	return e.newRangeIterator("", "")
+}
+
+// NewPrefixIterator duyệt các key có tiền tố prefix theo thứ tự tăng dần
+// và dừng ngay ở key đầu tiên vượt quá tiền tố.
+func (e *LSMEngine) NewPrefixIterator(prefix string) (engine.Iterator, error) {
+	return e.newRangeIterator(prefix, prefixEnd(prefix))
+}
+
+// newRangeIterator tạo iterator chỉ trả về key trong [start, end).
+// end == "" nghĩa là không giới hạn trên.
+// Các SSTable có [MinKey, MaxKey] không giao với khoảng này sẽ bị bỏ qua.
+func (e *LSMEngine) newRangeIterator(start, end string) (engine.Iterator, error) {
 	e.mu.RLock()
 	e.immutMu.RLock()
+	v := &readView{mem: e.mem, immutables: append([]*MemTable(nil), e.immutables...)}
+	e.immutMu.RUnlock()
+
+	// Snapshot Levels
+	v.levels = make(map[int][]*FileMetadata, len(e.current.Levels))
+	for level, files := range e.current.Levels {
+		v.levels[level] = files
+	}
+	v.ranges = e.current.RangeTombstones
+	v.pin = e.versions.acquire(v.levels)
+	e.mu.RUnlock()
+
+	it, err := e.viewIterator(v, start, end)
+	if err != nil {
+		e.releaseVersion(v.pin)
+		return nil, err
+	}
+	return e.newVersionIterator(it, func() { e.releaseVersion(v.pin) }), nil
+}
 
+// viewIterator ghép các nguồn của v thành một iterator trên [start, end).
+// Ảnh chụp Version (v.pin) do caller giữ và nhả.
+func (e *LSMEngine) viewIterator(v *readView, start, end string) (engine.Iterator, error) {
 	// Dự kiến số lượng iterator
-	iters := make([]engine.Iterator, 0, len(e.immutables)+10)
+	iters := make([]engine.Iterator, 0, len(v.immutables)+10)
 
 	// 1. Thêm MemTable
-	iters = append(iters, NewMemTableIterator(e.mem))
+	iters = append(iters, v.memIterator())
 
 	// 2. Thêm Immutables
-	for i := len(e.immutables) - 1; i >= 0; i-- {
-		iters = append(iters, NewMemTableIterator(e.immutables[i]))
+	for i := len(v.immutables) - 1; i >= 0; i-- {
+		iters = append(iters, NewMemTableIterator(v.immutables[i]))
 	}
-	e.immutMu.RUnlock()
 
-	// 3. Snapshot Levels
-	levelsSnapshot := make(map[int][]*FileMetadata)
-	for level, files := range e.current.Levels {
-		levelsSnapshot[level] = files
+	closeAll := func() {
+		for _, it := range iters {
+			it.Close()
+		}
 	}
-	e.mu.RUnlock()
 
-	// 4. Thêm L0 (Mới -> Cũ)
-	if l0Files, ok := levelsSnapshot[0]; ok {
+	// 3. Thêm L0 (Mới -> Cũ)
+	if l0Files, ok := v.levels[0]; ok {
 		for i := len(l0Files) - 1; i >= 0; i-- {
-			it, err := NewSSTableIterator(l0Files[i].Path)
+			if !fileOverlapsRange(l0Files[i], start, end) {
+				continue
+			}
+			it, err := e.openSSTIterator(l0Files[i].Path)
 			if err != nil {
-				// Close opened iters -> handle error cleanup carefully in prod
+				closeAll()
 				return nil, fmt.Errorf("open sst L0 iterator: %w", err)
 			}
 			iters = append(iters, it)
 		}
 	}
 
-	// 5. Thêm L1, L2... (Sorted Levels)
+	// 4. Thêm L1, L2... (Sorted Levels)
 	var sortedLevels []int
-	for level := range levelsSnapshot {
+	for level := range v.levels {
 		if level > 0 {
 			sortedLevels = append(sortedLevels, level)
 		}
@@ -714,20 +1213,54 @@ func (e *LSMEngine) NewIterator() (engine.Iterator, error) {
 	sort.Ints(sortedLevels)
 
 	for _, level := range sortedLevels {
-		files := levelsSnapshot[level]
+		files := v.levels[level]
 		// Level > 0: Các file không overlap, nhưng ta vẫn cần add tất cả vào
 		// MergingIterator để nó merge đúng thứ tự key toàn cục.
 		// (Hoặc tối ưu hơn là dùng ConcatIterator cho mỗi Level, nhưng Merging vẫn chạy đúng)
 		for _, meta := range files {
-			it, err := NewSSTableIterator(meta.Path)
+			if !fileOverlapsRange(meta, start, end) {
+				continue
+			}
+			it, err := e.openSSTIterator(meta.Path)
 			if err != nil {
+				closeAll()
 				return nil, fmt.Errorf("open sst L%d iterator: %w", level, err)
 			}
 			iters = append(iters, it)
 		}
 	}
 
-	return NewMergingIterator(iters), nil
+	// Định vị từng nguồn tại start trước khi merge
+	// (SSTable bỏ qua các khối đứng trước nhờ Index Block)
+	if start != "" {
+		for _, it := range iters {
+			it.Seek(start)
+		}
+	}
+
+	// Con trỏ value log chỉ được đọc ra ở đây (compaction dùng
+	// MergingIterator trực tiếp và chép nguyên con trỏ)
+	mergedIter := NewMergingIterator(iters)
+	if mi, ok := mergedIter.(*MergingIterator); ok {
+		mi.ranges = v.ranges
+		mi.now = time.Now().UnixNano()
+	}
+	var merged engine.Iterator = &valueLogIterator{Iterator: mergedIter, vlog: e.vlog}
+	if start != "" || end != "" {
+		merged = &rangeIterator{inner: merged, start: start, end: end}
+	}
+	return merged, nil
+}
+
+// fileOverlapsRange kiểm tra [MinKey, MaxKey] của file có giao với [start, end) không
+func fileOverlapsRange(meta *FileMetadata, start, end string) bool {
+	if start != "" && meta.MaxKey < start {
+		return false
+	}
+	if end != "" && meta.MinKey >= end {
+		return false
+	}
+	return true
 }
 
 // ... (Các hàm IterKeys, streamSSTKeys, mapToSlice, rotateMemTable, DumpDB, RestoreDB, Close, GetMetrics giữ nguyên) ...
@@ -786,37 +1319,28 @@ func (e *LSMEngine) rotateMemTable() error {
 	e.immutMu.RUnlock()
 
 	if immutableCount >= MaxImmutableTables {
-		return errors.New("too many pending flushes, please retry")
+		return ErrTooManyPendingFlushes
 	}
 
 	// 1. Đóng WAL hiện tại
-	oldWALPath := e.wal.path // Lưu đường dẫn để xóa sau
+	oldWALPaths := append(e.walRetired, e.wal.path) // Lưu đường dẫn để xóa sau
 	if err := e.wal.Close(); err != nil {
 		return fmt.Errorf("close wal: %w", err)
 	}
 
 	// 2. Tạo WAL mới
-	// Lưu ý: seq của engine dùng cho SST, ta có thể dùng timestamp hoặc seq riêng cho WAL.
-	// Để đơn giản và tránh conflict, dùng Seq hiện tại + Nano time
-	newWalPath := filepath.Join(e.dir, "wal", fmt.Sprintf("wal-%d-%d.log", e.seq, time.Now().UnixNano()))
-	newWalFile, err := os.OpenFile(newWalPath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	newWAL, err := e.newWALSegment()
 	if err != nil {
-		return fmt.Errorf("create new wal: %w", err)
-	}
-
-	// Cập nhật e.wal trỏ tới file mới
-	// (Lưu ý: Cần sửa struct WAL để public field hoặc tạo hàm NewWAL linh hoạt hơn,
-	// nhưng ở đây tôi giả định bạn fix nhanh bằng cách gán lại struct)
-	e.wal = &WAL{
-		f:    newWalFile,
-		path: newWalPath,
-		w:    bufio.NewWriterSize(newWalFile, 256*1024),
+		return err
 	}
+	e.wal = newWAL
+	e.walRetired = nil
 
 	// 3. Snapshot Memtable
 	snap := e.mem
 	e.mem = NewMemTable()
 	atomic.StoreInt64(&e.memBytes, 0)
+	e.applyPendingLimits()
 
 	// 4. Add to immutables
 	e.immutMu.Lock()
@@ -825,16 +1349,111 @@ func (e *LSMEngine) rotateMemTable() error {
 
 	// 5. Gửi cả Memtable và OldWALPath vào channel
 	task := flushTask{
-		mem:     snap,
-		walPath: oldWALPath,
+		mem:      snap,
+		walPaths: oldWALPaths,
 	}
 
-	select {
-	case e.flushCh <- task:
-		return nil
-	case <-time.After(time.Second):
-		return errors.New("flush queue full")
+	detail := fmt.Sprintf("%d entries", snap.Size())
+	if err := e.jobs.SubmitWait(jobFlush, detail, time.Second, func() error { return e.runFlush(task) }); err != nil {
+		return fmt.Errorf("flush queue: %w", err)
 	}
+	return nil
+}
+
+// truncateWALTail cắt segment WAL về offset (đầu bản ghi hỏng đầu tiên)
+func truncateWALTail(path string, offset int64) error {
+	st, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(path, offset); err != nil {
+		return err
+	}
+	slog.Warn("Truncated torn tail of the newest WAL segment", "component", "lsm",
+		"path", path, "offset", offset, "dropped_bytes", st.Size()-offset)
+	return nil
+}
+
+// sortWALFiles sắp các file WAL theo thứ tự tạo: wal-<seq>.log (bản cũ tạo lúc
+// mở CSDL) rồi wal-<seq>-<nano>.log (các segment còn lại), so sánh theo số
+// để wal-10 đứng sau wal-9 và wal-1-<nano> đứng sau wal-1.log
+func sortWALFiles(paths []string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		return walBefore(paths[i], paths[j])
+	})
+}
+
+// walNumber tách số thứ tự của segment WAL từ tên tệp: wal-<seq>.log hoặc
+// wal-<seq>-<nano>.log (nano = 0 với dạng đầu)
+func walNumber(p string) (seq, nano int64) {
+	name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(p), "wal-"), ".log")
+	seqStr, nanoStr, _ := strings.Cut(name, "-")
+	seq, _ = strconv.ParseInt(seqStr, 10, 64)
+	nano, _ = strconv.ParseInt(nanoStr, 10, 64)
+	return seq, nano
+}
+
+// walBefore: segment a được tạo trước segment b
+func walBefore(a, b string) bool {
+	sa, na := walNumber(a)
+	sb, nb := walNumber(b)
+	if sa != sb {
+		return sa < sb
+	}
+	return na < nb
+}
+
+// newWALSegment tạo file WAL mới.
+// Lưu ý: seq của engine dùng cho SST, ta có thể dùng timestamp hoặc seq riêng cho WAL.
+// Để đơn giản và tránh conflict, dùng Seq hiện tại + Nano time
+func (e *LSMEngine) newWALSegment() (*WAL, error) {
+	gen := uint64(time.Now().UnixNano())
+	path := filepath.Join(e.dir, "wal", fmt.Sprintf("wal-%d-%d.log", e.seq, gen))
+	reused := e.walRecycle.take(path, gen)
+	// Không O_APPEND: tệp tái sử dụng được ghi đè từ sau header
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("create new wal: %w", err)
+	}
+	if !reused {
+		if err := writeWALSegmentHeader(f, gen); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("write wal header: %w", err)
+		}
+		if e.opts.WALPreallocate && e.opts.WALSegmentBytes > 0 {
+			if err := preallocate(f, e.opts.WALSegmentBytes); err != nil {
+				slog.Debug("WAL preallocation failed", "component", "lsm", "path", path, "error", err)
+			}
+		}
+	}
+	if _, err := f.Seek(walSegmentHeader, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("seek new wal: %w", err)
+	}
+	return &WAL{
+		f:    f,
+		path: path,
+		w:    bufio.NewWriterSize(f, 256*1024),
+		size: walSegmentHeader,
+		gen:  gen,
+	}, nil
+}
+
+// switchWAL thay WAL hỏng (không cắt được phần ghi dở, fsync lỗi) bằng segment
+// mới mà không rotate MemTable. Segment cũ được giữ lại tới khi MemTable
+// flush xong vì phần đầu của nó vẫn là dữ liệu hợp lệ. Caller phải giữ e.mu.
+func (e *LSMEngine) switchWAL() error {
+	w, err := e.newWALSegment()
+	if err != nil {
+		return err
+	}
+	old := e.wal
+	old.Close()
+	e.walRetired = append(e.walRetired, old.path)
+	e.wal = w
+	e.metrics.walSwitches.Add(1)
+	slog.Warn("Switched to a new WAL segment after write errors", "component", "lsm", "old", old.path, "new", w.path)
+	return nil
 }
 
 // DumpDB
@@ -848,8 +1467,14 @@ func (e *LSMEngine) DumpDB(path string) error {
 
 	enc := json.NewEncoder(f)
 
-	// Sử dụng iterator để quét toàn bộ CSDL
-	it, err := e.NewIterator()
+	// Quét toàn bộ CSDL trên một snapshot: dump nhất quán dù vẫn có ghi,
+	// flush và compaction trong lúc quét
+	snap, err := e.Snapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Close()
+	it, err := snap.NewIterator()
 	if err != nil {
 		return err
 	}
@@ -860,8 +1485,8 @@ func (e *LSMEngine) DumpDB(path string) error {
 	for it.Next() {
 		fullKey := it.Key()
 		idx := strings.Index(fullKey, ":")
-		if idx < 0 {
-			continue // Bỏ qua key không hợp lệ
+		if idx < 0 || engine.IsSystemKey(fullKey) {
+			continue // Bỏ qua key không hợp lệ / key nội bộ
 		}
 
 		col := fullKey[:idx]
@@ -885,8 +1510,17 @@ func (e *LSMEngine) DumpDB(path string) error {
 		return err
 	}
 
-	// Logic [cite: 168] cũ đã được thay thế
-	return enc.Encode(collections)
+	// Kèm metadata (index...) để restore khôi phục cả cấu hình
+	meta, err := e.snapshotMeta()
+	if err != nil {
+		return err
+	}
+	out := make(map[string]interface{}, len(collections)+1)
+	out[dumpMetaKey] = meta
+	for col, docs := range collections {
+		out[col] = docs
+	}
+	return enc.Encode(out)
 }
 
 // --- KẾT THÚC SỬA ĐỔI ---
@@ -900,11 +1534,24 @@ func (e *LSMEngine) RestoreDB(path string) error {
 
 	// Stream decode to avoid loading entire file into memory
 	dec := json.NewDecoder(f)
-	var data map[string][]map[string]interface{}
+	var data map[string]json.RawMessage
 	if err := dec.Decode(&data); err != nil { // [cite: 170]
 		return err
 	}
-	for col, docs := range data {
+
+	// Khôi phục metadata trước, để document được index ngay khi ghi
+	if raw, ok := data[dumpMetaKey]; ok {
+		if err := e.restoreMeta(raw); err != nil {
+			return err
+		}
+		delete(data, dumpMetaKey)
+	}
+
+	for col, rawDocs := range data {
+		var docs []map[string]interface{}
+		if err := json.Unmarshal(rawDocs, &docs); err != nil {
+			return fmt.Errorf("decode collection %s: %w", col, err)
+		}
 		for _, doc := range docs {
 			idV, ok := doc["_id"]
 			if !ok {
@@ -935,32 +1582,45 @@ func (e *LSMEngine) Close() error {
 		return errors.New("database already closing")
 	}
 	e.shuttingDown = true
-	e.mu.Unlock()
 	// --- KẾT THÚC SỬA ĐỔI ---
 
-	// 1. Đẩy nốt dữ liệu RAM vào hàng đợi (nếu có)
+	// 1. Đẩy nốt dữ liệu RAM vào hàng đợi (nếu có). Vẫn giữ e.mu như
+	// commitGroup: rotate đổi e.wal mà job wal_sync đang đọc
 	if e.mem.Size() > 0 {
 		slog.Info("Scheduling active MemTable flush before shutdown...", "component", "lsm")
 		if err := e.rotateMemTable(); err != nil { // [cite: 214-215]
 			slog.Error("Failed to schedule final MemTable flush on close", "error", err)
 		}
 	}
+	e.mu.Unlock()
 
-	// 2. Đóng flushCh
-	close(e.flushCh)
-
-	// 3. Đóng compactionCh
-	close(e.compactionCh)
+	// 2. Dừng nhận job mới và chờ các job flush/compaction đã xếp hàng,
+	// tối đa ShutdownTimeout
+	flushes := e.metrics.flushes.Load()
+	if e.waitJobs(e.opts.ShutdownTimeout) {
+		slog.Info("All workers finished.", "component", "lsm")
+	} else {
+		e.reportShutdown(e.metrics.flushes.Load() - flushes)
+	}
 
-	// 4. Chờ worker
-	e.wg.Wait()
-	slog.Info("All workers finished.", "component", "lsm")
+	// 3. Lưu bộ đếm cộng dồn (sau khi flush cuối đã xong)
+	if err := e.persistStats(); err != nil {
+		slog.Error("Failed to persist lifetime stats", "error", err)
+	}
 
+	// 4. Đóng các SSTable đang mở cho Get
+	e.tables.close()
+	if err := e.vlog.close(); err != nil {
+		slog.Error("Failed to close value log", "error", err)
+	}
 	e.cancel()
 
 	// 5. Đóng WAL
-	if e.wal != nil {
-		if err := e.wal.Close(); err != nil { //
+	e.mu.RLock()
+	w := e.wal
+	e.mu.RUnlock()
+	if w != nil {
+		if err := w.Close(); err != nil { //
 			return err
 		}
 	}
@@ -975,10 +1635,43 @@ func (e *LSMEngine) GetMetrics() map[string]int64 {
 	metricsMap := map[string]int64{
 		"puts":     e.metrics.puts.Load(),
 		"gets":     e.metrics.gets.Load(),
+		"exists":   e.metrics.exists.Load(),
 		"deletes":  e.metrics.deletes.Load(),
 		"flushes":  e.metrics.flushes.Load(),
 		"compacts": e.metrics.compacts.Load(),
-	}
+
+		"l0_merges":             e.metrics.l0Merges.Load(),
+		"subcompactions":        e.metrics.subcompactions.Load(),
+		"scrub_blocks_checked":  e.metrics.scrubBlocks.Load(),
+		"scrub_errors":          e.metrics.scrubErrors.Load(),
+		"wal_write_errors":      e.metrics.walErrors.Load(),
+		"wal_switches":          e.metrics.walSwitches.Load(),
+		"wal_segment_rotations": e.metrics.walRotations.Load(),
+		"wal_background_syncs":  e.metrics.walSyncs.Load(),
+		"last_sequence":         int64(e.lastSeq.Load()),
+		"scrub_corrupt_files":   e.scrubCorruptFileCount(),
+	}
+	if e.opts.ReadStats {
+		e.readStats.export(metricsMap)
+	}
+	if e.opts.ReadLatencySLO > 0 {
+		e.bgIO.export(metricsMap)
+	}
+	e.sched.export(metricsMap)
+	e.blockCache.export(metricsMap)
+	e.bloomStats.export(metricsMap)
+	e.tables.export(metricsMap)
+	e.readAhead.export(metricsMap)
+	e.txns.export(metricsMap)
+	e.exportRangeDeletes(metricsMap)
+	e.ttl.export(metricsMap)
+	e.commits.export(metricsMap)
+	e.walRecycle.export(metricsMap)
+	e.walArchive.export(metricsMap)
+	e.versions.export(metricsMap)
+	e.snapshots.export(metricsMap)
+	e.vlog.export(metricsMap)
+	e.exportLifetime(metricsMap)
 
 	// --- BẮT ĐẦU MÃ MỚI ---
 	// 2. Lấy các gauges (trạng thái) về bộ nhớ
@@ -1002,26 +1695,35 @@ func (e *LSMEngine) GetMetrics() map[string]int64 {
 	}
 	e.mu.RUnlock()
 
-	// Khởi tạo tất cả các cấp (L0, L1, L2) để chúng luôn xuất hiện
-	metricsMap["level_0_files"] = 0
-	metricsMap["level_0_bytes"] = 0
-	metricsMap["level_1_files"] = 0
-	metricsMap["level_1_bytes"] = 0
-	metricsMap["level_2_files"] = 0
-	metricsMap["level_2_bytes"] = 0
-
+	// Khởi tạo các cấp L0, L1, L2 để chúng luôn xuất hiện; các cấp sâu hơn
+	// xuất hiện khi có trong Version. keys/tombstones là ước lượng theo số
+	// entry của từng tệp (chưa trừ các phiên bản cũ bị che ở cấp trên).
+	for level := 0; level <= 2; level++ {
+		if _, ok := levelsSnapshot[level]; !ok {
+			levelsSnapshot[level] = nil
+		}
+	}
+	var totalFiles, totalBytes, totalKeys, totalTombstones int64
 	for level, files := range levelsSnapshot {
-		keyFiles := fmt.Sprintf("level_%d_files", level)
-		keyBytes := fmt.Sprintf("level_%d_bytes", level)
-
-		metricsMap[keyFiles] = int64(len(files))
-
-		var totalBytes int64
+		var bytes, keys, tombstones int64
 		for _, f := range files {
-			totalBytes += f.FileSize
+			bytes += f.FileSize
+			keys += int64(f.KeyCount)
+			tombstones += int64(f.Tombstones)
 		}
-		metricsMap[keyBytes] = totalBytes
-	}
+		metricsMap[fmt.Sprintf("level_%d_files", level)] = int64(len(files))
+		metricsMap[fmt.Sprintf("level_%d_bytes", level)] = bytes
+		metricsMap[fmt.Sprintf("level_%d_keys", level)] = keys
+		metricsMap[fmt.Sprintf("level_%d_tombstones", level)] = tombstones
+		totalFiles += int64(len(files))
+		totalBytes += bytes
+		totalKeys += keys
+		totalTombstones += tombstones
+	}
+	metricsMap["sst_files"] = totalFiles
+	metricsMap["sst_bytes"] = totalBytes
+	metricsMap["sst_keys"] = totalKeys
+	metricsMap["sst_tombstones"] = totalTombstones
 	// --- KẾT THÚC MÃ MỚI ---
 
 	return metricsMap
@@ -0,0 +1,97 @@
+package lsm
+
+import (
+	"log/slog"
+	"time"
+)
+
+// FlushInfo mô tả một lần flush MemTable xuống SSTable L0
+type FlushInfo struct {
+	Path     string // SSTable mới ("" nếu lỗi)
+	Keys     uint32
+	Bytes    int64
+	Duration time.Duration
+	Err      error // nil nếu flush thành công
+}
+
+// CompactionInfo mô tả một lần compaction (Duration/Err chỉ có ở OnCompactionEnd)
+type CompactionInfo struct {
+	FromLevel  int
+	ToLevel    int
+	InputFiles int
+	InputBytes int64
+	Duration   time.Duration
+	Err        error
+}
+
+// WriteStallInfo mô tả một lần ghi bị từ chối vì hàng đợi flush đã đầy
+type WriteStallInfo struct {
+	PendingFlushes int
+	Err            error
+}
+
+// CorruptionInfo mô tả dữ liệu hỏng vừa được phát hiện.
+// Source: "scrubber", "read", "wal" hoặc "compaction".
+type CorruptionInfo struct {
+	Source string
+	Path   string // "" nếu không xác định được tệp
+	Level  int    // -1 nếu không phải SSTable
+	Err    error
+}
+
+// Các hook được gọi đồng bộ từ goroutine của engine (flush worker,
+// compaction worker, scrubber, luồng ghi...): hook phải chạy nhanh và
+// không được gọi ngược lại vào engine. Panic trong hook bị bỏ qua.
+
+func (e *LSMEngine) emitFlush(info FlushInfo) {
+	if fn := e.opts.OnFlush; fn != nil {
+		runHook("OnFlush", func() { fn(info) })
+	}
+}
+
+func (e *LSMEngine) emitCompactionStart(info CompactionInfo) {
+	if fn := e.opts.OnCompactionStart; fn != nil {
+		runHook("OnCompactionStart", func() { fn(info) })
+	}
+}
+
+func (e *LSMEngine) emitCompactionEnd(info CompactionInfo) {
+	if fn := e.opts.OnCompactionEnd; fn != nil {
+		runHook("OnCompactionEnd", func() { fn(info) })
+	}
+}
+
+func (e *LSMEngine) emitWriteStall(info WriteStallInfo) {
+	if fn := e.opts.OnWriteStall; fn != nil {
+		runHook("OnWriteStall", func() { fn(info) })
+	}
+}
+
+// reportCorruption ghi nhận tệp hỏng (mỗi tệp chỉ báo một lần) và gọi OnCorruption
+func (e *LSMEngine) reportCorruption(info CorruptionInfo) {
+	if info.Path != "" {
+		e.scrubMu.Lock()
+		_, known := e.scrubBadFiles[info.Path]
+		e.scrubBadFiles[info.Path] = struct{}{}
+		e.scrubMu.Unlock()
+		if known {
+			return // Đã báo lỗi tệp này rồi, tránh spam log
+		}
+	}
+	slog.Error("Data corruption detected", "source", info.Source, "path", info.Path,
+		"level", info.Level, "error", info.Err)
+
+	if fn := e.opts.OnCorruption; fn != nil {
+		runHook("OnCorruption", func() { fn(info) })
+	}
+}
+
+// runHook chạy hook của ứng dụng, không để panic làm sập engine
+func runHook(name string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("Engine hook panicked", "hook", name, "panic", r)
+		}
+	}()
+	fn()
+}
@@ -0,0 +1,54 @@
+package lsm
+
+import (
+	"errors"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// FindOneAndUpdate đọc giá trị hiện tại, gọi fn và ghi kết quả trong khi
+// giữ khóa của key, nên không lần ghi nào khác vào key bị mất giữa chừng.
+// Key chưa tồn tại: fn nhận old == nil.
+func (e *LSMEngine) FindOneAndUpdate(key []byte, fn func(old []byte) ([]byte, error)) ([]byte, []byte, error) {
+	unlock := e.keyLocks.lock(key)
+	defer unlock()
+
+	old, err := e.Get(key)
+	if err != nil && !errors.Is(err, engine.ErrKeyNotFound) {
+		return nil, nil, err
+	}
+	val, err := fn(old)
+	if err != nil || val == nil {
+		return old, nil, err
+	}
+
+	e.metrics.puts.Add(1)
+	b := NewBatch()
+	b.Put(key, val)
+	if err := e.writeBatch(b); err != nil {
+		return old, nil, err
+	}
+	return old, val, nil
+}
+
+// FindOneAndDelete xóa key (nếu match) trong khi giữ khóa của key
+func (e *LSMEngine) FindOneAndDelete(key []byte, match func(old []byte) bool) ([]byte, error) {
+	unlock := e.keyLocks.lock(key)
+	defer unlock()
+
+	old, err := e.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if match != nil && !match(old) {
+		return nil, nil
+	}
+
+	e.metrics.deletes.Add(1)
+	b := NewBatch()
+	b.Delete(key)
+	if err := e.writeBatch(b); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
@@ -0,0 +1,114 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// ErrUnsupportedFormat: tệp SSTable không phải định dạng mà bản build này đọc được
+// (version lạ, thiếu magic number - có thể do bản MiniDBGo mới hơn ghi, hoặc không phải SSTable)
+var ErrUnsupportedFormat = errors.New("unsupported sstable format")
+
+// sstMagic nằm ở 8 byte cuối tệp từ SSTVersion 5 ("MDBGOSST")
+const sstMagic uint64 = 0x5453534f4742444d
+
+// sstFormat mô tả bố cục của một version SSTable. Mọi chỗ đọc tệp tra
+// theo các field ở đây thay vì so sánh số version trực tiếp.
+type sstFormat struct {
+	version       uint32
+	footerSize    int64 // Gồm cả magic nếu có
+	magic         bool  // Footer kết thúc bằng sstMagic
+	blockCodec    bool  // Trailer của data block có codec byte (nén)
+	restartBlocks bool  // Data block rút gọn key theo tiền tố, có restart point
+	blockedBloom  bool  // Bloom filter dạng block, hash bằng xxhash
+	checksums     bool  // CRC cho index, bloom, properties và footer; có properties block
+	valuePointers bool  // Entry có thể là con trỏ vào value log (entryValuePointer)
+	// partitionedIndex: Index Block có byte kind, có thể trỏ tới index partition
+	partitionedIndex bool
+	updatedAt        bool // Entry có thể kèm thời điểm commit (entryUpdatedAt)
+	seqnos           bool // Entry có thể kèm seqno của lần ghi (entrySeq)
+	blockSize        bool // Footer có kích thước data block của tệp
+	expiry           bool // Entry có thể kèm thời điểm hết hạn (entryExpiresAt)
+	description      string
+}
+
+// sstFormats là registry các định dạng đọc được; SSTVersion là định dạng ghi.
+// Thêm định dạng mới: thêm phần tử ở đây và tăng SSTVersion.
+var sstFormats = map[uint32]*sstFormat{
+	1: {version: 1, footerSize: SSTFooterSize,
+		description: "block index, bloom filter, crc per block"},
+	2: {version: 2, footerSize: SSTFooterSize, blockCodec: true,
+		description: "compressed data blocks (snappy/zstd)"},
+	3: {version: 3, footerSize: SSTFooterSize, blockCodec: true, restartBlocks: true,
+		description: "prefix-compressed keys with restart points"},
+	4: {version: 4, footerSize: SSTFooterSize, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		description: "cache-line blocked bloom filter (xxhash)"},
+	5: {version: 5, footerSize: SSTFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		description: "magic number in footer"},
+	6: {version: 6, footerSize: SSTFooterSize + sstChecksumFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, description: "index/bloom/footer checksums and properties block"},
+	7: {version: 7, footerSize: SSTFooterSize + sstChecksumFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, description: "value log pointers for large values"},
+	8: {version: 8, footerSize: SSTFooterSize + sstChecksumFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, partitionedIndex: true, description: "two-level (partitioned) index for large files"},
+	9: {version: 9, footerSize: SSTFooterSize + sstChecksumFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, partitionedIndex: true, updatedAt: true, description: "per-entry commit timestamp"},
+	10: {version: 10, footerSize: SSTFooterSize + sstChecksumFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, partitionedIndex: true, updatedAt: true, seqnos: true, description: "per-entry sequence number"},
+	11: {version: 11, footerSize: SSTFooterSize + sstChecksumFooterSize + sstBlockSizeFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, partitionedIndex: true, updatedAt: true, seqnos: true, blockSize: true,
+		description: "data block size in footer, per-collection block sizes"},
+	12: {version: 12, footerSize: SSTFooterSize + sstChecksumFooterSize + sstBlockSizeFooterSize + 8, magic: true, blockCodec: true, restartBlocks: true, blockedBloom: true,
+		checksums: true, valuePointers: true, partitionedIndex: true, updatedAt: true, seqnos: true, blockSize: true, expiry: true,
+		description: "per-entry expiry time (document TTL)"},
+}
+
+// lookupSSTFormat trả về định dạng của version, hoặc lỗi ErrUnsupportedFormat
+func lookupSSTFormat(version uint32) (*sstFormat, error) {
+	if f, ok := sstFormats[version]; ok {
+		return f, nil
+	}
+	return nil, fmt.Errorf("%w: version %d (this build reads 1-%d)", ErrUnsupportedFormat, version, SSTVersion)
+}
+
+// checkSSTFormats đọc header/footer của mọi SSTable trong version khi mở CSDL,
+// để định dạng lạ làm OpenLSM lỗi ngay thay vì lỗi rải rác ở các lần Get sau.
+// Lỗi khác (thiếu tệp, tệp hỏng) chỉ được ghi log như trước đây.
+// Tệp chưa có số tombstone trong MANIFEST được điền từ properties block.
+func checkSSTFormats(v *Version) error {
+	for _, files := range v.Levels {
+		for _, meta := range files {
+			err := checkSSTFile(meta)
+			if errors.Is(err, ErrUnsupportedFormat) {
+				return fmt.Errorf("sst %s: %w", filepath.Base(meta.Path), err)
+			}
+			if err != nil {
+				slog.Warn("Cannot read SSTable footer", "component", "lsm", "path", meta.Path, "error", err)
+			}
+		}
+	}
+	return nil
+}
+
+func checkSSTFile(meta *FileMetadata) error {
+	f, err := os.Open(meta.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	ft, err := readFooter(f, stat.Size())
+	if err != nil || meta.Tombstones != 0 {
+		return err
+	}
+	if props, err := readProperties(f, ft); err == nil && props != nil {
+		meta.Tombstones = uint32(props.Tombstones)
+	}
+	return nil
+}
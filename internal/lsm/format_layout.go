@@ -0,0 +1,569 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Mô tả bố cục nhị phân hiện tại của WAL, SSTable, value log và MANIFEST
+// (lệnh formats), để công cụ bên ngoài và script khôi phục đọc được tệp mà
+// không phải đoán từ code. Mỗi bố cục được đối chiếu với output thật của
+// encoder tương ứng (appendRecord, SSTWriter, valueLog.append...) trước khi
+// trả về: mô tả lệch với code làm DescribeFormats lỗi thay vì in tài liệu sai.
+
+// FormatField là một field trong bố cục
+type FormatField struct {
+	Name     string `json:"name"`
+	Offset   string `json:"offset"`   // Tính từ đầu cấu trúc, vd. "13+keyLen"; footer: "EOF-88"
+	Size     string `json:"size"`     // Số byte, hoặc biểu thức theo field khác
+	Encoding string `json:"encoding"` // u8, u32le, u64le, uvarint, bytes
+	When     string `json:"when,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// FormatLayout là bố cục của một cấu trúc trên đĩa
+type FormatLayout struct {
+	Name    string        `json:"name"`
+	Summary string        `json:"summary"`
+	Fields  []FormatField `json:"fields"`
+}
+
+// FormatFlag là một giá trị (hoặc bit) của byte flag
+type FormatFlag struct {
+	Scope string `json:"scope"`
+	Name  string `json:"name"`
+	Value byte   `json:"value"`
+	Note  string `json:"note"`
+}
+
+// SSTVersionInfo là một version SSTable mà bản build này đọc được
+type SSTVersionInfo struct {
+	Version     uint32 `json:"version"`
+	FooterSize  int64  `json:"footerSize"`
+	Description string `json:"description"`
+}
+
+// ManifestField là một field JSON của MANIFEST
+type ManifestField struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+}
+
+// StorageFormats là kết quả của DescribeFormats
+type StorageFormats struct {
+	SSTVersion  uint32           `json:"sstVersion"` // Version được ghi
+	SSTVersions []SSTVersionInfo `json:"sstVersions"`
+	Encoding    string           `json:"encoding"`
+	Flags       []FormatFlag     `json:"flags"`
+	Layouts     []FormatLayout   `json:"layouts"`
+	Properties  []string         `json:"properties"` // Tên property trong tệp SSTable mới ghi
+	// MANIFEST là JSON (không phải nhị phân): Manifest liệt kê các field
+	ManifestSummary string          `json:"manifestSummary"`
+	Manifest        []ManifestField `json:"manifest"`
+}
+
+// layoutField là field của bố cục kèm thông tin để đối chiếu với mẫu
+type layoutField struct {
+	name string
+	enc  string // u8, u32le, u64le, uvarint, bytes
+	// sizeOf: field bytes lấy độ dài từ field đã đọc; rỗng thì từ lens của lần kiểm tra
+	sizeOf string
+	size   string // Biểu thức độ dài hiển thị (mặc định: sizeOf)
+	// Chỉ có mặt khi field flag đã đọc có bit này
+	whenBit byte
+	note    string
+}
+
+type layoutSpec struct {
+	name    string
+	summary string
+	fromEnd bool // Offset tính từ cuối tệp (footer)
+	fields  []layoutField
+}
+
+func encSize(enc string) int {
+	switch enc {
+	case "u8":
+		return 1
+	case "u32le":
+		return 4
+	case "u64le":
+		return 8
+	}
+	return 0
+}
+
+// describe tính offset (hằng số cộng các độ dài biến đổi đứng trước) cho từng field
+func (s layoutSpec) describe() FormatLayout {
+	out := FormatLayout{Name: s.name, Summary: s.summary}
+	total := 0
+	for _, f := range s.fields {
+		total += encSize(f.enc)
+	}
+	fixed, vars := 0, []string{}
+	for _, f := range s.fields {
+		ff := FormatField{Name: f.name, Encoding: f.enc, Note: f.note}
+		switch {
+		case s.fromEnd:
+			ff.Offset = fmt.Sprintf("EOF-%d", total-fixed)
+		case len(vars) == 0:
+			ff.Offset = strconv.Itoa(fixed)
+		case fixed == 0:
+			ff.Offset = strings.Join(vars, "+")
+		default:
+			ff.Offset = strings.Join(append([]string{strconv.Itoa(fixed)}, vars...), "+")
+		}
+		if f.whenBit != 0 {
+			ff.When = fmt.Sprintf("flag & %#02x", f.whenBit)
+		}
+		switch n := encSize(f.enc); {
+		case n > 0:
+			ff.Size = strconv.Itoa(n)
+			if f.whenBit != 0 {
+				vars = append(vars, fmt.Sprintf("(%s?%d)", f.name, n))
+			} else {
+				fixed += n
+			}
+		case f.enc == "uvarint":
+			ff.Size = "1-10"
+			vars = append(vars, "len("+f.name+")")
+		default:
+			ff.Size = f.size
+			if ff.Size == "" {
+				ff.Size = f.sizeOf
+			}
+			vars = append(vars, f.name+"Len")
+			if f.sizeOf != "" {
+				vars[len(vars)-1] = f.sizeOf
+			}
+		}
+		out.Fields = append(out.Fields, ff)
+	}
+	return out
+}
+
+// check đọc một cấu trúc theo spec từ b: field số có trong want phải bằng
+// giá trị mẫu, field bytes không có sizeOf lấy độ dài từ lens. Trả về số
+// byte đã đọc và các giá trị số đã đọc.
+func (s layoutSpec) check(b []byte, want map[string]uint64, lens map[string]int) (int, map[string]uint64, error) {
+	got := make(map[string]uint64)
+	pos := 0
+	fail := func(f layoutField, msg string, args ...interface{}) error {
+		return fmt.Errorf("layout %q does not match the encoder at field %q (offset %d): %s",
+			s.name, f.name, pos, fmt.Sprintf(msg, args...))
+	}
+	for _, f := range s.fields {
+		if f.whenBit != 0 && byte(got["flag"])&f.whenBit == 0 {
+			continue
+		}
+		var v uint64
+		switch f.enc {
+		case "u8", "u32le", "u64le":
+			n := encSize(f.enc)
+			if pos+n > len(b) {
+				return 0, nil, fail(f, "truncated")
+			}
+			switch n {
+			case 1:
+				v = uint64(b[pos])
+			case 4:
+				v = uint64(binary.LittleEndian.Uint32(b[pos:]))
+			default:
+				v = binary.LittleEndian.Uint64(b[pos:])
+			}
+			pos += n
+		case "uvarint":
+			x, n := binary.Uvarint(b[pos:])
+			if n <= 0 {
+				return 0, nil, fail(f, "bad uvarint")
+			}
+			v, pos = x, pos+n
+		default:
+			n, ok := lens[f.name]
+			if f.sizeOf != "" {
+				n, ok = int(got[f.sizeOf]), true
+			}
+			if !ok || pos+n > len(b) {
+				return 0, nil, fail(f, "length %d out of range", n)
+			}
+			pos += n
+			continue
+		}
+		if w, ok := want[f.name]; ok && w != v {
+			return 0, nil, fail(f, "got %d, want %d", v, w)
+		}
+		got[f.name] = v
+	}
+	return pos, got, nil
+}
+
+// checkExact như check nhưng b phải được đọc hết
+func (s layoutSpec) checkExact(b []byte, want map[string]uint64, lens map[string]int) (map[string]uint64, error) {
+	n, got, err := s.check(b, want, lens)
+	if err == nil && n != len(b) {
+		err = fmt.Errorf("layout %q does not match the encoder: %d of %d bytes described", s.name, n, len(b))
+	}
+	return got, err
+}
+
+var (
+	walRecordLayout = layoutSpec{name: "wal.record", summary: "WAL segment wal-<n>.log: records back to back, replay stops at the first torn/corrupt record of the newest segment", fields: []layoutField{
+		{name: "crc", enc: "u32le", note: "CRC32-C over flag + key + value"},
+		{name: "keyLen", enc: "u32le"},
+		{name: "valueLen", enc: "u32le", note: "includes updatedAt/seq/expiresAt when present"},
+		{name: "flag", enc: "u8", note: "see flags (wal)"},
+		{name: "key", enc: "bytes", sizeOf: "keyLen"},
+		{name: "updatedAt", enc: "u64le", whenBit: walUpdatedAt, note: "commit time, Unix nanoseconds"},
+		{name: "seq", enc: "u64le", whenBit: walSeq, note: "sequence number"},
+		{name: "expiresAt", enc: "u64le", whenBit: walExpiresAt, note: "document expiry (_ttl/_expiresAt), Unix nanoseconds"},
+		{name: "value", enc: "bytes", size: "valueLen-8*(present updatedAt/seq/expiresAt)", note: "empty for tombstones; batch payload when flag & 0x04"},
+	}}
+	walBatchLayout = layoutSpec{name: "wal.batch", summary: "value of a record with flag & 0x04 (key empty): the whole batch is applied or dropped as one record", fields: []layoutField{
+		{name: "count", enc: "u32le", note: "followed by count wal.batch.entry"},
+	}}
+	walBatchEntryLayout = layoutSpec{name: "wal.batch.entry", summary: "one entry of a batch record (no CRC of its own)", fields: []layoutField{
+		{name: "flag", enc: "u8"},
+		{name: "keyLen", enc: "u32le"},
+		{name: "valueLen", enc: "u32le"},
+		{name: "key", enc: "bytes", sizeOf: "keyLen"},
+		{name: "updatedAt", enc: "u64le", whenBit: walUpdatedAt},
+		{name: "seq", enc: "u64le", whenBit: walSeq},
+		{name: "expiresAt", enc: "u64le", whenBit: walExpiresAt},
+		{name: "value", enc: "bytes", size: "valueLen-8*(present updatedAt/seq/expiresAt)"},
+	}}
+
+	sstHeaderLayout = layoutSpec{name: "sst.header", summary: "first bytes of an .sst file; data blocks start right after it", fields: []layoutField{
+		{name: "version", enc: "u32le", note: "see sstVersions"},
+		{name: "count", enc: "u32le", note: "number of entries"},
+	}}
+	sstEntryLayout = layoutSpec{name: "sst.block.entry", summary: "entry of a data block; key is prefix-compressed against the previous entry, shared = 0 at restart points", fields: []layoutField{
+		{name: "shared", enc: "uvarint", note: "bytes shared with the previous key"},
+		{name: "unshared", enc: "uvarint"},
+		{name: "valueLen", enc: "uvarint", note: "includes updatedAt/seq/expiresAt when present"},
+		{name: "flag", enc: "u8", note: "see flags (sst-entry)"},
+		{name: "keySuffix", enc: "bytes", sizeOf: "unshared"},
+		{name: "updatedAt", enc: "u64le", whenBit: entryUpdatedAt},
+		{name: "seq", enc: "u64le", whenBit: entrySeq},
+		{name: "expiresAt", enc: "u64le", whenBit: entryExpiresAt},
+		{name: "value", enc: "bytes", size: "valueLen-8*(present updatedAt/seq/expiresAt)", note: "value log pointer when the low bits are 2"},
+	}}
+	sstRestartsLayout = layoutSpec{name: "sst.block.restarts", summary: fmt.Sprintf("end of a data block (before compression): restart offsets, one every %d entries", blockRestartInterval), fields: []layoutField{
+		{name: "restarts", enc: "bytes", size: "4*n", note: "u32le offsets of the restart entries"},
+		{name: "n", enc: "u32le"},
+	}}
+	sstTrailerLayout = layoutSpec{name: "sst.block.trailer", summary: "after each data block and index partition; the block length comes from the index", fields: []layoutField{
+		{name: "codec", enc: "u8", note: "0 none, 1 snappy, 2 zstd"},
+		{name: "crc", enc: "u32le", note: "CRC32-C over the stored (compressed) block + codec"},
+	}}
+	sstIndexLayout = layoutSpec{name: "sst.index", summary: "index block at footer.indexOffset", fields: []layoutField{
+		{name: "kind", enc: "u8", note: "0 flat (entries point at data blocks), 1 partitioned (entries point at index partitions)"},
+		{name: "count", enc: "u32le", note: "followed by count sst.index.entry; partitions use the same encoding without kind"},
+	}}
+	sstIndexEntryLayout = layoutSpec{name: "sst.index.entry", fields: []layoutField{
+		{name: "lastKeyLen", enc: "u32le"},
+		{name: "lastKey", enc: "bytes", sizeOf: "lastKeyLen", note: "last key of the block"},
+		{name: "offset", enc: "u64le"},
+		{name: "length", enc: "u64le", note: "stored length without trailer"},
+	}}
+	sstPropertyLayout = layoutSpec{name: "sst.property", summary: "properties block at footer.propsOffset: pairs until the end of the block; integers are uvarint-encoded values, unknown names are skipped", fields: []layoutField{
+		{name: "nameLen", enc: "uvarint"},
+		{name: "name", enc: "bytes", sizeOf: "nameLen"},
+		{name: "valueLen", enc: "uvarint"},
+		{name: "value", enc: "bytes", sizeOf: "valueLen"},
+	}}
+	sstFooterLayout = layoutSpec{name: "sst.footer", summary: "last bytes of the file; the bloom filter at bloomOffset is a raw bit array of bloomBits bits", fromEnd: true, fields: []layoutField{
+		{name: "indexOffset", enc: "u64le"},
+		{name: "indexLen", enc: "u64le"},
+		{name: "bloomOffset", enc: "u64le"},
+		{name: "bloomLen", enc: "u64le"},
+		{name: "bloomBits", enc: "u64le"},
+		{name: "bloomHashes", enc: "u32le"},
+		{name: "propsOffset", enc: "u64le"},
+		{name: "propsLen", enc: "u64le"},
+		{name: "indexCrc", enc: "u32le"},
+		{name: "bloomCrc", enc: "u32le"},
+		{name: "propsCrc", enc: "u32le"},
+		{name: "blockSize", enc: "u32le", note: "data block size of the file; collections with their own size are in property collection_block_sizes"},
+		{name: "footerCrc", enc: "u32le", note: "CRC32-C over the 8-byte header + footer bytes before this field"},
+		{name: "magic", enc: "u64le", note: fmt.Sprintf("%#x (\"MDBGOSST\")", sstMagic)},
+	}}
+
+	vlogRecordLayout = layoutSpec{name: "vlog.record", summary: "value log vlog-<id>.log: records back to back", fields: []layoutField{
+		{name: "crc", enc: "u32le", note: "CRC32-C over the rest of the record"},
+		{name: "keyLen", enc: "uvarint"},
+		{name: "valueLen", enc: "uvarint"},
+		{name: "key", enc: "bytes", sizeOf: "keyLen"},
+		{name: "value", enc: "bytes", sizeOf: "valueLen"},
+	}}
+	vlogPointerLayout = layoutSpec{name: "vlog.pointer", summary: "value of an SSTable entry whose flag low bits are 2", fields: []layoutField{
+		{name: "file", enc: "uvarint", note: "vlog file id"},
+		{name: "offset", enc: "uvarint"},
+		{name: "length", enc: "uvarint", note: "length of the whole record"},
+	}}
+)
+
+// DescribeFormats trả về bố cục định dạng hiện tại sau khi đối chiếu với
+// output của các encoder (ghi tệp mẫu vào thư mục tạm)
+func DescribeFormats() (*StorageFormats, error) {
+	tmp, err := os.MkdirTemp("", "minidb-formats-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	out := &StorageFormats{
+		SSTVersion: SSTVersion,
+		Encoding:   "integers little-endian unless uvarint; checksums are CRC32-C (Castagnoli)",
+		Flags: []FormatFlag{
+			{"wal", "delete", walDelete, "record deletes the key"},
+			{"wal", "updatedAt", walUpdatedAt, "value starts with the commit time"},
+			{"wal", "batch", walBatch, "value is a wal.batch"},
+			{"wal", "seq", walSeq, "value has the sequence number (after updatedAt)"},
+			{"wal", "expiresAt", walExpiresAt, "value has the document expiry time (after seq)"},
+			{"sst-entry", "value", entryValue, "low bits"},
+			{"sst-entry", "tombstone", entryTombstone, "low bits"},
+			{"sst-entry", "valuePointer", entryValuePointer, "low bits: value is a vlog.pointer"},
+			{"sst-entry", "updatedAt", entryUpdatedAt, "bit: value starts with the commit time"},
+			{"sst-entry", "seq", entrySeq, "bit: value has the sequence number (after updatedAt)"},
+			{"sst-entry", "expiresAt", entryExpiresAt, "bit: value has the document expiry time (after seq)"},
+		},
+	}
+	for v := uint32(1); v <= SSTVersion; v++ {
+		if f, ok := sstFormats[v]; ok {
+			out.SSTVersions = append(out.SSTVersions, SSTVersionInfo{v, f.footerSize, f.description})
+		}
+	}
+
+	if err := checkWALLayouts(); err != nil {
+		return nil, err
+	}
+	props, err := checkSSTLayouts(tmp)
+	if err != nil {
+		return nil, err
+	}
+	out.Properties = props
+	if err := checkValueLogLayouts(tmp); err != nil {
+		return nil, err
+	}
+	for _, s := range []layoutSpec{walRecordLayout, walBatchLayout, walBatchEntryLayout,
+		sstHeaderLayout, sstEntryLayout, sstRestartsLayout, sstTrailerLayout, sstIndexLayout,
+		sstIndexEntryLayout, sstPropertyLayout, sstFooterLayout, vlogRecordLayout, vlogPointerLayout} {
+		out.Layouts = append(out.Layouts, s.describe())
+	}
+	out.ManifestSummary = fmt.Sprintf("%s: one JSON object, rewritten whole through %s.tmp + rename; SSTables not listed in it are orphans", manifestFileName, manifestFileName)
+	out.Manifest = manifestFields("", reflect.TypeOf(Version{}))
+	return out, nil
+}
+
+// Giá trị mẫu: khác 0 để bit entryUpdatedAt/entrySeq/entryExpiresAt được ghi
+const (
+	sampleUpdatedAt = 1_700_000_000_000_000_000
+	sampleSeq       = 42
+	sampleExpiresAt = sampleUpdatedAt + 3600_000_000_000
+)
+
+func checkWALLayouts() error {
+	single := &batchEntry{Key: []byte("k1"), Value: []byte("v"), UpdatedAt: sampleUpdatedAt, Seq: sampleSeq, ExpiresAt: sampleExpiresAt}
+	if _, err := walRecordLayout.checkExact(appendRecord(nil, single), map[string]uint64{
+		"keyLen": 2, "valueLen": 25, "flag": uint64(walUpdatedAt | walSeq | walExpiresAt),
+		"updatedAt": sampleUpdatedAt, "seq": sampleSeq, "expiresAt": sampleExpiresAt,
+	}, map[string]int{"value": 1}); err != nil {
+		return err
+	}
+
+	tomb := &batchEntry{Key: []byte("k2"), Tombstone: true, UpdatedAt: sampleUpdatedAt, Seq: sampleSeq + 1}
+	rec := appendBatchRecord(nil, []*batchEntry{single, tomb})
+	n, _, err := walRecordLayout.check(rec, map[string]uint64{"keyLen": 0, "flag": uint64(walBatch)}, map[string]int{"value": 0})
+	if err != nil {
+		return err
+	}
+	payload := rec[n:]
+	if len(payload) != int(binary.LittleEndian.Uint32(rec[8:])) {
+		return fmt.Errorf("layout %q does not match the encoder: batch payload length", walRecordLayout.name)
+	}
+	n, _, err = walBatchLayout.check(payload, map[string]uint64{"count": 2}, nil)
+	if err != nil {
+		return err
+	}
+	payload = payload[n:]
+	n, _, err = walBatchEntryLayout.check(payload, map[string]uint64{
+		"keyLen": 2, "valueLen": 25, "flag": uint64(walUpdatedAt | walSeq | walExpiresAt), "seq": sampleSeq,
+	}, map[string]int{"value": 1})
+	if err != nil {
+		return err
+	}
+	_, err = walBatchEntryLayout.checkExact(payload[n:], map[string]uint64{
+		"flag": uint64(walDelete | walUpdatedAt | walSeq), "valueLen": 16, "seq": sampleSeq + 1,
+	}, map[string]int{"value": 0})
+	return err
+}
+
+// checkSSTLayouts ghi một SSTable mẫu bằng SSTWriter rồi đọc lại từng phần
+// theo bố cục; trả về tên các property của tệp
+func checkSSTLayouts(dir string) ([]string, error) {
+	path := filepath.Join(dir, "sample.sst")
+	w, err := NewSSTWriter(path, 1, 2, CompressionNone, BloomPolicy{})
+	if err != nil {
+		return nil, err
+	}
+	items := []struct {
+		key  string
+		item *engine.Item
+	}{
+		{"user:1", &engine.Item{Value: []byte(`{"a":1}`), UpdatedAt: sampleUpdatedAt, Seq: sampleSeq, ExpiresAt: sampleExpiresAt}},
+		{"user:2", &engine.Item{Tombstone: true}},
+	}
+	for _, it := range items {
+		if err := w.WriteEntry(it.key, it.item); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ft, err := readFooter(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := sstHeaderLayout.check(data, map[string]uint64{"version": SSTVersion, "count": 2}, nil); err != nil {
+		return nil, err
+	}
+	footerSize := sstFormats[SSTVersion].footerSize
+	if _, err := sstFooterLayout.checkExact(data[int64(len(data))-footerSize:], map[string]uint64{
+		"indexOffset": ft.indexOffset, "indexLen": ft.indexLen, "bloomOffset": ft.bloomOffset,
+		"bloomLen": ft.bloomLen, "bloomBits": ft.bloomN, "bloomHashes": uint64(ft.bloomK),
+		"propsOffset": ft.propsOffset, "propsLen": ft.propsLen, "indexCrc": uint64(ft.indexCrc),
+		"bloomCrc": uint64(ft.bloomCrc), "propsCrc": uint64(ft.propsCrc), "blockSize": SSTDataBlockSize, "magic": sstMagic,
+	}, nil); err != nil {
+		return nil, err
+	}
+
+	// Index Block phẳng với một data block
+	index := data[ft.indexOffset : ft.indexOffset+ft.indexLen]
+	n, _, err := sstIndexLayout.check(index, map[string]uint64{"kind": uint64(indexFlat), "count": 1}, nil)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := sstIndexEntryLayout.checkExact(index[n:], map[string]uint64{"lastKeyLen": uint64(len("user:2")), "offset": SSTHeaderSize}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Data block: hai entry, mảng restart (một restart point) và trailer
+	block := data[SSTHeaderSize : SSTHeaderSize+entry["length"]]
+	n, _, err = sstEntryLayout.check(block, map[string]uint64{
+		"shared": 0, "unshared": 6, "valueLen": 7 + 24, "flag": uint64(entryValue | entryUpdatedAt | entrySeq | entryExpiresAt),
+		"updatedAt": sampleUpdatedAt, "seq": sampleSeq, "expiresAt": sampleExpiresAt,
+	}, map[string]int{"value": 7})
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := sstEntryLayout.check(block[n:], map[string]uint64{
+		"shared": 5, "unshared": 1, "valueLen": 0, "flag": uint64(entryTombstone),
+	}, map[string]int{"value": 0})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sstRestartsLayout.checkExact(block[n+m:], map[string]uint64{"n": 1}, map[string]int{"restarts": 4}); err != nil {
+		return nil, err
+	}
+	trailer := data[SSTHeaderSize+entry["length"]:]
+	if _, _, err := sstTrailerLayout.check(trailer, map[string]uint64{"codec": uint64(codecNone)}, nil); err != nil {
+		return nil, err
+	}
+
+	// Properties: đọc hết block, lấy tên
+	props := data[ft.propsOffset : ft.propsOffset+ft.propsLen]
+	var names []string
+	for len(props) > 0 {
+		nl, k := binary.Uvarint(props)
+		if k <= 0 || k+int(nl) > len(props) {
+			return nil, fmt.Errorf("layout %q does not match the encoder: bad name", sstPropertyLayout.name)
+		}
+		name := string(props[k : k+int(nl)])
+		n, _, err := sstPropertyLayout.check(props, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		props = props[n:]
+	}
+	return names, nil
+}
+
+func checkValueLogLayouts(dir string) error {
+	vlog, err := openValueLog(dir, DefaultValueLogFileSize)
+	if err != nil {
+		return err
+	}
+	defer vlog.close()
+	value := []byte(`{"big":true}`)
+	ptr, err := vlog.append("user:1", value)
+	if err != nil {
+		return err
+	}
+	if err := vlog.sync(); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(valueLogPath(dir, ptr.file))
+	if err != nil {
+		return err
+	}
+	if _, err := vlogRecordLayout.checkExact(data[ptr.offset:ptr.offset+ptr.length], map[string]uint64{
+		"keyLen": uint64(len("user:1")), "valueLen": uint64(len(value)),
+	}, nil); err != nil {
+		return err
+	}
+	_, err = vlogPointerLayout.checkExact(ptr.encode(), map[string]uint64{
+		"file": uint64(ptr.file), "offset": uint64(ptr.offset), "length": uint64(ptr.length),
+	}, nil)
+	return err
+}
+
+// manifestFields liệt kê các field JSON của MANIFEST từ struct Version
+func manifestFields(prefix string, t reflect.Type) []ManifestField {
+	var out []ManifestField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		ft := f.Type
+		switch {
+		case ft.Kind() == reflect.Map && ft.Elem().Kind() == reflect.Slice && ft.Elem().Elem().Kind() == reflect.Ptr:
+			// levels: {"<level>": [FileMetadata...]}
+			out = append(out, ManifestField{Path: path, Type: "object of " + ft.Key().Kind().String() + " -> array"})
+			out = append(out, manifestFields(path+".<"+ft.Key().Kind().String()+">[]", ft.Elem().Elem().Elem())...)
+		case ft.Kind() == reflect.Map:
+			out = append(out, ManifestField{Path: path, Type: "object of " + ft.Key().Kind().String() + " -> " + ft.Elem().Kind().String()})
+		case ft.Kind() == reflect.Slice && ft.Elem().Kind() == reflect.Ptr:
+			// rangeTombstones: [RangeTombstone...]
+			out = append(out, ManifestField{Path: path, Type: "array"})
+			out = append(out, manifestFields(path+"[]", ft.Elem().Elem())...)
+		case ft.Kind() == reflect.Slice:
+			out = append(out, ManifestField{Path: path, Type: "array of " + ft.Elem().Kind().String()})
+		default:
+			out = append(out, ManifestField{Path: path, Type: ft.Kind().String()})
+		}
+	}
+	return out
+}
@@ -0,0 +1,193 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Fuzz các bộ giải mã định dạng trên đĩa (go test -fuzz=FuzzWAL ./internal/lsm,
+// hoặc make fuzz). Yêu cầu: byte hỏng chỉ được trả về lỗi, không panic, không
+// lặp vô hạn, không cấp phát theo độ dài đọc từ dữ liệu. Seed được dựng bằng
+// bộ ghi hiện tại nên luôn theo định dạng mới nhất; input gây lỗi được go test
+// ghi vào testdata/fuzz/<target>.
+
+// fuzzWALSegment dựng một segment có header thế hệ gen chứa các batch
+func fuzzWALSegment(gen uint64, batches ...[]*batchEntry) []byte {
+	buf := binary.LittleEndian.AppendUint64([]byte(walSegmentMagic), gen)
+	for _, entries := range batches {
+		buf = binary.LittleEndian.AppendUint64(buf, gen)
+		buf = appendBatchRecord(buf, entries)
+	}
+	return buf
+}
+
+func FuzzWAL(f *testing.F) {
+	put := &batchEntry{Key: []byte("users:1"), Value: []byte(`{"name":"a"}`), UpdatedAt: 1, Seq: 7, ExpiresAt: 99}
+	del := &batchEntry{Key: []byte("users:2"), Tombstone: true, UpdatedAt: 2, Seq: 8}
+	empty := &batchEntry{Key: []byte("users:3"), Seq: 9}
+	seg := fuzzWALSegment(1, []*batchEntry{put}, []*batchEntry{put, del, empty})
+	// Tệp tái sử dụng: sau bản ghi mới là bản ghi của thế hệ trước
+	recycled := append(fuzzWALSegment(2, []*batchEntry{del}), seg[walSegmentHeader:]...)
+	f.Add([]byte{})
+	f.Add(seg)
+	f.Add(seg[:len(seg)-3])
+	f.Add(recycled)
+	f.Add(appendBatchRecord(appendRecord(nil, put), []*batchEntry{put, del})) // Định dạng cũ không header
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		err := iterateWAL(bytes.NewReader(data), int64(len(data)), func(flag byte, key, value []byte) error {
+			if flag&walBatch != 0 {
+				return decodeWALBatch(value, func(flag byte, key, value []byte) error {
+					_, err := decodeWALEntry(flag, key, value)
+					return err
+				})
+			}
+			_, err := decodeWALEntry(flag, key, value)
+			return err
+		})
+		if err == nil {
+			return
+		}
+		if !errors.Is(err, ErrCorruption) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("unexpected error %v", err)
+		}
+		// Replay cắt tệp tại Offset: phải nằm trong dữ liệu (lỗi trong bản
+		// ghi batch có CRC đúng không mang offset)
+		var recErr *walRecordError
+		if errors.As(err, &recErr) && (recErr.Offset < 0 || recErr.Offset > int64(len(data))) {
+			t.Fatalf("bad record offset in %v", err)
+		}
+	})
+}
+
+// fuzzSSTSeed ghi một SSTable nhỏ theo định dạng hiện tại và trả về nội dung tệp
+func fuzzSSTSeed(f *testing.F, compression Compression) []byte {
+	path := filepath.Join(f.TempDir(), fmt.Sprintf("seed-%s.sst", compression))
+	w, err := NewSSTWriter(path, 0, 64, compression, BloomPolicy{})
+	if err != nil {
+		f.Fatal(err)
+	}
+	w.SetBlockSize(256, nil) // Nhiều block để có index và restart point
+	for i := 0; i < 64; i++ {
+		item := &engine.Item{Value: bytes.Repeat([]byte{byte('a' + i%26)}, 20), UpdatedAt: int64(i), Seq: uint64(i + 1)}
+		switch i % 5 {
+		case 1:
+			item = &engine.Item{Tombstone: true, UpdatedAt: int64(i), Seq: uint64(i + 1)}
+		case 2:
+			item.ExpiresAt = 1 << 40
+		}
+		if err := w.WriteEntry(fmt.Sprintf("users:%03d", i), item); err != nil {
+			f.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		f.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		f.Fatal(err)
+	}
+	return data
+}
+
+// FuzzSSTable: dữ liệu là nội dung một tệp SSTable. Đọc footer, bloom,
+// Index Block rồi tìm lastKey của từng block và duyệt hết từng block.
+func FuzzSSTable(f *testing.F) {
+	for _, c := range []Compression{CompressionNone, CompressionSnappy, CompressionZstd} {
+		f.Add(fuzzSSTSeed(f, c))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bytes.NewReader(data)
+		ft, err := readFooter(r, int64(len(data)))
+		if err != nil {
+			return
+		}
+		bloom, err := readBloom(r, ft)
+		if err != nil {
+			return
+		}
+		if _, err := readProperties(r, ft); err != nil {
+			return
+		}
+		index, err := readIndexBlock(r, ft)
+		if err != nil {
+			return
+		}
+		for _, entry := range index {
+			bloom.MightContain(entry.lastKey)
+			block, _, err := readDataBlock(r, ft.format, entry)
+			if err != nil {
+				continue
+			}
+			fuzzBlock(t, block, ft.format, entry.lastKey)
+		}
+	})
+}
+
+// FuzzDataBlock: byte đầu chọn version định dạng, phần còn lại là một data
+// block đã giải nén (bỏ qua CRC để fuzzer đi sâu vào bộ giải mã entry)
+func FuzzDataBlock(f *testing.F) {
+	data := fuzzSSTSeed(f, CompressionNone)
+	r := bytes.NewReader(data)
+	ft, err := readFooter(r, int64(len(data)))
+	if err != nil {
+		f.Fatal(err)
+	}
+	index, err := readIndexBlock(r, ft)
+	if err != nil {
+		f.Fatal(err)
+	}
+	block, _, err := readDataBlock(r, ft.format, index[0])
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(append([]byte{byte(SSTVersion)}, block...))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) < 2 {
+			return
+		}
+		format, err := lookupSSTFormat(uint32(data[0]))
+		if err != nil {
+			return
+		}
+		fuzzBlock(t, data[1:], format, "")
+	})
+}
+
+// fuzzBlock tìm key, duyệt tuần tự và seek trong block
+func fuzzBlock(t *testing.T, block []byte, format *sstFormat, key string) {
+	if _, err := searchDataBlock(block, format, key); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	it := newBlockIterator(block, format)
+	var keys []string
+	for it.Next() {
+		if len(keys) > len(block) {
+			t.Fatal("block iterator returned more entries than block bytes")
+		}
+		keys = append(keys, it.Key())
+		if it.Value().ValuePointer {
+			decodeValuePointer(it.Value().Value)
+		}
+	}
+	if it.Error() != nil {
+		return
+	}
+	// Block hỏng vẫn có thể duyệt được (vd. restart point lệch) nhưng tìm kiếm
+	// lỗi; ở đây chỉ cần không panic
+	for _, k := range keys {
+		searchDataBlock(block, format, k)
+		seek := newBlockIterator(block, format)
+		seek.seek(k)
+	}
+}
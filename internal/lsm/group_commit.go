@@ -0,0 +1,271 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// DefaultGroupCommitMaxBytes là dung lượng WAL tối đa của một nhóm commit
+const DefaultGroupCommitMaxBytes = 1 << 20 // 1MB
+
+// Group commit: writer đồng thời xếp batch vào commitQueue; writer đứng đầu
+// hàng đợi (leader) gom các batch đang chờ thành một nhóm, ghi cả nhóm xuống
+// WAL bằng một lần flush (và tối đa một lần fsync, xem walDurability), áp vào MemTable rồi
+// báo kết quả cho từng writer. Các writer đến trong lúc leader đang ghi tạo
+// thành nhóm tiếp theo, nên dưới tải cao số lần fsync giảm theo số writer.
+type commitQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*commitReq
+	bytes   int64 // Dung lượng WAL ước tính của pending
+	leading bool  // Đang có leader ghi một nhóm
+
+	groups  atomic.Int64 // Số nhóm đã ghi (số lần ghi WAL)
+	batches atomic.Int64 // Số batch đã ghi qua các nhóm
+
+	delay atomic.Int64 // GroupCommitDelay đang hiệu lực (ns), xem group_commit_tune.go
+	tuner commitTuner
+}
+
+type commitReq struct {
+	b     *lsmBatch
+	bytes int64
+	err   error
+	done  bool
+}
+
+func newCommitQueue(delay time.Duration) *commitQueue {
+	q := &commitQueue{}
+	q.cond = sync.NewCond(&q.mu)
+	q.delay.Store(int64(delay))
+	return q
+}
+
+// walBytes ước tính dung lượng bản ghi WAL của batch (xem appendBatchRecord)
+func (b *lsmBatch) walBytes() int64 {
+	n := int64(walRecordHeader + 4)
+	for _, e := range b.entries {
+		n += walEntryHeader + 16 + int64(len(e.Key)+len(e.Value))
+	}
+	return n
+}
+
+// commit ghi batch qua group commit và trả về khi batch đã nằm trong WAL + MemTable
+func (e *LSMEngine) commit(b *lsmBatch) error {
+	q := e.commits
+	req := &commitReq{b: b, bytes: b.walBytes()}
+
+	q.mu.Lock()
+	q.pending = append(q.pending, req)
+	q.bytes += req.bytes
+	q.cond.Broadcast()
+	for !req.done && (q.leading || q.pending[0] != req) {
+		q.cond.Wait()
+	}
+	if req.done {
+		q.mu.Unlock()
+		return req.err
+	}
+
+	// Leader: chờ thêm batch tối đa GroupCommitDelay (hoặc tới khi đủ GroupCommitMaxBytes)
+	q.leading = true
+	if delay := q.groupCommitDelay(); delay > 0 && q.bytes < e.groupCommitMaxBytes() {
+		expired := false
+		t := time.AfterFunc(delay, func() {
+			q.mu.Lock()
+			expired = true
+			q.cond.Broadcast()
+			q.mu.Unlock()
+		})
+		for !expired && q.bytes < e.groupCommitMaxBytes() {
+			q.cond.Wait()
+		}
+		t.Stop()
+	}
+	group := q.takeGroup(e.groupCommitMaxBytes())
+	q.mu.Unlock()
+
+	e.commitGroup(group)
+	q.groups.Add(1)
+	q.batches.Add(int64(len(group)))
+
+	q.mu.Lock()
+	for _, r := range group {
+		r.done = true
+	}
+	q.leading = false
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	return req.err
+}
+
+// takeGroup lấy các batch đầu hàng đợi tới khi vượt maxBytes (ít nhất một batch).
+// Caller phải giữ q.mu.
+func (q *commitQueue) takeGroup(maxBytes int64) []*commitReq {
+	n, size := 0, int64(0)
+	for n < len(q.pending) && (n == 0 || size+q.pending[n].bytes <= maxBytes) {
+		size += q.pending[n].bytes
+		n++
+	}
+	group := append([]*commitReq(nil), q.pending[:n]...)
+	clear(q.pending[:n])
+	q.pending = q.pending[n:]
+	q.bytes -= size
+	return group
+}
+
+func (e *LSMEngine) groupCommitMaxBytes() int64 {
+	if e.opts.GroupCommitMaxBytes > 0 {
+		return e.opts.GroupCommitMaxBytes
+	}
+	return DefaultGroupCommitMaxBytes
+}
+
+// commitGroup ghi một nhóm batch vào WAL + MemTable và gán lỗi cho từng batch
+func (e *LSMEngine) commitGroup(group []*commitReq) {
+	fail := func(err error) {
+		for _, r := range group {
+			r.err = err
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.shuttingDown {
+		fail(errors.New("database is shutting down"))
+		return
+	}
+	if e.ctx.Err() != nil {
+		fail(errors.New("engine is shutting down"))
+		return
+	}
+
+	// Mọi entry của nhóm cùng một thời điểm commit; seqno tăng dần theo thứ
+	// tự entry (mu đang được giữ nên thứ tự seqno là thứ tự commit)
+	now := time.Now().UnixNano()
+	batches := make([][]*batchEntry, 0, len(group))
+	for _, r := range group {
+		if len(r.b.entries) == 0 {
+			continue
+		}
+		for _, entry := range r.b.entries {
+			entry.UpdatedAt = now
+			entry.Seq = e.lastSeq.Add(1)
+		}
+		batches = append(batches, r.b.entries)
+	}
+	if len(batches) == 0 {
+		return
+	}
+
+	// Cả nhóm xuống WAL trước (mỗi batch một bản ghi nguyên tử); chỉ khi
+	// thành công mới áp vào MemTable để WAL và MemTable không lệch nhau
+	if err := e.wal.AppendBatches(batches, e.groupDurability(group)); err != nil {
+		e.metrics.walErrors.Add(1)
+		if e.wal.Broken() {
+			if serr := e.switchWAL(); serr != nil {
+				slog.Error("Failed to switch to a new WAL segment", "component", "lsm", "error", serr)
+			}
+		}
+		fail(fmt.Errorf("wal append batch: %w", err))
+		return
+	}
+
+	// Bản ghi WAL của cả nhóm nằm trong segment hiện tại nên MemTable chỉ
+	// được xoay sau khi áp xong cả nhóm; lỗi xoay được trả về cho batch làm
+	// MemTable đầy và các batch sau nó, như khi ghi tuần tự
+	firstFull := -1
+	for i, r := range group {
+		for _, entry := range r.b.entries {
+			k := string(entry.Key)
+			if entry.Tombstone {
+				e.mem.Delete(k, entry.UpdatedAt, entry.Seq)
+				atomic.AddInt64(&e.memBytes, int64(len(k)))
+			} else {
+				e.mem.Put(k, entry.Value, entry.UpdatedAt, entry.Seq, entry.ExpiresAt)
+				atomic.AddInt64(&e.memBytes, int64(len(k)+len(entry.Value)))
+			}
+		}
+		if firstFull < 0 && (e.mem.Size() >= e.flushSize || atomic.LoadInt64(&e.memBytes) >= e.maxMemBytes) {
+			firstFull = i
+		}
+	}
+
+	if firstFull >= 0 {
+		if err := e.rotateMemTable(); err != nil {
+			for _, r := range group[firstFull:] {
+				r.err = fmt.Errorf("rotate memtable: %w", err)
+			}
+		}
+		return
+	}
+	// MemTable chưa đầy nhưng segment WAL đã lớn: chỉ chuyển segment. Nhóm
+	// đã nằm trọn trong segment cũ nên lỗi ở đây không làm hỏng lần ghi nào.
+	if limit := e.opts.WALSegmentBytes; limit > 0 && e.wal.Size() >= limit {
+		if err := e.rotateWALSegment(); err != nil {
+			slog.Error("Failed to rotate WAL segment", "component", "lsm", "error", err)
+		}
+	}
+}
+
+// walDurability là chế độ fsync mặc định của engine (Options.WALDurability/WALSync)
+func (e *LSMEngine) walDurability() engine.Durability {
+	switch {
+	case e.opts.WALDurability != engine.DurabilityDefault:
+		return e.opts.WALDurability
+	case e.opts.WALSync:
+		return engine.DurabilityAlways
+	}
+	return engine.DurabilityOS
+}
+
+// groupDurability là chế độ mạnh nhất trong nhóm: chỉ cần một batch
+// DurabilityAlways là cả nhóm được fsync trước khi trả về
+func (e *LSMEngine) groupDurability(group []*commitReq) engine.Durability {
+	mode := engine.DurabilityOS
+	for _, r := range group {
+		d := r.b.durability
+		if d == engine.DurabilityDefault {
+			d = e.walDurability()
+		}
+		mode = max(mode, d)
+	}
+	return mode
+}
+
+// syncWAL là job nền fsync các bản ghi DurabilityEverySec của segment WAL hiện tại
+func (e *LSMEngine) syncWAL() error {
+	e.mu.RLock()
+	w := e.wal
+	e.mu.RUnlock()
+
+	synced, err := w.Sync()
+	if synced {
+		e.metrics.walSyncs.Add(1)
+	}
+	if err == nil {
+		return nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.wal == w && w.Broken() {
+		if serr := e.switchWAL(); serr != nil {
+			slog.Error("Failed to switch to a new WAL segment", "component", "lsm", "error", serr)
+		}
+	}
+	return fmt.Errorf("wal background sync: %w", err)
+}
+
+func (q *commitQueue) export(m map[string]int64) {
+	m["wal_group_commits"] = q.groups.Load()         // Số lần ghi WAL (mỗi nhóm một lần flush/fsync)
+	m["wal_group_commit_batches"] = q.batches.Load() // Số batch đã ghi; chia cho wal_group_commits = cỡ nhóm trung bình
+	m["wal_group_commit_delay_us"] = q.groupCommitDelay().Microseconds()
+	m["wal_group_commit_tune_adjustments"] = q.tuner.adjustments.Load()
+	m["wal_group_commit_tune_batches_per_sec"] = q.tuner.rate.Load() // Lần đo gần nhất của bộ tự chỉnh
+}
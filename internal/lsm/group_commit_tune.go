@@ -0,0 +1,90 @@
+package lsm
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Tự chỉnh GroupCommitDelay (Options.GroupCommitAutoTune): mỗi chu kỳ job nền
+// đo số batch commit được mỗi giây và leo đồi trên các mức groupCommitSteps.
+// Tăng thời gian chờ chỉ được giữ khi thông lượng tăng rõ rệt (gom được nhiều
+// batch hơn mỗi lần ghi/fsync WAL); ngược lại lùi về mức thấp hơn vì chờ làm
+// tăng độ trễ của từng lần ghi. Tải thấp thì về 0.
+var groupCommitSteps = []time.Duration{
+	0, 50 * time.Microsecond, 100 * time.Microsecond, 250 * time.Microsecond,
+	500 * time.Microsecond, time.Millisecond, 2 * time.Millisecond,
+}
+
+const (
+	groupCommitTuneInterval = time.Second
+	groupCommitTuneMinRate  = 200  // Batch/giây; ít hơn thì không có gì để gom
+	groupCommitTuneGain     = 0.05 // Thông lượng phải đổi hơn 5% mới tính là tốt/xấu hơn
+	groupCommitTuneProbe    = 10   // Số chu kỳ giữ nguyên trước khi thử mức cao hơn
+)
+
+// commitTuner là trạng thái của bộ tự chỉnh (chỉ job nền truy cập, trừ các bộ đếm)
+type commitTuner struct {
+	step     int
+	move     int     // Lần chỉnh trước: +1 tăng, -1 giảm, 0 giữ nguyên
+	lastRate float64 // Thông lượng trước lần chỉnh đó
+	held     int
+
+	lastBatches int64
+	lastAt      time.Time
+
+	rate        atomic.Int64 // Batch/giây của chu kỳ vừa đo
+	adjustments atomic.Int64
+}
+
+// groupCommitDelay là thời gian leader chờ gom batch đang hiệu lực
+func (q *commitQueue) groupCommitDelay() time.Duration {
+	return time.Duration(q.delay.Load())
+}
+
+// tuneGroupCommit là job nền của Options.GroupCommitAutoTune
+func (e *LSMEngine) tuneGroupCommit() error {
+	q := e.commits
+	t := &q.tuner
+	now, batches := time.Now(), q.batches.Load()
+	if t.lastAt.IsZero() {
+		t.lastBatches, t.lastAt = batches, now
+		return nil
+	}
+	rate := float64(batches-t.lastBatches) / now.Sub(t.lastAt).Seconds()
+	t.lastBatches, t.lastAt = batches, now
+	t.rate.Store(int64(rate))
+
+	better := rate > t.lastRate*(1+groupCommitTuneGain)
+	worse := rate < t.lastRate*(1-groupCommitTuneGain)
+	prev := t.step
+	move := 0
+	switch {
+	case rate < groupCommitTuneMinRate:
+		t.step = 0
+	case t.move > 0 && better, t.move < 0 && !worse:
+		move = t.move // Hướng vừa đi có lợi (hoặc giảm mà không mất gì): đi tiếp
+	case t.move > 0:
+		move = -1 // Tăng mà không nhanh hơn: quay lại
+	case t.move < 0:
+		t.step++ // Giảm làm chậm đi: quay lại rồi giữ
+	default:
+		if t.held++; t.held >= groupCommitTuneProbe {
+			move = 1
+		}
+	}
+	t.step = min(max(t.step+move, 0), len(groupCommitSteps)-1)
+	if t.step != prev+move {
+		move = 0 // Chạm biên
+	}
+	t.move, t.lastRate = move, rate
+
+	if t.step != prev {
+		t.held = 0
+		q.delay.Store(int64(groupCommitSteps[t.step]))
+		t.adjustments.Add(1)
+		slog.Debug("Group commit delay adjusted", "component", "lsm",
+			"delay", groupCommitSteps[t.step], "batches_per_sec", int64(rate))
+	}
+	return nil
+}
@@ -0,0 +1,602 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// Định dạng key của một index entry:
+//
+//	__idx:<collection>:<field>:<encodedValue>\x00<_id>
+//	__idx:<collection>:<f1,f2>:<encodedValue1>\x00<encodedValue2>\x00<_id>   (compound)
+//
+// encodedValue được mã hóa sao cho thứ tự byte khớp với thứ tự giá trị
+// (tag kiểu + biểu diễn có thể so sánh), nhờ đó có thể quét theo khoảng.
+const indexKeyPrefix = engine.SystemKeyPrefix + "idx:"
+
+// Tag kiểu dữ liệu (thứ tự giống MongoDB: null < number < string < bool)
+const (
+	tagNull   = '0'
+	tagNumber = '2'
+	tagString = '3'
+	tagBool   = '5'
+	tagOther  = '9' // Object trong compound index: sau mọi kiểu khác
+)
+
+const indexBackfillChunk = 1000
+
+// ErrTooManyPendingFlushes được trả về khi hàng đợi flush đã đầy
+var ErrTooManyPendingFlushes = errors.New("too many pending flushes, please retry")
+
+func indexPrefix(collection, field string) string {
+	return indexKeyPrefix + collection + ":" + field + ":"
+}
+
+// encodeIndexValue mã hóa một giá trị JSON thành chuỗi có thứ tự.
+// Trả về false nếu kiểu không được index (object).
+func encodeIndexValue(v interface{}) (string, bool) {
+	switch t := query.Normalize(v).(type) {
+	case nil:
+		return string(tagNull), true
+	case bool:
+		if t {
+			return string(tagBool) + "1", true
+		}
+		return string(tagBool) + "0", true
+	case float64:
+		return string(tagNumber) + encodeSortableFloat(t), true
+	case string:
+		return string(tagString) + t, true
+	}
+	return "", false
+}
+
+// encodeSortableFloat biến float64 thành 16 ký tự hex có thứ tự byte == thứ tự số
+func encodeSortableFloat(f float64) string {
+	bits := math.Float64bits(f)
+	if bits&(1<<63) == 0 {
+		bits ^= 1 << 63 // Số dương: lật bit dấu
+	} else {
+		bits = ^bits // Số âm: lật toàn bộ
+	}
+	return fmt.Sprintf("%016x", bits)
+}
+
+// splitDocKey tách "collection:id"
+func splitDocKey(key string) (string, string, bool) {
+	idx := strings.Index(key, ":")
+	if idx < 0 {
+		return "", "", false
+	}
+	return key[:idx], key[idx+1:], true
+}
+
+// indexKeysForDoc sinh tất cả index entry cho một document.
+// Field có thể là đường dẫn lồng nhau ("address.city").
+// Field dạng mảng sinh một entry cho mỗi phần tử (multikey); nếu multikey
+// khác nil, các index có field mảng trong document được thêm vào đó.
+func indexKeysForDoc(defs []*IndexDef, id string, raw []byte, multikey map[*IndexDef]struct{}) map[string]struct{} {
+	out := make(map[string]struct{})
+	if raw == nil {
+		return out
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return out
+	}
+	for _, def := range defs {
+		if multikey != nil && hasArrayField(def, doc) {
+			multikey[def] = struct{}{}
+		}
+		if def.compound() {
+			for _, enc := range compoundValues(def, doc) {
+				out[indexPrefix(def.Collection, def.Field)+enc+id] = struct{}{}
+			}
+			continue
+		}
+		v, ok := query.GetPath(doc, def.Field)
+		if !ok {
+			continue
+		}
+		values := []interface{}{v}
+		if arr, isArr := v.([]interface{}); isArr {
+			values = arr
+		}
+		for _, val := range values {
+			enc, ok := encodeIndexValue(def.Collation.Value(val))
+			if !ok {
+				continue
+			}
+			out[indexPrefix(def.Collection, def.Field)+enc+"\x00"+id] = struct{}{}
+		}
+	}
+	return out
+}
+
+// compoundValues mã hóa các field của compound index, mỗi phần kết thúc bằng \x00.
+// Khác index một field, document thiếu field vẫn có entry (lưu như null) để
+// mọi document đều nằm trong index và có thể duyệt theo thứ tự của nó.
+// Field dạng mảng sinh một entry cho mỗi phần tử (tích Descartes nếu nhiều mảng).
+func compoundValues(def *IndexDef, doc map[string]interface{}) []string {
+	out := []string{""}
+	for _, field := range def.fields() {
+		v, _ := query.GetPath(doc, field)
+		values := []interface{}{v}
+		if arr, isArr := v.([]interface{}); isArr && len(arr) > 0 {
+			values = arr
+		}
+		parts := make([]string, 0, len(values))
+		for _, val := range values {
+			parts = append(parts, encodeCompoundValue(def.Collation.Value(val))+"\x00")
+		}
+		next := make([]string, 0, len(out)*len(parts))
+		for _, prefix := range out {
+			for _, p := range parts {
+				next = append(next, prefix+p)
+			}
+		}
+		out = next
+	}
+	return out
+}
+
+// hasArrayField: một field của index có giá trị mảng trong doc
+func hasArrayField(def *IndexDef, doc map[string]interface{}) bool {
+	for _, field := range def.fields() {
+		if v, _ := query.GetPath(doc, field); v != nil {
+			if _, isArr := v.([]interface{}); isArr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markMultikey đánh dấu (và lưu vào CATALOG) các index đã chứa giá trị mảng.
+// Planner dựa vào cờ này để không giao hai cận của một khoảng trên index đó.
+func (e *LSMEngine) markMultikey(defs map[*IndexDef]struct{}) {
+	e.catalogMu.Lock()
+	defer e.catalogMu.Unlock()
+	changed := false
+	for def := range defs {
+		if !def.Multikey {
+			def.Multikey, changed = true, true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := e.saveCatalog(); err != nil {
+		slog.Warn("Cannot save catalog after marking multikey index", "error", err)
+	}
+}
+
+func encodeCompoundValue(v interface{}) string {
+	if enc, ok := encodeIndexValue(v); ok {
+		return enc
+	}
+	if _, isArr := v.([]interface{}); isArr {
+		return string(tagNull) // Mảng rỗng
+	}
+	raw, _ := json.Marshal(v)
+	return string(tagOther) + string(raw)
+}
+
+func (e *LSMEngine) hasIndexes() bool {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+	return len(e.catalog.Indexes) > 0 || len(e.catalog.TextIndexes) > 0
+}
+
+// withIndexEntries trả về một batch mới gồm các entry gốc (cộng các lệnh xóa
+// dây chuyền của tham chiếu) và các thay đổi index tương ứng, hoặc
+// *engine.DuplicateKeyError / *engine.ReferenceError nếu batch vi phạm ràng buộc.
+// Caller phải giữ e.indexMu để việc đọc document cũ và ghi là nguyên tử.
+func (e *LSMEngine) withIndexEntries(b *lsmBatch) (*lsmBatch, error) {
+	multikey := make(map[*IndexDef]struct{})
+	e.catalogMu.RLock()
+	// Xóa dây chuyền theo tham chiếu cũng cần bảo trì index nên được thêm trước
+	out, err := e.withReferences(b)
+	if err == nil {
+		out, err = e.indexEntries(out, multikey)
+	}
+	for def := range multikey {
+		if def.Multikey {
+			delete(multikey, def) // Chỉ lấy lock ghi cho index mới gặp mảng lần đầu
+		}
+	}
+	e.catalogMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if len(multikey) > 0 {
+		e.markMultikey(multikey)
+	}
+	return out, nil
+}
+
+// indexEntries là phần việc của withIndexEntries khi đang giữ e.catalogMu (đọc)
+func (e *LSMEngine) indexEntries(b *lsmBatch, multikey map[*IndexDef]struct{}) (*lsmBatch, error) {
+	out := NewBatch()
+	out.entries = append(out.entries, b.entries...)
+
+	// Document mới nhất của mỗi key trong chính batch này (Value nil = đã xóa)
+	pending := make(map[string]*engine.Item)
+	unique := make(uniqueChanges)
+
+	for _, entry := range b.entries {
+		k := string(entry.Key)
+		if engine.IsSystemKey(k) {
+			continue
+		}
+		col, id, ok := splitDocKey(k)
+		if !ok {
+			continue
+		}
+		defs := e.catalog.indexesFor(col)
+		text := e.catalog.findTextIndex(col)
+		if len(defs) == 0 && text == nil {
+			continue
+		}
+
+		old, seen := pending[k]
+		if !seen {
+			if it, err := e.getItem(entry.Key); err == nil {
+				old = it
+			} else {
+				old = &engine.Item{}
+			}
+		}
+		oldDoc := old.Value
+		var newDoc []byte
+		if !entry.Tombstone {
+			newDoc = entry.Value
+		}
+		// Entry index mang thời hạn của document (hết hạn cùng lúc); khi thời
+		// hạn đổi thì cả các entry không đổi giá trị cũng được ghi lại
+		refresh := !entry.Tombstone && (entry.ExpiresAt != 0 || old.ExpiresAt != 0)
+		mark := len(out.entries)
+
+		oldKeys := indexKeysForDoc(defs, id, oldDoc, nil)
+		newKeys := indexKeysForDoc(defs, id, newDoc, multikey)
+		for ik := range oldKeys {
+			if _, keep := newKeys[ik]; !keep {
+				out.Delete([]byte(ik))
+			}
+		}
+		for ik := range newKeys {
+			if _, exists := oldKeys[ik]; !exists || refresh {
+				out.Put([]byte(ik), []byte{})
+			}
+		}
+		unique.record(defs, id, oldKeys, newKeys)
+		if text != nil {
+			withTextEntries(out, text, id, oldDoc, newDoc, refresh)
+		}
+		for _, ie := range out.entries[mark:] {
+			if !ie.Tombstone {
+				ie.ExpiresAt = entry.ExpiresAt
+			}
+		}
+		pending[k] = &engine.Item{Value: newDoc, ExpiresAt: entry.ExpiresAt}
+	}
+	if err := e.checkUnique(unique); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateIndex tạo (hoặc bỏ qua nếu đã có) index trên collection.field
+// và xây dựng index cho các document hiện có.
+func (e *LSMEngine) CreateIndex(collection, field string, opts engine.IndexOptions) error {
+	if collection == "" || field == "" {
+		return errors.New("collection and field are required")
+	}
+	if strings.Contains(collection, ":") {
+		return fmt.Errorf("invalid collection name %q", collection)
+	}
+	if err := validateIndexFields(field); err != nil {
+		return err
+	}
+
+	// Unique index: chặn các lần ghi có bảo trì index cho tới khi backfill xong,
+	// để không document nào lọt qua kiểm tra trong lúc index còn thiếu entry
+	if opts.Unique {
+		e.indexMu.Lock()
+		defer e.indexMu.Unlock()
+	}
+
+	e.catalogMu.Lock()
+	if existing := e.catalog.findIndex(collection, field); existing != nil {
+		e.catalogMu.Unlock()
+		if !query.SameCollation(existing.Collation, opts.Collation) {
+			return fmt.Errorf("%w: %s.%s has collation %s", engine.ErrIndexConflict, collection, field, existing.Collation)
+		}
+		if existing.Unique != opts.Unique {
+			return fmt.Errorf("%w: %s.%s has unique=%v", engine.ErrIndexConflict, collection, field, existing.Unique)
+		}
+		return nil
+	}
+	def := &IndexDef{Collection: collection, Field: field, Collation: opts.Collation, Unique: opts.Unique}
+	e.catalog.Indexes = append(e.catalog.Indexes, def)
+	if err := e.saveCatalog(); err != nil {
+		e.catalog.Indexes = e.catalog.Indexes[:len(e.catalog.Indexes)-1]
+		e.catalogMu.Unlock()
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	e.catalogMu.Unlock()
+
+	// Index đã được đăng ký: các lần ghi mới sẽ tự bảo trì index.
+	// Giờ chỉ cần backfill các document đang có.
+	start := time.Now()
+	count, err := e.backfillIndex(def)
+	if errors.Is(err, engine.ErrDuplicateKey) {
+		// Dữ liệu hiện có vi phạm ràng buộc: chưa entry nào được ghi, bỏ định nghĩa
+		e.dropIndexDef(def)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("backfill index: %w", err)
+	}
+	slog.Info("Index created", "collection", collection, "field", field, "unique", def.Unique,
+		"collation", def.Collation.String(), "entries", count, "duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+// validateIndexFields kiểm tra tên index (một field hoặc "f1,f2,...")
+func validateIndexFields(index string) error {
+	seen := make(map[string]bool)
+	for _, f := range engine.IndexFields(index) {
+		if f == "" || strings.TrimSpace(f) != f {
+			return fmt.Errorf("invalid index field list %q", index)
+		}
+		if seen[f] {
+			return fmt.Errorf("field %q appears twice in index %q", f, index)
+		}
+		seen[f] = true
+	}
+	return nil
+}
+
+// backfillIndex quét collection và ghi index entry cho từng document
+func (e *LSMEngine) backfillIndex(def *IndexDef) (int, error) {
+	prefix := def.Collection + ":"
+	it, err := e.newRangeIterator(prefix, prefixEnd(prefix))
+	if err != nil {
+		return 0, err
+	}
+
+	// Iterator giữ RLock của MemTable, nên phải đóng nó trước khi ghi
+	keys := make([]string, 0)
+	expires := make(map[string]int64) // Entry của document có thời hạn (TTL)
+	multikey := make(map[*IndexDef]struct{})
+	for it.Next() {
+		_, id, _ := splitDocKey(it.Key())
+		item := it.Value()
+		for ik := range indexKeysForDoc([]*IndexDef{def}, id, item.Value, multikey) {
+			keys = append(keys, ik)
+			if item.ExpiresAt != 0 {
+				expires[ik] = item.ExpiresAt
+			}
+		}
+	}
+	iterErr := it.Error()
+	it.Close()
+	if iterErr != nil {
+		return 0, iterErr
+	}
+	if def.Unique {
+		if err := firstDuplicate(def, keys); err != nil {
+			return 0, err
+		}
+	}
+	if len(multikey) > 0 {
+		e.markMultikey(multikey)
+	}
+
+	for i := 0; i < len(keys); i += indexBackfillChunk {
+		end := i + indexBackfillChunk
+		if end > len(keys) {
+			end = len(keys)
+		}
+		b := NewBatch()
+		for _, ik := range keys[i:end] {
+			b.putExpiring([]byte(ik), []byte{}, expires[ik])
+		}
+		if err := e.applyBatchRetry(b); err != nil {
+			return i, err
+		}
+	}
+	return len(keys), nil
+}
+
+// dropIndexDef xóa định nghĩa index khỏi catalog (index chưa có entry nào)
+func (e *LSMEngine) dropIndexDef(def *IndexDef) {
+	e.catalogMu.Lock()
+	defer e.catalogMu.Unlock()
+	for i, d := range e.catalog.Indexes {
+		if d == def {
+			e.catalog.Indexes = append(e.catalog.Indexes[:i], e.catalog.Indexes[i+1:]...)
+			break
+		}
+	}
+	if err := e.saveCatalog(); err != nil {
+		slog.Error("Failed to save catalog after dropping index", "index", def.Field, "error", err)
+	}
+}
+
+// applyBatchRetry ghi batch (không qua bảo trì index),
+// chờ và thử lại khi hàng đợi flush đang đầy.
+// Chỉ dùng cho batch idempotent (ghi lại nhiều lần vẫn an toàn).
+func (e *LSMEngine) applyBatchRetry(b *lsmBatch) error {
+	var err error
+	for attempt := 0; attempt < 50; attempt++ {
+		err = e.applyBatch(b)
+		if !errors.Is(err, ErrTooManyPendingFlushes) {
+			return err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return err
+}
+
+// ListIndexes trả về các field đã được index của collection
+func (e *LSMEngine) ListIndexes(collection string) []string {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	fields := make([]string, 0)
+	for _, def := range e.catalog.indexesFor(collection) {
+		fields = append(fields, def.Field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// IndexInfo trả về tùy chọn của index trên collection.field
+func (e *LSMEngine) IndexInfo(collection, field string) (engine.IndexOptions, bool) {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	def := e.catalog.findIndex(collection, field)
+	if def == nil {
+		return engine.IndexOptions{}, false
+	}
+	return engine.IndexOptions{Collation: def.Collation, Unique: def.Unique, Multikey: def.Multikey}, true
+}
+
+// IndexLookup quét khoảng key của index và trả về danh sách _id.
+// Cận dạng chuỗi được mã hóa theo collation của index.
+func (e *LSMEngine) IndexLookup(collection, field string, r engine.IndexRange) ([]string, error) {
+	return e.IndexScan(collection, field, nil, r)
+}
+
+// IndexScan quét index theo thứ tự key: các giá trị trong eq cố định
+// các field đầu, r giới hạn field kế tiếp. _id được trả về theo thứ tự index.
+func (e *LSMEngine) IndexScan(collection, index string, eq []interface{}, r engine.IndexRange) ([]string, error) {
+	e.catalogMu.RLock()
+	def := e.catalog.findIndex(collection, index)
+	e.catalogMu.RUnlock()
+	if def == nil {
+		return nil, fmt.Errorf("no index on %s.%s", collection, index)
+	}
+	fields := def.fields()
+	if len(eq) > len(fields) || (len(eq) == len(fields) && (r.Lower != nil || r.Upper != nil)) {
+		return nil, fmt.Errorf("too many values for index %s.%s", collection, index)
+	}
+
+	prefix := indexPrefix(collection, index)
+	for _, v := range eq {
+		enc, ok := encodeIndexValue(def.Collation.Value(v))
+		if !ok {
+			return nil, fmt.Errorf("unsupported index value %v", v)
+		}
+		prefix += enc + "\x00"
+	}
+	if def.Collation != nil {
+		r = collateRange(r, def.Collation)
+	}
+	start, end, err := indexScanRange(prefix, r)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := e.newRangeIterator(start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	ids := make([]string, 0)
+	seen := make(map[string]struct{})
+	for it.Next() {
+		k := it.Key()
+		sep := strings.LastIndexByte(k, 0)
+		if sep < 0 {
+			continue
+		}
+		id := k[sep+1:]
+		if _, dup := seen[id]; dup {
+			continue // Multikey: một document có thể xuất hiện nhiều lần
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func collateRange(r engine.IndexRange, coll *query.Collation) engine.IndexRange {
+	collate := func(b *engine.IndexBound) *engine.IndexBound {
+		if b == nil {
+			return nil
+		}
+		return &engine.IndexBound{Value: coll.Value(b.Value), Inclusive: b.Inclusive}
+	}
+	return engine.IndexRange{Lower: collate(r.Lower), Upper: collate(r.Upper)}
+}
+
+// indexScanRange tính khoảng key [start, end) cho một IndexRange.
+// Nếu chỉ có một cận, khoảng được giới hạn trong cùng kiểu dữ liệu
+// (vd: {"$gt": 5} chỉ khớp số, giống MongoDB).
+func indexScanRange(prefix string, r engine.IndexRange) (string, string, error) {
+	start := prefix
+	end := prefix + "\xff"
+
+	var lowerTag, upperTag byte
+	if r.Lower != nil {
+		enc, ok := encodeIndexValue(r.Lower.Value)
+		if !ok {
+			return "", "", fmt.Errorf("unsupported index value %v", r.Lower.Value)
+		}
+		lowerTag = enc[0]
+		if r.Lower.Inclusive {
+			start = prefix + enc + "\x00"
+		} else {
+			start = prefix + enc + "\x01"
+		}
+	}
+	if r.Upper != nil {
+		enc, ok := encodeIndexValue(r.Upper.Value)
+		if !ok {
+			return "", "", fmt.Errorf("unsupported index value %v", r.Upper.Value)
+		}
+		upperTag = enc[0]
+		if r.Upper.Inclusive {
+			end = prefix + enc + "\x01"
+		} else {
+			end = prefix + enc + "\x00"
+		}
+	}
+
+	if r.Lower == nil && r.Upper != nil {
+		start = prefix + string(upperTag)
+	}
+	if r.Upper == nil && r.Lower != nil {
+		end = prefix + string(lowerTag+1)
+	}
+	return start, end, nil
+}
+
+// prefixEnd trả về key nhỏ nhất lớn hơn mọi key có tiền tố prefix
+func prefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return "" // Không có giới hạn trên
+}
@@ -0,0 +1,217 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+)
+
+// Index Block hai tầng (từ SSTVersion 8): Index Block bắt đầu bằng kind(1).
+//   - indexFlat: phần còn lại là danh sách entry của data block như trước;
+//   - indexPartitioned: các entry trỏ tới index partition. Mỗi partition được
+//     ghi như một data block không nén (payload + codec + crc) ngay sau data
+//     block cuối, payload mã hóa giống Index Block phẳng.
+//
+// SSTReader chỉ giữ tầng trên trong bộ nhớ; partition được đọc khi cần và
+// giữ trong block cache như data block.
+const (
+	indexFlat        byte = 0
+	indexPartitioned byte = 1
+
+	// IndexPartitionThreshold: Index Block lớn hơn ngưỡng này (tệp cỡ vài chục
+	// MB trở lên) được chia thành partition
+	IndexPartitionThreshold = 64 * 1024
+
+	// indexPartitionSize: kích thước mục tiêu của mỗi partition
+	indexPartitionSize = 4 * 1024
+)
+
+// encodeIndexEntries: count(4) + [lastKeyLen(4) + lastKey + offset(8) + length(8)]...
+func encodeIndexEntries(entries []blockIndexEntry) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(entries)))
+	for _, entry := range entries {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(len(entry.lastKey)))
+		buf = append(buf, entry.lastKey...)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.offset))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(entry.length))
+	}
+	return buf
+}
+
+// writeIndex trả về Index Block của tệp. Index lớn hơn IndexPartitionThreshold
+// được ghi thành các partition tại currentBlockOffset (sau data block cuối).
+func (w *SSTWriter) writeIndex() ([]byte, error) {
+	flat := encodeIndexEntries(w.indexEntries)
+	if len(flat) <= IndexPartitionThreshold {
+		return append([]byte{indexFlat}, flat...), nil
+	}
+
+	var top []blockIndexEntry
+	for start := 0; start < len(w.indexEntries); {
+		end, size := start, 4
+		for end < len(w.indexEntries) && size < indexPartitionSize {
+			size += 20 + len(w.indexEntries[end].lastKey)
+			end++
+		}
+		part := encodeIndexEntries(w.indexEntries[start:end])
+		crc := crc32.Update(crc32.Checksum(part, crcTable), crcTable, []byte{codecNone})
+		if _, err := w.writer.Write(part); err != nil {
+			return nil, fmt.Errorf("write index partition: %w", err)
+		}
+		if err := w.writer.WriteByte(codecNone); err != nil {
+			return nil, fmt.Errorf("write index partition: %w", err)
+		}
+		if err := binary.Write(w.writer, binary.LittleEndian, crc); err != nil {
+			return nil, fmt.Errorf("write index partition: %w", err)
+		}
+
+		top = append(top, blockIndexEntry{
+			lastKey: w.indexEntries[end-1].lastKey,
+			offset:  w.currentBlockOffset,
+			length:  int64(len(part)),
+		})
+		w.currentBlockOffset += int64(len(part)) + sstFormats[SSTVersion].blockTrailerSize()
+		start = end
+	}
+	return append([]byte{indexPartitioned}, encodeIndexEntries(top)...), nil
+}
+
+// readTopIndex đọc Index Block. partitioned = true: các entry trỏ tới index
+// partition thay vì data block (xem readIndexBlock để lấy mọi data block).
+func readTopIndex(f io.ReaderAt, ft *sstFooter) (entries []blockIndexEntry, partitioned bool, err error) {
+	indexData := make([]byte, ft.indexLen)
+	if _, err := f.ReadAt(indexData, int64(ft.indexOffset)); err != nil {
+		return nil, false, fmt.Errorf("read index block: %w", err)
+	}
+	if ft.format.checksums && crc32.Checksum(indexData, crcTable) != ft.indexCrc {
+		return nil, false, fmt.Errorf("index block checksum mismatch: %w", ErrCorruption)
+	}
+	if ft.format.partitionedIndex {
+		if len(indexData) == 0 || indexData[0] > indexPartitioned {
+			return nil, false, fmt.Errorf("bad index block kind: %w", ErrCorruption)
+		}
+		partitioned, indexData = indexData[0] == indexPartitioned, indexData[1:]
+	}
+	entries, err = parseIndexBlock(indexData)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := checkIndexEntries(entries, ft); err != nil {
+		return nil, false, err
+	}
+	return entries, partitioned, nil
+}
+
+// checkIndexEntries: mọi block mà index trỏ tới nằm trọn trong tệp
+func checkIndexEntries(entries []blockIndexEntry, ft *sstFooter) error {
+	trailer := uint64(ft.format.blockTrailerSize())
+	for _, e := range entries {
+		// offset/length âm đổi sang uint64 thành số rất lớn nên cũng bị loại
+		if uint64(e.length) > ft.end || !blockInFile(uint64(e.offset), uint64(e.length)+trailer, ft.end) {
+			return fmt.Errorf("index entry points outside file (%d+%d): %w", e.offset, e.length, ErrCorruption)
+		}
+	}
+	return nil
+}
+
+// readIndexPartitions đọc và nối các partition mà top trỏ tới
+func readIndexPartitions(f io.ReaderAt, ft *sstFooter, top []blockIndexEntry) ([]blockIndexEntry, error) {
+	var entries []blockIndexEntry
+	for i, p := range top {
+		data, _, err := readDataBlock(f, ft.format, p)
+		if err != nil {
+			return nil, fmt.Errorf("index partition %d: %w", i, err)
+		}
+		part, err := parseIndexBlock(data)
+		if err != nil {
+			return nil, fmt.Errorf("index partition %d: %w", i, err)
+		}
+		if len(part) == 0 || part[len(part)-1].lastKey != p.lastKey {
+			return nil, fmt.Errorf("index partition %d does not end at %q: %w", i, p.lastKey, ErrCorruption)
+		}
+		if err := checkIndexEntries(part, ft); err != nil {
+			return nil, err
+		}
+		entries = append(entries, part...)
+	}
+	return entries, nil
+}
+
+// searchIndexPartition tìm trong partition (đã kiểm tra CRC) entry đầu tiên có
+// lastKey >= key mà không giải mã cả partition (ok = false: không có)
+func searchIndexPartition(data []byte, key string) (entry blockIndexEntry, ok bool, err error) {
+	if len(data) < 4 {
+		return entry, false, fmt.Errorf("index partition too short: %w", ErrCorruption)
+	}
+	n := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+	for i := uint32(0); i < n; i++ {
+		if len(data) < 4 {
+			return entry, false, fmt.Errorf("index partition entry %d: %w", i, ErrCorruption)
+		}
+		klen := uint64(binary.LittleEndian.Uint32(data))
+		if klen+20 > uint64(len(data)) {
+			return entry, false, fmt.Errorf("index partition entry %d: %w", i, ErrCorruption)
+		}
+		if k := data[4 : 4+klen]; string(k) >= key {
+			return blockIndexEntry{
+				lastKey: string(k),
+				offset:  int64(binary.LittleEndian.Uint64(data[4+klen:])),
+				length:  int64(binary.LittleEndian.Uint64(data[12+klen:])),
+			}, true, nil
+		}
+		data = data[20+klen:]
+	}
+	return entry, false, nil
+}
+
+// blockFor trả về entry của data block đầu tiên có lastKey >= key
+// (ok = false: key lớn hơn mọi key của tệp); partition đi qua block cache
+func (r *SSTReader) blockFor(cache *blockCache, key string) (blockIndexEntry, bool, error) {
+	i := sort.Search(len(r.index), func(i int) bool {
+		return r.index[i].lastKey >= key
+	})
+	if i == len(r.index) {
+		return blockIndexEntry{}, false, nil
+	}
+	if !r.partitioned {
+		return r.index[i], true, nil
+	}
+
+	p := r.index[i]
+	data, cached := cache.get(r.path, p.offset)
+	if !cached {
+		var shared bool
+		var err error
+		data, shared, err = readDataBlock(r.f, r.ft.format, p)
+		if err != nil {
+			return blockIndexEntry{}, false, fmt.Errorf("index partition: %w", err)
+		}
+		if shared && cache != nil {
+			data = append([]byte(nil), data...)
+		}
+		cache.add(r.path, p.offset, data)
+	}
+	entry, ok, err := searchIndexPartition(data, key)
+	if err != nil {
+		return entry, false, err
+	}
+	if !ok {
+		// lastKey của partition là lastKey của entry cuối: không thể không thấy
+		return entry, false, fmt.Errorf("index partition does not cover %q: %w", p.lastKey, ErrCorruption)
+	}
+	if err := checkIndexEntries([]blockIndexEntry{entry}, r.ft); err != nil {
+		return entry, false, err
+	}
+	return entry, true, nil
+}
+
+// dataIndex trả về entry của mọi data block (đọc các partition nếu có)
+func (r *SSTReader) dataIndex() ([]blockIndexEntry, error) {
+	if !r.partitioned {
+		return r.index, nil
+	}
+	return readIndexPartitions(r.f, r.ft, r.index)
+}
@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"hash/crc32"
 	"io"
-	"os"
+	"sort"
 
 	"github.com/huandu/skiplist"
 	// --- MỚI: Import engine ---
@@ -44,6 +43,11 @@ func (it *memTableIterator) Next() bool {
 	return true
 }
 
+// Seek tìm phần tử đầu tiên >= key trên skiplist (O(log N))
+func (it *memTableIterator) Seek(key string) {
+	it.node = it.mem.sl.Find(key)
+}
+
 func (it *memTableIterator) Key() string { return it.key }
 
 // --- SỬA ĐỔI: Dùng engine.Item ---
@@ -67,19 +71,36 @@ func (it *memTableIterator) Error() error {
 // Đây là iterator nội bộ, không cần export
 
 type blockIterator struct {
-	r     *bytes.Reader
-	key   string
-	value *engine.Item
-	err   error
+	r      *bytes.Reader
+	key    string
+	value  *engine.Item
+	err    error
+	peeked bool // Entry hiện tại đã được đọc bởi seek nhưng chưa trả về
+
+	// Block v3 (có restart point); r chỉ dùng cho block v1/v2
+	restart bool
+	rb      restartBlock
+	off     int
+	prev    []byte
 }
 
-func newBlockIterator(blockData []byte) *blockIterator {
-	return &blockIterator{
-		r: bytes.NewReader(blockData),
+func newBlockIterator(blockData []byte, format *sstFormat) *blockIterator {
+	if !format.restartBlocks {
+		return &blockIterator{r: bytes.NewReader(blockData)}
 	}
+	it := &blockIterator{restart: true}
+	it.rb, it.err = decodeRestartBlock(blockData)
+	return it
 }
 
 func (it *blockIterator) Next() bool {
+	if it.peeked {
+		it.peeked = false
+		return true
+	}
+	if it.restart {
+		return it.nextRestart()
+	}
 	if it.r.Len() == 0 {
 		return false
 	}
@@ -104,6 +125,10 @@ func (it *blockIterator) Next() bool {
 		it.err = fmt.Errorf("read data flag: %w", err)
 		return false
 	}
+	if int64(klen)+int64(vlen) > int64(it.r.Len()) {
+		it.err = fmt.Errorf("read data entry: %w", io.ErrUnexpectedEOF)
+		return false
+	}
 
 	kb := make([]byte, klen)
 	if _, err = io.ReadFull(it.r, kb); err != nil {
@@ -120,11 +145,42 @@ func (it *blockIterator) Next() bool {
 	}
 
 	it.key = string(kb)
-	it.value = &engine.Item{
-		Value:     vb,
-		Tombstone: flag == 1,
+	it.value, it.err = entryItem(vb, flag)
+	return it.err == nil
+}
+
+func (it *blockIterator) nextRestart() bool {
+	if it.err != nil || it.off >= len(it.rb.data) {
+		return false
+	}
+	k, v, flag, next, err := it.rb.entry(it.off, it.prev)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.key = string(k)
+	it.value, it.err = entryItem(append(make([]byte, 0, len(v)), v...), flag)
+	it.prev, it.off = k, next
+	return it.err == nil
+}
+
+// seek đọc tuần tự trong khối đến entry đầu tiên >= key
+// (block v3: bắt đầu từ restart point gần nhất đứng trước key)
+func (it *blockIterator) seek(key string) {
+	if it.restart && it.err == nil {
+		off, err := it.rb.seekRestart(key)
+		if err != nil {
+			it.err = err
+			return
+		}
+		it.off, it.prev = off, nil
+	}
+	for it.Next() {
+		if it.key >= key {
+			it.peeked = true
+			return
+		}
 	}
-	return true
 }
 
 func (it *blockIterator) Key() string         { return it.key }
@@ -136,8 +192,9 @@ func (it *blockIterator) Close() error        { return nil } // Không làm gì
 // Lặp qua tất cả các khối (block) trong một tệp SSTable
 
 type sstIterator struct {
-	f     *os.File
-	index []blockIndexEntry // Index Block (đọc 1 lần)
+	f      *sstFile
+	format *sstFormat        // Định dạng tệp (trailer và bố cục của data block)
+	index  []blockIndexEntry // Index Block (đọc 1 lần)
 
 	blockIdx  int            // Chỉ số khối (data block) hiện tại
 	blockIter *blockIterator // Iterator cho khối hiện tại
@@ -145,79 +202,43 @@ type sstIterator struct {
 	key   string
 	value *engine.Item
 	err   error
+
+	release   func()     // != nil: f thuộc tableCache, Close trả tham chiếu thay vì đóng f
+	readAhead *readAhead // nil = đọc từng block
 }
 
-// NewSSTableIterator tạo một iterator cho một tệp SSTable
+// NewSSTableIterator tạo một iterator cho một tệp SSTable (đọc bằng pread)
 // Sử dụng logic từ Giai đoạn 1 (Block Index) để tải index
 func NewSSTableIterator(path string) (engine.Iterator, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
-	}
+	return newSSTableIterator(path, false)
+}
 
-	stat, err := f.Stat()
+// newSSTableIterator giống NewSSTableIterator; useMmap: đọc qua mmap, block
+// không nén được duyệt ngay trên vùng ánh xạ (value vẫn được sao chép ra)
+func newSSTableIterator(path string, useMmap bool) (engine.Iterator, error) {
+	f, err := openSSTFile(path, useMmap)
 	if err != nil {
-		f.Close()
 		return nil, err
 	}
 
 	// 1. Đọc Footer (để lấy vị trí Index Block)
-	if stat.Size() < (8 + SSTFooterSize) {
-		f.Close()
-		return nil, fmt.Errorf("file too small or corrupt")
-	}
-	footerData := make([]byte, SSTFooterSize)
-	if _, err := f.ReadAt(footerData, stat.Size()-SSTFooterSize); err != nil {
+	ft, err := readFooter(f, f.size)
+	if err != nil {
 		f.Close()
-		return nil, fmt.Errorf("read footer: %w", err)
+		return nil, err
 	}
 
-	var indexOffset, indexLen uint64
-	// Chúng ta chỉ cần indexOffset và indexLen
-	r := bytes.NewReader(footerData)
-	binary.Read(r, binary.LittleEndian, &indexOffset)
-	binary.Read(r, binary.LittleEndian, &indexLen)
-	// (Bỏ qua phần còn lại của footer vì iterator không cần bloom)
-
 	// 2. Đọc toàn bộ Index Block vào bộ nhớ
-	indexData := make([]byte, indexLen)
-	if _, err := f.ReadAt(indexData, int64(indexOffset)); err != nil {
-		f.Close()
-		return nil, fmt.Errorf("read index block: %w", err)
-	}
-
-	idxReader := bytes.NewReader(indexData)
-	var numEntries uint32
-	if err := binary.Read(idxReader, binary.LittleEndian, &numEntries); err != nil {
+	// (Bỏ qua bloom vì iterator không cần)
+	indexEntries, err := readIndexBlock(f, ft)
+	if err != nil {
 		f.Close()
-		return nil, fmt.Errorf("read index entry count: %w", err)
-	}
-
-	indexEntries := make([]blockIndexEntry, numEntries)
-	for i := 0; i < int(numEntries); i++ {
-		var klen uint32
-		if err := binary.Read(idxReader, binary.LittleEndian, &klen); err != nil {
-			f.Close()
-			return nil, fmt.Errorf("read index entry klen: %w", err)
-		}
-		keyBytes := make([]byte, klen)
-		if _, err := io.ReadFull(idxReader, keyBytes); err != nil {
-			f.Close()
-			return nil, fmt.Errorf("read index entry key: %w", err)
-		}
-		indexEntries[i].lastKey = string(keyBytes)
-		if err := binary.Read(idxReader, binary.LittleEndian, &indexEntries[i].offset); err != nil {
-			f.Close()
-			return nil, fmt.Errorf("read index entry offset: %w", err)
-		}
-		if err := binary.Read(idxReader, binary.LittleEndian, &indexEntries[i].length); err != nil {
-			f.Close()
-			return nil, fmt.Errorf("read index entry length: %w", err)
-		}
+		return nil, err
 	}
 
 	it := &sstIterator{
 		f:        f,
+		format:   ft.format,
 		index:    indexEntries,
 		blockIdx: -1, // Sẽ được +1 khi loadNextBlock
 	}
@@ -232,35 +253,17 @@ func (it *sstIterator) loadNextBlock() bool {
 		return false // Hết khối
 	}
 
-	entry := it.index[it.blockIdx]
-
-	dataBlock := make([]byte, entry.length)
-	if _, err := it.f.ReadAt(dataBlock, entry.offset); err != nil {
-		it.err = fmt.Errorf("read data block: %w", err)
-		return false
-	}
-
-	// --- LOGIC MỚI: ĐỌC VÀ KIỂM TRA CRC ---
-	var storedCrc uint32
-	crcBytes := make([]byte, 4)
-	if _, err := it.f.ReadAt(crcBytes, entry.offset+entry.length); err != nil {
-		it.err = fmt.Errorf("read data block crc: %w", err)
-		return false
+	var src io.ReaderAt = it.f
+	if it.readAhead != nil {
+		src = it.readAhead.source(it.index, it.blockIdx)
 	}
-
-	if err := binary.Read(bytes.NewReader(crcBytes), binary.LittleEndian, &storedCrc); err != nil {
-		it.err = fmt.Errorf("parse data block crc: %w", err)
-		return false
-	}
-
-	calculatedCrc := crc32.Checksum(dataBlock, crcTable)
-	if storedCrc != calculatedCrc {
-		it.err = ErrCorruption // Lỗi! Block SSTable bị hỏng.
+	dataBlock, _, err := readDataBlock(src, it.format, it.index[it.blockIdx])
+	if err != nil {
+		it.err = err
 		return false
 	}
-	// --- KẾT THÚC LOGIC MỚI ---
 
-	it.blockIter = newBlockIterator(dataBlock)
+	it.blockIter = newBlockIterator(dataBlock, it.format)
 	return true
 }
 
@@ -291,6 +294,29 @@ func (it *sstIterator) Next() bool {
 	}
 }
 
+// Seek tìm nhị phân trên Index Block để chọn khối đầu tiên có
+// lastKey >= key, rồi định vị bên trong khối đó.
+// Các khối đứng trước không bị đọc.
+func (it *sstIterator) Seek(key string) {
+	it.blockIter = nil
+	it.err = nil
+
+	i := sort.Search(len(it.index), func(i int) bool {
+		return it.index[i].lastKey >= key
+	})
+	it.blockIdx = i - 1
+	if i == len(it.index) {
+		return // Mọi key đều < key: Next() sẽ trả về false
+	}
+	if !it.loadNextBlock() {
+		return
+	}
+	it.blockIter.seek(key)
+	if err := it.blockIter.Error(); err != nil {
+		it.err = err
+	}
+}
+
 func (it *sstIterator) Key() string {
 	return it.key
 }
@@ -302,9 +328,61 @@ func (it *sstIterator) Value() *engine.Item {
 func (it *sstIterator) Close() error {
 	it.blockIter = nil
 	it.index = nil
+	it.readAhead = nil
+	if it.release != nil {
+		release := it.release
+		it.release = nil
+		release()
+		return nil
+	}
 	return it.f.Close()
 }
 
 func (it *sstIterator) Error() error {
 	return it.err
 }
+
+// --- rangeIterator ---
+// Bọc một iterator khác và chỉ trả về các key trong [start, end)
+
+var _ engine.Iterator = (*rangeIterator)(nil)
+
+type rangeIterator struct {
+	inner engine.Iterator
+	start string
+	end   string // "" = không giới hạn
+	done  bool
+}
+
+func (it *rangeIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	for it.inner.Next() {
+		k := it.inner.Key()
+		if k < it.start {
+			continue
+		}
+		if it.end != "" && k >= it.end {
+			it.done = true
+			return false
+		}
+		return true
+	}
+	it.done = true
+	return false
+}
+
+// Seek không cho phép định vị ra ngoài cận dưới của khoảng
+func (it *rangeIterator) Seek(key string) {
+	if key < it.start {
+		key = it.start
+	}
+	it.done = false
+	it.inner.Seek(key)
+}
+
+func (it *rangeIterator) Key() string         { return it.inner.Key() }
+func (it *rangeIterator) Value() *engine.Item { return it.inner.Value() }
+func (it *rangeIterator) Error() error        { return it.inner.Error() }
+func (it *rangeIterator) Close() error        { return it.inner.Close() }
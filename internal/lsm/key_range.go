@@ -0,0 +1,97 @@
+package lsm
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// KeyRangeStats ước lượng số key và dung lượng của tiền tố prefix mà không
+// đọc data block nào: chỉ dùng Min/MaxKey trong MANIFEST và Index Block
+// (thường đã nằm trong tableCache)
+func (e *LSMEngine) KeyRangeStats(prefix string) (engine.KeyRangeStats, error) {
+	stats := engine.KeyRangeStats{Prefix: prefix, Levels: []engine.LevelKeyRange{}}
+	end := prefixEnd(prefix)
+
+	e.mu.RLock()
+	e.immutMu.RLock()
+	mems := append([]*MemTable{e.mem}, e.immutables...)
+	e.immutMu.RUnlock()
+	levels := make(map[int][]*FileMetadata, len(e.current.Levels))
+	for level, files := range e.current.Levels {
+		levels[level] = files
+	}
+	e.mu.RUnlock()
+
+	for _, m := range mems {
+		keys, bytes := m.PrefixStats(prefix)
+		stats.MemTableKeys += keys
+		stats.MemTableBytes += bytes
+	}
+	stats.Keys, stats.Bytes = stats.MemTableKeys, stats.MemTableBytes
+
+	levelNums := make([]int, 0, len(levels))
+	for level := range levels {
+		levelNums = append(levelNums, level)
+	}
+	sort.Ints(levelNums)
+
+	for _, level := range levelNums {
+		lr := engine.LevelKeyRange{Level: level}
+		for _, meta := range levels[level] {
+			if !fileOverlapsRange(meta, prefix, end) {
+				continue
+			}
+			keys, bytes, err := e.sstRangeEstimate(meta, prefix, end)
+			if err != nil {
+				return stats, fmt.Errorf("estimate %s: %w", meta.Path, err)
+			}
+			lr.Files++
+			lr.Keys += keys
+			lr.Bytes += bytes
+		}
+		if lr.Files == 0 {
+			continue
+		}
+		stats.Levels = append(stats.Levels, lr)
+		stats.Keys += lr.Keys
+		stats.Bytes += lr.Bytes
+	}
+	return stats, nil
+}
+
+// sstRangeEstimate cộng độ dài các data block giao với [start, end) và chia
+// KeyCount của tệp theo tỉ lệ byte. Block ở hai biên được tính trọn nên kết
+// quả có thể lớn hơn thực tế tối đa khoảng hai block mỗi tệp.
+func (e *LSMEngine) sstRangeEstimate(meta *FileMetadata, start, end string) (int64, int64, error) {
+	h, _, err := e.tables.acquire(meta.Path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer e.tables.release(h)
+
+	index, err := h.r.dataIndex()
+	if err != nil {
+		return 0, 0, err
+	}
+	var total, overlap int64
+	for i, b := range index {
+		total += b.length
+		// Block i chứa các key trong (lastKey của block trước, b.lastKey]
+		if b.lastKey < start {
+			continue
+		}
+		if end != "" && i > 0 && index[i-1].lastKey >= end {
+			continue
+		}
+		if end != "" && i == 0 && meta.MinKey >= end {
+			continue
+		}
+		overlap += b.length
+	}
+	if total == 0 || overlap == 0 {
+		return 0, 0, nil
+	}
+	return int64(float64(meta.KeyCount) * float64(overlap) / float64(total)), overlap, nil
+}
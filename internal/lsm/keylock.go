@@ -0,0 +1,62 @@
+package lsm
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Số stripe khóa theo key. Hai key khác nhau có thể dùng chung stripe
+// (chỉ làm giảm song song, không ảnh hưởng tính đúng).
+const keyLockStripes = 256
+
+// keyLocks tuần tự hóa các thao tác ghi trên cùng một key, để
+// FindOneAndUpdate (đọc-sửa-ghi) không bị lần ghi khác chen vào giữa
+type keyLocks struct {
+	stripes [keyLockStripes]sync.Mutex
+}
+
+func keyStripe(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % keyLockStripes)
+}
+
+// lock khóa stripe của một key
+func (l *keyLocks) lock(key []byte) func() {
+	m := &l.stripes[keyStripe(key)]
+	m.Lock()
+	return m.Unlock
+}
+
+// lockBatch khóa stripe của mọi key trong batch
+func (l *keyLocks) lockBatch(b *lsmBatch) func() {
+	keys := make([][]byte, len(b.entries))
+	for i, entry := range b.entries {
+		keys[i] = entry.Key
+	}
+	return l.lockKeys(keys)
+}
+
+// lockKeys khóa stripe của các key theo thứ tự tăng dần
+// (tránh deadlock giữa hai nhóm key chồng lấn nhau)
+func (l *keyLocks) lockKeys(keys [][]byte) func() {
+	seen := make(map[int]struct{}, len(keys))
+	idx := make([]int, 0, len(keys))
+	for _, key := range keys {
+		s := keyStripe(key)
+		if _, dup := seen[s]; !dup {
+			seen[s] = struct{}{}
+			idx = append(idx, s)
+		}
+	}
+	sort.Ints(idx)
+	for _, s := range idx {
+		l.stripes[s].Lock()
+	}
+	return func() {
+		for _, s := range idx {
+			l.stripes[s].Unlock()
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package lsm
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Lease lưu ở key hệ thống leaseKeyPrefix + tên, ghi qua FindOneAndUpdate/
+// FindOneAndDelete nên cấp, gia hạn và trả lease là các thao tác nguyên tử và
+// bền như mọi lần ghi khác (WAL). Lease hết hạn coi như không tồn tại ngay
+// khi đọc; job nền (Options.LeaseReapInterval) xóa hẳn bản ghi của chúng.
+const leaseKeyPrefix = engine.SystemKeyPrefix + "lease:"
+
+// DefaultLeaseReapInterval là chu kỳ mặc định xóa các lease đã hết hạn
+const DefaultLeaseReapInterval = 10 * time.Second
+
+func leaseKey(name string) []byte {
+	return []byte(leaseKeyPrefix + name)
+}
+
+// newLeaseID sinh ID ngẫu nhiên (32 ký tự hex) cho lease mới cấp
+func newLeaseID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// decodeLease đọc bản ghi lease; bản ghi hỏng coi như không có lease
+func decodeLease(raw []byte) (*engine.Lease, bool) {
+	if raw == nil {
+		return nil, false
+	}
+	var l engine.Lease
+	if err := json.Unmarshal(raw, &l); err != nil {
+		return nil, false
+	}
+	return &l, true
+}
+
+// withoutID trả về bản sao của lease không kèm ID (trả cho người không giữ lease)
+func withoutID(l *engine.Lease) *engine.Lease {
+	c := *l
+	c.ID = ""
+	return &c
+}
+
+// GrantLease cấp lease name cho owner trong ttl nếu chưa ai giữ (hoặc đã hết hạn)
+func (e *LSMEngine) GrantLease(name, owner string, ttl time.Duration) (*engine.Lease, error) {
+	if name == "" || ttl <= 0 {
+		return nil, errors.New("lease name and a positive ttl are required")
+	}
+	var held *engine.Lease
+	_, after, err := e.FindOneAndUpdate(leaseKey(name), func(old []byte) ([]byte, error) {
+		now := time.Now()
+		if cur, ok := decodeLease(old); ok && !cur.Expired(now) {
+			held = withoutID(cur)
+			return nil, engine.ErrLeaseHeld
+		}
+		return json.Marshal(&engine.Lease{
+			Name:      name,
+			Owner:     owner,
+			ID:        newLeaseID(),
+			TTLMs:     ttl.Milliseconds(),
+			GrantedAt: now,
+			ExpiresAt: now.Add(ttl),
+		})
+	})
+	if err != nil {
+		return held, err
+	}
+	l, _ := decodeLease(after)
+	return l, nil
+}
+
+// KeepAlive gia hạn lease thêm ttl (0 = TTL lúc cấp) tính từ bây giờ
+func (e *LSMEngine) KeepAlive(name, id string, ttl time.Duration) (*engine.Lease, error) {
+	if ttl < 0 {
+		return nil, errors.New("lease ttl must not be negative")
+	}
+	var held *engine.Lease
+	_, after, err := e.FindOneAndUpdate(leaseKey(name), func(old []byte) ([]byte, error) {
+		now := time.Now()
+		cur, ok := decodeLease(old)
+		if !ok || cur.Expired(now) {
+			return nil, engine.ErrLeaseNotFound
+		}
+		if cur.ID != id {
+			held = withoutID(cur)
+			return nil, engine.ErrLeaseHeld
+		}
+		if ttl > 0 {
+			cur.TTLMs = ttl.Milliseconds()
+		}
+		cur.ExpiresAt = now.Add(time.Duration(cur.TTLMs) * time.Millisecond)
+		return json.Marshal(cur)
+	})
+	if err != nil {
+		return held, err
+	}
+	l, _ := decodeLease(after)
+	return l, nil
+}
+
+// RevokeLease trả lease nếu id khớp. Lease đã hết hạn được dọn luôn nhưng
+// vẫn trả về ErrLeaseNotFound.
+func (e *LSMEngine) RevokeLease(name, id string) (*engine.Lease, error) {
+	var cur *engine.Lease
+	var expired bool
+	old, err := e.FindOneAndDelete(leaseKey(name), func(old []byte) bool {
+		var ok bool
+		if cur, ok = decodeLease(old); !ok {
+			return true // Bản ghi hỏng: dọn luôn
+		}
+		expired = cur.Expired(time.Now())
+		return cur.ID == id || expired
+	})
+	switch {
+	case errors.Is(err, engine.ErrKeyNotFound):
+		return nil, engine.ErrLeaseNotFound
+	case err != nil:
+		return nil, err
+	case old == nil:
+		return withoutID(cur), engine.ErrLeaseHeld
+	case cur == nil || (expired && cur.ID != id):
+		return nil, engine.ErrLeaseNotFound
+	}
+	return cur, nil
+}
+
+// GetLease trả về lease còn hiệu lực (không kèm ID)
+func (e *LSMEngine) GetLease(name string) (*engine.Lease, error) {
+	raw, err := e.Get(leaseKey(name))
+	if errors.Is(err, engine.ErrKeyNotFound) {
+		return nil, engine.ErrLeaseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	l, ok := decodeLease(raw)
+	if !ok || l.Expired(time.Now()) {
+		return nil, engine.ErrLeaseNotFound
+	}
+	return withoutID(l), nil
+}
+
+// Leases trả về các lease còn hiệu lực theo thứ tự tên (không kèm ID)
+func (e *LSMEngine) Leases() ([]engine.Lease, error) {
+	out := []engine.Lease{}
+	now := time.Now()
+	err := e.scanLeases(func(l *engine.Lease) {
+		if !l.Expired(now) {
+			out = append(out, *withoutID(l))
+		}
+	})
+	return out, err
+}
+
+// scanLeases gọi fn cho từng bản ghi lease đọc được
+func (e *LSMEngine) scanLeases(fn func(l *engine.Lease)) error {
+	it, err := e.NewPrefixIterator(leaseKeyPrefix)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		if item := it.Value(); item != nil && !item.Tombstone {
+			if l, ok := decodeLease(item.Value); ok {
+				fn(l)
+			}
+		}
+	}
+	return it.Error()
+}
+
+// reapLeases là job nền xóa bản ghi của các lease đã hết hạn
+func (e *LSMEngine) reapLeases() error {
+	now := time.Now()
+	var expired []string
+	// Gom tên trước rồi mới xóa: iterator còn mở thì ghi bị chặn
+	if err := e.scanLeases(func(l *engine.Lease) {
+		if l.Expired(now) {
+			expired = append(expired, l.Name)
+		}
+	}); err != nil {
+		return fmt.Errorf("scan leases: %w", err)
+	}
+	for _, name := range expired {
+		_, err := e.FindOneAndDelete(leaseKey(name), func(old []byte) bool {
+			l, ok := decodeLease(old)
+			return !ok || l.Expired(time.Now()) // Có thể đã được cấp lại
+		})
+		if err != nil && !errors.Is(err, engine.ErrKeyNotFound) {
+			return fmt.Errorf("delete lease %s: %w", name, err)
+		}
+	}
+	if len(expired) > 0 {
+		slog.Debug("Expired leases removed", "component", "lsm", "count", len(expired))
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// MemTable nhỏ (50 entry) và ghi đè liên tục một key (xen key khác để
+// MemTable đầy) làm nhiều immutable chứa key cùng chờ flush: Get phải trả về
+// bản của immutable mới nhất
+func TestGetAfterOverwritesAcrossImmutables(t *testing.T) {
+	db, err := OpenLSMWithConfig(t.TempDir(), 50, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Hàng đợi flush đầy thì chờ và ghi lại như ứng dụng
+	put := func(key, value string) {
+		for {
+			err := db.Put([]byte(key), []byte(value))
+			if err == nil {
+				return
+			}
+			if !errors.Is(err, ErrTooManyPendingFlushes) {
+				t.Fatalf("put %s: %v", key, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	key := []byte("k")
+	for i := 0; i < 5000; i++ {
+		want := fmt.Sprintf("%08d", i)
+		put(string(key), want)
+		put(fmt.Sprintf("fill:%08d", i), want)
+		if i%10 != 0 {
+			continue
+		}
+		got, err := db.Get(key)
+		if err != nil {
+			t.Fatalf("get %d: %v", i, err)
+		}
+		if string(got) != want {
+			t.Fatalf("get after put %d = %q, want %q", i, got, want)
+		}
+	}
+}
+
+// SSTable mới nhất chứa key bị hỏng: Get phải trả về lỗi chứ không trả về
+// bản cũ hơn nằm trong SSTable trước đó
+func TestGetReturnsErrorFromCorruptNewerTable(t *testing.T) {
+	dir := t.TempDir()
+	opts := DefaultOptions()
+	opts.L0MergeFileBytes = 0
+	opts.ScrubBlocksPerSec = 0
+	opts.Compression = CompressionNone
+	for _, val := range []string{"old", "new"} {
+		db, err := OpenLSMWithOptions(dir, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Put([]byte("k"), []byte(val)); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Close(); err != nil { // Close flush MemTable thành một tệp L0
+			t.Fatal(err)
+		}
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "sst", "sst-L0-*.sst"))
+	if len(paths) != 2 {
+		t.Fatalf("got %d L0 tables, want 2", len(paths))
+	}
+	sort.Strings(paths)
+	f, err := os.OpenFile(paths[1], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Byte đầu của data block: CRC của block không còn khớp
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, SSTHeaderSize+2); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	db, err := OpenLSMWithOptions(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.Get([]byte("k"))
+	if err == nil || errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("get = %q, %v; want read error", got, err)
+	}
+}
@@ -1,6 +1,7 @@
 package lsm
 
 import (
+	"strings"
 	"sync"
 	"sync/atomic"
 
@@ -12,9 +13,15 @@ import (
 // --- SỬA ĐỔI: Xóa định nghĩa Item (đã ở engine.go) ---
 
 type MemTable struct {
-	sl       *skiplist.SkipList
-	byteSize int64
-	mu       sync.RWMutex
+	sl        *skiplist.SkipList
+	byteSize  int64
+	oldestSeq uint64 // Seqno nhỏ nhất từng được ghi vào (xem OldestSeq)
+	mu        sync.RWMutex
+
+	// Phiên bản bị ghi đè mà snapshot còn cần (xem retain trong snapshot.go)
+	retained  int                       // Số snapshot đang đọc MemTable này
+	retainSeq uint64                    // Seqno của snapshot mới nhất trong số đó
+	history   map[string][]*engine.Item // key -> các bản cũ, seqno tăng dần
 }
 
 // (NewMemTable giữ nguyên)
@@ -25,36 +32,56 @@ func NewMemTable() *MemTable {
 	}
 }
 
-func (m *MemTable) Put(key string, value []byte) {
+// Put ghi value của key; updatedAt là thời điểm commit (Unix nano), seq là seqno của lần ghi
+func (m *MemTable) Put(key string, value []byte, updatedAt int64, seq uint64, expiresAt int64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if existing, ok := m.sl.GetValue(key); ok { // [cite: 80-81]
 		if existingItem, ok := existing.(*engine.Item); ok { // --- SỬA ĐỔI: Dùng engine.Item ---
 			atomic.AddInt64(&m.byteSize, -int64(len(existingItem.Value)))
+			m.keepVersion(key, existingItem)
 		}
 	}
 
-	item := &engine.Item{Value: value, Tombstone: false} // --- SỬA ĐỔI: Dùng engine.Item ---
+	item := &engine.Item{Value: value, Tombstone: false, UpdatedAt: updatedAt, Seq: seq, ExpiresAt: expiresAt} // --- SỬA ĐỔI: Dùng engine.Item ---
 	m.sl.Set(key, item)
+	m.trackSeq(seq)
 	atomic.AddInt64(&m.byteSize, int64(len(key)+len(value)+16))
 }
 
-func (m *MemTable) Delete(key string) {
+func (m *MemTable) Delete(key string, updatedAt int64, seq uint64) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	if existing, ok := m.sl.GetValue(key); ok { // [cite: 81-82]
 		if existingItem, ok := existing.(*engine.Item); ok { // --- SỬA ĐỔI: Dùng engine.Item ---
 			atomic.AddInt64(&m.byteSize, -int64(len(existingItem.Value)))
+			m.keepVersion(key, existingItem)
 		}
 	}
 
-	item := &engine.Item{Tombstone: true} // --- SỬA ĐỔI: Dùng engine.Item ---
+	item := &engine.Item{Tombstone: true, UpdatedAt: updatedAt, Seq: seq} // --- SỬA ĐỔI: Dùng engine.Item ---
 	m.sl.Set(key, item)
+	m.trackSeq(seq)
 	atomic.AddInt64(&m.byteSize, int64(len(key)+8))
 }
 
+// trackSeq cập nhật oldestSeq; caller giữ m.mu
+func (m *MemTable) trackSeq(seq uint64) {
+	if m.sl.Len() == 1 || seq < m.oldestSeq {
+		m.oldestSeq = seq
+	}
+}
+
+// OldestSeq là seqno nhỏ nhất từng được ghi vào MemTable (kể cả entry đã bị
+// ghi đè); chỉ có nghĩa khi MemTable không rỗng
+func (m *MemTable) OldestSeq() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.oldestSeq
+}
+
 // --- SỬA ĐỔI: Trả về engine.Item ---
 func (m *MemTable) Get(key string) (*engine.Item, bool) {
 	m.mu.RLock()
@@ -101,6 +128,9 @@ func (m *MemTable) SnapshotAndReset() map[string]*engine.Item {
 		itemCopy := &engine.Item{ // --- SỬA ĐỔI: Dùng engine.Item ---
 			Value:     append([]byte(nil), v.Value...),
 			Tombstone: v.Tombstone,
+			UpdatedAt: v.UpdatedAt,
+			Seq:       v.Seq,
+			ExpiresAt: v.ExpiresAt,
 		}
 		items[k] = itemCopy
 	}
@@ -110,6 +140,20 @@ func (m *MemTable) SnapshotAndReset() map[string]*engine.Item {
 	return items
 }
 
+// Snapshot sao chép toàn bộ entry mà không xóa MemTable.
+// Dùng khi flush một immutable MemTable: nó phải còn đọc được
+// cho tới khi SSTable tương ứng đã được ghi vào MANIFEST.
+func (m *MemTable) Snapshot() map[string]*engine.Item {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	items := make(map[string]*engine.Item, m.sl.Len())
+	for el := m.sl.Front(); el != nil; el = el.Next() {
+		items[el.Key().(string)] = el.Value.(*engine.Item)
+	}
+	return items
+}
+
 // Clear removes all entries (used for testing)
 func (m *MemTable) Clear() {
 	m.mu.Lock()
@@ -134,6 +178,30 @@ func (m *MemTable) Iterate(fn func(key string, item *engine.Item) error) error {
 	return nil
 }
 
+// HasPrefix: có entry nào (kể cả tombstone) có tiền tố prefix
+func (m *MemTable) HasPrefix(prefix string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	el := m.sl.Find(prefix)
+	return el != nil && strings.HasPrefix(el.Key().(string), prefix)
+}
+
+// PrefixStats đếm chính xác số entry (kể cả tombstone) và số byte
+// key+value có tiền tố prefix
+func (m *MemTable) PrefixStats(prefix string) (keys, bytes int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for el := m.sl.Find(prefix); el != nil; el = el.Next() {
+		k := el.Key().(string)
+		if !strings.HasPrefix(k, prefix) {
+			break
+		}
+		keys++
+		bytes += int64(len(k) + len(el.Value.(*engine.Item).Value))
+	}
+	return keys, bytes
+}
+
 // --- SỬA ĐỔI: Dùng engine.Item ---
 func (m *MemTable) Stats() map[string]interface{} {
 	// ... (logic [cite: 87-88] giữ nguyên, chỉ thay kiểu *Item) ...
@@ -2,6 +2,8 @@ package lsm
 
 import (
 	"container/heap"
+	"sync/atomic"
+
 	// --- MỚI: Import engine ---
 	"github.com/nconghau/MiniDBGo/internal/engine"
 )
@@ -9,9 +11,10 @@ import (
 // mergingIteratorItem là một wrapper cho container/heap
 // Nó giữ một iterator và giá trị (key/value) hiện tại của nó
 type mergingIteratorItem struct {
-	iter  engine.Iterator
-	key   string
-	value *engine.Item
+	iter   engine.Iterator
+	key    string
+	value  *engine.Item
+	source int // Vị trí của iter trong danh sách (nhỏ hơn = mới hơn)
 }
 
 // mergingIteratorHeap là một min-heap của các iterator
@@ -21,10 +24,16 @@ type mergingIteratorHeap []mergingIteratorItem
 func (h mergingIteratorHeap) Len() int { return len(h) }
 
 func (h mergingIteratorHeap) Less(i, j int) bool {
-	// Chỉ cần so sánh key
-	return h[i].key < h[j].key
-	// Nếu key bằng nhau, thứ tự không quan trọng
-	// vì logic Next() sẽ xử lý de-dup
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	// Key bằng nhau: phiên bản mới hơn phải nằm trên đỉnh heap để Next()
+	// giữ lại nó và bỏ các bản cũ. Seqno quyết định nếu cả hai đều có;
+	// dữ liệu cũ chưa có seqno thì dựa vào thứ tự nguồn
+	if si, sj := h[i].value.Seq, h[j].value.Seq; si != 0 && sj != 0 && si != sj {
+		return si > sj
+	}
+	return h[i].source < h[j].source
 }
 
 func (h mergingIteratorHeap) Swap(i, j int) {
@@ -50,21 +59,37 @@ type MergingIterator struct {
 	key   string
 	value *engine.Item
 	err   error
+
+	// keepTombstone: tombstone (phiên bản mới nhất) của key được trả về thay
+	// vì bị bỏ qua (compaction, xem newCompactionIterator); nil = luôn bỏ qua
+	keepTombstone func(key string) bool
+
+	// ranges: phiên bản mới nhất nằm trong một range tombstone mới hơn bị bỏ
+	// qua như tombstone (kể cả với keepTombstone: mọi bản cũ hơn cũng bị xóa)
+	ranges rangeTombstones
+
+	// now (Unix nano, 0 = không xét): phiên bản mới nhất hết hạn trước now
+	// (TTL) được xử lý như tombstone; expiredCount != nil thì đếm chúng
+	now          int64
+	expiredCount *atomic.Int64
 }
 
-// --- SỬA ĐỔI: Chấp nhận và trả về engine.Iterator ---
+// NewMergingIterator hợp nhất các iterator theo thứ tự key.
+// iters phải được sắp xếp từ MỚI NHẤT đến CŨ NHẤT: khi cùng key,
+// giá trị của iterator đứng trước sẽ được giữ lại.
 func NewMergingIterator(iters []engine.Iterator) engine.Iterator {
 	mi := &MergingIterator{
 		h:     make(mergingIteratorHeap, 0, len(iters)),
 		iters: iters,
 	}
 
-	for _, iter := range iters {
+	for i, iter := range iters {
 		if iter.Next() {
 			heap.Push(&mi.h, mergingIteratorItem{
-				iter:  iter,
-				key:   iter.Key(),
-				value: iter.Value(),
+				iter:   iter,
+				key:    iter.Key(),
+				value:  iter.Value(),
+				source: i,
 			})
 		}
 		if iter.Error() != nil {
@@ -105,9 +130,10 @@ func (it *MergingIterator) Next() bool {
 			// Di chuyển con trỏ của iterator bị trùng lặp này
 			if dupItem.iter.Next() {
 				heap.Push(&it.h, mergingIteratorItem{
-					iter:  dupItem.iter,
-					key:   dupItem.iter.Key(),
-					value: dupItem.iter.Value(),
+					iter:   dupItem.iter,
+					key:    dupItem.iter.Key(),
+					value:  dupItem.iter.Value(),
+					source: dupItem.source,
 				})
 			} else if dupItem.iter.Error() != nil {
 				it.err = dupItem.iter.Error()
@@ -118,9 +144,10 @@ func (it *MergingIterator) Next() bool {
 		// 3. Di chuyển con trỏ của iterator chính (item)
 		if item.iter.Next() {
 			heap.Push(&it.h, mergingIteratorItem{
-				iter:  item.iter,
-				key:   item.iter.Key(),
-				value: item.iter.Value(),
+				iter:   item.iter,
+				key:    item.iter.Key(),
+				value:  item.iter.Value(),
+				source: item.source,
 			})
 		} else if item.iter.Error() != nil {
 			it.err = item.iter.Error()
@@ -130,7 +157,16 @@ func (it *MergingIterator) Next() bool {
 		// 4. Xử lý Tombstone
 		// Nếu key này (mới nhất) là tombstone,
 		// chúng ta bỏ qua nó và lặp lại (để tìm key tiếp theo)
-		if currentValue.Tombstone {
+		if it.ranges.covering(currentKey, currentValue.Seq) != nil {
+			continue
+		}
+		if !currentValue.Tombstone && expired(currentValue, it.now) {
+			if it.expiredCount != nil {
+				it.expiredCount.Add(1)
+			}
+			currentValue = &engine.Item{Tombstone: true, UpdatedAt: currentValue.UpdatedAt, Seq: currentValue.Seq}
+		}
+		if currentValue.Tombstone && (it.keepTombstone == nil || !it.keepTombstone(currentKey)) {
 			continue
 		}
 
@@ -141,6 +177,30 @@ func (it *MergingIterator) Next() bool {
 	}
 }
 
+// Seek định vị lại mọi iterator con tại key và dựng lại heap
+func (it *MergingIterator) Seek(key string) {
+	if it.err != nil {
+		return
+	}
+
+	it.h = it.h[:0]
+	for i, iter := range it.iters {
+		iter.Seek(key)
+		if iter.Next() {
+			heap.Push(&it.h, mergingIteratorItem{
+				iter:   iter,
+				key:    iter.Key(),
+				value:  iter.Value(),
+				source: i,
+			})
+		}
+		if iter.Error() != nil {
+			it.err = iter.Error()
+			return
+		}
+	}
+}
+
 func (it *MergingIterator) Key() string {
 	return it.key
 }
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package lsm
+
+import (
+	"errors"
+	"os"
+)
+
+// MmapSupported cho biết nền tảng có đường đọc SSTable bằng mmap (Options.MmapReads)
+const MmapSupported = false
+
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("mmap not supported on this platform")
+}
+
+func munmapFile(data []byte) error {
+	return nil
+}
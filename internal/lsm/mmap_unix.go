@@ -0,0 +1,21 @@
+//go:build unix
+
+package lsm
+
+import (
+	"os"
+	"syscall"
+)
+
+// MmapSupported cho biết nền tảng có đường đọc SSTable bằng mmap (Options.MmapReads)
+const MmapSupported = true
+
+// mmapFile ánh xạ toàn bộ tệp (chỉ đọc); SSTable không bao giờ bị ghi lại
+// sau khi tạo nên vùng ánh xạ luôn khớp nội dung tệp
+func mmapFile(f *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,192 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MoveReport tóm tắt kết quả của MoveData
+type MoveReport struct {
+	Files  int   // Tổng số tệp đã chuyển
+	Linked int   // Số tệp dùng hard-link
+	Copied int   // Số tệp phải sao chép
+	Bytes  int64 // Tổng dung lượng
+}
+
+// MoveData chuyển thư mục dữ liệu từ oldDir sang newDir.
+// Engine KHÔNG được chạy trên oldDir trong lúc này.
+//
+// Các bước:
+//  1. Tạo thư mục tạm cạnh newDir
+//  2. Hard-link SSTable (nếu link=true và cùng filesystem) hoặc sao chép;
+//     WAL, value log, MANIFEST, CATALOG luôn được sao chép
+//  3. So sánh CRC của từng tệp nguồn/đích
+//  4. Đổi tên thư mục tạm thành newDir (atomic)
+//
+// oldDir được giữ nguyên để người dùng tự xóa sau khi kiểm tra.
+func MoveData(oldDir, newDir string, link bool) (*MoveReport, error) {
+	if _, err := os.Stat(filepath.Join(oldDir, manifestFileName)); err != nil {
+		return nil, fmt.Errorf("%s is not a MiniDBGo data dir: %w", oldDir, err)
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		return nil, fmt.Errorf("destination %s already exists", newDir)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	parent := filepath.Dir(filepath.Clean(newDir))
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, fmt.Errorf("create parent dir: %w", err)
+	}
+	stageDir, err := os.MkdirTemp(parent, "."+filepath.Base(newDir)+".moving-")
+	if err != nil {
+		return nil, fmt.Errorf("create staging dir: %w", err)
+	}
+
+	report := &MoveReport{}
+	if err := moveDataInto(oldDir, stageDir, link, report); err != nil {
+		os.RemoveAll(stageDir)
+		return nil, err
+	}
+
+	if err := syncDir(stageDir); err != nil {
+		os.RemoveAll(stageDir)
+		return nil, err
+	}
+	// Đổi tên (atomic): newDir chỉ xuất hiện khi mọi tệp đã được xác thực
+	if err := os.Rename(stageDir, newDir); err != nil {
+		os.RemoveAll(stageDir)
+		return nil, fmt.Errorf("switch to new dir: %w", err)
+	}
+	return report, syncDir(parent)
+}
+
+func moveDataInto(oldDir, stageDir string, link bool, report *MoveReport) error {
+	for _, sub := range []string{"wal", "sst", valueLogDirName} {
+		if err := os.MkdirAll(filepath.Join(stageDir, sub), 0o755); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(filepath.Join(oldDir, sub))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		for _, ent := range entries {
+			if ent.IsDir() || strings.HasSuffix(ent.Name(), ".tmp") {
+				continue
+			}
+			rel := filepath.Join(sub, ent.Name())
+			// Chỉ SSTable (bất biến) mới được hard-link; WAL và value log
+			// có thể bị engine mới ghi tiếp nên luôn phải sao chép
+			useLink := link && sub == "sst"
+			if err := transferFile(filepath.Join(oldDir, rel), filepath.Join(stageDir, rel), useLink, report); err != nil {
+				return err
+			}
+		}
+	}
+
+	// MANIFEST chuyển sau cùng (đường dẫn SSTable trong đó được
+	// tự động sửa lại khi OpenLSM với thư mục mới)
+	for _, name := range []string{catalogFileName, manifestFileName} {
+		src := filepath.Join(oldDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			continue
+		}
+		if err := transferFile(src, filepath.Join(stageDir, name), false, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferFile hard-link hoặc sao chép một tệp, rồi xác thực CRC
+func transferFile(src, dst string, link bool, report *MoveReport) error {
+	linked := false
+	if link {
+		// Hard-link thất bại khi khác filesystem -> sao chép
+		linked = os.Link(src, dst) == nil
+	}
+	if !linked {
+		if err := copyFileSync(src, dst); err != nil {
+			return fmt.Errorf("copy %s: %w", src, err)
+		}
+	}
+
+	srcSum, size, err := fileChecksum(src)
+	if err != nil {
+		return err
+	}
+	dstSum, _, err := fileChecksum(dst)
+	if err != nil {
+		return err
+	}
+	if srcSum != dstSum {
+		return fmt.Errorf("checksum mismatch for %s: %w", src, ErrCorruption)
+	}
+
+	report.Files++
+	report.Bytes += size
+	if linked {
+		report.Linked++
+	} else {
+		report.Copied++
+	}
+	return nil
+}
+
+func copyFileSync(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func fileChecksum(path string) (uint32, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.New(crcTable)
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, 0, err
+	}
+	return h.Sum32(), n, nil
+}
+
+// syncDir fsync thư mục để việc tạo/đổi tên tệp được bền vững
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package lsm
+
+import (
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Options cấu hình LSMEngine khi mở CSDL
+type Options struct {
+	FlushSize   int64 // Số record trong MemTable trước khi flush
+	MaxMemBytes int64 // Dung lượng tối đa (byte) của MemTable
+
+	// ScrubBlocksPerSec là số data block mà scrubber nền đọc lại
+	// và kiểm tra CRC mỗi giây (0 = tắt scrubber, mặc định). Nên để thấp
+	// (vd. 2) để không cạnh tranh I/O với truy vấn của người dùng.
+	ScrubBlocksPerSec int
+
+	// ReadStats bật thống kê đường đi của Get (nơi lookup kết thúc,
+	// số lần gặp tombstone, số SSTable phải đọc)
+	ReadStats bool
+
+	// StatsPersistInterval là chu kỳ ghi các bộ đếm cộng dồn (lifetime_*)
+	// xuống tệp STATS; 0 = chỉ ghi khi đóng CSDL
+	StatsPersistInterval time.Duration
+
+	// Compression là codec nén data block của SSTable mới ghi (flush, compaction);
+	// mặc định CompressionNone. Tệp cũ giữ codec lúc ghi và vẫn đọc được khi
+	// đổi cấu hình.
+	Compression Compression
+
+	// BlockCacheBytes là dung lượng LRU cache cho các data block
+	// mà Get đọc từ SSTable (0 = tắt)
+	BlockCacheBytes int64
+
+	// WALSync: fsync WAL sau mỗi batch trước khi trả về (an toàn khi mất điện,
+	// chậm hơn); false = chỉ ghi vào page cache của hệ điều hành.
+	// Tương đương WALDurability = DurabilityAlways.
+	WALSync bool
+
+	// WALDurability: chế độ fsync WAL mặc định — DurabilityAlways (fsync mỗi
+	// commit), DurabilityEverySec (fsync nền mỗi giây) hoặc DurabilityOS (để
+	// hệ điều hành tự ghi). DurabilityDefault = theo WALSync. Từng batch có
+	// thể ghi đè bằng Batch.SetDurability.
+	WALDurability engine.Durability
+
+	// WALSegmentBytes: segment WAL vượt chừng này thì chuyển sang segment mới
+	// ngay cả khi MemTable chưa đầy (vd. nhiều lần xóa/ghi đè cùng key làm WAL
+	// lớn mà MemTable không lớn); 0 = chỉ rotate cùng MemTable
+	WALSegmentBytes int64
+	// WALPreallocate: cấp phát trước WALSegmentBytes cho mỗi segment mới (Linux)
+	WALPreallocate bool
+	// WALRecycleFiles: số tệp WAL đã flush được giữ lại để dùng lại cho
+	// segment mới thay vì xóa rồi tạo tệp (0 = luôn xóa)
+	WALRecycleFiles int
+
+	// WALArchiveDir: nếu khác rỗng, segment WAL đã flush được chuyển vào thư
+	// mục này thay vì bị xóa/tái sử dụng, để khôi phục tới một thời điểm bằng
+	// RestoreToTimestamp/RestoreToSeq (đường dẫn tương đối tính từ thư mục CSDL)
+	WALArchiveDir string
+	// WALArchiveRetention: segment lưu trữ cũ hơn chừng này bị xóa (0 = giữ mãi)
+	WALArchiveRetention time.Duration
+	// WALArchiveMaxBytes: vượt dung lượng này thì xóa segment cũ nhất (0 = không giới hạn)
+	WALArchiveMaxBytes int64
+
+	// GroupCommitDelay: leader của group commit chờ thêm tối đa chừng này để
+	// gom batch của các writer khác vào cùng một lần ghi/fsync WAL (0 = không
+	// chờ, chỉ gom các batch đến trong lúc nhóm trước đang ghi)
+	GroupCommitDelay time.Duration
+
+	// GroupCommitAutoTune: job nền đo thông lượng commit và tự chọn
+	// GroupCommitDelay (GroupCommitDelay chỉ còn là giá trị ban đầu),
+	// xem group_commit_tune.go
+	GroupCommitAutoTune bool
+
+	// ReadLatencySLO là ngân sách p99 độ trễ của Get: khi p99 đo được vượt
+	// ngân sách, flush/compaction/GC value log bị giới hạn tốc độ ghi, và
+	// được nới lại khi còn dư (xem read_slo.go); 0 = tắt
+	ReadLatencySLO time.Duration
+
+	// GroupCommitMaxBytes giới hạn dung lượng WAL của một nhóm commit
+	// (0 = DefaultGroupCommitMaxBytes); đủ chừng này thì leader ghi ngay
+	GroupCommitMaxBytes int64
+
+	// LeaseReapInterval là chu kỳ job nền xóa bản ghi của các lease đã hết
+	// hạn (lease hết hạn luôn bị coi như không tồn tại khi đọc); 0 = tắt
+	LeaseReapInterval time.Duration
+
+	// BloomBitsPerKey là số bit bloom filter cho mỗi key của SSTable mới ghi
+	// (10 ≈ 1% dương tính giả; tăng để giảm đọc thừa, đổi lại tốn bộ nhớ);
+	// < 0 = không ghi bloom filter
+	BloomBitsPerKey int
+
+	// BloomHashes là số hàm hash của bloom filter; 0 = tối ưu theo số bit mỗi key
+	BloomHashes int
+
+	// BloomLevels ghi đè BloomBitsPerKey/BloomHashes cho SSTable mới ghi ở
+	// từng level, vd. tắt bloom ở level cuối khi phần lớn Get tìm thấy key
+	BloomLevels map[int]BloomPolicy
+
+	// TargetFileSize: compaction chia output thành nhiều SSTable, mỗi tệp
+	// khoảng chừng này byte data block; 0 = một tệp cho mỗi compaction
+	TargetFileSize int64
+
+	// TargetFileSizeLevels ghi đè TargetFileSize cho output ở từng level
+	TargetFileSizeLevels map[int]int64
+
+	// MaxSubcompactions: compaction đủ lớn được chia thành tối đa chừng này
+	// khoảng key rời nhau nén song song, mỗi khoảng ghi tệp output riêng
+	// (còn bị giới hạn bởi GOMAXPROCS); <= 1 = một goroutine (mặc định)
+	MaxSubcompactions int
+
+	// L0MergeFileBytes: SSTable L0 nhỏ hơn chừng này (vd. do flush liên tục
+	// các MemTable nhỏ) được gộp với các tệp nhỏ liền kề thành một tệp L0
+	// trước khi đủ L0CompactionTrigger tệp, để Get đọc ít tệp hơn; 0 = tắt
+	// (mặc định)
+	L0MergeFileBytes int64
+
+	// BlockSize là kích thước data block (trước khi nén) của SSTable mới ghi;
+	// 0 = SSTDataBlockSize. Khối lớn hợp với quét và nén tốt hơn, khối nhỏ
+	// hợp với Get (đọc và giải nén ít hơn mỗi lần tra).
+	BlockSize int
+	// BlockSizeLevels ghi đè BlockSize cho SSTable ở từng level
+	BlockSizeLevels map[int]int
+	// BlockSizeCollections ghi đè cho key của từng collection ở mọi level
+	// (ưu tiên hơn BlockSizeLevels)
+	BlockSizeCollections map[string]int
+
+	// MaxOpenFiles là số SSTable được giữ mở (kèm Index Block và bloom
+	// đã parse) cho Get, iterator và compaction; 0 = mở lại tệp ở mỗi lần đọc
+	MaxOpenFiles int
+
+	// MmapReads: đọc SSTable qua mmap thay vì pread (tệp trong tableCache và
+	// iterator). Bỏ qua (kèm cảnh báo) nếu nền tảng không hỗ trợ, xem MmapSupported.
+	MmapReads bool
+
+	// ReadAheadBytes: iterator SSTable đọc các data block liên tiếp (quét,
+	// compaction) thì đọc trước một cửa sổ tăng dần tới chừng này byte bằng
+	// một lần pread (mmap: madvise WILLNEED); 0 = đọc từng block
+	ReadAheadBytes int64
+
+	// ValueLogThreshold: value (document) từ số byte này trở lên được tách
+	// sang value log lúc flush, SSTable chỉ giữ con trỏ nên compaction không
+	// phải ghi lại document lớn; 0 = tắt (value log cũ vẫn được đọc và GC)
+	ValueLogThreshold int
+
+	// ValueLogFileSize: tệp value log đang ghi được đổi sang tệp mới khi vượt
+	// ngưỡng này; chỉ tệp đã đổi mới được GC
+	ValueLogFileSize int64
+
+	// ShutdownTimeout giới hạn thời gian Close chờ các job nền. Hết hạn thì
+	// compaction đang chạy bị hủy (giữ input, xóa output) và flush còn trong
+	// hàng đợi bị bỏ qua (dữ liệu vẫn nằm trong WAL); 0 = chờ đến khi xong.
+	ShutdownTimeout time.Duration
+
+	// Hook cho ứng dụng nhúng engine (cảnh báo, đo đạc); nil = bỏ qua.
+	// Xem events.go về ngữ cảnh gọi hook.
+	OnFlush           func(FlushInfo)
+	OnCompactionStart func(CompactionInfo)
+	OnCompactionEnd   func(CompactionInfo)
+	OnWriteStall      func(WriteStallInfo)
+	OnCorruption      func(CorruptionInfo)
+}
+
+// DefaultOptions trả về cấu hình mặc định
+func DefaultOptions() Options {
+	return Options{
+		FlushSize:       DefaultFlushSize,
+		MaxMemBytes:     DefaultMemTableBytes,
+		ReadStats:       true,
+		Compression:     CompressionNone,
+		BlockCacheBytes: DefaultBlockCacheBytes,
+		MaxOpenFiles:    DefaultMaxOpenFiles,
+		BloomBitsPerKey: DefaultBloomBitsPerKey,
+		TargetFileSize:  DefaultTargetFileSize,
+		ReadAheadBytes:  DefaultReadAheadBytes,
+
+		StatsPersistInterval: DefaultStatsPersistInterval,
+		ShutdownTimeout:      ShutdownTimeout,
+		ValueLogFileSize:     DefaultValueLogFileSize,
+		GroupCommitMaxBytes:  DefaultGroupCommitMaxBytes,
+		WALSegmentBytes:      DefaultWALSegmentBytes,
+		LeaseReapInterval:    DefaultLeaseReapInterval,
+	}
+}
+
+// bloomPolicy trả về cấu hình bloom cho SSTable mới ghi ở level
+func (o Options) bloomPolicy(level int) BloomPolicy {
+	if p, ok := o.BloomLevels[level]; ok {
+		return p
+	}
+	return BloomPolicy{BitsPerKey: o.BloomBitsPerKey, Hashes: o.BloomHashes}
+}
+
+// blockSize trả về kích thước data block của SSTable mới ghi ở level
+// (trừ các collection trong BlockSizeCollections)
+func (o Options) blockSize(level int) int {
+	if size, ok := o.BlockSizeLevels[level]; ok {
+		return size
+	}
+	return o.BlockSize
+}
+
+// targetFileSize trả về kích thước mục tiêu của tệp compaction ghi ở level
+func (o Options) targetFileSize(level int) int64 {
+	if size, ok := o.TargetFileSizeLevels[level]; ok {
+		return size
+	}
+	return o.TargetFileSize
+}
@@ -0,0 +1,213 @@
+package lsm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Properties block (từ SSTVersion 6): danh sách cặp tên/giá trị, mỗi cặp là
+// nameLen(uvarint) + name + valueLen(uvarint) + value.
+// Số nguyên được mã hóa varint trong value. Tên lạ được bỏ qua khi đọc nên
+// thêm property mới không cần tăng version.
+const (
+	propKeyCount      = "key_count"
+	propTombstones    = "tombstones"
+	propDataBlocks    = "data_blocks"
+	propRawKeyBytes   = "raw_key_bytes"
+	propRawValueBytes = "raw_value_bytes"
+	propRawDataBytes  = "raw_data_bytes"
+	propDataBytes     = "data_bytes"
+	propMinKey        = "min_key"
+	propMaxKey        = "max_key"
+	propLevel         = "level"
+	propCompression   = "compression"
+	propCreatedAt     = "created_at" // Unix nano
+	// Chỉ có khi tệp chứa collection dùng kích thước khối riêng:
+	// [nameLen(uvarint) + collection + size(uvarint)]...
+	propCollectionBlockSizes = "collection_block_sizes"
+)
+
+// properties là properties block của tệp đang ghi (gọi sau khi flush block cuối)
+func (w *SSTWriter) properties() *engine.TableProperties {
+	var sizes map[string]uint32
+	if len(w.usedBlockSizes) > 0 {
+		sizes = make(map[string]uint32, len(w.usedBlockSizes))
+		for col, size := range w.usedBlockSizes {
+			sizes[col] = uint32(size)
+		}
+	}
+	return &engine.TableProperties{
+		KeyCount:      uint64(w.count),
+		Tombstones:    w.tombstones,
+		DataBlocks:    uint64(len(w.indexEntries)),
+		RawKeyBytes:   w.rawKeyBytes,
+		RawValueBytes: w.rawValueBytes,
+		RawDataBytes:  w.rawDataBytes,
+		DataBytes:     uint64(w.currentBlockOffset - SSTHeaderSize),
+		MinKey:        w.minKey,
+		MaxKey:        w.maxKey,
+		Level:         w.level,
+		Compression:   string(w.compression),
+		CreatedAt:     time.Now(),
+
+		BlockSize:            uint32(w.blockSize),
+		CollectionBlockSizes: sizes,
+	}
+}
+
+func encodeProperties(p *engine.TableProperties) []byte {
+	var buf []byte
+	add := func(name string, value []byte) {
+		buf = binary.AppendUvarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+		buf = binary.AppendUvarint(buf, uint64(len(value)))
+		buf = append(buf, value...)
+	}
+	for _, u := range []struct {
+		name string
+		v    uint64
+	}{
+		{propKeyCount, p.KeyCount}, {propTombstones, p.Tombstones}, {propDataBlocks, p.DataBlocks},
+		{propRawKeyBytes, p.RawKeyBytes}, {propRawValueBytes, p.RawValueBytes},
+		{propRawDataBytes, p.RawDataBytes}, {propDataBytes, p.DataBytes},
+	} {
+		add(u.name, binary.AppendUvarint(nil, u.v))
+	}
+	add(propMinKey, []byte(p.MinKey))
+	add(propMaxKey, []byte(p.MaxKey))
+	add(propLevel, binary.AppendVarint(nil, int64(p.Level)))
+	add(propCompression, []byte(p.Compression))
+	add(propCreatedAt, binary.AppendVarint(nil, p.CreatedAt.UnixNano()))
+	if len(p.CollectionBlockSizes) > 0 {
+		cols := make([]string, 0, len(p.CollectionBlockSizes))
+		for col := range p.CollectionBlockSizes {
+			cols = append(cols, col)
+		}
+		sort.Strings(cols)
+		var v []byte
+		for _, col := range cols {
+			v = binary.AppendUvarint(v, uint64(len(col)))
+			v = append(v, col...)
+			v = binary.AppendUvarint(v, uint64(p.CollectionBlockSizes[col]))
+		}
+		add(propCollectionBlockSizes, v)
+	}
+	return buf
+}
+
+func decodeProperties(data []byte) (*engine.TableProperties, error) {
+	p := &engine.TableProperties{}
+	field := func() ([]byte, error) {
+		n, k := binary.Uvarint(data)
+		if k <= 0 || n > uint64(len(data)-k) {
+			return nil, fmt.Errorf("bad properties entry: %w", ErrCorruption)
+		}
+		v := data[k : k+int(n)]
+		data = data[k+int(n):]
+		return v, nil
+	}
+	for len(data) > 0 {
+		name, err := field()
+		if err != nil {
+			return nil, err
+		}
+		value, err := field()
+		if err != nil {
+			return nil, err
+		}
+
+		var u *uint64
+		switch string(name) {
+		case propKeyCount:
+			u = &p.KeyCount
+		case propTombstones:
+			u = &p.Tombstones
+		case propDataBlocks:
+			u = &p.DataBlocks
+		case propRawKeyBytes:
+			u = &p.RawKeyBytes
+		case propRawValueBytes:
+			u = &p.RawValueBytes
+		case propRawDataBytes:
+			u = &p.RawDataBytes
+		case propDataBytes:
+			u = &p.DataBytes
+		case propMinKey:
+			p.MinKey = string(value)
+		case propMaxKey:
+			p.MaxKey = string(value)
+		case propCompression:
+			p.Compression = string(value)
+		case propCollectionBlockSizes:
+			sizes, err := decodeCollectionBlockSizes(value)
+			if err != nil {
+				return nil, err
+			}
+			p.CollectionBlockSizes = sizes
+		case propLevel, propCreatedAt:
+			v, k := binary.Varint(value)
+			if k <= 0 {
+				return nil, fmt.Errorf("bad property %s: %w", name, ErrCorruption)
+			}
+			if string(name) == propLevel {
+				p.Level = int(v)
+			} else {
+				p.CreatedAt = time.Unix(0, v)
+			}
+		}
+		if u != nil {
+			v, k := binary.Uvarint(value)
+			if k <= 0 {
+				return nil, fmt.Errorf("bad property %s: %w", name, ErrCorruption)
+			}
+			*u = v
+		}
+	}
+	return p, nil
+}
+
+// readProperties đọc và kiểm tra CRC của properties block;
+// trả về nil với tệp trước v6 (không có properties)
+func readProperties(f io.ReaderAt, ft *sstFooter) (*engine.TableProperties, error) {
+	if !ft.format.checksums {
+		return nil, nil
+	}
+	data := make([]byte, ft.propsLen)
+	if _, err := f.ReadAt(data, int64(ft.propsOffset)); err != nil {
+		return nil, fmt.Errorf("read properties block: %w", err)
+	}
+	if crc32.Checksum(data, crcTable) != ft.propsCrc {
+		return nil, fmt.Errorf("properties block checksum mismatch: %w", ErrCorruption)
+	}
+	p, err := decodeProperties(data)
+	if err != nil {
+		return nil, err
+	}
+	p.BlockSize = ft.blockSize
+	return p, nil
+}
+
+func decodeCollectionBlockSizes(v []byte) (map[string]uint32, error) {
+	sizes := make(map[string]uint32)
+	for len(v) > 0 {
+		n, k := binary.Uvarint(v)
+		if k <= 0 || n > uint64(len(v)-k) {
+			return nil, fmt.Errorf("bad property %s: %w", propCollectionBlockSizes, ErrCorruption)
+		}
+		col := string(v[k : k+int(n)])
+		v = v[k+int(n):]
+		size, k := binary.Uvarint(v)
+		if k <= 0 || size > MaxDataBlockSize {
+			return nil, fmt.Errorf("bad property %s: %w", propCollectionBlockSizes, ErrCorruption)
+		}
+		v = v[k:]
+		sizes[col] = uint32(size)
+	}
+	return sizes, nil
+}
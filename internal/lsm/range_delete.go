@@ -0,0 +1,288 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync/atomic"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// RangeTombstone xóa mọi key trong [Start, End) có seqno nhỏ hơn Seq (các
+// lần ghi sau DeleteRange không bị ảnh hưởng). Tombstone nằm trong MANIFEST
+// chứ không trong WAL/SSTable: Get, iterator, flush và compaction đều lọc theo
+// nó, và dữ liệu bị xóa được bỏ dần khi flush/compaction ghi lại các tệp.
+type RangeTombstone struct {
+	Start string `json:"start"`
+	End   string `json:"end,omitempty"` // "" = không giới hạn trên
+	Seq   uint64 `json:"seq"`
+
+	// Pending: các SSTable có thể còn chứa key bị xóa (tệp có trước tombstone,
+	// hoặc output của flush/compaction bắt đầu trước nó). Tombstone được bỏ khi
+	// không còn tệp nào ở đây và không MemTable nào còn dữ liệu cũ hơn Seq.
+	Pending []string `json:"pending,omitempty"`
+}
+
+func (rt *RangeTombstone) contains(key string) bool {
+	return key >= rt.Start && (rt.End == "" || key < rt.End)
+}
+
+// rangeTombstones là danh sách tombstone của một Version, theo Seq tăng dần.
+// Slice và các phần tử không bị sửa tại chỗ (readView giữ bản chụp).
+type rangeTombstones []*RangeTombstone
+
+// covering trả về tombstone xóa phiên bản seq của key (nil nếu không có)
+func (rts rangeTombstones) covering(key string, seq uint64) *RangeTombstone {
+	for _, rt := range rts {
+		if seq < rt.Seq && rt.contains(key) {
+			return rt
+		}
+	}
+	return nil
+}
+
+// maxSeq là Seq của tombstone mới nhất (0 nếu không có)
+func (rts rangeTombstones) maxSeq() uint64 {
+	if len(rts) == 0 {
+		return 0
+	}
+	return rts[len(rts)-1].Seq
+}
+
+// rangeDeleteStats đếm các lần DeleteRange, ReplaceCollection và việc thu hồi tombstone
+type rangeDeleteStats struct {
+	deletes      atomic.Int64
+	droppedFiles atomic.Int64 // SSTable nằm trọn trong khoảng, bỏ ngay lúc DeleteRange
+	collected    atomic.Int64 // Tombstone đã được bỏ khỏi MANIFEST
+	replaces     atomic.Int64 // Lần ReplaceCollection thành công
+}
+
+func (e *LSMEngine) exportRangeDeletes(m map[string]int64) {
+	m["range_deletes"] = e.rangeDels.deletes.Load()
+	m["range_delete_dropped_files"] = e.rangeDels.droppedFiles.Load()
+	m["range_tombstones_collected"] = e.rangeDels.collected.Load()
+	m["collection_replaces"] = e.rangeDels.replaces.Load()
+	e.mu.RLock()
+	m["range_tombstones"] = int64(len(e.current.RangeTombstones))
+	e.mu.RUnlock()
+}
+
+// DeleteRange xóa mọi key trong [start, end) (end rỗng: tới key cuối) bằng
+// một range tombstone, không phụ thuộc số key trong khoảng. Index, tham chiếu
+// và change event không được bảo trì: dùng DropCollection cho collection.
+func (e *LSMEngine) DeleteRange(start, end []byte) error {
+	if len(start) == 0 && len(end) == 0 {
+		return errors.New("delete range: empty range, start or end is required")
+	}
+	if len(end) > 0 && string(start) >= string(end) {
+		return fmt.Errorf("delete range: start %q must be before end %q", start, end)
+	}
+	return e.deleteRanges([][2]string{{string(start), string(end)}})
+}
+
+// DropCollection xóa mọi document của collection cùng các entry index và
+// text index của nó trong một lần (cùng một seqno). Định nghĩa index, tham
+// chiếu... trong catalog và metadata của ứng dụng (engine.AppKeyPrefix) được
+// giữ lại. Từ chối nếu collection khác còn tham chiếu tới nó với onDelete
+// restrict/cascade.
+func (e *LSMEngine) DropCollection(collection string) error {
+	if collection == "" || engine.IsSystemKey(collection) {
+		return fmt.Errorf("%w: invalid collection name %q", engine.ErrInvalidDocument, collection)
+	}
+	for _, ref := range e.References(collection) {
+		if ref.Target == collection && ref.Collection != collection && ref.OnDelete != engine.RefDeleteNone {
+			return fmt.Errorf("%w: %s is referenced by %s.%s (onDelete %s), drop the reference first",
+				engine.ErrReferenceViolation, collection, ref.Collection, ref.Field, ref.OnDelete)
+		}
+	}
+
+	// Chờ các lần ghi đang bảo trì index xong để chúng rơi hẳn vào trước
+	// hoặc sau tombstone
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	return e.deleteRanges(collectionRanges(collection))
+}
+
+// collectionRanges là các khoảng key của document, entry index và text index
+// của collection, theo thứ tự key tăng dần
+func collectionRanges(collection string) [][2]string {
+	prefixes := []string{collection + ":", indexKeyPrefix + collection + ":", textPrefix(collection)}
+	sort.Strings(prefixes)
+	ranges := make([][2]string, 0, len(prefixes))
+	for _, prefix := range prefixes {
+		ranges = append(ranges, [2]string{prefix, prefixEnd(prefix)})
+	}
+	return ranges
+}
+
+// deleteRanges ghi một tombstone cho mỗi khoảng với cùng một seqno mới. Các
+// SSTable nằm trọn trong một khoảng được bỏ khỏi Version ngay, trừ khi một
+// compaction đang chạy (khi đó chúng được dọn dần như các tệp khác).
+func (e *LSMEngine) deleteRanges(ranges [][2]string) error {
+	dropping := e.compactMu.TryLock()
+	if dropping {
+		defer e.compactMu.Unlock()
+	}
+
+	e.mu.Lock()
+	if e.shuttingDown {
+		e.mu.Unlock()
+		return errors.New("database is shutting down")
+	}
+	// Seqno cấp dưới mu như commitGroup: mọi batch đã commit có seqno nhỏ hơn
+	// (bị xóa), mọi batch sau có seqno lớn hơn (giữ lại)
+	seq := e.lastSeq.Add(1)
+	prevLevels := make(map[int][]*FileMetadata, len(e.current.Levels))
+	for level, files := range e.current.Levels {
+		prevLevels[level] = files
+	}
+	prevRanges := e.current.RangeTombstones
+
+	dropped := e.current.addRangeTombstones(ranges, seq, dropping)
+	e.gcRangeTombstones()
+	if err := e.saveManifest(); err != nil {
+		e.current.Levels, e.current.RangeTombstones = prevLevels, prevRanges
+		e.mu.Unlock()
+		return fmt.Errorf("save manifest: %w", err)
+	}
+	e.mu.Unlock()
+
+	for _, f := range dropped {
+		if err := e.removeTableFile(f.Path); err != nil {
+			slog.Warn("Failed to delete SSTable covered by range delete", "component", "lsm", "path", f.Path, "error", err)
+		}
+	}
+	e.rangeDels.deletes.Add(1)
+	e.rangeDels.droppedFiles.Add(int64(len(dropped)))
+	slog.Info("Range delete", "component", "lsm", "ranges", len(ranges), "seq", seq, "dropped_files", len(dropped))
+	return nil
+}
+
+// addRangeTombstones thêm một tombstone Seq seq cho mỗi khoảng và trả về các
+// SSTable nằm trọn trong một khoảng đã bị bỏ khỏi Version (chỉ khi dropping,
+// tức caller giữ compactMu). Caller giữ e.mu (ghi) và sẽ lưu MANIFEST.
+func (v *Version) addRangeTombstones(ranges [][2]string, seq uint64, dropping bool) []*FileMetadata {
+	var dropped []*FileMetadata
+	rts := append(rangeTombstones(nil), v.RangeTombstones...)
+	for _, r := range ranges {
+		rt := &RangeTombstone{Start: r[0], End: r[1], Seq: seq}
+		for level, files := range v.Levels {
+			var gone []*FileMetadata
+			for _, f := range files {
+				switch {
+				case dropping && f.MinKey >= rt.Start && (rt.End == "" || f.MaxKey < rt.End):
+					gone = append(gone, f)
+				case fileOverlapsRange(f, rt.Start, rt.End):
+					rt.Pending = append(rt.Pending, f.Path)
+				}
+			}
+			if len(gone) > 0 {
+				v.DeleteFiles(level, gone)
+				dropped = append(dropped, gone...)
+			}
+		}
+		rts = append(rts, rt)
+	}
+	v.RangeTombstones = rts
+	return dropped
+}
+
+// rangeTombstonesForJob trả về các tombstone mà một flush/compaction bắt đầu
+// lúc này dùng để lọc output, cùng Seq mới nhất trong đó (xem trackRangeTombstones)
+func (e *LSMEngine) rangeTombstonesForJob() (rangeTombstones, uint64) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	rts := e.current.RangeTombstones
+	return rts, rts.maxSeq()
+}
+
+// trackRangeTombstones đưa các tệp output của một flush/compaction vào Pending
+// của những tombstone mới hơn since (job chưa biết tới nên chưa lọc theo chúng).
+// Caller giữ e.mu.
+func (v *Version) trackRangeTombstones(since uint64, files []*FileMetadata) {
+	if v.RangeTombstones.maxSeq() <= since {
+		return
+	}
+	rts := append(rangeTombstones(nil), v.RangeTombstones...)
+	for i, rt := range rts {
+		if rt.Seq <= since {
+			continue
+		}
+		cp := *rt
+		cp.Pending = append([]string(nil), rt.Pending...)
+		for _, f := range files {
+			if fileOverlapsRange(f, rt.Start, rt.End) {
+				cp.Pending = append(cp.Pending, f.Path)
+			}
+		}
+		rts[i] = &cp
+	}
+	v.RangeTombstones = rts
+}
+
+// replacePending: tệp new (ghi lại từ old, cùng dữ liệu) thay old trong Pending
+func (v *Version) replacePending(old, new string) {
+	rts := append(rangeTombstones(nil), v.RangeTombstones...)
+	for i, rt := range rts {
+		for j, p := range rt.Pending {
+			if p == old {
+				cp := *rt
+				cp.Pending = append([]string(nil), rt.Pending...)
+				cp.Pending[j] = new
+				rts[i] = &cp
+				break
+			}
+		}
+	}
+	v.RangeTombstones = rts
+}
+
+// gcRangeTombstones bỏ khỏi Pending các tệp đã rời Version và bỏ các tombstone
+// không còn dữ liệu nào để xóa. Caller giữ e.mu (ghi) và sẽ lưu MANIFEST.
+func (e *LSMEngine) gcRangeTombstones() {
+	if len(e.current.RangeTombstones) == 0 {
+		return
+	}
+	live := make(map[string]bool)
+	for _, files := range e.current.Levels {
+		for _, f := range files {
+			live[f.Path] = true
+		}
+	}
+	e.immutMu.RLock()
+	mems := append([]*MemTable{e.mem}, e.immutables...)
+	e.immutMu.RUnlock()
+
+	keep := make(rangeTombstones, 0, len(e.current.RangeTombstones))
+	for _, rt := range e.current.RangeTombstones {
+		var pending []string
+		for _, p := range rt.Pending {
+			if live[p] {
+				pending = append(pending, p)
+			}
+		}
+		if len(pending) == 0 && !memHoldsBefore(mems, rt.Seq) {
+			e.rangeDels.collected.Add(1)
+			continue
+		}
+		if len(pending) != len(rt.Pending) {
+			cp := *rt
+			cp.Pending = pending
+			rt = &cp
+		}
+		keep = append(keep, rt)
+	}
+	e.current.RangeTombstones = keep
+}
+
+// memHoldsBefore: có MemTable nào (có thể) chứa entry với seqno nhỏ hơn seq
+func memHoldsBefore(mems []*MemTable, seq uint64) bool {
+	for _, m := range mems {
+		if m.Size() > 0 && m.OldestSeq() < seq {
+			return true
+		}
+	}
+	return false
+}
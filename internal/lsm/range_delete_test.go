@@ -0,0 +1,130 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// visibleKeys trả về các key còn thấy được qua Get, kèm số key qua iterator
+func visibleKeys(t *testing.T, db engine.Engine, keys []string) (map[string]bool, int) {
+	t.Helper()
+	got := make(map[string]bool)
+	for _, k := range keys {
+		_, err := db.Get([]byte(k))
+		switch {
+		case err == nil:
+			got[k] = true
+		case !errors.Is(err, engine.ErrKeyNotFound):
+			t.Fatalf("get %s: %v", k, err)
+		}
+	}
+	it, err := db.NewIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	n := 0
+	for it.Next() {
+		if !engine.IsSystemKey(it.Key()) {
+			n++
+		}
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return got, n
+}
+
+// DeleteRange xóa [start, end) ở cả MemTable lẫn SSTable, giữ hiệu lực sau
+// crash, flush và compaction; lần ghi sau DeleteRange trong khoảng vẫn thấy
+func TestDeleteRangeHidesOlderVersions(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSMWithConfig(dir, 1000, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys []string
+	for i := 0; i < 10; i++ {
+		keys = append(keys, fmt.Sprintf("k:%d", i))
+	}
+	// k:0..k:4 trong SSTable, k:5..k:9 trong MemTable
+	for _, k := range keys[:5] {
+		db.Put([]byte(k), []byte("v"))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = OpenLSMWithConfig(dir, 1000, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range keys[5:] {
+		db.Put([]byte(k), []byte("v"))
+	}
+
+	if err := db.DeleteRange([]byte("k:2"), []byte("k:7")); err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("k:3"), []byte("again"))
+
+	want := map[string]bool{"k:0": true, "k:1": true, "k:3": true, "k:7": true, "k:8": true, "k:9": true}
+	check := func(name string, db engine.Engine) {
+		got, n := visibleKeys(t, db, keys)
+		if fmt.Sprint(got) != fmt.Sprint(want) || n != len(want) {
+			t.Fatalf("%s: visible = %v (scan %d), want %v", name, got, n, want)
+		}
+		if v, _ := db.Get([]byte("k:3")); string(v) != "again" {
+			t.Fatalf("%s: k:3 = %q, want again", name, v)
+		}
+	}
+	check("memtable", db)
+
+	crashed, err := OpenLSM(crashCopy(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after crash", crashed)
+	crashed.Close()
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	check("after flush", db)
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	check("after compaction", db)
+}
+
+// DropCollection xóa mọi document của collection, collection khác giữ nguyên
+func TestDropCollection(t *testing.T) {
+	db, err := OpenLSM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		db.Put([]byte(fmt.Sprintf("users:%d", i)), []byte(`{"n":1}`))
+		db.Put([]byte(fmt.Sprintf("users2:%d", i)), []byte(`{"n":2}`))
+	}
+	if err := db.DropCollection("users"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := db.Get([]byte(fmt.Sprintf("users:%d", i))); !errors.Is(err, engine.ErrKeyNotFound) {
+			t.Fatalf("users:%d err = %v, want not found", i, err)
+		}
+		if _, err := db.Get([]byte(fmt.Sprintf("users2:%d", i))); err != nil {
+			t.Fatalf("users2:%d: %v", i, err)
+		}
+	}
+}
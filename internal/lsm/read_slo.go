@@ -0,0 +1,166 @@
+package lsm
+
+import (
+	"log/slog"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SLO độ trễ đọc (Options.ReadLatencySLO): Get ghi độ trễ vào một histogram,
+// mỗi chu kỳ job nền lấy p99 của chu kỳ vừa qua. Vượt ngân sách thì giới hạn
+// tốc độ ghi của flush/compaction/GC value log (bgThrottle) giảm một nửa; p99
+// dưới sloHeadroom ngân sách thì nới dần, tới bgIOMaxRate thì bỏ giới hạn.
+const (
+	sloTuneInterval = time.Second
+	sloMinSamples   = 50  // Ít Get hơn trong một chu kỳ thì p99 không đáng tin: coi như còn dư
+	sloHeadroom     = 0.7 // p99 dưới 70% ngân sách mới tăng tốc lại
+	bgIOMinRate     = 1 << 20
+	bgIOMaxRate     = 512 << 20
+)
+
+// Histogram độ trễ theo µs: bốn ô tuyến tính trong mỗi khoảng lũy thừa 2
+// (sai số ≤ 25%), ô cuối gộp mọi độ trễ từ khoảng 16 giây trở lên
+const latencyBuckets = 92
+
+type latencyHistogram struct {
+	counts [latencyBuckets]atomic.Int64
+}
+
+func latencyBucket(us uint64) int {
+	if us < 4 {
+		return int(us)
+	}
+	n := bits.Len64(us) // us nằm trong [2^(n-1), 2^n)
+	i := (n-2)*4 + int(us>>(n-3)) - 4
+	return min(i, latencyBuckets-1)
+}
+
+// latencyBucketUpper là cận trên (µs) của ô i
+func latencyBucketUpper(i int) uint64 {
+	if i < 4 {
+		return uint64(i) + 1
+	}
+	n := i/4 + 2
+	return uint64(i%4+5) << (n - 3)
+}
+
+// since ghi độ trễ của một lần đọc bắt đầu lúc start
+func (h *latencyHistogram) since(start time.Time) {
+	h.counts[latencyBucket(uint64(time.Since(start).Microseconds()))].Add(1)
+}
+
+// drain trả về p99 và số mẫu từ lần drain trước, rồi đặt lại histogram
+func (h *latencyHistogram) drain() (time.Duration, int64) {
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range h.counts {
+		counts[i] = h.counts[i].Swap(0)
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	rank := total - total/100 // Mẫu thứ rank (từ 1) là p99
+	var seen int64
+	for i, c := range counts {
+		if seen += c; seen >= rank {
+			return time.Duration(latencyBucketUpper(i)) * time.Microsecond, total
+		}
+	}
+	return 0, total
+}
+
+// bgThrottle giới hạn tốc độ ghi (byte/giây) của các tác vụ nền. Các tác vụ
+// gọi wait trước mỗi entry; thời điểm được ghi tiếp dồn theo số byte nên vài
+// tác vụ cùng chạy chia nhau một giới hạn.
+type bgThrottle struct {
+	rate atomic.Int64 // 0 = không giới hạn
+	mu   sync.Mutex
+	next time.Time
+
+	bytes       atomic.Int64 // Byte đã qua trong chu kỳ SLO hiện tại
+	waits       atomic.Int64
+	waitNanos   atomic.Int64
+	adjustments atomic.Int64
+	violations  atomic.Int64 // Số chu kỳ p99 vượt ngân sách
+	p99         atomic.Int64 // µs, của chu kỳ vừa đo
+}
+
+func (t *bgThrottle) wait(n int) {
+	t.bytes.Add(int64(n))
+	rate := t.rate.Load()
+	if rate <= 0 {
+		return
+	}
+	t.mu.Lock()
+	now := time.Now()
+	if t.next.Before(now) {
+		t.next = now
+	}
+	t.next = t.next.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	d := t.next.Sub(now)
+	t.mu.Unlock()
+	if d >= time.Millisecond { // Ngủ theo lô, không ngủ cho từng entry nhỏ
+		t.waits.Add(1)
+		t.waitNanos.Add(int64(d))
+		time.Sleep(d)
+	}
+}
+
+func (t *bgThrottle) export(m map[string]int64) {
+	m["read_slo_p99_us"] = t.p99.Load()
+	m["read_slo_violations"] = t.violations.Load()
+	m["bg_io_rate_limit_bytes_per_sec"] = t.rate.Load()
+	m["bg_io_throttle_adjustments"] = t.adjustments.Load()
+	m["bg_io_throttle_waits"] = t.waits.Load()
+	m["bg_io_throttle_wait_ms"] = t.waitNanos.Load() / int64(time.Millisecond)
+}
+
+// tuneReadSLO là job nền của Options.ReadLatencySLO
+func (e *LSMEngine) tuneReadSLO() error {
+	t := &e.bgIO
+	p99, samples := e.readLatency.drain()
+	written := t.bytes.Swap(0)
+	t.p99.Store(p99.Microseconds())
+
+	slo := e.opts.ReadLatencySLO
+	prev := t.rate.Load()
+	rate := prev
+	switch {
+	case samples >= sloMinSamples && p99 > slo:
+		t.violations.Add(1)
+		if rate == 0 {
+			if written == 0 {
+				break // Không có tác vụ nền nào đang ghi: không phải nguyên nhân
+			}
+			rate = int64(float64(written) / sloTuneInterval.Seconds())
+		}
+		rate = max(rate/2, bgIOMinRate)
+	case samples < sloMinSamples || float64(p99) < float64(slo)*sloHeadroom:
+		if rate > 0 {
+			if rate = rate * 3 / 2; rate > bgIOMaxRate {
+				rate = 0
+			}
+		}
+	}
+	if rate != prev {
+		t.rate.Store(rate)
+		t.adjustments.Add(1)
+		slog.Debug("Background I/O limit adjusted", "component", "lsm",
+			"bytes_per_sec", rate, "read_p99", p99, "slo", slo)
+	}
+	return nil
+}
+
+// flushThrottled: flush chỉ bị giới hạn khi không có MemTable nào khác chờ
+// flush, để SLO đọc không biến thành write stall
+func (e *LSMEngine) flushThrottled() bool {
+	if e.opts.ReadLatencySLO <= 0 {
+		return false
+	}
+	e.immutMu.RLock()
+	defer e.immutMu.RUnlock()
+	return len(e.immutables) <= 1
+}
@@ -0,0 +1,127 @@
+package lsm
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// DefaultReadAheadBytes là cửa sổ read-ahead tối đa của mỗi iterator SSTable
+const DefaultReadAheadBytes = 256 * 1024 // 256KB
+
+const (
+	readAheadInitial = 16 * 1024 // Cửa sổ ban đầu, nhân đôi sau mỗi lần đọc tới tối đa
+	readAheadTrigger = 2         // Số block liên tiếp trước khi bật read-ahead
+)
+
+// readAhead phát hiện iterator đọc các data block liên tiếp (quét toàn
+// collection, compaction) và khi đó đọc trước cả một cửa sổ lớn bằng một
+// lần pread thay vì từng block vài KB; tệp đọc qua mmap thì chỉ báo trước
+// cho kernel (madvise WILLNEED). Seek sang chỗ khác đưa về đọc từng block.
+type readAhead struct {
+	f      *sstFile
+	max    int64
+	window int64
+	limit  int64 // Cuối data block cuối cùng: không đọc trước sang index/bloom
+
+	run  int // Số block liên tiếp vừa đọc
+	next int // Chỉ số block tiếp theo nếu đọc tuần tự
+
+	buf     []byte // pread: vùng đã đọc trước
+	bufOff  int64
+	advised int64 // mmap: đã madvise tới offset này
+	stats   *readAheadStats
+}
+
+// readAheadStats đếm hiệu quả read-ahead của mọi iterator
+type readAheadStats struct {
+	reads atomic.Int64 // Số lần đọc trước (pread lớn hoặc madvise)
+	bytes atomic.Int64
+	hits  atomic.Int64 // Số block lấy từ vùng đã đọc trước
+}
+
+func (s *readAheadStats) export(m map[string]int64) {
+	m["readahead_reads"] = s.reads.Load()
+	m["readahead_bytes"] = s.bytes.Load()
+	m["readahead_block_hits"] = s.hits.Load()
+}
+
+// newReadAhead trả về nil nếu read-ahead tắt (Options.ReadAheadBytes <= 0)
+func (e *LSMEngine) newReadAhead(f *sstFile, format *sstFormat, index []blockIndexEntry) *readAhead {
+	if e.opts.ReadAheadBytes <= 0 || len(index) == 0 {
+		return nil
+	}
+	last := index[len(index)-1]
+	return &readAhead{
+		f:     f,
+		max:   e.opts.ReadAheadBytes,
+		limit: last.offset + last.length + format.blockTrailerSize(),
+		next:  -1,
+		stats: &e.readAhead,
+	}
+}
+
+// source trả về nơi đọc block idx: chính tệp (đọc ngẫu nhiên, mmap) hoặc
+// ra (đọc tuần tự bằng pread)
+func (ra *readAhead) source(index []blockIndexEntry, idx int) io.ReaderAt {
+	if idx == ra.next {
+		ra.run++
+	} else {
+		ra.run = 1
+		ra.window = min(int64(readAheadInitial), ra.max)
+		ra.buf = ra.buf[:0]
+		ra.advised = 0
+	}
+	ra.next = idx + 1
+	if ra.run < readAheadTrigger {
+		return ra.f
+	}
+
+	if ra.f.data == nil {
+		return ra
+	}
+	entry := index[idx]
+	if entry.offset+entry.length <= ra.advised {
+		ra.stats.hits.Add(1)
+		return ra.f
+	}
+	n := min(ra.window, ra.limit-entry.offset)
+	ra.f.adviseWillNeed(entry.offset, n)
+	ra.advised = entry.offset + n
+	ra.grow(n)
+	return ra.f
+}
+
+// ReadAt trả về từ vùng đã đọc trước, hoặc đọc một cửa sổ mới bắt đầu tại off
+func (ra *readAhead) ReadAt(p []byte, off int64) (int, error) {
+	end := off + int64(len(p))
+	if off >= ra.bufOff && end <= ra.bufOff+int64(len(ra.buf)) {
+		ra.stats.hits.Add(1)
+		return copy(p, ra.buf[off-ra.bufOff:]), nil
+	}
+
+	n := min(ra.window, ra.limit-off)
+	if n < 2*int64(len(p)) {
+		// Cửa sổ không chứa nổi block kế tiếp (hoặc block vượt limit): đọc thẳng
+		ra.window = min(ra.window*2, ra.max)
+		return ra.f.ReadAt(p, off)
+	}
+	if int64(cap(ra.buf)) < n {
+		ra.buf = make([]byte, n)
+	}
+	ra.buf = ra.buf[:n]
+	read, err := ra.f.ReadAt(ra.buf, off)
+	if read < len(p) {
+		copied := copy(p, ra.buf[:read])
+		ra.buf = ra.buf[:0]
+		return copied, err
+	}
+	ra.buf, ra.bufOff = ra.buf[:read], off
+	ra.grow(int64(read))
+	return copy(p, ra.buf), nil
+}
+
+func (ra *readAhead) grow(read int64) {
+	ra.stats.reads.Add(1)
+	ra.stats.bytes.Add(read)
+	ra.window = min(ra.window*2, ra.max)
+}
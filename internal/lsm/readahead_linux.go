@@ -0,0 +1,20 @@
+//go:build linux
+
+package lsm
+
+import (
+	"os"
+	"syscall"
+)
+
+// adviseWillNeed báo kernel sắp đọc n byte tại off của vùng mmap để nó
+// nạp trước vào page cache (madvise cần địa chỉ căn theo trang)
+func (s *sstFile) adviseWillNeed(off, n int64) {
+	page := int64(os.Getpagesize())
+	start := off &^ (page - 1)
+	end := min(off+n, int64(len(s.data)))
+	if s.data == nil || start >= end {
+		return
+	}
+	syscall.Madvise(s.data[start:end], syscall.MADV_WILLNEED)
+}
@@ -0,0 +1,6 @@
+//go:build !linux
+
+package lsm
+
+// adviseWillNeed: chưa hỗ trợ ngoài Linux, kernel tự đọc trước theo page fault
+func (s *sstFile) adviseWillNeed(off, n int64) {}
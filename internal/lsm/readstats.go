@@ -0,0 +1,83 @@
+package lsm
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Nguồn (nơi) một lần Get kết thúc
+const (
+	sourceNone      = -3 // Không tìm thấy ở đâu cả
+	sourceMemTable  = -2
+	sourceImmutable = -1
+	// >= 0: cấp (level) của SSTable
+)
+
+// maxTrackedLevels: số cấp được thống kê riêng (các cấp sâu hơn gộp vào cấp cuối)
+const maxTrackedLevels = 8
+
+// lookupResult mô tả đường đi của một lần Get
+type lookupResult struct {
+	source    int   // Nơi lookup kết thúc (xem hằng source*)
+	tombstone bool  // Kết thúc tại một tombstone
+	sstProbes int   // Số SSTable đã phải đọc (sau khi lọc theo Min/MaxKey)
+	updatedAt int64 // UpdatedAt của entry tìm thấy
+	seq       uint64
+	expiresAt int64 // ExpiresAt của entry tìm thấy (TTL)
+}
+
+// readStats thống kê khuếch đại đọc (read amplification) của Get
+type readStats struct {
+	lookups    atomic.Int64
+	notFound   atomic.Int64
+	tombstones atomic.Int64
+	memTable   atomic.Int64
+	immutable  atomic.Int64
+	levels     [maxTrackedLevels]atomic.Int64
+	sstProbes  atomic.Int64
+}
+
+func (rs *readStats) record(res lookupResult) {
+	rs.lookups.Add(1)
+	rs.sstProbes.Add(int64(res.sstProbes))
+	if res.tombstone {
+		rs.tombstones.Add(1)
+	}
+
+	switch {
+	case res.source == sourceNone:
+		rs.notFound.Add(1)
+	case res.source == sourceMemTable:
+		rs.memTable.Add(1)
+	case res.source == sourceImmutable:
+		rs.immutable.Add(1)
+	case res.source >= maxTrackedLevels:
+		rs.levels[maxTrackedLevels-1].Add(1)
+	default:
+		rs.levels[res.source].Add(1)
+	}
+}
+
+// export ghi các chỉ số vào map của GetMetrics
+func (rs *readStats) export(m map[string]int64) {
+	lookups := rs.lookups.Load()
+	probes := rs.sstProbes.Load()
+
+	m["get_terminated_memtable"] = rs.memTable.Load()
+	m["get_terminated_immutable"] = rs.immutable.Load()
+	m["get_not_found"] = rs.notFound.Load()
+	m["get_tombstone_hits"] = rs.tombstones.Load()
+	m["get_sst_probes"] = probes
+	for level := 0; level < maxTrackedLevels; level++ {
+		if n := rs.levels[level].Load(); n > 0 || level <= 2 {
+			m[fmt.Sprintf("get_terminated_level_%d", level)] = n
+		}
+	}
+
+	// Trung bình số SSTable phải đọc mỗi Get (nhân 100 vì map chỉ chứa int64)
+	if lookups > 0 {
+		m["get_avg_sst_probes_x100"] = probes * 100 / lookups
+	} else {
+		m["get_avg_sst_probes_x100"] = 0
+	}
+}
@@ -0,0 +1,325 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// Số document tối đa một batch được xóa dây chuyền (cascade)
+const maxCascadeDeletes = 10000
+
+var errCascadeTooLarge = fmt.Errorf("cascade would delete more than %d documents", maxCascadeDeletes)
+
+// SetReference khai báo (hoặc thay thế) tham chiếu ref.Collection.Field -> ref.Target.
+// Index trên Collection.Field được tạo nếu chưa có, để việc xóa document đích
+// tìm được các document tham chiếu tới nó mà không quét cả collection.
+// Chỉ các lần ghi sau đó được kiểm tra, dữ liệu sẵn có giữ nguyên.
+func (e *LSMEngine) SetReference(ref engine.Reference) error {
+	if ref.Collection == "" || ref.Field == "" || ref.Target == "" {
+		return errors.New("collection, field and target are required")
+	}
+	if strings.Contains(ref.Collection, ":") || strings.Contains(ref.Target, ":") {
+		return errors.New("invalid collection name")
+	}
+	if strings.Contains(ref.Field, ",") {
+		return fmt.Errorf("reference field %q must be a single field", ref.Field)
+	}
+	switch ref.OnDelete {
+	case engine.RefDeleteNone, engine.RefDeleteRestrict, engine.RefDeleteCascade:
+	default:
+		return fmt.Errorf("unknown onDelete action %q (use restrict or cascade)", ref.OnDelete)
+	}
+	if _, ok := e.IndexInfo(ref.Collection, ref.Field); !ok {
+		if err := e.CreateIndex(ref.Collection, ref.Field, engine.IndexOptions{}); err != nil {
+			return fmt.Errorf("create index for reference: %w", err)
+		}
+	}
+
+	// Chờ các batch đang kiểm tra tham chiếu xong rồi mới đổi định nghĩa
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.catalogMu.Lock()
+	defer e.catalogMu.Unlock()
+
+	prev := e.catalog.References
+	refs := make([]engine.Reference, 0, len(prev)+1)
+	for _, r := range prev {
+		if r.Collection != ref.Collection || r.Field != ref.Field {
+			refs = append(refs, r)
+		}
+	}
+	e.catalog.References = append(refs, ref)
+	if err := e.saveCatalog(); err != nil {
+		e.catalog.References = prev
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// DropReference xóa tham chiếu của collection.field (index vẫn được giữ)
+func (e *LSMEngine) DropReference(collection, field string) error {
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.catalogMu.Lock()
+	defer e.catalogMu.Unlock()
+
+	prev := e.catalog.References
+	refs := make([]engine.Reference, 0, len(prev))
+	for _, r := range prev {
+		if r.Collection != collection || r.Field != field {
+			refs = append(refs, r)
+		}
+	}
+	if len(refs) == len(prev) {
+		return fmt.Errorf("no reference on %s.%s", collection, field)
+	}
+	e.catalog.References = refs
+	if err := e.saveCatalog(); err != nil {
+		e.catalog.References = prev
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	return nil
+}
+
+// References trả về các tham chiếu khai báo trên collection hoặc trỏ tới nó
+func (e *LSMEngine) References(collection string) []engine.Reference {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	out := make([]engine.Reference, 0)
+	for _, r := range e.catalog.References {
+		if r.Collection == collection || r.Target == collection {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// withReferences thêm vào batch các lệnh xóa dây chuyền (cascade) rồi kiểm tra
+// các tham chiếu trên trạng thái cuối của batch. Trả về batch (có thể đã mở rộng)
+// hoặc *engine.ReferenceError.
+// Caller phải giữ e.indexMu và e.catalogMu (đọc).
+func (e *LSMEngine) withReferences(b *lsmBatch) (*lsmBatch, error) {
+	refs := e.catalog.References
+	if len(refs) == 0 {
+		return b, nil
+	}
+
+	// Trạng thái cuối của mỗi document trong batch (nil = bị xóa)
+	final := make(map[string][]byte)
+	for _, entry := range b.entries {
+		k := string(entry.Key)
+		if engine.IsSystemKey(k) {
+			continue
+		}
+		if entry.Tombstone {
+			final[k] = nil
+		} else {
+			final[k] = entry.Value
+		}
+	}
+
+	// 1. Cascade: batch được mở rộng trong lúc duyệt nên xóa dây chuyền nhiều tầng
+	out := b
+	cascaded := 0
+	for i := 0; i < len(out.entries); i++ {
+		k := string(out.entries[i].Key)
+		if v, ok := final[k]; !ok || v != nil {
+			continue
+		}
+		col, id, ok := splitDocKey(k)
+		if !ok {
+			continue
+		}
+		for _, ref := range refs {
+			if ref.Target != col || ref.OnDelete != engine.RefDeleteCascade {
+				continue
+			}
+			ids, err := e.referencing(ref, id, final)
+			if err != nil {
+				return nil, err
+			}
+			for _, rid := range ids {
+				if cascaded++; cascaded > maxCascadeDeletes {
+					return nil, errCascadeTooLarge
+				}
+				if out == b {
+					out = NewBatch()
+					out.entries = append(out.entries, b.entries...)
+				}
+				rk := ref.Collection + ":" + rid
+				out.Delete([]byte(rk))
+				final[rk] = nil
+			}
+		}
+	}
+
+	// 2. Kiểm tra restrict (document bị xóa) và checkInsert (document được ghi)
+	checked := make(map[string]bool)
+	for _, entry := range out.entries {
+		k := string(entry.Key)
+		v, ok := final[k]
+		if !ok || checked[k] {
+			continue
+		}
+		checked[k] = true
+		col, id, ok := splitDocKey(k)
+		if !ok {
+			continue
+		}
+		for _, ref := range refs {
+			var err error
+			switch {
+			case v == nil && ref.Target == col && ref.OnDelete == engine.RefDeleteRestrict:
+				err = e.checkRestrict(ref, id, final)
+			case v != nil && ref.Collection == col && ref.CheckInsert:
+				err = e.checkTargets(ref, id, v, final)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func (e *LSMEngine) checkRestrict(ref engine.Reference, id string, final map[string][]byte) error {
+	ids, err := e.referencing(ref, id, final)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	return &engine.ReferenceError{Collection: ref.Collection, Field: ref.Field, Target: ref.Target,
+		ID: ids[0], TargetID: id, Op: "delete"}
+}
+
+// checkTargets kiểm tra các _id mà document raw tham chiếu tới đều tồn tại
+func (e *LSMEngine) checkTargets(ref engine.Reference, id string, raw []byte, final map[string][]byte) error {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil // Không phải document JSON: không có field để kiểm tra
+	}
+	v, _ := query.GetPath(doc, ref.Field)
+	values := []interface{}{v}
+	if arr, isArr := v.([]interface{}); isArr {
+		values = arr
+	}
+	for _, val := range values {
+		if val == nil {
+			continue
+		}
+		target, isStr := val.(string)
+		if isStr {
+			tk := ref.Target + ":" + target
+			tv, inBatch := final[tk]
+			if inBatch && tv != nil {
+				continue
+			}
+			if !inBatch {
+				ok, err := e.exists(tk)
+				if err != nil {
+					return err
+				}
+				if ok {
+					continue
+				}
+			}
+		} else {
+			target = fmt.Sprint(val) // Chỉ _id dạng chuỗi mới tham chiếu được
+		}
+		return &engine.ReferenceError{Collection: ref.Collection, Field: ref.Field, Target: ref.Target,
+			ID: id, TargetID: target, Op: "write"}
+	}
+	return nil
+}
+
+// referencing trả về _id các document của ref.Collection đang tham chiếu tới id
+// theo trạng thái sau batch: ứng viên lấy từ index của ref.Field cộng các
+// document được ghi trong batch, rồi kiểm tra lại trên document.
+func (e *LSMEngine) referencing(ref engine.Reference, id string, final map[string][]byte) ([]string, error) {
+	candidates := make([]string, 0)
+	if def := e.catalog.findIndex(ref.Collection, ref.Field); def != nil {
+		if enc, ok := encodeIndexValue(def.Collation.Value(id)); ok {
+			prefix := indexPrefix(def.Collection, def.Field) + enc + "\x00"
+			it, err := e.newRangeIterator(prefix, prefixEnd(prefix))
+			if err != nil {
+				return nil, err
+			}
+			for it.Next() {
+				candidates = append(candidates, it.Key()[len(prefix):])
+			}
+			err = it.Error()
+			it.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	colPrefix := ref.Collection + ":"
+	for k, v := range final {
+		if v != nil && strings.HasPrefix(k, colPrefix) {
+			candidates = append(candidates, k[len(colPrefix):])
+		}
+	}
+
+	out := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, rid := range candidates {
+		if seen[rid] {
+			continue
+		}
+		seen[rid] = true
+		raw, inBatch := final[colPrefix+rid]
+		if !inBatch {
+			var err error
+			if raw, _, err = e.lookupValue(colPrefix + rid); err != nil {
+				return nil, err
+			}
+		}
+		if raw != nil && refersTo(raw, ref.Field, id) {
+			out = append(out, rid)
+		}
+	}
+	return out, nil
+}
+
+func refersTo(raw []byte, field, id string) bool {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return false
+	}
+	v, _ := query.GetPath(doc, field)
+	if s, ok := v.(string); ok {
+		return s == id
+	}
+	if arr, ok := v.([]interface{}); ok {
+		for _, item := range arr {
+			if s, ok := item.(string); ok && s == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lookupValue đọc giá trị hiện tại của key (nil, false nếu không tồn tại)
+// mà không tính vào metrics đọc của người dùng
+func (e *LSMEngine) lookupValue(key string) ([]byte, bool, error) {
+	val, res, err := e.lookup(key)
+	if err != nil || res.source == sourceNone || res.tombstone {
+		return nil, false, err
+	}
+	return val, true, nil
+}
+
+// exists giống Exists nhưng không tính vào metrics
+func (e *LSMEngine) exists(key string) (bool, error) {
+	v := e.readView()
+	defer e.releaseVersion(v.pin)
+	_, res, err := e.lookupIn(v, key, nil, true)
+	return err == nil && res.source != sourceNone && !res.tombstone, err
+}
@@ -0,0 +1,291 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// replaceStagingPattern: thư mục tạm (trong thư mục CSDL) nơi ReplaceCollection
+// nạp dữ liệu mới; thư mục còn sót do crash bị xóa khi mở CSDL
+const replaceStagingPattern = "replace-staging-*"
+
+// replaceFlushWaitAttempts: số lần (mỗi lần 100ms) ReplaceCollection chờ flush
+// các MemTable còn dữ liệu cũ của collection
+const replaceFlushWaitAttempts = 300
+
+// ReplaceCollection thay toàn bộ document của collection (cùng entry index và
+// text index) bằng dữ liệu mà load ghi qua apply. load chạy trên một CSDL tạm
+// có cùng định nghĩa index nên reader không bao giờ thấy collection nạp dở;
+// xong thì dữ liệu mới được chép thành SSTable L0 và hoán đổi trong một lần
+// sửa MANIFEST: range tombstone xóa dữ liệu cũ (seqno S-1) cùng lúc các tệp
+// mới (seqno S) vào L0. Reader thấy trọn dữ liệu cũ hoặc trọn dữ liệu mới;
+// load hay hoán đổi lỗi thì dữ liệu cũ giữ nguyên. Mọi key trong batch phải
+// thuộc collection. Như DropCollection: tham chiếu và change event không được
+// kiểm tra/phát, và các lần ghi có index bị chặn trong lúc chép và hoán đổi.
+func (e *LSMEngine) ReplaceCollection(collection string, load func(apply func(engine.Batch) error) error) error {
+	if collection == "" || engine.IsSystemKey(collection) {
+		return fmt.Errorf("%w: invalid collection name %q", engine.ErrInvalidDocument, collection)
+	}
+	start := time.Now()
+	stage, err := e.openReplaceStaging(collection)
+	if err != nil {
+		return fmt.Errorf("replace %s: open staging: %w", collection, err)
+	}
+	defer func() {
+		if err := stage.Close(); err != nil {
+			slog.Warn("Failed to close replace staging", "component", "lsm", "dir", stage.dir, "error", err)
+		}
+		os.RemoveAll(stage.dir)
+	}()
+
+	prefix := collection + ":"
+	var docs int64
+	err = load(func(b engine.Batch) error {
+		lb, ok := b.(*lsmBatch)
+		if !ok {
+			return errors.New("invalid batch type provided")
+		}
+		for _, entry := range lb.entries {
+			if !strings.HasPrefix(string(entry.Key), prefix) {
+				return fmt.Errorf("%w: key %q is not in collection %s", engine.ErrInvalidDocument, entry.Key, collection)
+			}
+		}
+		var err error
+		for attempt := 0; attempt < 50; attempt++ {
+			if err = stage.ApplyBatch(b); !errors.Is(err, ErrTooManyPendingFlushes) {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		if err == nil {
+			docs += int64(len(lb.entries))
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// Như DropCollection: lần ghi có index rơi hẳn vào trước hoặc sau hoán đổi
+	e.indexMu.Lock()
+	defer e.indexMu.Unlock()
+	e.mu.Lock()
+	if e.shuttingDown {
+		e.mu.Unlock()
+		return errors.New("database is shutting down")
+	}
+	// Seqno cấp dưới mu như deleteRanges: S-1 cho tombstone, S cho dữ liệu mới
+	seq := e.lastSeq.Add(2)
+	e.mu.Unlock()
+
+	ranges := collectionRanges(collection)
+	files, err := e.writeReplaceTables(stage, ranges, seq)
+	if err != nil {
+		return fmt.Errorf("replace %s: %w", collection, err)
+	}
+	dropped, err := e.installReplace(ranges, files, seq)
+	if err != nil {
+		for _, f := range files {
+			os.Remove(f.Path)
+		}
+		return fmt.Errorf("replace %s: %w", collection, err)
+	}
+
+	for _, f := range dropped {
+		if err := e.removeTableFile(f.Path); err != nil {
+			slog.Warn("Failed to delete SSTable replaced by ReplaceCollection", "component", "lsm", "path", f.Path, "error", err)
+		}
+	}
+	e.rangeDels.replaces.Add(1)
+	e.rangeDels.droppedFiles.Add(int64(len(dropped)))
+	slog.Info("Collection replaced", "component", "lsm", "collection", collection, "written", docs,
+		"files", len(files), "dropped_files", len(dropped), "seq", seq, "duration", time.Since(start))
+	e.tryScheduleCompaction()
+	return nil
+}
+
+// openReplaceStaging mở CSDL tạm cho ReplaceCollection với định nghĩa index
+// và text index của collection (không scrubber, hook, value log hay lưu trữ WAL)
+func (e *LSMEngine) openReplaceStaging(collection string) (*LSMEngine, error) {
+	dir, err := os.MkdirTemp(e.dir, replaceStagingPattern)
+	if err != nil {
+		return nil, err
+	}
+	opts := e.opts
+	opts.ScrubBlocksPerSec = 0
+	opts.ValueLogThreshold = 0 // SSTable chép sang không được trỏ vào value log của CSDL tạm
+	opts.WALArchiveDir = ""
+	opts.WALDurability = engine.DurabilityOS // Crash thì CSDL tạm bị bỏ
+	opts.WALSync = false
+	opts.ReadLatencySLO = 0
+	opts.GroupCommitAutoTune = false
+	opts.LeaseReapInterval = 0
+	opts.OnFlush, opts.OnCompactionStart, opts.OnCompactionEnd = nil, nil, nil
+	opts.OnWriteStall, opts.OnCorruption = nil, nil
+	eng, err := OpenLSMWithOptions(dir, opts)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	stage := eng.(*LSMEngine)
+
+	err = func() error {
+		for _, field := range e.ListIndexes(collection) {
+			info, _ := e.IndexInfo(collection, field)
+			if err := stage.CreateIndex(collection, field, info); err != nil {
+				return fmt.Errorf("create index %s: %w", field, err)
+			}
+		}
+		if fields, ok := e.TextIndex(collection); ok {
+			if err := stage.CreateTextIndex(collection, fields); err != nil {
+				return fmt.Errorf("create text index: %w", err)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		stage.Close()
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return stage, nil
+}
+
+// writeReplaceTables chép mọi entry của stage trong ranges (tăng dần) thành
+// SSTable L0 của CSDL chính với seqno seq. Tệp chưa nằm trong MANIFEST.
+func (e *LSMEngine) writeReplaceTables(stage *LSMEngine, ranges [][2]string, seq uint64) ([]*FileMetadata, error) {
+	var estimated uint32
+	stage.mu.RLock()
+	for _, files := range stage.current.Levels {
+		estimated += calculateTotalKeys(files)
+	}
+	stage.mu.RUnlock()
+	stage.immutMu.RLock()
+	for _, m := range append([]*MemTable{stage.mem}, stage.immutables...) {
+		estimated += uint32(m.Size())
+	}
+	stage.immutMu.RUnlock()
+
+	out := e.newCompactionOutput(0, estimated)
+	copyRange := func(r [2]string) error {
+		it, err := stage.newRangeIterator(r[0], r[1])
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for it.Next() {
+			item := *it.Value()
+			item.Seq = seq
+			if err := out.add(it.Key(), &item); err != nil {
+				return err
+			}
+		}
+		return it.Error()
+	}
+	for _, r := range ranges {
+		if err := copyRange(r); err != nil {
+			out.discard()
+			return nil, err
+		}
+		if e.shutdownAborted() {
+			out.discard()
+			return nil, errors.New("database is shutting down")
+		}
+	}
+	files, err := out.finish()
+	if err != nil {
+		out.discard()
+		return nil, err
+	}
+	return files, nil
+}
+
+// installReplace thêm tombstone (seq-1) cho ranges và đưa files vào cuối L0
+// trong cùng một lần lưu MANIFEST, trả về các SSTable bị bỏ. Trước đó mọi
+// MemTable còn dữ liệu của ranges cũ hơn tombstone phải được flush: nếu
+// không, flush sau hoán đổi sẽ đặt dữ liệu cũ vào tệp L0 mới hơn files.
+func (e *LSMEngine) installReplace(ranges [][2]string, files []*FileMetadata, seq uint64) ([]*FileMetadata, error) {
+	for attempt := 0; ; attempt++ {
+		e.mu.Lock()
+		if e.shuttingDown {
+			e.mu.Unlock()
+			return nil, errors.New("database is shutting down")
+		}
+		if memHoldsRanges([]*MemTable{e.mem}, ranges, seq-1) {
+			// Lỗi (hàng đợi flush đầy) thì chờ và thử lại như ở dưới
+			if err := e.rotateMemTable(); err != nil && !errors.Is(err, ErrTooManyPendingFlushes) {
+				e.mu.Unlock()
+				return nil, fmt.Errorf("rotate memtable: %w", err)
+			}
+		}
+		e.immutMu.RLock()
+		mems := append([]*MemTable{e.mem}, e.immutables...)
+		e.immutMu.RUnlock()
+		if memHoldsRanges(mems, ranges, seq-1) {
+			e.mu.Unlock()
+			if attempt >= replaceFlushWaitAttempts {
+				return nil, errors.New("timed out waiting for memtable flush")
+			}
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		break
+	}
+	defer e.mu.Unlock()
+
+	dropping := e.compactMu.TryLock()
+	if dropping {
+		defer e.compactMu.Unlock()
+	}
+	prevLevels := make(map[int][]*FileMetadata, len(e.current.Levels))
+	for level, files := range e.current.Levels {
+		prevLevels[level] = files
+	}
+	prevRanges, prevSeq := e.current.RangeTombstones, e.current.LastSeq
+
+	dropped := e.current.addRangeTombstones(ranges, seq-1, dropping)
+	for _, f := range files {
+		e.current.AddFile(f)
+	}
+	e.current.LastSeq = max(e.current.LastSeq, seq)
+	e.gcRangeTombstones()
+	if err := e.saveManifest(); err != nil {
+		e.current.Levels, e.current.RangeTombstones, e.current.LastSeq = prevLevels, prevRanges, prevSeq
+		return nil, fmt.Errorf("save manifest: %w", err)
+	}
+	return dropped, nil
+}
+
+// memHoldsRanges: có MemTable nào chứa key trong ranges với seqno (có thể)
+// nhỏ hơn seq
+func memHoldsRanges(mems []*MemTable, ranges [][2]string, seq uint64) bool {
+	for _, m := range mems {
+		if m.Size() == 0 || m.OldestSeq() >= seq {
+			continue
+		}
+		for _, r := range ranges {
+			if m.HasPrefix(r[0]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeReplaceStaging xóa thư mục tạm của ReplaceCollection còn sót (crash
+// giữa chừng: dữ liệu cũ vẫn nguyên vì MANIFEST chưa đổi)
+func removeReplaceStaging(dir string) {
+	stale, _ := filepath.Glob(filepath.Join(dir, replaceStagingPattern))
+	for _, p := range stale {
+		if err := os.RemoveAll(p); err != nil {
+			slog.Warn("Failed to remove stale replace staging", "component", "lsm", "dir", p, "error", err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// ReplaceCollection thay trọn collection (kể cả khi mở lại sau crash),
+// không đụng tới collection khác; load lỗi hoặc key ngoài collection thì dữ
+// liệu cũ giữ nguyên
+func TestReplaceCollection(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 5; i++ {
+		db.Put([]byte(fmt.Sprintf("users:%d", i)), []byte(`{"v":"old"}`))
+	}
+	db.Put([]byte("users2:1"), []byte(`{"v":"other"}`))
+	keys := []string{"users:0", "users:1", "users:2", "users:3", "users:4", "users:new", "users2:1"}
+
+	failed := errors.New("load failed")
+	err = db.ReplaceCollection("users", func(apply func(engine.Batch) error) error {
+		b := db.NewBatch()
+		b.Put([]byte("users:new"), []byte(`{"v":"new"}`))
+		if err := apply(b); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("replace with failing load err = %v", err)
+	}
+	err = db.ReplaceCollection("users", func(apply func(engine.Batch) error) error {
+		b := db.NewBatch()
+		b.Put([]byte("users2:2"), []byte(`{}`))
+		return apply(b)
+	})
+	if !errors.Is(err, engine.ErrInvalidDocument) {
+		t.Fatalf("replace with foreign key err = %v, want ErrInvalidDocument", err)
+	}
+	if got, _ := visibleKeys(t, db, keys); len(got) != 6 || got["users:new"] {
+		t.Fatalf("after failed replaces visible = %v, want old data", got)
+	}
+
+	err = db.ReplaceCollection("users", func(apply func(engine.Batch) error) error {
+		b := db.NewBatch()
+		b.Put([]byte("users:1"), []byte(`{"v":"new"}`))
+		b.Put([]byte("users:new"), []byte(`{"v":"new"}`))
+		return apply(b)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"users:1": true, "users:new": true, "users2:1": true}
+	check := func(name string, db engine.Engine) {
+		got, n := visibleKeys(t, db, keys)
+		if fmt.Sprint(got) != fmt.Sprint(want) || n != len(want) {
+			t.Fatalf("%s: visible = %v (scan %d), want %v", name, got, n, want)
+		}
+		if v, _ := db.Get([]byte("users:1")); string(v) != `{"v":"new"}` {
+			t.Fatalf("%s: users:1 = %s", name, v)
+		}
+	}
+	check("after replace", db)
+
+	crashed, err := OpenLSM(crashCopy(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer crashed.Close()
+	check("after crash", crashed)
+}
@@ -0,0 +1,144 @@
+package lsm
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Hạn mức (số key) một iterator được đọc liên tục trước khi phải nhường
+// và kiểm tra deadline, theo độ ưu tiên của yêu cầu
+var scanQuota = [...]int{
+	engine.PriorityLow:    64,
+	engine.PriorityNormal: 256,
+	engine.PriorityHigh:   1024,
+}
+
+// Thời gian tối đa một scan chờ các lần đọc điểm ưu tiên cao ở mỗi lần nhường
+// (giới hạn để scan không bị bỏ đói)
+const maxScanYieldWait = 5 * time.Millisecond
+
+// readScheduler điều phối scan và đọc điểm: scan ưu tiên thấp/thường
+// tạm dừng ở cuối mỗi hạn mức khi đang có đọc điểm ưu tiên cao
+type readScheduler struct {
+	highReads atomic.Int32 // Số đọc điểm ưu tiên cao đang chạy
+	yields    atomic.Int64 // Số lần scan phải chờ đọc ưu tiên cao
+	deadlines atomic.Int64 // Số yêu cầu bị dừng vì hết deadline
+}
+
+// beginHighRead đánh dấu một đọc điểm ưu tiên cao đang chạy
+func (s *readScheduler) beginHighRead() func() {
+	s.highReads.Add(1)
+	return func() { s.highReads.Add(-1) }
+}
+
+// yield được scan gọi ở cuối mỗi hạn mức
+func (s *readScheduler) yield(ctx context.Context, p engine.Priority) error {
+	if p < engine.PriorityHigh && s.highReads.Load() > 0 {
+		s.yields.Add(1)
+		deadline := time.Now().Add(maxScanYieldWait)
+		for s.highReads.Load() > 0 && time.Now().Before(deadline) {
+			time.Sleep(50 * time.Microsecond)
+		}
+	}
+	runtime.Gosched()
+	return s.checkDeadline(ctx)
+}
+
+func (s *readScheduler) checkDeadline(ctx context.Context) error {
+	err := ctx.Err()
+	if err != nil {
+		s.deadlines.Add(1)
+	}
+	return err
+}
+
+func (s *readScheduler) export(m map[string]int64) {
+	m["sched_high_reads_active"] = int64(s.highReads.Load())
+	m["sched_scan_yields"] = s.yields.Load()
+	m["sched_deadline_exceeded"] = s.deadlines.Load()
+}
+
+// scheduledIterator áp dụng hạn mức, nhường và deadline lên một iterator
+type scheduledIterator struct {
+	engine.Iterator
+	ctx      context.Context
+	sched    *readScheduler
+	priority engine.Priority
+	quota    int
+	left     int
+	err      error
+}
+
+func (it *scheduledIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.left == 0 {
+		if it.err = it.sched.yield(it.ctx, it.priority); it.err != nil {
+			return false
+		}
+		it.left = it.quota
+	}
+	it.left--
+	return it.Iterator.Next()
+}
+
+func (it *scheduledIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
+
+// GetContext giống Get nhưng tôn trọng deadline của ctx; đọc ưu tiên cao
+// khiến các scan ưu tiên thấp hơn tạm nhường
+func (e *LSMEngine) GetContext(ctx context.Context, key []byte) ([]byte, error) {
+	if err := e.sched.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+	if engine.PriorityFrom(ctx) == engine.PriorityHigh {
+		defer e.sched.beginHighRead()()
+	}
+	return e.Get(key)
+}
+
+// GetItem giống GetContext nhưng trả về cả UpdatedAt của lần ghi cuối
+func (e *LSMEngine) GetItem(ctx context.Context, key []byte) (*engine.Item, error) {
+	if err := e.sched.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+	if engine.PriorityFrom(ctx) == engine.PriorityHigh {
+		defer e.sched.beginHighRead()()
+	}
+	return e.getItem(key)
+}
+
+// NewPrefixIteratorContext giống NewPrefixIterator; iterator dừng với
+// lỗi của ctx khi hết deadline và nhường theo độ ưu tiên trong ctx
+func (e *LSMEngine) NewPrefixIteratorContext(ctx context.Context, prefix string) (engine.Iterator, error) {
+	return e.withSchedule(ctx, func() (engine.Iterator, error) { return e.NewPrefixIterator(prefix) })
+}
+
+// withSchedule mở iterator bằng open rồi gắn deadline và độ ưu tiên của ctx
+func (e *LSMEngine) withSchedule(ctx context.Context, open func() (engine.Iterator, error)) (engine.Iterator, error) {
+	if err := e.sched.checkDeadline(ctx); err != nil {
+		return nil, err
+	}
+	it, err := open()
+	if err != nil {
+		return nil, err
+	}
+	p := engine.PriorityFrom(ctx)
+	return &scheduledIterator{
+		Iterator: it,
+		ctx:      ctx,
+		sched:    &e.sched,
+		priority: p,
+		quota:    scanQuota[p],
+		left:     scanQuota[p],
+	}, nil
+}
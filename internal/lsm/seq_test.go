@@ -0,0 +1,116 @@
+package lsm
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// crashCopy chép thư mục CSDL đang mở sang thư mục mới như thể tiến trình
+// chết lúc này: không flush MemTable, không đóng WAL. Các lần ghi trả về
+// thành công đều đã nằm trong tệp WAL (ghi xuống OS trước khi trả về).
+func crashCopy(t *testing.T, dir string) string {
+	t.Helper()
+	dst := t.TempDir()
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, p)
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		in, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, in)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func itemSeq(t *testing.T, db engine.Engine, key string) uint64 {
+	t.Helper()
+	item, err := db.GetItem(context.Background(), []byte(key))
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return item.Seq
+}
+
+// Seqno của mỗi lần ghi (kể cả batch) giữ nguyên khi replay WAL sau crash và
+// khi đọc lại từ SSTable; lần ghi sau khi mở lại nhận seqno lớn hơn
+func TestSeqSurvivesWALReplayAndFlush(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("k:a"), []byte("a"))
+	b := db.NewBatch()
+	b.Put([]byte("k:b"), []byte("b"))
+	b.Put([]byte("k:c"), []byte("c"))
+	if err := db.ApplyBatch(b); err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("k:a"), []byte("a2"))
+
+	want := map[string]uint64{}
+	for _, k := range []string{"k:a", "k:b", "k:c"} {
+		want[k] = itemSeq(t, db, k)
+	}
+	if !(want["k:b"] < want["k:c"] && want["k:c"] < want["k:a"]) {
+		t.Fatalf("seqs = %v: want increasing in commit order", want)
+	}
+
+	check := func(name string, db engine.Engine) {
+		for k, seq := range want {
+			if got := itemSeq(t, db, k); got != seq {
+				t.Fatalf("%s: seq of %s = %d, want %d", name, k, got, seq)
+			}
+		}
+		if err := db.Put([]byte("k:d"), []byte("d")); err != nil {
+			t.Fatal(err)
+		}
+		if got := itemSeq(t, db, "k:d"); got <= want["k:a"] {
+			t.Fatalf("%s: new write seq %d not above %d", name, got, want["k:a"])
+		}
+	}
+
+	// Replay WAL
+	crashed, err := OpenLSM(crashCopy(t, dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check("after crash", crashed)
+	if err := crashed.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Đọc từ SSTable
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	check("after flush", reopened)
+}
@@ -0,0 +1,87 @@
+package lsm
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// errCompactionAborted: compaction bị hủy vì Close đã hết ShutdownTimeout
+var errCompactionAborted = errors.New("compaction aborted by shutdown")
+
+// shutdownStats đếm các việc bị bỏ dở khi Close hết ShutdownTimeout
+type shutdownStats struct {
+	compactionsAborted atomic.Int64 // Compaction đang chạy bị hủy
+	compactionsSkipped atomic.Int64 // Compaction trong hàng đợi không chạy
+	flushesSkipped     atomic.Int64 // Flush trong hàng đợi không chạy (dữ liệu còn trong WAL)
+}
+
+// shutdownAborted: Close đã hết ShutdownTimeout và hủy e.ctx
+func (e *LSMEngine) shutdownAborted() bool {
+	return e.ctx.Err() != nil
+}
+
+// waitJobs đóng bộ lập lịch và chờ các job nền tối đa timeout (<= 0 = chờ mãi).
+// Hết hạn thì hủy e.ctx để compaction dừng ở lần kiểm tra kế tiếp, rồi chờ
+// các worker thoát hẳn (flush đang ghi dở được chạy nốt). Trả về false nếu đã hủy.
+func (e *LSMEngine) waitJobs(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		e.jobs.Close()
+		close(done)
+	}()
+	if timeout <= 0 {
+		<-done
+		return true
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+	}
+	slog.Warn("Shutdown timeout elapsed, aborting background jobs", "component", "lsm", "timeout", timeout)
+	e.cancel()
+	<-done
+	return false
+}
+
+// abortCompaction bỏ các tệp output đã ghi (writer: tệp đang ghi dở). MANIFEST
+// chưa đổi nên các tệp input vẫn là dữ liệu hợp lệ và được nén lại ở lần mở sau.
+func (e *LSMEngine) abortCompaction(writer *SSTWriter, paths ...string) error {
+	if writer != nil {
+		writer.Close()
+	}
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	e.shutdown.compactionsAborted.Add(1)
+	slog.Warn("Compaction aborted by shutdown, output removed", "component", "lsm", "files", paths)
+	return errCompactionAborted
+}
+
+// reportShutdown ghi lại MANIFEST và log những việc bị bỏ qua sau khi
+// Close hết ShutdownTimeout
+func (e *LSMEngine) reportShutdown(flushed int64) {
+	e.mu.Lock()
+	err := e.saveManifest()
+	e.mu.Unlock()
+	if err != nil {
+		slog.Error("Failed to persist manifest after shutdown timeout", "error", err)
+	}
+
+	e.immutMu.RLock()
+	pending := len(e.immutables)
+	e.immutMu.RUnlock()
+	slog.Warn("Shutdown incomplete, skipped background work",
+		"component", "lsm",
+		"flushes_completed", flushed,
+		"flushes_skipped", e.shutdown.flushesSkipped.Load(),
+		"memtables_left_in_wal", pending,
+		"compactions_aborted", e.shutdown.compactionsAborted.Load(),
+		"compactions_skipped", e.shutdown.compactionsSkipped.Load())
+}
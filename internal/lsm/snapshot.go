@@ -0,0 +1,296 @@
+package lsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+var errSnapshotClosed = errors.New("snapshot is closed")
+
+// snapshot là engine.Snapshot: một readView đóng băng (MemTable dùng chung
+// nhưng chỉ thấy entry có seqno <= seq, Immutables không đổi sau khi xoay,
+// các tệp SST được giữ bởi versionPin) cùng seqno tại thời điểm chụp
+type snapshot struct {
+	e    *LSMEngine
+	seq  uint64
+	view *readView
+
+	mu      sync.Mutex
+	refs    int // 1 cho chính snapshot + số iterator đang mở
+	closed  bool
+	created time.Time
+}
+
+// snapshotSet là các snapshot đang mở (cho metrics). Giá trị zero dùng được ngay.
+type snapshotSet struct {
+	mu   sync.Mutex
+	live map[*snapshot]struct{}
+}
+
+func (ss *snapshotSet) add(s *snapshot) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.live == nil {
+		ss.live = make(map[*snapshot]struct{})
+	}
+	ss.live[s] = struct{}{}
+}
+
+func (ss *snapshotSet) remove(s *snapshot) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.live, s)
+}
+
+// export: số snapshot còn mở (kể cả snapshot đã Close nhưng còn iterator
+// đọc) và tuổi của snapshot cũ nhất; snapshot sống lâu giữ tệp và MemTable
+func (ss *snapshotSet) export(m map[string]int64) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	var oldest time.Time
+	for s := range ss.live {
+		if oldest.IsZero() || s.created.Before(oldest) {
+			oldest = s.created
+		}
+	}
+	m["open_snapshots"] = int64(len(ss.live))
+	m["oldest_snapshot_age_sec"] = 0
+	if !oldest.IsZero() {
+		m["oldest_snapshot_age_sec"] = int64(time.Since(oldest).Seconds())
+	}
+}
+
+// Snapshot chụp MemTable, Immutables và các level dưới cùng một lần giữ
+// e.mu, nên ảnh chụp khớp đúng seqno của lần commit cuối. MemTable không bị
+// sao chép: nó giữ lại các bản bị ghi đè tới khi snapshot nhả (retain).
+func (e *LSMEngine) Snapshot() (engine.Snapshot, error) {
+	e.mu.RLock()
+	if e.shuttingDown {
+		e.mu.RUnlock()
+		return nil, errors.New("database is shutting down")
+	}
+	seq := e.lastSeq.Load()
+	v := &readView{mem: e.mem, seq: seq}
+	e.mem.retain(seq)
+	e.immutMu.RLock()
+	v.immutables = append([]*MemTable(nil), e.immutables...)
+	e.immutMu.RUnlock()
+	v.levels = make(map[int][]*FileMetadata, len(e.current.Levels))
+	for level, files := range e.current.Levels {
+		v.levels[level] = files
+	}
+	v.ranges = e.current.RangeTombstones
+	v.pin = e.versions.acquire(v.levels)
+	e.mu.RUnlock()
+
+	s := &snapshot{e: e, seq: seq, view: v, refs: 1, created: time.Now()}
+	e.snapshots.add(s)
+	return s, nil
+}
+
+func (s *snapshot) Seq() uint64 { return s.seq }
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	if !s.acquire() {
+		return nil, errSnapshotClosed
+	}
+	defer s.release()
+	s.e.metrics.gets.Add(1)
+	val, res, err := s.e.lookupIn(s.view, string(key), nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if res.source == sourceNone || res.tombstone {
+		return nil, engine.ErrKeyNotFound
+	}
+	return val, nil
+}
+
+func (s *snapshot) NewIterator() (engine.Iterator, error) {
+	return s.newRangeIterator("", "")
+}
+
+func (s *snapshot) NewPrefixIterator(prefix string) (engine.Iterator, error) {
+	return s.newRangeIterator(prefix, prefixEnd(prefix))
+}
+
+func (s *snapshot) NewPrefixIteratorContext(ctx context.Context, prefix string) (engine.Iterator, error) {
+	return s.e.withSchedule(ctx, func() (engine.Iterator, error) { return s.NewPrefixIterator(prefix) })
+}
+
+// newRangeIterator: iterator giữ snapshot tới khi đóng, nên Close của
+// snapshot không làm hỏng các iterator còn đang đọc
+func (s *snapshot) newRangeIterator(start, end string) (engine.Iterator, error) {
+	if !s.acquire() {
+		return nil, errSnapshotClosed
+	}
+	it, err := s.e.viewIterator(s.view, start, end)
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	return s.e.newVersionIterator(it, s.release), nil
+}
+
+// Close nhả snapshot; các tệp nó giữ được dọn khi iterator cuối cùng đóng
+func (s *snapshot) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+	s.release()
+	return nil
+}
+
+func (s *snapshot) acquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	s.refs++
+	return true
+}
+
+func (s *snapshot) release() {
+	s.mu.Lock()
+	s.refs--
+	done := s.refs == 0
+	s.mu.Unlock()
+	if done {
+		s.e.snapshots.remove(s)
+		s.view.mem.unretain()
+		s.e.releaseVersion(s.view.pin)
+	}
+}
+
+// retain: một snapshot với seqno seq bắt đầu đọc MemTable; từ giờ bản bị
+// Put/Delete ghi đè được giữ lại nếu snapshot đó có thể thấy nó
+func (m *MemTable) retain(seq uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retained++
+	m.retainSeq = max(m.retainSeq, seq)
+}
+
+// unretain: snapshot nhả MemTable; snapshot cuối cùng nhả thì bỏ các bản cũ
+func (m *MemTable) unretain() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.retained--; m.retained == 0 {
+		m.retainSeq, m.history = 0, nil
+	}
+}
+
+// keepVersion giữ bản it của key vừa bị ghi đè nếu snapshot còn mở có thể
+// thấy nó (bản ghi sau snapshot mới nhất thì không ai thấy). Caller giữ m.mu.
+func (m *MemTable) keepVersion(key string, it *engine.Item) {
+	if m.retained == 0 || it.Seq > m.retainSeq {
+		return
+	}
+	if m.history == nil {
+		m.history = make(map[string][]*engine.Item)
+	}
+	m.history[key] = append(m.history[key], it)
+}
+
+// getAt trả về bản mới nhất của key có seqno <= seq (false nếu key chỉ được
+// ghi vào MemTable sau seq: snapshot tra tiếp ở nguồn cũ hơn)
+func (m *MemTable) getAt(key string, seq uint64) (*engine.Item, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	val, ok := m.sl.GetValue(key)
+	if !ok {
+		return nil, false
+	}
+	return m.versionAt(key, val.(*engine.Item), seq)
+}
+
+// versionAt chọn trong cur và các bản cũ của key bản mới nhất có seqno <= seq.
+// Caller giữ m.mu.
+func (m *MemTable) versionAt(key string, cur *engine.Item, seq uint64) (*engine.Item, bool) {
+	if cur.Seq <= seq {
+		return cur, true
+	}
+	older := m.history[key]
+	for i := len(older) - 1; i >= 0; i-- {
+		if older[i].Seq <= seq {
+			return older[i], true
+		}
+	}
+	return nil, false
+}
+
+// snapshotMemBatch: số entry snapshotMemIterator đọc mỗi lần giữ m.mu
+const snapshotMemBatch = 256
+
+// snapshotMemIterator duyệt MemTable như snapshot seqno seq thấy. Khác
+// memTableIterator (giữ RLock tới khi Close), nó chỉ giữ m.mu trong lúc đọc
+// từng lô entry nên snapshot sống lâu không chặn các lần ghi vào MemTable.
+type snapshotMemIterator struct {
+	mem  *MemTable
+	seq  uint64
+	buf  []memEntry
+	from string // Key đầu tiên của lô kế tiếp
+	done bool
+	cur  memEntry
+}
+
+type memEntry struct {
+	key  string
+	item *engine.Item
+}
+
+func newSnapshotMemIterator(mem *MemTable, seq uint64) *snapshotMemIterator {
+	return &snapshotMemIterator{mem: mem, seq: seq}
+}
+
+// fill đọc lô entry kế tiếp (key >= it.from) mà snapshot thấy
+func (it *snapshotMemIterator) fill() {
+	m := it.mem
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	el := m.sl.Find(it.from)
+	for n := 0; el != nil && n < snapshotMemBatch; el, n = el.Next(), n+1 {
+		k := el.Key().(string)
+		if item, ok := m.versionAt(k, el.Value.(*engine.Item), it.seq); ok {
+			it.buf = append(it.buf, memEntry{key: k, item: item})
+		}
+	}
+	if el == nil {
+		it.done = true
+		return
+	}
+	it.from = el.Key().(string)
+}
+
+func (it *snapshotMemIterator) Next() bool {
+	for len(it.buf) == 0 {
+		if it.done {
+			return false
+		}
+		it.fill()
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+func (it *snapshotMemIterator) Seek(key string) {
+	it.buf, it.from, it.done = it.buf[:0], key, false
+}
+
+func (it *snapshotMemIterator) Key() string         { return it.cur.key }
+func (it *snapshotMemIterator) Value() *engine.Item { return it.cur.item }
+func (it *snapshotMemIterator) Error() error        { return nil }
+
+func (it *snapshotMemIterator) Close() error {
+	it.buf, it.done = nil, true
+	return nil
+}
@@ -0,0 +1,161 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+func snapshotKeys(t *testing.T, s engine.Snapshot, prefix string) map[string]string {
+	t.Helper()
+	it, err := s.NewPrefixIterator(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	out := make(map[string]string)
+	for it.Next() {
+		out[it.Key()] = string(it.Value().Value)
+	}
+	if err := it.Error(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// Ghi đè, xóa và key mới sau snapshot nằm cùng MemTable với bản snapshot thấy
+func TestSnapshotIgnoresLaterWritesInMemTable(t *testing.T) {
+	db, err := OpenLSMWithConfig(t.TempDir(), 1000, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	db.Put([]byte("k:a"), []byte("a1"))
+	db.Put([]byte("k:b"), []byte("b1"))
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+
+	db.Put([]byte("k:a"), []byte("a2"))
+	db.Put([]byte("k:a"), []byte("a3"))
+	db.Delete([]byte("k:b"))
+	db.Put([]byte("k:c"), []byte("c1"))
+
+	if got, err := snap.Get([]byte("k:a")); err != nil || string(got) != "a1" {
+		t.Fatalf("snapshot get k:a = %q, %v; want a1", got, err)
+	}
+	if got, err := snap.Get([]byte("k:b")); err != nil || string(got) != "b1" {
+		t.Fatalf("snapshot get k:b = %q, %v; want b1", got, err)
+	}
+	if _, err := snap.Get([]byte("k:c")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("snapshot get k:c err = %v, want not found", err)
+	}
+	got := snapshotKeys(t, snap, "k:")
+	if len(got) != 2 || got["k:a"] != "a1" || got["k:b"] != "b1" {
+		t.Fatalf("snapshot scan = %v", got)
+	}
+	if val, _ := db.Get([]byte("k:a")); string(val) != "a3" {
+		t.Fatalf("get k:a = %q, want a3", val)
+	}
+}
+
+// Snapshot vẫn thấy đúng dữ liệu lúc chụp sau khi MemTable bị xoay, flush
+// và compaction
+func TestSnapshotSurvivesFlushAndCompaction(t *testing.T) {
+	db, err := OpenLSMWithConfig(t.TempDir(), 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	put := func(key, val string) {
+		for {
+			err := db.Put([]byte(key), []byte(val))
+			if err == nil {
+				return
+			}
+			if !errors.Is(err, ErrTooManyPendingFlushes) {
+				t.Fatalf("put %s: %v", key, err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	for i := 0; i < 40; i++ {
+		put(fmt.Sprintf("k:%03d", i), "old")
+	}
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 40; i++ {
+			put(fmt.Sprintf("k:%03d", i), fmt.Sprintf("new%d", round))
+		}
+	}
+	if err := db.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := snapshotKeys(t, snap, "k:")
+	if len(got) != 40 {
+		t.Fatalf("snapshot scan has %d keys, want 40", len(got))
+	}
+	for k, v := range got {
+		if v != "old" {
+			t.Fatalf("snapshot %s = %q, want old", k, v)
+		}
+	}
+	if val, err := snap.Get([]byte("k:007")); err != nil || string(val) != "old" {
+		t.Fatalf("snapshot get = %q, %v; want old", val, err)
+	}
+}
+
+// Iterator của snapshot đang đọc dở không chặn lần ghi vào MemTable
+func TestSnapshotIteratorDoesNotBlockWrites(t *testing.T) {
+	db, err := OpenLSMWithConfig(t.TempDir(), 1000, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for i := 0; i < 10; i++ {
+		db.Put([]byte(fmt.Sprintf("k:%d", i)), []byte("v"))
+	}
+	snap, err := db.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Close()
+	it, err := snap.NewPrefixIterator("k:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+	if !it.Next() {
+		t.Fatal("empty snapshot scan")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- db.Put([]byte("k:x"), []byte("v")) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("put blocked by open snapshot iterator")
+	}
+	n := 1
+	for it.Next() {
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("snapshot scan = %d keys, want 10", n)
+	}
+}
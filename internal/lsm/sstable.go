@@ -10,43 +10,68 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/nconghau/MiniDBGo/internal/engine"
 )
 
 const (
-	// SSTable format version
-	SSTVersion = 1
+	// SSTable format version (2: data block có codec byte trong trailer;
+	// 3: key trong data block rút gọn theo tiền tố, có restart point - xem block.go;
+	// 4: bloom filter dạng block, hash bằng xxhash - xem bloom.go;
+	// 5: footer kết thúc bằng magic number;
+	// 6: CRC cho index/bloom/footer và properties block - xem properties.go;
+	// 7: entry có thể là con trỏ vào value log - xem vlog.go;
+	// 8: Index Block có thể chia partition (hai tầng) - xem index_partition.go;
+	// 9: entry có thể kèm thời điểm commit - xem entryUpdatedAt;
+	// 10: entry có thể kèm seqno của lần ghi - xem entrySeq;
+	// 11: footer ghi kích thước data block của tệp - xem SSTWriter.SetBlockSize;
+	// 12: entry có thể kèm thời điểm hết hạn (TTL) - xem entryExpiresAt).
+	// Các version đọc được: xem sstFormats.
+	SSTVersion = 12
 
 	// Buffer sizes
 	SSTWriteBufferSize = 256 * 1024 // 256KB
 	SSTReadBufferSize  = 128 * 1024 // 128KB
 
 	// --- MỚI: Kích thước khối dữ liệu ---
-	SSTDataBlockSize = 4 * 1024 // 4KB
+	SSTDataBlockSize = 4 * 1024 // 4KB, mặc định (xem Options.BlockSize)
+	MaxDataBlockSize = 16 << 20 // Kích thước data block lớn nhất được cấu hình
 
 	// SSTable file format:
 	// [Header: 8 bytes]
 	// [Data Block 1]
 	// [Data Block 2]
 	// ...
+	// [Index Partitions: variable, từ v8 khi index lớn]
 	// [Index Block: variable]
 	// [BloomFilter Data: variable]
-	// [Footer: 44 bytes]
+	// [Properties Block: variable, từ v6]
+	// [Footer: 44 bytes (+ 32 bytes từ v6) (+ 4 bytes từ v11) (+ magic 8 bytes từ v5)]
 	//
 	// Header: version(4) + count(4)
-	// Entry: keyLen(4) + valueLen(4) + flag(1) + key + value
+	// Entry (v1, v2): keyLen(4) + valueLen(4) + flag(1) + key + value
+	// Entry (v3): xem blockBuilder
+	// Data Block: payload (entry, có thể đã nén) + trailer
+	// Trailer: v1 = crc(4); v2 = codec(1) + crc(4), crc tính trên payload + codec
 	//
 	// --- SỬA ĐỔI: Footer ---
 	// Footer: indexOffset(8) + indexLen(8) + bloomOffset(8) + bloomLen(8) + bloomN_bits(8) + bloomK_hashes(4)
-	SSTFooterSize = 44 // 8+8+8+8+8+4
+	// (+ propsOffset(8) + propsLen(8) + indexCrc(4) + bloomCrc(4) + propsCrc(4) + footerCrc(4) từ v6,
+	// footerCrc tính trên header + các field footer đứng trước nó)
+	// (+ blockSize(4) ngay trước footerCrc từ v11)
+	// (+ magic(8) từ v5)
+	SSTFooterSize          = 44 // 8+8+8+8+8+4
+	sstChecksumFooterSize  = 32
+	sstBlockSizeFooterSize = 4
+	SSTHeaderSize          = 8
 )
 
 // --- MỚI: Cấu trúc cho một entry trong Index Block ---
 type blockIndexEntry struct {
 	lastKey string // Khóa cuối cùng trong khối dữ liệu
 	offset  int64  // Offset bắt đầu của khối dữ liệu
-	length  int64  // Độ dài của khối dữ liệu
+	length  int64  // Độ dài của khối dữ liệu trên đĩa (sau khi nén, không gồm trailer)
 }
 
 // SSTMetadata (Không thay đổi)
@@ -55,10 +80,13 @@ type SSTMetadata struct {
 	Level       int
 	Sequence    int
 	KeyCount    uint32
+	Tombstones  uint32
 	MinKey      string
 	MaxKey      string
 	FileSize    int64
 	BloomFilter *BloomFilter
+
+	ValueLogRefs map[uint32]int64 // Số byte record value log mà tệp trỏ tới, theo tệp vlog
 }
 
 // SSTWriter handles writing SSTable files
@@ -69,17 +97,38 @@ type SSTWriter struct {
 	count  uint32
 	minKey string
 	maxKey string
-	bloom  *BloomFilter
+	bloom  *BloomFilter // Tạo ở Close từ keyHashes (đúng số key đã ghi)
+
+	bloomPolicy BloomPolicy
+	keyHashes   []uint64 // bloomHash của mọi key đã ghi (rỗng nếu bloom tắt)
+
+	compression Compression // Codec nén data block
+
+	// Kích thước data block (xem SetBlockSize); blockLimit là kích thước của khối đang ghi
+	blockSize            int
+	collectionBlockSizes map[string]int
+	usedBlockSizes       map[string]int // Các collection trong tệp đã dùng kích thước riêng
+	blockLimit           int
+
+	// Số liệu cho properties block
+	level         int
+	tombstones    uint64
+	rawKeyBytes   uint64
+	rawValueBytes uint64
+	rawDataBytes  uint64
+
+	valueLogRefs map[uint32]int64 // Xem SSTMetadata.ValueLogRefs
 
 	// --- MỚI: Trạng thái cho Block Index ---
 	indexEntries       []blockIndexEntry // Danh sách các entry index
-	currentBlock       bytes.Buffer      // Bộ đệm cho khối dữ liệu hiện tại
+	currentBlock       blockBuilder      // Bộ đệm cho khối dữ liệu hiện tại
 	currentBlockOffset int64             // Offset tệp nơi khối hiện tại bắt đầu
 	lastBlockKey       string            // Khóa cuối cùng được ghi vào khối hiện tại
 }
 
-// NewSSTWriter creates a new SSTable writer
-func NewSSTWriter(path string, estimatedKeys uint32) (*SSTWriter, error) {
+// NewSSTWriter creates a new SSTable writer (level chỉ được ghi vào properties block).
+// estimatedKeys chỉ để cấp phát trước; bloom filter được tính theo số key thực tế.
+func NewSSTWriter(path string, level int, estimatedKeys uint32, compression Compression, bloom BloomPolicy) (*SSTWriter, error) {
 	f, err := os.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("create sst file: %w", err)
@@ -90,19 +139,23 @@ func NewSSTWriter(path string, estimatedKeys uint32) (*SSTWriter, error) {
 		writer: bufio.NewWriterSize(f, SSTWriteBufferSize),
 		path:   path,
 		count:  0,
-		bloom:  NewBloomFilter(estimatedKeys*10, 3), // [cite: 87]
+
+		bloomPolicy: bloom,
+
+		compression: compression,
+		level:       level,
+		blockSize:   SSTDataBlockSize,
 
 		// --- MỚI: Khởi tạo trạng thái Block Index ---
 		indexEntries:       make([]blockIndexEntry, 0, 128),
-		currentBlock:       bytes.Buffer{},
 		currentBlockOffset: 8, // Bắt đầu sau header 8 byte
 	}
+	if bloom.enabled() {
+		w.keyHashes = make([]uint64, 0, min(estimatedKeys, maxPreallocKeyHashes))
+	}
 
 	// Write header placeholder (will be updated on close)
-	header := make([]byte, 8)
-	binary.LittleEndian.PutUint32(header[0:4], SSTVersion)
-	binary.LittleEndian.PutUint32(header[4:8], 0)     // count placeholder
-	if _, err := w.writer.Write(header); err != nil { // [cite: 88]
+	if _, err := w.writer.Write(sstHeader(SSTVersion, 0)); err != nil { // [cite: 88]
 		f.Close()
 		return nil, fmt.Errorf("write header: %w", err)
 	}
@@ -110,39 +163,77 @@ func NewSSTWriter(path string, estimatedKeys uint32) (*SSTWriter, error) {
 	return w, nil
 }
 
+// SetBlockSize đặt kích thước data block của tệp (<= 0: SSTDataBlockSize) và
+// kích thước riêng của các collection (tiền tố key trước ':'). Khối không trộn
+// hai collection khác kích thước. Gọi trước WriteEntry đầu tiên.
+func (w *SSTWriter) SetBlockSize(size int, collections map[string]int) {
+	w.blockSize = clampBlockSize(size)
+	w.collectionBlockSizes = collections
+}
+
+func clampBlockSize(size int) int {
+	if size <= 0 {
+		return SSTDataBlockSize
+	}
+	return min(size, MaxDataBlockSize)
+}
+
+// blockSizeFor trả về kích thước khối cho key
+func (w *SSTWriter) blockSizeFor(key string) int {
+	if len(w.collectionBlockSizes) == 0 {
+		return w.blockSize
+	}
+	col, _, _ := strings.Cut(key, ":")
+	size, ok := w.collectionBlockSizes[col]
+	if !ok {
+		return w.blockSize
+	}
+	size = clampBlockSize(size)
+	if w.usedBlockSizes == nil {
+		w.usedBlockSizes = make(map[string]int)
+	}
+	w.usedBlockSizes[col] = size
+	return size
+}
+
 // --- MỚI: Hàm flush khối dữ liệu hiện tại ra đĩa ---
 func (w *SSTWriter) flushCurrentBlock() error {
-	if w.currentBlock.Len() == 0 {
+	if w.currentBlock.empty() {
 		return nil
 	}
 
-	blockData := w.currentBlock.Bytes()
+	raw := w.currentBlock.finish()
+	w.rawDataBytes += uint64(len(raw))
+	blockData, codec, err := compressBlock(w.compression, raw)
+	if err != nil {
+		return fmt.Errorf("compress data block: %w", err)
+	}
 
-	// --- LOGIC MỚI: TÍNH VÀ GHI CRC ---
-	crc := crc32.Checksum(blockData, crcTable)
-	// --- KẾT THÚC LOGIC MỚI ---
+	// CRC tính trên dữ liệu đã nén + codec byte
+	crc := crc32.Update(crc32.Checksum(blockData, crcTable), crcTable, []byte{codec})
 
-	// Ghi khối dữ liệu (như cũ)
 	if _, err := w.writer.Write(blockData); err != nil {
 		return fmt.Errorf("write data block: %w", err)
 	}
 
-	// --- LOGIC MỚI: GHI CRC (4 bytes) ---
+	// Trailer: codec(1) + crc(4)
+	if err := w.writer.WriteByte(codec); err != nil {
+		return fmt.Errorf("write data block codec: %w", err)
+	}
 	if err := binary.Write(w.writer, binary.LittleEndian, crc); err != nil {
 		return fmt.Errorf("write data block crc: %w", err)
 	}
-	// --- KẾT THÚC LOGIC MỚI ---
 
 	w.indexEntries = append(w.indexEntries, blockIndexEntry{
 		lastKey: w.lastBlockKey,
 		offset:  w.currentBlockOffset,
-		length:  int64(len(blockData)), // Vẫn giữ nguyên length của data
+		length:  int64(len(blockData)),
 	})
 
 	// Cập nhật offset cho khối tiếp theo
-	// (offset MỚI = offset cũ + data_len + 4 byte CRC)
-	w.currentBlockOffset += int64(len(blockData)) + 4 // +4 cho CRC
-	w.currentBlock.Reset()
+	// (offset MỚI = offset cũ + data_len + trailer)
+	w.currentBlockOffset += int64(len(blockData)) + sstFormats[SSTVersion].blockTrailerSize()
+	w.currentBlock.reset()
 	return nil
 }
 
@@ -155,35 +246,41 @@ func (w *SSTWriter) WriteEntry(key string, item *engine.Item) error {
 	w.maxKey = key
 	w.count++
 
-	// Add to bloom filter
-	w.bloom.Add(key)
+	// Bloom filter được dựng ở Close, khi đã biết số key
+	if w.bloomPolicy.enabled() {
+		w.keyHashes = append(w.keyHashes, bloomHash(key))
+	}
 
-	kb := []byte(key)
 	vb := item.Value
 	if item.Tombstone {
-		vb = []byte{} // Empty value for tombstone
+		vb = nil // Empty value for tombstone
+		w.tombstones++
 	}
+	w.rawKeyBytes += uint64(len(key))
+	w.rawValueBytes += uint64(len(vb))
 
-	// --- SỬA ĐỔI: Ghi entry vào bộ đệm khối (currentBlock) ---
-	// Định dạng entry không đổi: keyLen(4) + valueLen(4) + flag(1) + key + value
-	entryHeader := make([]byte, 9) // 4+4+1
-	binary.LittleEndian.PutUint32(entryHeader[0:4], uint32(len(kb)))
-	binary.LittleEndian.PutUint32(entryHeader[4:8], uint32(len(vb)))
-	if item.Tombstone {
-		entryHeader[8] = 1
-	} else {
-		entryHeader[8] = 0
+	if item.ValuePointer {
+		if err := w.addValueLogRef(vb); err != nil {
+			return err
+		}
 	}
 
-	w.currentBlock.Write(entryHeader)
-	w.currentBlock.Write(kb)
-	w.currentBlock.Write(vb)
+	// Key thuộc collection có kích thước khối khác: bắt đầu khối mới
+	limit := w.blockSizeFor(key)
+	if limit != w.blockLimit && !w.currentBlock.empty() {
+		if err := w.flushCurrentBlock(); err != nil {
+			return err
+		}
+	}
+	w.blockLimit = limit
 
+	// --- SỬA ĐỔI: Ghi entry vào bộ đệm khối (currentBlock) ---
+	w.currentBlock.add(key, vb, entryFlag(item), item.UpdatedAt, item.Seq, item.ExpiresAt)
 	w.lastBlockKey = key
 	// --- KẾT THÚC SỬA ĐỔI ---
 
 	// Nếu khối đầy, flush nó
-	if w.currentBlock.Len() >= SSTDataBlockSize {
+	if w.currentBlock.size() >= w.blockLimit {
 		if err := w.flushCurrentBlock(); err != nil {
 			return err
 		}
@@ -192,6 +289,11 @@ func (w *SSTWriter) WriteEntry(key string, item *engine.Item) error {
 	return nil
 }
 
+// DataSize trả về số byte data block đã ghi (kể cả khối đang đệm, chưa nén)
+func (w *SSTWriter) DataSize() int64 {
+	return w.currentBlockOffset + int64(w.currentBlock.size())
+}
+
 // Close finalizes the SSTable file
 // --- SỬA ĐỔI: Ghi Index Block, Bloom Filter, và Footer mới ---
 func (w *SSTWriter) Close() error {
@@ -200,78 +302,51 @@ func (w *SSTWriter) Close() error {
 		return fmt.Errorf("flush final block: %w", err)
 	}
 
-	// 2. Flush mọi thứ từ writer ra file
-	if err := w.writer.Flush(); err != nil { // [cite: 93]
-		return fmt.Errorf("flush writer: %w", err)
-	}
-
-	// 3. Ghi Index Block
-	indexOffset, err := w.file.Seek(0, io.SeekCurrent)
+	// 2. Index Block: kind(1) + count(4) + [lastKeyLen(4) + lastKey + offset(8) + length(8)]...
+	// (index lớn: partition ghi trước, Index Block trỏ tới partition - xem writeIndex).
+	// Properties tính trước để data_bytes không gồm partition.
+	props := encodeProperties(w.properties())
+	index, err := w.writeIndex()
 	if err != nil {
-		return fmt.Errorf("seek for index block: %w", err)
-	}
-
-	// Ghi số lượng entry trong index
-	if err := binary.Write(w.file, binary.LittleEndian, uint32(len(w.indexEntries))); err != nil {
-		return fmt.Errorf("write index entry count: %w", err)
-	}
-	// Ghi từng entry (lastKeyLen, lastKey, offset, length)
-	for _, entry := range w.indexEntries {
-		keyBytes := []byte(entry.lastKey)
-		// keyLen
-		if err := binary.Write(w.file, binary.LittleEndian, uint32(len(keyBytes))); err != nil {
-			return fmt.Errorf("write index keylen: %w", err)
-		}
-		// key
-		if _, err := w.file.Write(keyBytes); err != nil {
-			return fmt.Errorf("write index key: %w", err)
-		}
-		// offset
-		if err := binary.Write(w.file, binary.LittleEndian, entry.offset); err != nil {
-			return fmt.Errorf("write index offset: %w", err)
-		}
-		// length
-		if err := binary.Write(w.file, binary.LittleEndian, entry.length); err != nil {
-			return fmt.Errorf("write index length: %w", err)
-		}
+		return err
 	}
 
-	indexEndOffset, _ := w.file.Seek(0, io.SeekCurrent)
-	indexLen := indexEndOffset - indexOffset
-
-	// 4. Ghi Bloom Filter (như Giai đoạn 1)
-	bloomOffset, err := w.file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return fmt.Errorf("seek for bloom offset: %w", err)
-	}
+	// 3. Bloom Filter và Properties Block ngay sau Index Block
+	w.buildBloom()
 	bloomData := w.bloom.ToBytes()
-	if _, err := w.file.Write(bloomData); err != nil {
-		return fmt.Errorf("write bloom data: %w", err)
+	indexOffset := uint64(w.currentBlockOffset)
+	bloomOffset := indexOffset + uint64(len(index))
+	propsOffset := bloomOffset + uint64(len(bloomData))
+	for _, part := range [][]byte{index, bloomData, props} {
+		if _, err := w.writer.Write(part); err != nil {
+			return fmt.Errorf("write index/bloom/properties: %w", err)
+		}
 	}
-	bloomLen := uint64(len(bloomData))
 
-	// 5. Ghi Footer mới (44 bytes)
-	// indexOffset(8) + indexLen(8) + bloomOffset(8) + bloomLen(8) + bloomN_bits(8) + bloomK_hashes(4)
-	if err := binary.Write(w.file, binary.LittleEndian, uint64(indexOffset)); err != nil {
-		return fmt.Errorf("write footer index offset: %w", err)
-	}
-	if err := binary.Write(w.file, binary.LittleEndian, uint64(indexLen)); err != nil {
-		return fmt.Errorf("write footer index length: %w", err)
-	}
-	if err := binary.Write(w.file, binary.LittleEndian, uint64(bloomOffset)); err != nil {
-		return fmt.Errorf("write footer bloom offset: %w", err)
-	}
-	if err := binary.Write(w.file, binary.LittleEndian, bloomLen); err != nil {
-		return fmt.Errorf("write footer bloom length: %w", err)
-	}
-	if err := binary.Write(w.file, binary.LittleEndian, uint64(w.bloom.n)); err != nil {
-		return fmt.Errorf("write footer bloom N: %w", err)
-	}
-	if err := binary.Write(w.file, binary.LittleEndian, uint32(w.bloom.k)); err != nil {
-		return fmt.Errorf("write footer bloom K: %w", err)
+	// 4. Footer (xem SSTFooterSize), footerCrc phủ cả header nên count cũng được bảo vệ
+	footer := make([]byte, 0, sstFormats[SSTVersion].footerSize)
+	footer = binary.LittleEndian.AppendUint64(footer, indexOffset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(index)))
+	footer = binary.LittleEndian.AppendUint64(footer, bloomOffset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(bloomData)))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(w.bloom.n))
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(w.bloom.k))
+	footer = binary.LittleEndian.AppendUint64(footer, propsOffset)
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(len(props)))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.Checksum(index, crcTable))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.Checksum(bloomData, crcTable))
+	footer = binary.LittleEndian.AppendUint32(footer, crc32.Checksum(props, crcTable))
+	footer = binary.LittleEndian.AppendUint32(footer, uint32(w.blockSize))
+	footer = binary.LittleEndian.AppendUint32(footer, footerChecksum(sstHeader(SSTVersion, w.count), footer))
+	footer = binary.LittleEndian.AppendUint64(footer, sstMagic)
+	if _, err := w.writer.Write(footer); err != nil {
+		return fmt.Errorf("write footer: %w", err)
+	}
+	if err := w.writer.Flush(); err != nil {
+		return fmt.Errorf("flush writer: %w", err)
 	}
 
-	// 6. Cập nhật Header (như cũ)
+	// 5. Cập nhật Header (như cũ)
 	if _, err := w.file.Seek(4, io.SeekStart); err != nil { // [cite: 94]
 		return fmt.Errorf("seek header: %w", err)
 	}
@@ -279,7 +354,7 @@ func (w *SSTWriter) Close() error {
 		return fmt.Errorf("write count: %w", err)
 	}
 
-	// 7. Sync và Close (như cũ)
+	// 6. Sync và Close (như cũ)
 	if err := w.file.Sync(); err != nil { // [cite: 96]
 		return fmt.Errorf("sync file: %w", err)
 	}
@@ -289,17 +364,50 @@ func (w *SSTWriter) Close() error {
 
 // --- KẾT THÚC SỬA ĐỔI Close() ---
 
+// maxPreallocKeyHashes giới hạn cấp phát trước theo estimatedKeys (ước lượng
+// của compaction có thể lệch xa số key thực tế)
+const maxPreallocKeyHashes = 1 << 20
+
+// buildBloom dựng bloom filter từ keyHashes (bloom tắt: noBloomFilter)
+func (w *SSTWriter) buildBloom() {
+	if !w.bloomPolicy.enabled() {
+		w.bloom = noBloomFilter
+		return
+	}
+	w.bloom = newBlockedBloomFilter(uint32(len(w.keyHashes)), w.bloomPolicy)
+	for _, h := range w.keyHashes {
+		w.bloom.addHash(h)
+	}
+	w.keyHashes = nil
+}
+
 // GetMetadata (Không thay đổi)
 func (w *SSTWriter) GetMetadata() *SSTMetadata {
 	stat, _ := os.Stat(w.path)
 	return &SSTMetadata{
 		Path:        w.path,
 		KeyCount:    w.count,
+		Tombstones:  uint32(w.tombstones),
 		MinKey:      w.minKey,
 		MaxKey:      w.maxKey,
 		FileSize:    stat.Size(),
 		BloomFilter: w.bloom,
+
+		ValueLogRefs: w.valueLogRefs,
+	}
+}
+
+// addValueLogRef cộng record mà con trỏ ptr trỏ tới vào valueLogRefs
+func (w *SSTWriter) addValueLogRef(ptr []byte) error {
+	p, err := decodeValuePointer(ptr)
+	if err != nil {
+		return err
+	}
+	if w.valueLogRefs == nil {
+		w.valueLogRefs = make(map[uint32]int64)
 	}
+	w.valueLogRefs[p.file] += p.length
+	return nil
 }
 
 // WriteSST (Không thay đổi)
@@ -313,7 +421,7 @@ func WriteSST(dir string, level, seq int, items map[string]*engine.Item) (string
 	}
 	sort.Strings(keys)
 	path := filepath.Join(dir, fmt.Sprintf("sst-L%d-%06d.sst", level, seq)) // [cite: 97]
-	writer, err := NewSSTWriter(path, uint32(len(items)))
+	writer, err := NewSSTWriter(path, level, uint32(len(items)), CompressionNone, BloomPolicy{})
 	if err != nil {
 		return "", err
 	}
@@ -332,7 +440,11 @@ func WriteSST(dir string, level, seq int, items map[string]*engine.Item) (string
 }
 
 // --- MỚI: Hàm đọc và tìm kiếm trong một khối dữ liệu ---
-func searchDataBlock(blockData []byte, key string) ([]byte, bool, error) {
+// (trả về item của key: value, tombstone hoặc con trỏ value log)
+func searchDataBlock(blockData []byte, format *sstFormat, key string) (*engine.Item, error) {
+	if format.restartBlocks {
+		return searchRestartBlock(blockData, key)
+	}
 	r := bytes.NewReader(blockData)
 	keyBytes := []byte(key)
 
@@ -342,56 +454,199 @@ func searchDataBlock(blockData []byte, key string) ([]byte, bool, error) {
 		var err error // --- SỬA 1: Khai báo 'err' một lần ở đây ---
 
 		if err = binary.Read(r, binary.LittleEndian, &klen); err != nil { // --- SỬA 2: Sử dụng '=' ---
-			return nil, false, fmt.Errorf("read data keylen: %w", err)
+			return nil, fmt.Errorf("read data keylen: %w", err)
 		}
 		if err = binary.Read(r, binary.LittleEndian, &vlen); err != nil { // --- SỬA 3: Sử dụng '=' ---
-			return nil, false, fmt.Errorf("read data vallen: %w", err)
+			return nil, fmt.Errorf("read data vallen: %w", err)
 		}
 
 		// --- SỬA 4: Sử dụng gán '=' để gán giá trị cho 'flag' và 'err' đã khai báo bên ngoài ---
 		flag, err = r.ReadByte()
 		if err != nil {
-			return nil, false, fmt.Errorf("read data flag: %w", err)
+			return nil, fmt.Errorf("read data flag: %w", err)
+		}
+		if int64(klen)+int64(vlen) > int64(r.Len()) {
+			return nil, fmt.Errorf("read data entry: %w", io.ErrUnexpectedEOF)
 		}
 
 		kb := make([]byte, klen)
 		if _, err := io.ReadFull(r, kb); err != nil {
-			return nil, false, fmt.Errorf("read data key: %w", err)
+			return nil, fmt.Errorf("read data key: %w", err)
 		}
 
 		if bytes.Equal(kb, keyBytes) {
 			vb := make([]byte, vlen)
 			if vlen > 0 {
 				if _, err := io.ReadFull(r, vb); err != nil {
-					return nil, false, fmt.Errorf("read data value: %w", err)
+					return nil, fmt.Errorf("read data value: %w", err)
 				}
 			}
-			if flag == 1 { // 'flag' bây giờ là biến được gán giá trị chính xác
-				return nil, true, nil // tombstone
-			}
-			return vb, false, nil
+			return entryItem(vb, flag)
 		} else {
 			// Bỏ qua value nếu key không khớp
 			if _, err := r.Seek(int64(vlen), io.SeekCurrent); err != nil {
-				return nil, false, fmt.Errorf("skip data value: %w", err)
+				return nil, fmt.Errorf("skip data value: %w", err)
 			}
 		}
 	}
 
-	return nil, false, os.ErrNotExist
+	return nil, os.ErrNotExist
+}
+
+// searchRestartBlock tìm nhị phân trên restart point rồi quét tiếp trong
+// đoạn (tối đa blockRestartInterval entry) chứa key
+func searchRestartBlock(blockData []byte, key string) (*engine.Item, error) {
+	b, err := decodeRestartBlock(blockData)
+	if err != nil {
+		return nil, err
+	}
+	off, err := b.seekRestart(key)
+	if err != nil {
+		return nil, err
+	}
+	var prev []byte
+	for off < len(b.data) {
+		k, v, flag, next, err := b.entry(off, prev)
+		if err != nil {
+			return nil, err
+		}
+		switch ks := string(k); {
+		case ks == key:
+			val := make([]byte, len(v)) // v trỏ vào block (có thể đang trong cache)
+			copy(val, v)
+			return entryItem(val, flag)
+		case ks > key:
+			return nil, os.ErrNotExist // Key tăng dần: đã vượt qua
+		}
+		prev, off = k, next
+	}
+	return nil, os.ErrNotExist
+}
+
+// sstFooter là nội dung đã parse của footer
+// (kèm định dạng theo version đọc từ header)
+type sstFooter struct {
+	format      *sstFormat
+	indexOffset uint64
+	indexLen    uint64
+	bloomOffset uint64
+	bloomLen    uint64
+	bloomN      uint64
+	bloomK      uint32
+	end         uint64 // Offset đầu footer: mọi block phải nằm trong [SSTHeaderSize, end)
+
+	// Từ v6 (format.checksums)
+	propsOffset uint64
+	propsLen    uint64
+	indexCrc    uint32
+	bloomCrc    uint32
+	propsCrc    uint32
+
+	blockSize uint32 // Từ v11 (format.blockSize); 0 = không ghi
+}
+
+// sstHeader mã hóa header: version(4) + count(4)
+func sstHeader(version, count uint32) []byte {
+	header := binary.LittleEndian.AppendUint32(make([]byte, 0, SSTHeaderSize), version)
+	return binary.LittleEndian.AppendUint32(header, count)
+}
+
+// footerChecksum là CRC của header và các field footer đứng trước footerCrc
+func footerChecksum(header, footer []byte) uint32 {
+	return crc32.Update(crc32.Checksum(header, crcTable), crcTable, footer)
+}
+
+// readFooter đọc footer ở cuối tệp SSTable và kiểm tra vị trí Index Block,
+// bloom nằm trong tệp (footer hỏng không được dẫn tới cấp phát khổng lồ)
+func readFooter(f io.ReaderAt, size int64) (*sstFooter, error) {
+	if size < 8 {
+		return nil, fmt.Errorf("file too small or corrupt")
+	}
+	header := make([]byte, SSTHeaderSize)
+	if _, err := f.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	format, err := lookupSSTFormat(binary.LittleEndian.Uint32(header))
+	if err != nil {
+		return nil, err
+	}
+
+	if size < (8 + format.footerSize) {
+		// Tệp quá nhỏ, có thể đang trong quá trình ghi hoặc bị hỏng
+		return nil, fmt.Errorf("file too small or corrupt")
+	}
+	footerData := make([]byte, format.footerSize)
+	if _, err := f.ReadAt(footerData, size-format.footerSize); err != nil {
+		return nil, fmt.Errorf("read footer: %w", err)
+	}
+	if format.magic {
+		if magic := binary.LittleEndian.Uint64(footerData[len(footerData)-8:]); magic != sstMagic {
+			return nil, fmt.Errorf("%w: bad magic number %#x", ErrUnsupportedFormat, magic)
+		}
+	}
+	if format.checksums {
+		crcOff := len(footerData) - 8 - 4 // footerCrc đứng ngay trước magic
+		if stored := binary.LittleEndian.Uint32(footerData[crcOff:]); stored != footerChecksum(header, footerData[:crcOff]) {
+			return nil, fmt.Errorf("footer checksum mismatch: %w", ErrCorruption)
+		}
+	}
+
+	ft := &sstFooter{format: format}
+	r := bytes.NewReader(footerData)
+	binary.Read(r, binary.LittleEndian, &ft.indexOffset)
+	binary.Read(r, binary.LittleEndian, &ft.indexLen)
+	binary.Read(r, binary.LittleEndian, &ft.bloomOffset)
+	binary.Read(r, binary.LittleEndian, &ft.bloomLen)
+	binary.Read(r, binary.LittleEndian, &ft.bloomN)
+	binary.Read(r, binary.LittleEndian, &ft.bloomK)
+	if format.checksums {
+		binary.Read(r, binary.LittleEndian, &ft.propsOffset)
+		binary.Read(r, binary.LittleEndian, &ft.propsLen)
+		binary.Read(r, binary.LittleEndian, &ft.indexCrc)
+		binary.Read(r, binary.LittleEndian, &ft.bloomCrc)
+		binary.Read(r, binary.LittleEndian, &ft.propsCrc)
+	}
+	if format.blockSize {
+		binary.Read(r, binary.LittleEndian, &ft.blockSize)
+	}
+
+	ft.end = uint64(size - format.footerSize)
+	if !blockInFile(ft.indexOffset, ft.indexLen, ft.end) || !blockInFile(ft.bloomOffset, ft.bloomLen, ft.end) {
+		return nil, fmt.Errorf("footer points outside file (index %d+%d, bloom %d+%d, size %d): %w",
+			ft.indexOffset, ft.indexLen, ft.bloomOffset, ft.bloomLen, size, ErrCorruption)
+	}
+	if format.checksums && !blockInFile(ft.propsOffset, ft.propsLen, ft.end) {
+		return nil, fmt.Errorf("footer points outside file (properties %d+%d, size %d): %w",
+			ft.propsOffset, ft.propsLen, size, ErrCorruption)
+	}
+	return ft, nil
+}
+
+// blockInFile: đoạn [offset, offset+length) nằm sau header và trước end (không tràn số)
+func blockInFile(offset, length, end uint64) bool {
+	return offset >= SSTHeaderSize && offset <= end && length <= end-offset
 }
 
-// --- MỚI: Hàm đọc Index Block và tìm khối dữ liệu phù hợp ---
-func readAndSearchIndexBlock(f *os.File, indexOffset, indexLen int64, key string) (int64, int64, error) {
-	indexData := make([]byte, indexLen)
-	if _, err := f.ReadAt(indexData, indexOffset); err != nil {
-		return 0, 0, fmt.Errorf("read index block: %w", err)
+// readIndexBlock đọc và parse toàn bộ Index Block (kể cả mọi index partition)
+func readIndexBlock(f io.ReaderAt, ft *sstFooter) ([]blockIndexEntry, error) {
+	entries, partitioned, err := readTopIndex(f, ft)
+	if err != nil || !partitioned {
+		return entries, err
 	}
+	return readIndexPartitions(f, ft, entries)
+}
 
+// parseIndexBlock giải mã Index Block: count(4) + [klen(4) key offset(8) length(8)]...
+func parseIndexBlock(indexData []byte) ([]blockIndexEntry, error) {
 	r := bytes.NewReader(indexData)
 	var numEntries uint32
 	if err := binary.Read(r, binary.LittleEndian, &numEntries); err != nil {
-		return 0, 0, fmt.Errorf("read index entry count: %w", err)
+		return nil, fmt.Errorf("read index entry count: %w", err)
+	}
+
+	// Mỗi entry tối thiểu 20 byte: count lớn hơn thế là index hỏng
+	if uint64(numEntries)*20 > uint64(r.Len()) {
+		return nil, fmt.Errorf("index entry count %d exceeds block size %d: %w", numEntries, len(indexData), ErrCorruption)
 	}
 
 	// Đọc tất cả các entry vào bộ nhớ (vì index block thường nhỏ)
@@ -399,115 +654,234 @@ func readAndSearchIndexBlock(f *os.File, indexOffset, indexLen int64, key string
 	for i := 0; i < int(numEntries); i++ {
 		var klen uint32
 		if err := binary.Read(r, binary.LittleEndian, &klen); err != nil {
-			return 0, 0, fmt.Errorf("read index entry klen: %w", err)
+			return nil, fmt.Errorf("read index entry klen: %w", err)
+		}
+		if int64(klen) > int64(r.Len()) {
+			return nil, fmt.Errorf("read index entry key: %w", io.ErrUnexpectedEOF)
 		}
 		keyBytes := make([]byte, klen)
 		if _, err := io.ReadFull(r, keyBytes); err != nil {
-			return 0, 0, fmt.Errorf("read index entry key: %w", err)
+			return nil, fmt.Errorf("read index entry key: %w", err)
 		}
 		entries[i].lastKey = string(keyBytes)
 		if err := binary.Read(r, binary.LittleEndian, &entries[i].offset); err != nil {
-			return 0, 0, fmt.Errorf("read index entry offset: %w", err)
+			return nil, fmt.Errorf("read index entry offset: %w", err)
 		}
 		if err := binary.Read(r, binary.LittleEndian, &entries[i].length); err != nil {
-			return 0, 0, fmt.Errorf("read index entry length: %w", err)
+			return nil, fmt.Errorf("read index entry length: %w", err)
 		}
 	}
+	return entries, nil
+}
 
-	// Tìm kiếm nhị phân (Binary Search)
-	// Tìm khối *đầu tiên* mà lastKey >= key
-	i := sort.Search(len(entries), func(i int) bool {
-		return entries[i].lastKey >= key
-	})
-
-	if i == len(entries) {
-		// Key lớn hơn tất cả các lastKey, không có trong tệp này
-		return 0, 0, os.ErrNotExist
+// readBloom đọc bloom filter (kiểm tra CRC từ v6)
+func readBloom(f io.ReaderAt, ft *sstFooter) (*BloomFilter, error) {
+	bloomData := make([]byte, ft.bloomLen)
+	if _, err := f.ReadAt(bloomData, int64(ft.bloomOffset)); err != nil {
+		return nil, fmt.Errorf("read bloom data: %w", err)
 	}
-
-	// Trả về offset và length của khối dữ liệu đã tìm thấy
-	return entries[i].offset, entries[i].length, nil
+	if ft.format.checksums && crc32.Checksum(bloomData, crcTable) != ft.bloomCrc {
+		return nil, fmt.Errorf("bloom filter checksum mismatch: %w", ErrCorruption)
+	}
+	return bloomFromBytes(ft.format, bloomData, ft.bloomN, ft.bloomK)
 }
 
-// ReadSSTFind searches for a key in an SSTable file
-// --- SỬA ĐỔI: Sử dụng Index Block thay vì quét tuần tự ---
-func ReadSSTFind(path string, key string) ([]byte, bool, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, false, err
+// blockTrailerSize là số byte ngay sau mỗi data block
+func (f *sstFormat) blockTrailerSize() int64 {
+	if !f.blockCodec {
+		return 4 // crc
 	}
-	defer f.Close()
+	return 5 // codec + crc
+}
 
-	stat, err := f.Stat()
-	if err != nil {
-		return nil, false, err
+// readDataBlock đọc một data block cùng trailer, kiểm tra CRC
+// rồi trả về block đã giải nén. shared = true: block (không nén) trỏ thẳng
+// vào vùng mmap của f, chỉ hợp lệ khi f còn mở - phải sao chép trước khi
+// giữ lâu hơn (vd. đưa vào block cache).
+func readDataBlock(f io.ReaderAt, format *sstFormat, entry blockIndexEntry) (block []byte, shared bool, err error) {
+	trailer := format.blockTrailerSize()
+	var buf []byte
+	if m, ok := f.(*sstFile); ok {
+		buf, shared = m.mapped(entry.offset, entry.length+trailer)
+	}
+	if !shared {
+		buf = make([]byte, entry.length+trailer)
+		if _, err := f.ReadAt(buf, entry.offset); err != nil {
+			return nil, false, fmt.Errorf("read data block: %w", err)
+		}
 	}
 
-	// 1. Đọc Footer
-	if stat.Size() < (8 + SSTFooterSize) {
-		// Tệp quá nhỏ, có thể đang trong quá trình ghi hoặc bị hỏng
-		return nil, false, fmt.Errorf("file too small or corrupt")
+	dataBlock := buf[:entry.length]
+	storedCrc := binary.LittleEndian.Uint32(buf[len(buf)-4:])
+	if !format.blockCodec {
+		if storedCrc != crc32.Checksum(dataBlock, crcTable) {
+			return nil, false, ErrCorruption // Lỗi! Block SSTable bị hỏng.
+		}
+		return dataBlock, shared, nil
 	}
 
-	footerData := make([]byte, SSTFooterSize)
-	if _, err := f.ReadAt(footerData, stat.Size()-SSTFooterSize); err != nil {
-		return nil, false, fmt.Errorf("read footer: %w", err)
+	// CRC phủ cả codec byte nên codec lạ sau bước này là định dạng mới hơn, không phải hỏng
+	if storedCrc != crc32.Checksum(buf[:entry.length+1], crcTable) {
+		return nil, false, ErrCorruption
 	}
+	codec := buf[entry.length]
+	block, err = decompressBlock(codec, dataBlock)
+	return block, shared && codec == codecNone, err
+}
 
-	var indexOffset, indexLen, bloomOffset, bloomLen, bloomN uint64
-	var bloomK uint32
+// SSTReader là một tệp SSTable đang mở cùng footer, Index Block và bloom
+// đã parse, để các lần tìm kiếm sau chỉ còn đọc data block
+type SSTReader struct {
+	path  string
+	f     *sstFile
+	ft    *sstFooter
+	index []blockIndexEntry // Tầng trên nếu partitioned (xem index_partition.go)
+	bloom *BloomFilter
 
-	r := bytes.NewReader(footerData)
-	binary.Read(r, binary.LittleEndian, &indexOffset)
-	binary.Read(r, binary.LittleEndian, &indexLen)
-	binary.Read(r, binary.LittleEndian, &bloomOffset)
-	binary.Read(r, binary.LittleEndian, &bloomLen)
-	binary.Read(r, binary.LittleEndian, &bloomN)
-	binary.Read(r, binary.LittleEndian, &bloomK)
+	partitioned bool
+}
+
+// OpenSSTReader mở tệp (đọc bằng pread) và nạp footer, bloom filter, Index Block
+func OpenSSTReader(path string) (*SSTReader, error) {
+	return openSSTReader(path, false)
+}
 
-	// 2. Kiểm tra Bloom Filter
-	bloomData := make([]byte, bloomLen)
-	if _, err = f.ReadAt(bloomData, int64(bloomOffset)); err != nil {
-		return nil, false, fmt.Errorf("read bloom data: %w", err)
+// openSSTReader giống OpenSSTReader; useMmap: đọc qua mmap (xem sstFile)
+func openSSTReader(path string, useMmap bool) (*SSTReader, error) {
+	f, err := openSSTFile(path, useMmap)
+	if err != nil {
+		return nil, err
 	}
+	r, err := loadSSTReader(path, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
 
-	bloom := NewFromBytes(bloomData, uint32(bloomN), int(bloomK))
-	if !bloom.MightContain(key) {
-		return nil, false, os.ErrNotExist // Tối ưu hóa thành công!
+func loadSSTReader(path string, f *sstFile) (*SSTReader, error) {
+	ft, err := readFooter(f, f.size)
+	if err != nil {
+		return nil, err
+	}
+	bloom, err := readBloom(f, ft)
+	if err != nil {
+		return nil, err
 	}
+	index, partitioned, err := readTopIndex(f, ft)
+	if err != nil {
+		return nil, err
+	}
+	return &SSTReader{
+		path:  path,
+		f:     f,
+		ft:    ft,
+		index: index,
+		bloom: bloom,
 
-	// 3. Đọc Index Block và tìm Data Block
-	blockOffset, blockLen, err := readAndSearchIndexBlock(f, int64(indexOffset), int64(indexLen), key)
+		partitioned: partitioned,
+	}, nil
+}
+
+// Find tìm key trong tệp (tombstone = true nếu key đã bị xóa).
+// Value nằm trong value log trả về lỗi ErrValueInValueLog (engine tự đọc qua con trỏ).
+func (r *SSTReader) Find(key string) ([]byte, bool, error) {
+	item, err := r.find(nil, nil, key, nil)
 	if err != nil {
-		return nil, false, err // os.ErrNotExist nếu không tìm thấy
+		return nil, false, err
 	}
+	if item.ValuePointer {
+		return nil, false, ErrValueInValueLog
+	}
+	return item.Value, item.Tombstone, nil
+}
 
-	// 4. Đọc và quét Data Block
-	dataBlock := make([]byte, blockLen)
-	if _, err := f.ReadAt(dataBlock, blockOffset); err != nil {
-		return nil, false, fmt.Errorf("read data block: %w", err)
+// find giống Find nhưng lấy data block từ cache (nếu có) trước khi đọc đĩa.
+// bs != nil: đếm kết quả bloom (kể cả dương tính giả).
+// step != nil: ghi lại kết quả bloom và block đã đọc (GetTrace).
+func (r *SSTReader) find(cache *blockCache, bs *bloomStats, key string, step *engine.TraceStep) (item *engine.Item, err error) {
+	if r.bloom.disabled() {
+		// Tệp ghi với bloom tắt: không tính vào bloomStats
+		bs = nil
+		if step != nil {
+			step.Bloom = "none"
+		}
+	}
+	if bs != nil {
+		bs.checks.Add(1)
+	}
+	if !r.bloom.MightContain(key) {
+		if bs != nil {
+			bs.negatives.Add(1)
+		}
+		if step != nil {
+			step.Bloom = "negative"
+		}
+		return nil, os.ErrNotExist // Tối ưu hóa thành công!
+	}
+	if bs != nil {
+		defer func() {
+			if err == os.ErrNotExist {
+				bs.falsePositives.Add(1)
+			}
+		}()
+	}
+	if step != nil && step.Bloom == "" {
+		step.Bloom = "positive"
 	}
 
-	// --- LOGIC MỚI: ĐỌC VÀ KIỂM TRA CRC ---
-	var storedCrc uint32
-	// Đọc 4 byte CRC ngay sau data block
-	crcBytes := make([]byte, 4)
-	if _, err := f.ReadAt(crcBytes, blockOffset+blockLen); err != nil {
-		return nil, false, fmt.Errorf("read data block crc: %w", err)
+	// Tìm khối *đầu tiên* mà lastKey >= key
+	entry, ok, err := r.blockFor(cache, key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Key lớn hơn tất cả các lastKey, không có trong tệp này
+		return nil, os.ErrNotExist
 	}
 
-	if err := binary.Read(bytes.NewReader(crcBytes), binary.LittleEndian, &storedCrc); err != nil {
-		return nil, false, fmt.Errorf("parse data block crc: %w", err)
+	// Đọc (kèm kiểm tra CRC) và quét Data Block
+	block, cached := cache.get(r.path, entry.offset)
+	if step != nil {
+		step.Block = &engine.TraceBlock{Offset: entry.offset, Length: entry.length, Cached: cached}
 	}
+	if cached {
+		return searchDataBlock(block, r.ft.format, key)
+	}
+	dataBlock, shared, err := readDataBlock(r.f, r.ft.format, entry)
+	if err != nil {
+		return nil, err
+	}
+	if shared && cache != nil {
+		// Block cache sống lâu hơn reader (vùng mmap bị gỡ khi reader đóng)
+		dataBlock = append([]byte(nil), dataBlock...)
+	}
+	cache.add(r.path, entry.offset, dataBlock)
+	return searchDataBlock(dataBlock, r.ft.format, key)
+}
 
-	calculatedCrc := crc32.Checksum(dataBlock, crcTable)
-	if storedCrc != calculatedCrc {
-		return nil, false, ErrCorruption // Lỗi! Block SSTable bị hỏng.
+// memSize ước lượng bộ nhớ của Index Block (tầng trên) và bloom filter đã nạp
+func (r *SSTReader) memSize() int64 {
+	size := int64(len(r.bloom.bits))
+	for _, e := range r.index {
+		size += int64(len(e.lastKey)) + 32 // string header + offset + length
 	}
-	// --- KẾT THÚC LOGIC MỚI ---
+	return size
+}
 
-	// Sử dụng hàm đã sửa lỗi
-	return searchDataBlock(dataBlock, key)
+func (r *SSTReader) Close() error {
+	return r.f.Close()
+}
 
-	// --- TOÀN BỘ LOGIC QUÉT TUẦN TỰ GỐC ĐÃ BỊ XÓA ---
+// ReadSSTFind searches for a key in an SSTable file
+// (mở và parse tệp cho mỗi lần gọi, đọc bằng pread vì mmap rồi gỡ ngay tốn
+// hơn vài lần ReadAt; engine dùng tableCache, có mmap theo Options.MmapReads)
+func ReadSSTFind(path string, key string) ([]byte, bool, error) {
+	r, err := OpenSSTReader(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer r.Close()
+	return r.Find(key)
 }
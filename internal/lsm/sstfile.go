@@ -0,0 +1,72 @@
+package lsm
+
+import (
+	"io"
+	"os"
+)
+
+// sstFile là một tệp SSTable mở để đọc, bằng pread (ReadAt của os.File)
+// hoặc bằng mmap (Options.MmapReads): khi đó đọc block không cần syscall
+// và block không nén được trả về dạng slice trỏ thẳng vào vùng ánh xạ.
+type sstFile struct {
+	f    *os.File
+	data []byte // Vùng mmap; nil = pread
+	size int64
+}
+
+// openSSTFile mở tệp; useMmap mà không ánh xạ được (tệp rỗng, nền tảng
+// không hỗ trợ) thì quay về pread
+func openSSTFile(path string, useMmap bool) (*sstFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &sstFile{f: f, size: stat.Size()}
+	if useMmap && MmapSupported && s.size > 0 {
+		if data, err := mmapFile(f, s.size); err == nil {
+			s.data = data
+		}
+	}
+	return s, nil
+}
+
+func (s *sstFile) ReadAt(p []byte, off int64) (int, error) {
+	if s.data == nil {
+		return s.f.ReadAt(p, off)
+	}
+	if off < 0 || off > int64(len(s.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// mapped trả về n byte tại off trong vùng mmap, không sao chép
+// (false nếu tệp đọc bằng pread hoặc đoạn nằm ngoài tệp)
+func (s *sstFile) mapped(off, n int64) ([]byte, bool) {
+	if s.data == nil || off < 0 || n < 0 || off > int64(len(s.data))-n {
+		return nil, false
+	}
+	return s.data[off : off+n : off+n], true
+}
+
+func (s *sstFile) mappedBytes() int64 {
+	return int64(len(s.data))
+}
+
+// Close gỡ ánh xạ: mọi slice lấy từ mapped không còn dùng được sau đó
+func (s *sstFile) Close() error {
+	if s.data != nil {
+		munmapFile(s.data)
+		s.data = nil
+	}
+	return s.f.Close()
+}
@@ -0,0 +1,88 @@
+package lsm
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const statsFileName = "STATS"
+
+// DefaultStatsPersistInterval là chu kỳ mặc định ghi tệp STATS
+const DefaultStatsPersistInterval = time.Minute
+
+// lifetimeStats là các bộ đếm cộng dồn qua mọi lần mở CSDL (tệp STATS),
+// khác với metrics thường vốn về 0 sau mỗi lần khởi động lại
+type lifetimeStats struct {
+	Since           time.Time `json:"since"` // Lần đầu tạo tệp STATS
+	Opens           int64     `json:"opens"`
+	Puts            int64     `json:"puts"`
+	Gets            int64     `json:"gets"`
+	Deletes         int64     `json:"deletes"`
+	Flushes         int64     `json:"flushes"`
+	FlushBytes      int64     `json:"flushBytes"`
+	Compactions     int64     `json:"compactions"`
+	CompactionBytes int64     `json:"compactionBytes"`
+}
+
+// loadStats đọc tệp STATS và tính thêm lần mở này.
+// Tệp hỏng không chặn việc mở CSDL: bộ đếm được tính lại từ đầu.
+func loadStats(dir string) lifetimeStats {
+	s := lifetimeStats{Since: time.Now().UTC()}
+	raw, err := os.ReadFile(filepath.Join(dir, statsFileName))
+	if err == nil {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			slog.Warn("Invalid STATS file, lifetime counters reset", "error", err)
+			s = lifetimeStats{Since: time.Now().UTC()}
+		}
+	} else if !os.IsNotExist(err) {
+		slog.Warn("Cannot read STATS file, lifetime counters reset", "error", err)
+	}
+	s.Opens++
+	return s
+}
+
+// lifetime trả về bộ đếm đã lưu cộng với bộ đếm của lần mở hiện tại
+func (e *LSMEngine) lifetime() lifetimeStats {
+	s := e.statsBase
+	s.Puts += e.metrics.puts.Load()
+	s.Gets += e.metrics.gets.Load()
+	s.Deletes += e.metrics.deletes.Load()
+	s.Flushes += e.metrics.flushes.Load()
+	s.FlushBytes += e.metrics.flushBytes.Load()
+	s.Compactions += e.metrics.compacts.Load()
+	s.CompactionBytes += e.metrics.compactBytes.Load()
+	return s
+}
+
+// persistStats ghi đè tệp STATS (atomic rename như CATALOG)
+func (e *LSMEngine) persistStats() error {
+	e.statsMu.Lock()
+	defer e.statsMu.Unlock()
+
+	raw, err := json.MarshalIndent(e.lifetime(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := filepath.Join(e.dir, statsFileName+".tmp")
+	if err := os.WriteFile(tempPath, raw, 0o644); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return os.Rename(tempPath, filepath.Join(e.dir, statsFileName))
+}
+
+func (e *LSMEngine) exportLifetime(m map[string]int64) {
+	s := e.lifetime()
+	m["lifetime_since_unix"] = s.Since.Unix()
+	m["lifetime_opens"] = s.Opens
+	m["lifetime_puts"] = s.Puts
+	m["lifetime_gets"] = s.Gets
+	m["lifetime_deletes"] = s.Deletes
+	m["lifetime_flushes"] = s.Flushes
+	m["lifetime_flush_bytes"] = s.FlushBytes
+	m["lifetime_compacts"] = s.Compactions
+	m["lifetime_compaction_bytes"] = s.CompactionBytes
+}
@@ -0,0 +1,175 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// minSubcompactionBytes: mỗi sub-compaction nhận ít nhất chừng này byte đầu
+// vào; compaction nhỏ hơn chạy trên một goroutine
+const minSubcompactionBytes = 8 * 1024 * 1024
+
+// runSubcompactions nén inputs (sắp xếp mới -> cũ) xuống outputLevel và trả
+// về các tệp output theo thứ tự key. Khoảng key của inputs được chia thành
+// các khoảng rời nhau [lo, hi) (xem subcompactionBounds), mỗi khoảng do một
+// goroutine đọc bằng MergingIterator riêng và ghi ra compactionOutput riêng,
+// nên output của các khoảng không chồng lấn nhau. Lỗi ở một khoảng bỏ toàn
+// bộ output (MANIFEST chưa đổi).
+func (e *LSMEngine) runSubcompactions(inputs []*FileMetadata, outputLevel int, rts rangeTombstones) ([]*FileMetadata, error) {
+	bounds, err := e.subcompactionBounds(inputs)
+	if err != nil {
+		return nil, err
+	}
+	outs := make([]*compactionOutput, len(bounds)+1)
+	errs := make([]error, len(outs))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i := range outs {
+		lo, hi := "", ""
+		if i > 0 {
+			lo = bounds[i-1]
+		}
+		if i < len(bounds) {
+			hi = bounds[i]
+		}
+		outs[i] = e.newCompactionOutput(outputLevel, calculateTotalKeys(inputs))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if errs[i] = e.runSubcompaction(inputs, outputLevel, rts, lo, hi, outs[i], &failed); errs[i] != nil {
+				failed.Store(true)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if len(outs) > 1 {
+		e.metrics.subcompactions.Add(int64(len(outs)))
+	}
+
+	err = errors.Join(errs...)
+	if err == nil && e.shutdownAborted() {
+		err = errCompactionAborted
+	}
+	if err != nil {
+		var paths []string
+		for _, out := range outs {
+			paths = append(paths, out.paths()...)
+			out.discard()
+		}
+		if errors.Is(err, errCompactionAborted) {
+			return nil, e.abortCompaction(nil, paths...)
+		}
+		return nil, err
+	}
+
+	var files []*FileMetadata
+	for _, out := range outs {
+		files = append(files, out.files...)
+	}
+	return files, nil
+}
+
+// runSubcompaction ghi các entry có key trong [lo, hi) ("" = không giới hạn)
+// vào out; dừng sớm khi một sub-compaction khác đã lỗi (failed)
+func (e *LSMEngine) runSubcompaction(inputs []*FileMetadata, outputLevel int, rts rangeTombstones, lo, hi string, out *compactionOutput, failed *atomic.Bool) error {
+	iters := make([]engine.Iterator, 0, len(inputs))
+	for _, meta := range inputs {
+		it, err := e.openSSTIterator(meta.Path)
+		if err != nil {
+			for _, it := range iters {
+				it.Close()
+			}
+			return fmt.Errorf("create compaction iterator: %w", err)
+		}
+		iters = append(iters, it)
+	}
+	mergedIter := e.newCompactionIterator(iters, outputLevel, rts)
+	defer mergedIter.Close()
+	if lo != "" {
+		mergedIter.Seek(lo)
+	}
+
+	keysWritten := 0
+	const throttleAfterKeys = 1000 // Nhường CPU sau mỗi 1000 key
+	for mergedIter.Next() {
+		if hi != "" && mergedIter.Key() >= hi {
+			break
+		}
+		// MergingIterator đã de-dup và bỏ các tombstone không còn cần
+		if err := out.add(mergedIter.Key(), mergedIter.Value()); err != nil {
+			return err
+		}
+		keysWritten++
+		if keysWritten%throttleAfterKeys == 0 {
+			if e.shutdownAborted() {
+				return errCompactionAborted
+			}
+			if failed.Load() {
+				return nil // runSubcompactions sẽ bỏ output
+			}
+			runtime.Gosched()
+		}
+	}
+	if err := mergedIter.Error(); err != nil {
+		return err
+	}
+	_, err := out.finish()
+	return err
+}
+
+// subcompactionBounds chia khoảng key của inputs thành tối đa
+// Options.MaxSubcompactions khoảng có dung lượng đầu vào gần bằng nhau, dựa
+// trên các data block trong Index Block của từng tệp (lastKey, độ dài).
+// Trả về các ranh giới tăng dần; nil = chạy một khoảng duy nhất.
+func (e *LSMEngine) subcompactionBounds(inputs []*FileMetadata) ([]string, error) {
+	var total int64
+	for _, meta := range inputs {
+		total += meta.FileSize
+	}
+	n := min(e.opts.MaxSubcompactions, runtime.GOMAXPROCS(0), int(total/minSubcompactionBytes))
+	if n <= 1 {
+		return nil, nil
+	}
+
+	var blocks []blockIndexEntry
+	var blockBytes int64
+	for _, meta := range inputs {
+		it, err := e.openSSTIterator(meta.Path)
+		if err != nil {
+			return nil, fmt.Errorf("read compaction input index: %w", err)
+		}
+		if sit, ok := it.(*sstIterator); ok {
+			for _, b := range sit.index {
+				blocks = append(blocks, b)
+				blockBytes += b.length
+			}
+		}
+		it.Close()
+	}
+	if len(blocks) < 2 {
+		return nil, nil
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].lastKey < blocks[j].lastKey })
+
+	// Cắt sau block mà dung lượng cộng dồn vượt k/n tổng; ranh giới là key
+	// ngay sau lastKey để block đó thuộc trọn khoảng trước
+	var bounds []string
+	var acc int64
+	for i, b := range blocks[:len(blocks)-1] {
+		acc += b.length
+		if acc*int64(n) < blockBytes*int64(len(bounds)+1) || b.lastKey == blocks[i+1].lastKey {
+			continue
+		}
+		bounds = append(bounds, b.lastKey+"\x00")
+		if len(bounds) == n-1 {
+			break
+		}
+	}
+	return bounds, nil
+}
@@ -0,0 +1,252 @@
+package lsm
+
+import (
+	"container/list"
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// DefaultMaxOpenFiles là số SSTable mặc định được giữ mở trong tableCache
+const DefaultMaxOpenFiles = 500
+
+// tableHandle là một SSTReader trong cache, đếm số Get và iterator đang dùng
+// để tệp chỉ bị đóng khi đã bị loại khỏi cache và không còn ai đọc
+type tableHandle struct {
+	r        *SSTReader
+	refs     int
+	evicted  bool
+	obsolete bool // Tệp đã bị xóa khỏi Version: unlink khi không còn ai đọc
+	el       *list.Element
+}
+
+// tableCache giữ tối đa capacity SSTReader đang mở (LRU), để các tệp
+// được đọc nhiều không phải mở và parse footer/Index Block/bloom lại mỗi lần.
+// Handle bị loại khi còn người đọc (iterator dài) nằm trong pinned tới
+// lần release cuối, nên số tệp mở có thể tạm vượt capacity.
+type tableCache struct {
+	mu       sync.Mutex
+	capacity int
+	mmap     bool       // Mở tệp bằng mmap (Options.MmapReads)
+	ll       *list.List // Đầu danh sách = dùng gần nhất
+	items    map[string]*tableHandle
+	pinned   map[string]*tableHandle // Đã loại khỏi cache, còn người đọc
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// newTableCache trả về nil khi capacity <= 0 (mỗi lần đọc tự mở tệp); mọi method chấp nhận nil
+func newTableCache(capacity int, mmap bool) *tableCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &tableCache{
+		capacity: capacity,
+		mmap:     mmap,
+		ll:       list.New(),
+		items:    make(map[string]*tableHandle),
+		pinned:   make(map[string]*tableHandle),
+	}
+}
+
+// acquire trả về reader của tệp (hit = đã mở sẵn trong cache);
+// caller phải gọi release khi đọc xong
+func (c *tableCache) acquire(path string) (h *tableHandle, hit bool, err error) {
+	if c == nil {
+		r, err := OpenSSTReader(path)
+		if err != nil {
+			return nil, false, err
+		}
+		return &tableHandle{r: r, refs: 1, evicted: true}, false, nil
+	}
+
+	c.mu.Lock()
+	if h := c.reuse(path); h != nil {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return h, true, nil
+	}
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	// Mở tệp ngoài khóa để các Get khác không phải chờ IO
+	r, err := openSSTReader(path, c.mmap)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h := c.reuse(path); h != nil {
+		// Get khác đã mở cùng tệp trong lúc này: dùng bản đã có
+		r.Close()
+		return h, false, nil
+	}
+	h = &tableHandle{r: r, refs: 1}
+	h.el = c.ll.PushFront(h)
+	c.items[path] = h
+	c.trim()
+	return h, false, nil
+}
+
+// reuse trả về handle đang mở của tệp (đưa handle pinned trở lại cache) để
+// mỗi tệp chỉ có một handle; nil nếu tệp chưa mở. Caller phải giữ c.mu.
+func (c *tableCache) reuse(path string) *tableHandle {
+	if h, ok := c.items[path]; ok {
+		h.refs++
+		c.ll.MoveToFront(h.el)
+		return h
+	}
+	h, ok := c.pinned[path]
+	if !ok {
+		return nil
+	}
+	delete(c.pinned, path)
+	h.refs++
+	h.evicted = false
+	h.el = c.ll.PushFront(h)
+	c.items[path] = h
+	c.trim()
+	return h
+}
+
+// trim loại các handle ít dùng nhất khi cache vượt capacity. Caller phải giữ c.mu.
+func (c *tableCache) trim() {
+	for len(c.items) > c.capacity {
+		c.evict(c.ll.Back().Value.(*tableHandle))
+	}
+}
+
+func (c *tableCache) release(h *tableHandle) {
+	if c == nil {
+		h.r.Close()
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h.refs--
+	if h.evicted && h.refs == 0 {
+		delete(c.pinned, h.r.path)
+		c.closeHandle(h)
+	}
+}
+
+// evict loại handle khỏi cache; tệp được đóng ngay nếu không còn ai đọc.
+// Caller phải giữ c.mu.
+func (c *tableCache) evict(h *tableHandle) {
+	c.ll.Remove(h.el)
+	delete(c.items, h.r.path)
+	h.evicted = true
+	if h.refs == 0 {
+		c.closeHandle(h)
+	} else {
+		c.pinned[h.r.path] = h
+	}
+}
+
+// closeHandle đóng reader và unlink tệp nếu tệp đã bị xóa khỏi Version
+func (c *tableCache) closeHandle(h *tableHandle) {
+	h.r.Close()
+	if h.obsolete {
+		if err := os.Remove(h.r.path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to delete obsolete SSTable", "component", "lsm", "path", h.r.path, "error", err)
+		}
+	}
+}
+
+// removeFile xóa tệp đã bị compaction bỏ khỏi Version. Nếu Get hoặc
+// iterator còn đọc tệp qua cache, việc unlink chờ tới lần release cuối.
+func (c *tableCache) removeFile(path string) error {
+	if c == nil {
+		return os.Remove(path)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, ok := c.items[path]; ok {
+		h.obsolete = true
+		c.evict(h)
+		return nil
+	}
+	if h, ok := c.pinned[path]; ok {
+		h.obsolete = true
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// close đóng mọi reader (khi đóng CSDL)
+func (c *tableCache) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, h := range c.items {
+		c.evict(h)
+	}
+}
+
+func (c *tableCache) export(m map[string]int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	open := int64(len(c.items))
+	pinned := int64(len(c.pinned))
+	var pendingDeletes int64
+	for _, h := range c.pinned {
+		if h.obsolete {
+			pendingDeletes++
+		}
+	}
+	var memBytes, mappedBytes int64
+	for _, h := range c.items {
+		memBytes += h.r.memSize()
+		mappedBytes += h.r.f.mappedBytes()
+	}
+	c.mu.Unlock()
+	m["table_cache_open_files"] = open
+	m["table_cache_pinned_files"] = pinned            // Đã loại khỏi cache, iterator còn đọc
+	m["table_cache_pending_deletes"] = pendingDeletes // Tệp đã bị compaction bỏ, chờ iterator đóng
+	m["table_cache_meta_bytes"] = memBytes
+	m["table_cache_mapped_bytes"] = mappedBytes // Vùng mmap (page cache của OS, không phải heap)
+	m["table_cache_capacity"] = int64(c.capacity)
+	m["table_cache_hits"] = c.hits.Load()
+	m["table_cache_misses"] = c.misses.Load()
+}
+
+// openSSTIterator mở iterator của tệp theo Options.MmapReads. Có tableCache
+// thì iterator dùng chung reader (và file descriptor) của cache và giữ một
+// tham chiếu tới khi Close, nên tệp không bị unlink khi iterator còn đọc.
+func (e *LSMEngine) openSSTIterator(path string) (engine.Iterator, error) {
+	if e.tables == nil {
+		it, err := newSSTableIterator(path, e.opts.MmapReads)
+		if err != nil {
+			return nil, err
+		}
+		sit := it.(*sstIterator)
+		sit.readAhead = e.newReadAhead(sit.f, sit.format, sit.index)
+		return sit, nil
+	}
+	h, _, err := e.tables.acquire(path)
+	if err != nil {
+		return nil, err
+	}
+	index, err := h.r.dataIndex()
+	if err != nil {
+		e.tables.release(h)
+		return nil, err
+	}
+	return &sstIterator{
+		f:         h.r.f,
+		format:    h.r.ft.format,
+		index:     index,
+		blockIdx:  -1,
+		release:   func() { e.tables.release(h) },
+		readAhead: e.newReadAhead(h.r.f, h.r.ft.format, index),
+	}, nil
+}
@@ -0,0 +1,74 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+var tagsFieldMarker = []byte(`"` + engine.TagsField + `"`)
+
+// ensureTagIndexes kiểm tra field _tags của các document trong batch
+// và tự tạo index _tags cho collection ở lần đầu tiên gặp document có nhãn.
+func (e *LSMEngine) ensureTagIndexes(b *lsmBatch) error {
+	var pending map[string]struct{}
+	for _, entry := range b.entries {
+		if entry.Tombstone || !bytes.Contains(entry.Value, tagsFieldMarker) {
+			continue // Lọc nhanh: phần lớn document không có nhãn
+		}
+		k := string(entry.Key)
+		if engine.IsSystemKey(k) {
+			continue
+		}
+		col, _, ok := splitDocKey(k)
+		if !ok {
+			continue
+		}
+
+		var doc map[string]interface{}
+		if err := json.Unmarshal(entry.Value, &doc); err != nil {
+			continue
+		}
+		tags, has := doc[engine.TagsField]
+		if !has {
+			continue
+		}
+		if err := validateTags(tags); err != nil {
+			return fmt.Errorf("%w: %s: %v", engine.ErrInvalidDocument, k, err)
+		}
+
+		e.catalogMu.RLock()
+		exists := e.catalog.findIndex(col, engine.TagsField) != nil
+		e.catalogMu.RUnlock()
+		if !exists {
+			if pending == nil {
+				pending = make(map[string]struct{})
+			}
+			pending[col] = struct{}{}
+		}
+	}
+
+	for col := range pending {
+		if err := e.CreateIndex(col, engine.TagsField, engine.IndexOptions{}); err != nil {
+			return fmt.Errorf("create tag index: %w", err)
+		}
+	}
+	return nil
+}
+
+// validateTags: _tags phải là mảng các chuỗi không rỗng
+func validateTags(v interface{}) error {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return fmt.Errorf("%s must be an array of strings", engine.TagsField)
+	}
+	for i, t := range arr {
+		s, ok := t.(string)
+		if !ok || s == "" {
+			return fmt.Errorf("%s[%d] must be a non-empty string", engine.TagsField, i)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package lsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+	"github.com/nconghau/MiniDBGo/internal/query"
+)
+
+// Định dạng key của một posting (text index):
+//
+//	__txt:<collection>:<term>\x00<_id>   value = số lần term xuất hiện (tf)
+//
+// Mọi posting của một term nằm liền nhau nên tra một term là một lần quét khoảng.
+const textKeyPrefix = engine.SystemKeyPrefix + "txt:"
+
+func textPrefix(collection string) string {
+	return textKeyPrefix + collection + ":"
+}
+
+// textKeysForDoc sinh các posting (key -> tf) của một document
+func textKeysForDoc(def *TextIndexDef, id string, raw []byte) map[string]string {
+	out := make(map[string]string)
+	if def == nil || raw == nil {
+		return out
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return out
+	}
+	prefix := textPrefix(def.Collection)
+	for term, tf := range query.TextTerms(doc, def.Fields) {
+		out[prefix+term+"\x00"+id] = strconv.Itoa(tf)
+	}
+	return out
+}
+
+// withTextEntries thêm vào out các thay đổi posting khi document đổi từ oldDoc sang newDoc;
+// refresh: ghi lại cả các posting không đổi (thời hạn của document đã đổi)
+func withTextEntries(out *lsmBatch, def *TextIndexDef, id string, oldDoc, newDoc []byte, refresh bool) {
+	oldKeys := textKeysForDoc(def, id, oldDoc)
+	newKeys := textKeysForDoc(def, id, newDoc)
+	for tk := range oldKeys {
+		if _, keep := newKeys[tk]; !keep {
+			out.Delete([]byte(tk))
+		}
+	}
+	for tk, tf := range newKeys {
+		if refresh || oldKeys[tk] != tf {
+			out.Put([]byte(tk), []byte(tf))
+		}
+	}
+}
+
+// CreateTextIndex tạo text index trên các field của collection
+// (mỗi collection tối đa một text index) và xây dựng posting cho document hiện có.
+func (e *LSMEngine) CreateTextIndex(collection string, fields []string) error {
+	if collection == "" || len(fields) == 0 {
+		return errors.New("collection and fields are required")
+	}
+	if strings.Contains(collection, ":") {
+		return fmt.Errorf("invalid collection name %q", collection)
+	}
+	fields = append([]string(nil), fields...)
+	sort.Strings(fields)
+
+	e.catalogMu.Lock()
+	if existing := e.catalog.findTextIndex(collection); existing != nil {
+		e.catalogMu.Unlock()
+		if strings.Join(existing.Fields, ",") != strings.Join(fields, ",") {
+			return fmt.Errorf("%w: %s has a text index on %s", engine.ErrIndexConflict,
+				collection, strings.Join(existing.Fields, ", "))
+		}
+		return nil
+	}
+	def := &TextIndexDef{Collection: collection, Fields: fields}
+	e.catalog.TextIndexes = append(e.catalog.TextIndexes, def)
+	if err := e.saveCatalog(); err != nil {
+		e.catalog.TextIndexes = e.catalog.TextIndexes[:len(e.catalog.TextIndexes)-1]
+		e.catalogMu.Unlock()
+		return fmt.Errorf("save catalog: %w", err)
+	}
+	e.catalogMu.Unlock()
+
+	start := time.Now()
+	count, err := e.backfillTextIndex(def)
+	if err != nil {
+		return fmt.Errorf("backfill text index: %w", err)
+	}
+	slog.Info("Text index created", "collection", collection, "fields", fields,
+		"postings", count, "duration_ms", time.Since(start).Milliseconds())
+	return nil
+}
+
+// backfillTextIndex quét collection và ghi posting cho từng document
+func (e *LSMEngine) backfillTextIndex(def *TextIndexDef) (int, error) {
+	prefix := def.Collection + ":"
+	it, err := e.newRangeIterator(prefix, prefixEnd(prefix))
+	if err != nil {
+		return 0, err
+	}
+
+	// Iterator giữ RLock của MemTable, nên phải đóng nó trước khi ghi
+	postings := make(map[string]string)
+	expires := make(map[string]int64) // Posting của document có thời hạn (TTL)
+	for it.Next() {
+		_, id, _ := splitDocKey(it.Key())
+		item := it.Value()
+		for tk, tf := range textKeysForDoc(def, id, item.Value) {
+			postings[tk] = tf
+			if item.ExpiresAt != 0 {
+				expires[tk] = item.ExpiresAt
+			}
+		}
+	}
+	iterErr := it.Error()
+	it.Close()
+	if iterErr != nil {
+		return 0, iterErr
+	}
+
+	written := 0
+	b := NewBatch()
+	for tk, tf := range postings {
+		b.putExpiring([]byte(tk), []byte(tf), expires[tk])
+		if b.Size() >= indexBackfillChunk {
+			if err := e.applyBatchRetry(b); err != nil {
+				return written, err
+			}
+			written += b.Size()
+			b = NewBatch()
+		}
+	}
+	if err := e.applyBatchRetry(b); err != nil {
+		return written, err
+	}
+	return written + b.Size(), nil
+}
+
+// TextIndex trả về các field của text index trên collection
+func (e *LSMEngine) TextIndex(collection string) ([]string, bool) {
+	e.catalogMu.RLock()
+	defer e.catalogMu.RUnlock()
+
+	def := e.catalog.findTextIndex(collection)
+	if def == nil {
+		return nil, false
+	}
+	return append([]string(nil), def.Fields...), true
+}
+
+// TextSearch quét posting của từng term và cộng điểm cho mỗi document:
+// mỗi term đóng góp (1 + ln tf) / (1 + ln df), nên từ hiếm (df nhỏ)
+// và xuất hiện nhiều lần trong document (tf lớn) được ưu tiên.
+func (e *LSMEngine) TextSearch(collection string, terms []string) ([]engine.TextHit, error) {
+	if _, ok := e.TextIndex(collection); !ok {
+		return nil, fmt.Errorf("no text index on %s", collection)
+	}
+
+	scores := make(map[string]float64)
+	for _, term := range terms {
+		start := textPrefix(collection) + term + "\x00"
+		it, err := e.newRangeIterator(start, prefixEnd(start))
+		if err != nil {
+			return nil, err
+		}
+		tfs := make(map[string]int)
+		for it.Next() {
+			tf, _ := strconv.Atoi(string(it.Value().Value))
+			if tf < 1 {
+				tf = 1
+			}
+			tfs[it.Key()[len(start):]] = tf
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		idf := 1 / (1 + math.Log(float64(len(tfs))))
+		for id, tf := range tfs {
+			scores[id] += (1 + math.Log(float64(tf))) * idf
+		}
+	}
+
+	hits := make([]engine.TextHit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, engine.TextHit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits, nil
+}
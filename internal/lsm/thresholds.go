@@ -0,0 +1,52 @@
+package lsm
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// SetFlushThresholds đổi ngưỡng rotate MemTable khi đang chạy.
+// Ngưỡng mới được giữ chờ và áp dụng ở lần rotate kế tiếp (xem rotateMemTable),
+// nên không phải khởi động lại CSDL và replay WAL chỉ để chỉnh ngưỡng.
+func (e *LSMEngine) SetFlushThresholds(t engine.FlushThresholds) error {
+	if t.FlushSize < 1 || t.MaxMemBytes < 1 {
+		return errors.New("flush thresholds must be positive")
+	}
+	e.limitsMu.Lock()
+	e.pendingLimits = &t
+	e.limitsMu.Unlock()
+	slog.Info("Flush thresholds scheduled for next rotation", "component", "lsm",
+		"flush_size", t.FlushSize, "max_mem_bytes", t.MaxMemBytes)
+	return nil
+}
+
+// FlushThresholds trả về ngưỡng đang hiệu lực và ngưỡng chờ áp dụng
+func (e *LSMEngine) FlushThresholds() (engine.FlushThresholds, *engine.FlushThresholds) {
+	e.mu.RLock()
+	active := engine.FlushThresholds{FlushSize: e.flushSize, MaxMemBytes: e.maxMemBytes}
+	e.mu.RUnlock()
+
+	e.limitsMu.Lock()
+	defer e.limitsMu.Unlock()
+	if e.pendingLimits == nil {
+		return active, nil
+	}
+	pending := *e.pendingLimits
+	return active, &pending
+}
+
+// applyPendingLimits áp dụng ngưỡng chờ cho MemTable mới.
+// Caller phải giữ e.mu (rotateMemTable).
+func (e *LSMEngine) applyPendingLimits() {
+	e.limitsMu.Lock()
+	defer e.limitsMu.Unlock()
+	if e.pendingLimits == nil {
+		return
+	}
+	e.flushSize, e.maxMemBytes = e.pendingLimits.FlushSize, e.pendingLimits.MaxMemBytes
+	e.pendingLimits = nil
+	slog.Info("Flush thresholds applied", "component", "lsm",
+		"flush_size", e.flushSize, "max_mem_bytes", e.maxMemBytes)
+}
@@ -0,0 +1,103 @@
+package lsm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// readTrace gom các bước của một lần lookup cho GetTrace.
+// Mọi method chấp nhận nil để đường đọc thường không tốn thêm gì.
+type readTrace struct {
+	steps []engine.TraceStep
+}
+
+func traceStart(tr *readTrace) time.Time {
+	if tr == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+func (tr *readTrace) add(step engine.TraceStep, start time.Time) {
+	if tr == nil {
+		return
+	}
+	step.DurationUs = time.Since(start).Microseconds()
+	tr.steps = append(tr.steps, step)
+}
+
+// stepPtr trả về step để findInSST điền chi tiết, hoặc nil khi không trace
+func (tr *readTrace) stepPtr(step *engine.TraceStep) *engine.TraceStep {
+	if tr == nil {
+		return nil
+	}
+	return step
+}
+
+func memOutcome(tombstone bool) string {
+	if tombstone {
+		return "tombstone"
+	}
+	return "found"
+}
+
+func sstStep(level int, path, outcome string) engine.TraceStep {
+	step := engine.TraceStep{Source: "sst", Level: &level, Outcome: outcome}
+	if path != "" {
+		step.File = filepath.Base(path)
+	}
+	return step
+}
+
+// finishSSTStep điền Outcome theo kết quả của findInSST
+func finishSSTStep(step engine.TraceStep, tombstone bool, err error) engine.TraceStep {
+	switch {
+	case err == nil:
+		step.Outcome = memOutcome(tombstone)
+	case err == os.ErrNotExist && step.Bloom == "negative":
+		step.Outcome = "bloom_negative"
+	case err == os.ErrNotExist:
+		step.Outcome = "miss"
+	default:
+		step.Outcome, step.Error = "error", err.Error()
+	}
+	return step
+}
+
+// GetTrace giống GetContext nhưng trả về thêm đường đi của lần đọc
+func (e *LSMEngine) GetTrace(ctx context.Context, key []byte) ([]byte, *engine.ReadTrace, error) {
+	if err := e.sched.checkDeadline(ctx); err != nil {
+		return nil, nil, err
+	}
+	if engine.PriorityFrom(ctx) == engine.PriorityHigh {
+		defer e.sched.beginHighRead()()
+	}
+	e.metrics.gets.Add(1)
+
+	start := time.Now()
+	tr := &readTrace{}
+	v := e.readView()
+	defer e.releaseVersion(v.pin)
+	val, res, err := e.lookupIn(v, string(key), tr, false)
+	if e.opts.ReadStats && err == nil {
+		e.readStats.record(res)
+	}
+	out := &engine.ReadTrace{DurationUs: time.Since(start).Microseconds(), Steps: tr.steps}
+	switch {
+	case err != nil:
+		out.Result = "error"
+		return nil, out, err
+	case res.source == sourceNone:
+		out.Result = "not_found"
+		return nil, out, engine.ErrKeyNotFound
+	case res.tombstone:
+		out.Result = "tombstone"
+		return nil, out, engine.ErrKeyNotFound
+	}
+	out.Result = "found"
+	return val, out, nil
+}
@@ -0,0 +1,104 @@
+package lsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// TTL của document (engine.TTLField, engine.ExpiresAtField): thời điểm hết hạn
+// được tính lúc ghi và lưu cạnh entry (WAL, MemTable, SSTable) nên đọc không
+// phải phân tích lại document. Get và iterator coi phiên bản mới nhất đã hết
+// hạn là tombstone; compaction bỏ hẳn entry đó (hoặc thay bằng tombstone khi
+// level sâu hơn còn có thể chứa phiên bản cũ của key).
+var (
+	ttlFieldMarker       = []byte(`"` + engine.TTLField + `"`)
+	expiresAtFieldMarker = []byte(`"` + engine.ExpiresAtField + `"`)
+)
+
+// ttlStats đếm các document có thời hạn
+type ttlStats struct {
+	writes    atomic.Int64 // Lần ghi document có _ttl/_expiresAt
+	expired   atomic.Int64 // Lần tra key gặp phiên bản mới nhất đã hết hạn
+	compacted atomic.Int64 // Entry hết hạn compaction đã bỏ khỏi dữ liệu
+}
+
+func (s *ttlStats) export(m map[string]int64) {
+	m["ttl_writes"] = s.writes.Load()
+	m["ttl_expired_lookups"] = s.expired.Load()
+	m["ttl_expired_compacted"] = s.compacted.Load()
+}
+
+// expired: item có thời điểm hết hạn và thời điểm đó không sau now (Unix nano)
+func expired(item *engine.Item, now int64) bool {
+	return item.ExpiresAt != 0 && item.ExpiresAt <= now
+}
+
+// putExpiring là Put cho entry hết hạn cùng một document (entry index, posting)
+func (b *lsmBatch) putExpiring(key, value []byte, expiresAt int64) {
+	b.Put(key, value)
+	b.entries[len(b.entries)-1].ExpiresAt = expiresAt
+}
+
+// stampExpiry gán ExpiresAt cho các document trong batch có _ttl/_expiresAt.
+// Document được ghi nguyên vẹn: đọc lại vẫn thấy field như lúc ghi.
+func (e *LSMEngine) stampExpiry(b *lsmBatch) error {
+	now := time.Now()
+	for _, entry := range b.entries {
+		if entry.Tombstone || (!bytes.Contains(entry.Value, ttlFieldMarker) && !bytes.Contains(entry.Value, expiresAtFieldMarker)) {
+			continue // Lọc nhanh: phần lớn document không có thời hạn
+		}
+		k := string(entry.Key)
+		if engine.IsSystemKey(k) {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal(entry.Value, &doc); err != nil {
+			continue
+		}
+		at, err := docExpiry(doc, now)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", engine.ErrInvalidDocument, k, err)
+		}
+		entry.ExpiresAt = at
+		if at != 0 {
+			e.ttl.writes.Add(1)
+		}
+	}
+	return nil
+}
+
+// docExpiry trả về thời điểm hết hạn (Unix nano) của document, 0 nếu không
+// có; có cả hai field thì lấy thời điểm sớm hơn
+func docExpiry(doc map[string]interface{}, now time.Time) (int64, error) {
+	var at int64
+	if v, ok := doc[engine.TTLField]; ok {
+		secs, ok := v.(float64)
+		if !ok || secs <= 0 {
+			return 0, fmt.Errorf("%s must be a positive number of seconds", engine.TTLField)
+		}
+		at = now.Add(time.Duration(secs * float64(time.Second))).UnixNano()
+	}
+	if v, ok := doc[engine.ExpiresAtField]; ok {
+		var t time.Time
+		switch x := v.(type) {
+		case string:
+			var err error
+			if t, err = time.Parse(time.RFC3339Nano, x); err != nil {
+				return 0, fmt.Errorf("%s must be an RFC 3339 time or Unix milliseconds", engine.ExpiresAtField)
+			}
+		case float64:
+			t = time.UnixMilli(int64(x))
+		default:
+			return 0, fmt.Errorf("%s must be an RFC 3339 time or Unix milliseconds", engine.ExpiresAtField)
+		}
+		if n := t.UnixNano(); at == 0 || n < at {
+			at = max(n, 1) // 0 nghĩa là không hết hạn
+		}
+	}
+	return at, nil
+}
@@ -0,0 +1,75 @@
+package lsm
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Document có _ttl/_expiresAt biến mất khi hết hạn (kể cả sau khi mở lại
+// từ SSTable) và bị compaction bỏ hẳn; document không thời hạn giữ nguyên
+func TestTTLExpiresDocuments(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339Nano)
+	docs := map[string]string{
+		"users:ttl":     `{"name":"a","_ttl":0.2}`,
+		"users:expired": `{"name":"b","_expiresAt":"` + past + `"}`,
+		"users:keep":    `{"name":"c"}`,
+	}
+	for k, v := range docs {
+		if err := db.Put([]byte(k), []byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := db.Get([]byte("users:ttl")); err != nil || string(got) != docs["users:ttl"] {
+		t.Fatalf("get before expiry = %q, %v", got, err)
+	}
+	if _, err := db.Get([]byte("users:expired")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("get expired err = %v, want not found", err)
+	}
+	if err := db.Put([]byte("users:bad"), []byte(`{"_ttl":-1}`)); !errors.Is(err, engine.ErrInvalidDocument) {
+		t.Fatalf("put negative _ttl err = %v, want ErrInvalidDocument", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Thêm tệp L0 cho đủ L0CompactionTrigger
+	for i := 1; i < L0CompactionTrigger; i++ {
+		db, err := OpenLSM(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Put([]byte(fmt.Sprintf("fill:%d", i)), []byte("v"))
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	eng, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	check := func(name string) {
+		got, n := visibleKeys(t, eng, []string{"users:ttl", "users:expired", "users:keep"})
+		if len(got) != 1 || !got["users:keep"] || n != L0CompactionTrigger {
+			t.Fatalf("%s: visible = %v (scan %d), want only users:keep and fill keys", name, got, n)
+		}
+	}
+	check("after reopen")
+	if err := eng.(*LSMEngine).pickAndRunCompaction(); err != nil {
+		t.Fatal(err)
+	}
+	check("after compaction")
+	if n := eng.GetMetrics()["ttl_expired_compacted"]; n != 2 {
+		t.Fatalf("ttl_expired_compacted = %d, want 2", n)
+	}
+}
@@ -0,0 +1,175 @@
+package lsm
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+var _ engine.Txn = (*txn)(nil)
+
+// txn là engine.Txn: đọc qua snapshot, ghi dồn vào writes. Commit khóa mọi
+// key đã đọc/ghi (keyLocks, như ApplyBatch), kiểm tra không key nào có lần
+// ghi mới hơn snapshot rồi mới ghi cả batch, nên không lần ghi nào khác chen
+// được vào giữa kiểm tra và ghi.
+type txn struct {
+	e    *LSMEngine
+	snap *snapshot
+
+	mu     sync.Mutex
+	reads  map[string]bool        // key -> có tồn tại lúc đọc
+	writes map[string]*batchEntry // Lần ghi cuối của mỗi key
+	order  []string               // Thứ tự ghi lần đầu của các key
+	done   bool
+}
+
+// txnStats đếm kết quả của các transaction
+type txnStats struct {
+	commits   atomic.Int64
+	conflicts atomic.Int64
+	rollbacks atomic.Int64
+}
+
+func (s *txnStats) export(m map[string]int64) {
+	m["txn_commits"] = s.commits.Load()
+	m["txn_conflicts"] = s.conflicts.Load()
+	m["txn_rollbacks"] = s.rollbacks.Load()
+}
+
+// Begin mở transaction trên một snapshot mới
+func (e *LSMEngine) Begin() (engine.Txn, error) {
+	s, err := e.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &txn{
+		e:      e,
+		snap:   s.(*snapshot),
+		reads:  make(map[string]bool),
+		writes: make(map[string]*batchEntry),
+	}, nil
+}
+
+func (t *txn) Seq() uint64 { return t.snap.seq }
+
+// Get đọc lần ghi của chính txn trước, sau đó tới snapshot
+func (t *txn) Get(key []byte) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil, engine.ErrTxnDone
+	}
+	k := string(key)
+	if w, ok := t.writes[k]; ok {
+		if w.Tombstone {
+			return nil, engine.ErrKeyNotFound
+		}
+		return w.Value, nil
+	}
+	val, err := t.snap.Get(key)
+	if err != nil && !errors.Is(err, engine.ErrKeyNotFound) {
+		return nil, err
+	}
+	t.reads[k] = err == nil
+	return val, err
+}
+
+func (t *txn) Put(key, value []byte) {
+	t.write(&batchEntry{Key: key, Value: value})
+}
+
+func (t *txn) Delete(key []byte) {
+	t.write(&batchEntry{Key: key, Tombstone: true})
+}
+
+func (t *txn) write(entry *batchEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	k := string(entry.Key)
+	if _, ok := t.writes[k]; !ok {
+		t.order = append(t.order, k)
+	}
+	t.writes[k] = entry
+}
+
+// Commit ghi các lần ghi của txn thành một batch, hoặc trả về
+// engine.ErrTxnConflict (không ghi gì) nếu key nào đã bị thay đổi sau snapshot
+func (t *txn) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return engine.ErrTxnDone
+	}
+	t.done = true
+	defer t.snap.Close()
+
+	keys := make([][]byte, 0, len(t.reads)+len(t.order))
+	for k := range t.reads {
+		keys = append(keys, []byte(k))
+	}
+	for _, k := range t.order {
+		if _, read := t.reads[k]; !read {
+			keys = append(keys, []byte(k))
+		}
+	}
+	unlock := t.e.keyLocks.lockKeys(keys)
+	defer unlock()
+
+	conflict, err := t.conflicts(keys)
+	if err != nil {
+		return err
+	}
+	if conflict {
+		t.e.txns.conflicts.Add(1)
+		return engine.ErrTxnConflict
+	}
+	if len(t.order) > 0 {
+		b := NewBatch()
+		for _, k := range t.order {
+			b.entries = append(b.entries, t.writes[k])
+		}
+		if err := t.e.writeBatch(b); err != nil {
+			return err
+		}
+	}
+	t.e.txns.commits.Add(1)
+	return nil
+}
+
+// conflicts: có key nào mang seqno mới hơn snapshot, hoặc (với key đã đọc)
+// tồn tại/không tồn tại khác lúc đọc - trường hợp lần ghi mới đã bị
+// compaction bỏ cùng tombstone. Caller giữ khóa của keys.
+func (t *txn) conflicts(keys [][]byte) (bool, error) {
+	v := t.e.readView()
+	defer t.e.releaseVersion(v.pin)
+	for _, key := range keys {
+		_, res, err := t.e.lookupIn(v, string(key), nil, true)
+		if err != nil {
+			return false, err
+		}
+		if res.seq > t.snap.seq {
+			return true, nil
+		}
+		exists := res.source != sourceNone && !res.tombstone
+		if seen, read := t.reads[string(key)]; read && seen != exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (t *txn) Rollback() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return
+	}
+	t.done = true
+	t.e.txns.rollbacks.Add(1)
+	t.snap.Close()
+}
@@ -0,0 +1,108 @@
+package lsm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Txn thấy lần ghi của chính nó, người khác chỉ thấy sau Commit; lần ghi
+// ngoài txn sau Begin không lọt vào snapshot của txn
+func TestTxnVisibility(t *testing.T) {
+	db, err := OpenLSM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("k:a"), []byte("a1"))
+
+	reader, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put([]byte("k:b"), []byte("b1")) // Sau snapshot của reader
+	if _, err := reader.Get([]byte("k:b")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("txn get k:b err = %v, want not found", err)
+	}
+	reader.Rollback()
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Put([]byte("k:c"), []byte("c1"))
+	txn.Delete([]byte("k:a"))
+	if got, err := txn.Get([]byte("k:c")); err != nil || string(got) != "c1" {
+		t.Fatalf("txn get own write = %q, %v", got, err)
+	}
+	if _, err := txn.Get([]byte("k:a")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("txn get own delete err = %v, want not found", err)
+	}
+	if _, err := db.Get([]byte("k:c")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("uncommitted write visible: %v", err)
+	}
+
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get([]byte("k:c")); err != nil || string(got) != "c1" {
+		t.Fatalf("get after commit = %q, %v", got, err)
+	}
+	if _, err := db.Get([]byte("k:a")); !errors.Is(err, engine.ErrKeyNotFound) {
+		t.Fatalf("committed delete err = %v, want not found", err)
+	}
+	if err := txn.Commit(); !errors.Is(err, engine.ErrTxnDone) {
+		t.Fatalf("second commit err = %v, want ErrTxnDone", err)
+	}
+}
+
+// Key txn đã đọc hoặc ghi bị ghi bởi người khác sau Begin: Commit trả về
+// ErrTxnConflict và không ghi gì; Rollback bỏ các lần ghi
+func TestTxnConflict(t *testing.T) {
+	db, err := OpenLSM(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.Put([]byte("acct:1"), []byte("100"))
+	db.Put([]byte("acct:2"), []byte("0"))
+
+	for _, tc := range []struct {
+		name  string
+		touch func(txn engine.Txn)
+	}{
+		{"read", func(txn engine.Txn) { txn.Get([]byte("acct:1")) }},
+		{"write", func(txn engine.Txn) { txn.Put([]byte("acct:1"), []byte("x")) }},
+	} {
+		txn, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc.touch(txn)
+		txn.Put([]byte("acct:2"), []byte(tc.name))
+		db.Put([]byte("acct:1"), []byte("outside-"+tc.name))
+		if err := txn.Commit(); !errors.Is(err, engine.ErrTxnConflict) {
+			t.Fatalf("%s: commit err = %v, want ErrTxnConflict", tc.name, err)
+		}
+		if got, _ := db.Get([]byte("acct:2")); string(got) != "0" {
+			t.Fatalf("%s: conflicting txn wrote acct:2 = %q", tc.name, got)
+		}
+		if got, _ := db.Get([]byte("acct:1")); string(got) != "outside-"+tc.name {
+			t.Fatalf("%s: acct:1 = %q", tc.name, got)
+		}
+	}
+
+	txn, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn.Put([]byte("acct:2"), []byte("rolled back"))
+	txn.Rollback()
+	if err := txn.Commit(); !errors.Is(err, engine.ErrTxnDone) {
+		t.Fatalf("commit after rollback err = %v, want ErrTxnDone", err)
+	}
+	if got, _ := db.Get([]byte("acct:2")); string(got) != "0" {
+		t.Fatalf("rolled back write visible: %q", got)
+	}
+}
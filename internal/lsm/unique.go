@@ -0,0 +1,148 @@
+package lsm
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// uniqueChange là trạng thái cuối cùng của một entry thuộc unique index trong batch
+type uniqueChange struct {
+	def   *IndexDef
+	id    string
+	added bool // false = entry bị xóa trong batch
+}
+
+// uniqueChanges gom thay đổi trên unique index của cả batch, để việc kiểm tra
+// dựa trên kết quả cuối (vd batch xóa document A rồi ghi document B cùng email)
+type uniqueChanges map[string]uniqueChange
+
+func (u uniqueChanges) record(defs []*IndexDef, id string, oldKeys, newKeys map[string]struct{}) {
+	for _, def := range defs {
+		if !def.Unique {
+			continue
+		}
+		prefix := indexPrefix(def.Collection, def.Field)
+		for ik := range oldKeys {
+			if _, keep := newKeys[ik]; !keep && strings.HasPrefix(ik, prefix) {
+				u[ik] = uniqueChange{def: def, id: id}
+			}
+		}
+		for ik := range newKeys {
+			if _, exists := oldKeys[ik]; !exists && strings.HasPrefix(ik, prefix) {
+				u[ik] = uniqueChange{def: def, id: id, added: true}
+			}
+		}
+	}
+}
+
+// checkUnique trả về *engine.DuplicateKeyError nếu một giá trị mới của unique index
+// đã thuộc về document khác (trong chính batch hoặc trong dữ liệu đã lưu).
+// Caller phải giữ e.indexMu để không có lần ghi nào chen vào giữa kiểm tra và ghi.
+func (e *LSMEngine) checkUnique(u uniqueChanges) error {
+	claimed := make(map[string]string) // valuePrefix -> _id trong batch
+	for ik, c := range u {
+		if !c.added {
+			continue
+		}
+		valuePrefix := ik[:len(ik)-len(c.id)]
+		if other, ok := claimed[valuePrefix]; ok && other != c.id {
+			return duplicateKeyError(c.def, valuePrefix, c.id, other)
+		}
+		claimed[valuePrefix] = c.id
+
+		it, err := e.newRangeIterator(valuePrefix, prefixEnd(valuePrefix))
+		if err != nil {
+			return err
+		}
+		var existing string
+		for it.Next() {
+			k := it.Key()
+			other := k[len(valuePrefix):]
+			if other == c.id {
+				continue
+			}
+			if change, ok := u[k]; ok && !change.added {
+				continue // Document kia bỏ giá trị này trong cùng batch
+			}
+			existing = other
+			break
+		}
+		err = it.Error()
+		it.Close()
+		if err != nil {
+			return err
+		}
+		if existing != "" {
+			return duplicateKeyError(c.def, valuePrefix, c.id, existing)
+		}
+	}
+	return nil
+}
+
+// firstDuplicate tìm hai document có cùng giá trị trong danh sách entry
+// (dùng khi tạo unique index trên dữ liệu sẵn có)
+func firstDuplicate(def *IndexDef, keys []string) error {
+	owners := make(map[string]string)
+	for _, ik := range keys {
+		sep := strings.LastIndexByte(ik, 0)
+		if sep < 0 {
+			continue
+		}
+		valuePrefix, id := ik[:sep+1], ik[sep+1:]
+		if other, ok := owners[valuePrefix]; ok && other != id {
+			return duplicateKeyError(def, valuePrefix, id, other)
+		}
+		owners[valuePrefix] = id
+	}
+	return nil
+}
+
+func duplicateKeyError(def *IndexDef, valuePrefix, id, existing string) error {
+	enc := strings.TrimSuffix(valuePrefix[len(indexPrefix(def.Collection, def.Field)):], "\x00")
+	var value interface{}
+	if parts := strings.Split(enc, "\x00"); def.compound() {
+		values := make([]interface{}, len(parts))
+		for i, p := range parts {
+			values[i] = decodeIndexValue(p)
+		}
+		value = values
+	} else {
+		value = decodeIndexValue(enc)
+	}
+	return &engine.DuplicateKeyError{Collection: def.Collection, Index: def.Field,
+		Value: value, ID: id, ExistingID: existing}
+}
+
+// decodeIndexValue là phép ngược của encodeIndexValue/encodeCompoundValue
+// (chuỗi được trả về ở dạng đã qua collation)
+func decodeIndexValue(enc string) interface{} {
+	if enc == "" {
+		return nil
+	}
+	switch enc[0] {
+	case tagBool:
+		return enc[1:] == "1"
+	case tagString:
+		return enc[1:]
+	case tagNumber:
+		bits, err := strconv.ParseUint(enc[1:], 16, 64)
+		if err != nil {
+			return nil
+		}
+		if bits&(1<<63) != 0 {
+			bits ^= 1 << 63
+		} else {
+			bits = ^bits
+		}
+		return math.Float64frombits(bits)
+	case tagOther:
+		var v interface{}
+		_ = json.Unmarshal([]byte(enc[1:]), &v)
+		return v
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package lsm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// VerifyTables đọc lại mọi block của tệp định dạng hiện tại: tệp lành có
+// properties và không lỗi, byte hỏng trong data block bị báo ở đúng tệp
+func TestVerifyTablesReportsCorruptBlock(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		db.Put([]byte{'k', ':', byte('a' + i%26), byte('0' + i/26)}, []byte("value"))
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	verify := func() []string {
+		db, err := OpenLSM(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		checks, err := db.VerifyTables(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(checks) != 1 {
+			t.Fatalf("got %d table checks, want 1", len(checks))
+		}
+		var errs []string
+		for _, c := range checks {
+			if c.Version != SSTVersion || c.Properties == nil {
+				t.Fatalf("check = %+v, want version %d with properties", c, SSTVersion)
+			}
+			if c.Error != "" {
+				errs = append(errs, c.Error)
+			} else if c.Keys != 100 {
+				t.Fatalf("check counted %d keys, want 100", c.Keys)
+			}
+		}
+		return errs
+	}
+	if errs := verify(); len(errs) != 0 {
+		t.Fatalf("clean table reported %v", errs)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "sst", "*.sst"))
+	f, err := os.OpenFile(paths[0], os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, SSTHeaderSize+2); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if errs := verify(); len(errs) != 1 {
+		t.Fatalf("corrupt table reported %v, want one error", errs)
+	}
+}
@@ -2,9 +2,11 @@ package lsm
 
 import (
 	"encoding/json"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 )
 
 const manifestFileName = "MANIFEST"
@@ -18,6 +20,12 @@ type FileMetadata struct {
 	MaxKey   string `json:"maxKey"`
 	FileSize int64  `json:"fileSize"`
 	KeyCount uint32 `json:"keyCount"`
+	// Tombstones: số tombstone trong tệp (property tombstones); tệp ghi trước
+	// khi MANIFEST có field này được điền khi mở CSDL (checkSSTFormats)
+	Tombstones uint32 `json:"tombstones,omitempty"`
+
+	// ValueLogRefs: số byte record value log mà tệp trỏ tới, theo id tệp vlog
+	ValueLogRefs map[uint32]int64 `json:"valueLogRefs,omitempty"`
 }
 
 // Version đại diện cho một snapshot (ảnh chụp)
@@ -27,6 +35,17 @@ type Version struct {
 	// L0: Có thể chồng lấn, sắp xếp theo tệp mới nhất
 	// L1+: Không chồng lấn, sắp xếp theo MinKey
 	Levels map[int][]*FileMetadata `json:"levels"`
+
+	// FlushedWAL là segment WAL mới nhất mà dữ liệu đã nằm trong SSTable;
+	// segment này và các segment cũ hơn không được replay lại
+	FlushedWAL string `json:"flushedWal,omitempty"`
+
+	// LastSeq là seqno lớn nhất đã nằm trong SSTable; khi mở CSDL, seqno
+	// tiếp tục từ giá trị này (và từ các bản ghi WAL được replay)
+	LastSeq uint64 `json:"lastSeq,omitempty"`
+
+	// RangeTombstones là các DeleteRange chưa được dọn hết (xem range_delete.go)
+	RangeTombstones rangeTombstones `json:"rangeTombstones,omitempty"`
 }
 
 // NewVersion tạo một Version rỗng
@@ -36,10 +55,12 @@ func NewVersion() *Version {
 	}
 }
 
-// AddFile thêm một tệp vào Version
+// AddFile thêm một tệp vào Version. Slice của level luôn được chép lại
+// (không sửa tại chỗ) để các ảnh chụp Levels đang đọc không bị đổi thứ tự.
 func (v *Version) AddFile(meta *FileMetadata) {
 	level := meta.Level
-	v.Levels[level] = append(v.Levels[level], meta)
+	files := v.Levels[level]
+	v.Levels[level] = append(files[:len(files):len(files)], meta)
 
 	if level == 0 {
 		// L0 sắp xếp theo tệp mới nhất (thêm vào cuối)
@@ -51,6 +72,35 @@ func (v *Version) AddFile(meta *FileMetadata) {
 	}
 }
 
+// ReplaceFile thay old bằng meta ở đúng vị trí của old (giữ thứ tự mới/cũ
+// của L0); false nếu old không còn trong Version
+func (v *Version) ReplaceFile(old, meta *FileMetadata) bool {
+	for i, f := range v.Levels[old.Level] {
+		if f.Path == old.Path {
+			files := append([]*FileMetadata(nil), v.Levels[old.Level]...)
+			files[i] = meta
+			v.Levels[old.Level] = files
+			v.replacePending(old.Path, meta.Path)
+			return true
+		}
+	}
+	return false
+}
+
+// markWALFlushed ghi nhận segment mới nhất trong paths là đã flush
+func (v *Version) markWALFlushed(paths []string) {
+	for _, p := range paths {
+		if name := filepath.Base(p); v.FlushedWAL == "" || walBefore(v.FlushedWAL, name) {
+			v.FlushedWAL = name
+		}
+	}
+}
+
+// walFlushed: dữ liệu của segment p đã nằm trong SSTable
+func (v *Version) walFlushed(p string) bool {
+	return v.FlushedWAL != "" && !walBefore(v.FlushedWAL, p)
+}
+
 // DeleteFiles xóa các tệp khỏi Version
 func (v *Version) DeleteFiles(level int, filesToRemove []*FileMetadata) {
 	keep := make([]*FileMetadata, 0, len(v.Levels[level]))
@@ -67,6 +117,37 @@ func (v *Version) DeleteFiles(level int, filesToRemove []*FileMetadata) {
 	v.Levels[level] = keep
 }
 
+// removeOrphanTables xóa các SSTable không có trong Version: tệp mà
+// compaction đã bỏ nhưng chưa kịp unlink (còn iterator đọc) trước khi tiến
+// trình dừng, hoặc output của flush/compaction chưa vào MANIFEST.
+// Không xóa gì khi chưa có MANIFEST (mất MANIFEST thì các tệp vẫn cần giữ).
+func removeOrphanTables(dir, sstDir string, v *Version) {
+	if _, err := os.Stat(filepath.Join(dir, manifestFileName)); err != nil {
+		return
+	}
+	live := make(map[string]bool)
+	for _, files := range v.Levels {
+		for _, f := range files {
+			live[filepath.Base(f.Path)] = true
+		}
+	}
+	entries, err := os.ReadDir(sstDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "sst-") || filepath.Ext(name) != ".sst" || live[name] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(sstDir, name)); err != nil {
+			slog.Warn("Failed to delete orphan SSTable", "component", "lsm", "file", name, "error", err)
+			continue
+		}
+		slog.Info("Deleted orphan SSTable", "component", "lsm", "file", name)
+	}
+}
+
 // --- Quản lý Manifest ---
 
 // loadManifest đọc tệp MANIFEST và khôi phục Version
@@ -0,0 +1,227 @@
+package lsm
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// versionRefs đếm tham chiếu tới từng tệp SSTable (theo FileMetadata.Path).
+// Mỗi ảnh chụp Levels (versionPin) mà iterator, snapshot hay readView của Get
+// đang giữ cộng một tham chiếu cho mọi tệp trong nó; tệp bị compaction bỏ khỏi
+// Version khi còn tham chiếu chỉ bị xóa khi ảnh chụp cuối cùng chứa nó nhả ra.
+// Nhờ vậy một iterator luôn mở được đủ các tệp nó thấy lúc tạo, tệp đang mở
+// không bị os.Remove (vốn thất bại trên Windows), và một iterator sống lâu chỉ
+// giữ lại các tệp nó thấy chứ không giữ mọi tệp bị bỏ sau nó. Tệp còn chờ khi
+// đóng CSDL được removeOrphanTables dọn ở lần mở sau. Giá trị zero dùng được ngay.
+type versionRefs struct {
+	mu       sync.Mutex
+	cur      *versionPin              // Ảnh chụp của Levels hiện tại, dùng chung cho các lần đọc
+	files    map[string]int           // path -> số versionPin còn sống chứa tệp
+	metas    map[string]*FileMetadata // path -> metadata của tệp trong files (cho GC value log)
+	obsolete map[string]int64         // Tệp đã bỏ khỏi Version, chờ tham chiếu về 0 (-> dung lượng)
+	views    int                      // Số ảnh chụp đang được đọc
+
+	iterators atomic.Int64 // Iterator (engine và snapshot) chưa Close
+}
+
+// versionPin là một tập tệp (Levels lúc chụp). refs gồm các lần đọc đang giữ
+// nó, cộng 1 khi nó còn là vr.cur.
+type versionPin struct {
+	levels map[int][]*FileMetadata
+	refs   int
+}
+
+// acquire trả về ảnh chụp chứa levels (bản copy Levels của Version hiện tại)
+// sau khi tăng tham chiếu. Caller phải giữ e.mu (RLock) trong lúc chụp
+// Levels để thứ tự với thay đổi Version là đúng. Chỉ tạo pin mới (đếm lại
+// từng tệp) khi Levels đã đổi; mọi thay đổi Version đều thay slice của level
+// (copy-on-write) nên so sánh slice là đủ.
+func (vr *versionRefs) acquire(levels map[int][]*FileMetadata) *versionPin {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	if vr.cur == nil || !sameLevels(vr.cur.levels, levels) {
+		// Pin cũ không thể chứa tệp đã retire (retire bỏ vr.cur khi đó) nên
+		// unpin ở đây không làm tệp nào tới lượt xóa
+		vr.dropCurrent()
+		vr.cur = &versionPin{levels: levels, refs: 1}
+		vr.pin(vr.cur, 1)
+	}
+	vr.cur.refs++
+	vr.views++
+	return vr.cur
+}
+
+// release nhả tham chiếu và trả về các tệp đã có thể xóa
+func (vr *versionRefs) release(p *versionPin) []string {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	vr.views--
+	if p.refs--; p.refs > 0 {
+		return nil
+	}
+	return vr.pin(p, -1)
+}
+
+// retire ghi nhận path vừa bị bỏ khỏi Version (sau khi MANIFEST đã lưu);
+// true nếu tệp phải chờ các ảnh chụp đang chứa nó nhả ra.
+func (vr *versionRefs) retire(path string) bool {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	if vr.cur != nil && pinHolds(vr.cur, path) {
+		vr.dropCurrent() // Levels đã đổi: lần đọc sau sẽ chụp lại
+	}
+	if vr.files[path] == 0 {
+		return false
+	}
+	if vr.obsolete == nil {
+		vr.obsolete = make(map[string]int64)
+	}
+	var size int64
+	if st, err := os.Stat(path); err == nil {
+		size = st.Size()
+	}
+	vr.obsolete[path] = size
+	return true
+}
+
+// dropCurrent bỏ tham chiếu "hiện tại" của vr.cur. Caller phải giữ vr.mu.
+func (vr *versionRefs) dropCurrent() {
+	if vr.cur == nil {
+		return
+	}
+	if vr.cur.refs--; vr.cur.refs == 0 {
+		vr.pin(vr.cur, -1)
+	}
+	vr.cur = nil
+}
+
+// pin cộng delta vào tham chiếu của mọi tệp trong p và trả về các tệp đã
+// retire vừa hết tham chiếu. Caller phải giữ vr.mu.
+func (vr *versionRefs) pin(p *versionPin, delta int) []string {
+	if vr.files == nil {
+		vr.files = make(map[string]int)
+		vr.metas = make(map[string]*FileMetadata)
+	}
+	var paths []string
+	for _, files := range p.levels {
+		for _, f := range files {
+			n := vr.files[f.Path] + delta
+			if n > 0 {
+				vr.files[f.Path] = n
+				vr.metas[f.Path] = f
+				continue
+			}
+			delete(vr.files, f.Path)
+			delete(vr.metas, f.Path)
+			if _, ok := vr.obsolete[f.Path]; ok {
+				delete(vr.obsolete, f.Path)
+				paths = append(paths, f.Path)
+			}
+		}
+	}
+	return paths
+}
+
+// pinnedTables thêm vào tables (path -> metadata) mọi tệp nằm trong một ảnh
+// chụp còn sống: Get, iterator hay snapshot đang đọc chúng
+func (vr *versionRefs) pinnedTables(tables map[string]*FileMetadata) {
+	vr.mu.Lock()
+	defer vr.mu.Unlock()
+	for path, meta := range vr.metas {
+		tables[path] = meta
+	}
+}
+
+// pinHolds: p chứa tệp path
+func pinHolds(p *versionPin, path string) bool {
+	for _, files := range p.levels {
+		for _, f := range files {
+			if f.Path == path {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameLevels: a và b là cùng các slice tệp ở mọi level
+func sameLevels(a, b map[int][]*FileMetadata) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for level, fa := range a {
+		fb, ok := b[level]
+		if !ok || len(fa) != len(fb) || (len(fa) > 0 && &fa[0] != &fb[0]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (vr *versionRefs) export(m map[string]int64) {
+	vr.mu.Lock()
+	views, pinned, pending := int64(vr.views), int64(len(vr.files)), int64(len(vr.obsolete))
+	var pendingBytes int64
+	for _, size := range vr.obsolete {
+		pendingBytes += size
+	}
+	vr.mu.Unlock()
+	m["version_refs"] = views                        // Iterator, snapshot và Get đang giữ ảnh chụp Version
+	m["version_pinned_files"] = pinned               // Tệp có trong ít nhất một ảnh chụp (kể cả Levels hiện tại)
+	m["version_pending_deletes"] = pending           // Tệp đã bị bỏ khỏi Version, chờ ảnh chụp nhả
+	m["version_pending_delete_bytes"] = pendingBytes // Dung lượng đĩa các tệp đó còn chiếm
+	m["open_iterators"] = vr.iterators.Load()        // Tăng mãi: có nơi quên Close iterator
+}
+
+// versionIterator giữ ảnh chụp Version của iterator tới khi Close
+type versionIterator struct {
+	engine.Iterator
+	release func()
+}
+
+func (it *versionIterator) Close() error {
+	err := it.Iterator.Close()
+	if it.release != nil {
+		it.release()
+		it.release = nil
+	}
+	return err
+}
+
+// newVersionIterator bọc it để gọi release khi Close và đếm iterator đang mở
+// (open_iterators: tăng mãi nghĩa là có nơi quên Close)
+func (e *LSMEngine) newVersionIterator(it engine.Iterator, release func()) engine.Iterator {
+	e.versions.iterators.Add(1)
+	return &versionIterator{Iterator: it, release: func() {
+		e.versions.iterators.Add(-1)
+		release()
+	}}
+}
+
+// releaseVersion nhả ảnh chụp và xóa các tệp không còn ai tham chiếu
+func (e *LSMEngine) releaseVersion(p *versionPin) {
+	for _, path := range e.versions.release(p) {
+		if err := e.deleteTableFile(path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to delete obsolete SSTable", "component", "lsm", "path", path, "error", err)
+		}
+	}
+}
+
+// removeTableFile xóa một tệp vừa bị bỏ khỏi Version (sau khi MANIFEST đã
+// lưu); tệp còn nằm trong ảnh chụp đang đọc chỉ bị xóa khi ảnh chụp nhả ra
+func (e *LSMEngine) removeTableFile(path string) error {
+	if e.versions.retire(path) {
+		return nil
+	}
+	return e.deleteTableFile(path)
+}
+
+// deleteTableFile xóa tệp cùng các block đã cache của nó
+func (e *LSMEngine) deleteTableFile(path string) error {
+	e.blockCache.dropFile(path)
+	return e.tables.removeFile(path)
+}
@@ -0,0 +1,94 @@
+package lsm
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Iterator (và snapshot) chỉ giữ các tệp nó thấy lúc tạo: tệp bị compaction
+// thay thế còn trên đĩa tới khi iterator cũ đóng, còn tệp flush sau khi
+// iterator được tạo (và iterator mở sau compaction) không giữ lại gì
+func TestIteratorPinsOnlyFilesItSaw(t *testing.T) {
+	dir := t.TempDir()
+	n := L0CompactionTrigger - 1 // Dưới ngưỡng: mở CSDL không kích hoạt compaction
+	for i := 0; i < n; i++ {
+		db, err := OpenLSM(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Put([]byte(fmt.Sprintf("k:%d", i)), []byte("v"))
+		if err := db.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	eng, err := OpenLSMWithConfig(dir, 1, 1<<20) // Mỗi Put làm đầy MemTable
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer eng.Close()
+	e := eng.(*LSMEngine)
+	seen, _ := filepath.Glob(filepath.Join(dir, "sst", "sst-L0-*.sst"))
+	if len(seen) != n {
+		t.Fatalf("got %d L0 tables, want %d", len(seen), n)
+	}
+
+	// Iterator của snapshot: không giữ khóa MemTable nên Put bên dưới không bị chặn
+	snap, err := e.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, err := snap.NewPrefixIterator("k:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tệp L0 thứ L0CompactionTrigger: flush rồi compaction chạy nền
+	if err := e.Put([]byte("k:new"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		e.mu.RLock()
+		l0 := len(e.current.Levels[0])
+		e.mu.RUnlock()
+		if l0 == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("compaction did not run (%d L0 tables)", l0)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	l0, _ := filepath.Glob(filepath.Join(dir, "sst", "sst-L0-*.sst"))
+	if fmt.Sprint(l0) != fmt.Sprint(seen) {
+		t.Fatalf("L0 tables on disk = %v, want only the ones the iterator saw %v", l0, seen)
+	}
+	after, err := e.NewIterator()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer after.Close()
+
+	keys := 0
+	for before.Next() {
+		keys++
+	}
+	if err := before.Error(); err != nil {
+		t.Fatal(err)
+	}
+	if keys != n {
+		t.Fatalf("old iterator saw %d keys, want %d", keys, n)
+	}
+	before.Close()
+	snap.Close()
+	if l0, _ := filepath.Glob(filepath.Join(dir, "sst", "sst-L0-*.sst")); len(l0) != 0 {
+		t.Fatalf("tables still on disk after their last iterator closed: %v", l0)
+	}
+	for keys = 0; after.Next(); keys++ {
+	}
+	if keys != n+1 {
+		t.Fatalf("new iterator saw %d keys, want %d", keys, n+1)
+	}
+}
@@ -0,0 +1,317 @@
+package lsm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Value log (kiểu WiscKey): value lớn hơn Options.ValueLogThreshold được tách
+// khỏi SSTable lúc flush và ghi nối vào vlog/vlog-<id>.log; SSTable chỉ giữ
+// con trỏ (flag entryValuePointer) nên compaction chỉ chép con trỏ thay vì
+// ghi lại cả document.
+//
+// Record:   crc(4) + keyLen(uvarint) + valueLen(uvarint) + key + value
+// Con trỏ:  fileID(uvarint) + offset(uvarint) + length(uvarint) của record
+//
+// CRC phủ phần sau nó; key trong record dùng để xác nhận con trỏ trỏ đúng chỗ.
+// Mỗi SSTable ghi lại số byte record nó trỏ tới trong từng tệp vlog
+// (FileMetadata.ValueLogRefs), GC dựa vào đó để biết phần còn sống của tệp.
+const (
+	valueLogDirName = "vlog"
+
+	DefaultValueLogFileSize = 64 * 1024 * 1024
+
+	// valueLogGCRatio: tệp có tỉ lệ rác (byte không còn SSTable nào trỏ tới)
+	// từ ngưỡng này trở lên sẽ được GC
+	valueLogGCRatio = 0.5
+)
+
+// ErrValueInValueLog: value của key nằm trong value log, không đọc được
+// chỉ từ SSTable (SSTReader.Find, ReadSSTFind)
+var ErrValueInValueLog = errors.New("value stored in value log")
+
+// valuePointer trỏ tới một record trong value log
+type valuePointer struct {
+	file   uint32
+	offset int64
+	length int64 // Độ dài cả record
+}
+
+func (p valuePointer) encode() []byte {
+	b := binary.AppendUvarint(nil, uint64(p.file))
+	b = binary.AppendUvarint(b, uint64(p.offset))
+	return binary.AppendUvarint(b, uint64(p.length))
+}
+
+func decodeValuePointer(b []byte) (valuePointer, error) {
+	var v [3]uint64
+	for i := range v {
+		n, k := binary.Uvarint(b)
+		if k <= 0 {
+			return valuePointer{}, fmt.Errorf("bad value pointer: %w", ErrCorruption)
+		}
+		v[i], b = n, b[k:]
+	}
+	if len(b) != 0 || v[0] > 1<<32-1 || v[1] > 1<<62 || v[2] > maxDecodedBlockSize {
+		return valuePointer{}, fmt.Errorf("bad value pointer: %w", ErrCorruption)
+	}
+	return valuePointer{file: uint32(v[0]), offset: int64(v[1]), length: int64(v[2])}, nil
+}
+
+// valueLog quản lý các tệp vlog: một tệp đang ghi (flush, GC) và các tệp
+// mở để đọc theo con trỏ
+type valueLog struct {
+	dir      string
+	fileSize int64 // Options.ValueLogFileSize
+
+	// commitMu: flush giữ RLock từ lúc ghi record tới khi SSTable vào MANIFEST,
+	// GC giữ Lock khi xóa tệp không còn được trỏ tới
+	commitMu sync.RWMutex
+
+	mu         sync.Mutex // Tuần tự hóa ghi
+	active     *os.File
+	activeBuf  *bufio.Writer
+	activeID   uint32
+	activeSize int64
+	nextID     uint32
+
+	filesMu sync.RWMutex
+	files   map[uint32]*os.File // Tệp đang mở để đọc
+
+	reads       atomic.Int64
+	gcRuns      atomic.Int64 // Số tệp vlog đã GC xong (xóa)
+	gcRewritten atomic.Int64 // Số byte value còn sống được chép sang tệp mới
+}
+
+func valueLogPath(dir string, id uint32) string {
+	return filepath.Join(dir, fmt.Sprintf("vlog-%06d.log", id))
+}
+
+// openValueLog mở thư mục vlog; tệp đang ghi luôn là tệp mới (tạo khi có
+// record đầu tiên) nên các tệp cũ chỉ còn được đọc và GC
+func openValueLog(dir string, fileSize int64) (*valueLog, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create value log dir: %w", err)
+	}
+	if fileSize <= 0 {
+		fileSize = DefaultValueLogFileSize
+	}
+	v := &valueLog{dir: dir, fileSize: fileSize, nextID: 1, files: make(map[uint32]*os.File)}
+	ids, err := v.fileIDs()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		v.nextID = ids[len(ids)-1] + 1
+	}
+	return v, nil
+}
+
+// fileIDs liệt kê các tệp vlog trên đĩa theo thứ tự tạo
+func (v *valueLog) fileIDs() ([]uint32, error) {
+	entries, err := os.ReadDir(v.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, entry := range entries {
+		var id uint32
+		if n, _ := fmt.Sscanf(entry.Name(), "vlog-%d.log", &id); n == 1 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// append ghi nối record của key vào tệp đang ghi; con trỏ chỉ an toàn để
+// lưu vào MANIFEST sau khi sync
+func (v *valueLog) append(key string, value []byte) (valuePointer, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.active == nil || v.activeSize >= v.fileSize {
+		if err := v.rotateLocked(); err != nil {
+			return valuePointer{}, err
+		}
+	}
+
+	body := binary.AppendUvarint(nil, uint64(len(key)))
+	body = binary.AppendUvarint(body, uint64(len(value)))
+	body = append(body, key...)
+	body = append(body, value...)
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.Checksum(body, crcTable))
+	if _, err := v.activeBuf.Write(crc[:]); err != nil {
+		return valuePointer{}, fmt.Errorf("write value log: %w", err)
+	}
+	if _, err := v.activeBuf.Write(body); err != nil {
+		return valuePointer{}, fmt.Errorf("write value log: %w", err)
+	}
+
+	ptr := valuePointer{file: v.activeID, offset: v.activeSize, length: int64(4 + len(body))}
+	v.activeSize += ptr.length
+	return ptr, nil
+}
+
+// rotateLocked đóng tệp đang ghi (sau khi sync) và tạo tệp mới
+func (v *valueLog) rotateLocked() error {
+	if err := v.closeActiveLocked(); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(valueLogPath(v.dir, v.nextID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("create value log file: %w", err)
+	}
+	v.active, v.activeBuf, v.activeID, v.activeSize = f, bufio.NewWriterSize(f, SSTWriteBufferSize), v.nextID, 0
+	v.nextID++
+	return nil
+}
+
+func (v *valueLog) closeActiveLocked() error {
+	if v.active == nil {
+		return nil
+	}
+	if err := v.syncLocked(); err != nil {
+		return err
+	}
+	err := v.active.Close()
+	v.active, v.activeBuf = nil, nil
+	return err
+}
+
+// sync đẩy các record đã append xuống đĩa (trước khi SSTable trỏ tới chúng
+// được ghi vào MANIFEST)
+func (v *valueLog) sync() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.syncLocked()
+}
+
+func (v *valueLog) syncLocked() error {
+	if v.active == nil {
+		return nil
+	}
+	if err := v.activeBuf.Flush(); err != nil {
+		return fmt.Errorf("flush value log: %w", err)
+	}
+	if err := v.active.Sync(); err != nil {
+		return fmt.Errorf("sync value log: %w", err)
+	}
+	return nil
+}
+
+// activeFile là id của tệp đang ghi (0 = chưa có), không được GC
+func (v *valueLog) activeFile() uint32 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.active == nil {
+		return 0
+	}
+	return v.activeID
+}
+
+// read đọc value mà con trỏ ptr (đã mã hóa) của key trỏ tới
+func (v *valueLog) read(key string, ptr []byte) ([]byte, error) {
+	p, err := decodeValuePointer(ptr)
+	if err != nil {
+		return nil, err
+	}
+	f, err := v.file(p.file)
+	if err != nil {
+		return nil, err
+	}
+	v.reads.Add(1)
+
+	buf := make([]byte, p.length)
+	if _, err := f.ReadAt(buf, p.offset); err != nil {
+		return nil, fmt.Errorf("read value log %06d at %d: %w", p.file, p.offset, err)
+	}
+	if len(buf) < 4 || binary.LittleEndian.Uint32(buf) != crc32.Checksum(buf[4:], crcTable) {
+		return nil, fmt.Errorf("value log %06d at %d: checksum mismatch: %w", p.file, p.offset, ErrCorruption)
+	}
+	body := buf[4:]
+	klen, n := binary.Uvarint(body)
+	if n <= 0 {
+		return nil, fmt.Errorf("value log %06d at %d: bad record: %w", p.file, p.offset, ErrCorruption)
+	}
+	body = body[n:]
+	vlen, n := binary.Uvarint(body)
+	if n <= 0 || klen > uint64(len(body)-n) || vlen != uint64(len(body)-n)-klen {
+		return nil, fmt.Errorf("value log %06d at %d: bad record: %w", p.file, p.offset, ErrCorruption)
+	}
+	body = body[n:]
+	if string(body[:klen]) != key {
+		return nil, fmt.Errorf("value log %06d at %d: record is for another key: %w", p.file, p.offset, ErrCorruption)
+	}
+	return body[klen:], nil
+}
+
+// file trả về tệp id mở để đọc (mở lần đầu khi cần)
+func (v *valueLog) file(id uint32) (*os.File, error) {
+	v.filesMu.RLock()
+	f := v.files[id]
+	v.filesMu.RUnlock()
+	if f != nil {
+		return f, nil
+	}
+
+	v.filesMu.Lock()
+	defer v.filesMu.Unlock()
+	if f := v.files[id]; f != nil {
+		return f, nil
+	}
+	f, err := os.Open(valueLogPath(v.dir, id))
+	if err != nil {
+		return nil, fmt.Errorf("open value log: %w", err)
+	}
+	v.files[id] = f
+	return f, nil
+}
+
+// remove xóa tệp vlog không còn SSTable nào trỏ tới
+func (v *valueLog) remove(id uint32) error {
+	v.filesMu.Lock()
+	if f := v.files[id]; f != nil {
+		f.Close()
+		delete(v.files, id)
+	}
+	v.filesMu.Unlock()
+	return os.Remove(valueLogPath(v.dir, id))
+}
+
+func (v *valueLog) close() error {
+	v.mu.Lock()
+	err := v.closeActiveLocked()
+	v.mu.Unlock()
+
+	v.filesMu.Lock()
+	for id, f := range v.files {
+		f.Close()
+		delete(v.files, id)
+	}
+	v.filesMu.Unlock()
+	return err
+}
+
+func (v *valueLog) export(m map[string]int64) {
+	ids, _ := v.fileIDs()
+	var size int64
+	for _, id := range ids {
+		if st, err := os.Stat(valueLogPath(v.dir, id)); err == nil {
+			size += st.Size()
+		}
+	}
+	m["value_log_files"] = int64(len(ids))
+	m["value_log_bytes"] = size
+	m["value_log_reads"] = v.reads.Load()
+	m["value_log_gc_files"] = v.gcRuns.Load()
+	m["value_log_gc_rewritten_bytes"] = v.gcRewritten.Load()
+}
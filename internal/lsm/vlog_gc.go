@@ -0,0 +1,286 @@
+package lsm
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// GC value log chạy trong worker compaction (dưới compactMu), sau mỗi lần
+// compaction hoặc khi tryScheduleCompaction thấy có tệp cần dọn:
+//   - tệp không còn SSTable nào trỏ tới bị xóa;
+//   - tệp có tỉ lệ rác >= valueLogGCRatio: các SSTable trỏ vào nó được ghi lại
+//     (cùng level, cùng vị trí trong Version), value còn sống được chép sang
+//     tệp vlog đang ghi; tệp cũ bị xóa ở lần GC kế tiếp khi đã hết tham chiếu.
+//
+// Tệp vlog mà SSTable trong một ảnh chụp còn sống (readView của Get, iterator,
+// snapshot; xem versionRefs) trỏ tới được giữ tới khi ảnh chụp đó nhả ra.
+
+// valueLogLive cộng ValueLogRefs của mọi SSTable trong Version hiện tại và
+// trong các ảnh chụp đang được đọc (mỗi tệp một lần). Ảnh chụp được lấy dưới
+// e.mu nên lần đọc bắt đầu sau đó chỉ thấy các tệp của Version hiện tại.
+func (e *LSMEngine) valueLogLive() map[uint32]int64 {
+	tables := make(map[string]*FileMetadata)
+	e.mu.RLock()
+	for _, files := range e.current.Levels {
+		for _, meta := range files {
+			tables[meta.Path] = meta
+		}
+	}
+	e.versions.pinnedTables(tables)
+	e.mu.RUnlock()
+
+	live := make(map[uint32]int64)
+	for _, meta := range tables {
+		for id, n := range meta.ValueLogRefs {
+			live[id] += n
+		}
+	}
+	return live
+}
+
+// valueLogGCPlan trả về các tệp vlog không còn được trỏ tới và tệp nên ghi
+// lại (tỉ lệ rác cao nhất, >= valueLogGCRatio; 0 = không có)
+func (e *LSMEngine) valueLogGCPlan() (drop []uint32, rewrite uint32, err error) {
+	ids, err := e.vlog.fileIDs()
+	if err != nil {
+		return nil, 0, err
+	}
+	live := e.valueLogLive()
+	active := e.vlog.activeFile()
+	best := 0.0
+	for _, id := range ids {
+		if id == active {
+			continue
+		}
+		if live[id] == 0 {
+			drop = append(drop, id)
+			continue
+		}
+		st, err := os.Stat(valueLogPath(e.vlog.dir, id))
+		if err != nil || st.Size() == 0 {
+			continue
+		}
+		if garbage := 1 - float64(live[id])/float64(st.Size()); garbage >= valueLogGCRatio && garbage > best {
+			best, rewrite = garbage, id
+		}
+	}
+	return drop, rewrite, nil
+}
+
+// needsValueLogGC cho tryScheduleCompaction biết có việc cho GC
+func (e *LSMEngine) needsValueLogGC() bool {
+	drop, rewrite, err := e.valueLogGCPlan()
+	return err == nil && (len(drop) > 0 || rewrite != 0)
+}
+
+// collectValueLog chạy một lượt GC value log (gọi từ job compaction)
+func (e *LSMEngine) collectValueLog() error {
+	e.compactMu.Lock()
+	defer e.compactMu.Unlock()
+
+	// Flush đang ghi giữ commitMu.RLock tới khi SSTable vào MANIFEST:
+	// con trỏ của nó chưa có trong valueLogLive nên phải chờ trước khi xóa
+	e.vlog.commitMu.Lock()
+	drop, rewrite, err := e.valueLogGCPlan()
+	if err == nil {
+		for _, id := range drop {
+			if err := e.vlog.remove(id); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove value log file", "component", "lsm", "file", id, "error", err)
+				continue
+			}
+			e.vlog.gcRuns.Add(1)
+			slog.Info("Removed unreferenced value log file", "component", "lsm", "file", id)
+		}
+	}
+	e.vlog.commitMu.Unlock()
+	if err != nil || rewrite == 0 {
+		return err
+	}
+
+	e.mu.RLock()
+	var tables []*FileMetadata
+	for _, files := range e.current.Levels {
+		for _, meta := range files {
+			if meta.ValueLogRefs[rewrite] > 0 {
+				tables = append(tables, meta)
+			}
+		}
+	}
+	e.mu.RUnlock()
+
+	slog.Info("Starting value log GC", "component", "lsm", "file", rewrite, "tables", len(tables))
+	for _, meta := range tables {
+		if err := e.rewriteValueLogRefs(meta, rewrite); err != nil {
+			return fmt.Errorf("value log gc %06d: %w", rewrite, err)
+		}
+	}
+	return nil
+}
+
+// rewriteValueLogRefs ghi lại SSTable meta, chép các value nằm trong tệp vlog
+// target sang tệp vlog đang ghi, rồi thay meta bằng tệp mới trong Version
+func (e *LSMEngine) rewriteValueLogRefs(meta *FileMetadata, target uint32) error {
+	it, err := e.openSSTIterator(meta.Path)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+
+	e.mu.Lock()
+	seq := e.seq
+	e.seq++
+	e.mu.Unlock()
+
+	path := filepath.Join(e.sstDir, fmt.Sprintf("sst-L%d-%06d.sst", meta.Level, seq))
+	writer, err := NewSSTWriter(path, meta.Level, meta.KeyCount, e.opts.Compression, e.opts.bloomPolicy(meta.Level))
+	if err != nil {
+		return err
+	}
+	writer.SetBlockSize(e.opts.blockSize(meta.Level), e.opts.BlockSizeCollections)
+	fail := func(err error) error {
+		writer.Close()
+		os.Remove(path)
+		return err
+	}
+
+	var rewritten int64
+	keysWritten := 0
+	const throttleAfterKeys = 1000
+	for it.Next() {
+		item := it.Value()
+		if item.ValuePointer {
+			p, err := decodeValuePointer(item.Value)
+			if err != nil {
+				return fail(err)
+			}
+			if p.file == target {
+				val, err := e.vlog.read(it.Key(), item.Value)
+				if err != nil {
+					return fail(err)
+				}
+				ptr, err := e.vlog.append(it.Key(), val)
+				if err != nil {
+					return fail(err)
+				}
+				item = &engine.Item{Value: ptr.encode(), ValuePointer: true, UpdatedAt: item.UpdatedAt, Seq: item.Seq, ExpiresAt: item.ExpiresAt}
+				rewritten += int64(len(val))
+			}
+		}
+		e.bgIO.wait(len(it.Key()) + len(item.Value))
+		if err := writer.WriteEntry(it.Key(), item); err != nil {
+			return fail(err)
+		}
+		keysWritten++
+		if keysWritten%throttleAfterKeys == 0 && e.shutdownAborted() {
+			return e.abortCompaction(writer, path)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return fail(err)
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err := e.vlog.sync(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	if e.shutdownAborted() {
+		return e.abortCompaction(nil, path)
+	}
+
+	m := writer.GetMetadata()
+	newMeta := &FileMetadata{
+		Level:      meta.Level,
+		Path:       path,
+		MinKey:     m.MinKey,
+		MaxKey:     m.MaxKey,
+		FileSize:   m.FileSize,
+		KeyCount:   m.KeyCount,
+		Tombstones: m.Tombstones,
+
+		ValueLogRefs: m.ValueLogRefs,
+	}
+	e.mu.Lock()
+	if !e.current.ReplaceFile(meta, newMeta) {
+		e.mu.Unlock()
+		os.Remove(path)
+		return fmt.Errorf("sst %s no longer in version", filepath.Base(meta.Path))
+	}
+	if err := e.saveManifest(); err != nil {
+		e.mu.Unlock()
+		slog.Error("CRITICAL: Failed to save manifest after value log GC", "error", err)
+		return err
+	}
+	e.mu.Unlock()
+
+	e.removeTableFile(meta.Path)
+	e.vlog.gcRewritten.Add(rewritten)
+	return nil
+}
+
+// separateValue trả về item ghi xuống SSTable khi flush: value từ
+// Options.ValueLogThreshold byte được ghi vào value log, item chỉ còn con trỏ
+func (e *LSMEngine) separateValue(key string, item *engine.Item) (*engine.Item, error) {
+	if e.opts.ValueLogThreshold <= 0 || item.Tombstone || item.ValuePointer || len(item.Value) < e.opts.ValueLogThreshold {
+		return item, nil
+	}
+	ptr, err := e.vlog.append(key, item.Value)
+	if err != nil {
+		return nil, err
+	}
+	return &engine.Item{Value: ptr.encode(), ValuePointer: true, UpdatedAt: item.UpdatedAt, Seq: item.Seq, ExpiresAt: item.ExpiresAt}, nil
+}
+
+// valueLogIterator đọc value từ value log cho các entry là con trỏ
+// (chỉ khi Value() được gọi: duyệt key, đếm không phải đọc value log)
+type valueLogIterator struct {
+	engine.Iterator
+	vlog  *valueLog
+	value *engine.Item
+	err   error
+}
+
+var _ engine.Iterator = (*valueLogIterator)(nil)
+
+func (it *valueLogIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.value = nil
+	return it.Iterator.Next()
+}
+
+func (it *valueLogIterator) Seek(key string) {
+	it.value = nil
+	it.Iterator.Seek(key)
+}
+
+func (it *valueLogIterator) Value() *engine.Item {
+	if it.value != nil {
+		return it.value
+	}
+	item := it.Iterator.Value()
+	if item == nil || !item.ValuePointer || item.Tombstone {
+		return item
+	}
+	val, err := it.vlog.read(it.Key(), item.Value)
+	if err != nil {
+		it.err = err
+		return &engine.Item{Tombstone: true}
+	}
+	it.value = &engine.Item{Value: val, UpdatedAt: item.UpdatedAt, Seq: item.Seq, ExpiresAt: item.ExpiresAt}
+	return it.value
+}
+
+func (it *valueLogIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.Iterator.Error()
+}
@@ -0,0 +1,119 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// GC value log chạy liên tục trong lúc Get và iterator đọc: tệp vlog mà
+// SSTable trong ảnh chụp của chúng trỏ tới không được bị xóa
+func TestValueLogGCKeepsFilesOfPinnedReads(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FlushSize = 8
+	opts.ValueLogThreshold = 64
+	opts.ValueLogFileSize = 4 << 10
+	eng, err := OpenLSMWithOptions(t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := eng.(*LSMEngine)
+	defer db.Close()
+
+	value := func(w, i int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("w%d-%06d|", w, i)), 16)
+	}
+	put := func(key string, val []byte) error {
+		for {
+			err := db.Put([]byte(key), val)
+			if !errors.Is(err, ErrTooManyPendingFlushes) {
+				return err
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	stop := make(chan struct{})
+	errs := make(chan error, 16)
+	var wg, readers sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		readers.Add(1)
+		go func(w int) {
+			defer readers.Done()
+			for i := 0; i < 1500; i++ {
+				key := fmt.Sprintf("doc:%d:%02d", w, i%20)
+				want := value(w, i)
+				if err := put(key, want); err != nil {
+					errs <- fmt.Errorf("put %s: %w", key, err)
+					return
+				}
+				got, err := db.Get([]byte(key))
+				if err != nil {
+					errs <- fmt.Errorf("get %s after put %d: %w", key, i, err)
+					return
+				}
+				if !bytes.Equal(got, want) {
+					errs <- fmt.Errorf("get %s after put %d = %.20q", key, i, got)
+					return
+				}
+			}
+		}(w)
+	}
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for n := 0; n < 50; n++ {
+			it, err := db.NewPrefixIterator("doc:")
+			if err != nil {
+				errs <- err
+				return
+			}
+			// Đọc chậm để compaction và GC kịp bỏ các tệp iterator đang thấy
+			for i := 0; it.Next(); i++ {
+				_ = it.Value()
+				if i%16 == 0 {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			err = it.Error()
+			it.Close()
+			if err != nil {
+				errs <- fmt.Errorf("iterator: %w", err)
+				return
+			}
+		}
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := db.Compact(); err != nil {
+				errs <- fmt.Errorf("compact: %w", err)
+				return
+			}
+			if err := db.collectValueLog(); err != nil {
+				errs <- fmt.Errorf("value log gc: %w", err)
+				return
+			}
+		}
+	}()
+
+	readers.Wait()
+	close(stop)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if db.vlog.gcRuns.Load() == 0 {
+		t.Error("value log GC never removed a file")
+	}
+}
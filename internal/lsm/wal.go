@@ -9,6 +9,9 @@ import (
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
 )
 
 type WAL struct {
@@ -16,6 +19,12 @@ type WAL struct {
 	path string
 	w    *bufio.Writer
 	mu   sync.Mutex
+
+	size     int64  // Số byte của các bản ghi đã ghi trọn vẹn (kể cả header segment)
+	gen      uint64 // Thế hệ của segment (xem walSegmentMagic); 0 = định dạng cũ không header
+	broken   error  // Khác nil: tệp không còn ghi tiếp được, phải chuyển segment mới
+	unsynced bool   // Có bản ghi DurabilityEverySec chưa fsync (xem Sync)
+	closed   bool
 }
 
 func OpenWAL(dir string, seq int) (*WAL, error) {
@@ -24,102 +33,393 @@ func OpenWAL(dir string, seq int) (*WAL, error) {
 	if err != nil {
 		return nil, err
 	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
 	return &WAL{
 		f:    f,
 		path: path,
 		w:    bufio.NewWriterSize(f, 256*1024), // 256KB buffer
+		size: stat.Size(),
 	}, nil
 }
 
+// Bit trong flag của bản ghi WAL
+const (
+	walDelete    byte = 1
+	walUpdatedAt byte = 2  // Value bắt đầu bằng thời điểm commit (Unix nano, 8 byte)
+	walBatch     byte = 4  // Bản ghi chứa cả một batch nhiều entry (xem appendBatchRecord)
+	walSeq       byte = 8  // Value có seqno của lần ghi (8 byte, sau thời điểm commit nếu có)
+	walExpiresAt byte = 16 // Value có thời điểm hết hạn của document (Unix nano, 8 byte, sau seqno)
+)
+
+// walRecordHeader là khung của mỗi bản ghi: crc(4) + keyLen(4) + valueLen(4) + flag(1)
+const walRecordHeader = 13
+
+// Segment WAL mới bắt đầu bằng header magic(8) + thế hệ(8), và mỗi bản ghi
+// trong đó có thế hệ (8 byte) đứng trước. Tệp tái sử dụng giữ nguyên kích
+// thước nên sau bản ghi cuối vẫn còn bản ghi của lần dùng trước: bản ghi mang
+// thế hệ khác là điểm kết thúc segment chứ không phải lỗi.
+const (
+	walSegmentMagic  = "MDBWALG1"
+	walSegmentHeader = 16
+)
+
+// writeWALSegmentHeader ghi header của segment thế hệ gen vào đầu f
+func writeWALSegmentHeader(f *os.File, gen uint64) error {
+	hdr := binary.LittleEndian.AppendUint64([]byte(walSegmentMagic), gen)
+	_, err := f.WriteAt(hdr, 0)
+	return err
+}
+
+// walEntryHeader là phần đầu của mỗi entry trong bản ghi walBatch: flag(1) + keyLen(4) + valueLen(4)
+const walEntryHeader = 9
+
+// walFlag trả về flag và phần đầu value của entry: thời điểm commit, seqno
+// rồi thời điểm hết hạn (mỗi phần 8 byte, bỏ qua nếu bằng 0)
+func walFlag(e *batchEntry) (byte, []byte) {
+	flag := byte(0)
+	if e.Tombstone {
+		flag |= walDelete
+	}
+	var ts []byte
+	if e.UpdatedAt != 0 {
+		flag |= walUpdatedAt
+		ts = binary.LittleEndian.AppendUint64(ts, uint64(e.UpdatedAt))
+	}
+	if e.Seq != 0 {
+		flag |= walSeq
+		ts = binary.LittleEndian.AppendUint64(ts, e.Seq)
+	}
+	if e.ExpiresAt != 0 {
+		flag |= walExpiresAt
+		ts = binary.LittleEndian.AppendUint64(ts, uint64(e.ExpiresAt))
+	}
+	return flag, ts
+}
+
+// appendRecord mã hóa một bản ghi: crc(4) + keyLen(4) + valueLen(4) + flag(1) + key + value,
+// crc tính trên flag + key + value (value gồm cả thời điểm commit/seqno, xem walFlag)
+func appendRecord(buf []byte, e *batchEntry) []byte {
+	flag, ts := walFlag(e)
+	return appendFramed(buf, flag, e.Key, ts, e.Value)
+}
+
+// appendFramed ghi khung bản ghi; value của bản ghi là ts + value
+func appendFramed(buf []byte, flag byte, key, ts, value []byte) []byte {
+	crc := crc32.Update(crc32.Checksum([]byte{flag}, crcTable), crcTable, key)
+	crc = crc32.Update(crc, crcTable, ts)
+	crc = crc32.Update(crc, crcTable, value)
+
+	buf = binary.LittleEndian.AppendUint32(buf, crc)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(key)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(ts)+len(value)))
+	buf = append(buf, flag)
+	buf = append(buf, key...)
+	buf = append(buf, ts...)
+	return append(buf, value...)
+}
+
+// appendBatchRecord mã hóa cả batch thành một bản ghi walBatch (key rỗng) với
+// một CRC: value = count(4) + mỗi entry flag(1) + keyLen(4) + valueLen(4) +
+// key + value. Bản ghi ghi dở hay hỏng bị bỏ cả, nên replay áp cả batch hoặc
+// không áp gì. Batch một entry được ghi như bản ghi thường.
+func appendBatchRecord(buf []byte, entries []*batchEntry) []byte {
+	if len(entries) == 1 {
+		return appendRecord(buf, entries[0])
+	}
+	n := 4
+	for _, e := range entries {
+		n += walEntryHeader + 24 + len(e.Key) + len(e.Value)
+	}
+	payload := make([]byte, 0, n)
+	payload = binary.LittleEndian.AppendUint32(payload, uint32(len(entries)))
+	for _, e := range entries {
+		flag, ts := walFlag(e)
+		payload = append(payload, flag)
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(len(e.Key)))
+		payload = binary.LittleEndian.AppendUint32(payload, uint32(len(ts)+len(e.Value)))
+		payload = append(payload, e.Key...)
+		payload = append(payload, ts...)
+		payload = append(payload, e.Value...)
+	}
+	return appendFramed(buf, walBatch, nil, nil, payload)
+}
+
+// decodeWALBatch tách các entry của bản ghi walBatch rồi gọi fn cho từng
+// entry; cả bản ghi được kiểm tra trước khi gọi fn lần đầu
+func decodeWALBatch(value []byte, fn func(flag byte, key, value []byte) error) error {
+	if len(value) < 4 {
+		return fmt.Errorf("wal batch record too short: %w", ErrCorruption)
+	}
+	count := binary.LittleEndian.Uint32(value)
+	rest := value[4:]
+	if uint64(count)*walEntryHeader > uint64(len(rest)) {
+		return fmt.Errorf("wal batch count %d exceeds record: %w", count, ErrCorruption)
+	}
+	type entry struct {
+		flag       byte
+		key, value []byte
+	}
+	entries := make([]entry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		if len(rest) < walEntryHeader {
+			return fmt.Errorf("wal batch entry %d truncated: %w", i, ErrCorruption)
+		}
+		flag := rest[0]
+		klen := uint64(binary.LittleEndian.Uint32(rest[1:]))
+		vlen := uint64(binary.LittleEndian.Uint32(rest[5:]))
+		rest = rest[walEntryHeader:]
+		if flag&walBatch != 0 || klen+vlen > uint64(len(rest)) {
+			return fmt.Errorf("wal batch entry %d invalid: %w", i, ErrCorruption)
+		}
+		entries = append(entries, entry{flag, rest[:klen], rest[klen : klen+vlen]})
+		rest = rest[klen+vlen:]
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("wal batch has %d trailing bytes: %w", len(rest), ErrCorruption)
+	}
+	for _, e := range entries {
+		if err := fn(e.flag, e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeWALEntry dựng lại entry từ flag, key và value của bản ghi: tách thời
+// điểm commit, seqno và thời điểm hết hạn (0 nếu bản ghi cũ không có) khỏi value
+func decodeWALEntry(flag byte, key, value []byte) (*batchEntry, error) {
+	e := &batchEntry{Key: key, Tombstone: flag&walDelete != 0}
+	if flag&walUpdatedAt != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("wal record too short for timestamp: %w", ErrCorruption)
+		}
+		e.UpdatedAt, value = int64(binary.LittleEndian.Uint64(value)), value[8:]
+	}
+	if flag&walSeq != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("wal record too short for seqno: %w", ErrCorruption)
+		}
+		e.Seq, value = binary.LittleEndian.Uint64(value), value[8:]
+	}
+	if flag&walExpiresAt != 0 {
+		if len(value) < 8 {
+			return nil, fmt.Errorf("wal record too short for expiry: %w", ErrCorruption)
+		}
+		e.ExpiresAt, value = int64(binary.LittleEndian.Uint64(value)), value[8:]
+	}
+	e.Value = value
+	return e, nil
+}
+
 // Append an entry (delete=true means tombstone)
 func (w *WAL) Append(key, value []byte, delete bool) error {
+	entry := &batchEntry{Key: key, Value: value, Tombstone: delete, UpdatedAt: time.Now().UnixNano()}
+	return w.AppendBatches([][]*batchEntry{{entry}}, engine.DurabilityOS)
+}
+
+// AppendBatches ghi các batch trong một lần, mỗi batch là một bản ghi
+// nguyên tử (xem appendBatchRecord). mode DurabilityAlways: fsync trước khi
+// trả về; DurabilityEverySec: để lần Sync nền kế tiếp fsync.
+// Lỗi giữa chừng thì tệp được cắt về trước lần ghi để không để lại bản ghi dở;
+// nếu không cắt được (hoặc fsync lỗi) WAL bị đánh dấu hỏng, xem Broken.
+func (w *WAL) AppendBatches(batches [][]*batchEntry, mode engine.Durability) error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-
-	flag := byte(0)
-	if delete {
-		flag = 1
+	if w.broken != nil {
+		return fmt.Errorf("wal %s unusable: %w", filepath.Base(w.path), w.broken)
 	}
 
-	// --- LOGIC MỚI BẮT ĐẦU ---
-	// 1. Tạo buffer cho dữ liệu cần checksum
-	// (flag + key + value)
-	dataLen := 1 + len(key) + len(value)
-	buf := make([]byte, dataLen)
-	buf[0] = flag
-	copy(buf[1:], key)
-	copy(buf[1+len(key):], value)
-
-	// 2. Tính CRC
-	crc := crc32.Checksum(buf, crcTable)
-	// --- LOGIC MỚI KẾT THÚC ---
+	// Dựng mọi bản ghi trong bộ nhớ trước khi chạm vào tệp
+	n := 0
+	for _, entries := range batches {
+		n += 8 + walRecordHeader + 4
+		for _, e := range entries {
+			n += walEntryHeader + 24 + len(e.Key) + len(e.Value)
+		}
+	}
+	buf := make([]byte, 0, n)
+	for _, entries := range batches {
+		if w.gen != 0 {
+			buf = binary.LittleEndian.AppendUint64(buf, w.gen)
+		}
+		buf = appendBatchRecord(buf, entries)
+	}
 
-	// 3. Ghi CRC (MỚI)
-	if err := binary.Write(w.w, binary.LittleEndian, crc); err != nil {
-		return err
+	_, err := w.w.Write(buf)
+	if err == nil {
+		err = w.w.Flush()
 	}
-	// 4. Ghi phần còn lại (như cũ)
-	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(key))); err != nil {
+	if err != nil {
+		w.rollback(err)
 		return err
 	}
-	if err := binary.Write(w.w, binary.LittleEndian, uint32(len(value))); err != nil {
-		return err
+	w.size += int64(len(buf))
+	switch mode {
+	case engine.DurabilityAlways:
+		return w.syncLocked()
+	case engine.DurabilityEverySec:
+		w.unsynced = true
 	}
-	if _, err := w.w.Write([]byte{flag}); err != nil {
-		return err
+	return nil
+}
+
+// Sync fsync các bản ghi DurabilityEverySec chưa được fsync (job nền mỗi giây)
+func (w *WAL) Sync() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.unsynced || w.closed || w.broken != nil {
+		return false, nil
 	}
-	if _, err := w.w.Write(key); err != nil {
+	return true, w.syncLocked()
+}
+
+func (w *WAL) syncLocked() error {
+	if err := w.f.Sync(); err != nil {
+		// Sau khi fsync lỗi không biết phần nào đã xuống đĩa: không ghi tiếp vào tệp này
+		w.broken = err
 		return err
 	}
-	if _, err := w.w.Write(value); err != nil {
-		return err
+	w.unsynced = false
+	return nil
+}
+
+// rollback cắt tệp về cuối bản ghi trọn vẹn cuối cùng sau một lần ghi lỗi
+func (w *WAL) rollback(cause error) {
+	if err := w.f.Truncate(w.size); err != nil {
+		w.broken = fmt.Errorf("%v (truncate after failed write: %v)", cause, err)
+		return
+	}
+	// Segment mới không mở O_APPEND: đưa vị trí ghi về cuối bản ghi trọn vẹn
+	if _, err := w.f.Seek(w.size, io.SeekStart); err != nil {
+		w.broken = fmt.Errorf("%v (seek after failed write: %v)", cause, err)
+		return
 	}
+	w.w.Reset(w.f) // bufio.Writer giữ lỗi cũ mãi nếu không Reset
+}
+
+// Size trả về số byte đã ghi vào segment
+func (w *WAL) Size() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.size
+}
 
-	return w.w.Flush()
+// Broken trả về true nếu WAL không còn ghi tiếp được
+func (w *WAL) Broken() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.broken != nil
 }
 
-// Iterate to replay WAL
+// Iterate to replay WAL; bản ghi walBatch được tách thành từng entry
 func (w *WAL) Iterate(fn func(flag byte, key, value []byte) error) error {
 	if _, err := w.f.Seek(0, 0); err != nil {
 		return err
 	}
-	r := bufio.NewReaderSize(w.f, 256*1024)
+	stat, err := w.f.Stat()
+	if err != nil {
+		return err
+	}
+	return iterateWAL(bufio.NewReaderSize(w.f, 256*1024), stat.Size(), func(flag byte, key, value []byte) error {
+		if flag&walBatch != 0 {
+			return decodeWALBatch(value, fn)
+		}
+		return fn(flag, key, value)
+	})
+}
+
+// walRecordError: bản ghi bắt đầu tại Offset không đọc được (ghi dở hoặc
+// hỏng); mọi bản ghi đứng trước Offset đều hợp lệ
+type walRecordError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *walRecordError) Error() string {
+	return fmt.Sprintf("wal record at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *walRecordError) Unwrap() error { return e.Err }
 
+// iterateWAL giải mã các bản ghi từ r (size byte); segment có header chỉ đọc
+// tới bản ghi đầu tiên mang thế hệ khác (xem walSegmentMagic). Độ dài key/value được
+// kiểm tra với số byte còn lại trước khi cấp phát, nên bản ghi hỏng chỉ
+// trả về lỗi (io.ErrUnexpectedEOF / ErrCorruption, bọc trong *walRecordError)
+// chứ không cấp phát vài GB. Lỗi do fn trả về được giữ nguyên.
+func iterateWAL(r io.Reader, size int64, fn func(flag byte, key, value []byte) error) error {
 	// Buffer tái sử dụng để tính toán CRC
 	buf := make([]byte, 1024)
+	var header [12]byte
+	remaining := size
+	var start int64 // Offset của bản ghi đang đọc
+	bad := func(err error) error { return &walRecordError{Offset: start, Err: err} }
+
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	r = br
+	var gen uint64
+	if hdr, err := br.Peek(walSegmentHeader); err == nil && string(hdr[:8]) == walSegmentMagic {
+		gen = binary.LittleEndian.Uint64(hdr[8:])
+		br.Discard(walSegmentHeader)
+		remaining -= walSegmentHeader
+	}
 
 	for {
-		// --- LOGIC MỚI: ĐỌC VÀ KIỂM TRA CRC ---
-		var storedCrc uint32
-		if err := binary.Read(r, binary.LittleEndian, &storedCrc); err != nil {
+		start = size - remaining
+		if gen != 0 {
+			var g [8]byte
+			if _, err := io.ReadFull(r, g[:]); err != nil {
+				if err == io.EOF {
+					break
+				}
+				return bad(err)
+			}
+			if binary.LittleEndian.Uint64(g[:]) != gen {
+				break // Dữ liệu còn lại của lần dùng trước
+			}
+			remaining -= 8
+		}
+		// crc(4) + keyLen(4) + valueLen(4)
+		if _, err := io.ReadFull(r, header[:4]); err != nil {
 			if err == io.EOF {
 				break
 			}
-			return err
+			return bad(err)
 		}
-		// --- KẾT THÚC LOGIC MỚI ---
-
-		var klen, vlen uint32
-		if err := binary.Read(r, binary.LittleEndian, &klen); err != nil {
-			return err // Báo lỗi (hỏng hóc) nếu file kết thúc đột ngột sau CRC
+		if _, err := io.ReadFull(r, header[4:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return bad(err) // Báo lỗi (hỏng hóc) nếu file kết thúc đột ngột sau CRC
 		}
-		if err := binary.Read(r, binary.LittleEndian, &vlen); err != nil {
-			return err
+		storedCrc := binary.LittleEndian.Uint32(header[0:])
+		klen := binary.LittleEndian.Uint32(header[4:])
+		vlen := binary.LittleEndian.Uint32(header[8:])
+		remaining -= int64(len(header))
+		if int64(klen)+int64(vlen)+1 > remaining {
+			return bad(io.ErrUnexpectedEOF) // Bản ghi ghi dở (hoặc độ dài hỏng)
 		}
+		remaining -= int64(klen) + int64(vlen) + 1
 
-		flag, err := r.ReadByte()
+		flag, err := readByte(r)
 		if err != nil {
-			return err
+			return bad(err)
 		}
 
 		key := make([]byte, klen)
 		if _, err := io.ReadFull(r, key); err != nil {
-			return err
+			return bad(err)
 		}
 
 		val := make([]byte, vlen)
 		if _, err := io.ReadFull(r, val); err != nil {
-			return err
+			return bad(err)
 		}
 
 		// --- LOGIC MỚI: XÁC THỰC CRC ---
@@ -136,7 +436,7 @@ func (w *WAL) Iterate(fn func(flag byte, key, value []byte) error) error {
 		calculatedCrc := crc32.Checksum(buf, crcTable)
 
 		if storedCrc != calculatedCrc {
-			return ErrCorruption // Lỗi! Dữ liệu WAL đã bị hỏng.
+			return bad(ErrCorruption) // Lỗi! Dữ liệu WAL đã bị hỏng.
 		}
 		// --- KẾT THÚC LOGIC MỚI ---
 
@@ -147,10 +447,25 @@ func (w *WAL) Iterate(fn func(flag byte, key, value []byte) error) error {
 	return nil
 }
 
+func readByte(r io.Reader) (byte, error) {
+	if br, ok := r.(io.ByteReader); ok {
+		return br.ReadByte()
+	}
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
+
 // Close flushes and closes the WAL file
 func (w *WAL) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
+	w.closed = true
+
+	if w.broken != nil {
+		// Các batch đã thành công đều đã được flush; phần còn lại không dùng được
+		return w.f.Close()
+	}
 
 	if w.w != nil {
 		if err := w.w.Flush(); err != nil {
@@ -0,0 +1,273 @@
+package lsm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// walArchivePruneInterval là chu kỳ job nền xóa segment lưu trữ quá hạn
+const walArchivePruneInterval = time.Minute
+
+// walArchive giữ các segment WAL đã flush (thay vì xóa) để khôi phục tới
+// một thời điểm (point-in-time recovery) từ một bản sao lưu cũ hơn
+type walArchive struct {
+	dir       string
+	retention time.Duration // 0 = không xóa theo tuổi
+	maxBytes  int64         // 0 = không giới hạn dung lượng
+
+	archived atomic.Int64 // Số segment đã đưa vào lưu trữ
+	pruned   atomic.Int64 // Số segment bị xóa theo chính sách giữ lại
+	bytes    atomic.Int64 // Dung lượng lưu trữ ở lần prune gần nhất
+}
+
+// openWALArchive tạo thư mục lưu trữ; dir tương đối tính từ thư mục CSDL
+func openWALArchive(dbDir string, opts Options) (*walArchive, error) {
+	if opts.WALArchiveDir == "" {
+		return nil, nil
+	}
+	dir := opts.WALArchiveDir
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(dbDir, dir)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create wal archive dir: %w", err)
+	}
+	return &walArchive{dir: dir, retention: opts.WALArchiveRetention, maxBytes: opts.WALArchiveMaxBytes}, nil
+}
+
+// put chuyển segment đã flush vào thư mục lưu trữ (chép nếu khác filesystem)
+func (a *walArchive) put(path string) error {
+	dst := filepath.Join(a.dir, filepath.Base(path))
+	if _, err := os.Stat(dst); err == nil {
+		// Segment cùng tên đã được lưu (vd. mở lại một bản khôi phục với cùng
+		// thư mục lưu trữ): giữ bản cũ, đầy đủ hơn
+		slog.Warn("WAL segment already archived, keeping the archived copy", "component", "lsm", "path", path)
+		return os.Remove(path)
+	}
+	if err := os.Rename(path, dst); err != nil {
+		if err := copyFileSync(path, dst); err != nil {
+			os.Remove(dst)
+			return fmt.Errorf("archive wal %s: %w", path, err)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	a.archived.Add(1)
+	return syncDir(a.dir)
+}
+
+// prune xóa các segment cũ nhất quá retention hoặc vượt maxBytes
+func (a *walArchive) prune() error {
+	paths, err := listWALFiles(a.dir)
+	if err != nil {
+		return err
+	}
+	sizes := make([]int64, len(paths))
+	mtimes := make([]time.Time, len(paths))
+	var total int64
+	for i, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		sizes[i], mtimes[i] = st.Size(), st.ModTime()
+		total += st.Size()
+	}
+	cutoff := time.Now().Add(-a.retention)
+	for i, p := range paths {
+		expired := a.retention > 0 && mtimes[i].Before(cutoff)
+		if !expired && (a.maxBytes <= 0 || total <= a.maxBytes) {
+			break // Các segment sau mới hơn
+		}
+		if err := os.Remove(p); err != nil {
+			slog.Warn("Failed to prune archived WAL segment", "component", "lsm", "path", p, "error", err)
+			continue
+		}
+		total -= sizes[i]
+		a.pruned.Add(1)
+		slog.Debug("Pruned archived WAL segment", "component", "lsm", "path", p)
+	}
+	a.bytes.Store(total)
+	return nil
+}
+
+func (a *walArchive) export(m map[string]int64) {
+	if a == nil {
+		return
+	}
+	m["wal_archived_segments"] = a.archived.Load()
+	m["wal_archive_pruned"] = a.pruned.Load()
+	m["wal_archive_bytes"] = a.bytes.Load()
+}
+
+// listWALFiles trả về các segment wal-*.log trong dir theo thứ tự tạo
+func listWALFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, ent := range entries {
+		if name := ent.Name(); strings.HasPrefix(name, "wal-") && strings.HasSuffix(name, ".log") {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	sortWALFiles(paths)
+	return paths, nil
+}
+
+// RestoreReport mô tả kết quả của RestoreToTimestamp/RestoreToSeq
+type RestoreReport struct {
+	Segments   int       // Số segment được đặt vào thư mục WAL để replay
+	Records    int64     // Số bản ghi WAL được giữ
+	Dropped    int64     // Số bản ghi sau điểm dừng bị bỏ (trong segment cuối)
+	LastCommit time.Time // Thời điểm commit của bản ghi cuối được giữ (zero nếu không rõ)
+}
+
+// RestoreToTimestamp chuẩn bị dir (bản sao của một bản sao lưu, CSDL chưa mở)
+// để lần mở kế tiếp khôi phục tới thời điểm ts: các segment lưu trữ mới hơn
+// phần đã flush của bản sao lưu được chép vào thư mục WAL, bỏ từ bản ghi đầu
+// tiên commit sau ts. Mỗi bản ghi (cả batch) được giữ hoặc bỏ trọn vẹn.
+func RestoreToTimestamp(dir, archiveDir string, ts time.Time) (*RestoreReport, error) {
+	limit := ts.UnixNano()
+	return restoreWAL(dir, archiveDir, func(seg, commit int64) bool { return commit > limit })
+}
+
+// RestoreToSeq như RestoreToTimestamp nhưng dừng sau segment WAL số seq
+// (wal-<seq>-*.log)
+func RestoreToSeq(dir, archiveDir string, seq int64) (*RestoreReport, error) {
+	return restoreWAL(dir, archiveDir, func(seg, commit int64) bool { return seg > seq })
+}
+
+// restoreWAL ghi lại các segment cần replay vào thư mục WAL của dir cho tới
+// khi stop(segment, thời điểm commit) trả về true
+func restoreWAL(dir, archiveDir string, stop func(seg, commit int64) bool) (*RestoreReport, error) {
+	v, err := loadManifest(dir)
+	if err != nil {
+		return nil, fmt.Errorf("load manifest: %w", err)
+	}
+	walDir := filepath.Join(dir, "wal")
+	if err := os.MkdirAll(walDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	// Segment chưa flush của bản sao lưu cộng các segment lưu trữ; bản lưu
+	// trữ (đã đầy đủ) thay cho bản cùng tên trong bản sao lưu
+	local, err := listWALFiles(walDir)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := listWALFiles(archiveDir)
+	if err != nil {
+		return nil, fmt.Errorf("read wal archive: %w", err)
+	}
+	byName := make(map[string]string)
+	for _, p := range append(local, archived...) {
+		if !v.walFlushed(p) {
+			byName[filepath.Base(p)] = p
+		}
+	}
+	sources := make([]string, 0, len(byName))
+	for _, p := range byName {
+		sources = append(sources, p)
+	}
+	sortWALFiles(sources)
+
+	report := &RestoreReport{}
+	stopped := false
+	for i, src := range sources {
+		dst := filepath.Join(walDir, filepath.Base(src))
+		seg, _ := walNumber(src)
+		if stopped || stop(seg, 0) {
+			stopped = true
+			if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+				return nil, err
+			}
+			continue
+		}
+
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return nil, err
+		}
+		var out []byte
+		err = iterateWAL(bytes.NewReader(data), int64(len(data)), func(flag byte, key, value []byte) error {
+			commit, err := walRecordCommit(flag, value)
+			if err != nil {
+				return err
+			}
+			if stopped || (commit != 0 && stop(seg, commit)) {
+				stopped = true
+				report.Dropped++
+				return nil
+			}
+			out = appendFramed(out, flag, key, nil, value)
+			report.Records++
+			if commit != 0 {
+				report.LastCommit = time.Unix(0, commit)
+			}
+			return nil
+		})
+		if err != nil {
+			// Như replay: chỉ chấp nhận phần ghi dở ở cuối segment mới nhất
+			var recErr *walRecordError
+			if i != len(sources)-1 || !errors.As(err, &recErr) {
+				return nil, fmt.Errorf("read wal %s: %w", src, err)
+			}
+			slog.Warn("Ignoring torn tail of the newest WAL segment", "component", "lsm", "path", src, "offset", recErr.Offset)
+		}
+
+		tmp := dst + ".tmp"
+		if err := os.WriteFile(tmp, out, 0o644); err != nil {
+			return nil, err
+		}
+		if err := syncFile(tmp); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			return nil, err
+		}
+		report.Segments++
+	}
+	return report, syncDir(walDir)
+}
+
+// walRecordCommit trả về thời điểm commit của bản ghi (batch: của entry
+// muộn nhất), 0 nếu bản ghi không có
+func walRecordCommit(flag byte, value []byte) (int64, error) {
+	if flag&walBatch == 0 {
+		e, err := decodeWALEntry(flag, nil, value)
+		if err != nil {
+			return 0, err
+		}
+		return e.UpdatedAt, nil
+	}
+	var latest int64
+	err := decodeWALBatch(value, func(flag byte, key, value []byte) error {
+		e, err := decodeWALEntry(flag, key, value)
+		if err != nil {
+			return err
+		}
+		latest = max(latest, e.UpdatedAt)
+		return nil
+	})
+	return latest, err
+}
+
+// syncFile fsync một tệp đã ghi xong
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
@@ -0,0 +1,61 @@
+package lsm
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// Batch ghi dở (crash giữa lúc ghi bản ghi) bị bỏ cả: sau khi mở lại không
+// thấy entry nào của batch, các lần ghi trước đó vẫn còn
+func TestTornBatchRecordIsDroppedWhole(t *testing.T) {
+	dir := t.TempDir()
+	db, err := OpenLSM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := db.Put([]byte("k:before"), []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	b := db.NewBatch()
+	b.Put([]byte("k:1"), []byte("v1"))
+	b.Delete([]byte("k:before"))
+	b.Put([]byte("k:2"), []byte("v2"))
+	if err := db.ApplyBatch(b); err != nil {
+		t.Fatal(err)
+	}
+
+	crashed := crashCopy(t, dir)
+	paths, _ := filepath.Glob(filepath.Join(crashed, "wal", "wal-*.log"))
+	if len(paths) == 0 {
+		t.Fatal("no WAL segment")
+	}
+	sortWALFiles(paths)
+	newest := paths[len(paths)-1]
+	st, err := os.Stat(newest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cắt mất vài byte cuối của bản ghi batch
+	if err := os.Truncate(newest, st.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+
+	re, err := OpenLSM(crashed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer re.Close()
+	if got, err := re.Get([]byte("k:before")); err != nil || string(got) != "v" {
+		t.Fatalf("get k:before = %q, %v; want v", got, err)
+	}
+	for _, k := range []string{"k:1", "k:2"} {
+		if _, err := re.Get([]byte(k)); !errors.Is(err, engine.ErrKeyNotFound) {
+			t.Fatalf("get %s err = %v, want not found", k, err)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+
+package lsm
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocKeepSize (FALLOC_FL_KEEP_SIZE): cấp phát trước mà không đổi kích thước tệp, nên replay
+// (đọc tới hết kích thước tệp) không thấy phần chưa ghi
+const fallocKeepSize = 0x1
+
+// preallocate cấp phát trước size byte cho tệp WAL để các lần ghi sau không
+// phải xin thêm block từ filesystem
+func preallocate(f *os.File, size int64) error {
+	return syscall.Fallocate(int(f.Fd()), fallocKeepSize, 0, size)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package lsm
+
+import "os"
+
+// preallocate không được hỗ trợ ngoài Linux: tệp WAL lớn dần theo lần ghi
+func preallocate(f *os.File, size int64) error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package lsm
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultWALSegmentBytes là dung lượng tối đa mặc định của một segment WAL
+const DefaultWALSegmentBytes = 64 << 20 // 64MB
+
+// Tệp WAL đã flush chờ tái sử dụng; không khớp wal-*.log nên không bị replay
+const (
+	walRecyclePrefix = "recycle-"
+	walRecycleSuffix = ".wal"
+)
+
+// walRecycler giữ tối đa max tệp WAL đã flush để dùng lại cho segment mới
+// (đổi tên thay vì xóa rồi tạo tệp), giảm thao tác trên thư mục lúc rotate.
+type walRecycler struct {
+	mu    sync.Mutex
+	dir   string
+	max   int
+	files []string
+
+	reused atomic.Int64 // Số segment mới được tạo từ tệp tái sử dụng
+}
+
+// newWALRecycler nhận lại các tệp chờ tái sử dụng của lần chạy trước
+// (bỏ phần vượt quá max)
+func newWALRecycler(dir string, max int) *walRecycler {
+	r := &walRecycler{dir: dir, max: max}
+	entries, _ := os.ReadDir(dir)
+	for _, ent := range entries {
+		name := ent.Name()
+		if !strings.HasPrefix(name, walRecyclePrefix) || !strings.HasSuffix(name, walRecycleSuffix) {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		if len(r.files) < max {
+			r.files = append(r.files, p)
+		} else {
+			os.Remove(p)
+		}
+	}
+	return r
+}
+
+// put đưa segment đã flush vào danh sách tái sử dụng; false = danh sách đầy,
+// caller tự xóa tệp
+func (r *walRecycler) put(path string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.files) >= r.max {
+		return false
+	}
+	p := filepath.Join(r.dir, fmt.Sprintf("%s%d%s", walRecyclePrefix, time.Now().UnixNano(), walRecycleSuffix))
+	if err := os.Rename(path, p); err != nil {
+		return false
+	}
+	r.files = append(r.files, p)
+	return true
+}
+
+// take đổi tên một tệp tái sử dụng thành path cho segment thế hệ gen. Tệp giữ
+// nguyên kích thước (không trả lại block cho filesystem); header được ghi đè
+// bằng thế hệ mới và fsync trước khi đổi tên, nên bản ghi cũ trong tệp mang
+// thế hệ khác và không bao giờ bị replay dưới tên mới.
+func (r *walRecycler) take(path string, gen uint64) bool {
+	r.mu.Lock()
+	if len(r.files) == 0 {
+		r.mu.Unlock()
+		return false
+	}
+	p := r.files[len(r.files)-1]
+	r.files = r.files[:len(r.files)-1]
+	r.mu.Unlock()
+
+	f, err := os.OpenFile(p, os.O_RDWR, 0o644)
+	if err == nil {
+		if err = writeWALSegmentHeader(f, gen); err == nil {
+			err = f.Sync()
+		}
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(p, path)
+	}
+	if err != nil {
+		slog.Warn("Failed to reuse WAL file", "component", "lsm", "path", p, "error", err)
+		os.Remove(p)
+		return false
+	}
+	r.reused.Add(1)
+	return true
+}
+
+func (r *walRecycler) export(m map[string]int64) {
+	r.mu.Lock()
+	m["wal_recycle_pool"] = int64(len(r.files)) // Số tệp WAL đang chờ tái sử dụng
+	r.mu.Unlock()
+	m["wal_recycle_reuses"] = r.reused.Load()
+}
+
+// removeWAL bỏ segment WAL đã flush: đưa vào lưu trữ nếu bật WALArchiveDir,
+// không thì vào danh sách tái sử dụng nếu còn chỗ, không nữa thì xóa
+func (e *LSMEngine) removeWAL(path string) error {
+	if e.walArchive != nil {
+		return e.walArchive.put(path)
+	}
+	if e.walRecycle.put(path) {
+		slog.Debug("Recycled old WAL file", "path", path)
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// rotateWALSegment chuyển sang segment mới khi segment hiện tại vượt
+// WALSegmentBytes; các segment cũ vẫn thuộc MemTable hiện tại (walRetired)
+// và được bỏ cùng nhau khi MemTable flush xong. Caller phải giữ e.mu.
+func (e *LSMEngine) rotateWALSegment() error {
+	w, err := e.newWALSegment()
+	if err != nil {
+		return err
+	}
+	old := e.wal
+	if err := old.Close(); err != nil {
+		// Dữ liệu trong segment cũ chưa chắc đã xuống đĩa: vẫn giữ nó để replay
+		slog.Warn("Failed to close rotated WAL segment", "component", "lsm", "path", old.path, "error", err)
+	}
+	e.walRetired = append(e.walRetired, old.path)
+	e.wal = w
+	e.metrics.walRotations.Add(1)
+	slog.Debug("Rotated WAL segment", "component", "lsm", "old", old.path, "size", old.Size(), "new", w.path)
+	return nil
+}
@@ -0,0 +1,91 @@
+package lsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nconghau/MiniDBGo/internal/engine"
+)
+
+// walKeys replay segment tại path và trả về các key theo thứ tự
+func walKeys(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var keys []string
+	err = (&WAL{f: f, path: path}).Iterate(func(flag byte, key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("replay %s: %v", filepath.Base(path), err)
+	}
+	return keys
+}
+
+// Segment tạo từ tệp tái sử dụng giữ nguyên kích thước tệp, và bản ghi của
+// lần dùng trước còn nằm sau bản ghi mới không bao giờ bị replay
+func TestRecycledWALSegmentKeepsSizeAndSkipsOldRecords(t *testing.T) {
+	walDir := filepath.Join(t.TempDir(), "wal")
+	if err := os.MkdirAll(walDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	e := &LSMEngine{dir: filepath.Dir(walDir), walRecycle: newWALRecycler(walDir, 1)}
+	write := func(prefix string, n int) *WAL {
+		w, err := e.newWALSegment()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var batches [][]*batchEntry
+		for i := 0; i < n; i++ {
+			batches = append(batches, []*batchEntry{{Key: []byte(fmt.Sprintf("%s:%03d", prefix, i)), Value: make([]byte, 64)}})
+		}
+		if err := w.AppendBatches(batches, engine.DurabilityAlways); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	old := write("old", 100)
+	st, err := os.Stat(old.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSize := st.Size()
+	if !e.walRecycle.put(old.path) {
+		t.Fatal("recycle pool rejected the segment")
+	}
+
+	// Tệp tái sử dụng chưa có bản ghi mới: replay không thấy gì
+	empty, err := e.newWALSegment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty.Close()
+	if keys := walKeys(t, empty.path); len(keys) != 0 {
+		t.Fatalf("fresh recycled segment replays %d old records", len(keys))
+	}
+	if !e.walRecycle.put(empty.path) {
+		t.Fatal("recycle pool rejected the segment")
+	}
+
+	cur := write("new", 2)
+	if st, err := os.Stat(cur.path); err != nil || st.Size() != oldSize {
+		t.Fatalf("recycled segment size = %v (%v), want %d", st.Size(), err, oldSize)
+	}
+	keys := walKeys(t, cur.path)
+	if len(keys) != 2 || keys[0] != "new:000" || keys[1] != "new:001" {
+		t.Fatalf("replayed keys = %v, want [new:000 new:001]", keys)
+	}
+	if n := e.walRecycle.reused.Load(); n != 2 {
+		t.Fatalf("reused = %d, want 2", n)
+	}
+}
@@ -0,0 +1,429 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidPipeline được trả về khi pipeline không hợp lệ
+var ErrInvalidPipeline = errors.New("invalid aggregation pipeline")
+
+// Pipeline là một chuỗi stage xử lý document theo kiểu streaming:
+// mỗi document được đẩy vào bằng Push, kết quả lấy ra bằng Result.
+// Hỗ trợ: $match, $group ($sum, $avg, $min, $max, $count), $sort,
+// $lookup (cần WithLookup).
+type Pipeline struct {
+	stages []stage
+	out    []map[string]interface{}
+}
+
+type stage interface {
+	push(doc map[string]interface{}, emit func(map[string]interface{}))
+	flush(emit func(map[string]interface{}))
+}
+
+// ParsePipeline kiểm tra và dựng pipeline từ JSON đã decode
+func ParsePipeline(raw []map[string]interface{}) (*Pipeline, error) {
+	p := &Pipeline{out: make([]map[string]interface{}, 0)}
+	for i, spec := range raw {
+		if len(spec) != 1 {
+			return nil, fmt.Errorf("%w: stage %d must have exactly one operator", ErrInvalidPipeline, i)
+		}
+		for op, arg := range spec {
+			var st stage
+			var err error
+			switch op {
+			case "$match":
+				filter, ok := arg.(map[string]interface{})
+				if !ok {
+					err = errors.New("$match expects an object")
+				} else {
+					err = ValidateFilter(filter)
+				}
+				st = &matchStage{filter: filter}
+			case "$group":
+				st, err = newGroupStage(arg)
+			case "$sort":
+				st, err = newSortStage(arg)
+			case "$lookup":
+				st, err = newLookupStage(arg)
+			default:
+				err = fmt.Errorf("unsupported stage %s", op)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%w: stage %d: %v", ErrInvalidPipeline, i, err)
+			}
+			p.stages = append(p.stages, st)
+		}
+	}
+	return p, nil
+}
+
+// LeadingMatch trả về filter của $match đứng đầu (nếu có) và pipeline
+// còn lại, để caller có thể dùng index khi đọc document nguồn.
+func (p *Pipeline) LeadingMatch() (map[string]interface{}, *Pipeline) {
+	if len(p.stages) == 0 {
+		return nil, p
+	}
+	m, ok := p.stages[0].(*matchStage)
+	if !ok {
+		return nil, p
+	}
+	return m.filter, &Pipeline{stages: p.stages[1:], out: p.out}
+}
+
+// LeadingSort trả về các key của $sort đứng đầu (nếu có) và pipeline còn lại,
+// để caller bỏ qua stage này khi đã đọc document theo đúng thứ tự (index).
+func (p *Pipeline) LeadingSort() ([]SortKey, *Pipeline) {
+	if len(p.stages) == 0 {
+		return nil, p
+	}
+	st, ok := p.stages[0].(*sortStage)
+	if !ok {
+		return nil, p
+	}
+	return st.keys, &Pipeline{stages: p.stages[1:], out: p.out}
+}
+
+// WithCoercions ép kiểu toán hạng trong các $match theo quy tắc của collection.
+// Document đưa vào Push cần được ép kiểu sẵn bằng Coercions.Doc.
+func (p *Pipeline) WithCoercions(c Coercions) {
+	if len(c) == 0 {
+		return
+	}
+	for _, st := range p.stages {
+		if m, ok := st.(*matchStage); ok {
+			m.filter = c.Filter(m.filter)
+		}
+	}
+}
+
+// WithCollation áp dụng collation cho so sánh chuỗi trong $match,
+// khóa nhóm của $group và thứ tự của $sort
+func (p *Pipeline) WithCollation(coll *Collation) {
+	for _, st := range p.stages {
+		switch t := st.(type) {
+		case *matchStage:
+			t.coll = coll
+		case *groupStage:
+			t.coll = coll
+		case *sortStage:
+			t.coll = coll
+		}
+	}
+}
+
+// WithLookup đặt nguồn đọc collection ngoài cho các stage $lookup
+func (p *Pipeline) WithLookup(fetch LookupFunc) {
+	for _, st := range p.stages {
+		if l, ok := st.(*lookupStage); ok {
+			l.fetch = fetch
+		}
+	}
+}
+
+// Err trả về lỗi đầu tiên của một stage (vd $lookup không đọc được collection ngoài).
+// Khi có lỗi, kết quả của pipeline không đầy đủ.
+func (p *Pipeline) Err() error {
+	for _, st := range p.stages {
+		if l, ok := st.(*lookupStage); ok && l.err != nil {
+			return l.err
+		}
+	}
+	return nil
+}
+
+// Push đưa một document nguồn qua pipeline
+func (p *Pipeline) Push(doc map[string]interface{}) {
+	p.pushAt(0, doc)
+}
+
+func (p *Pipeline) pushAt(i int, doc map[string]interface{}) {
+	if i == len(p.stages) {
+		p.out = append(p.out, doc)
+		return
+	}
+	p.stages[i].push(doc, func(d map[string]interface{}) { p.pushAt(i+1, d) })
+}
+
+// Result flush các stage (theo thứ tự) và trả về kết quả cuối
+func (p *Pipeline) Result() []map[string]interface{} {
+	for i, st := range p.stages {
+		next := i + 1
+		st.flush(func(d map[string]interface{}) { p.pushAt(next, d) })
+	}
+	return p.out
+}
+
+// --- $match ---
+
+type matchStage struct {
+	filter map[string]interface{}
+	coll   *Collation
+}
+
+func (s *matchStage) push(doc map[string]interface{}, emit func(map[string]interface{})) {
+	if MatchFilterWith(doc, s.filter, s.coll) {
+		emit(doc)
+	}
+}
+
+func (s *matchStage) flush(func(map[string]interface{})) {}
+
+// --- $group ---
+
+type accumulator struct {
+	name string
+	op   string // $sum, $avg, $min, $max, $count
+	expr interface{}
+}
+
+type groupState struct {
+	id    interface{}
+	sums  []float64
+	count []int
+	set   []bool // $min/$max đã có giá trị
+}
+
+type groupStage struct {
+	idExpr interface{}
+	accs   []accumulator
+	groups map[string]*groupState
+	order  []string // Thứ tự xuất hiện của group (kết quả ổn định)
+	coll   *Collation
+}
+
+func newGroupStage(arg interface{}) (*groupStage, error) {
+	spec, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("$group expects an object")
+	}
+	idExpr, ok := spec["_id"]
+	if !ok {
+		return nil, errors.New("$group requires an _id expression")
+	}
+	g := &groupStage{idExpr: idExpr, groups: make(map[string]*groupState)}
+
+	names := make([]string, 0, len(spec))
+	for name := range spec {
+		if name != "_id" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		accSpec, ok := spec[name].(map[string]interface{})
+		if !ok || len(accSpec) != 1 {
+			return nil, fmt.Errorf("field %q must be a single accumulator object", name)
+		}
+		for op, expr := range accSpec {
+			switch op {
+			case "$sum", "$avg", "$min", "$max", "$count":
+			default:
+				return nil, fmt.Errorf("unsupported accumulator %s", op)
+			}
+			g.accs = append(g.accs, accumulator{name: name, op: op, expr: expr})
+		}
+	}
+	return g, nil
+}
+
+func (g *groupStage) push(doc map[string]interface{}, _ func(map[string]interface{})) {
+	id := evalExpr(doc, g.idExpr)
+	// Với collation, "Hanoi" và "hanoi" thuộc cùng một nhóm
+	// (_id của nhóm là giá trị gặp đầu tiên)
+	keyBytes, _ := json.Marshal(g.coll.Value(id))
+	key := string(keyBytes)
+
+	st, ok := g.groups[key]
+	if !ok {
+		st = &groupState{
+			id:    id,
+			sums:  make([]float64, len(g.accs)),
+			count: make([]int, len(g.accs)),
+			set:   make([]bool, len(g.accs)),
+		}
+		g.groups[key] = st
+		g.order = append(g.order, key)
+	}
+
+	for i, acc := range g.accs {
+		if acc.op == "$count" {
+			st.count[i]++
+			continue
+		}
+		num, ok := toFloat(evalExpr(doc, acc.expr))
+		if !ok {
+			continue // Bỏ qua giá trị không phải số (giống MongoDB)
+		}
+		switch acc.op {
+		case "$sum", "$avg":
+			st.sums[i] += num
+			st.count[i]++
+		case "$min":
+			if !st.set[i] || num < st.sums[i] {
+				st.sums[i] = num
+			}
+			st.set[i] = true
+		case "$max":
+			if !st.set[i] || num > st.sums[i] {
+				st.sums[i] = num
+			}
+			st.set[i] = true
+		}
+	}
+}
+
+func (g *groupStage) flush(emit func(map[string]interface{})) {
+	for _, key := range g.order {
+		st := g.groups[key]
+		out := map[string]interface{}{"_id": st.id}
+		for i, acc := range g.accs {
+			switch acc.op {
+			case "$count":
+				out[acc.name] = st.count[i]
+			case "$sum":
+				out[acc.name] = st.sums[i]
+			case "$avg":
+				if st.count[i] == 0 {
+					out[acc.name] = nil
+				} else {
+					out[acc.name] = st.sums[i] / float64(st.count[i])
+				}
+			case "$min", "$max":
+				if st.set[i] {
+					out[acc.name] = st.sums[i]
+				} else {
+					out[acc.name] = nil
+				}
+			}
+		}
+		emit(out)
+	}
+	g.groups = nil
+	g.order = nil
+}
+
+// evalExpr tính giá trị của một biểu thức:
+// "$field" là tham chiếu field, object được tính từng field, còn lại là hằng số
+func evalExpr(doc map[string]interface{}, expr interface{}) interface{} {
+	switch t := expr.(type) {
+	case string:
+		if strings.HasPrefix(t, "$") {
+			return lookup(doc, t[1:])
+		}
+		return t
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			out[k] = evalExpr(doc, v)
+		}
+		return out
+	}
+	return expr
+}
+
+// --- $sort ---
+
+// SortKey là một field của thứ tự sắp xếp
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+type sortStage struct {
+	keys []SortKey
+	buf  []map[string]interface{}
+	coll *Collation
+}
+
+func newSortStage(arg interface{}) (*sortStage, error) {
+	keys, err := ParseSort(arg)
+	if err != nil {
+		return nil, err
+	}
+	return &sortStage{keys: keys}, nil
+}
+
+// ParseSort đọc đặc tả sắp xếp {"a": 1} hoặc [{"a": 1}, {"b": -1}]
+func ParseSort(arg interface{}) ([]SortKey, error) {
+	// Thứ tự các field trong JSON object không được giữ khi decode vào map,
+	// nên chỉ chấp nhận một field hoặc dạng mảng [{"a": 1}, {"b": -1}]
+	var specs []map[string]interface{}
+	switch t := arg.(type) {
+	case map[string]interface{}:
+		if len(t) != 1 {
+			return nil, errors.New(`$sort with several fields must be an array, e.g. [{"a": 1}, {"b": -1}]`)
+		}
+		specs = []map[string]interface{}{t}
+	case []interface{}:
+		for _, item := range t {
+			m, ok := item.(map[string]interface{})
+			if !ok || len(m) != 1 {
+				return nil, errors.New("$sort array items must be single-field objects")
+			}
+			specs = append(specs, m)
+		}
+	default:
+		return nil, errors.New("$sort expects an object or an array")
+	}
+
+	var keys []SortKey
+	for _, m := range specs {
+		for field, dir := range m {
+			d, ok := toFloat(dir)
+			if !ok || (d != 1 && d != -1) {
+				return nil, fmt.Errorf("sort direction for %q must be 1 or -1", field)
+			}
+			keys = append(keys, SortKey{Field: field, Desc: d < 0})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("$sort requires at least one field")
+	}
+	return keys, nil
+}
+
+func (s *sortStage) push(doc map[string]interface{}, _ func(map[string]interface{})) {
+	s.buf = append(s.buf, doc)
+}
+
+func (s *sortStage) flush(emit func(map[string]interface{})) {
+	SortDocs(s.buf, s.keys, s.coll)
+	for _, doc := range s.buf {
+		emit(doc)
+	}
+	s.buf = nil
+}
+
+// SortDocs sắp xếp (ổn định) các document theo keys, chuỗi theo collation
+func SortDocs(docs []map[string]interface{}, keys []SortKey, coll *Collation) {
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, k := range keys {
+			c := compareValues(lookup(docs[i], k.Field), lookup(docs[j], k.Field), coll)
+			if c == 0 {
+				continue
+			}
+			if k.Desc {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+}
+
+// CompareValues so sánh hai giá trị JSON theo thứ tự của $sort
+func CompareValues(a, b interface{}) int {
+	return compareValues(a, b, nil)
+}
+
+// compareValues so sánh hai giá trị JSON (chuỗi theo collation).
+// Khác kiểu: null < number < string < bool (giống thứ tự của index).
+func compareValues(a, b interface{}, coll *Collation) int {
+	return Compare(a, b, coll)
+}
@@ -0,0 +1,211 @@
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Các kiểu đích của quy tắc ép kiểu (schema-on-read)
+const (
+	CoerceNumber = "number" // "12.5" -> 12.5
+	CoerceString = "string" // 12.5 -> "12.5"
+	CoerceBool   = "bool"   // "true"/"1" -> true
+	CoerceDate   = "date"   // "2024-01-31T10:00:00Z" -> epoch milliseconds
+)
+
+// ValidCoercionType kiểm tra tên kiểu đích
+func ValidCoercionType(t string) bool {
+	switch t {
+	case CoerceNumber, CoerceString, CoerceBool, CoerceDate:
+		return true
+	}
+	return false
+}
+
+// Coercions ánh xạ field (có thể có dấu chấm) -> kiểu đích.
+// Quy tắc chỉ áp dụng khi đọc (lọc, sắp xếp, gom nhóm);
+// dữ liệu lưu trên đĩa không bị thay đổi.
+type Coercions map[string]string
+
+// Doc trả về document với các field đã được ép kiểu.
+// Nếu không có giá trị nào đổi, trả về chính doc (không sao chép).
+func (c Coercions) Doc(doc map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	for field, typ := range c {
+		v, ok := GetPath(doc, field)
+		if !ok {
+			continue
+		}
+		nv, changed := coerceValue(v, typ)
+		if !changed {
+			continue
+		}
+		if out == nil {
+			out = deepCopy(doc).(map[string]interface{})
+		}
+		setPath(out, field, nv)
+	}
+	if out == nil {
+		return doc
+	}
+	return out
+}
+
+// Validate kiểm tra các field có quy tắc: giá trị phải đã đúng kiểu đích
+// hoặc ép được sang kiểu đó (dùng khi nạp dữ liệu, xem _importJob)
+func (c Coercions) Validate(doc map[string]interface{}) error {
+	fields := make([]string, 0, len(c))
+	for field := range c {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		v, ok := GetPath(doc, field)
+		if !ok || v == nil || hasCoercionType(v, c[field]) {
+			continue
+		}
+		if _, changed := coerceValue(v, c[field]); !changed {
+			return fmt.Errorf("field %s: %v is not a valid %s", field, v, c[field])
+		}
+	}
+	return nil
+}
+
+// hasCoercionType: v đã mang kiểu typ (ngày lưu dạng epoch milliseconds)
+func hasCoercionType(v interface{}, typ string) bool {
+	switch v.(type) {
+	case float64:
+		return typ == CoerceNumber || typ == CoerceDate
+	case string:
+		return typ == CoerceString
+	case bool:
+		return typ == CoerceBool
+	}
+	return false
+}
+
+// Filter ép kiểu các toán hạng trong filter cho các field có quy tắc,
+// để {"createdAt": {"$gt": "2024-01-01"}} so sánh được với ngày đã ép kiểu
+func (c Coercions) Filter(filter map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(filter))
+	for k, v := range filter {
+		switch strings.ToLower(k) {
+		case "$and", "$or", "$nor":
+			if subs, ok := subFilters(v); ok {
+				arr := make([]interface{}, 0, len(subs))
+				for _, sub := range subs {
+					arr = append(arr, c.Filter(sub))
+				}
+				out[k] = arr
+				continue
+			}
+		case "$not":
+			if sub, ok := v.(map[string]interface{}); ok {
+				out[k] = c.Filter(sub)
+				continue
+			}
+		}
+		typ, ok := c[k]
+		if !ok {
+			out[k] = v
+			continue
+		}
+		out[k] = coerceCondition(v, typ)
+	}
+	return out
+}
+
+func coerceCondition(cond interface{}, typ string) interface{} {
+	switch t := cond.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for op, arg := range t {
+			switch strings.ToLower(op) {
+			case "$not":
+				out[op] = coerceCondition(arg, typ)
+			case "$exists", "$regex", "$options", "$size", "$type":
+				out[op] = arg
+			case "$elemmatch":
+				// Filter trên phần tử dạng object không dùng quy tắc của field này
+				if m, ok := arg.(map[string]interface{}); ok && !elemMatchOnValue(m) {
+					out[op] = arg
+					continue
+				}
+				out[op] = coerceCondition(arg, typ)
+			default:
+				out[op] = coerceCondition(arg, typ)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, item := range t {
+			out[i] = coerceCondition(item, typ)
+		}
+		return out
+	}
+	if s, ok := cond.(string); ok && typ == CoerceDate {
+		// Mốc tương đối trong filter: {"createdAt": {"$gt": "now-24h"}}
+		if ms, ok, err := relativeDate(s); ok && err == nil {
+			return ms
+		}
+	}
+	v, _ := coerceValue(cond, typ)
+	return v
+}
+
+// coerceValue chuyển v sang kiểu typ; giá trị không chuyển được giữ nguyên
+func coerceValue(v interface{}, typ string) (interface{}, bool) {
+	switch typ {
+	case CoerceNumber:
+		if s, ok := v.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return f, true
+			}
+		}
+	case CoerceString:
+		switch t := v.(type) {
+		case float64:
+			return strconv.FormatFloat(t, 'f', -1, 64), true
+		case bool:
+			return strconv.FormatBool(t), true
+		}
+	case CoerceBool:
+		switch t := v.(type) {
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(t)); err == nil {
+				return b, true
+			}
+		case float64:
+			return t != 0, true
+		}
+	case CoerceDate:
+		if s, ok := v.(string); ok {
+			if ms, ok := parseDate(s); ok {
+				return ms, true
+			}
+		}
+	}
+	return v, false
+}
+
+var dateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseDate đọc ngày ISO-8601 và trả về epoch milliseconds (UTC nếu không có múi giờ)
+func parseDate(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return float64(t.UnixMilli()), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Collation điều khiển cách so sánh chuỗi: so sánh bằng, thứ tự sắp xếp
+// và key của index. nil nghĩa là so sánh theo byte (mặc định).
+type Collation struct {
+	// Locale: "" hoặc "simple" = thứ tự byte; mã ngôn ngữ (vd "vi", "en")
+	// = thứ tự chữ cái: so chữ gốc trước, rồi dấu, rồi hoa/thường
+	// (a < á < B < b́ ... thay vì "B" < "a" < "á").
+	// Chưa có bảng riêng cho từng ngôn ngữ: mọi locale dùng chung thứ tự này.
+	Locale string `json:"locale,omitempty"`
+	// Strength: 1 = bỏ qua dấu và hoa/thường, 2 = bỏ qua hoa/thường,
+	// 3 (mặc định) = phân biệt cả hai
+	Strength int `json:"strength,omitempty"`
+}
+
+// ParseCollation đọc collation dạng JSON, vd {"locale":"vi","strength":2}.
+// Trả về nil nếu collation tương đương so sánh theo byte.
+func ParseCollation(raw []byte) (*Collation, error) {
+	var c Collation
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("%w: collation must be an object like {\"locale\":\"vi\",\"strength\":2}", ErrInvalidFilter)
+	}
+	return c.normalize()
+}
+
+// normalize kiểm tra và chuẩn hóa collation
+func (c Collation) normalize() (*Collation, error) {
+	if c.Strength == 0 {
+		c.Strength = 3
+	}
+	if c.Strength < 1 || c.Strength > 3 {
+		return nil, fmt.Errorf("%w: collation strength must be 1, 2 or 3", ErrInvalidFilter)
+	}
+	c.Locale = strings.ToLower(strings.TrimSpace(c.Locale))
+	if c.Locale == "simple" {
+		c.Locale = ""
+	}
+	if c.Locale == "" && c.Strength == 3 {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// SameCollation so sánh hai collation (nil = theo byte)
+func SameCollation(a, b *Collation) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// String dùng khi hiển thị (CLI, log)
+func (c *Collation) String() string {
+	if c == nil {
+		return "simple"
+	}
+	locale := c.Locale
+	if locale == "" {
+		locale = "simple"
+	}
+	return fmt.Sprintf("%s/%d", locale, c.Strength)
+}
+
+// Key trả về khóa so sánh của s: hai chuỗi bằng nhau theo collation
+// khi và chỉ khi key bằng nhau, và thứ tự byte của key là thứ tự collation.
+func (c *Collation) Key(s string) string {
+	if c == nil {
+		return s
+	}
+	if c.Locale == "" {
+		switch c.Strength {
+		case 1:
+			return foldAccents(strings.ToLower(s))
+		case 2:
+			return strings.ToLower(s)
+		}
+		return s
+	}
+
+	// Key nhiều cấp: chữ gốc | dấu | hoa/thường, phân tách bởi \x01
+	// (trọng số luôn >= \x02 nên cấp trước quyết định thứ tự)
+	var primary, accents, cases strings.Builder
+	for _, r := range s {
+		lower := unicode.ToLower(r)
+		base, accent := baseLetter(lower)
+		primary.WriteRune(base)
+		if c.Strength >= 2 {
+			accents.WriteByte(byte(2 + accent))
+		}
+		if c.Strength == 3 {
+			if lower != r {
+				cases.WriteByte(3)
+			} else {
+				cases.WriteByte(2)
+			}
+		}
+	}
+	key := primary.String()
+	if c.Strength >= 2 {
+		key += "\x01" + accents.String()
+	}
+	if c.Strength == 3 {
+		key += "\x01" + cases.String()
+	}
+	return key
+}
+
+// Value áp dụng Key cho giá trị chuỗi; kiểu khác giữ nguyên
+func (c *Collation) Value(v interface{}) interface{} {
+	if s, ok := v.(string); ok && c != nil {
+		return c.Key(s)
+	}
+	return v
+}
+
+// Chữ cái Latin có dấu (gồm cả tiếng Việt), nhóm theo chữ gốc.
+// Vị trí trong chuỗi + 1 là trọng số dấu (0 = không dấu).
+var accentGroups = map[rune]string{
+	'a': "àáâãäåāăąǎạảấầẩẫậắằẳẵặ",
+	'c': "çćĉċč",
+	'd': "ďđ",
+	'e': "èéêëēĕėęěẹẻẽếềểễệ",
+	'g': "ĝğġģ",
+	'h': "ĥħ",
+	'i': "ìíîïĩīĭįıǐỉị",
+	'j': "ĵ",
+	'k': "ķ",
+	'l': "ĺļľŀł",
+	'n': "ñńņňŉ",
+	'o': "òóôõöøōŏőơǒọỏốồổỗộớờởỡợ",
+	'r': "ŕŗř",
+	's': "śŝşšș",
+	't': "ţťŧț",
+	'u': "ùúûüũūŭůűųưǔụủứừửữự",
+	'w': "ŵ",
+	'y': "ýÿŷỳỵỷỹ",
+	'z': "źżž",
+}
+
+// accentIndex: rune có dấu -> (chữ gốc, trọng số dấu)
+var accentIndex = func() map[rune][2]int {
+	m := make(map[rune][2]int)
+	for base, group := range accentGroups {
+		i := 0
+		for _, r := range group {
+			i++
+			m[r] = [2]int{int(base), i}
+		}
+	}
+	return m
+}()
+
+// baseLetter tách chữ thường r thành chữ gốc và trọng số dấu
+func baseLetter(r rune) (rune, int) {
+	if e, ok := accentIndex[r]; ok {
+		return rune(e[0]), e[1]
+	}
+	return r, 0
+}
+
+// foldAccents bỏ dấu của các chữ cái trong s (s đã là chữ thường)
+func foldAccents(s string) string {
+	return strings.Map(func(r rune) rune {
+		base, _ := baseLetter(r)
+		return base
+	}, s)
+}
@@ -0,0 +1,203 @@
+package query
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// Lớp so sánh chuẩn cho giá trị JSON. Cùng một số có thể đến dưới nhiều dạng
+// (float64 từ json.Unmarshal, json.Number khi decoder dùng UseNumber, int/int64
+// từ code Go), nên filter, sort và index đều so sánh qua đây thay vì so kiểu Go.
+//
+// Thứ tự giữa các kiểu: null < number < string < bool < object < array.
+const (
+	rankNull   = 0
+	rankNumber = 2
+	rankString = 3
+	rankBool   = 5
+	rankObject = 7
+	rankArray  = 8
+	rankOther  = 9
+)
+
+// number là một số ở dạng chuẩn: số nguyên được giữ chính xác trong i
+// (để 2^53+1 không bị làm tròn khi so với số nguyên khác), còn lại trong f
+type number struct {
+	i     int64
+	f     float64
+	isInt bool
+}
+
+func (n number) float() float64 {
+	if n.isInt {
+		return float64(n.i)
+	}
+	return n.f
+}
+
+func (n number) cmp(o number) int {
+	if n.isInt && o.isInt {
+		switch {
+		case n.i < o.i:
+			return -1
+		case n.i > o.i:
+			return 1
+		}
+		return 0
+	}
+	a, b := n.float(), o.float()
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// toNumber đọc mọi kiểu số Go/JSON về dạng chuẩn
+func toNumber(v interface{}) (number, bool) {
+	switch t := v.(type) {
+	case float64:
+		return number{f: t}, true
+	case float32:
+		return number{f: float64(t)}, true
+	case int:
+		return number{i: int64(t), isInt: true}, true
+	case int8:
+		return number{i: int64(t), isInt: true}, true
+	case int16:
+		return number{i: int64(t), isInt: true}, true
+	case int32:
+		return number{i: int64(t), isInt: true}, true
+	case int64:
+		return number{i: t, isInt: true}, true
+	case uint:
+		return uintNumber(uint64(t)), true
+	case uint8:
+		return number{i: int64(t), isInt: true}, true
+	case uint16:
+		return number{i: int64(t), isInt: true}, true
+	case uint32:
+		return number{i: int64(t), isInt: true}, true
+	case uint64:
+		return uintNumber(t), true
+	case json.Number:
+		if i, err := t.Int64(); err == nil {
+			return number{i: i, isInt: true}, true
+		}
+		if f, err := t.Float64(); err == nil {
+			return number{f: f}, true
+		}
+	}
+	return number{}, false
+}
+
+func uintNumber(u uint64) number {
+	if u > math.MaxInt64 {
+		return number{f: float64(u)}
+	}
+	return number{i: int64(u), isInt: true}
+}
+
+// Normalize đưa một giá trị về dạng chuẩn để so sánh/mã hóa:
+// mọi kiểu số thành float64, các kiểu khác giữ nguyên
+func Normalize(v interface{}) interface{} {
+	if n, ok := toNumber(v); ok {
+		return n.float()
+	}
+	return v
+}
+
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return rankNull
+	case string:
+		return rankString
+	case bool:
+		return rankBool
+	case map[string]interface{}:
+		return rankObject
+	case []interface{}:
+		return rankArray
+	}
+	if _, ok := toNumber(v); ok {
+		return rankNumber
+	}
+	return rankOther
+}
+
+// Equal so sánh bằng theo giá trị: 1200 (float64), json.Number("1200")
+// và int64(1200) là bằng nhau; object/array được so sâu
+func Equal(a, b interface{}) bool {
+	return Compare(a, b, nil) == 0
+}
+
+// Compare so sánh hai giá trị JSON theo thứ tự chuẩn (chuỗi theo collation)
+func Compare(a, b interface{}, coll *Collation) int {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1
+		}
+		return 1
+	}
+	switch ra {
+	case rankNumber:
+		na, _ := toNumber(a)
+		nb, _ := toNumber(b)
+		return na.cmp(nb)
+	case rankString:
+		return strings.Compare(coll.Key(a.(string)), coll.Key(b.(string)))
+	case rankBool:
+		va, vb := a.(bool), b.(bool)
+		if va == vb {
+			return 0
+		}
+		if !va {
+			return -1
+		}
+		return 1
+	case rankArray:
+		return compareArrays(a.([]interface{}), b.([]interface{}), coll)
+	case rankObject:
+		return compareObjects(a.(map[string]interface{}), b.(map[string]interface{}), coll)
+	}
+	return 0
+}
+
+// compareArrays so từng phần tử, mảng ngắn hơn đứng trước
+func compareArrays(a, b []interface{}, coll *Collation) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := Compare(a[i], b[i], coll); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+// compareObjects so theo các cặp (key, value) đã sắp theo key
+func compareObjects(a, b map[string]interface{}, coll *Collation) int {
+	ka, kb := sortedKeys(a), sortedKeys(b)
+	for i := 0; i < len(ka) && i < len(kb); i++ {
+		if c := strings.Compare(ka[i], kb[i]); c != 0 {
+			return c
+		}
+		if c := Compare(a[ka[i]], b[kb[i]], coll); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(ka), len(kb))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Toán tử so sánh ngày: {"createdAt": {"$dateGt": "now-24h"}}.
+// Hai vế được chuyển về epoch milliseconds trước khi so sánh, nên field
+// có thể lưu chuỗi RFC3339/ISO-8601 hoặc số epoch millis.
+var dateOps = map[string]func(c int) bool{
+	"$dategt":  func(c int) bool { return c > 0 },
+	"$dategte": func(c int) bool { return c >= 0 },
+	"$datelt":  func(c int) bool { return c < 0 },
+	"$datelte": func(c int) bool { return c <= 0 },
+}
+
+// matchDate so sánh val với mốc thời gian arg theo toán tử op
+func matchDate(val, arg interface{}, op string) bool {
+	a, ok := toDateMillis(val)
+	if !ok {
+		return false
+	}
+	b, ok := dateOperand(arg)
+	if !ok {
+		return false
+	}
+	c := 0
+	switch {
+	case a < b:
+		c = -1
+	case a > b:
+		c = 1
+	}
+	return dateOps[op](c)
+}
+
+// toDateMillis đọc giá trị ngày lưu trong document
+// (số epoch millis hoặc chuỗi ngày ISO-8601)
+func toDateMillis(v interface{}) (float64, bool) {
+	if n, ok := toFloat(v); ok {
+		return n, true
+	}
+	if s, ok := v.(string); ok {
+		return parseDate(s)
+	}
+	return 0, false
+}
+
+// dateOperand đọc mốc thời gian trong filter: giống toDateMillis,
+// cộng thêm biểu thức tương đối "now", "now-24h", "now+7d"
+func dateOperand(v interface{}) (float64, bool) {
+	if s, ok := v.(string); ok {
+		if ms, ok, err := relativeDate(s); ok {
+			return ms, err == nil
+		}
+	}
+	return toDateMillis(v)
+}
+
+// relativeDate phân tích "now[+-]<n><đơn vị>" với đơn vị ms, s, m, h, d, w.
+// ok = false nếu s không bắt đầu bằng "now" (không phải biểu thức tương đối).
+func relativeDate(s string) (ms float64, ok bool, err error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToLower(s), "now") {
+		return 0, false, nil
+	}
+	rest := strings.TrimSpace(s[3:])
+	rest = strings.TrimSuffix(rest, "()") // chấp nhận cả "now()"
+	now := time.Now()
+	if rest == "" {
+		return float64(now.UnixMilli()), true, nil
+	}
+
+	sign := time.Duration(1)
+	switch rest[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return 0, true, fmt.Errorf("invalid relative date %q", s)
+	}
+	d, err := parseDateOffset(strings.TrimSpace(rest[1:]))
+	if err != nil {
+		return 0, true, fmt.Errorf("invalid relative date %q: %v", s, err)
+	}
+	return float64(now.Add(sign * d).UnixMilli()), true, nil
+}
+
+func parseDateOffset(s string) (time.Duration, error) {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		// "ms" phải đứng trước "s" và "m"
+		{"ms", time.Millisecond},
+		{"s", time.Second},
+		{"m", time.Minute},
+		{"h", time.Hour},
+		{"d", 24 * time.Hour},
+		{"w", 7 * 24 * time.Hour},
+	}
+	for _, u := range units {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSuffix(s, u.suffix), 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("expected a positive amount before %q", u.suffix)
+		}
+		return time.Duration(n * float64(u.unit)), nil
+	}
+	return 0, fmt.Errorf("missing unit (ms, s, m, h, d, w)")
+}
+
+// validateDateOperand dùng trong ValidateFilter
+func validateDateOperand(op, field string, arg interface{}) error {
+	if s, ok := arg.(string); ok {
+		if _, ok, err := relativeDate(s); ok {
+			if err != nil {
+				return fmt.Errorf("%w: %s on %q: %v", ErrInvalidFilter, op, field, err)
+			}
+			return nil
+		}
+	}
+	if _, ok := toDateMillis(arg); !ok {
+		return fmt.Errorf("%w: %s on %q expects a date (RFC3339, epoch millis or now-24h)", ErrInvalidFilter, op, field)
+	}
+	return nil
+}
@@ -0,0 +1,522 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidFilter được trả về khi filter không hợp lệ (vd: $expr sai cú pháp)
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Giới hạn để biểu thức không thể làm treo/tràn stack server
+const (
+	maxExprLen   = 1024
+	maxExprDepth = 200
+	maxExprCache = 256
+)
+
+// Expr là một biểu thức $expr đã được biên dịch, ví dụ:
+//
+//	doc.price * doc.qty > 1000 && (doc.status == "paid" || !doc.archived)
+//
+// Ngôn ngữ chỉ gồm literal (số, chuỗi, true/false/null), truy cập field
+// (doc.a.b), toán tử số học + - * / %, so sánh == != < <= > >=,
+// logic && || ! và ngoặc. Không có vòng lặp, gán hay gọi hàm nên việc
+// đánh giá luôn kết thúc và không có tác dụng phụ.
+type Expr struct {
+	root exprNode
+}
+
+var exprCache sync.Map // string -> *Expr
+
+// CompileExpr phân tích cú pháp biểu thức
+func CompileExpr(src string) (*Expr, error) {
+	if cached, ok := exprCache.Load(src); ok {
+		return cached.(*Expr), nil
+	}
+	if len(src) > maxExprLen {
+		return nil, fmt.Errorf("%w: $expr longer than %d characters", ErrInvalidFilter, maxExprLen)
+	}
+	toks, err := tokenizeExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: $expr: %v", ErrInvalidFilter, err)
+	}
+	p := &exprParser{toks: toks}
+	root, err := p.parseOr(0)
+	if err == nil && p.pos < len(p.toks) {
+		err = fmt.Errorf("unexpected %q", p.toks[p.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: $expr: %v", ErrInvalidFilter, err)
+	}
+
+	e := &Expr{root: root}
+	if syncMapLen(&exprCache) < maxExprCache {
+		exprCache.Store(src, e)
+	}
+	return e, nil
+}
+
+func syncMapLen(m *sync.Map) int {
+	n := 0
+	m.Range(func(_, _ interface{}) bool { n++; return true })
+	return n
+}
+
+// Eval đánh giá biểu thức trên document và trả về giá trị chân lý
+func (e *Expr) Eval(doc map[string]interface{}) bool {
+	return truthy(e.root.eval(doc))
+}
+
+// ValidateFilter kiểm tra các phần của filter cần biên dịch trước
+// ($expr, $regex) và kiểu tham số của toán tử field,
+// kể cả bên trong $and/$or/$nor/$not
+func ValidateFilter(filter map[string]interface{}) error {
+	for k, v := range filter {
+		switch strings.ToLower(k) {
+		case "$expr":
+			src, ok := v.(string)
+			if !ok {
+				return fmt.Errorf("%w: $expr must be a string", ErrInvalidFilter)
+			}
+			if _, err := CompileExpr(src); err != nil {
+				return err
+			}
+		case "$text":
+			if _, err := TextSearch(v); err != nil {
+				return err
+			}
+		case "$and", "$or", "$nor":
+			subs, ok := subFilters(v)
+			if !ok {
+				return fmt.Errorf("%w: %s expects a non-empty array of filters", ErrInvalidFilter, k)
+			}
+			for _, sub := range subs {
+				if err := ValidateFilter(sub); err != nil {
+					return err
+				}
+			}
+		case "$not":
+			if sub, ok := v.(map[string]interface{}); ok {
+				if err := ValidateFilter(sub); err != nil {
+					return err
+				}
+			}
+		default:
+			if err := validateCondition(k, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateCondition kiểm tra map toán tử của một field
+func validateCondition(field string, cond interface{}) error {
+	ops, ok := cond.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for op, arg := range ops {
+		if !strings.HasPrefix(op, "$") {
+			continue // So sánh bằng với object con
+		}
+		switch strings.ToLower(op) {
+		case "$gt", "$gte", "$lt", "$lte", "$ne", "$options":
+		case "$in", "$nin":
+			if _, ok := arg.([]interface{}); !ok {
+				return fmt.Errorf("%w: %s on %q expects an array", ErrInvalidFilter, op, field)
+			}
+		case "$exists":
+			if _, ok := arg.(bool); !ok {
+				return fmt.Errorf("%w: $exists on %q expects true or false", ErrInvalidFilter, field)
+			}
+		case "$dategt", "$dategte", "$datelt", "$datelte":
+			if err := validateDateOperand(op, field, arg); err != nil {
+				return err
+			}
+		case "$regex":
+			if _, err := compileRegex(arg, ops["$options"]); err != nil {
+				return err
+			}
+		case "$size":
+			if n, ok := toNumber(arg); !ok || n.float() < 0 || n.float() != math.Trunc(n.float()) {
+				return fmt.Errorf("%w: $size on %q expects a non-negative integer", ErrInvalidFilter, field)
+			}
+		case "$all":
+			items, ok := arg.([]interface{})
+			if !ok {
+				return fmt.Errorf("%w: $all on %q expects an array", ErrInvalidFilter, field)
+			}
+			for _, item := range items {
+				if isOperatorMap(item) {
+					if err := validateCondition(field, item); err != nil {
+						return err
+					}
+				}
+			}
+		case "$elemmatch":
+			cond, ok := arg.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%w: $elemMatch on %q expects an object", ErrInvalidFilter, field)
+			}
+			if elemMatchOnValue(cond) {
+				if err := validateCondition(field, cond); err != nil {
+					return err
+				}
+			} else if err := ValidateFilter(cond); err != nil {
+				return err
+			}
+		case "$not":
+			if err := validateCondition(field, arg); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("%w: unsupported operator %s on %q", ErrInvalidFilter, op, field)
+		}
+	}
+	return nil
+}
+
+// matchExpr dùng trong MatchFilter; biểu thức lỗi không khớp document nào
+func matchExpr(doc map[string]interface{}, v interface{}) bool {
+	src, ok := v.(string)
+	if !ok {
+		return false
+	}
+	e, err := CompileExpr(src)
+	if err != nil {
+		return false
+	}
+	return e.Eval(doc)
+}
+
+// --- Tokenizer ---
+
+type tokKind int
+
+const (
+	tokNum tokKind = iota
+	tokStr
+	tokIdent
+	tokOp
+)
+
+type exprToken struct {
+	kind tokKind
+	text string
+	num  float64
+}
+
+func tokenizeExpr(src string) ([]exprToken, error) {
+	toks := make([]exprToken, 0, 16)
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c >= '0' && c <= '9' || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			j := i
+			for j < len(src) && (src[j] >= '0' && src[j] <= '9' || src[j] == '.' || src[j] == 'e' || src[j] == 'E' ||
+				((src[j] == '+' || src[j] == '-') && (src[j-1] == 'e' || src[j-1] == 'E'))) {
+				j++
+			}
+			f, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad number %q", src[i:j])
+			}
+			toks = append(toks, exprToken{kind: tokNum, text: src[i:j], num: f})
+			i = j
+		case c == '"' || c == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(src) && src[j] != c; j++ {
+				if src[j] == '\\' && j+1 < len(src) {
+					j++
+				}
+				sb.WriteByte(src[j])
+			}
+			if j >= len(src) {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, exprToken{kind: tokStr, text: sb.String()})
+			i = j + 1
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i
+			for j < len(src) && (src[j] == '_' || src[j] == '.' || src[j] == '$' ||
+				src[j] >= 'a' && src[j] <= 'z' || src[j] >= 'A' && src[j] <= 'Z' || src[j] >= '0' && src[j] <= '9') {
+				j++
+			}
+			toks = append(toks, exprToken{kind: tokIdent, text: src[i:j]})
+			i = j
+		default:
+			if i+1 < len(src) {
+				two := src[i : i+2]
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					toks = append(toks, exprToken{kind: tokOp, text: two})
+					i += 2
+					continue
+				}
+			}
+			if strings.IndexByte("+-*/%<>!()", c) < 0 {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+			toks = append(toks, exprToken{kind: tokOp, text: string(c)})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+// --- Parser (recursive descent) ---
+
+type exprParser struct {
+	toks []exprToken
+	pos  int
+}
+
+func (p *exprParser) peekOp(ops ...string) (string, bool) {
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.toks[p.pos].text == op {
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) binary(depth int, next func(int) (exprNode, error), ops ...string) (exprNode, error) {
+	if depth > maxExprDepth {
+		return nil, errors.New("expression nested too deeply")
+	}
+	left, err := next(depth + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.peekOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		p.pos++
+		right, err := next(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseOr(d int) (exprNode, error) {
+	return p.binary(d, p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd(d int) (exprNode, error) {
+	return p.binary(d, p.parseCompare, "&&")
+}
+
+func (p *exprParser) parseCompare(d int) (exprNode, error) {
+	return p.binary(d, p.parseAdd, "==", "!=", "<=", ">=", "<", ">")
+}
+
+func (p *exprParser) parseAdd(d int) (exprNode, error) {
+	return p.binary(d, p.parseMul, "+", "-")
+}
+
+func (p *exprParser) parseMul(d int) (exprNode, error) {
+	return p.binary(d, p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary(d int) (exprNode, error) {
+	if d > maxExprDepth {
+		return nil, errors.New("expression nested too deeply")
+	}
+	if op, ok := p.peekOp("!", "-"); ok {
+		p.pos++
+		operand, err := p.parseUnary(d + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary(d)
+}
+
+func (p *exprParser) parsePrimary(d int) (exprNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, errors.New("unexpected end of expression")
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokNum:
+		return &literalNode{v: t.num}, nil
+	case tokStr:
+		return &literalNode{v: t.text}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{v: true}, nil
+		case "false":
+			return &literalNode{v: false}, nil
+		case "null":
+			return &literalNode{v: nil}, nil
+		}
+		if t.text == "doc" {
+			return &fieldNode{}, nil
+		}
+		if !strings.HasPrefix(t.text, "doc.") {
+			return nil, fmt.Errorf("unknown identifier %q (fields are accessed as doc.<field>)", t.text)
+		}
+		path := t.text[len("doc."):]
+		for _, part := range strings.Split(path, ".") {
+			if part == "" {
+				return nil, fmt.Errorf("bad field path %q", t.text)
+			}
+		}
+		return &fieldNode{path: path}, nil
+	case tokOp:
+		if t.text == "(" {
+			inner, err := p.parseOr(d + 1)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.peekOp(")"); !ok {
+				return nil, errors.New("missing )")
+			}
+			p.pos++
+			return inner, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// --- AST ---
+
+type exprNode interface {
+	eval(doc map[string]interface{}) interface{}
+}
+
+type literalNode struct{ v interface{} }
+
+func (n *literalNode) eval(map[string]interface{}) interface{} { return n.v }
+
+// fieldNode đọc doc.<path>; path rỗng là chính document
+type fieldNode struct{ path string }
+
+func (n *fieldNode) eval(doc map[string]interface{}) interface{} {
+	if n.path == "" {
+		return doc
+	}
+	return lookup(doc, n.path)
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(doc map[string]interface{}) interface{} {
+	v := n.operand.eval(doc)
+	if n.op == "!" {
+		return !truthy(v)
+	}
+	if f, ok := toFloat(v); ok {
+		return -f
+	}
+	return nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(doc map[string]interface{}) interface{} {
+	// && và || đánh giá ngắn mạch
+	switch n.op {
+	case "&&":
+		return truthy(n.left.eval(doc)) && truthy(n.right.eval(doc))
+	case "||":
+		return truthy(n.left.eval(doc)) || truthy(n.right.eval(doc))
+	}
+
+	l, r := n.left.eval(doc), n.right.eval(doc)
+	switch n.op {
+	case "==":
+		return equals(l, r)
+	case "!=":
+		return !equals(l, r)
+	case "<", "<=", ">", ">=":
+		// Chỉ so sánh cùng kiểu (số với số, chuỗi với chuỗi)
+		if typeRank(l) != typeRank(r) || l == nil {
+			return false
+		}
+		c := compareValues(l, r, nil)
+		switch n.op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}
+
+	if n.op == "+" {
+		if ls, ok := l.(string); ok {
+			if rs, ok := r.(string); ok {
+				return ls + rs
+			}
+		}
+	}
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	if !lok || !rok {
+		return nil // Phép toán trên giá trị không phải số -> null
+	}
+	switch n.op {
+	case "+":
+		return lf + rf
+	case "-":
+		return lf - rf
+	case "*":
+		return lf * rf
+	case "/":
+		if rf == 0 {
+			return nil
+		}
+		return lf / rf
+	case "%":
+		if int64(rf) == 0 {
+			return nil
+		}
+		return float64(int64(lf) % int64(rf))
+	}
+	return nil
+}
+
+func truthy(v interface{}) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return t
+	case string:
+		return t != ""
+	}
+	if n, ok := toFloat(v); ok {
+		return n != 0
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package query
+
+import (
+	"errors"
+	"strings"
+)
+
+// LookupFunc đọc các document theo _id trong một collection khác (cho $lookup).
+// Kết quả không chứa các _id không tồn tại.
+type LookupFunc func(collection string, ids []string) (map[string]map[string]interface{}, error)
+
+// Số document được gom lại trước mỗi lần đọc collection ngoài
+const lookupBatchSize = 100
+
+// --- $lookup ---
+// {"$lookup": {"from": "customers", "localField": "customerId", "foreignField": "_id", "as": "customer"}}
+// Join theo key: foreignField phải là _id. localField là một _id hoặc mảng _id;
+// "as" luôn nhận một mảng (rỗng nếu không tìm thấy), giống MongoDB.
+
+type lookupStage struct {
+	from       string
+	localField string
+	as         string
+	fetch      LookupFunc
+	buf        []map[string]interface{}
+	err        error
+}
+
+func newLookupStage(arg interface{}) (*lookupStage, error) {
+	spec, ok := arg.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("$lookup expects an object")
+	}
+	field := func(name string) (string, error) {
+		s, ok := spec[name].(string)
+		if !ok || s == "" {
+			return "", errors.New("$lookup requires a string " + name)
+		}
+		return s, nil
+	}
+	st := &lookupStage{}
+	var err error
+	if st.from, err = field("from"); err != nil {
+		return nil, err
+	}
+	if strings.Contains(st.from, ":") {
+		return nil, errors.New("$lookup: invalid collection name " + st.from)
+	}
+	if st.localField, err = field("localField"); err != nil {
+		return nil, err
+	}
+	if st.as, err = field("as"); err != nil {
+		return nil, err
+	}
+	foreign, err := field("foreignField")
+	if err != nil {
+		return nil, err
+	}
+	if foreign != "_id" {
+		return nil, errors.New("$lookup joins by key: foreignField must be _id")
+	}
+	for name := range spec {
+		switch name {
+		case "from", "localField", "foreignField", "as":
+		default:
+			return nil, errors.New("$lookup: unknown option " + name)
+		}
+	}
+	return st, nil
+}
+
+func (s *lookupStage) push(doc map[string]interface{}, emit func(map[string]interface{})) {
+	s.buf = append(s.buf, doc)
+	if len(s.buf) >= lookupBatchSize {
+		s.resolve(emit)
+	}
+}
+
+func (s *lookupStage) flush(emit func(map[string]interface{})) {
+	s.resolve(emit)
+}
+
+// resolve đọc các document ngoài của cả lô trong một lần gọi fetch
+func (s *lookupStage) resolve(emit func(map[string]interface{})) {
+	docs := s.buf
+	s.buf = nil
+	if len(docs) == 0 || s.err != nil {
+		return
+	}
+	if s.fetch == nil {
+		s.err = errors.New("$lookup is not available here")
+		return
+	}
+
+	ids := make([]string, 0, len(docs))
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		for _, id := range localIDs(lookup(doc, s.localField)) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	var foreign map[string]map[string]interface{}
+	if len(ids) > 0 {
+		var err error
+		if foreign, err = s.fetch(s.from, ids); err != nil {
+			s.err = err
+			return
+		}
+	}
+
+	for _, doc := range docs {
+		matched := make([]interface{}, 0, 1)
+		for _, id := range localIDs(lookup(doc, s.localField)) {
+			if f, ok := foreign[id]; ok {
+				matched = append(matched, f)
+			}
+		}
+		// Chỉ lỗi khi "as" đi qua một giá trị không phải object: giữ nguyên document
+		_ = setPath(doc, s.as, matched)
+		emit(doc)
+	}
+}
+
+// localIDs trả về các _id được tham chiếu bởi giá trị của localField
+func localIDs(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+// Package query chứa logic truy vấn dùng chung: so khớp filter và aggregation.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// MatchFilter checks if a document matches a filter query
+// Supports equality, operators: $gt, $gte, $lt, $lte, $ne, $in, $nin,
+// $exists, $regex (kèm $options), $not,
+// mảng: $all, $size, $elemMatch (giá trị đơn khớp một phần tử bất kỳ, xem matchField),
+// ngày: $dateGt, $dateGte, $dateLt, $dateLte (xem matchDate)
+// logical operators: $and, $or, $nor, $not (lồng nhau tùy ý)
+// and expressions: $expr (xem Expr), toàn văn: $text (xem matchText)
+func MatchFilter(doc map[string]interface{}, filter map[string]interface{}) bool {
+	return MatchFilterWith(doc, filter, nil)
+}
+
+// MatchFilterWith giống MatchFilter nhưng so sánh chuỗi theo collation
+// (bằng nhau, $in/$nin, $gt/$lt...). $regex không bị ảnh hưởng.
+func MatchFilterWith(doc map[string]interface{}, filter map[string]interface{}, coll *Collation) bool {
+	for k, v := range filter {
+		switch strings.ToLower(k) {
+		case "$and":
+			subs, ok := subFilters(v)
+			if !ok {
+				return false
+			}
+			for _, sub := range subs {
+				if !MatchFilterWith(doc, sub, coll) {
+					return false
+				}
+			}
+		case "$or":
+			subs, ok := subFilters(v)
+			if !ok {
+				return false
+			}
+			matched := false
+			for _, sub := range subs {
+				if MatchFilterWith(doc, sub, coll) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		case "$nor":
+			subs, ok := subFilters(v)
+			if !ok {
+				return false
+			}
+			for _, sub := range subs {
+				if MatchFilterWith(doc, sub, coll) {
+					return false
+				}
+			}
+		case "$text":
+			// Tìm kiếm toàn văn: {"$text": {"$search": "áo đỏ"}}
+			if !matchText(doc, v) {
+				return false
+			}
+		case "$expr":
+			// Biểu thức tự do: {"$expr": "doc.price * doc.qty > 1000"}
+			if !matchExpr(doc, v) {
+				return false
+			}
+		case "$not":
+			// Dạng cấp cao nhất: {"$not": {<filter>}}
+			sub, ok := v.(map[string]interface{})
+			if !ok || MatchFilterWith(doc, sub, coll) {
+				return false
+			}
+		default:
+			// k có thể là đường dẫn lồng nhau: "address.city", "items.0.sku"
+			val, exists := GetPath(doc, k)
+			if !matchField(val, exists, v, coll) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// subFilters chuyển giá trị của $and/$or/$nor thành danh sách filter
+func subFilters(v interface{}) ([]map[string]interface{}, bool) {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil, false
+	}
+	out := make([]map[string]interface{}, 0, len(arr))
+	for _, item := range arr {
+		sub, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		out = append(out, sub)
+	}
+	return out, true
+}
+
+// matchField kiểm tra giá trị của một field với điều kiện
+// (so sánh trực tiếp hoặc một map toán tử).
+// exists = false khi document không có field (val = nil, giống null;
+// chỉ $exists phân biệt hai trường hợp).
+// Như MongoDB, nếu field là mảng thì điều kiện so sánh khớp khi cả mảng
+// hoặc một phần tử bất kỳ thỏa mãn ({"tags": "sale"} khớp ["new", "sale"]);
+// mỗi toán tử được xét riêng, nên {"$gt": 1, "$lt": 5} có thể được thỏa
+// bởi hai phần tử khác nhau (dùng $elemMatch để buộc cùng một phần tử).
+func matchField(val interface{}, exists bool, cond interface{}, coll *Collation) bool {
+	// case toán tử (vd: {"rating": {"$gt": 5}})
+	fv, ok := cond.(map[string]interface{})
+	if !ok || (len(fv) > 0 && !isOperatorMap(fv)) {
+		// case: so sánh trực tiếp (kể cả với object con)
+		return anyValue(val, func(v interface{}) bool { return collEquals(coll, v, cond) })
+	}
+
+	for op, arg := range fv {
+		switch strings.ToLower(op) {
+		case "$gt":
+			if !anyValue(val, func(v interface{}) bool { c, ok := compareOrdered(coll, v, arg); return ok && c > 0 }) {
+				return false
+			}
+		case "$gte":
+			if !anyValue(val, func(v interface{}) bool { c, ok := compareOrdered(coll, v, arg); return ok && c >= 0 }) {
+				return false
+			}
+		case "$lt":
+			if !anyValue(val, func(v interface{}) bool { c, ok := compareOrdered(coll, v, arg); return ok && c < 0 }) {
+				return false
+			}
+		case "$lte":
+			if !anyValue(val, func(v interface{}) bool { c, ok := compareOrdered(coll, v, arg); return ok && c <= 0 }) {
+				return false
+			}
+		case "$ne":
+			if anyValue(val, func(v interface{}) bool { return collEquals(coll, v, arg) }) {
+				return false
+			}
+		case "$in":
+			arr, ok := arg.([]interface{})
+			if !ok || !anyValue(val, func(v interface{}) bool { return inValues(coll, v, arr) }) {
+				return false
+			}
+		case "$nin":
+			arr, ok := arg.([]interface{})
+			if !ok || anyValue(val, func(v interface{}) bool { return inValues(coll, v, arr) }) {
+				return false
+			}
+		case "$exists":
+			want, ok := arg.(bool)
+			if !ok || exists != want {
+				return false
+			}
+		case "$regex":
+			re, err := compileRegex(arg, fv["$options"])
+			if err != nil || !anyValue(val, func(v interface{}) bool { s, isStr := v.(string); return isStr && re.MatchString(s) }) {
+				return false
+			}
+		case "$dategt", "$dategte", "$datelt", "$datelte":
+			op := strings.ToLower(op)
+			if !anyValue(val, func(v interface{}) bool { return matchDate(v, arg, op) }) {
+				return false
+			}
+		case "$size":
+			arr, isArr := val.([]interface{})
+			n, ok := toNumber(arg)
+			if !isArr || !ok || n.cmp(number{i: int64(len(arr)), isInt: true}) != 0 {
+				return false
+			}
+		case "$all":
+			if !matchAll(val, exists, arg, coll) {
+				return false
+			}
+		case "$elemmatch":
+			if !matchElem(val, arg, coll) {
+				return false
+			}
+		case "$options":
+			// Đi kèm $regex
+		case "$not":
+			// Dạng cấp field: {"price": {"$not": {"$gt": 100}}}
+			if matchField(val, exists, arg, coll) {
+				return false
+			}
+		default:
+			// chưa hỗ trợ toán tử này
+			return false
+		}
+	}
+	return true
+}
+
+// anyValue: pred đúng với val, hoặc với một phần tử nếu val là mảng
+func anyValue(val interface{}, pred func(v interface{}) bool) bool {
+	if pred(val) {
+		return true
+	}
+	if arr, ok := val.([]interface{}); ok {
+		for _, item := range arr {
+			if pred(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchAll: mọi phần tử của arg đều có trong val ({"tags": {"$all": ["a", "b"]}}).
+// Phần tử dạng {"$elemMatch": {...}} được xét như điều kiện. $all rỗng không khớp gì.
+func matchAll(val interface{}, exists bool, arg interface{}, coll *Collation) bool {
+	items, ok := arg.([]interface{})
+	if !ok || len(items) == 0 {
+		return false
+	}
+	for _, item := range items {
+		if isOperatorMap(item) {
+			if !matchField(val, exists, item, coll) {
+				return false
+			}
+			continue
+		}
+		if !anyValue(val, func(v interface{}) bool { return collEquals(coll, v, item) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchElem: val là mảng có ít nhất một phần tử thỏa mọi điều kiện của arg.
+// arg là điều kiện trên chính phần tử ({"$gte": 80, "$lt": 85}) hoặc
+// filter trên phần tử dạng object ({"sku": "A1", "qty": {"$gt": 2}}).
+func matchElem(val interface{}, arg interface{}, coll *Collation) bool {
+	arr, isArr := val.([]interface{})
+	cond, ok := arg.(map[string]interface{})
+	if !isArr || !ok {
+		return false
+	}
+	onValue := elemMatchOnValue(cond)
+	for _, item := range arr {
+		if onValue {
+			if matchField(item, true, cond, coll) {
+				return true
+			}
+			continue
+		}
+		if sub, ok := item.(map[string]interface{}); ok && MatchFilterWith(sub, cond, coll) {
+			return true
+		}
+	}
+	return false
+}
+
+// elemMatchOnValue: điều kiện $elemMatch chỉ gồm toán tử field (không có
+// tên field hay toán tử logic) thì áp dụng lên chính phần tử
+func elemMatchOnValue(cond map[string]interface{}) bool {
+	if !isOperatorMap(cond) {
+		return false
+	}
+	for k := range cond {
+		switch strings.ToLower(k) {
+		case "$and", "$or", "$nor", "$expr", "$text":
+			return false
+		}
+	}
+	return true
+}
+
+// compareOrdered so sánh hai giá trị cùng kiểu số hoặc cùng kiểu chuỗi
+// (chuỗi theo collation). Khác kiểu thì không so sánh được.
+func compareOrdered(coll *Collation, a, b interface{}) (int, bool) {
+	if na, ok := toNumber(a); ok {
+		nb, ok := toNumber(b)
+		if !ok {
+			return 0, false
+		}
+		return na.cmp(nb), true
+	}
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok {
+			return strings.Compare(coll.Key(sa), coll.Key(sb)), true
+		}
+	}
+	return 0, false
+}
+
+func inValues(coll *Collation, val interface{}, arr []interface{}) bool {
+	for _, av := range arr {
+		if collEquals(coll, val, av) {
+			return true
+		}
+	}
+	return false
+}
+
+// Pattern $regex đã biên dịch, dùng lại giữa các document và request
+const maxRegexLen = 512
+
+var regexCache sync.Map // options + "/" + pattern -> *regexp.Regexp
+
+// compileRegex biên dịch $regex với $options (chỉ hỗ trợ i, m, s).
+// Go regexp (RE2) chạy tuyến tính nên pattern từ client không gây ReDoS.
+func compileRegex(pattern, options interface{}) (*regexp.Regexp, error) {
+	src, ok := pattern.(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: $regex must be a string", ErrInvalidFilter)
+	}
+	opts := ""
+	if options != nil {
+		if opts, ok = options.(string); !ok {
+			return nil, fmt.Errorf("%w: $options must be a string", ErrInvalidFilter)
+		}
+	}
+	key := opts + "/" + src
+	if cached, ok := regexCache.Load(key); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	if len(src) > maxRegexLen {
+		return nil, fmt.Errorf("%w: $regex longer than %d characters", ErrInvalidFilter, maxRegexLen)
+	}
+	for _, f := range opts {
+		if !strings.ContainsRune("ims", f) {
+			return nil, fmt.Errorf("%w: unsupported $options flag %q", ErrInvalidFilter, f)
+		}
+	}
+	if opts != "" {
+		src = "(?" + opts + ")" + src
+	}
+	re, err := regexp.Compile(src)
+	if err != nil {
+		return nil, fmt.Errorf("%w: $regex: %v", ErrInvalidFilter, err)
+	}
+	if syncMapLen(&regexCache) < maxExprCache {
+		regexCache.Store(key, re)
+	}
+	return re, nil
+}
+
+// collEquals so sánh bằng, chuỗi được so theo collation
+func collEquals(coll *Collation, a, b interface{}) bool {
+	if coll != nil {
+		if sa, ok := a.(string); ok {
+			if sb, ok := b.(string); ok {
+				return coll.Key(sa) == coll.Key(sb)
+			}
+		}
+	}
+	return equals(a, b)
+}
+
+// equals so sánh bằng theo giá trị (xem Equal)
+func equals(a, b interface{}) bool {
+	return Equal(a, b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	n, ok := toNumber(v)
+	return n.float(), ok
+}
+
+func toFloatMust(v interface{}) float64 {
+	if f, ok := toFloat(v); ok {
+		return f
+	}
+	return 0
+}
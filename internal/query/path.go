@@ -0,0 +1,167 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Giới hạn chỉ số mảng khi $set vượt quá độ dài (phần thiếu được điền null)
+const maxArrayPad = 1000
+
+// GetPath đọc giá trị theo đường dẫn có dấu chấm, vd: "address.city"
+// hoặc "items.0.name" (phân đoạn số là chỉ số mảng).
+// Trả về false nếu đường dẫn không tồn tại.
+func GetPath(doc map[string]interface{}, path string) (interface{}, bool) {
+	if !strings.Contains(path, ".") {
+		v, ok := doc[path]
+		return v, ok
+	}
+	var cur interface{} = doc
+	for _, seg := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			v, ok := node[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			cur = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// lookup giống GetPath nhưng trả nil khi không tồn tại
+func lookup(doc map[string]interface{}, path string) interface{} {
+	v, _ := GetPath(doc, path)
+	return v
+}
+
+// setPath gán giá trị theo đường dẫn, tạo object trung gian nếu thiếu
+func setPath(doc map[string]interface{}, path string, value interface{}) error {
+	segs := strings.Split(path, ".")
+	var parent interface{} = doc
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if last {
+				node[seg] = value
+				return nil
+			}
+			next, ok := node[seg]
+			if !ok || next == nil {
+				next = make(map[string]interface{})
+				node[seg] = next
+			}
+			parent = next
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 {
+				return fmt.Errorf("cannot use %q as an array index in %q", seg, path)
+			}
+			if idx >= len(node) {
+				// Mảng không thể mở rộng tại chỗ (slice nằm trong object cha)
+				return fmt.Errorf("array index %d out of range in %q", idx, path)
+			}
+			if last {
+				node[idx] = value
+				return nil
+			}
+			if node[idx] == nil {
+				node[idx] = make(map[string]interface{})
+			}
+			parent = node[idx]
+		default:
+			return fmt.Errorf("cannot create field %q in a non-object value (path %q)", seg, path)
+		}
+	}
+	return nil
+}
+
+// unsetPath xóa field theo đường dẫn (phần tử mảng được đặt về null)
+func unsetPath(doc map[string]interface{}, path string) {
+	segs := strings.Split(path, ".")
+	parentPath := strings.Join(segs[:len(segs)-1], ".")
+	leaf := segs[len(segs)-1]
+
+	var parent interface{} = doc
+	if parentPath != "" {
+		var ok bool
+		if parent, ok = GetPath(doc, parentPath); !ok {
+			return
+		}
+	}
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		delete(node, leaf)
+	case []interface{}:
+		if idx, err := strconv.Atoi(leaf); err == nil && idx >= 0 && idx < len(node) {
+			node[idx] = nil
+		}
+	}
+}
+
+// padArrayPath đảm bảo mảng tại đường dẫn cha đủ dài cho chỉ số cuối
+// (để $set "items.5" trên mảng 3 phần tử điền null như MongoDB)
+func padArrayPath(doc map[string]interface{}, path string) error {
+	dot := strings.LastIndexByte(path, '.')
+	if dot < 0 {
+		return nil
+	}
+	idx, err := strconv.Atoi(path[dot+1:])
+	if err != nil {
+		return nil
+	}
+	parentPath := path[:dot]
+	arr, ok := lookup(doc, parentPath).([]interface{})
+	if !ok || idx < len(arr) {
+		return nil
+	}
+	if idx-len(arr) > maxArrayPad {
+		return fmt.Errorf("array index %d in %q is too far past the end", idx, path)
+	}
+	padded := append(make([]interface{}, 0, idx+1), arr...)
+	for len(padded) <= idx {
+		padded = append(padded, nil)
+	}
+	return setPath(doc, parentPath, padded)
+}
+
+// deepCopy sao chép object/mảng lồng nhau (giá trị vô hướng dùng chung)
+func deepCopy(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			out[k] = deepCopy(val)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, val := range t {
+			out[i] = deepCopy(val)
+		}
+		return out
+	}
+	return v
+}
+
+// pathsOverlap: hai đường dẫn trùng nhau hoặc một cái là cha của cái kia
+func pathsOverlap(a, b string) bool {
+	if a == b {
+		return true
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	return strings.HasPrefix(b, a+".")
+}
@@ -0,0 +1,98 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Tokenize tách chuỗi thành các từ để tìm kiếm toàn văn:
+// chữ thường, bỏ dấu, tách tại ký tự không phải chữ/số.
+// Từ một ký tự bị bỏ qua (trừ chữ số).
+func Tokenize(s string) []string {
+	s = foldAccents(strings.ToLower(s))
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	out := fields[:0]
+	for _, f := range fields {
+		if len([]rune(f)) < 2 && !unicode.IsDigit([]rune(f)[0]) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// TextTerms đếm tần suất các từ trong các field của document.
+// Field có thể là chuỗi hoặc mảng chuỗi; fields rỗng = mọi chuỗi trong document.
+func TextTerms(doc map[string]interface{}, fields []string) map[string]int {
+	terms := make(map[string]int)
+	if len(fields) == 0 {
+		collectText(doc, terms)
+		return terms
+	}
+	for _, f := range fields {
+		if v, ok := GetPath(doc, f); ok {
+			collectText(v, terms)
+		}
+	}
+	return terms
+}
+
+func collectText(v interface{}, terms map[string]int) {
+	switch t := v.(type) {
+	case string:
+		for _, tok := range Tokenize(t) {
+			terms[tok]++
+		}
+	case []interface{}:
+		for _, item := range t {
+			collectText(item, terms)
+		}
+	case map[string]interface{}:
+		for _, item := range t {
+			collectText(item, terms)
+		}
+	}
+}
+
+// TextSearch đọc toán tử $text: {"$search": "áo đỏ"} hoặc dạng rút gọn "áo đỏ".
+// Trả về các từ (đã tách, không trùng) của chuỗi tìm kiếm.
+func TextSearch(v interface{}) ([]string, error) {
+	search, ok := v.(string)
+	if m, isMap := v.(map[string]interface{}); isMap {
+		search, ok = m["$search"].(string)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: $text expects {\"$search\": \"<words>\"}", ErrInvalidFilter)
+	}
+	seen := make(map[string]struct{})
+	terms := make([]string, 0)
+	for _, tok := range Tokenize(search) {
+		if _, dup := seen[tok]; !dup {
+			seen[tok] = struct{}{}
+			terms = append(terms, tok)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: $text search has no words", ErrInvalidFilter)
+	}
+	return terms, nil
+}
+
+// matchText: document khớp nếu chứa ít nhất một từ của $search
+// (quét mọi field chuỗi; có text index thì index chọn ứng viên trước)
+func matchText(doc map[string]interface{}, v interface{}) bool {
+	terms, err := TextSearch(v)
+	if err != nil {
+		return false
+	}
+	docTerms := TextTerms(doc, nil)
+	for _, t := range terms {
+		if docTerms[t] > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,218 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidUpdate được trả về khi update document không hợp lệ
+var ErrInvalidUpdate = errors.New("invalid update")
+
+// Thứ tự áp dụng cố định để kết quả không phụ thuộc thứ tự duyệt map
+var updateOps = []string{"$set", "$unset", "$inc", "$push", "$addToSet", "$pull", "$rename"}
+
+// ApplyUpdate áp dụng các toán tử update lên doc (sửa trực tiếp doc).
+// Hỗ trợ: $set, $unset, $inc, $push, $addToSet, $pull, $rename.
+// Field có thể là đường dẫn có dấu chấm ("address.city", "items.0.qty").
+// Toàn bộ update được kiểm tra trước; nếu có lỗi, doc không bị thay đổi.
+func ApplyUpdate(doc map[string]interface{}, update map[string]interface{}) error {
+	if len(update) == 0 {
+		return fmt.Errorf("%w: empty update", ErrInvalidUpdate)
+	}
+
+	// Kiểm tra toán tử và xung đột field giữa các toán tử
+	type touch struct{ path, op string }
+	touched := make([]touch, 0, 4)
+	for op, arg := range update {
+		if !isUpdateOp(op) {
+			return fmt.Errorf("%w: unsupported operator %s", ErrInvalidUpdate, op)
+		}
+		fields, ok := arg.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%w: %s expects an object", ErrInvalidUpdate, op)
+		}
+		for f, v := range fields {
+			if f == "_id" || strings.HasPrefix(f, "_id.") {
+				return fmt.Errorf("%w: %s: _id cannot be modified", ErrInvalidUpdate, op)
+			}
+			targets := []string{f}
+			if op == "$rename" {
+				to, ok := v.(string)
+				if !ok || to == "" || to == f {
+					return fmt.Errorf("%w: $rename: new name for %q must be a different non-empty string", ErrInvalidUpdate, f)
+				}
+				if to == "_id" || strings.HasPrefix(to, "_id.") {
+					return fmt.Errorf("%w: $rename: _id cannot be modified", ErrInvalidUpdate)
+				}
+				targets = append(targets, to)
+			}
+			for _, t := range targets {
+				for _, prev := range touched {
+					if pathsOverlap(prev.path, t) {
+						return fmt.Errorf("%w: fields %q (%s) and %q (%s) conflict", ErrInvalidUpdate, prev.path, prev.op, t, op)
+					}
+				}
+				touched = append(touched, touch{path: t, op: op})
+			}
+		}
+	}
+
+	// Áp dụng trên bản sao để lỗi kiểu dữ liệu không để lại thay đổi dở dang
+	out := deepCopy(doc).(map[string]interface{})
+	for _, op := range updateOps {
+		arg, ok := update[op]
+		if !ok {
+			continue
+		}
+		fields := arg.(map[string]interface{})
+		for _, f := range sortedKeys(fields) {
+			if err := applyUpdateOp(out, op, f, fields[f]); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidUpdate, op, err)
+			}
+		}
+	}
+
+	for k := range doc {
+		delete(doc, k)
+	}
+	for k, v := range out {
+		doc[k] = v
+	}
+	return nil
+}
+
+func isUpdateOp(op string) bool {
+	for _, o := range updateOps {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+func applyUpdateOp(doc map[string]interface{}, op, field string, arg interface{}) error {
+	cur, exists := GetPath(doc, field)
+
+	switch op {
+	case "$set":
+		if err := padArrayPath(doc, field); err != nil {
+			return err
+		}
+		return setPath(doc, field, arg)
+
+	case "$unset":
+		unsetPath(doc, field)
+
+	case "$inc":
+		delta, ok := toFloat(arg)
+		if !ok {
+			return fmt.Errorf("amount for %q must be a number", field)
+		}
+		if !exists {
+			return setPath(doc, field, delta)
+		}
+		n, ok := toFloat(cur)
+		if !ok {
+			return fmt.Errorf("field %q is not a number", field)
+		}
+		return setPath(doc, field, n+delta)
+
+	case "$push", "$addToSet":
+		arr, err := arrayField(field, cur, exists)
+		if err != nil {
+			return err
+		}
+		for _, item := range eachItems(arg) {
+			if op == "$addToSet" && containsValue(arr, item) {
+				continue
+			}
+			arr = append(arr, item)
+		}
+		return setPath(doc, field, arr)
+
+	case "$pull":
+		if !exists {
+			return nil
+		}
+		arr, err := arrayField(field, cur, exists)
+		if err != nil {
+			return err
+		}
+		kept := make([]interface{}, 0, len(arr))
+		for _, item := range arr {
+			// Điều kiện dạng toán tử ({"$gt": 5}) hoặc so sánh bằng
+			if isOperatorMap(arg) {
+				if matchField(item, true, arg, nil) {
+					continue
+				}
+			} else if Equal(item, arg) {
+				continue
+			}
+			kept = append(kept, item)
+		}
+		return setPath(doc, field, kept)
+
+	case "$rename":
+		if !exists {
+			return nil
+		}
+		unsetPath(doc, field)
+		return setPath(doc, arg.(string), cur)
+	}
+	return nil
+}
+
+func arrayField(field string, cur interface{}, exists bool) ([]interface{}, error) {
+	if !exists || cur == nil {
+		return make([]interface{}, 0), nil
+	}
+	arr, ok := cur.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("field %q is not an array", field)
+	}
+	// Sao chép để không sửa mảng của document gốc
+	return append(make([]interface{}, 0, len(arr)+1), arr...), nil
+}
+
+// eachItems hỗ trợ dạng {"$each": [...]} của $push/$addToSet
+func eachItems(arg interface{}) []interface{} {
+	if m, ok := arg.(map[string]interface{}); ok && len(m) == 1 {
+		if each, ok := m["$each"].([]interface{}); ok {
+			return each
+		}
+	}
+	return []interface{}{arg}
+}
+
+func containsValue(arr []interface{}, v interface{}) bool {
+	for _, item := range arr {
+		if Equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOperatorMap(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok || len(m) == 0 {
+		return false
+	}
+	for k := range m {
+		if len(k) == 0 || k[0] != '$' {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
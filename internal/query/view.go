@@ -0,0 +1,115 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ErrInvalidView: định nghĩa view không hợp lệ (lỗi của client)
+var ErrInvalidView = errors.New("invalid view")
+
+// View là cách trình bày document trong response (?view=<tên>), giúp client
+// như ứng dụng di động chỉ nhận đúng phần cần dùng. Các bước được áp dụng
+// theo thứ tự: chọn field, đổi tên field, làm phẳng object lồng nhau.
+// Dữ liệu lưu trên đĩa không bị thay đổi.
+type View struct {
+	// Fields: chỉ giữ các field này (đường dẫn có dấu chấm) cùng _id; rỗng = giữ tất cả
+	Fields []string `json:"fields,omitempty"`
+	// Rename: đường dẫn cũ -> đường dẫn mới, vd. {"seller.name": "sellerName"}
+	Rename map[string]string `json:"rename,omitempty"`
+	// Flatten: {"size": {"w": 1}} -> {"size.w": 1} (mảng được giữ nguyên)
+	Flatten   bool   `json:"flatten,omitempty"`
+	Separator string `json:"separator,omitempty"` // Ngăn cách khi làm phẳng (mặc định ".")
+}
+
+// Validate kiểm tra định nghĩa view
+func (v *View) Validate() error {
+	for _, f := range v.Fields {
+		if f == "" {
+			return fmt.Errorf("%w: fields must not be empty", ErrInvalidView)
+		}
+	}
+	targets := make(map[string]string, len(v.Rename))
+	for from, to := range v.Rename {
+		if from == "" || to == "" {
+			return fmt.Errorf("%w: rename paths must not be empty", ErrInvalidView)
+		}
+		if prev, ok := targets[to]; ok {
+			return fmt.Errorf("%w: renames both %q and %q to %q", ErrInvalidView, prev, from, to)
+		}
+		targets[to] = from
+	}
+	if v.Separator != "" && !v.Flatten {
+		return fmt.Errorf("%w: separator requires flatten", ErrInvalidView)
+	}
+	return nil
+}
+
+// Apply trả về bản sao của doc đã được trình bày theo view
+func (v *View) Apply(doc map[string]interface{}) map[string]interface{} {
+	var out map[string]interface{}
+	if len(v.Fields) == 0 {
+		out = deepCopy(doc).(map[string]interface{})
+	} else {
+		out = make(map[string]interface{}, len(v.Fields)+1)
+		if id, ok := doc["_id"]; ok {
+			out["_id"] = id
+		}
+		for _, f := range v.Fields {
+			if val, ok := GetPath(doc, f); ok {
+				setPath(out, f, deepCopy(val))
+			}
+		}
+	}
+
+	if len(v.Rename) > 0 {
+		from := make([]string, 0, len(v.Rename))
+		for f := range v.Rename {
+			from = append(from, f)
+		}
+		sort.Strings(from)
+		// Đọc hết giá trị trước khi gán để các lần đổi tên không ảnh hưởng lẫn nhau
+		vals := make([]interface{}, len(from))
+		found := make([]bool, len(from))
+		for i, f := range from {
+			vals[i], found[i] = GetPath(out, f)
+		}
+		for i, f := range from {
+			if found[i] {
+				unsetPath(out, f)
+			}
+		}
+		for i, f := range from {
+			if found[i] {
+				setPath(out, v.Rename[f], vals[i])
+			}
+		}
+	}
+
+	if v.Flatten {
+		sep := v.Separator
+		if sep == "" {
+			sep = "."
+		}
+		flat := make(map[string]interface{}, len(out))
+		flattenInto(flat, "", sep, out)
+		out = flat
+	}
+	return out
+}
+
+// flattenInto ghi các field lá của m vào out với tên nối bởi sep
+func flattenInto(out map[string]interface{}, prefix, sep string, m map[string]interface{}) {
+	for k, val := range m {
+		name := k
+		if prefix != "" {
+			name = prefix + sep + k
+		}
+		if sub, ok := val.(map[string]interface{}); ok && len(sub) > 0 {
+			flattenInto(out, name, sep, sub)
+			continue
+		}
+		out[name] = val
+	}
+}